@@ -0,0 +1,7 @@
+package main
+
+import "github.com/lao-tseu-is-alive/JsonSiteGo/pkg/server"
+
+func main() {
+	server.Main()
+}
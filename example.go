@@ -0,0 +1,10 @@
+// Package jsonsitego embeds the example site of the repository in the server, so that a single binary can write it
+// and serve it with the example subcommand.
+package jsonsitego
+
+import "embed"
+
+// ExampleSite holds the config, its schema, the templates and the favicon of the example site.
+//
+//go:embed config.json config.schema.json favicon.ico templates
+var ExampleSite embed.FS
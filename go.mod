@@ -2,7 +2,11 @@ module github.com/lao-tseu-is-alive/JsonSiteGo
 
 go 1.25
 
-require github.com/xeipuuv/gojsonschema v1.2.0
+require (
+	github.com/xeipuuv/gojsonschema v1.2.0
+	golang.org/x/image v0.23.0
+	golang.org/x/text v0.21.0
+)
 
 require (
 	github.com/xeipuuv/gojsonpointer v0.0.0-20180127040702-4e3ac2762d5f // indirect
@@ -0,0 +1,85 @@
+// Package sigv4 signs the requests to the AWS compatible apis, like S3 and Secrets Manager, with AWS Signature
+// Version 4, so that the packages calling them share one implementation.
+package sigv4
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Credentials are the keys signing the requests, SessionToken is set for temporary credentials like the ones of an
+// IAM role or of STS.
+type Credentials struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+}
+
+// Sign adds the x-amz-date, the x-amz-security-token of temporary credentials and the Authorization headers to req
+// for the service in region. path and rawQuery are the canonical uri and query of the request, payloadHash the
+// SHA256Hex of its body, and headers the names of the other headers of req to sign, like content-type.
+func Sign(req *http.Request, creds Credentials, region, service, path, rawQuery, payloadHash string, headers []string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	day := now.UTC().Format("20060102")
+	req.Header.Set("x-amz-date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("x-amz-security-token", creds.SessionToken)
+	}
+
+	names := []string{"host", "x-amz-date"}
+	if creds.SessionToken != "" {
+		names = append(names, "x-amz-security-token")
+	}
+	for _, h := range headers {
+		if h = strings.ToLower(h); !slices.Contains(names, h) {
+			names = append(names, h)
+		}
+	}
+	slices.Sort(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		rawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + SHA256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKey, scope, signedHeaders, signature))
+}
+
+// SHA256Hex returns the hex encoded sha256 of b, the payload hash of a request body.
+func SHA256Hex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,115 @@
+// Package siteerrors defines the errors of the handlers by kind, like a page not found or a forbidden access, so
+// that the server renders all of them with a single function choosing the status, the error page and the json
+// envelope of their kind. the cause of an error is wrapped, it is logged but never shown to the visitors.
+package siteerrors
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Kind is the category of an error, it gives its http status.
+type Kind int
+
+const (
+	KindInternal     Kind = iota // a failure of the server, like a template error, 500
+	KindNotFound                 // the resource does not exist, 404
+	KindForbidden                // the visitor is not allowed, 403
+	KindUnauthorized             // the visitor must authenticate, 401
+	KindValidation               // the request is invalid, like a missing parameter, 400
+	KindUnavailable              // the site is not available for now, like in maintenance, 503
+)
+
+// Status returns the http status of the kind.
+func (k Kind) Status() int {
+	switch k {
+	case KindNotFound:
+		return http.StatusNotFound
+	case KindForbidden:
+		return http.StatusForbidden
+	case KindUnauthorized:
+		return http.StatusUnauthorized
+	case KindValidation:
+		return http.StatusBadRequest
+	case KindUnavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// Error is an error of a kind, with the message shown to the visitor and its cause.
+type Error struct {
+	Kind    Kind
+	Message string // shown to the visitor, a default one of the kind is used when empty
+	Err     error  // cause, may be nil
+}
+
+// Error returns the message followed by the cause.
+func (e *Error) Error() string {
+	switch {
+	case e.Err == nil:
+		return e.Message
+	case e.Message == "":
+		return e.Err.Error()
+	}
+	return e.Message + ": " + e.Err.Error()
+}
+
+// Unwrap returns the cause, so that errors.Is and errors.As see it.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Status returns the http status of the kind of the error.
+func (e *Error) Status() int {
+	return e.Kind.Status()
+}
+
+// NotFound returns an error of KindNotFound.
+func NotFound(message string) *Error {
+	return &Error{Kind: KindNotFound, Message: message}
+}
+
+// Forbidden returns an error of KindForbidden.
+func Forbidden(message string) *Error {
+	return &Error{Kind: KindForbidden, Message: message}
+}
+
+// Unauthorized returns an error of KindUnauthorized.
+func Unauthorized(message string) *Error {
+	return &Error{Kind: KindUnauthorized, Message: message}
+}
+
+// Validation returns an error of KindValidation.
+func Validation(message string) *Error {
+	return &Error{Kind: KindValidation, Message: message}
+}
+
+// Unavailable returns an error of KindUnavailable.
+func Unavailable(message string) *Error {
+	return &Error{Kind: KindUnavailable, Message: message}
+}
+
+// Internal returns an error of KindInternal wrapping err.
+func Internal(err error) *Error {
+	return &Error{Kind: KindInternal, Err: err}
+}
+
+// Wrap returns an error of kind with message wrapping err.
+func Wrap(kind Kind, message string, err error) *Error {
+	return &Error{Kind: kind, Message: message, Err: err}
+}
+
+// From returns the first *Error in the chain of err, or err wrapped by Internal when there is none.
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return Internal(err)
+}
+
+// KindOf returns the kind of the first *Error in the chain of err, KindInternal when there is none.
+func KindOf(err error) Kind {
+	return From(err).Kind
+}
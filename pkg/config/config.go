@@ -0,0 +1,83 @@
+// Package config loads the json configuration of a JsonSiteGo site: it reads the base config and its APP_ENV overlay
+// from files, urls or stdin, resolves their secret values, validates the merged json against the schema and decodes
+// it. the problems are returned as a *ValidationError giving the position of each one in the source files, the
+// checks of the meaning of the values are done by the server on the decoded config.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// ValidateSchema returns the problems of the json data against the schema at schemaPath, a local file or an http(s)
+// url. a missing local schema only gives a warning, the config is then not validated.
+func ValidateSchema(data []byte, schemaPath string, l *log.Logger) ([]Error, error) {
+	var schemaLoader gojsonschema.JSONLoader
+	if strings.HasPrefix(schemaPath, "http://") || strings.HasPrefix(schemaPath, "https://") {
+		l.Printf("Attempting to load remote JSON schema from: %s", schemaPath)
+		schemaLoader = gojsonschema.NewReferenceLoader(schemaPath)
+	} else if _, err := os.Stat(schemaPath); os.IsNotExist(err) {
+		l.Printf("WARNING: Local JSON schema file not found at '%s'. Skipping validation.", schemaPath)
+		return nil, nil
+	} else {
+		absSchemaPath, err := filepath.Abs(schemaPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not get absolute path for schema: %w", err)
+		}
+		l.Printf("Loading local JSON schema from: %s", absSchemaPath)
+		schemaLoader = gojsonschema.NewReferenceLoader("file://" + absSchemaPath)
+	}
+	result, err := gojsonschema.Validate(schemaLoader, gojsonschema.NewBytesLoader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error during JSON schema validation: %w", err)
+	}
+	if !result.Valid() {
+		return SchemaErrors(result, ""), nil
+	}
+	l.Println("✅ Configuration file validated successfully against schema.")
+	return nil, nil
+}
+
+// Decode resolves the secret values of the merged json data of the config sources, validates it against the schema,
+// then decodes it into v and logs its unknown fields as warnings. a config that is not trusted, the one of a tenant,
+// a preview or an editor, cannot have secret values. it returns the json pointers of the secret values, to give to
+// MaskSecrets with the problems found later in the decoded config.
+func Decode(sources []Source, data []byte, schemaPath string, trusted bool, v interface{}, l *log.Logger) (map[string]bool, error) {
+	// the config is validated and decoded with its secrets decrypted and resolved, the history keeps them as written
+	plain, secretPointers, problems := ResolveSecrets(data, trusted)
+	if len(problems) > 0 {
+		cfgErr := NewValidationError(sources, problems)
+		l.Printf("%v", cfgErr)
+		return nil, cfgErr
+	}
+	problems, err := ValidateSchema(plain, schemaPath, l)
+	if err != nil {
+		return nil, err
+	}
+	if len(problems) > 0 {
+		cfgErr := NewValidationError(sources, MaskSecrets(problems, secretPointers))
+		l.Printf("%v", cfgErr)
+		return nil, cfgErr
+	}
+	if err := json.Unmarshal(plain, v); err != nil {
+		return nil, err
+	}
+	unknownFields, err := UnknownFields(plain, reflect.TypeOf(v))
+	if err != nil {
+		return nil, err
+	}
+	if len(unknownFields) > 0 {
+		warnings := NewValidationError(sources, MaskSecrets(unknownFields, secretPointers))
+		for _, ce := range warnings.Errors {
+			l.Printf("⚠️ WARNING: %s", warnings.FormatError(ce))
+		}
+	}
+	return secretPointers, nil
+}
@@ -0,0 +1,203 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// Error is one problem found in the configuration file.
+type Error struct {
+	Pointer string      // RFC 6901 json pointer of the offending value, like /pages/2/route
+	Value   interface{} // the offending value, nil when it is missing
+	File    string      // the source file of the value, the base config or one of its overlays
+	Line    int         // 1-based position of the value in the source file, 0 when unknown
+	Column  int
+	Message string
+}
+
+// DisplayPointer returns the json pointer of the error, or "(root)" for the whole document.
+func (ce Error) DisplayPointer() string {
+	if ce.Pointer == "" {
+		return gojsonschema.STRING_CONTEXT_ROOT
+	}
+	return ce.Pointer
+}
+
+// ValidationError lists all the problems found in a configuration file.
+type ValidationError struct {
+	Path   string
+	Errors []Error
+}
+
+func (e *ValidationError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "💥💥 %d errors in configuration file %s:", len(e.Errors), e.Path)
+	for _, ce := range e.Errors {
+		sb.WriteString("\n- ")
+		sb.WriteString(e.FormatError(ce))
+	}
+	return sb.String()
+}
+
+// FormatError returns one error on a line like config.json:12:5 /pages/1/route: message (got value).
+func (e *ValidationError) FormatError(ce Error) string {
+	var sb strings.Builder
+	if ce.Line > 0 {
+		fmt.Fprintf(&sb, "%s:%d:%d ", ce.File, ce.Line, ce.Column)
+	}
+	fmt.Fprintf(&sb, "%s: %s", ce.DisplayPointer(), ce.Message)
+	if ce.Value != nil {
+		fmt.Fprintf(&sb, " (got %s)", FormatValue(ce.Value))
+	}
+	return sb.String()
+}
+
+// FormatValue returns a short json representation of an offending value.
+func FormatValue(value interface{}) string {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	const maxLen = 80
+	if len(raw) > maxLen {
+		return string(raw[:maxLen]) + "…"
+	}
+	return string(raw)
+}
+
+// schemaFieldToPointer converts a gojsonschema field like pages.1.route into the json pointer /pages/1/route.
+func schemaFieldToPointer(field string) string {
+	if field == "" || field == gojsonschema.STRING_CONTEXT_ROOT {
+		return ""
+	}
+	parts := strings.Split(field, ".")
+	for i, p := range parts {
+		parts[i] = strings.ReplaceAll(strings.ReplaceAll(p, "~", "~0"), "/", "~1")
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+// SchemaErrors converts the errors of a gojsonschema result, prefix is prepended to the pointers.
+func SchemaErrors(result *gojsonschema.Result, prefix string) []Error {
+	var errs []Error
+	for _, desc := range result.Errors() {
+		ce := Error{
+			Pointer: prefix + schemaFieldToPointer(desc.Field()),
+			Message: desc.Description(),
+		}
+		if desc.Type() != "required" {
+			ce.Value = desc.Value()
+		}
+		errs = append(errs, ce)
+	}
+	return errs
+}
+
+// JSONPointerOffsets walks the json document and returns the byte offset of every value by json pointer.
+func JSONPointerOffsets(data []byte) map[string]int64 {
+	offsets := make(map[string]int64)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	var walk func(pointer string) error
+	// valueStart skips the separators between the end of the previous token and the next value
+	valueStart := func() int64 {
+		i := dec.InputOffset()
+		for i < int64(len(data)) && strings.IndexByte(" \t\r\n:,", data[i]) >= 0 {
+			i++
+		}
+		return i
+	}
+	walk = func(pointer string) error {
+		offsets[pointer] = valueStart()
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'):
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				key, _ := keyTok.(string)
+				key = strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+				if err := walk(pointer + "/" + key); err != nil {
+					return err
+				}
+			}
+			_, err = dec.Token()
+			return err
+		case json.Delim('['):
+			for i := 0; dec.More(); i++ {
+				if err := walk(pointer + "/" + strconv.Itoa(i)); err != nil {
+					return err
+				}
+			}
+			_, err = dec.Token()
+			return err
+		}
+		return nil
+	}
+	// a syntax error only stops the walk, the offsets found until there are still useful
+	_ = walk("")
+	return offsets
+}
+
+// getLineColumn converts a byte offset into a 1-based line and column.
+func getLineColumn(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := int(offset) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
+
+// NewValidationError resolves the source position of every error using its json pointer.
+// a pointer absent from the sources (like a missing required key) gets the position of its closest parent,
+// the overlays are searched before the base config since their values win in the merged configuration.
+func NewValidationError(sources []Source, errs []Error) *ValidationError {
+	offsets := make([]map[string]int64, len(sources))
+	for i, src := range sources {
+		offsets[i] = JSONPointerOffsets(src.Data)
+	}
+	for i := range errs {
+		pointer := errs[i].Pointer
+	resolve:
+		for {
+			for s := len(sources) - 1; s >= 0; s-- {
+				if offset, ok := offsets[s][pointer]; ok {
+					errs[i].File = sources[s].Path
+					errs[i].Line, errs[i].Column = getLineColumn(sources[s].Data, offset)
+					break resolve
+				}
+			}
+			cut := strings.LastIndex(pointer, "/")
+			if cut < 0 {
+				break
+			}
+			pointer = pointer[:cut]
+		}
+	}
+	fileOrder := make(map[string]int, len(sources))
+	for i, src := range sources {
+		fileOrder[src.Path] = i
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		if errs[i].File != errs[j].File {
+			return fileOrder[errs[i].File] < fileOrder[errs[j].File]
+		}
+		if errs[i].Line != errs[j].Line {
+			return errs[i].Line < errs[j].Line
+		}
+		return errs[i].Column < errs[j].Column
+	})
+	return &ValidationError{Path: getSourcesName(sources), Errors: errs}
+}
@@ -0,0 +1,220 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/secrets"
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/version"
+)
+
+const (
+	EncryptCommand     = "encrypt"        // subcommand of the server encrypting a secret of the config
+	configSecretPrefix = "ENC[aes256gcm," // encrypted string values of the config look like ENC[aes256gcm,base64]
+	configSecretSuffix = "]"
+	SecretKeySize      = 32               // bytes of the AES-256 key of env CONFIG_SECRET_KEY
+	maskedConfigSecret = "********"       // shown instead of a decrypted or resolved value in the config errors
+	secretRefPrefix    = "secret://"      // string values of the config read from the provider of env SECRETS_URL
+	secretsTimeout     = 30 * time.Second // to resolve all the secret:// values of a config
+)
+
+// the provider of env SECRETS_URL is kept between the loads of the config, with its access token
+var (
+	secretsProviderMu  sync.Mutex
+	secretsProviderURL string
+	secretsProvider    secrets.Provider
+)
+
+var (
+	// ErrNoSecretKey is returned when the config has encrypted values but env CONFIG_SECRET_KEY is not set.
+	ErrNoSecretKey = errors.New("env CONFIG_SECRET_KEY is required to decrypt the encrypted values of the config")
+	// errNoSecretsURL is returned when the config has secret:// values but env SECRETS_URL is not set.
+	errNoSecretsURL = errors.New("env SECRETS_URL is required to resolve the secret:// values of the config, like env:// or file:///run/secrets")
+	// errUntrustedConfigSecret is the problem of a secret value in the config of a tenant, a preview or an editor.
+	errUntrustedConfigSecret = errors.New("the secret:// and ENC[...] values are only allowed in the config of the server, not in the one of a tenant, a preview or an editor")
+)
+
+// SecretKey returns the AES-256 key of env CONFIG_SECRET_KEY, base64 encoded, or nil when it is not set.
+func SecretKey() ([]byte, error) {
+	encoded := strings.TrimSpace(os.Getenv("CONFIG_SECRET_KEY"))
+	if encoded == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != SecretKeySize {
+		return nil, fmt.Errorf("env CONFIG_SECRET_KEY should be %d random bytes in base64, like the output of %s %s -generate-key", SecretKeySize, version.APP, EncryptCommand)
+	}
+	return key, nil
+}
+
+// IsSecret reports whether value is an encrypted value of the config.
+func IsSecret(value string) bool {
+	return strings.HasPrefix(value, configSecretPrefix) && strings.HasSuffix(value, configSecretSuffix)
+}
+
+// EncryptSecret returns plaintext encrypted with key in AES-256-GCM, as an ENC[aes256gcm,…] value of the config.
+func EncryptSecret(key []byte, plaintext string) (string, error) {
+	gcm, err := newSecretCipher(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return configSecretPrefix + base64.StdEncoding.EncodeToString(sealed) + configSecretSuffix, nil
+}
+
+// DecryptSecret returns the plaintext of an ENC[aes256gcm,…] value of the config.
+func DecryptSecret(key []byte, value string) (string, error) {
+	gcm, err := newSecretCipher(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(strings.TrimPrefix(value, configSecretPrefix), configSecretSuffix))
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return "", errors.New("the encrypted value is not valid base64")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("the encrypted value cannot be decrypted with env CONFIG_SECRET_KEY, the key is wrong or the value is corrupted")
+	}
+	return string(plaintext), nil
+}
+
+// getSecretsProviderFromEnv returns the provider of the secret:// values of env SECRETS_URL, there is none when it
+// is unset so that the config cannot read the env variables of the process.
+func getSecretsProviderFromEnv() (secrets.Provider, error) {
+	secretsProviderMu.Lock()
+	defer secretsProviderMu.Unlock()
+	rawURL := strings.TrimSpace(os.Getenv("SECRETS_URL"))
+	if rawURL == "" {
+		return nil, errNoSecretsURL
+	}
+	if secretsProvider != nil && rawURL == secretsProviderURL {
+		return secretsProvider, nil
+	}
+	provider, err := secrets.New(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	secretsProviderURL, secretsProvider = rawURL, provider
+	return provider, nil
+}
+
+func newSecretCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ResolveSecrets returns the json data of the config with its encrypted string values decrypted and its
+// secret://name values read from the provider of env SECRETS_URL, and the json pointers of these values so that
+// the errors do not show them. data is returned as is when it has no such value. a config that is not trusted, the
+// one of a tenant, a preview or an editor, cannot have such values: it could read the secrets of the server.
+func ResolveSecrets(data []byte, trusted bool) ([]byte, map[string]bool, []Error) {
+	if !bytes.Contains(data, []byte(configSecretPrefix)) && !bytes.Contains(data, []byte(secretRefPrefix)) {
+		return data, nil, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var root interface{}
+	if err := decoder.Decode(&root); err != nil {
+		// the schema validation reports the syntax error
+		return data, nil, nil
+	}
+	key, keyErr := SecretKey()
+	if keyErr == nil && key == nil {
+		keyErr = ErrNoSecretKey
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), secretsTimeout)
+	defer cancel()
+	var provider secrets.Provider
+	var providerErr error
+	pointers := make(map[string]bool)
+	var problems []Error
+	var walk func(value interface{}, pointer string) interface{}
+	walk = func(value interface{}, pointer string) interface{} {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for k, child := range v {
+				v[k] = walk(child, pointer+"/"+strings.ReplaceAll(strings.ReplaceAll(k, "~", "~0"), "/", "~1"))
+			}
+		case []interface{}:
+			for i, child := range v {
+				v[i] = walk(child, pointer+"/"+strconv.Itoa(i))
+			}
+		case string:
+			if !trusted && (strings.HasPrefix(v, secretRefPrefix) || IsSecret(v)) {
+				pointers[pointer] = true
+				problems = append(problems, Error{Pointer: pointer, Message: errUntrustedConfigSecret.Error()})
+				return v
+			}
+			if strings.HasPrefix(v, secretRefPrefix) {
+				pointers[pointer] = true
+				if provider == nil && providerErr == nil {
+					provider, providerErr = getSecretsProviderFromEnv()
+				}
+				if providerErr != nil {
+					problems = append(problems, Error{Pointer: pointer, Value: v, Message: providerErr.Error()})
+					return v
+				}
+				value, err := secrets.Resolve(ctx, provider, strings.TrimPrefix(v, secretRefPrefix))
+				if err != nil {
+					problems = append(problems, Error{Pointer: pointer, Value: v, Message: err.Error()})
+					return v
+				}
+				return value
+			}
+			if !IsSecret(v) {
+				return v
+			}
+			pointers[pointer] = true
+			if keyErr != nil {
+				problems = append(problems, Error{Pointer: pointer, Message: keyErr.Error()})
+				return v
+			}
+			plaintext, err := DecryptSecret(key, v)
+			if err != nil {
+				problems = append(problems, Error{Pointer: pointer, Message: err.Error()})
+				return v
+			}
+			return plaintext
+		}
+		return value
+	}
+	root = walk(root, "")
+	if len(pointers) == 0 || len(problems) > 0 {
+		return data, pointers, problems
+	}
+	decrypted, err := json.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return data, pointers, []Error{{Message: fmt.Sprintf("error encoding the decrypted config: %v", err)}}
+	}
+	return decrypted, pointers, nil
+}
+
+// MaskSecrets replaces the decrypted or resolved values of the problems at the pointers of the secrets.
+func MaskSecrets(problems []Error, pointers map[string]bool) []Error {
+	for i, ce := range problems {
+		if pointers[ce.Pointer] && ce.Value != nil {
+			problems[i].Value = maskedConfigSecret
+		}
+	}
+	return problems
+}
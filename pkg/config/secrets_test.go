@@ -0,0 +1,80 @@
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestSecretRoundTrip(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, SecretKeySize)
+	otherKey := bytes.Repeat([]byte{2}, SecretKeySize)
+	value, err := EncryptSecret(key, "s3cr3t ünicode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsSecret(value) || strings.Contains(value, "s3cr3t") {
+		t.Fatalf("EncryptSecret() = %q, want an ENC[aes256gcm,...] value", value)
+	}
+	if again, _ := EncryptSecret(key, "s3cr3t ünicode"); again == value {
+		t.Errorf("EncryptSecret() gives the same value twice, the nonce is not random")
+	}
+	if got, err := DecryptSecret(key, value); err != nil || got != "s3cr3t ünicode" {
+		t.Errorf("DecryptSecret() = %q, %v", got, err)
+	}
+
+	sealed, _ := base64.StdEncoding.DecodeString(strings.TrimSuffix(strings.TrimPrefix(value, configSecretPrefix), configSecretSuffix))
+	tamper := func(i int) string {
+		b := bytes.Clone(sealed)
+		b[i] ^= 1
+		return configSecretPrefix + base64.StdEncoding.EncodeToString(b) + configSecretSuffix
+	}
+	tests := []struct {
+		name    string
+		key     []byte
+		value   string
+		wantErr string
+	}{
+		{name: "wrong key", key: otherKey, value: value, wantErr: "cannot be decrypted"},
+		{name: "tampered nonce", key: key, value: tamper(0), wantErr: "cannot be decrypted"},
+		{name: "tampered ciphertext", key: key, value: tamper(len(sealed) - 20), wantErr: "cannot be decrypted"},
+		{name: "tampered tag", key: key, value: tamper(len(sealed) - 1), wantErr: "cannot be decrypted"},
+		{name: "truncated", key: key, value: configSecretPrefix + base64.StdEncoding.EncodeToString(sealed[:8]) + configSecretSuffix, wantErr: "not valid base64"},
+		{name: "not base64", key: key, value: configSecretPrefix + "%%%" + configSecretSuffix, wantErr: "not valid base64"},
+		{name: "short key", key: key[:10], value: value, wantErr: "invalid key size"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecryptSecret(tt.key, tt.value)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("DecryptSecret() = %q, %v, want an error about %s", got, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResolveSecrets(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, SecretKeySize)
+	t.Setenv("CONFIG_SECRET_KEY", base64.StdEncoding.EncodeToString(key))
+	value, err := EncryptSecret(key, "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte(`{"mail": {"password": "` + value + `"}}`)
+	decrypted, pointers, problems := ResolveSecrets(data, true)
+	if len(problems) > 0 || !pointers["/mail/password"] || !strings.Contains(string(decrypted), `"hunter2"`) {
+		t.Errorf("ResolveSecrets() = %s, %v, %v", decrypted, pointers, problems)
+	}
+	if _, _, problems := ResolveSecrets(data, false); len(problems) != 1 || problems[0].Message != errUntrustedConfigSecret.Error() {
+		t.Errorf("ResolveSecrets() of an untrusted config = %v, want it refused", problems)
+	}
+	t.Setenv("CONFIG_SECRET_KEY", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, SecretKeySize)))
+	if got, _, problems := ResolveSecrets(data, true); len(problems) != 1 || problems[0].Pointer != "/mail/password" || !bytes.Equal(got, data) {
+		t.Errorf("ResolveSecrets() with a wrong key = %s, %v, want the error of the value", got, problems)
+	}
+	t.Setenv("CONFIG_SECRET_KEY", "")
+	if _, _, problems := ResolveSecrets(data, true); len(problems) != 1 || problems[0].Message != ErrNoSecretKey.Error() {
+		t.Errorf("ResolveSecrets() without a key = %v, want %v", problems, ErrNoSecretKey)
+	}
+}
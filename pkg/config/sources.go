@@ -0,0 +1,162 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	configFetchTimeout = 10 * time.Second
+	StdinPath          = "-" // CONFIG_URL reading the config from stdin, the server then writes no file
+)
+
+// stdinConfig is the config read from stdin, read once so that the reloads get the same config.
+var stdinConfig struct {
+	once sync.Once
+	data []byte
+	err  error
+}
+
+// Source is one file of a layered configuration, the base config or an overlay.
+type Source struct {
+	Path string
+	Data []byte
+}
+
+// AppEnv returns the environment name from env APP_ENV, like production or staging, or "" when not set.
+func AppEnv() string {
+	return strings.ToLower(strings.TrimSpace(os.Getenv("APP_ENV")))
+}
+
+// IsURL reports whether the config is fetched over http rather than read from a file.
+func IsURL(configPath string) bool {
+	return strings.HasPrefix(configPath, "http://") || strings.HasPrefix(configPath, "https://")
+}
+
+// IsFromStdin reports whether the config is read from stdin, for ephemeral previews like the ones of a CI:
+// the server then runs in memory, it keeps the data, the audit and the form submissions in memory and logs to stderr.
+func IsFromStdin() bool {
+	return strings.TrimSpace(os.Getenv("CONFIG_URL")) == StdinPath
+}
+
+// ReadSource reads a config file, stdin when configPath is "-", or fetches it when configPath is an http(s) url,
+// a missing file or a 404 gives an error wrapping fs.ErrNotExist
+func ReadSource(configPath string) ([]byte, error) {
+	if configPath == StdinPath {
+		stdinConfig.once.Do(func() {
+			stdinConfig.data, stdinConfig.err = io.ReadAll(os.Stdin)
+			if stdinConfig.err != nil {
+				stdinConfig.err = fmt.Errorf("error reading the configuration from stdin: %w", stdinConfig.err)
+			}
+		})
+		return stdinConfig.data, stdinConfig.err
+	}
+	if !IsURL(configPath) {
+		return os.ReadFile(strings.TrimPrefix(configPath, "file://"))
+	}
+	client := http.Client{Timeout: configFetchTimeout}
+	resp, err := client.Get(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching configuration %s: %w", configPath, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("configuration %s: %w", configPath, fs.ErrNotExist)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching configuration %s: status %s", configPath, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// getOverlayPath returns the overlay of configPath for env, like config.production.json for config.json.
+func getOverlayPath(configPath, env string) string {
+	ext := filepath.Ext(configPath)
+	return strings.TrimSuffix(configPath, ext) + "." + env + ext
+}
+
+// getSourcesName returns a name for the layered configuration, like config.json+config.production.json
+func getSourcesName(sources []Source) string {
+	names := make([]string, len(sources))
+	for i, src := range sources {
+		names[i] = src.Path
+	}
+	return strings.Join(names, "+")
+}
+
+// LoadSources reads the base config and the overlay selected by APP_ENV when it exists, from files or http(s) urls,
+// and returns them with the json of the merged configuration.
+// without an overlay the returned data is the content of the base config, untouched.
+func LoadSources(configPath string, l *log.Logger) ([]Source, []byte, error) {
+	data, err := ReadSource(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if configPath == StdinPath {
+		// there is no file next to stdin to read an overlay from
+		return []Source{{Path: "stdin", Data: data}}, data, nil
+	}
+	sources := []Source{{Path: configPath, Data: data}}
+	env := AppEnv()
+	if env == "" {
+		return sources, data, nil
+	}
+	overlayPath := getOverlayPath(configPath, env)
+	overlayData, err := ReadSource(overlayPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		l.Printf("no configuration overlay %s for APP_ENV=%s", overlayPath, env)
+		return sources, data, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	sources = append(sources, Source{Path: overlayPath, Data: overlayData})
+	var base, overlay interface{}
+	if err := json.Unmarshal(data, &base); err != nil {
+		return nil, nil, fmt.Errorf("error parsing configuration file %s: %w", configPath, err)
+	}
+	if err := json.Unmarshal(overlayData, &overlay); err != nil {
+		return nil, nil, fmt.Errorf("error parsing configuration overlay %s: %w", overlayPath, err)
+	}
+	merged, err := json.MarshalIndent(mergeValues(base, overlay), "", "  ")
+	if err != nil {
+		return nil, nil, fmt.Errorf("error merging configuration overlay %s: %w", overlayPath, err)
+	}
+	l.Printf("✅ Configuration overlay %s merged for APP_ENV=%s", overlayPath, env)
+	return sources, merged, nil
+}
+
+// mergeValues deep-merges overlay into base following the json merge patch rules (RFC 7386):
+// objects are merged key by key, a null removes the key, any other value (arrays included) replaces the base one.
+func mergeValues(base, overlay interface{}) interface{} {
+	overlayObj, ok := overlay.(map[string]interface{})
+	if !ok {
+		return overlay
+	}
+	baseObj, ok := base.(map[string]interface{})
+	if !ok {
+		baseObj = make(map[string]interface{})
+	}
+	merged := make(map[string]interface{}, len(baseObj)+len(overlayObj))
+	for k, v := range baseObj {
+		merged[k] = v
+	}
+	for k, v := range overlayObj {
+		if v == nil {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = mergeValues(merged[k], v)
+	}
+	return merged
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// UnknownFields compares the keys of the json configuration with the fields of the type t it is decoded into.
+// it reports the keys that json.Unmarshal silently drops, and the ones it only accepts because
+// it matches field names ignoring case (like menuorder for menuOrder).
+func UnknownFields(data []byte, t reflect.Type) ([]Error, error) {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	var problems []Error
+	checkUnknownFields(raw, t, "", &problems)
+	return problems, nil
+}
+
+// checkUnknownFields walks the decoded json value alongside the go type it is decoded into.
+func checkUnknownFields(value interface{}, t reflect.Type, pointer string, problems *[]Error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return
+		}
+		fields := getJSONFields(t)
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			// keys like $schema or $comment are meant for the editors and the json schema tools
+			if !strings.HasPrefix(key, "$") {
+				keys = append(keys, key)
+			}
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			keyPointer := pointer + "/" + strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+			if field, ok := fields[key]; ok {
+				checkUnknownFields(obj[key], field.Type, keyPointer, problems)
+				continue
+			}
+			if name := findFieldIgnoringCase(names, key); name != "" {
+				*problems = append(*problems, Error{
+					Pointer: keyPointer,
+					Message: fmt.Sprintf("key %q only matches field %q ignoring case, use the exact spelling", key, name),
+				})
+				checkUnknownFields(obj[key], fields[name].Type, keyPointer, problems)
+				continue
+			}
+			msg := fmt.Sprintf("unknown field %q is ignored", key)
+			if suggestion := suggestFieldName(names, key); suggestion != "" {
+				msg = fmt.Sprintf("unknown field %q is ignored, did you mean %q?", key, suggestion)
+			}
+			*problems = append(*problems, Error{Pointer: keyPointer, Value: obj[key], Message: msg})
+		}
+	case reflect.Slice, reflect.Array:
+		list, ok := value.([]interface{})
+		if !ok {
+			return
+		}
+		for i, item := range list {
+			checkUnknownFields(item, t.Elem(), pointer+"/"+strconv.Itoa(i), problems)
+		}
+	case reflect.Map:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for key, item := range obj {
+			checkUnknownFields(item, t.Elem(), pointer+"/"+key, problems)
+		}
+	}
+}
+
+// getJSONFields returns the struct fields by the json key they are decoded from.
+func getJSONFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+func findFieldIgnoringCase(names []string, key string) string {
+	for _, name := range names {
+		if strings.EqualFold(name, key) {
+			return name
+		}
+	}
+	return ""
+}
+
+// suggestFieldName returns the known name closest to key, or "" when none is close enough to be a typo.
+func suggestFieldName(names []string, key string) string {
+	best, bestDistance := "", len(key)/3+1
+	slices.Sort(names)
+	for _, name := range names {
+		if d := levenshtein(strings.ToLower(key), strings.ToLower(name)); d <= bestDistance && (best == "" || d < bestDistance) {
+			best, bestDistance = name, d
+		}
+	}
+	return best
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,329 @@
+// Package mailer sends the emails of the server, like the contact form submissions and the alerts, through an smtp
+// server, the sendmail command or files written in a directory for the development.
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSMTPPort     = "587"
+	implicitTLSSMTPPort = "465"
+	defaultSendmailPath = "/usr/sbin/sendmail"
+	dialTimeout         = 10 * time.Second
+)
+
+// Message is an email with a plain text body and an optional html alternative.
+type Message struct {
+	From    string // the From of the Mailer when empty
+	To      []string
+	ReplyTo string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Transport delivers an encoded message to the recipients.
+type Transport interface {
+	Send(ctx context.Context, from string, to []string, msg []byte) error
+}
+
+// Mailer encodes the messages and sends them with its transport.
+type Mailer struct {
+	transport Transport
+	from      *mail.Address
+}
+
+// New returns a Mailer sending with transport, from is the sender of the messages without From.
+func New(transport Transport, from string) (*Mailer, error) {
+	address, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("mailer: invalid sender %q: %w", from, err)
+	}
+	return &Mailer{transport: transport, from: address}, nil
+}
+
+// Send encodes msg and sends it to its recipients, msg is not changed.
+func (m *Mailer) Send(ctx context.Context, msg *Message) error {
+	from := m.from
+	if msg.From != "" {
+		address, err := mail.ParseAddress(msg.From)
+		if err != nil {
+			return fmt.Errorf("mailer: invalid sender %q: %w", msg.From, err)
+		}
+		from = address
+	}
+	if len(msg.To) == 0 {
+		return errors.New("mailer: a message needs a recipient")
+	}
+	if msg.ReplyTo != "" {
+		// the reply-to often comes from a form, it must be a single address
+		address, err := mail.ParseAddress(msg.ReplyTo)
+		if err != nil {
+			return fmt.Errorf("mailer: invalid reply-to %q: %w", msg.ReplyTo, err)
+		}
+		clean := *msg
+		clean.ReplyTo = address.String()
+		msg = &clean
+	}
+	to := make([]string, 0, len(msg.To))
+	for _, recipient := range msg.To {
+		address, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return fmt.Errorf("mailer: invalid recipient %q: %w", recipient, err)
+		}
+		to = append(to, address.Address)
+	}
+	data, err := Encode(msg, from)
+	if err != nil {
+		return err
+	}
+	return m.transport.Send(ctx, from.Address, to, data)
+}
+
+// Encode returns msg in the MIME format, a multipart/alternative when it has an html body.
+func Encode(msg *Message, from *mail.Address) ([]byte, error) {
+	var buf bytes.Buffer
+	id := make([]byte, 12)
+	rand.Read(id)
+	domain := "localhost"
+	if _, host, found := strings.Cut(from.Address, "@"); found {
+		domain = host
+	}
+	header := textproto.MIMEHeader{}
+	header.Set("From", from.String())
+	header.Set("To", strings.Join(msg.To, ", "))
+	if msg.ReplyTo != "" {
+		header.Set("Reply-To", msg.ReplyTo)
+	}
+	header.Set("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header.Set("Date", time.Now().Format(time.RFC1123Z))
+	header.Set("Message-ID", "<"+hex.EncodeToString(id)+"@"+domain+">")
+	header.Set("MIME-Version", "1.0")
+	if msg.HTML == "" {
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+		writeHeader(&buf, header)
+		if err := writeQuotedPrintable(&buf, msg.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	var parts bytes.Buffer
+	writer := multipart.NewWriter(&parts)
+	header.Set("Content-Type", "multipart/alternative; boundary="+writer.Boundary())
+	writeHeader(&buf, header)
+	for _, part := range []struct{ contentType, body string }{{"text/plain", msg.Text}, {"text/html", msg.HTML}} {
+		w, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("mailer: error encoding the message: %w", err)
+		}
+		if err := writeQuotedPrintable(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("mailer: error encoding the message: %w", err)
+	}
+	buf.Write(parts.Bytes())
+	return buf.Bytes(), nil
+}
+
+// writeHeader writes header in a stable order, followed by the blank line before the body.
+func writeHeader(buf *bytes.Buffer, header textproto.MIMEHeader) {
+	for _, name := range []string{"From", "To", "Reply-To", "Subject", "Date", "Message-Id", "Mime-Version", "Content-Type", "Content-Transfer-Encoding"} {
+		if value := header.Get(name); value != "" {
+			fmt.Fprintf(buf, "%s: %s\r\n", name, value)
+		}
+	}
+	buf.WriteString("\r\n")
+}
+
+// writeQuotedPrintable writes body with crlf line endings in the quoted-printable encoding.
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n"))); err != nil {
+		return fmt.Errorf("mailer: error encoding the message: %w", err)
+	}
+	return qp.Close()
+}
+
+// NewTransport returns the Transport described by rawURL :
+//   - smtp://user@host:587     an smtp server, with STARTTLS when it offers it, the password is given apart,
+//     ?tls=required refuses to send when the server does not offer STARTTLS
+//   - smtps://user@host:465    an smtp server over tls
+//   - sendmail:///usr/sbin/sendmail the sendmail command, /usr/sbin/sendmail when the path is empty
+//   - file:///var/spool/mails  one .eml file per message in the directory, for the development
+func NewTransport(rawURL, password string) (Transport, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("mailer: invalid transport url %q: %w", rawURL, err)
+	}
+	switch u.Scheme {
+	case "smtp", "smtps":
+		if u.Hostname() == "" {
+			return nil, fmt.Errorf("mailer: the smtp transport %q needs a host", rawURL)
+		}
+		t := &SMTPTransport{Host: u.Hostname(), Port: u.Port(), User: u.User.Username(), Password: password, ImplicitTLS: u.Scheme == "smtps"}
+		switch mode := u.Query().Get("tls"); mode {
+		case "":
+		case "required":
+			t.RequireTLS = true
+		default:
+			return nil, fmt.Errorf("mailer: invalid tls %q in %q, only required is supported", mode, rawURL)
+		}
+		if t.Port == "" {
+			t.Port = defaultSMTPPort
+			if t.ImplicitTLS {
+				t.Port = implicitTLSSMTPPort
+			}
+		}
+		return t, nil
+	case "sendmail":
+		path := u.Path
+		if path == "" {
+			path = defaultSendmailPath
+		}
+		return &SendmailTransport{Path: path}, nil
+	case "file":
+		dir := u.Path
+		if u.Host != "" {
+			// file://./mails is parsed with "." as host, keep it as a relative path
+			dir = u.Host + u.Path
+		}
+		return NewFileTransport(dir)
+	default:
+		return nil, fmt.Errorf("mailer: unsupported scheme %q in %q", u.Scheme, rawURL)
+	}
+}
+
+// SMTPTransport sends the messages to an smtp server, with STARTTLS when the server offers it.
+type SMTPTransport struct {
+	Host        string
+	Port        string
+	User        string // no authentication when empty
+	Password    string
+	ImplicitTLS bool // the connection is in tls from the start, usually on port 465
+	RequireTLS  bool // the message is not sent when the server does not offer STARTTLS
+}
+
+func (t *SMTPTransport) Send(ctx context.Context, from string, to []string, msg []byte) error {
+	address := net.JoinHostPort(t.Host, t.Port)
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	var conn net.Conn
+	var err error
+	if t.ImplicitTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: t.Host}}).DialContext(ctx, "tcp", address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return fmt.Errorf("mailer: error connecting to %s: %w", address, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, t.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("mailer: error connecting to %s: %w", address, err)
+	}
+	defer client.Close()
+	if !t.ImplicitTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: t.Host}); err != nil {
+				return fmt.Errorf("mailer: error starting tls with %s: %w", address, err)
+			}
+		} else if t.RequireTLS {
+			return fmt.Errorf("mailer: %s does not offer STARTTLS, required by the transport", address)
+		}
+	}
+	if t.User != "" {
+		if err := client.Auth(smtp.PlainAuth("", t.User, t.Password, t.Host)); err != nil {
+			return fmt.Errorf("mailer: error authenticating to %s: %w", address, err)
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return fmt.Errorf("mailer: sender refused by %s: %w", address, err)
+	}
+	for _, recipient := range to {
+		if err := client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("mailer: recipient %s refused by %s: %w", recipient, address, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("mailer: error sending to %s: %w", address, err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("mailer: error sending to %s: %w", address, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("mailer: message refused by %s: %w", address, err)
+	}
+	return client.Quit()
+}
+
+// SendmailTransport sends the messages with the sendmail command of the system.
+type SendmailTransport struct {
+	Path string
+}
+
+func (t *SendmailTransport) Send(ctx context.Context, from string, to []string, msg []byte) error {
+	args := append([]string{"-i", "-f", from, "--"}, to...)
+	cmd := exec.CommandContext(ctx, t.Path, args...)
+	cmd.Stdin = bytes.NewReader(msg)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("mailer: error running %s: %w: %s", t.Path, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// FileTransport writes each message in a .eml file of its directory, named by time, instead of sending it.
+type FileTransport struct {
+	Dir string
+}
+
+// NewFileTransport returns a FileTransport writing in dir, creating it when needed.
+func NewFileTransport(dir string) (*FileTransport, error) {
+	if strings.TrimSpace(dir) == "" {
+		return nil, errors.New("mailer: the file transport needs a directory")
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("mailer: cannot create directory %s: %w", dir, err)
+	}
+	return &FileTransport{Dir: dir}, nil
+}
+
+func (t *FileTransport) Send(ctx context.Context, from string, to []string, msg []byte) error {
+	id := make([]byte, 4)
+	rand.Read(id)
+	name := filepath.Join(t.Dir, time.Now().UTC().Format("20060102-150405.000")+"-"+hex.EncodeToString(id)+".eml")
+	if err := os.WriteFile(name, msg, 0640); err != nil {
+		return fmt.Errorf("mailer: error writing %s: %w", name, err)
+	}
+	return nil
+}
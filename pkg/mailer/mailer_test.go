@@ -0,0 +1,226 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	from := &mail.Address{Name: "My Site", Address: "noreply@example.com"}
+	tests := []struct {
+		name     string
+		msg      *Message
+		contains []string
+		absent   []string
+	}{
+		{
+			name: "plain text",
+			msg:  &Message{To: []string{"ops@example.com"}, Subject: "Hello", Text: "line 1\nline 2"},
+			contains: []string{
+				"From: \"My Site\" <noreply@example.com>\r\n",
+				"To: ops@example.com\r\n",
+				"Subject: Hello\r\n",
+				"Message-Id: <",
+				"@example.com>\r\n",
+				"Content-Type: text/plain; charset=utf-8\r\n",
+				"Content-Transfer-Encoding: quoted-printable\r\n",
+				"\r\n\r\nline 1\r\nline 2",
+			},
+			absent: []string{"Reply-To", "multipart"},
+		},
+		{
+			name:     "reply-to and an utf-8 subject",
+			msg:      &Message{To: []string{"a@example.com", "b@example.com"}, ReplyTo: "visitor@example.org", Subject: "Réservation", Text: "é"},
+			contains: []string{"To: a@example.com, b@example.com\r\n", "Reply-To: visitor@example.org\r\n", "Subject: =?utf-8?q?R=C3=A9servation?=\r\n", "=C3=A9"},
+		},
+		{
+			name:     "html alternative",
+			msg:      &Message{To: []string{"ops@example.com"}, Subject: "Hello", Text: "Hello", HTML: "<p>Hello</p>"},
+			contains: []string{"Content-Type: multipart/alternative; boundary=", "Content-Type: text/plain; charset=utf-8", "Content-Type: text/html; charset=utf-8", "<p>Hello</p>"},
+		},
+		{
+			name:     "header injection in the subject",
+			msg:      &Message{To: []string{"ops@example.com"}, Subject: "Hi\r\nBcc: victim@example.com", Text: "x"},
+			absent:   []string{"\r\nBcc:"},
+			contains: []string{"Subject: =?utf-8?q?"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := Encode(tt.msg, from)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			got := string(data)
+			for _, want := range tt.contains {
+				if !strings.Contains(got, want) {
+					t.Errorf("Encode() has no %q in:\n%s", want, got)
+				}
+			}
+			for _, unwanted := range tt.absent {
+				if strings.Contains(got, unwanted) {
+					t.Errorf("Encode() has %q in:\n%s", unwanted, got)
+				}
+			}
+			if _, err := mail.ReadMessage(strings.NewReader(got)); err != nil {
+				t.Errorf("Encode() is not a valid message: %v", err)
+			}
+		})
+	}
+}
+
+func TestNewTransport(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mails")
+	tests := []struct {
+		url     string
+		want    Transport
+		wantErr bool
+	}{
+		{url: "smtp://user@mail.example.com", want: &SMTPTransport{Host: "mail.example.com", Port: "587", User: "user", Password: "pw"}},
+		{url: "smtp://mail.example.com:2525?tls=required", want: &SMTPTransport{Host: "mail.example.com", Port: "2525", Password: "pw", RequireTLS: true}},
+		{url: "smtps://user@mail.example.com", want: &SMTPTransport{Host: "mail.example.com", Port: "465", User: "user", Password: "pw", ImplicitTLS: true}},
+		{url: "smtp://mail.example.com?tls=maybe", wantErr: true},
+		{url: "smtp:///no-host", wantErr: true},
+		{url: "sendmail://", want: &SendmailTransport{Path: "/usr/sbin/sendmail"}},
+		{url: "sendmail:///usr/local/bin/sendmail", want: &SendmailTransport{Path: "/usr/local/bin/sendmail"}},
+		{url: "file://" + dir, want: &FileTransport{Dir: dir}},
+		{url: "pop3://mail.example.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got, err := NewTransport(tt.url, "pw")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("NewTransport() = %#v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewTransport() error = %v", err)
+			}
+			switch want := tt.want.(type) {
+			case *SMTPTransport:
+				if g, ok := got.(*SMTPTransport); !ok || *g != *want {
+					t.Errorf("NewTransport() = %#v, want %#v", got, want)
+				}
+			case *SendmailTransport:
+				if g, ok := got.(*SendmailTransport); !ok || *g != *want {
+					t.Errorf("NewTransport() = %#v, want %#v", got, want)
+				}
+			case *FileTransport:
+				if g, ok := got.(*FileTransport); !ok || *g != *want {
+					t.Errorf("NewTransport() = %#v, want %#v", got, want)
+				}
+				if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+					t.Errorf("NewTransport() did not create the directory %s", dir)
+				}
+			}
+		})
+	}
+}
+
+// recordingTransport keeps the last message sent.
+type recordingTransport struct {
+	to  []string
+	msg string
+}
+
+func (t *recordingTransport) Send(ctx context.Context, from string, to []string, msg []byte) error {
+	t.to, t.msg = to, string(msg)
+	return nil
+}
+
+func TestSendKeepsTheMessage(t *testing.T) {
+	transport := &recordingTransport{}
+	m, err := New(transport, "My Site <noreply@example.com>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &Message{To: []string{"Ops <ops@example.com>"}, ReplyTo: "Visitor <visitor@example.org>", Subject: "Hello", Text: "Hello"}
+	if err := m.Send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.ReplyTo != "Visitor <visitor@example.org>" {
+		t.Errorf("Send() changed the reply-to of the message to %q", msg.ReplyTo)
+	}
+	if !strings.Contains(transport.msg, "Reply-To: \"Visitor\" <visitor@example.org>\r\n") || strings.Join(transport.to, ",") != "ops@example.com" {
+		t.Errorf("Send() sent to %v:\n%s", transport.to, transport.msg)
+	}
+	if err := m.Send(context.Background(), &Message{To: []string{"ops@example.com"}, ReplyTo: "a@example.com, b@example.com"}); err == nil {
+		t.Errorf("Send() accepted a reply-to of two addresses")
+	}
+}
+
+// serveSMTP answers one smtp session without STARTTLS, and returns the commands received.
+func serveSMTP(t *testing.T, listener net.Listener) <-chan []string {
+	commands := make(chan []string, 1)
+	go func() {
+		var received []string
+		defer func() { commands <- received }()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(strings.Fields(line + " x")[0])
+			received = append(received, command)
+			switch command {
+			case "EHLO":
+				reply("250-localhost")
+				reply("250 8BITMIME")
+			case "DATA":
+				reply("354 go ahead")
+				for {
+					if line, err = r.ReadString('\n'); err != nil || line == ".\r\n" {
+						break
+					}
+				}
+				reply("250 queued")
+			case "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return commands
+}
+
+func TestSMTPTransportTLS(t *testing.T) {
+	for _, requireTLS := range []bool{false, true} {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		commands := serveSMTP(t, listener)
+		host, port, _ := net.SplitHostPort(listener.Addr().String())
+		transport := &SMTPTransport{Host: host, Port: port, RequireTLS: requireTLS}
+		err = transport.Send(context.Background(), "noreply@example.com", []string{"ops@example.com"}, []byte("Subject: x\r\n\r\nx\r\n"))
+		listener.Close()
+		received := strings.Join(<-commands, " ")
+		if requireTLS {
+			if err == nil || !strings.Contains(err.Error(), "STARTTLS") || strings.Contains(received, "MAIL") {
+				t.Errorf("Send() with tls required = %v after %s, want a refusal before MAIL", err, received)
+			}
+			continue
+		}
+		if err != nil || !strings.Contains(received, "MAIL RCPT DATA") {
+			t.Errorf("Send() without tls = %v after %s, want the message sent", err, received)
+		}
+	}
+}
@@ -0,0 +1,396 @@
+// Package markdown converts the common subset of markdown written in the content files to html: headings,
+// paragraphs, lists, block quotes, fenced code and rules, with the code, emphasis, links and images of the text.
+// the html of the source is escaped, the pages needing their own html are written as .html files.
+package markdown
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	headingRe  = regexp.MustCompile(`^(#{1,6})(?:\s+(.*?))?(?:\s+#+)?\s*$`)
+	ruleRe     = regexp.MustCompile(`^ {0,3}([-*_])(?:\s*([-*_])){2,}\s*$`)
+	listItemRe = regexp.MustCompile(`^( {0,3})([-*+]|\d{1,9}[.)])(\s+|$)`)
+	fenceRe    = regexp.MustCompile("^ {0,3}(```+|~~~+)\\s*([^`\\s]*)")
+)
+
+// converter holds the state of one document, the ids already given to its headings.
+type converter struct {
+	ids map[string]int
+}
+
+// ToHTML returns the html of the markdown src.
+func ToHTML(src string) string {
+	c := &converter{ids: make(map[string]int)}
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	return c.renderBlocks(lines, false)
+}
+
+// isRule reports whether line is a thematic break like --- or * * *, made of a single character.
+func isRule(line string) bool {
+	m := ruleRe.FindStringSubmatch(line)
+	return m != nil && strings.Count(strings.TrimSpace(line), m[1]) == len(strings.ReplaceAll(strings.TrimSpace(line), " ", ""))
+}
+
+// startsBlock reports whether line starts a block ending the paragraph before it.
+func startsBlock(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return headingRe.MatchString(trimmed) && strings.HasPrefix(trimmed, "#") || isRule(line) || fenceRe.MatchString(line) ||
+		strings.HasPrefix(trimmed, ">") || listItemRe.MatchString(line)
+}
+
+// renderBlocks returns the html of the block lines, the paragraphs of a tight list item are not wrapped in <p>.
+func (c *converter) renderBlocks(lines []string, tight bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			i++
+		case fenceRe.MatchString(line):
+			m := fenceRe.FindStringSubmatch(line)
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), m[1]); i++ {
+				code = append(code, lines[i])
+			}
+			i++ // the closing fence, or the end of the document
+			sb.WriteString("<pre><code")
+			if m[2] != "" {
+				fmt.Fprintf(&sb, ` class="language-%s"`, html.EscapeString(m[2]))
+			}
+			sb.WriteString(">")
+			if len(code) > 0 {
+				sb.WriteString(html.EscapeString(strings.Join(code, "\n")) + "\n")
+			}
+			sb.WriteString("</code></pre>\n")
+		case strings.HasPrefix(trimmed, "#") && headingRe.MatchString(trimmed):
+			m := headingRe.FindStringSubmatch(trimmed)
+			text := c.renderInline(m[2])
+			fmt.Fprintf(&sb, "<h%d id=\"%s\">%s</h%d>\n", len(m[1]), c.getID(m[2]), text, len(m[1]))
+			i++
+		case isRule(line):
+			sb.WriteString("<hr>\n")
+			i++
+		case strings.HasPrefix(trimmed, ">"):
+			var quoted []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				text := strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")
+				quoted = append(quoted, strings.TrimPrefix(text, " "))
+			}
+			sb.WriteString("<blockquote>\n" + c.renderBlocks(quoted, false) + "</blockquote>\n")
+		case listItemRe.MatchString(line):
+			i = c.renderList(&sb, lines, i)
+		default:
+			var paragraph []string
+			for ; i < len(lines) && strings.TrimSpace(lines[i]) != "" && (len(paragraph) == 0 || !startsBlock(lines[i])); i++ {
+				paragraph = append(paragraph, lines[i])
+			}
+			text := c.renderParagraph(paragraph)
+			if tight {
+				sb.WriteString(text + "\n")
+			} else {
+				sb.WriteString("<p>" + text + "</p>\n")
+			}
+		}
+	}
+	return sb.String()
+}
+
+// renderList writes the list starting at lines[start] and returns the index of the line after it. the lines of an
+// item are the ones indented below its marker, a list with blank lines between its items is loose.
+func (c *converter) renderList(sb *strings.Builder, lines []string, start int) int {
+	first := listItemRe.FindStringSubmatch(lines[start])
+	ordered := unicode.IsDigit(rune(first[2][0]))
+	var items [][]string
+	tight := true
+	i := start
+	for i < len(lines) {
+		m := listItemRe.FindStringSubmatch(lines[i])
+		if m == nil || unicode.IsDigit(rune(m[2][0])) != ordered || len(m[1]) > len(first[1])+1 {
+			break
+		}
+		indent := len(m[0])
+		if strings.TrimSpace(m[3]) == "" && m[3] != "" {
+			indent = len(m[1]) + len(m[2]) + 1
+		}
+		item := []string{lines[i][len(m[0]):]}
+		for i++; i < len(lines); i++ {
+			line := lines[i]
+			if strings.TrimSpace(line) == "" {
+				// a blank line continues the item when the next line is indented below it
+				next := i + 1
+				for next < len(lines) && strings.TrimSpace(lines[next]) == "" {
+					next++
+				}
+				if next < len(lines) && getIndent(lines[next]) >= indent {
+					item = append(item, "")
+					tight = false
+					continue
+				}
+				if next < len(lines) {
+					if n := listItemRe.FindStringSubmatch(lines[next]); n != nil && unicode.IsDigit(rune(n[2][0])) == ordered {
+						tight = false // the list goes on after a blank line
+					}
+				}
+				i = next
+				break
+			}
+			if getIndent(line) >= indent {
+				item = append(item, line[indent:])
+				continue
+			}
+			if listItemRe.MatchString(line) || startsBlock(line) {
+				break
+			}
+			item = append(item, strings.TrimSpace(line)) // lazy continuation of the paragraph
+		}
+		items = append(items, item)
+	}
+	tag := "ul"
+	if ordered {
+		tag = "ol"
+		if number := strings.TrimRight(first[2], ".)"); strings.TrimLeft(number, "0") != "1" {
+			start := strings.TrimLeft(number, "0")
+			if start == "" {
+				start = "0"
+			}
+			tag = `ol start="` + start + `"`
+		}
+	}
+	sb.WriteString("<" + tag + ">\n")
+	for _, item := range items {
+		sb.WriteString("<li>" + strings.TrimSuffix(c.renderBlocks(item, tight), "\n") + "</li>\n")
+	}
+	sb.WriteString("</" + strings.Fields(tag)[0] + ">\n")
+	return i
+}
+
+// getIndent returns the number of spaces starting line, a tab counting for 4.
+func getIndent(line string) int {
+	n := 0
+	for _, r := range line {
+		switch r {
+		case ' ':
+			n++
+		case '\t':
+			n += 4
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+// renderParagraph returns the html of the lines of a paragraph, a line ending with two spaces or a backslash
+// breaks the line.
+func (c *converter) renderParagraph(lines []string) string {
+	var sb strings.Builder
+	for i, line := range lines {
+		line = strings.TrimLeft(line, " \t")
+		hardBreak := strings.HasSuffix(line, "  ") || strings.HasSuffix(line, "\\")
+		line = strings.TrimRight(line, " \t")
+		if hardBreak {
+			line = strings.TrimSuffix(line, "\\")
+		}
+		sb.WriteString(c.renderInline(line))
+		if i < len(lines)-1 {
+			if hardBreak {
+				sb.WriteString("<br>")
+			}
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+// getID returns a unique id for a heading, its text in lower case with dashes like getting-started.
+func (c *converter) getID(text string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(stripInline(text)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if dash && sb.Len() > 0 {
+				sb.WriteByte('-')
+			}
+			sb.WriteRune(r)
+			dash = false
+		default:
+			dash = true
+		}
+	}
+	id := sb.String()
+	if id == "" {
+		id = "section"
+	}
+	c.ids[id]++
+	if n := c.ids[id]; n > 1 {
+		id = fmt.Sprintf("%s-%d", id, n-1)
+	}
+	return id
+}
+
+// stripInline removes the markers of the inline markdown from text, for the ids and the alt of the images.
+func stripInline(text string) string {
+	return strings.NewReplacer("*", "", "_", " ", "`", "", "[", "", "]", "", "\\", "").Replace(linkTargetRe.ReplaceAllString(text, "]"))
+}
+
+var linkTargetRe = regexp.MustCompile(`\]\([^)]*\)`)
+
+// safeSchemes are the url schemes kept in the links and images, the others like javascript: are replaced by #.
+var safeSchemes = []string{"http:", "https:", "mailto:", "tel:"}
+
+// getSafeURL returns the escaped url, or # when its scheme is not a safe one.
+func getSafeURL(url string) string {
+	lower := strings.ToLower(url)
+	if scheme, _, found := strings.Cut(lower, ":"); found && !strings.ContainsAny(scheme, "/?#") {
+		safe := false
+		for _, s := range safeSchemes {
+			safe = safe || strings.HasPrefix(lower, s)
+		}
+		if !safe {
+			return "#"
+		}
+	}
+	return html.EscapeString(url)
+}
+
+// renderInline returns the html of a line of text with its code spans, emphasis, links and images.
+func (c *converter) renderInline(text string) string {
+	var sb strings.Builder
+	for i := 0; i < len(text); {
+		ch := text[i]
+		switch {
+		case ch == '\\' && i+1 < len(text) && strings.IndexByte("\\`*_{}[]()#+-.!<>|~", text[i+1]) >= 0:
+			sb.WriteString(html.EscapeString(text[i+1 : i+2]))
+			i += 2
+			continue
+		case ch == '`':
+			run := len(text[i:]) - len(strings.TrimLeft(text[i:], "`"))
+			delim := text[i : i+run]
+			if end := strings.Index(text[i+run:], delim); end >= 0 {
+				code := strings.TrimSpace(text[i+run : i+run+end])
+				sb.WriteString("<code>" + html.EscapeString(code) + "</code>")
+				i += run + end + run
+				continue
+			}
+			sb.WriteString(delim)
+			i += run
+			continue
+		case ch == '!' && strings.HasPrefix(text[i+1:], "["):
+			if label, url, title, n, ok := parseLink(text[i+1:]); ok {
+				fmt.Fprintf(&sb, `<img src="%s" alt="%s"`, getSafeURL(url), html.EscapeString(stripInline(label)))
+				if title != "" {
+					fmt.Fprintf(&sb, ` title="%s"`, html.EscapeString(title))
+				}
+				sb.WriteString(">")
+				i += 1 + n
+				continue
+			}
+		case ch == '[':
+			if label, url, title, n, ok := parseLink(text[i:]); ok {
+				fmt.Fprintf(&sb, `<a href="%s"`, getSafeURL(url))
+				if title != "" {
+					fmt.Fprintf(&sb, ` title="%s"`, html.EscapeString(title))
+				}
+				sb.WriteString(">" + c.renderInline(label) + "</a>")
+				i += n
+				continue
+			}
+		case ch == '<':
+			if end := strings.IndexByte(text[i:], '>'); end > 0 {
+				url := text[i+1 : i+end]
+				if (strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")) && !strings.ContainsAny(url, " <") {
+					fmt.Fprintf(&sb, `<a href="%s">%s</a>`, html.EscapeString(url), html.EscapeString(url))
+					i += end + 1
+					continue
+				}
+			}
+		case ch == '*' || ch == '_':
+			if n, ok := c.renderEmphasis(&sb, text, i); ok {
+				i += n
+				continue
+			}
+		}
+		sb.WriteString(html.EscapeString(text[i : i+1]))
+		i++
+	}
+	return sb.String()
+}
+
+// renderEmphasis writes the strong or em span starting at text[i] and returns the length it consumed. an
+// underscore inside a word, like in snake_case, is not a marker.
+func (c *converter) renderEmphasis(sb *strings.Builder, text string, i int) (int, bool) {
+	ch := text[i]
+	if ch == '_' && i > 0 && isWordByte(text[i-1]) {
+		return 0, false
+	}
+	for _, size := range []int{2, 1} {
+		delim := strings.Repeat(string(ch), size)
+		if !strings.HasPrefix(text[i:], delim) || i+size >= len(text) || text[i+size] == ' ' {
+			continue
+		}
+		for from := i + size; from < len(text); {
+			end := strings.Index(text[from:], delim)
+			if end < 0 {
+				break
+			}
+			end += from
+			if size == 1 && end+1 < len(text) && text[end+1] == ch {
+				from = end + 2 // the marker of a strong span inside the em one
+				continue
+			}
+			if end > i+size && text[end-1] != ' ' && (ch != '_' || end+size >= len(text) || !isWordByte(text[end+size])) {
+				tag := "em"
+				if size == 2 {
+					tag = "strong"
+				}
+				sb.WriteString("<" + tag + ">" + c.renderInline(text[i+size:end]) + "</" + tag + ">")
+				return end + size - i, true
+			}
+			from = end + size
+		}
+	}
+	return 0, false
+}
+
+// isWordByte reports whether b is a letter or a digit of ascii.
+func isWordByte(b byte) bool {
+	return b < 0x80 && (unicode.IsLetter(rune(b)) || unicode.IsDigit(rune(b)))
+}
+
+// parseLink parses a link like [label](url "title") at the start of text and returns its parts and length.
+func parseLink(text string) (label, url, title string, n int, ok bool) {
+	depth := 0
+	closeLabel := -1
+	for j := 0; j < len(text) && closeLabel < 0; j++ {
+		switch text[j] {
+		case '\\':
+			j++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				closeLabel = j
+			}
+		}
+	}
+	if closeLabel < 0 || !strings.HasPrefix(text[closeLabel+1:], "(") {
+		return "", "", "", 0, false
+	}
+	end := strings.IndexByte(text[closeLabel+2:], ')')
+	if end < 0 {
+		return "", "", "", 0, false
+	}
+	target := strings.TrimSpace(text[closeLabel+2 : closeLabel+2+end])
+	url, title, _ = strings.Cut(target, " ")
+	title = strings.Trim(strings.TrimSpace(title), `"'`)
+	url = strings.TrimSuffix(strings.TrimPrefix(url, "<"), ">")
+	return text[1:closeLabel], url, title, closeLabel + 3 + end, true
+}
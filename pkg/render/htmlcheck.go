@@ -0,0 +1,217 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// maxHTMLProblems limits the problems reported by page, a single unclosed tag often causes many others.
+const maxHTMLProblems = 20
+
+var (
+	// voidElements never have content nor end tag
+	voidElements = []string{"area", "base", "br", "col", "embed", "hr", "img", "input", "link", "meta", "param", "source", "track", "wbr"}
+	// optionalEndElements may be closed implicitly by the next element or the end of their parent
+	optionalEndElements = []string{"html", "head", "body", "p", "li", "dt", "dd", "option", "optgroup", "tr", "td", "th", "thead", "tbody", "tfoot", "colgroup", "caption", "rb", "rt", "rtc", "rp"}
+	// rawTextElements contain text up to their end tag, it is not tokenized
+	rawTextElements = []string{"script", "style", "textarea", "title"}
+)
+
+// htmlOpenTag is an element whose end tag is still expected.
+type htmlOpenTag struct {
+	name string
+	line int
+}
+
+// htmlValidator tokenizes a page and collects its structural problems.
+type htmlValidator struct {
+	page       []byte
+	lineStarts []int // offset of the first byte of each line
+	stack      []htmlOpenTag
+	ids        map[string]int // line of the first element having each id
+	problems   []string
+}
+
+// ValidateHTML tokenizes a rendered page and returns its structural problems : elements not closed or closed in the
+// wrong order, end tags without element, duplicate ids and attributes, and unclosed comments.
+// it does not replace a full HTML5 validator, but catches the usual mistakes made when composing templates.
+func ValidateHTML(page []byte) []string {
+	v := &htmlValidator{page: page, lineStarts: []int{0}, ids: make(map[string]int)}
+	for i, b := range page {
+		if b == '\n' {
+			v.lineStarts = append(v.lineStarts, i+1)
+		}
+	}
+	v.run()
+	if len(v.problems) > maxHTMLProblems {
+		v.problems = append(v.problems[:maxHTMLProblems], fmt.Sprintf("and %d other problems", len(v.problems)-maxHTMLProblems))
+	}
+	return v.problems
+}
+
+// lineAt returns the line number of the byte at offset pos.
+func (v *htmlValidator) lineAt(pos int) int {
+	return sort.SearchInts(v.lineStarts, pos+1)
+}
+
+func (v *htmlValidator) report(format string, args ...any) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+func (v *htmlValidator) run() {
+	page := v.page
+	for i := 0; i < len(page); {
+		lt := bytes.IndexByte(page[i:], '<')
+		if lt < 0 {
+			break
+		}
+		i += lt
+		rest := page[i:]
+		switch {
+		case bytes.HasPrefix(rest, []byte("<!--")):
+			end := bytes.Index(rest[4:], []byte("-->"))
+			if end < 0 {
+				v.report("the comment at line %d is never closed", v.lineAt(i))
+				return
+			}
+			i += 4 + end + 3
+		case bytes.HasPrefix(rest, []byte("<!")) || bytes.HasPrefix(rest, []byte("<?")):
+			i += max(bytes.IndexByte(rest, '>'), 0) + 1
+		case len(rest) > 2 && rest[1] == '/' && isASCIILetter(rest[2]):
+			name, end := readTagName(rest, 2)
+			v.closeTag(name, v.lineAt(i))
+			i += max(bytes.IndexByte(rest[end:], '>'), 0) + end + 1
+		case len(rest) > 1 && isASCIILetter(rest[1]):
+			i += v.openTag(i)
+		default:
+			i++
+		}
+	}
+	for _, open := range v.stack {
+		if !slices.Contains(optionalEndElements, open.name) {
+			v.report("<%s> opened at line %d is never closed", open.name, open.line)
+		}
+	}
+}
+
+// openTag reads the start tag at offset pos and returns its length, including the raw text of script and style.
+func (v *htmlValidator) openTag(pos int) int {
+	page, line := v.page[pos:], v.lineAt(pos)
+	name, i := readTagName(page, 1)
+	seen := make(map[string]bool)
+	selfClosing := false
+	for i < len(page) && page[i] != '>' {
+		switch c := page[i]; {
+		case c == '/':
+			selfClosing = true
+			i++
+			continue
+		case isHTMLSpace(c):
+			i++
+			continue
+		}
+		selfClosing = false
+		start := i
+		for i < len(page) && !isHTMLSpace(page[i]) && page[i] != '=' && page[i] != '>' && page[i] != '/' {
+			i++
+		}
+		attr := string(bytes.ToLower(page[start:i]))
+		for i < len(page) && isHTMLSpace(page[i]) {
+			i++
+		}
+		value := ""
+		if i < len(page) && page[i] == '=' {
+			i++
+			for i < len(page) && isHTMLSpace(page[i]) {
+				i++
+			}
+			if i < len(page) && (page[i] == '"' || page[i] == '\'') {
+				quote := page[i]
+				end := bytes.IndexByte(page[i+1:], quote)
+				if end < 0 {
+					v.report("the %s attribute of <%s> at line %d has no closing quote", attr, name, line)
+					return len(page)
+				}
+				value = string(page[i+1 : i+1+end])
+				i += end + 2
+			} else {
+				valueStart := i
+				for i < len(page) && !isHTMLSpace(page[i]) && page[i] != '>' {
+					i++
+				}
+				value = string(page[valueStart:i])
+			}
+		}
+		if seen[attr] {
+			v.report("<%s> at line %d has the %s attribute twice", name, line, attr)
+		}
+		seen[attr] = true
+		if attr == "id" && value != "" {
+			if first, used := v.ids[value]; used {
+				v.report("id %q at line %d is already used at line %d", value, line, first)
+			} else {
+				v.ids[value] = line
+			}
+		}
+	}
+	if i >= len(page) {
+		v.report("<%s> at line %d is never ended by >", name, line)
+		return len(page)
+	}
+	i++
+	if selfClosing || slices.Contains(voidElements, name) {
+		return i
+	}
+	if slices.Contains(rawTextElements, name) {
+		end := bytes.Index(bytes.ToLower(page[i:]), []byte("</"+name))
+		if end < 0 {
+			v.report("<%s> opened at line %d is never closed", name, line)
+			return len(page)
+		}
+		// the end tag is consumed here, its element was never pushed
+		i += end
+		return i + max(bytes.IndexByte(page[i:], '>'), 0) + 1
+	}
+	v.stack = append(v.stack, htmlOpenTag{name: name, line: line})
+	return i
+}
+
+// closeTag pops the elements up to the one closed by the end tag name, those not closed are reported.
+func (v *htmlValidator) closeTag(name string, line int) {
+	if slices.Contains(voidElements, name) {
+		v.report("</%s> at line %d closes a void element, which has no end tag", name, line)
+		return
+	}
+	for i := len(v.stack) - 1; i >= 0; i-- {
+		if v.stack[i].name != name {
+			continue
+		}
+		for _, open := range v.stack[i+1:] {
+			if !slices.Contains(optionalEndElements, open.name) {
+				v.report("<%s> opened at line %d is not closed before </%s> at line %d", open.name, open.line, name, line)
+			}
+		}
+		v.stack = v.stack[:i]
+		return
+	}
+	v.report("</%s> at line %d closes no open element", name, line)
+}
+
+// readTagName returns the lowercase tag name starting at offset start of b, and the offset following it.
+func readTagName(b []byte, start int) (string, int) {
+	i := start
+	for i < len(b) && !isHTMLSpace(b[i]) && b[i] != '>' && b[i] != '/' {
+		i++
+	}
+	return string(bytes.ToLower(b[start:i])), i
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
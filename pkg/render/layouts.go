@@ -0,0 +1,74 @@
+package render
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	LayoutsDir          = "layouts"      // directory of the layouts inside the templates directory
+	DefaultLayout       = "base_layout"  // layout of the pages without one, and of the error pages
+	LayoutEntryTemplate = "page_layout"  // template executed to render a page, it calls the root layout of the page
+	PrintEntryTemplate  = "print_layout" // template executed to render the print and pdf versions of a page
+)
+
+// layoutExtendsRegex matches the first line of a layout extending a parent, like {{/* extends "base_layout" */}}
+var layoutExtendsRegex = regexp.MustCompile(`^\s*\{\{-?\s*/\*\s*extends\s+"([\w-]+)"\s*\*/\s*-?\}\}`)
+
+// LayoutName returns the layout of a page, the default one when it has none.
+func LayoutName(name string) string {
+	if strings.TrimSpace(name) == "" {
+		return DefaultLayout
+	}
+	return name
+}
+
+// LayoutChain returns the files of the layout name of the templates of dir and of all its parents, starting with the
+// root layout. a layout lives in templates/layouts/<name>.gohtml, it extends a parent when its first line is
+// {{/* extends "parent" */}}
+func LayoutChain(dir, name string) ([]string, string, error) {
+	var chain []string
+	var seen []string
+	for {
+		if slices.Contains(seen, name) {
+			return nil, "", fmt.Errorf("layout %q extends itself through %s", name, strings.Join(seen, " -> "))
+		}
+		if strings.ContainsAny(name, `/\.`) {
+			return nil, "", fmt.Errorf("invalid layout name %q, use the file name without extension", name)
+		}
+		seen = append(seen, name)
+		layoutPath := filepath.Join(dir, LayoutsDir, name+".gohtml")
+		content, err := os.ReadFile(layoutPath)
+		if err != nil {
+			return nil, "", fmt.Errorf("error reading layout %q: %w", name, err)
+		}
+		chain = append([]string{layoutPath}, chain...)
+		m := layoutExtendsRegex.FindSubmatch(content)
+		if m == nil {
+			return chain, name, nil
+		}
+		name = string(m[1])
+	}
+}
+
+// ParseLayout parses the layout chain of the templates of dir into tmpl, the root first so that the children override
+// its blocks, and defines the page_layout entry template calling the root layout.
+func ParseLayout(tmpl *template.Template, dir, name string) error {
+	chain, root, err := LayoutChain(dir, LayoutName(name))
+	if err != nil {
+		return err
+	}
+	if _, err := tmpl.ParseFiles(chain...); err != nil {
+		return err
+	}
+	if tmpl.Lookup(root) == nil {
+		return fmt.Errorf("the root layout file %s must define the template %q", chain[0], root)
+	}
+	_, err = tmpl.Parse(fmt.Sprintf(`{{define %q}}{{template %q .}}{{end}}`, LayoutEntryTemplate, root))
+	return err
+}
@@ -0,0 +1,67 @@
+package render
+
+import (
+	"bytes"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLayoutChain(t *testing.T) {
+	dir := t.TempDir()
+	layouts := map[string]string{
+		"base_layout": `{{define "base_layout"}}<main>{{block "main" .}}base{{end}}</main>{{end}}`,
+		"docs":        `{{/* extends "base_layout" */}}{{define "main"}}docs {{block "toc" .}}{{end}}{{end}}`,
+		"api":         `{{/* extends "docs" */}}{{define "toc"}}api{{end}}`,
+		"loop_a":      `{{/* extends "loop_b" */}}`,
+		"loop_b":      `{{/* extends "loop_a" */}}`,
+	}
+	if err := os.MkdirAll(filepath.Join(dir, LayoutsDir), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range layouts {
+		if err := os.WriteFile(filepath.Join(dir, LayoutsDir, name+".gohtml"), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name     string
+		wantRoot string
+		wantLen  int
+		wantErr  string
+	}{
+		{name: "base_layout", wantRoot: "base_layout", wantLen: 1},
+		{name: "api", wantRoot: "base_layout", wantLen: 3},
+		{name: "loop_a", wantErr: "extends itself"},
+		{name: "../secret", wantErr: "invalid layout name"},
+		{name: "missing", wantErr: "error reading layout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain, root, err := LayoutChain(dir, tt.name)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("LayoutChain() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || root != tt.wantRoot || len(chain) != tt.wantLen {
+				t.Errorf("LayoutChain() = %v, %s, %v, want %d files with root %s", chain, root, err, tt.wantLen, tt.wantRoot)
+			}
+		})
+	}
+
+	tmpl := template.New("page")
+	if err := ParseLayout(tmpl, dir, "api"); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, LayoutEntryTemplate, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "<main>docs api</main>" {
+		t.Errorf("page of the api layout = %q, want the blocks of the children", got)
+	}
+}
@@ -0,0 +1,199 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template/parse"
+	"time"
+)
+
+const (
+	templateMarkFunc = "templateMark"
+	// the marks are written around each template in dev mode, with private use characters left as is by the escaping
+	templateMarkStart = '\uE000'
+	templateMarkEnd   = '\uE001'
+)
+
+// templateMarkRegex matches a mark written by MarkTemplate, like begin or end, name, file and time in nanoseconds.
+var templateMarkRegex = regexp.MustCompile(`\x{E000}([be])\|([^|\x{E001}]*)\|([^|\x{E001}]*)\|(\d+)\x{E001}`)
+
+// templateTiming is a template rendered in a page, shown by the panel of ?debugTemplates.
+type templateTiming struct {
+	Name     string
+	File     string
+	Depth    int // number of templates around it
+	Duration time.Duration
+}
+
+// templateDebugPanel lists the templates rendered in the page, standalone so it does not depend on the templates of
+// the site.
+var templateDebugPanel = template.Must(template.New("templates").Parse(`
+<details id="jsonsitego-templates" open style="position:fixed;right:1rem;bottom:1rem;z-index:2147483647;max-width:32rem;max-height:50vh;overflow:auto;padding:.5rem 1rem;background:#fff;color:#222;border:1px solid #888;border-radius:.25rem;font:12px/1.4 monospace">
+    <summary>Templates of this page</summary>
+    <table>
+        {{range .}}
+            <tr><td style="padding-left:{{.Depth}}rem">{{.Name}}</td><td>{{.File}}</td><td style="text-align:right">{{.Duration}}</td></tr>
+        {{end}}
+    </table>
+</details>
+`))
+
+// MarkTemplate returns the mark written before, when edge is b, or after, when edge is e, the template name of file.
+func MarkTemplate(edge, name, file string) string {
+	return fmt.Sprintf("%c%s|%s|%s|%d%c", templateMarkStart, edge, name, file, time.Now().UnixNano(), templateMarkEnd)
+}
+
+// TemplateFile returns the file the template name of tmpl was parsed from, empty when it was not parsed from a file.
+func TemplateFile(tmpl *template.Template, name string) string {
+	t := tmpl.Lookup(name)
+	if t == nil || t.Tree == nil || filepath.Ext(t.Tree.ParseName) == "" {
+		return ""
+	}
+	return t.Tree.ParseName
+}
+
+// InstrumentTemplates marks the begin and the end of each {{template}} called by the templates of tmpl, it is only
+// used in dev mode. the trees are copied since the clones of a template share them, and the calls inside a tag, a
+// script or a style are not marked since the marks would be escaped there.
+func InstrumentTemplates(tmpl *template.Template) error {
+	tmpl.Funcs(template.FuncMap{templateMarkFunc: MarkTemplate})
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil || t.Tree.Root == nil {
+			continue
+		}
+		tree := t.Tree.Copy()
+		if err := instrumentList(tree.Root, tmpl); err != nil {
+			return err
+		}
+		if _, err := tmpl.AddParseTree(t.Name(), tree); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// instrumentList surrounds the template nodes of list with the actions writing their marks.
+func instrumentList(list *parse.ListNode, tmpl *template.Template) error {
+	if list == nil {
+		return nil
+	}
+	var nodes []parse.Node
+	text := ""
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.TextNode:
+			text += string(n.Text)
+		case *parse.TemplateNode:
+			if isMarkableText(text) {
+				file := TemplateFile(tmpl, n.Name)
+				begin, err := getTemplateMarkNode("b", n.Name, file)
+				if err != nil {
+					return err
+				}
+				end, err := getTemplateMarkNode("e", n.Name, file)
+				if err != nil {
+					return err
+				}
+				nodes = append(nodes, begin, n, end)
+				continue
+			}
+		case *parse.IfNode:
+			if err := instrumentBranch(&n.BranchNode, tmpl); err != nil {
+				return err
+			}
+		case *parse.RangeNode:
+			if err := instrumentBranch(&n.BranchNode, tmpl); err != nil {
+				return err
+			}
+		case *parse.WithNode:
+			if err := instrumentBranch(&n.BranchNode, tmpl); err != nil {
+				return err
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	list.Nodes = nodes
+	return nil
+}
+
+// instrumentBranch instruments both lists of an if, range or with.
+func instrumentBranch(branch *parse.BranchNode, tmpl *template.Template) error {
+	if err := instrumentList(branch.List, tmpl); err != nil {
+		return err
+	}
+	return instrumentList(branch.ElseList, tmpl)
+}
+
+// isMarkableText reports whether the html text before a template call leaves it in the text of the page, not in a
+// tag, a script or a style.
+func isMarkableText(text string) bool {
+	lower := strings.ToLower(text)
+	if strings.LastIndex(lower, "<") > strings.LastIndex(lower, ">") {
+		return false
+	}
+	for _, element := range []string{"script", "style"} {
+		if strings.LastIndex(lower, "<"+element) > strings.LastIndex(lower, "</"+element) {
+			return false
+		}
+	}
+	return true
+}
+
+// getTemplateMarkNode returns the action writing the mark of edge for the template name of file.
+func getTemplateMarkNode(edge, name, file string) (parse.Node, error) {
+	trees, err := parse.Parse("mark", fmt.Sprintf("{{%s %q %q %q}}", templateMarkFunc, edge, name, file), "{{", "}}", map[string]any{templateMarkFunc: MarkTemplate})
+	if err != nil {
+		return nil, err
+	}
+	return trees["mark"].Root.Nodes[0], nil
+}
+
+// ApplyMarks removes the marks of the templates from the body of a page, or, when show is true, replaces them
+// with html comments giving the name, the file and the render time of each template, and adds a panel listing them.
+func ApplyMarks(body []byte, show bool) []byte {
+	if !bytes.ContainsRune(body, templateMarkStart) {
+		return body
+	}
+	if !show {
+		return templateMarkRegex.ReplaceAll(body, nil)
+	}
+	type openTemplate struct {
+		entry int
+		start int64
+	}
+	var timings []templateTiming
+	var stack []openTemplate
+	body = templateMarkRegex.ReplaceAllFunc(body, func(mark []byte) []byte {
+		m := templateMarkRegex.FindSubmatch(mark)
+		name, file := strings.ReplaceAll(string(m[2]), "--", "- -"), string(m[3])
+		at, _ := strconv.ParseInt(string(m[4]), 10, 64)
+		if m[1][0] == 'b' {
+			timings = append(timings, templateTiming{Name: name, File: file, Depth: len(stack)})
+			stack = append(stack, openTemplate{entry: len(timings) - 1, start: at})
+			if file != "" {
+				name += " " + file
+			}
+			return fmt.Appendf(nil, "<!-- ▶ %s -->", name)
+		}
+		if len(stack) == 0 {
+			return nil
+		}
+		open := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		timings[open.entry].Duration = time.Duration(at - open.start).Round(time.Microsecond)
+		return fmt.Appendf(nil, "<!-- ◀ %s %v -->", name, timings[open.entry].Duration)
+	})
+	var panel bytes.Buffer
+	if err := templateDebugPanel.Execute(&panel, timings); err != nil {
+		return body
+	}
+	if i := bytes.LastIndex(body, []byte("</body>")); i >= 0 {
+		return append(body[:i:i], append(panel.Bytes(), body[i:]...)...)
+	}
+	return append(body, panel.Bytes()...)
+}
@@ -0,0 +1,95 @@
+// Package render assembles the html/template templates of the pages of a JsonSiteGo site: the layout chains, the
+// templates kept between the builds while their files do not change, the pages compiled at their first request,
+// the check of the templates called and defined nowhere, and the marks showing the templates of a page in dev mode.
+// the engine binding them to the config and the functions of a site is the one of the server.
+package render
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Renderer renders one assembled page, *html/template.Template and *text/template.Template implement it.
+type Renderer interface {
+	ExecuteTemplate(w io.Writer, name string, data any) error
+}
+
+// Parsed is a template never executed, cloned for each build of the site, with the fingerprint of the files it was
+// parsed from.
+type Parsed struct {
+	Fingerprint string
+	Tmpl        *template.Template
+}
+
+// Cache keeps the templates of a build by route of the pages and name of the error pages, completed later by the
+// pages compiled at their first request in lazy mode.
+type Cache struct {
+	mu        sync.Mutex
+	templates map[string]Parsed
+}
+
+// NewCache returns an empty Cache.
+func NewCache() *Cache {
+	return &Cache{templates: make(map[string]Parsed)}
+}
+
+// Get returns the template of key, a nil Cache has none.
+func (c *Cache) Get(key string) (Parsed, bool) {
+	if c == nil {
+		return Parsed{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	parsed, found := c.templates[key]
+	return parsed, found
+}
+
+// Set keeps the template of key.
+func (c *Cache) Set(key string, parsed Parsed) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.templates[key] = parsed
+}
+
+// Lazy is the renderer of a page compiled at its first request, the requests arriving meanwhile wait for the same
+// compilation. a compilation error is returned to all the requests until the next build.
+type Lazy struct {
+	once    sync.Once
+	compile func() (*template.Template, error)
+	tmpl    *template.Template
+	err     error
+}
+
+// NewLazy returns the renderer of the template returned by compile at its first use.
+func NewLazy(compile func() (*template.Template, error)) *Lazy {
+	return &Lazy{compile: compile}
+}
+
+func (t *Lazy) ExecuteTemplate(w io.Writer, name string, data any) error {
+	t.once.Do(func() {
+		t.tmpl, t.err = t.compile()
+		t.compile = nil
+	})
+	if t.err != nil {
+		return t.err
+	}
+	return t.tmpl.ExecuteTemplate(w, name, data)
+}
+
+// FilesFingerprint returns the path, size and modification time of the files, a change of one of them changes
+// the fingerprint. a missing file is part of it too, so that its creation is seen.
+func FilesFingerprint(files []string) string {
+	var sb strings.Builder
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			fmt.Fprintf(&sb, "%s|%d|%d\n", file, info.Size(), info.ModTime().UnixNano())
+		} else {
+			fmt.Fprintf(&sb, "%s|missing\n", file)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,55 @@
+package render
+
+import (
+	"fmt"
+	"html/template"
+	"slices"
+	"strings"
+	"text/template/parse"
+)
+
+// CheckTemplateCalls returns an error listing the templates called with {{template}} by the templates of tmpl and
+// defined nowhere, which would only fail when the branch calling them is rendered.
+func CheckTemplateCalls(tmpl *template.Template) error {
+	var problems []string
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil || t.Tree.Root == nil {
+			continue
+		}
+		for _, name := range getCalledTemplates(t.Tree.Root) {
+			if tmpl.Lookup(name) == nil {
+				problem := fmt.Sprintf("%q called by %q", name, t.Name())
+				if !slices.Contains(problems, problem) {
+					problems = append(problems, problem)
+				}
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("undefined templates: %s", strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// getCalledTemplates returns the names of the templates called with {{template}} in node and its branches.
+func getCalledTemplates(node parse.Node) []string {
+	var names []string
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			names = append(names, getCalledTemplates(child)...)
+		}
+	case *parse.TemplateNode:
+		names = append(names, n.Name)
+	case *parse.IfNode:
+		names = append(append(names, getCalledTemplates(n.List)...), getCalledTemplates(n.ElseList)...)
+	case *parse.RangeNode:
+		names = append(append(names, getCalledTemplates(n.List)...), getCalledTemplates(n.ElseList)...)
+	case *parse.WithNode:
+		names = append(append(names, getCalledTemplates(n.List)...), getCalledTemplates(n.ElseList)...)
+	}
+	return names
+}
@@ -0,0 +1,281 @@
+// Package sanitize removes from html the elements and attributes a policy does not allow, like bluemonday does.
+// the html is tokenized and written again: the text is escaped, the allowed elements are written with their allowed
+// attributes only, the other elements are removed but their text is kept, and the content of script, style and the
+// other active elements is dropped. the elements left open are closed at the end.
+package sanitize
+
+import (
+	"html"
+	"slices"
+	"strings"
+)
+
+var (
+	// droppedElements are removed with their content, whatever the policy.
+	droppedElements = []string{"script", "style", "iframe", "frame", "frameset", "object", "embed", "applet", "template",
+		"noscript", "noembed", "noframes", "textarea", "title", "xmp", "plaintext", "svg", "math", "select", "button", "form", "base", "meta", "link"}
+	// voidElements never have content nor end tag
+	voidElements = []string{"area", "br", "col", "hr", "img", "source", "track", "wbr"}
+	// urlAttributes have a url checked against the schemes of the policy
+	urlAttributes = []string{"href", "src", "cite", "action", "formaction", "poster", "background", "longdesc", "usemap", "xlink:href"}
+	// forbiddenAttributes are never written, whatever the policy
+	forbiddenAttributes = []string{"style", "srcset", "formaction", "xmlns"}
+)
+
+// Policy lists the elements and attributes kept by Sanitize.
+type Policy struct {
+	Elements   []string            // allowed elements, lowercase
+	Attributes map[string][]string // allowed attributes by element, those of "*" are allowed on all the allowed elements
+	URLSchemes []string            // allowed schemes of the url attributes, like https, the relative urls are always allowed
+}
+
+// Text returns the policy keeping the text only.
+func Text() *Policy {
+	return &Policy{}
+}
+
+// UGC returns the policy of the user generated content: the formatting, headings, lists, quotes, code, tables,
+// links and images, with http, https, mailto and tel urls.
+func UGC() *Policy {
+	return &Policy{
+		Elements: []string{"p", "br", "hr", "div", "span", "h1", "h2", "h3", "h4", "h5", "h6", "b", "strong", "i", "em",
+			"u", "s", "del", "ins", "mark", "small", "sub", "sup", "abbr", "cite", "q", "blockquote", "code", "kbd", "samp",
+			"pre", "ul", "ol", "li", "dl", "dt", "dd", "a", "img", "figure", "figcaption", "table", "caption", "thead",
+			"tbody", "tfoot", "tr", "th", "td", "details", "summary", "time"},
+		Attributes: map[string][]string{
+			"*":          {"title", "lang", "dir"},
+			"a":          {"href"},
+			"img":        {"src", "alt", "width", "height"},
+			"abbr":       {"title"},
+			"blockquote": {"cite"},
+			"q":          {"cite"},
+			"ol":         {"start", "reversed", "type"},
+			"th":         {"colspan", "rowspan", "scope"},
+			"td":         {"colspan", "rowspan"},
+			"time":       {"datetime"},
+			"details":    {"open"},
+		},
+		URLSchemes: []string{"http", "https", "mailto", "tel"},
+	}
+}
+
+// IsDropped reports whether the element name is always removed with its content.
+func IsDropped(name string) bool {
+	return slices.Contains(droppedElements, strings.ToLower(name))
+}
+
+// Sanitize returns the html of src keeping only what p allows.
+func (p *Policy) Sanitize(src string) string {
+	var sb strings.Builder
+	var open []string
+	for i := 0; i < len(src); {
+		lt := strings.IndexByte(src[i:], '<')
+		if lt < 0 {
+			sb.WriteString(escapeText(src[i:]))
+			break
+		}
+		sb.WriteString(escapeText(src[i : i+lt]))
+		i += lt
+		rest := src[i:]
+		switch {
+		case strings.HasPrefix(rest, "<!--"):
+			end := strings.Index(rest[4:], "-->")
+			if end < 0 {
+				i = len(src)
+			} else {
+				i += 4 + end + 3
+			}
+		case strings.HasPrefix(rest, "<!") || strings.HasPrefix(rest, "<?"):
+			i += skipTag(rest)
+		case len(rest) > 2 && rest[1] == '/' && isASCIILetter(rest[2]):
+			name, _ := readName(rest, 2)
+			i += skipTag(rest)
+			if at := slices.Index(open, name); at >= 0 {
+				for j := len(open) - 1; j >= at; j-- {
+					sb.WriteString("</" + open[j] + ">")
+				}
+				open = open[:at]
+			}
+		case len(rest) > 1 && isASCIILetter(rest[1]):
+			tag, n := p.readStartTag(rest)
+			i += n
+			switch {
+			case IsDropped(tag.name):
+				i += skipContent(src[i:], tag.name)
+			case tag.allowed:
+				sb.WriteString(tag.html)
+				if !slices.Contains(voidElements, tag.name) && !tag.selfClosing {
+					open = append(open, tag.name)
+				}
+			}
+		default:
+			sb.WriteString("&lt;")
+			i++
+		}
+	}
+	for j := len(open) - 1; j >= 0; j-- {
+		sb.WriteString("</" + open[j] + ">")
+	}
+	return sb.String()
+}
+
+// startTag is a start tag read by readStartTag, html is the tag written again when allowed.
+type startTag struct {
+	name        string
+	allowed     bool
+	selfClosing bool
+	html        string
+}
+
+// readStartTag reads the start tag at the beginning of s and returns it with its length, a tag without > takes all s.
+func (p *Policy) readStartTag(s string) (startTag, int) {
+	name, i := readName(s, 1)
+	tag := startTag{name: name, allowed: slices.Contains(p.Elements, name) && !IsDropped(name)}
+	var sb strings.Builder
+	sb.WriteString("<" + name)
+	var seen []string
+	for i < len(s) && s[i] != '>' {
+		if s[i] == '/' || isHTMLSpace(s[i]) {
+			tag.selfClosing = s[i] == '/'
+			i++
+			continue
+		}
+		tag.selfClosing = false
+		start := i
+		for i < len(s) && !isHTMLSpace(s[i]) && s[i] != '=' && s[i] != '>' && s[i] != '/' {
+			i++
+		}
+		attr := strings.ToLower(s[start:i])
+		for i < len(s) && isHTMLSpace(s[i]) {
+			i++
+		}
+		value, hasValue := "", false
+		if i < len(s) && s[i] == '=' {
+			hasValue = true
+			i++
+			for i < len(s) && isHTMLSpace(s[i]) {
+				i++
+			}
+			if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+				end := strings.IndexByte(s[i+1:], s[i])
+				if end < 0 {
+					return startTag{name: name}, len(s)
+				}
+				value = s[i+1 : i+1+end]
+				i += end + 2
+			} else {
+				valueStart := i
+				for i < len(s) && !isHTMLSpace(s[i]) && s[i] != '>' {
+					i++
+				}
+				value = s[valueStart:i]
+			}
+		}
+		if slices.Contains(seen, attr) || !p.isAllowedAttribute(name, attr) {
+			continue
+		}
+		// the first one wins like in the browsers
+		seen = append(seen, attr)
+		value = html.UnescapeString(value)
+		if slices.Contains(urlAttributes, attr) && !p.isAllowedURL(value) {
+			continue
+		}
+		if hasValue {
+			sb.WriteString(" " + attr + `="` + html.EscapeString(value) + `"`)
+		} else {
+			sb.WriteString(" " + attr)
+		}
+	}
+	if i >= len(s) {
+		return startTag{name: name}, len(s)
+	}
+	sb.WriteString(">")
+	tag.html = sb.String()
+	return tag, i + 1
+}
+
+// isAllowedAttribute reports whether attr is allowed on the element name, the event handlers never are.
+func (p *Policy) isAllowedAttribute(name, attr string) bool {
+	if attr == "" || strings.HasPrefix(attr, "on") || slices.Contains(forbiddenAttributes, attr) {
+		return false
+	}
+	return slices.Contains(p.Attributes[name], attr) || slices.Contains(p.Attributes["*"], attr)
+}
+
+// isAllowedURL reports whether the url is relative or has a scheme of the policy.
+func (p *Policy) isAllowedURL(url string) bool {
+	// the browsers ignore the spaces and control characters of the scheme, like in java\tscript:
+	cleaned := strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, url)
+	scheme, _, found := strings.Cut(cleaned, ":")
+	if !found || strings.ContainsAny(scheme, "/?#") {
+		return true
+	}
+	return slices.Contains(p.URLSchemes, strings.ToLower(scheme))
+}
+
+// escapeText returns the text of the html src, escaped again.
+func escapeText(src string) string {
+	return html.EscapeString(html.UnescapeString(src))
+}
+
+// skipTag returns the length of the tag at the beginning of s, up to its >, all s when it has none.
+func skipTag(s string) int {
+	if end := strings.IndexByte(s, '>'); end >= 0 {
+		return end + 1
+	}
+	return len(s)
+}
+
+// skipContent returns the length of the content of the element name at the beginning of s with its end tag, all s
+// when it is never closed.
+func skipContent(s, name string) int {
+	end := indexASCIIFold(s, "</"+name)
+	if end < 0 {
+		return len(s)
+	}
+	return end + skipTag(s[end:])
+}
+
+// indexASCIIFold returns the offset of the first instance of the lowercase ascii substr in s, ignoring the ascii
+// case, or -1. unlike strings.ToLower it keeps the byte offsets of s, which lowercasing some runes would change.
+func indexASCIIFold(s, substr string) int {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		j := 0
+		for j < len(substr) && toLowerASCII(s[i+j]) == substr[j] {
+			j++
+		}
+		if j == len(substr) {
+			return i
+		}
+	}
+	return -1
+}
+
+func toLowerASCII(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// readName returns the lowercase tag name starting at offset start of s, and the offset following it.
+func readName(s string, start int) (string, int) {
+	i := start
+	for i < len(s) && !isHTMLSpace(s[i]) && s[i] != '>' && s[i] != '/' {
+		i++
+	}
+	return strings.ToLower(s[start:i]), i
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
@@ -0,0 +1,181 @@
+package sanitize
+
+import (
+	"html"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// xssCorpus are classic payloads, from the OWASP cheat sheet among others, none of them may leave an active element,
+// an event handler or a script url in the output of UGC.
+var xssCorpus = []string{
+	`<script>alert(1)</script>`,
+	`<SCRIPT SRC=//evil.example.com/x.js></SCRIPT>`,
+	`<script/xss src=//evil.example.com/x.js></script>`,
+	`<scr<script>ipt>alert(1)</script>`,
+	`<<script>alert(1);//<</script>`,
+	`<script>alert(1)`,
+	`<img src=x onerror=alert(1)>`,
+	`<img src="x" onerror="alert(1)"/>`,
+	`<img src=x ONERROR=alert(1)>`,
+	`<img/src=x/onerror=alert(1)>`,
+	`<img src=x onerror	=alert(1)>`,
+	`<img src="x` + "\n" + `" onerror="alert(1)">`,
+	`<img """><script>alert(1)</script>">`,
+	`<img src=javascript:alert(1)>`,
+	`<img src="jav&#x09;ascript:alert(1)">`,
+	`<a href="javascript:alert(1)">x</a>`,
+	`<a href="JaVaScRiPt:alert(1)">x</a>`,
+	`<a href=" javascript:alert(1)">x</a>`,
+	`<a href="java` + "\t" + `script:alert(1)">x</a>`,
+	`<a href="java&#x0A;script:alert(1)">x</a>`,
+	`<a href="&#106;&#97;&#118;&#97;&#115;&#99;&#114;&#105;&#112;&#116;&#58;alert(1)">x</a>`,
+	`<a href="&#x6A;avascript&colon;alert(1)">x</a>`,
+	`<a href="javascript&#0000058alert(1)">x</a>`,
+	`<a href="vbscript:msgbox(1)">x</a>`,
+	`<a href="data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==">x</a>`,
+	`<a href="x" onclick="alert(1)">x</a>`,
+	`<a href='x' title='"><script>alert(1)</script>'>x</a>`,
+	`<a title=x"onmouseover=alert(1)>x</a>`,
+	`<a href="https://example.com" href="javascript:alert(1)">x</a>`,
+	`<a href="javascript:alert(1)" href="https://example.com">x</a>`,
+	`<p style="background:url(javascript:alert(1))">x</p>`,
+	`<div style="x:expression(alert(1))">x</div>`,
+	`<svg onload=alert(1)>`,
+	`<svg><script>alert(1)</script></svg>`,
+	`<math><mtext><table><mglyph><style><img src=x onerror=alert(1)>`,
+	`<iframe src="javascript:alert(1)"></iframe>`,
+	`<iframe srcdoc="<script>alert(1)</script>"></iframe>`,
+	`<object data="javascript:alert(1)"></object>`,
+	`<embed src="javascript:alert(1)">`,
+	`<form action="javascript:alert(1)"><button>x</button></form>`,
+	`<button formaction="javascript:alert(1)">x</button>`,
+	`<input onfocus=alert(1) autofocus>`,
+	`<details open ontoggle=alert(1)>`,
+	`<body onload=alert(1)>`,
+	`<video><source onerror="alert(1)"></video>`,
+	`<base href="javascript:alert(1)//">`,
+	`<meta http-equiv="refresh" content="0;url=javascript:alert(1)">`,
+	`<link rel=stylesheet href="javascript:alert(1)">`,
+	`<style>@import 'javascript:alert(1)';</style>`,
+	`<textarea><script>alert(1)</script></textarea>`,
+	`<noscript><p title="</noscript><img src=x onerror=alert(1)>">`,
+	`<title><img src=x onerror=alert(1)></title>`,
+	`<template><script>alert(1)</script></template>`,
+	`<!--<img src=x onerror=alert(1)>-->`,
+	`<!--><img src=x onerror=alert(1)>-->`,
+	`<![CDATA[<img src=x onerror=alert(1)>]]>`,
+	`<?xml version="1.0"?><img src=x onerror=alert(1)>`,
+	`&lt;script&gt;alert(1)&lt;/script&gt;`,
+	`<img src=x onerror=&#97;lert(1)>`,
+	`<a href="#" xlink:href="javascript:alert(1)">x</a>`,
+	`<img src="x" srcset="javascript:alert(1) 1x">`,
+	`<a href="//evil.example.com/%0a<script>">x</a>`,
+	`</p><script>alert(1)</script><p>`,
+	`<p>unclosed <b>bold <i>italic`,
+	`<a href="https://example.com/?q=<script>">x</a>`,
+	`<img src=x onerror=alert(1)`,
+	`<a href="x`,
+	"<script>" + strings.Repeat("Ⱥ", 20) + "</script><img src=x onerror=alert(1)>",
+	"<script>" + strings.Repeat("İ", 20) + "</script><img src=x onerror=alert(1)>",
+}
+
+var (
+	tagRegex       = regexp.MustCompile(`<(/?)([^\s/>]+)([^>]*)>`)
+	attributeRegex = regexp.MustCompile(`\s([^\s="]+)(?:="([^"]*)")?`)
+)
+
+// checkSafe fails t when the output of the policy has an element or an attribute it does not allow, an event handler,
+// a script url, or a < or > that does not belong to a tag. it does not use the checks of the policy it tests.
+func checkSafe(t *testing.T, p *Policy, input, output string) {
+	t.Helper()
+	for _, tag := range tagRegex.FindAllStringSubmatch(output, -1) {
+		name, attributes := tag[2], tag[3]
+		if !slices.Contains(p.Elements, name) {
+			t.Errorf("Sanitize(%q) = %q keeps the element %s", input, output, name)
+		}
+		if tag[1] == "/" {
+			continue
+		}
+		rest := attributeRegex.ReplaceAllStringFunc(attributes, func(attribute string) string {
+			parts := attributeRegex.FindStringSubmatch(attribute)
+			attribute = parts[1]
+			if strings.HasPrefix(attribute, "on") || attribute == "style" || attribute == "srcset" ||
+				(!slices.Contains(p.Attributes[name], attribute) && !slices.Contains(p.Attributes["*"], attribute)) {
+				t.Errorf("Sanitize(%q) = %q keeps the attribute %s", input, output, attribute)
+			}
+			value := strings.ToLower(strings.Map(func(r rune) rune {
+				if r <= ' ' {
+					return -1
+				}
+				return r
+			}, html.UnescapeString(parts[2])))
+			if slices.Contains(urlAttributes, attribute) && (strings.HasPrefix(value, "javascript:") || strings.HasPrefix(value, "vbscript:") || strings.HasPrefix(value, "data:")) {
+				t.Errorf("Sanitize(%q) = %q keeps the url %s", input, output, value)
+			}
+			return ""
+		})
+		if strings.TrimSpace(rest) != "" {
+			t.Errorf("Sanitize(%q) = %q has a malformed tag %s", input, output, tag[0])
+		}
+	}
+	if text := tagRegex.ReplaceAllString(output, ""); strings.ContainsAny(text, "<>\"") {
+		t.Errorf("Sanitize(%q) = %q has markup outside of the tags", input, output)
+	}
+}
+
+func TestSanitizeXSSCorpus(t *testing.T) {
+	for _, policy := range []struct {
+		name string
+		p    *Policy
+	}{{"ugc", UGC()}, {"text", Text()}} {
+		t.Run(policy.name, func(t *testing.T) {
+			for _, input := range xssCorpus {
+				checkSafe(t, policy.p, input, policy.p.Sanitize(input))
+			}
+		})
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: `<p>Hello <b>world</b></p>`, want: `<p>Hello <b>world</b></p>`},
+		{input: `<script>alert(1)</script>text`, want: `text`},
+		{input: `<p onclick="alert(1)" title="t">x</p>`, want: `<p title="t">x</p>`},
+		{input: `<a href="javascript:alert(1)" title="t">x</a>`, want: `<a title="t">x</a>`},
+		{input: `<a href="java&#x09;script:alert(1)">x</a>`, want: `<a>x</a>`},
+		{input: `<a href="/docs?a=1&amp;b=2">x</a>`, want: `<a href="/docs?a=1&amp;b=2">x</a>`},
+		{input: `<a href="mailto:me@example.com">x</a>`, want: `<a href="mailto:me@example.com">x</a>`},
+		{input: `<a href="https://example.com" href="javascript:alert(1)">x</a>`, want: `<a href="https://example.com">x</a>`},
+		{input: `<a title=x"onmouseover=alert(1)>x</a>`, want: `<a title="x&#34;onmouseover=alert(1)">x</a>`},
+		{input: `<img src=x onerror=alert(1)>`, want: `<img src="x">`},
+		{input: `<img src="x" onerror="alert(1)"`, want: ``},
+		{input: `<unknown>text</unknown>`, want: `text`},
+		{input: `<p>unclosed <b>bold <i>italic`, want: `<p>unclosed <b>bold <i>italic</i></b></p>`},
+		{input: `<b><i>x</b>y</i>`, want: `<b><i>x</i></b>y`},
+		{input: `</p>stray end`, want: `stray end`},
+		{input: `1 < 2 & 3 > 2`, want: `1 &lt; 2 &amp; 3 &gt; 2`},
+		{input: `&lt;script&gt;`, want: `&lt;script&gt;`},
+		{input: `<!-- comment -->after`, want: `after`},
+		{input: `<textarea><b>x</b></textarea>after`, want: `after`},
+		{input: `<SCRIPT>alert(1)</SCRIPT >after`, want: `after`},
+		{input: `<br/><hr>`, want: `<br><hr>`},
+		// lowercasing these runes changes their length, the end tag must still be found at its byte offset
+		{input: "<script>" + strings.Repeat("Ⱥ", 20) + "</script><p>ok</p>", want: `<p>ok</p>`},
+		{input: "<script>" + strings.Repeat("İ", 20) + "</SCRIPT><p>ok</p>", want: `<p>ok</p>`},
+		{input: "<style>K</style>" + strings.Repeat("Ⱥ", 3), want: strings.Repeat("Ⱥ", 3)},
+	}
+	for _, tt := range tests {
+		if got := UGC().Sanitize(tt.input); got != tt.want {
+			t.Errorf("UGC().Sanitize(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+	if got := Text().Sanitize(`<p>Hello <a href="https://example.com">world</a></p>`); got != `Hello world` {
+		t.Errorf("Text().Sanitize() = %q, want the text only", got)
+	}
+}
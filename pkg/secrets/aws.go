@@ -0,0 +1,94 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/internal/sigv4"
+)
+
+// AWSProvider reads the secrets of AWS Secrets Manager, secret://prod/smtp is the SecretString of the secret
+// prod/smtp and secret://prod/smtp#password the password key of its json. requests are signed with AWS Signature
+// Version 4.
+type AWSProvider struct {
+	endpoint     string // like https://secretsmanager.eu-central-1.amazonaws.com
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string // of temporary credentials, optional
+	client       *http.Client
+}
+
+// NewAWSProviderFromEnv returns an AWSProvider for region, default env AWS_REGION or us-east-1, using
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, the optional AWS_SESSION_TOKEN and AWS_ENDPOINT_URL_SECRETS_MANAGER.
+func NewAWSProviderFromEnv(region string) (*AWSProvider, error) {
+	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return nil, errors.New("secrets: env AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required for awssm")
+	}
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := strings.TrimRight(os.Getenv("AWS_ENDPOINT_URL_SECRETS_MANAGER"), "/")
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://secretsmanager.%s.amazonaws.com", region)
+	}
+	return &AWSProvider{
+		endpoint:     endpoint,
+		region:       region,
+		accessKey:    accessKey,
+		secretKey:    secretKey,
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		client:       &http.Client{Timeout: requestTimeout},
+	}, nil
+}
+
+func (a *AWSProvider) Get(ctx context.Context, name string) (string, error) {
+	body, _ := json.Marshal(map[string]string{"SecretId": name})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("secrets: error creating awssm request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	a.sign(req, body, time.Now().UTC())
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("secrets: awssm GetSecretValue %s failed: %w", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err := providerError("awssm", resp)
+		if strings.Contains(err.Error(), "ResourceNotFoundException") {
+			return "", fmt.Errorf("%w: no awssm secret %s", ErrNotFound, name)
+		}
+		return "", err
+	}
+	var value struct {
+		SecretString *string `json:"SecretString"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&value); err != nil {
+		return "", fmt.Errorf("secrets: error decoding the awssm secret %s: %w", name, err)
+	}
+	if value.SecretString == nil {
+		return "", fmt.Errorf("secrets: the awssm secret %s is binary, only the string secrets are supported", name)
+	}
+	return *value.SecretString, nil
+}
+
+// sign adds the AWS Signature Version 4 headers to req.
+func (a *AWSProvider) sign(req *http.Request, body []byte, now time.Time) {
+	creds := sigv4.Credentials{AccessKey: a.accessKey, SecretKey: a.secretKey, SessionToken: a.sessionToken}
+	sigv4.Sign(req, creds, a.region, "secretsmanager", "/", "", sigv4.SHA256Hex(body), []string{"content-type", "x-amz-target"}, now)
+}
@@ -0,0 +1,41 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// DefaultEnvPrefix is the prefix of the env variables read by an EnvProvider when env:// gives none.
+const DefaultEnvPrefix = "SECRET_"
+
+// EnvProvider reads the secrets from the env variables starting with its prefix, so that the other variables of
+// the process, like the tokens of the server, cannot be read by the config. with the default prefix
+// secret://SMTP_PASSWORD is the value of env SECRET_SMTP_PASSWORD.
+type EnvProvider struct {
+	prefix string
+}
+
+// NewEnvProvider returns an EnvProvider reading the env variables of prefix, DefaultEnvPrefix when it is empty.
+func NewEnvProvider(prefix string) (EnvProvider, error) {
+	if prefix == "" {
+		prefix = DefaultEnvPrefix
+	}
+	for _, c := range prefix {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return EnvProvider{}, fmt.Errorf("secrets: invalid env prefix %q, only uppercase letters, digits and _ are allowed", prefix)
+		}
+	}
+	return EnvProvider{prefix: prefix}, nil
+}
+
+func (e EnvProvider) Get(ctx context.Context, name string) (string, error) {
+	if e.prefix == "" {
+		return "", fmt.Errorf("secrets: the env provider has no prefix, create it with NewEnvProvider")
+	}
+	value, ok := os.LookupEnv(e.prefix + name)
+	if !ok {
+		return "", fmt.Errorf("%w: env %s is not set", ErrNotFound, e.prefix+name)
+	}
+	return value, nil
+}
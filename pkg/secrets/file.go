@@ -0,0 +1,36 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileProvider reads each secret from the file of its name below a directory, like the docker and kubernetes
+// secrets mounted in /run/secrets, the final newline of the file is removed.
+type FileProvider struct {
+	dir string
+}
+
+// NewFileProvider returns a FileProvider reading the secrets below dir.
+func NewFileProvider(dir string) (*FileProvider, error) {
+	if dir == "" {
+		return nil, errors.New("secrets: file provider needs a directory like file:///run/secrets")
+	}
+	return &FileProvider{dir: dir}, nil
+}
+
+func (f *FileProvider) Get(ctx context.Context, name string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(f.dir, filepath.FromSlash(name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%w: no file %s in %s", ErrNotFound, name, f.dir)
+	}
+	if err != nil {
+		return "", fmt.Errorf("secrets: error reading %s: %w", name, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
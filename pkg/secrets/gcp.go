@@ -0,0 +1,122 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const gcpMetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// GCPProvider reads the latest version of the secrets of a project of GCP Secret Manager, with the access token of
+// env GCP_ACCESS_TOKEN or else of the service account of the metadata server, on Cloud Run, GKE or Compute Engine.
+type GCPProvider struct {
+	endpoint string // like https://secretmanager.googleapis.com
+	project  string
+	token    string // of env GCP_ACCESS_TOKEN, the one of the metadata server is fetched when it is empty
+	client   *http.Client
+	mu       sync.Mutex
+	cached   string // token of the metadata server
+	expires  time.Time
+}
+
+// NewGCPProviderFromEnv returns a GCPProvider for project, default env GOOGLE_CLOUD_PROJECT, using the optional
+// GCP_ACCESS_TOKEN and GCP_SECRET_MANAGER_ENDPOINT.
+func NewGCPProviderFromEnv(project string) (*GCPProvider, error) {
+	if project == "" {
+		project = os.Getenv("GOOGLE_CLOUD_PROJECT")
+	}
+	if project == "" {
+		return nil, errors.New("secrets: gcpsm provider needs a project like gcpsm://my-project or env GOOGLE_CLOUD_PROJECT")
+	}
+	endpoint := strings.TrimRight(os.Getenv("GCP_SECRET_MANAGER_ENDPOINT"), "/")
+	if endpoint == "" {
+		endpoint = "https://secretmanager.googleapis.com"
+	}
+	return &GCPProvider{
+		endpoint: endpoint,
+		project:  project,
+		token:    os.Getenv("GCP_ACCESS_TOKEN"),
+		client:   &http.Client{Timeout: requestTimeout},
+	}, nil
+}
+
+func (g *GCPProvider) Get(ctx context.Context, name string) (string, error) {
+	token, err := g.getToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	u := fmt.Sprintf("%s/v1/projects/%s/secrets/%s/versions/latest:access", g.endpoint, url.PathEscape(g.project), url.PathEscape(name))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", fmt.Errorf("secrets: error creating gcpsm request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("secrets: gcpsm access %s failed: %w", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("%w: no gcpsm secret %s in project %s", ErrNotFound, name, g.project)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", providerError("gcpsm", resp)
+	}
+	var body struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("secrets: error decoding the gcpsm secret %s: %w", name, err)
+	}
+	value, err := base64.StdEncoding.DecodeString(body.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("secrets: error decoding the gcpsm secret %s: %w", name, err)
+	}
+	return string(value), nil
+}
+
+// getToken returns the access token of env GCP_ACCESS_TOKEN, or the one of the metadata server until it expires.
+func (g *GCPProvider) getToken(ctx context.Context) (string, error) {
+	if g.token != "" {
+		return g.token, nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.cached != "" && time.Now().Before(g.expires) {
+		return g.cached, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcpMetadataTokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("secrets: env GCP_ACCESS_TOKEN is not set and the metadata server cannot be reached: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", providerError("gcp metadata server", resp)
+	}
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("secrets: error decoding the token of the metadata server: %w", err)
+	}
+	// renewed a minute before it expires
+	g.cached, g.expires = body.AccessToken, time.Now().Add(time.Duration(body.ExpiresIn-60)*time.Second)
+	return g.cached, nil
+}
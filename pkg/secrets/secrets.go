@@ -0,0 +1,96 @@
+// Package secrets reads the secrets referenced by the config as secret://name from a provider (the env variables,
+// a directory of files, HashiCorp Vault, AWS Secrets Manager or GCP Secret Manager), so that the tokens and passwords
+// are not written in the config.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ErrNotFound is returned by Get when the secret does not exist.
+var ErrNotFound = errors.New("secrets: secret not found")
+
+// Provider returns the value of the secrets by name.
+type Provider interface {
+	// Get returns the value of the secret name or ErrNotFound.
+	Get(ctx context.Context, name string) (string, error)
+}
+
+// New returns the Provider described by rawURL :
+//   - env://PREFIX_                   the env variable of the name prefixed with PREFIX_, default SECRET_
+//   - file:///run/secrets             the content of the file of the name below the directory
+//   - vault://secret/optional/prefix  the KV v2 secrets of the mount using the VAULT_* env variables
+//   - awssm://optional-region         AWS Secrets Manager using the AWS_* env variables
+//   - gcpsm://project                 GCP Secret Manager using env GCP_ACCESS_TOKEN or the metadata server
+func New(rawURL string) (Provider, error) {
+	if strings.TrimSpace(rawURL) == "" {
+		return nil, errors.New("secrets: the url of the provider is empty")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("secrets: invalid url %q: %w", rawURL, err)
+	}
+	switch u.Scheme {
+	case "env":
+		return NewEnvProvider(u.Host)
+	case "file":
+		dir := u.Path
+		if u.Host != "" {
+			// file://./secrets is parsed with "." as host, keep it as a relative path
+			dir = u.Host + u.Path
+		}
+		return NewFileProvider(dir)
+	case "vault":
+		return NewVaultProviderFromEnv(u.Host, strings.Trim(u.Path, "/"))
+	case "awssm":
+		return NewAWSProviderFromEnv(u.Host)
+	case "gcpsm":
+		return NewGCPProviderFromEnv(u.Host)
+	default:
+		return nil, fmt.Errorf("secrets: unsupported scheme %q in %q", u.Scheme, rawURL)
+	}
+}
+
+// Resolve returns the value of the reference name#field of provider: the whole secret without #field,
+// else the field of the json object the secret holds, like smtp#password.
+func Resolve(ctx context.Context, provider Provider, ref string) (string, error) {
+	name, field, hasField := strings.Cut(ref, "#")
+	if err := validateName(name); err != nil {
+		return "", err
+	}
+	value, err := provider.Get(ctx, name)
+	if err != nil || !hasField {
+		return value, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return "", fmt.Errorf("secrets: secret %q is not a json object, it has no field %q", name, field)
+	}
+	v, ok := fields[field]
+	if !ok {
+		return "", fmt.Errorf("%w: secret %q has no field %q", ErrNotFound, name, field)
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	b, _ := json.Marshal(v)
+	return string(b), nil
+}
+
+// validateName rejects the names that could escape the directory of a file provider or the path of a vault prefix.
+func validateName(name string) error {
+	if name == "" || strings.HasPrefix(name, "/") || strings.Contains(name, "\\") {
+		return fmt.Errorf("secrets: invalid name %q", name)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("secrets: invalid name %q", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const requestTimeout = 30 * time.Second
+
+// VaultProvider reads the secrets of a KV version 2 mount of HashiCorp Vault (or OpenBao),
+// secret://smtp#password is the password key of the secret smtp below the prefix. a secret having a single key
+// is its value, the others are a json object of their keys.
+type VaultProvider struct {
+	addr      string // like https://vault.example.com:8200
+	token     string
+	namespace string // of Vault Enterprise, optional
+	mount     string
+	prefix    string
+	client    *http.Client
+}
+
+// NewVaultProviderFromEnv returns a VaultProvider for mount using VAULT_ADDR (default http://127.0.0.1:8200),
+// VAULT_TOKEN and the optional VAULT_NAMESPACE.
+func NewVaultProviderFromEnv(mount, prefix string) (*VaultProvider, error) {
+	if mount == "" {
+		return nil, errors.New("secrets: vault provider needs a mount like vault://secret/prefix")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		return nil, errors.New("secrets: env VAULT_TOKEN is required for vault")
+	}
+	addr := strings.TrimRight(os.Getenv("VAULT_ADDR"), "/")
+	if addr == "" {
+		addr = "http://127.0.0.1:8200"
+	}
+	return &VaultProvider{
+		addr:      addr,
+		token:     token,
+		namespace: os.Getenv("VAULT_NAMESPACE"),
+		mount:     mount,
+		prefix:    prefix,
+		client:    &http.Client{Timeout: requestTimeout},
+	}, nil
+}
+
+func (v *VaultProvider) Get(ctx context.Context, name string) (string, error) {
+	path := name
+	if v.prefix != "" {
+		path = v.prefix + "/" + name
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.addr+"/v1/"+v.mount+"/data/"+path, nil)
+	if err != nil {
+		return "", fmt.Errorf("secrets: error creating vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("secrets: vault GET %s failed: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("%w: no vault secret %s/%s", ErrNotFound, v.mount, path)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", providerError("vault", resp)
+	}
+	var body struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("secrets: error decoding the vault secret %s: %w", path, err)
+	}
+	if len(body.Data.Data) == 1 {
+		for _, value := range body.Data.Data {
+			if s, ok := value.(string); ok {
+				return s, nil
+			}
+		}
+	}
+	b, err := json.Marshal(body.Data.Data)
+	return string(b), err
+}
+
+// providerError returns the error of a response of a provider, its body being a message without the secret.
+func providerError(provider string, resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("secrets: %s returned status %s: %s", provider, resp.Status, strings.TrimSpace(string(msg)))
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+var (
+	a11yImgRegex       = regexp.MustCompile(`(?is)<img\b[^>]*>`)
+	a11yAltRegex       = regexp.MustCompile(`(?is)\salt\s*=`)
+	a11ySrcRegex       = regexp.MustCompile(`(?is)\ssrc\s*=\s*"([^"]*)"`)
+	a11yHeadingRegex   = regexp.MustCompile(`(?i)<h([1-6])\b`)
+	a11yHTMLLangRegex  = regexp.MustCompile(`(?is)<html\b[^>]*\slang\s*=\s*"\s*[^"\s]`)
+	a11yEmptyLinkRegex = regexp.MustCompile(`(?is)<a\b([^>]*)>\s*</a>`)
+	a11yLabelRegex     = regexp.MustCompile(`(?is)\s(aria-label|aria-labelledby|title)\s*=`)
+	a11yAnchorRegex    = regexp.MustCompile(`(?is)\shref\s*=\s*"#([^"]+)"`)
+)
+
+// checkAccessibility runs basic accessibility checks on a rendered html page and returns the problems found :
+// images without alt, missing lang, headings skipping levels, links without text and anchors without target.
+// they do not replace a WCAG audit, but catch the usual mistakes of the templates while they are written.
+func checkAccessibility(page []byte) []string {
+	var problems []string
+	if bytes.Contains(bytes.ToLower(page), []byte("<html")) && !a11yHTMLLangRegex.Match(page) {
+		problems = append(problems, "the <html> element has no lang attribute")
+	}
+	for _, img := range a11yImgRegex.FindAll(page, -1) {
+		if !a11yAltRegex.Match(img) {
+			src := "?"
+			if m := a11ySrcRegex.FindSubmatch(img); m != nil {
+				src = string(m[1])
+			}
+			problems = append(problems, fmt.Sprintf("image %s has no alt attribute, use alt=\"\" for a decorative one", src))
+		}
+	}
+	previous, h1Count := 0, 0
+	for _, m := range a11yHeadingRegex.FindAllSubmatch(page, -1) {
+		level, _ := strconv.Atoi(string(m[1]))
+		if level == 1 {
+			h1Count++
+		}
+		if level > previous+1 {
+			if previous == 0 {
+				problems = append(problems, fmt.Sprintf("the first heading is a h%d instead of a h1", level))
+			} else {
+				problems = append(problems, fmt.Sprintf("heading h%d follows a h%d, skipping a level", level, previous))
+			}
+		}
+		previous = level
+	}
+	if h1Count == 0 && previous == 0 {
+		problems = append(problems, "the page has no heading")
+	} else if h1Count > 1 {
+		problems = append(problems, fmt.Sprintf("the page has %d h1 headings", h1Count))
+	}
+	for _, m := range a11yEmptyLinkRegex.FindAllSubmatch(page, -1) {
+		if !a11yLabelRegex.Match(m[1]) {
+			problems = append(problems, fmt.Sprintf("link <a%s> has no text nor aria-label", m[1]))
+		}
+	}
+	for _, m := range a11yAnchorRegex.FindAllSubmatch(page, -1) {
+		id := string(m[1])
+		if !bytes.Contains(page, []byte(`id="`+id+`"`)) {
+			problems = append(problems, fmt.Sprintf("link to #%s has no element with this id", id))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const adminPathPrefix = "/admin"
+
+// getAdminTokenFromEnv returns the token protecting the admin endpoints from the env variable ADMIN_TOKEN.
+// when it is empty the admin endpoints are simply not registered.
+func getAdminTokenFromEnv() string {
+	return strings.TrimSpace(os.Getenv("ADMIN_TOKEN"))
+}
+
+// getPreviewTokenFromEnv returns the token allowing editors to preview pages from the env variable PREVIEW_TOKEN,
+// falling back on the admin token when it is not set.
+func getPreviewTokenFromEnv() string {
+	if token := strings.TrimSpace(os.Getenv("PREVIEW_TOKEN")); token != "" {
+		return token
+	}
+	return getAdminTokenFromEnv()
+}
+
+// isPreviewRequest checks the request carries the preview token, either in the previewToken query parameter
+// (handy in a browser) or as an admin bearer token.
+func isPreviewRequest(r *http.Request, previewToken string) bool {
+	if previewToken == "" {
+		return false
+	}
+	if token := r.URL.Query().Get("previewToken"); token != "" {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(previewToken)) == 1
+	}
+	return isAdminRequest(r, previewToken) || isAdminRequest(r, getAdminTokenFromEnv())
+}
+
+// isAdminRequest checks the request carries the admin token as "Authorization: Bearer <token>".
+func isAdminRequest(r *http.Request, adminToken string) bool {
+	if adminToken == "" {
+		return false
+	}
+	auth := r.Header.Get("Authorization")
+	token, found := strings.CutPrefix(auth, "Bearer ")
+	if !found {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
+
+// requireAdmin only lets the requests having the admin token reach next.
+func requireAdmin(next http.HandlerFunc, adminToken string, l *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdminRequest(r, adminToken) {
+			l.Printf("💥 unauthorized admin request to %s from %s", r.URL.Path, getClientIP(r))
+			auditLog.RecordRequest(r, "admin.denied", auditFailure, "", "invalid admin token")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeJSONError(w, r, http.StatusUnauthorized, "a valid admin bearer token is required")
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			// the reads are not audited, they would drown the changes
+			auditLog.RecordRequest(r, "admin.request", auditSuccess, "admin", "")
+		}
+		next(w, r)
+	}
+}
+
+// getBandwidthReportHandler returns the bytes served per route and status as json, biggest first.
+func getBandwidthReportHandler(counter *BandwidthCounter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stats := counter.Snapshot()
+		var total int64
+		for _, s := range stats {
+			total += s.Bytes
+		}
+		writeJSON(w, r, http.StatusOK, map[string]interface{}{
+			"totalBytes": total,
+			"routes":     stats,
+		})
+	}
+}
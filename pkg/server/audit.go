@@ -0,0 +1,333 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	siteconfig "github.com/lao-tseu-is-alive/JsonSiteGo/pkg/config"
+)
+
+const (
+	auditPath            = adminPathPrefix + "/audit"
+	defaultAuditViewSize = 200  // events shown by the viewer
+	maxAuditViewSize     = 5000 // limit of ?limit
+	auditSuccess         = "success"
+	auditFailure         = "failure"
+	auditFailureWindow   = time.Minute
+	auditFailureBurst    = 10    // failures of a limited action recorded by client in a window, the next ones are counted
+	maxAuditClients      = 10000 // clients whose failures are counted, the others share one count
+)
+
+// auditLimitedActions are the failures any anonymous client can cause, they are limited by client so that it cannot
+// fill the audit log.
+var auditLimitedActions = []string{"auth.token", "auth.denied", "auth.login", "admin.denied"}
+
+// auditLog records the security events when the audit is enabled, it stays nil otherwise.
+var auditLog *AuditLog
+
+// AuditConfig enables the append-only audit log of the admin actions, the config loads and the auth events.
+type AuditConfig struct {
+	File       string `json:"file"`                 // json lines file, overridden by env AUDIT_LOG
+	ViewerRole string `json:"viewerRole,omitempty"` // users having this role can open the viewer, besides the admin token
+}
+
+// AuditEvent is one line of the audit log.
+type AuditEvent struct {
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"`           // like config.load, admin.request, auth.login or auth.denied
+	Outcome   string    `json:"outcome"`          // success or failure
+	Actor     string    `json:"actor,omitempty"`  // the subject of the user, admin for the admin token
+	IP        string    `json:"ip,omitempty"`     // address of the client
+	Target    string    `json:"target,omitempty"` // the path or resource concerned
+	Detail    string    `json:"detail,omitempty"`
+	RequestID string    `json:"requestID,omitempty"`
+}
+
+// AuditLog appends the events to a json lines file, opened once in append mode so no line is ever rewritten.
+type AuditLog struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	l    *log.Logger
+
+	failuresMu sync.Mutex
+	failures   map[string]*auditFailures // by action and client address
+}
+
+// auditFailures counts the failures of a limited action by a client in the current window.
+type auditFailures struct {
+	windowStart time.Time
+	count       int
+	suppressed  int // not recorded
+}
+
+// validateAudit checks the audit log has a file and that its viewer role can be known.
+func validateAudit(config *SiteConfig) []ConfigError {
+	if config.Audit == nil {
+		return nil
+	}
+	var problems []ConfigError
+	if strings.TrimSpace(config.Audit.File) == "" {
+		problems = append(problems, ConfigError{Pointer: "/audit/file", Value: config.Audit.File, Message: "the audit log needs a file"})
+	}
+	if config.Audit.ViewerRole != "" && config.Auth == nil {
+		problems = append(problems, ConfigError{Pointer: "/audit/viewerRole", Value: config.Audit.ViewerRole, Message: "the viewerRole needs the auth config"})
+	}
+	return problems
+}
+
+// getAuditLogFromEnvOrPanic opens the audit log file of env AUDIT_LOG or of the config, or returns nil when there is none.
+func getAuditLogFromEnvOrPanic(site *SiteConfig, l *log.Logger) *AuditLog {
+	path := ""
+	if site.Audit != nil {
+		path = site.Audit.File
+	}
+	if val, exist := os.LookupEnv("AUDIT_LOG"); exist {
+		path = strings.TrimSpace(val)
+	}
+	if path == "" {
+		return nil
+	}
+	if siteconfig.IsFromStdin() {
+		l.Printf("INFO: the config is read from stdin, the audit log %s is not written", path)
+		return nil
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		panic(fmt.Errorf("💥💥 ERROR: CONFIG ENV AUDIT_LOG or audit file in config cannot be opened. %w", err))
+	}
+	l.Printf("INFO: audit log written to %s", path)
+	return &AuditLog{path: path, file: file, l: l}
+}
+
+// Record appends an event, it does nothing when the audit is disabled. a write error is logged, never returned,
+// so that the audit never breaks a request.
+func (a *AuditLog) Record(event AuditEvent) {
+	if a == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		a.l.Printf("💥 error encoding audit event %s: %v", event.Action, err)
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		a.l.Printf("💥 error writing audit event %s to %s: %v", event.Action, a.path, err)
+	}
+}
+
+// RecordRequest appends an event about a request, with its client address, request id and user. beyond
+// auditFailureBurst failures of a limited action by a client in a minute, the next ones are only counted, and the
+// count is recorded with its next failure once the minute is over.
+func (a *AuditLog) RecordRequest(r *http.Request, action, outcome, actor, detail string) {
+	if a == nil {
+		return
+	}
+	if actor == "" {
+		if user := getUser(r); user != nil {
+			actor = user.Subject
+		}
+	}
+	ip := getClientIP(r)
+	if outcome == auditFailure && slices.Contains(auditLimitedActions, action) {
+		allowed, suppressed := a.countFailure(action, ip, time.Now())
+		if suppressed > 0 {
+			a.Record(AuditEvent{Action: action, Outcome: auditFailure, IP: ip, Detail: fmt.Sprintf("%d more failures of this client were not recorded", suppressed)})
+		}
+		if !allowed {
+			return
+		}
+	}
+	a.Record(AuditEvent{
+		Action:    action,
+		Outcome:   outcome,
+		Actor:     actor,
+		IP:        ip,
+		Target:    r.Method + " " + r.URL.Path,
+		Detail:    detail,
+		RequestID: getRequestID(r),
+	})
+}
+
+// countFailure counts a failure of action by the client at ip, and reports whether it is recorded, with the failures
+// not recorded during the previous window of the client to record first.
+func (a *AuditLog) countFailure(action, ip string, now time.Time) (bool, int) {
+	a.failuresMu.Lock()
+	defer a.failuresMu.Unlock()
+	if a.failures == nil {
+		a.failures = make(map[string]*auditFailures)
+	}
+	key := action + " " + ip
+	f := a.failures[key]
+	if f == nil && len(a.failures) >= maxAuditClients {
+		for k, other := range a.failures {
+			if now.Sub(other.windowStart) < auditFailureWindow {
+				continue
+			}
+			if other.suppressed > 0 {
+				otherAction, otherIP, _ := strings.Cut(k, " ")
+				a.Record(AuditEvent{Action: otherAction, Outcome: auditFailure, IP: otherIP, Detail: fmt.Sprintf("%d more failures of this client were not recorded", other.suppressed)})
+			}
+			delete(a.failures, k)
+		}
+		if len(a.failures) >= maxAuditClients {
+			key = action + " *"
+			f = a.failures[key]
+		}
+	}
+	if f == nil {
+		f = &auditFailures{windowStart: now}
+		a.failures[key] = f
+	}
+	suppressed := 0
+	if now.Sub(f.windowStart) >= auditFailureWindow {
+		suppressed = f.suppressed
+		*f = auditFailures{windowStart: now}
+	}
+	f.count++
+	if f.count <= auditFailureBurst {
+		return true, suppressed
+	}
+	if f.suppressed == 0 {
+		a.l.Printf("⚠️ WARNING: more than %d %s failures from %s in %s, the next ones are not recorded in the audit log", auditFailureBurst, action, ip, auditFailureWindow)
+	}
+	f.suppressed++
+	return false, suppressed
+}
+
+// Read returns the last limit events matching action and actor when they are not empty, the newest first.
+func (a *AuditLog) Read(limit int, action, actor string) ([]AuditEvent, error) {
+	file, err := os.Open(a.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var events []AuditEvent
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue // a truncated line, after a crash, must not hide the others
+		}
+		if (action != "" && !strings.HasPrefix(event.Action, action)) || (actor != "" && event.Actor != actor) {
+			continue
+		}
+		events = append(events, event)
+		if len(events) > limit {
+			events = events[1:]
+		}
+	}
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	return events, scanner.Err()
+}
+
+// auditViewTemplate is the viewer page, standalone so it does not depend on the templates of the site.
+var auditViewTemplate = template.Must(template.New("audit").Funcs(template.FuncMap{
+	"integrity": getComputedIntegrity,
+}).Parse(`<!doctype html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta name="robots" content="noindex">
+    <title>Audit log | {{.Site}}</title>
+    <link rel="stylesheet" href="https://cdn.jsdelivr.net/npm/@picocss/pico@2/css/pico.min.css"{{with integrity "https://cdn.jsdelivr.net/npm/@picocss/pico@2/css/pico.min.css"}} integrity="{{.}}" crossorigin="anonymous"{{end}}>
+</head>
+<body>
+<main class="container-fluid">
+    <h1>Audit log</h1>
+    <form method="get" role="search">
+        <input name="action" placeholder="action, like auth." value="{{.Action}}">
+        <input name="actor" placeholder="actor" value="{{.Actor}}">
+        <input type="submit" value="Filter">
+    </form>
+    <figure class="overflow-auto">
+        <table class="striped">
+            <thead><tr><th>Time</th><th>Action</th><th>Outcome</th><th>Actor</th><th>IP</th><th>Target</th><th>Detail</th></tr></thead>
+            <tbody>
+            {{range .Events}}
+                <tr>
+                    <td><time datetime="{{.Time.Format "2006-01-02T15:04:05Z07:00"}}">{{.Time.Format "2006-01-02 15:04:05"}}</time></td>
+                    <td>{{.Action}}</td>
+                    <td>{{if eq .Outcome "failure"}}<mark>{{.Outcome}}</mark>{{else}}{{.Outcome}}{{end}}</td>
+                    <td>{{.Actor}}</td>
+                    <td>{{.IP}}</td>
+                    <td><code>{{.Target}}</code></td>
+                    <td>{{.Detail}}</td>
+                </tr>
+            {{else}}
+                <tr><td colspan="7">No event.</td></tr>
+            {{end}}
+            </tbody>
+        </table>
+    </figure>
+</main>
+</body>
+</html>
+`))
+
+// getAuditViewHandler shows the last events of the audit log, as json for the api clients, filtered by
+// the action prefix and actor query parameters. it accepts the admin token or a user having the viewerRole.
+func getAuditViewHandler(site *SiteConfig, adminToken string, l *log.Logger) http.HandlerFunc {
+	viewerRole := ""
+	if site.Audit != nil {
+		viewerRole = site.Audit.ViewerRole
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdminRequest(r, adminToken) && (viewerRole == "" || !getUser(r).HasRole(viewerRole)) {
+			l.Printf("💥 unauthorized audit view request from %s", getClientIP(r))
+			auditLog.RecordRequest(r, "admin.denied", auditFailure, "", "invalid admin token or missing viewer role")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeJSONError(w, r, http.StatusUnauthorized, "a valid admin bearer token or the viewer role is required")
+			return
+		}
+		query := r.URL.Query()
+		limit := defaultAuditViewSize
+		if n, err := strconv.Atoi(query.Get("limit")); err == nil && n > 0 {
+			limit = min(n, maxAuditViewSize)
+		}
+		events, err := auditLog.Read(limit, query.Get("action"), query.Get("actor"))
+		if err != nil {
+			l.Printf("💥 error reading audit log: %v", err)
+			writeJSONError(w, r, http.StatusInternalServerError, "error reading the audit log")
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		if wantsJSON(r) {
+			writeJSON(w, r, http.StatusOK, events)
+			return
+		}
+		var buf bytes.Buffer
+		err = auditViewTemplate.Execute(&buf, map[string]interface{}{
+			"Site":   site.Title,
+			"Action": query.Get("action"),
+			"Actor":  query.Get("actor"),
+			"Events": events,
+		})
+		if err != nil {
+			l.Printf("💥 error rendering audit log: %v", err)
+			writeJSONError(w, r, http.StatusInternalServerError, "error rendering the audit log")
+			return
+		}
+		writeResponse(w, r, http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+	}
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAuditFailuresLimitedByClient(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	a := &AuditLog{path: path, file: file, l: log.New(io.Discard, "", 0)}
+	request := func(ip string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/private", nil)
+		r.RemoteAddr = ip + ":1234"
+		return r
+	}
+	for range 3 * auditFailureBurst {
+		a.RecordRequest(request("192.0.2.1"), "auth.token", auditFailure, "", "invalid token")
+	}
+	a.RecordRequest(request("192.0.2.2"), "auth.token", auditFailure, "", "invalid token")
+	for range 2 * auditFailureBurst {
+		a.RecordRequest(request("192.0.2.1"), "auth.login", auditSuccess, "alice", "")
+	}
+	events, err := a.Read(1000, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := map[string]int{}
+	for _, e := range events {
+		count[e.IP+" "+e.Action+" "+e.Outcome]++
+	}
+	if got := count["192.0.2.1 auth.token failure"]; got != auditFailureBurst {
+		t.Errorf("%d failures recorded for the client, want %d", got, auditFailureBurst)
+	}
+	if got := count["192.0.2.2 auth.token failure"]; got != 1 {
+		t.Errorf("%d failures recorded for another client, want 1", got)
+	}
+	if got := count["192.0.2.1 auth.login success"]; got != 2*auditFailureBurst {
+		t.Errorf("%d successes recorded, want all of them", got)
+	}
+
+	// the next window records the count of the failures not recorded before
+	now := time.Now()
+	if allowed, suppressed := a.countFailure("auth.token", "192.0.2.1", now.Add(auditFailureWindow)); !allowed || suppressed != 2*auditFailureBurst {
+		t.Errorf("countFailure() in the next window = %v, %d, want the failure recorded after %d not recorded", allowed, suppressed, 2*auditFailureBurst)
+	}
+}
+
+func TestAuditFailuresClientsBounded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	a := &AuditLog{path: path, file: file, l: log.New(io.Discard, "", 0)}
+	now := time.Now()
+	for i := range maxAuditClients {
+		a.countFailure("auth.denied", "client-"+strconv.Itoa(i), now)
+	}
+	for range auditFailureBurst {
+		if allowed, _ := a.countFailure("auth.denied", "new-client", now); !allowed {
+			t.Fatalf("countFailure() refused a failure within the burst of the shared count")
+		}
+	}
+	if allowed, _ := a.countFailure("auth.denied", "another-new-client", now); allowed {
+		t.Errorf("countFailure() recorded a failure beyond the burst of the clients sharing a count")
+	}
+	if len(a.failures) > maxAuditClients+1 {
+		t.Errorf("%d clients counted, want at most %d", len(a.failures), maxAuditClients+1)
+	}
+	if allowed, _ := a.countFailure("auth.denied", "late-client", now.Add(auditFailureWindow)); !allowed || len(a.failures) > 2 {
+		t.Errorf("countFailure() after the window kept %d clients, want the old ones forgotten", len(a.failures))
+	}
+}
@@ -0,0 +1,602 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/internal/siteerrors"
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/storage"
+)
+
+const (
+	authPathPrefix     = "/auth"
+	sessionCookieName  = "session"
+	stateCookieName    = "auth_state"
+	defaultRolesClaim  = "roles"
+	defaultSessionTTL  = 8 * time.Hour
+	sessionKeySize     = 32
+	sessionKeyTimeout  = 10 * time.Second
+	sessionKeyStoreKey = "sessions/key"   // of the generated session key in the store of env STORAGE_URL
+	loginStateTTL      = 10 * time.Minute // time given to the user to log in at the provider
+	anyRole            = "*"              // requiredRole of the pages open to every authenticated user
+)
+
+var defaultAuthScopes = []string{"openid", "profile", "email"}
+
+type userKey struct{}
+
+// AuthConfig delegates the login to an OpenID Connect provider and validates its bearer tokens,
+// the pages having a requiredRole are only served to the users having this role.
+type AuthConfig struct {
+	Issuer       string   `json:"issuer,omitempty"`       // url of the provider and iss of its tokens, its endpoints are read from /.well-known/openid-configuration
+	ClientID     string   `json:"clientID,omitempty"`     // enables the login pages
+	ClientSecret string   `json:"clientSecret,omitempty"` // of the clientID, best encrypted with the encrypt subcommand, env OIDC_CLIENT_SECRET wins
+	Audience     string   `json:"audience,omitempty"`     // expected aud of the bearer tokens, default is clientID, required without it
+	JWKSURL      string   `json:"jwksURL,omitempty"`      // keys of the bearer tokens, default is the jwks_uri of the provider
+	Scopes       []string `json:"scopes,omitempty"`       // requested at login, default is openid profile email
+	RolesClaim   string   `json:"rolesClaim,omitempty"`   // claim holding the roles, like groups or realm_access.roles, default is roles
+	SessionTTL   string   `json:"sessionTTL,omitempty"`   // lifetime of the login session, a Go duration like 8h
+}
+
+// User is the identity of the authenticated user, available in the templates as .User
+type User struct {
+	Subject string   `json:"sub"`
+	Name    string   `json:"name,omitempty"`
+	Email   string   `json:"email,omitempty"`
+	Roles   []string `json:"roles,omitempty"`
+}
+
+// HasRole reports whether the user has role, any user has the role *.
+func (u *User) HasRole(role string) bool {
+	if u == nil {
+		return false
+	}
+	return role == anyRole || slices.Contains(u.Roles, role)
+}
+
+// validateAuth checks the auth settings and that the pages having a requiredRole can be protected.
+func validateAuth(config *SiteConfig) []ConfigError {
+	var problems []ConfigError
+	if config.Auth == nil {
+		for i, page := range config.Pages {
+			if page.RequiredRole != "" {
+				problems = append(problems, ConfigError{Pointer: fmt.Sprintf("/pages/%d/requiredRole", i), Value: page.RequiredRole, Message: "a page with a requiredRole needs the auth config"})
+			}
+		}
+		return problems
+	}
+	auth := config.Auth
+	// the bearer tokens are always accepted, a token of another client or of another issuer must be refused
+	if auth.Issuer == "" {
+		problems = append(problems, ConfigError{Pointer: "/auth/issuer", Message: "auth needs the issuer, the iss of the bearer tokens"})
+	}
+	if auth.ClientID == "" && auth.Audience == "" {
+		problems = append(problems, ConfigError{Pointer: "/auth/audience", Message: "auth needs the audience of the bearer tokens when it has no clientID"})
+	}
+	for pointer, value := range map[string]string{"/auth/issuer": auth.Issuer, "/auth/jwksURL": auth.JWKSURL} {
+		if u, err := url.Parse(value); value != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+			problems = append(problems, ConfigError{Pointer: pointer, Value: value, Message: "must be an absolute url like https://login.example.com/realms/intranet"})
+		}
+	}
+	if auth.ClientID != "" {
+		if auth.Issuer == "" {
+			problems = append(problems, ConfigError{Pointer: "/auth/clientID", Value: auth.ClientID, Message: "the login needs the issuer of the provider"})
+		}
+		if u, err := url.Parse(config.BaseURL); err != nil || u.Host == "" {
+			problems = append(problems, ConfigError{Pointer: "/baseURL", Value: config.BaseURL, Message: "the login needs an absolute baseURL to build its callback url"})
+		}
+	}
+	if auth.SessionTTL != "" {
+		if _, err := parseServerDuration(auth.SessionTTL); err != nil {
+			problems = append(problems, ConfigError{Pointer: "/auth/sessionTTL", Value: auth.SessionTTL, Message: fmt.Sprintf("invalid duration, use a Go duration like 8h: %v", err)})
+		}
+	}
+	return problems
+}
+
+// oidcProvider are the endpoints of the openid configuration of the issuer.
+type oidcProvider struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// discoverOIDCProvider reads the openid configuration of issuer.
+func discoverOIDCProvider(client *http.Client, issuer string) (oidcProvider, error) {
+	var provider oidcProvider
+	discoveryURL := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	resp, err := client.Get(discoveryURL)
+	if err != nil {
+		return provider, fmt.Errorf("error fetching %s: %w", discoveryURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return provider, fmt.Errorf("error fetching %s: status %d", discoveryURL, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&provider); err != nil {
+		return provider, fmt.Errorf("error decoding %s: %w", discoveryURL, err)
+	}
+	return provider, nil
+}
+
+// Authenticator identifies the users by their bearer token or login session.
+type Authenticator struct {
+	config       *AuthConfig
+	site         *SiteConfig // attributes of the cookies
+	provider     oidcProvider
+	keys         *jwtKeySet
+	audience     string
+	rolesClaim   string
+	clientSecret string
+	sessionKey   []byte
+	sessionTTL   time.Duration
+	baseURL      string
+	redirectURL  string
+	secure       bool // the cookies are only sent over https
+	client       *http.Client
+	l            *log.Logger
+}
+
+// getAuthenticatorFromEnv returns the authenticator of the auth config, or nil when there is none.
+// the secrets come from the env variables OIDC_CLIENT_SECRET, or the clientSecret of the config, SESSION_SECRET and JWT_SECRET.
+func getAuthenticatorFromEnv(site *SiteConfig, l *log.Logger) (*Authenticator, error) {
+	config := site.Auth
+	if config == nil {
+		return nil, nil
+	}
+	auth := &Authenticator{
+		config:       config,
+		site:         site,
+		audience:     config.Audience,
+		rolesClaim:   config.RolesClaim,
+		clientSecret: getEnvOrDefault("OIDC_CLIENT_SECRET", config.ClientSecret),
+		sessionTTL:   defaultSessionTTL,
+		baseURL:      strings.TrimSuffix(site.BaseURL, "/"),
+		client:       &http.Client{Timeout: 10 * time.Second},
+		l:            l,
+	}
+	if auth.audience == "" {
+		auth.audience = config.ClientID
+	}
+	if auth.rolesClaim == "" {
+		auth.rolesClaim = defaultRolesClaim
+	}
+	if config.SessionTTL != "" {
+		auth.sessionTTL, _ = parseServerDuration(config.SessionTTL)
+	}
+	jwksURL := config.JWKSURL
+	// the provider is discovered for the login and for its keys, an issuer of tokens with a jwksURL may have no discovery
+	if config.ClientID != "" || jwksURL == "" {
+		provider, err := discoverOIDCProvider(auth.client, config.Issuer)
+		if err != nil {
+			return nil, fmt.Errorf("auth issuer %s cannot be discovered: %w", config.Issuer, err)
+		}
+		auth.provider = provider
+		if jwksURL == "" {
+			jwksURL = provider.JWKSURI
+		}
+	}
+	auth.keys = newJWTKeySet(jwksURL, []byte(os.Getenv("JWT_SECRET")))
+	if auth.canLogin() {
+		if auth.provider.AuthorizationEndpoint == "" || auth.provider.TokenEndpoint == "" {
+			return nil, fmt.Errorf("auth issuer %s has no authorization or token endpoint", config.Issuer)
+		}
+		auth.redirectURL = auth.baseURL + authPathPrefix + "/callback"
+		auth.secure = strings.HasPrefix(auth.baseURL, "https://")
+		auth.sessionKey = []byte(os.Getenv("SESSION_SECRET"))
+		if len(auth.sessionKey) == 0 {
+			auth.sessionKey = getGeneratedSessionKey()
+			l.Printf("⚠️ WARNING: env SESSION_SECRET is not set, the login sessions are signed with a key generated in the store of env STORAGE_URL, they end when the server restarts with a store in memory")
+		}
+		l.Printf("INFO: login delegated to %s, callback on %s", config.Issuer, auth.redirectURL)
+	}
+	return auth, nil
+}
+
+// generatedSessionKey is the random key signing the sessions without SESSION_SECRET, the same for the life of the
+// process so that applying another config version keeps the users logged in.
+var generatedSessionKey = struct {
+	mu  sync.Mutex
+	key []byte
+}{}
+
+// getGeneratedSessionKey returns the key signing the sessions without SESSION_SECRET, the one of the store once
+// loadGeneratedSessionKey ran.
+func getGeneratedSessionKey() []byte {
+	generatedSessionKey.mu.Lock()
+	defer generatedSessionKey.mu.Unlock()
+	if generatedSessionKey.key == nil {
+		generatedSessionKey.key = make([]byte, sessionKeySize)
+		rand.Read(generatedSessionKey.key)
+	}
+	return generatedSessionKey.key
+}
+
+// loadGeneratedSessionKey takes the key signing the sessions and the cookies without SESSION_SECRET or COOKIE_SECRET
+// from store, where it is created the first time, so that the replicas sharing the store, and the restarts with a
+// store on disk or in s3, keep the users logged in.
+func loadGeneratedSessionKey(store storage.Store) error {
+	if (os.Getenv("SESSION_SECRET") != "" && os.Getenv("COOKIE_SECRET") != "") || storage.IsInMemory(store) {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sessionKeyTimeout)
+	defer cancel()
+	key, err := store.Get(ctx, sessionKeyStoreKey)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && len(key) != sessionKeySize) {
+		key = make([]byte, sessionKeySize)
+		rand.Read(key)
+		if err = store.Put(ctx, sessionKeyStoreKey, key); err == nil {
+			// another replica may have created its key at the same time, the last one written is shared
+			key, err = store.Get(ctx, sessionKeyStoreKey)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	generatedSessionKey.mu.Lock()
+	defer generatedSessionKey.mu.Unlock()
+	generatedSessionKey.key = key
+	return nil
+}
+
+// canLogin reports whether the users can log in through the provider, else only the bearer tokens are accepted.
+func (auth *Authenticator) canLogin() bool {
+	return auth != nil && auth.config.ClientID != ""
+}
+
+// getUserFromClaims returns the identity found in the claims of a verified token.
+func (auth *Authenticator) getUserFromClaims(claims jwtClaims) *User {
+	user := &User{
+		Subject: claims.getString("sub"),
+		Email:   claims.getString("email"),
+		Roles:   claims.getStrings(auth.rolesClaim),
+	}
+	for _, name := range []string{"name", "preferred_username", "email", "sub"} {
+		if user.Name = claims.getString(name); user.Name != "" {
+			break
+		}
+	}
+	return user
+}
+
+// withAuth stores in the request context the user of the bearer token or of the session cookie, if any.
+// an invalid token is logged and the request continues as anonymous, the protected pages then refuse it.
+func withAuth(next http.Handler, auth *Authenticator) http.Handler {
+	if auth == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var user *User
+		// the admin token is also a bearer token, only the ones looking like a jwt are verified
+		if token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found && strings.Count(token, ".") == 2 {
+			claims, err := verifyJWT(auth.keys, token, auth.config.Issuer, auth.audience)
+			if err != nil {
+				auth.l.Printf("💥 rejected bearer token for %s from %s: %v", r.URL.Path, getClientIP(r), err)
+				auditLog.RecordRequest(r, "auth.token", auditFailure, "", err.Error())
+			} else {
+				user = auth.getUserFromClaims(claims)
+			}
+		} else if auth.canLogin() {
+			user = auth.getSessionUser(r)
+		}
+		if user != nil {
+			r = r.WithContext(context.WithValue(r.Context(), userKey{}, user))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// getUser returns the user authenticated by withAuth, or nil.
+func getUser(r *http.Request) *User {
+	user, _ := r.Context().Value(userKey{}).(*User)
+	return user
+}
+
+// requireRole only lets the users having the requiredRole and one of the visibleTo roles of the page reach next.
+// the anonymous browsers are sent to the login when it is available, the other clients get a 401,
+// and the users lacking the role a 403.
+func requireRole(next http.Handler, page *Page, site *SiteConfig, auth *Authenticator, l *log.Logger) http.HandlerFunc {
+	menuPages := getMenuPages(site)
+	menus := getMenus(site)
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := getUser(r)
+		if canSeePage(page, user) {
+			// a protected page must never be stored by a shared cache
+			w.Header().Set("Cache-Control", "no-store")
+			next.ServeHTTP(w, r)
+			return
+		}
+		data := PageData{
+			Site:        site,
+			Page:        &Page{Route: page.Route, Title: "Access Denied"},
+			Theme:       getThemeFromCookie(r),
+			MenuPages:   menuPages,
+			Menus:       menus,
+			User:        user,
+			Request:     getRequestInfo(r, site),
+			CurrentPath: r.URL.Path,
+			Flags:       getFlags(site),
+		}
+		if user == nil {
+			if auth.canLogin() && (r.Method == http.MethodGet || r.Method == http.MethodHead) && !wantsJSON(r) {
+				http.Redirect(w, r, authPathPrefix+"/login?redirect="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+				return
+			}
+			l.Printf("💥 anonymous request to protected %s from %s", r.URL.Path, getClientIP(r))
+			auditLog.RecordRequest(r, "auth.denied", auditFailure, "", "authentication required")
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q", site.Title))
+			renderError(w, r, siteerrors.Unauthorized("you must be authenticated to see this page"), data, l)
+			return
+		}
+		l.Printf("💥 user %s without the role of %s denied from %s", user.Subject, r.URL.Path, getClientIP(r))
+		auditLog.RecordRequest(r, "auth.denied", auditFailure, "", "missing role")
+		renderError(w, r, siteerrors.Forbidden("your account is not allowed to see this page"), data, l)
+	}
+}
+
+// signValue returns the base64 encoded json of v followed by its hmac signature for the cookie name.
+func (auth *Authenticator) signValue(name string, v interface{}) (string, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(raw)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(auth.getValueSignature(name, payload)), nil
+}
+
+// openValue checks the signature of a value made by signValue for the cookie name and decodes it into v.
+func (auth *Authenticator) openValue(name, value string, v interface{}) error {
+	payload, signature, found := strings.Cut(value, ".")
+	if !found {
+		return errInvalidToken
+	}
+	sum, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return errInvalidToken
+	}
+	if !hmac.Equal(auth.getValueSignature(name, payload), sum) {
+		return errInvalidToken
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return errInvalidToken
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// getValueSignature returns the hmac of the payload of the cookie name, the purpose and the name are signed too so
+// that the value of a cookie, like the login state any visitor gets, can't be moved to another one, like the session.
+func (auth *Authenticator) getValueSignature(name, payload string) []byte {
+	mac := hmac.New(sha256.New, auth.sessionKey)
+	mac.Write([]byte("auth:" + name + "=" + payload))
+	return mac.Sum(nil)
+}
+
+// authSession is stored, signed, in the session cookie.
+type authSession struct {
+	User    User      `json:"user"`
+	Expires time.Time `json:"exp"`
+}
+
+// authState is stored, signed, in the state cookie during the login at the provider.
+type authState struct {
+	State    string    `json:"state"`
+	Nonce    string    `json:"nonce"`
+	Verifier string    `json:"verifier"` // pkce code verifier
+	Redirect string    `json:"redirect"`
+	Expires  time.Time `json:"exp"`
+}
+
+// getSessionUser returns the user of a valid session cookie, or nil.
+func (auth *Authenticator) getSessionUser(r *http.Request) *User {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return nil
+	}
+	var session authSession
+	if err := auth.openValue(sessionCookieName, cookie.Value, &session); err != nil || time.Now().After(session.Expires) || session.User.Subject == "" {
+		return nil
+	}
+	return &session.User
+}
+
+// setCookie sets or, with an empty value, removes a cookie of the authenticator, with the SameSite and Secure
+// attributes of the cookies config of the site. the login state cookie stays lax since it comes back with the redirect of the
+// provider, which a strict cookie would not follow.
+func (auth *Authenticator) setCookie(w http.ResponseWriter, r *http.Request, name, value, path string, ttl time.Duration) {
+	cookie := &http.Cookie{Name: name, Value: value, Path: path, HttpOnly: true, Secure: auth.secure || isSecureCookie(auth.site, r), SameSite: getCookieSameSite(auth.site)}
+	if name == stateCookieName && cookie.SameSite == http.SameSiteStrictMode {
+		cookie.SameSite = http.SameSiteLaxMode
+	}
+	if value == "" {
+		cookie.MaxAge = -1
+	} else {
+		cookie.MaxAge = int(ttl.Seconds())
+	}
+	http.SetCookie(w, cookie)
+}
+
+// randomString returns n random bytes encoded in base64 url.
+func randomString(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// appendQuery adds query to endpoint, which may already have a query string.
+func appendQuery(endpoint string, query url.Values) string {
+	if strings.Contains(endpoint, "?") {
+		return endpoint + "&" + query.Encode()
+	}
+	return endpoint + "?" + query.Encode()
+}
+
+// getLoginHandler sends the browser to the provider, with a pkce challenge and a state kept in a signed cookie.
+func (auth *Authenticator) getLoginHandler() http.HandlerFunc {
+	scopes := auth.config.Scopes
+	if len(scopes) == 0 {
+		scopes = defaultAuthScopes
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		state := authState{
+			State:    randomString(16),
+			Nonce:    randomString(16),
+			Verifier: randomString(32),
+			Redirect: getLocalRedirect(r.URL.Query().Get("redirect")),
+			Expires:  time.Now().Add(loginStateTTL),
+		}
+		value, err := auth.signValue(stateCookieName, state)
+		if err != nil {
+			writeJSONError(w, r, http.StatusInternalServerError, "error starting the login")
+			return
+		}
+		auth.setCookie(w, r, stateCookieName, value, authPathPrefix, loginStateTTL)
+		challenge := sha256.Sum256([]byte(state.Verifier))
+		query := url.Values{
+			"response_type":         {"code"},
+			"client_id":             {auth.config.ClientID},
+			"redirect_uri":          {auth.redirectURL},
+			"scope":                 {strings.Join(scopes, " ")},
+			"state":                 {state.State},
+			"nonce":                 {state.Nonce},
+			"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+			"code_challenge_method": {"S256"},
+		}
+		http.Redirect(w, r, appendQuery(auth.provider.AuthorizationEndpoint, query), http.StatusFound)
+	}
+}
+
+// exchangeCode trades the authorization code for the tokens of the user and returns the id token.
+func (auth *Authenticator) exchangeCode(ctx context.Context, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {auth.redirectURL},
+		"client_id":     {auth.config.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, auth.provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if auth.clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(auth.config.ClientID), url.QueryEscape(auth.clientSecret))
+	}
+	resp, err := auth.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error calling the token endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return "", fmt.Errorf("error decoding the token response, status %d: %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || tokens.Error != "" {
+		return "", fmt.Errorf("token endpoint answered %d: %s %s", resp.StatusCode, tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return "", errors.New("the token response has no id_token")
+	}
+	return tokens.IDToken, nil
+}
+
+// getCallbackHandler finishes the login : it checks the state, gets and verifies the id token and opens the session.
+func (auth *Authenticator) getCallbackHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fail := func(status int, message string, err error) {
+			detail := message
+			if err != nil {
+				detail = fmt.Sprintf("%s: %v", message, err)
+			}
+			auth.l.Printf("💥 login failed from %s: %s", getClientIP(r), detail)
+			auditLog.RecordRequest(r, "auth.login", auditFailure, "", detail)
+			writeJSONError(w, r, status, message)
+		}
+		var state authState
+		cookie, err := r.Cookie(stateCookieName)
+		if err != nil {
+			fail(http.StatusBadRequest, "the login has no state, please retry", err)
+			return
+		}
+		auth.setCookie(w, r, stateCookieName, "", authPathPrefix, 0)
+		query := r.URL.Query()
+		if err := auth.openValue(stateCookieName, cookie.Value, &state); err != nil || time.Now().After(state.Expires) || query.Get("state") != state.State {
+			fail(http.StatusBadRequest, "the login state is invalid or expired, please retry", err)
+			return
+		}
+		if providerError := query.Get("error"); providerError != "" {
+			fail(http.StatusUnauthorized, "the provider refused the login: "+providerError, errors.New(query.Get("error_description")))
+			return
+		}
+		idToken, err := auth.exchangeCode(r.Context(), query.Get("code"), state.Verifier)
+		if err != nil {
+			fail(http.StatusBadGateway, "the login could not be completed", err)
+			return
+		}
+		claims, err := verifyJWT(auth.keys, idToken, auth.config.Issuer, auth.config.ClientID)
+		if err == nil && claims.getString("sub") == "" {
+			err = errors.New("the identity token has no subject")
+		}
+		if err != nil || claims.getString("nonce") != state.Nonce {
+			fail(http.StatusUnauthorized, "the identity token is invalid", err)
+			return
+		}
+		session := authSession{User: *auth.getUserFromClaims(claims), Expires: time.Now().Add(auth.sessionTTL)}
+		value, err := auth.signValue(sessionCookieName, session)
+		if err != nil {
+			fail(http.StatusInternalServerError, "error opening the session", err)
+			return
+		}
+		auth.setCookie(w, r, sessionCookieName, value, "/", auth.sessionTTL)
+		auth.l.Printf("✅ user %s (%s) logged in from %s", session.User.Subject, session.User.Name, getClientIP(r))
+		auditLog.RecordRequest(r, "auth.login", auditSuccess, session.User.Subject, session.User.Name)
+		http.Redirect(w, r, state.Redirect, http.StatusFound)
+	}
+}
+
+// getLogoutHandler closes the session, and the one of the provider when it supports the rp initiated logout.
+func (auth *Authenticator) getLogoutHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if getUser(r) != nil {
+			auditLog.RecordRequest(r, "auth.logout", auditSuccess, "", "")
+		}
+		auth.setCookie(w, r, sessionCookieName, "", "/", 0)
+		if auth.provider.EndSessionEndpoint == "" {
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+		query := url.Values{"client_id": {auth.config.ClientID}, "post_logout_redirect_uri": {auth.baseURL + "/"}}
+		http.Redirect(w, r, appendQuery(auth.provider.EndSessionEndpoint, query), http.StatusFound)
+	}
+}
+
+// registerAuthHandlers adds the login, callback and logout pages when the login is available.
+func registerAuthHandlers(mux *http.ServeMux, auth *Authenticator) {
+	if !auth.canLogin() {
+		return
+	}
+	mux.HandleFunc("GET "+authPathPrefix+"/login", auth.getLoginHandler())
+	mux.HandleFunc("GET "+authPathPrefix+"/callback", auth.getCallbackHandler())
+	mux.HandleFunc("GET "+authPathPrefix+"/logout", auth.getLogoutHandler())
+}
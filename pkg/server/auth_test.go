@@ -0,0 +1,63 @@
+package server
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSessionCookieReplay(t *testing.T) {
+	auth := &Authenticator{
+		config:      &AuthConfig{Issuer: testIssuer, ClientID: testAudience},
+		site:        &SiteConfig{BaseURL: "https://example.com/"},
+		provider:    oidcProvider{AuthorizationEndpoint: testIssuer + "/auth"},
+		sessionKey:  []byte("0123456789abcdef0123456789abcdef"),
+		sessionTTL:  time.Hour,
+		redirectURL: "https://example.com/auth/callback",
+		l:           log.New(io.Discard, "", 0),
+	}
+	withCookie := func(name, value string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/private", nil)
+		r.AddCookie(&http.Cookie{Name: name, Value: value})
+		return r
+	}
+
+	// any visitor gets a signed login state, it must not open a session
+	w := httptest.NewRecorder()
+	auth.getLoginHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/login", nil))
+	var state string
+	for _, c := range w.Result().Cookies() {
+		if c.Name == stateCookieName {
+			state = c.Value
+		}
+	}
+	if state == "" {
+		t.Fatalf("the login did not set the %s cookie", stateCookieName)
+	}
+	if user := auth.getSessionUser(withCookie(sessionCookieName, state)); user != nil {
+		t.Errorf("getSessionUser() of the login state replayed as a session = %+v, want nil", user)
+	}
+
+	session, err := auth.signValue(sessionCookieName, authSession{User: User{Subject: "alice"}, Expires: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user := auth.getSessionUser(withCookie(sessionCookieName, session)); user == nil || user.Subject != "alice" {
+		t.Errorf("getSessionUser() of a valid session = %+v, want alice", user)
+	}
+	var opened authState
+	if err := auth.openValue(stateCookieName, session, &opened); err == nil {
+		t.Errorf("openValue() accepted a session as a login state")
+	}
+	anonymous, _ := auth.signValue(sessionCookieName, authSession{Expires: time.Now().Add(time.Hour)})
+	if user := auth.getSessionUser(withCookie(sessionCookieName, anonymous)); user != nil {
+		t.Errorf("getSessionUser() of a session without subject = %+v, want nil", user)
+	}
+	expired, _ := auth.signValue(sessionCookieName, authSession{User: User{Subject: "alice"}, Expires: time.Now().Add(-time.Minute)})
+	if user := auth.getSessionUser(withCookie(sessionCookieName, expired)); user != nil {
+		t.Errorf("getSessionUser() of an expired session = %+v, want nil", user)
+	}
+}
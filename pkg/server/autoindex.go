@@ -0,0 +1,238 @@
+package server
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/internal/siteerrors"
+)
+
+// Autoindex makes a page list a directory tree, its route ends with a {path...} wildcard like GET /files/{path...}:
+// the directories are rendered with the page template and the files are served.
+type Autoindex struct {
+	Dir     string   `json:"dir"`               // directory listed, like files or static/docs
+	Exclude []string `json:"exclude,omitempty"` // patterns of the names or paths hidden and not served, like *.tmp or drafts/*
+}
+
+// AutoindexEntry is a file or a directory of a listing.
+type AutoindexEntry struct {
+	Name     string
+	URL      string
+	IsDir    bool
+	Size     string // like 1.2 MB, empty for the directories
+	Bytes    int64
+	Modified time.Time
+	Icon     string
+}
+
+// AutoindexCrumb is a link of the breadcrumbs of a listing, from the root of the page to the current directory.
+type AutoindexCrumb struct {
+	Name    string
+	URL     string
+	Current bool // the directory listed
+}
+
+// AutoindexColumn is a header of a listing, its link sorts by the column or reverses the order of the sorted one.
+type AutoindexColumn struct {
+	Label  string
+	URL    string
+	Sorted string // the aria-sort value of the sorted column, ascending or descending
+}
+
+// autoindexColumns are the sort keys of the columns of a listing with their label.
+var autoindexColumns = []struct{ Sort, Label string }{{"name", "Name"}, {"size", "Size"}, {"date", "Modified"}}
+
+// AutoindexData is the listing of a directory, rendered by the Autoindex component as the .Data of the page.
+type AutoindexData struct {
+	Path        string // of the directory, relative to the root of the page, like /reports/2025/
+	Breadcrumbs []AutoindexCrumb
+	Columns     []AutoindexColumn
+	Entries     []AutoindexEntry // the directories first
+	Sort        string           // name, size or date
+	Desc        bool
+}
+
+// validateAutoindex checks the route of the autoindex pages ends with a {path...} wildcard, their dir exists and
+// their exclude patterns are valid.
+func validateAutoindex(config *SiteConfig) []ConfigError {
+	var problems []ConfigError
+	for i, page := range config.Pages {
+		if page.Autoindex == nil {
+			continue
+		}
+		pointer := fmt.Sprintf("/pages/%d", i)
+		if parts := strings.Fields(page.Route); len(parts) < 2 || parts[0] != http.MethodGet || !strings.HasSuffix(parts[1], "...}") {
+			problems = append(problems, ConfigError{Pointer: pointer + "/route", Value: page.Route, Message: "the route of an autoindex page must be a GET ending with a wildcard like {path...}"})
+		}
+		if page.DataSource != nil {
+			problems = append(problems, ConfigError{Pointer: pointer + "/dataSource", Message: "an autoindex page cannot have a dataSource, its data is the listing"})
+		}
+		if page.Autoindex.Dir == "" || !config.isDir(page.Autoindex.Dir) {
+			problems = append(problems, ConfigError{Pointer: pointer + "/autoindex/dir", Value: page.Autoindex.Dir, Message: "the dir must be an existing directory"})
+		}
+		for j, pattern := range page.Autoindex.Exclude {
+			if _, err := path.Match(pattern, ""); err != nil {
+				problems = append(problems, ConfigError{Pointer: fmt.Sprintf("%s/autoindex/exclude/%d", pointer, j), Value: pattern, Message: fmt.Sprintf("invalid pattern: %v", err)})
+			}
+		}
+	}
+	return problems
+}
+
+// isExcluded reports whether the entry at rel, a slash separated path like reports/draft.txt, is hidden by the
+// autoindex: the dot files and the ones matching a pattern on their name or their path.
+func (index *Autoindex) isExcluded(rel string) bool {
+	for _, part := range strings.Split(rel, "/") {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	for _, pattern := range index.Exclude {
+		if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+		// a pattern matching a directory hides everything below it
+		for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+			if ok, _ := path.Match(pattern, dir); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getAutoindexData serves the file of the request under the dir of the page, or returns the listing of the
+// directory to render. it returns nil when the response is already written, a file or a redirect adding the
+// slash of a directory.
+func getAutoindexData(w http.ResponseWriter, r *http.Request, site *SiteConfig, index *Autoindex, routePath string, params map[string]string) (*AutoindexData, error) {
+	names := getRouteParamNames(routePath)
+	rel := strings.Trim(path.Clean("/"+params[names[len(names)-1]]), "/")
+	if rel != "" && index.isExcluded(rel) {
+		return nil, siteerrors.NotFound("")
+	}
+	root, err := site.openDir(index.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("error opening the autoindex dir %s: %w", index.Dir, err)
+	}
+	defer root.Close()
+	name := rel
+	if name == "" {
+		name = "."
+	}
+	info, err := root.Stat(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, siteerrors.NotFound("")
+		}
+		return nil, siteerrors.Wrap(siteerrors.KindNotFound, "", err)
+	}
+	if !info.IsDir() {
+		f, err := root.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("error opening %s: %w", name, err)
+		}
+		defer f.Close()
+		setDownloadDisposition(w, r)
+		http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+		return nil, nil
+	}
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		target := url.URL{Path: r.URL.Path + "/", RawQuery: r.URL.RawQuery}
+		http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+		return nil, nil
+	}
+	entries, err := fs.ReadDir(root.FS(), name)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the directory %s: %w", name, err)
+	}
+	query := r.URL.Query()
+	data := &AutoindexData{Path: "/" + rel, Sort: query.Get("sort"), Desc: query.Get("order") == "desc"}
+	if rel != "" {
+		data.Path += "/"
+	}
+	if data.Sort != "size" && data.Sort != "date" {
+		data.Sort = "name"
+	}
+	base := strings.TrimSuffix(r.URL.Path, "/"+rel+"/")
+	if rel == "" {
+		base = strings.TrimSuffix(r.URL.Path, "/")
+	}
+	data.Breadcrumbs = append(data.Breadcrumbs, AutoindexCrumb{Name: "/", URL: base + "/"})
+	crumbURL := base
+	for _, part := range strings.Split(rel, "/") {
+		if part == "" {
+			continue
+		}
+		crumbURL += "/" + url.PathEscape(part)
+		data.Breadcrumbs = append(data.Breadcrumbs, AutoindexCrumb{Name: part, URL: crumbURL + "/"})
+	}
+	data.Breadcrumbs[len(data.Breadcrumbs)-1].Current = true
+	for _, column := range autoindexColumns {
+		header := AutoindexColumn{Label: column.Label, URL: "?sort=" + column.Sort}
+		if column.Sort == data.Sort {
+			header.Sorted = "ascending"
+			if data.Desc {
+				header.Sorted = "descending"
+			} else {
+				header.URL += "&order=desc"
+			}
+		}
+		data.Columns = append(data.Columns, header)
+	}
+	for _, entry := range entries {
+		entryRel := strings.TrimPrefix(rel+"/"+entry.Name(), "/")
+		if index.isExcluded(entryRel) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || (!info.IsDir() && !info.Mode().IsRegular()) {
+			continue
+		}
+		item := AutoindexEntry{Name: entry.Name(), URL: url.PathEscape(entry.Name()), IsDir: info.IsDir(), Modified: info.ModTime(), Icon: "📁"}
+		if item.IsDir {
+			item.URL += "/"
+		} else {
+			item.Bytes = info.Size()
+			item.Size = formatFileSize(info.Size())
+			item.Icon = downloadIconDefault
+			if icon, found := downloadIcons[strings.ToLower(path.Ext(entry.Name()))]; found {
+				item.Icon = icon
+			}
+		}
+		data.Entries = append(data.Entries, item)
+	}
+	slices.SortFunc(data.Entries, func(a, b AutoindexEntry) int {
+		if a.IsDir != b.IsDir {
+			if a.IsDir {
+				return -1
+			}
+			return 1
+		}
+		var order int
+		switch data.Sort {
+		case "size":
+			order = cmp.Compare(a.Bytes, b.Bytes)
+		case "date":
+			order = a.Modified.Compare(b.Modified)
+		}
+		if order == 0 {
+			order = compareCells(a.Name, b.Name)
+		}
+		if data.Desc {
+			return -order
+		}
+		return order
+	})
+	return data, nil
+}
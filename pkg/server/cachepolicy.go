@@ -0,0 +1,258 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/storage"
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/version"
+)
+
+const (
+	// maxOutputCacheEntries limits the renderings kept by page, the routes with parameters having one by url.
+	maxOutputCacheEntries = 1000
+	// outputCacheKeyPrefix is the prefix of the renderings in a shared store, below the generation of the site.
+	outputCacheKeyPrefix    = "cache/output/"
+	outputCachePurgeTimeout = time.Minute
+)
+
+// CachePolicy sets the Cache-Control and Vary headers of a page, and whether its renderings are kept in memory.
+type CachePolicy struct {
+	MaxAge      string   `json:"maxAge,omitempty"`      // duration like 10m, sent as max-age
+	Private     bool     `json:"private,omitempty"`     // only the browser may store the page, not the shared caches
+	NoStore     bool     `json:"noStore,omitempty"`     // no cache may store the page
+	Vary        []string `json:"vary,omitempty"`        // request headers changing the page, like Accept-Language
+	OutputCache bool     `json:"outputCache,omitempty"` // serve the rendering of the anonymous requests from memory for maxAge
+}
+
+// validateCachePolicies checks the durations of the pages and that their policy is consistent.
+func validateCachePolicies(config *SiteConfig) []ConfigError {
+	var problems []ConfigError
+	for i, page := range config.Pages {
+		policy := page.Cache
+		if policy == nil {
+			continue
+		}
+		pointer := fmt.Sprintf("/pages/%d/cache", i)
+		if policy.MaxAge != "" {
+			if _, err := parseServerDuration(policy.MaxAge); err != nil {
+				problems = append(problems, ConfigError{Pointer: pointer + "/maxAge", Value: policy.MaxAge, Message: fmt.Sprintf("invalid duration: %v", err)})
+			}
+		}
+		if policy.NoStore && (policy.MaxAge != "" || policy.OutputCache) {
+			problems = append(problems, ConfigError{Pointer: pointer + "/noStore", Value: true, Message: "noStore cannot be used with maxAge or outputCache"})
+		}
+		if policy.OutputCache && policy.MaxAge == "" {
+			problems = append(problems, ConfigError{Pointer: pointer + "/outputCache", Value: true, Message: "outputCache needs a maxAge, the time the renderings are kept"})
+		}
+		for j, header := range policy.Vary {
+			if header == "" || strings.ContainsAny(header, " ,:") {
+				problems = append(problems, ConfigError{Pointer: fmt.Sprintf("%s/vary/%d", pointer, j), Value: header, Message: "not a header name"})
+			}
+		}
+	}
+	return problems
+}
+
+// getCacheControl returns the Cache-Control header of the policy, or an empty string when it sets none.
+func getCacheControl(policy *CachePolicy) string {
+	if policy == nil {
+		return ""
+	}
+	if policy.NoStore {
+		return "no-store"
+	}
+	var directives []string
+	if policy.Private {
+		directives = append(directives, "private")
+	} else if policy.MaxAge != "" {
+		directives = append(directives, "public")
+	}
+	if maxAge, err := parseServerDuration(policy.MaxAge); err == nil {
+		directives = append(directives, fmt.Sprintf("max-age=%d", int(maxAge.Seconds())))
+	}
+	return strings.Join(directives, ", ")
+}
+
+// setCachePolicyHeaders sets the Cache-Control and Vary headers of the policy.
+func setCachePolicyHeaders(w http.ResponseWriter, policy *CachePolicy) {
+	if cacheControl := getCacheControl(policy); cacheControl != "" {
+		w.Header().Set("Cache-Control", cacheControl)
+	}
+	if policy != nil && len(policy.Vary) > 0 {
+		w.Header().Add("Vary", strings.Join(policy.Vary, ", "))
+	}
+}
+
+// outputCacheEntry is a rendering of a page.
+type outputCacheEntry struct {
+	ContentType        string    `json:"contentType"`
+	ContentDisposition string    `json:"contentDisposition,omitempty"` // set on the pdf renderings
+	Body               []byte    `json:"body"`
+	Expires            time.Time `json:"expires"`
+}
+
+// outputCache keeps the renderings of one page by url, theme and vary headers, it lives as long as the site.
+// with a store shared by the replicas, the renderings are kept in it and entries only holds the expiry of the
+// ones written by this process, to bound them.
+type outputCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	vary    []string
+	entries map[string]outputCacheEntry
+	store   storage.Store // nil when the store of the server is in memory
+	route   string        // of the page, its renderings are kept in store under a hash of the route and of the key
+}
+
+// newOutputCacheStore returns the store of the renderings of the site of config, below a generation changing with
+// the config, the version and the pages published at now, so that the replicas serving another config never share
+// them. it is nil when store is in memory, the renderings are then kept by the output caches themselves.
+func newOutputCacheStore(config *SiteConfig, store storage.Store, now time.Time) storage.Store {
+	if store == nil || storage.IsInMemory(store) {
+		return nil
+	}
+	h := sha256.New()
+	h.Write(config.raw)
+	h.Write([]byte("\n" + version.VERSION + "\n"))
+	for i := range config.Pages {
+		if isPublished(&config.Pages[i], now) {
+			h.Write([]byte(strconv.Itoa(i) + ","))
+		}
+	}
+	return storage.NewPrefixStore(store, outputCacheKeyPrefix+hex.EncodeToString(h.Sum(nil))[:configVersionHashSize])
+}
+
+// purgeOutputCache removes the renderings of all the generations from store, the templates or the data of the site
+// served may have changed.
+func purgeOutputCache(store storage.Store, l *log.Logger) {
+	if store == nil || storage.IsInMemory(store) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), outputCachePurgeTimeout)
+	defer cancel()
+	keys, err := store.List(ctx, outputCacheKeyPrefix)
+	if err != nil {
+		l.Printf("💥 warning: could not purge the output cache: %v", err)
+		return
+	}
+	for _, key := range keys {
+		if err := store.Delete(ctx, key); err != nil {
+			l.Printf("💥 warning: could not purge the output cache: %v", err)
+			return
+		}
+	}
+}
+
+// newOutputCache returns the output cache of the page, or nil when the page does not use it. the renderings are
+// kept in store when it is not nil.
+func newOutputCache(page *Page, store storage.Store) *outputCache {
+	policy := page.Cache
+	if policy == nil || !policy.OutputCache {
+		return nil
+	}
+	ttl, err := parseServerDuration(policy.MaxAge)
+	if err != nil {
+		return nil
+	}
+	return &outputCache{ttl: ttl, vary: policy.Vary, entries: make(map[string]outputCacheEntry), store: store, route: page.Route}
+}
+
+// getStoreKey returns the key of the rendering stored under key in the store.
+func (c *outputCache) getStoreKey(key string) string {
+	sum := sha256.Sum256([]byte(c.route + "\n" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// getKey returns the key of the rendering of r, or an empty string when r must not use the cache : the requests
+// other than GET and HEAD, of the authenticated users, showing flash messages or previewing a theme.
+func (c *outputCache) getKey(r *http.Request, previewTheme string) string {
+	if c == nil || (r.Method != http.MethodGet && r.Method != http.MethodHead) || getUser(r) != nil || previewTheme != "" {
+		return ""
+	}
+	if _, err := r.Cookie(flashCookieName); err == nil {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString(r.URL.RequestURI())
+	sb.WriteString("\n")
+	sb.WriteString(getThemeFromCookie(r))
+	for _, header := range c.vary {
+		sb.WriteString("\n")
+		sb.WriteString(r.Header.Get(header))
+	}
+	return sb.String()
+}
+
+// get returns the rendering stored under key when it has not expired.
+func (c *outputCache) get(ctx context.Context, key string) (outputCacheEntry, bool) {
+	if c.store != nil {
+		data, err := c.store.Get(ctx, c.getStoreKey(key))
+		if err != nil {
+			return outputCacheEntry{}, false
+		}
+		var entry outputCacheEntry
+		if err := json.Unmarshal(data, &entry); err != nil || time.Now().After(entry.Expires) {
+			return outputCacheEntry{}, false
+		}
+		return entry, true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.Expires) {
+		return outputCacheEntry{}, false
+	}
+	return entry, true
+}
+
+// put stores a rendering under key, the expired ones are removed when the cache is full, and nothing is stored
+// when it is still full.
+func (c *outputCache) put(ctx context.Context, key string, entry outputCacheEntry) error {
+	now := time.Now()
+	entry.Expires = now.Add(c.ttl)
+	c.mu.Lock()
+	var expired []string
+	if len(c.entries) >= maxOutputCacheEntries {
+		for k, e := range c.entries {
+			if now.After(e.Expires) {
+				delete(c.entries, k)
+				expired = append(expired, k)
+			}
+		}
+	}
+	full := len(c.entries) >= maxOutputCacheEntries
+	if !full {
+		if c.store == nil {
+			c.entries[key] = entry
+		} else {
+			// the rendering is in the store, only its expiry is remembered
+			c.entries[key] = outputCacheEntry{Expires: entry.Expires}
+		}
+	}
+	c.mu.Unlock()
+	if c.store == nil {
+		return nil
+	}
+	for _, k := range expired {
+		if err := c.store.Delete(ctx, c.getStoreKey(k)); err != nil {
+			return err
+		}
+	}
+	if full {
+		return nil
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return c.store.Put(ctx, c.getStoreKey(key), data)
+}
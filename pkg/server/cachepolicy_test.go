@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/storage"
+)
+
+func TestOutputCacheSharedStore(t *testing.T) {
+	disk, err := storage.NewDiskStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	page := &Page{Route: "GET /products", Cache: &CachePolicy{MaxAge: "10m", OutputCache: true}}
+	config := &SiteConfig{Pages: []Page{*page}, raw: []byte(`{"pages": []}`)}
+	now := time.Now()
+	if newOutputCacheStore(config, storage.NewMemoryStore(), now) != nil {
+		t.Errorf("newOutputCacheStore() of a memory store is not nil, the renderings would be kept twice in memory")
+	}
+	// the caches of the same page on two replicas
+	first := newOutputCache(page, newOutputCacheStore(config, disk, now))
+	second := newOutputCache(page, newOutputCacheStore(config, disk, now))
+	if err := first.put(ctx, "/products", outputCacheEntry{ContentType: "text/html", Body: []byte("<h1>Products</h1>")}); err != nil {
+		t.Fatal(err)
+	}
+	entry, found := second.get(ctx, "/products")
+	if !found || string(entry.Body) != "<h1>Products</h1>" || entry.ContentType != "text/html" {
+		t.Fatalf("get() on another replica = %+v, %v, want the rendering put by the first one", entry, found)
+	}
+	if _, found := second.get(ctx, "/products?page=2"); found {
+		t.Errorf("get() found a rendering of another url")
+	}
+	other := newOutputCache(page, newOutputCacheStore(&SiteConfig{Pages: config.Pages, raw: []byte(`{"pages": [], "title": "new"}`)}, disk, now))
+	if _, found := other.get(ctx, "/products"); found {
+		t.Errorf("get() found the rendering of another config")
+	}
+	purgeOutputCache(disk, log.New(io.Discard, "", 0))
+	if _, found := second.get(ctx, "/products"); found {
+		t.Errorf("get() found a rendering after the purge")
+	}
+}
+
+func TestOutputCacheExpiry(t *testing.T) {
+	page := &Page{Route: "GET /", Cache: &CachePolicy{MaxAge: "1ns", OutputCache: true}}
+	ctx := context.Background()
+	for _, cache := range []*outputCache{newOutputCache(page, nil), newOutputCache(page, storage.NewMemoryStore())} {
+		if err := cache.put(ctx, "/", outputCacheEntry{ContentType: "text/html", Body: []byte("home")}); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+		if _, found := cache.get(ctx, "/"); found {
+			t.Errorf("get() returned an expired rendering")
+		}
+	}
+}
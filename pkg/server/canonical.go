@@ -0,0 +1,94 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// CanonicalRedirectConfig redirects the requests whose host or scheme differs from the baseURL,
+// like www.example.com to example.com or http to https, so search engines index a single copy of the site.
+type CanonicalRedirectConfig struct {
+	Enabled bool     `json:"enabled"`
+	Hosts   []string `json:"hosts,omitempty"` // the hosts to redirect, like www.example.com, default is every other host except ip addresses and localhost
+}
+
+// canonicalExemptPrefixes are never redirected : the probes and the certificate challenges must reach any host.
+var canonicalExemptPrefixes = []string{healthPath, "/.well-known/acme-challenge/"}
+
+// validateCanonicalRedirect checks the baseURL is absolute when the canonical redirect is enabled.
+func validateCanonicalRedirect(config *SiteConfig) []ConfigError {
+	if config.CanonicalRedirect == nil || !config.CanonicalRedirect.Enabled {
+		return nil
+	}
+	u, err := url.Parse(config.BaseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return []ConfigError{{Pointer: "/baseURL", Value: config.BaseURL, Message: "the canonical redirect needs an absolute baseURL like https://example.com/"}}
+	}
+	return nil
+}
+
+// isLocalHost reports whether host is an ip address or localhost, these are used by the probes and in development.
+func isLocalHost(host string) bool {
+	if _, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil {
+		return true
+	}
+	return host == "localhost" || strings.HasSuffix(host, ".localhost")
+}
+
+// withCanonicalRedirect answers with a permanent redirect to the same path on the baseURL host and scheme
+// when the request uses another one. GET and HEAD get a 301, the other methods a 308 keeping the method and body.
+func withCanonicalRedirect(next http.Handler, site *SiteConfig, l *log.Logger) http.Handler {
+	config := site.CanonicalRedirect
+	base, err := url.Parse(site.BaseURL)
+	if config == nil || !config.Enabled || err != nil || base.Host == "" {
+		return next
+	}
+	hosts := make([]string, len(config.Hosts))
+	for i, host := range config.Hosts {
+		hosts[i] = strings.ToLower(host)
+	}
+	l.Printf("INFO: canonical redirect to %s://%s", base.Scheme, base.Host)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, prefix := range canonicalExemptPrefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		host := strings.ToLower(r.Host)
+		hostname := host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			hostname = h
+		}
+		redirectHost := false
+		if host != strings.ToLower(base.Host) {
+			if len(hosts) > 0 {
+				redirectHost = slices.Contains(hosts, host) || slices.Contains(hosts, hostname)
+			} else {
+				redirectHost = !isLocalHost(hostname)
+			}
+		}
+		// only upgrade to https, a site served in http keeps the scheme of the request
+		redirectScheme := base.Scheme == "https" && getRequestScheme(r) != "https" && !isLocalHost(hostname)
+		if !redirectHost && !redirectScheme {
+			next.ServeHTTP(w, r)
+			return
+		}
+		targetHost := r.Host
+		if redirectHost {
+			targetHost = base.Host
+		}
+		target := fmt.Sprintf("%s://%s%s", base.Scheme, targetHost, r.URL.RequestURI())
+		code := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			code = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, target, code)
+	})
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	cdnProviderFastly     = "fastly"
+	cdnProviderCloudflare = "cloudflare"
+	cdnPurgeTimeout       = 15 * time.Second
+	cdnSiteKey            = "site" // surrogate key shared by every page, purging it invalidates the whole site
+)
+
+// surrogateKeyReplacer turns a route path like /docs/{slug} into a key friendly value like docs-slug
+var surrogateKeyReplacer = strings.NewReplacer("/", "-", "{", "", "}", "", "...", "", "$", "")
+
+// CDNConfig holds the optional settings used when the site is served behind a CDN.
+type CDNConfig struct {
+	Provider     string `json:"provider"`     // "fastly" or "cloudflare"
+	ServiceID    string `json:"serviceId"`    // Fastly service id or Cloudflare zone id
+	PurgeOnStart bool   `json:"purgeOnStart"` // purge all the site keys when the server starts, they are always purged when the config is loaded again
+}
+
+// getPageKey returns a stable identifier of a page derived from its route path, like page-docs-slug.
+func getPageKey(page *Page) string {
+	path := strings.Trim(splitRoutePath(page.Route), "/")
+	if path == "" {
+		return "page-root"
+	}
+	return "page-" + surrogateKeyReplacer.Replace(path)
+}
+
+// getDataSourceKey returns the surrogate key of the pages of the data source at url, like data-1f2e3d4c5b6a7980.
+func getDataSourceKey(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return "data-" + hex.EncodeToString(sum[:8])
+}
+
+// getSurrogateKeys returns the cache keys of a page derived from its route, its data source and its tags.
+func getSurrogateKeys(page *Page) []string {
+	keys := []string{cdnSiteKey, getPageKey(page)}
+	if page.DataSource != nil {
+		keys = append(keys, getDataSourceKey(page.DataSource.URL))
+	}
+	for _, tag := range page.Tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" {
+			keys = append(keys, "tag-"+strings.ReplaceAll(tag, " ", "-"))
+		}
+	}
+	return keys
+}
+
+// splitRoutePath returns the path part of a route like "GET /page".
+func splitRoutePath(route string) string {
+	parts := strings.Fields(route)
+	if len(parts) > 1 {
+		return parts[1]
+	}
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return ""
+}
+
+// setSurrogateKeyHeaders emits both the Fastly (Surrogate-Key) and Cloudflare (Cache-Tag) headers.
+func setSurrogateKeyHeaders(w http.ResponseWriter, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	w.Header().Set("Surrogate-Key", strings.Join(keys, " "))
+	w.Header().Set("Cache-Tag", strings.Join(keys, ","))
+}
+
+// purgeCDN asks the configured CDN provider to invalidate the given keys.
+// the api token is read from the env variable CDN_PURGE_TOKEN so that it never lives in config.json
+func purgeCDN(cfg *CDNConfig, keys []string, l *log.Logger) error {
+	if cfg == nil || len(keys) == 0 {
+		return nil
+	}
+	token, exist := os.LookupEnv("CDN_PURGE_TOKEN")
+	if !exist || token == "" {
+		return fmt.Errorf("env CDN_PURGE_TOKEN is required to purge the %s cache", cfg.Provider)
+	}
+	var url string
+	var body []byte
+	var err error
+	switch cfg.Provider {
+	case cdnProviderFastly:
+		url = fmt.Sprintf("https://api.fastly.com/service/%s/purge", cfg.ServiceID)
+		body, err = json.Marshal(map[string][]string{"surrogate_keys": keys})
+	case cdnProviderCloudflare:
+		url = fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/purge_cache", cfg.ServiceID)
+		body, err = json.Marshal(map[string][]string{"tags": keys})
+	default:
+		return fmt.Errorf("unsupported cdn provider '%s'", cfg.Provider)
+	}
+	if err != nil {
+		return fmt.Errorf("error encoding cdn purge request: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating cdn purge request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cfg.Provider == cdnProviderFastly {
+		req.Header.Set("Fastly-Key", token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	client := http.Client{Timeout: cdnPurgeTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling %s purge api: %w", cfg.Provider, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s purge api returned status %s", cfg.Provider, resp.Status)
+	}
+	l.Printf("✅ purged %d keys from %s cache", len(keys), cfg.Provider)
+	return nil
+}
+
+// getAllSurrogateKeys returns the unique keys of all the pages that have a handler.
+func getAllSurrogateKeys(config *SiteConfig) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for i := range config.Pages {
+		page := &config.Pages[i]
+		if !page.CreateHandler || page.Draft {
+			continue
+		}
+		for _, k := range getSurrogateKeys(page) {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	return keys
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestGetSurrogateKeys(t *testing.T) {
+	products := &DataSource{URL: "https://api.example.com/products.json", Key: "slug"}
+	list := &Page{Route: "GET /products", DataSource: &DataSource{URL: products.URL}, Tags: []string{"shop", " "}}
+	detail := &Page{Route: "GET /products/{slug}", DataSource: products, Tags: []string{"spring sale"}}
+	about := &Page{Route: "GET /about"}
+
+	dataKey := getDataSourceKey(products.URL)
+	if got := getSurrogateKeys(list); !slices.Equal(got, []string{cdnSiteKey, "page-products", dataKey, "tag-shop"}) {
+		t.Errorf("getSurrogateKeys() of the list = %v", got)
+	}
+	if got := getSurrogateKeys(detail); !slices.Equal(got, []string{cdnSiteKey, "page-products-slug", dataKey, "tag-spring-sale"}) {
+		t.Errorf("getSurrogateKeys() of the detail = %v", got)
+	}
+	if got := getSurrogateKeys(about); !slices.Equal(got, []string{cdnSiteKey, "page-about"}) {
+		t.Errorf("getSurrogateKeys() of a page without data = %v", got)
+	}
+	if other := getDataSourceKey("https://api.example.com/events.json"); other == dataKey || len(other) != len("data-")+16 {
+		t.Errorf("getDataSourceKey() = %s for another url, %s for the products", other, dataKey)
+	}
+}
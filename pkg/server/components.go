@@ -0,0 +1,421 @@
+package server
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// TableColumn is one column of a Table component, Key selects the value in keyed rows.
+type TableColumn struct {
+	Key   string
+	Label string
+}
+
+// TableData is the normalized content of a Table component, whatever the source of its rows.
+type TableData struct {
+	Caption  string
+	Columns  []TableColumn
+	Rows     [][]string
+	Sortable bool // allow the visitor to sort by clicking a column header
+}
+
+// toCellString converts a json value to the text displayed in a table cell.
+func toCellString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// getTableColumns reads the "columns" key, accepting a list of names or of {"key","label"} objects.
+func getTableColumns(kv map[string]interface{}) []TableColumn {
+	raw, _ := kv["columns"].([]interface{})
+	columns := make([]TableColumn, 0, len(raw))
+	for _, c := range raw {
+		switch col := c.(type) {
+		case string:
+			columns = append(columns, TableColumn{Key: col, Label: col})
+		case map[string]interface{}:
+			key := toCellString(col["key"])
+			label := toCellString(col["label"])
+			if label == "" {
+				label = key
+			}
+			columns = append(columns, TableColumn{Key: key, Label: label})
+		}
+	}
+	return columns
+}
+
+// readCSVRows reads a csv file, the first record gives the column names.
+func readCSVRows(site *SiteConfig, path string) ([]string, [][]string, error) {
+	f, err := site.openFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening table csv %s: %w", path, err)
+	}
+	defer f.Close()
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading table csv %s: %w", path, err)
+	}
+	if len(records) == 0 {
+		return nil, nil, nil
+	}
+	return records[0], records[1:], nil
+}
+
+// getTableData builds the TableData of a Table component from its KeyValues :
+// inline "rows" (lists or objects), a "csv" file or a "dataSource" returning a json array,
+// with optional "columns", "caption", "sortBy", "sortDesc" and "sortable" settings.
+func getTableData(kv map[string]interface{}, site *SiteConfig) (*TableData, error) {
+	table := &TableData{
+		Caption:  toCellString(kv["caption"]),
+		Columns:  getTableColumns(kv),
+		Sortable: kv["sortable"] == true,
+	}
+	var records []interface{}
+	switch {
+	case kv["csv"] != nil:
+		header, rows, err := readCSVRows(site, toCellString(kv["csv"]))
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			record := make(map[string]interface{}, len(header))
+			for i, name := range header {
+				if i < len(row) {
+					record[name] = row[i]
+				}
+			}
+			records = append(records, record)
+		}
+		if len(table.Columns) == 0 {
+			for _, name := range header {
+				table.Columns = append(table.Columns, TableColumn{Key: name, Label: name})
+			}
+		}
+	case kv["dataSource"] != nil:
+		// the template functions are called without the request
+		data, err := loadDataSource(context.Background(), site, &DataSource{URL: toCellString(kv["dataSource"])}, nil)
+		if err != nil {
+			return nil, err
+		}
+		list, ok := data.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("table dataSource %v should contain a json array", kv["dataSource"])
+		}
+		records = list
+	default:
+		records, _ = kv["rows"].([]interface{})
+	}
+
+	// keyed rows without explicit columns use the sorted keys of the first row
+	if len(table.Columns) == 0 && len(records) > 0 {
+		if first, ok := records[0].(map[string]interface{}); ok {
+			keys := make([]string, 0, len(first))
+			for k := range first {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				table.Columns = append(table.Columns, TableColumn{Key: k, Label: k})
+			}
+		}
+	}
+
+	for _, record := range records {
+		var row []string
+		switch r := record.(type) {
+		case map[string]interface{}:
+			for _, col := range table.Columns {
+				row = append(row, toCellString(r[col.Key]))
+			}
+		case []interface{}:
+			for _, v := range r {
+				row = append(row, toCellString(v))
+			}
+		default:
+			row = []string{toCellString(r)}
+		}
+		table.Rows = append(table.Rows, row)
+	}
+
+	if sortBy := toCellString(kv["sortBy"]); sortBy != "" {
+		index := -1
+		for i, col := range table.Columns {
+			if col.Key == sortBy {
+				index = i
+			}
+		}
+		if index < 0 {
+			return nil, fmt.Errorf("table sortBy '%s' is not one of the columns", sortBy)
+		}
+		desc := kv["sortDesc"] == true
+		sort.SliceStable(table.Rows, func(i, j int) bool {
+			cmp := compareCells(cellAt(table.Rows[i], index), cellAt(table.Rows[j], index))
+			if desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		})
+	}
+	return table, nil
+}
+
+func cellAt(row []string, i int) string {
+	if i < len(row) {
+		return row[i]
+	}
+	return ""
+}
+
+// compareCells compares numerically when both cells are numbers, else alphabetically ignoring case.
+func compareCells(a, b string) int {
+	fa, errA := strconv.ParseFloat(strings.TrimSpace(a), 64)
+	fb, errB := strconv.ParseFloat(strings.TrimSpace(b), 64)
+	if errA == nil && errB == nil {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		default:
+			return 0
+		}
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+// GalleryImage is one picture of a Gallery component.
+type GalleryImage struct {
+	Src     string
+	Srcset  string
+	Alt     string
+	Caption string
+}
+
+// GalleryData is the normalized content of a Gallery component.
+type GalleryData struct {
+	Layout string // "grid" (default) or "carousel"
+	Sizes  string // the sizes attribute going with the srcset of the images
+	Images []GalleryImage
+}
+
+// galleryVariantRegex matches the resized variants of a picture named like photo-480w.jpg
+var galleryVariantRegex = regexp.MustCompile(`^(.+)-(\d+)w(\.[A-Za-z0-9]+)$`)
+
+// getGalleryData builds the GalleryData of a Gallery component from its KeyValues : an explicit "images" list
+// of {"src","alt","caption","srcset"} objects or a "glob" relative to the static directory (like "gallery/*.jpg").
+// with a glob, the variants named like photo-480w.jpg next to photo.jpg are used to build the srcset.
+func getGalleryData(kv map[string]interface{}, staticDir string) (*GalleryData, error) {
+	gallery := &GalleryData{
+		Layout: toCellString(kv["layout"]),
+		Sizes:  toCellString(kv["sizes"]),
+	}
+	if gallery.Layout != "carousel" {
+		gallery.Layout = "grid"
+	}
+	if gallery.Sizes == "" {
+		if gallery.Layout == "carousel" {
+			gallery.Sizes = "100vw"
+		} else {
+			gallery.Sizes = "(min-width: 768px) 33vw, 100vw"
+		}
+	}
+	if pattern := toCellString(kv["glob"]); pattern != "" {
+		if strings.Contains(pattern, "..") {
+			return nil, fmt.Errorf("gallery glob '%s' should stay inside the static directory", pattern)
+		}
+		files, err := filepath.Glob(filepath.Join(staticDir, filepath.FromSlash(pattern)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gallery glob '%s': %w", pattern, err)
+		}
+		variants := make(map[string][]string)
+		var originals []string
+		for _, file := range files {
+			rel, err := filepath.Rel(staticDir, file)
+			if err != nil {
+				return nil, err
+			}
+			url := staticURLPrefix + filepath.ToSlash(rel)
+			if m := galleryVariantRegex.FindStringSubmatch(url); m != nil {
+				original := m[1] + m[3]
+				variants[original] = append(variants[original], fmt.Sprintf("%s %sw", url, m[2]))
+				continue
+			}
+			originals = append(originals, url)
+		}
+		for _, src := range originals {
+			name := strings.TrimSuffix(path.Base(src), path.Ext(src))
+			gallery.Images = append(gallery.Images, GalleryImage{
+				Src:    src,
+				Srcset: strings.Join(variants[src], ", "),
+				Alt:    strings.ReplaceAll(strings.ReplaceAll(name, "-", " "), "_", " "),
+			})
+		}
+		return gallery, nil
+	}
+	images, _ := kv["images"].([]interface{})
+	for _, img := range images {
+		switch i := img.(type) {
+		case string:
+			gallery.Images = append(gallery.Images, GalleryImage{Src: i})
+		case map[string]interface{}:
+			gallery.Images = append(gallery.Images, GalleryImage{
+				Src:     toCellString(i["src"]),
+				Srcset:  toCellString(i["srcset"]),
+				Alt:     toCellString(i["alt"]),
+				Caption: toCellString(i["caption"]),
+			})
+		}
+	}
+	return gallery, nil
+}
+
+// mapCounter gives a unique html id to every Map component rendered by the server.
+var mapCounter atomic.Int64
+
+// MapMarker is one point displayed on a Map component.
+type MapMarker struct {
+	Lat   float64 `json:"lat"`
+	Lng   float64 `json:"lng"`
+	Popup string  `json:"popup,omitempty"`
+}
+
+// MapData is the normalized content of a Map component.
+type MapData struct {
+	ID      string
+	Center  [2]float64
+	Zoom    int
+	Height  string
+	Markers []MapMarker
+	GeoJSON interface{} // inline object or loaded from a file or url by the server, so the browser needs no CORS
+}
+
+// getMapData builds the MapData of a Map component from its KeyValues : "center" [lat, lng], "zoom",
+// "height", a "markers" list of {"lat","lng","popup"} and "geojson" as an inline object or a file path or url.
+func getMapData(kv map[string]interface{}, site *SiteConfig) (*MapData, error) {
+	m := &MapData{
+		ID:     fmt.Sprintf("map-%d", mapCounter.Add(1)),
+		Center: [2]float64{46.5197, 6.6323}, // Lausanne, where this project was born
+		Zoom:   13,
+		Height: toCellString(kv["height"]),
+	}
+	if m.Height == "" {
+		m.Height = "400px"
+	}
+	if center, ok := kv["center"].([]interface{}); ok && len(center) == 2 {
+		lat, errLat := toFloat(center[0])
+		lng, errLng := toFloat(center[1])
+		if errLat != nil || errLng != nil {
+			return nil, fmt.Errorf("map center should be [lat, lng], got %v", center)
+		}
+		m.Center = [2]float64{lat, lng}
+	}
+	if zoom, err := toFloat(kv["zoom"]); err == nil {
+		m.Zoom = int(zoom)
+	}
+	markers, _ := kv["markers"].([]interface{})
+	for _, raw := range markers {
+		marker, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		lat, errLat := toFloat(marker["lat"])
+		lng, errLng := toFloat(marker["lng"])
+		if errLat != nil || errLng != nil {
+			return nil, fmt.Errorf("map marker should have a numeric lat and lng, got %v", marker)
+		}
+		m.Markers = append(m.Markers, MapMarker{Lat: lat, Lng: lng, Popup: toCellString(marker["popup"])})
+	}
+	switch geo := kv["geojson"].(type) {
+	case map[string]interface{}:
+		m.GeoJSON = geo
+	case string:
+		data, err := loadDataSource(context.Background(), site, &DataSource{URL: geo}, nil)
+		if err != nil {
+			return nil, err
+		}
+		m.GeoJSON = data
+	}
+	return m, nil
+}
+
+const (
+	embedPrivacyClickToLoad = "click-to-load" // nothing is loaded from the provider before the visitor clicks (default)
+	embedPrivacyNoCookie    = "no-cookie"     // the iframe is loaded at once, using the privacy enhanced provider urls
+	embedPrivacyOff         = "off"           // the standard provider urls
+)
+
+var (
+	youtubeIDRegex  = regexp.MustCompile(`(?:youtube\.com/(?:watch\?(?:.*&)?v=|embed/|shorts/)|youtu\.be/)([A-Za-z0-9_-]{11})`)
+	vimeoIDRegex    = regexp.MustCompile(`vimeo\.com/(?:video/)?(\d+)`)
+	peertubeIDRegex = regexp.MustCompile(`^(https://[^/]+)/(?:w|videos/watch|videos/embed)/([A-Za-z0-9-]+)`)
+)
+
+// EmbedData is the normalized content of an Embed component.
+type EmbedData struct {
+	Provider    string // youtube, vimeo or peertube
+	Title       string
+	EmbedURL    string
+	ClickToLoad bool
+}
+
+// getEmbedData builds the EmbedData of an Embed component from the "url" and "title" in its KeyValues.
+// the privacy mode comes from the site config and can be overridden by the "privacy" key of the block.
+func getEmbedData(kv map[string]interface{}, sitePrivacy string) (*EmbedData, error) {
+	rawURL := strings.TrimSpace(toCellString(kv["url"]))
+	privacy := toCellString(kv["privacy"])
+	if privacy == "" {
+		privacy = sitePrivacy
+	}
+	if privacy == "" {
+		privacy = embedPrivacyClickToLoad
+	}
+	embed := &EmbedData{
+		Title:       toCellString(kv["title"]),
+		ClickToLoad: privacy == embedPrivacyClickToLoad,
+	}
+	private := privacy != embedPrivacyOff
+	if m := youtubeIDRegex.FindStringSubmatch(rawURL); m != nil {
+		embed.Provider = "youtube"
+		if private {
+			embed.EmbedURL = "https://www.youtube-nocookie.com/embed/" + m[1]
+		} else {
+			embed.EmbedURL = "https://www.youtube.com/embed/" + m[1]
+		}
+	} else if m := vimeoIDRegex.FindStringSubmatch(rawURL); m != nil {
+		embed.Provider = "vimeo"
+		embed.EmbedURL = "https://player.vimeo.com/video/" + m[1]
+		if private {
+			embed.EmbedURL += "?dnt=1"
+		}
+	} else if m := peertubeIDRegex.FindStringSubmatch(rawURL); m != nil {
+		// PeerTube instances do not track, the same url is used in every mode
+		embed.Provider = "peertube"
+		embed.EmbedURL = m[1] + "/videos/embed/" + m[2]
+	} else {
+		return nil, fmt.Errorf("embed url '%s' is not a supported YouTube, Vimeo or PeerTube video", rawURL)
+	}
+	if embed.Title == "" {
+		embed.Title = "Video " + embed.Provider
+	}
+	return embed, nil
+}
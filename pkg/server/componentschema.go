@@ -0,0 +1,155 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+
+	siteconfig "github.com/lao-tseu-is-alive/JsonSiteGo/pkg/config"
+)
+
+// componentSchemaSuffix is appended to the component type to find its schema, like AccordionCard.schema.json
+const componentSchemaSuffix = ".schema.json"
+
+// validateContentBlocks checks the KeyValues of every ContentBlock, and of every shortcode in the page content,
+// against the json schema shipped with its component in templates/components, the components without a schema are not checked.
+func validateContentBlocks(config *SiteConfig) ([]ConfigError, error) {
+	schemas := make(map[string]*gojsonschema.Schema)
+	dir := config.getTemplatesDir()
+	var problems []ConfigError
+	// validateBlock checks the block and, for a container like Tabs, each of its child blocks
+	var validateBlock func(block ContentBlock, prefix, what string) ([]ConfigError, error)
+	validateBlock = func(block ContentBlock, prefix, what string) ([]ConfigError, error) {
+		// a block referencing a snippet is replaced by its blocks, checked with the snippets
+		if block.Snippet == "" && !isComponent(dir, block.Type) {
+			return []ConfigError{{Pointer: strings.TrimSuffix(prefix, "/keyValues") + "/type", Value: block.Type, Message: fmt.Sprintf("%s: unknown component, no file %s.gohtml in templates/components", what, block.Type)}}, nil
+		}
+		schema, ok := schemas[block.Type]
+		if !ok {
+			var err error
+			schema, err = loadComponentSchema(dir, block.Type)
+			if err != nil {
+				return nil, err
+			}
+			schemas[block.Type] = schema
+		}
+		var errs []ConfigError
+		if schema != nil {
+			keyValues := block.KeyValues
+			if keyValues == nil {
+				keyValues = map[string]interface{}{}
+			}
+			result, err := schema.Validate(gojsonschema.NewGoLoader(keyValues))
+			if err != nil {
+				return nil, fmt.Errorf("error validating %s: %w", what, err)
+			}
+			errs = siteconfig.SchemaErrors(result, prefix)
+			for i := range errs {
+				errs[i].Message = fmt.Sprintf("%s: %s", what, errs[i].Message)
+			}
+		}
+		children, err := getChildBlocks(block)
+		if err != nil {
+			return append(errs, ConfigError{Pointer: prefix, Message: fmt.Sprintf("%s: %v", what, err)}), nil
+		}
+		for _, child := range children {
+			childErrs, err := validateBlock(child.Block, prefix+child.Pointer, fmt.Sprintf("%s block in %s", child.Block.Type, what))
+			if err != nil {
+				return nil, err
+			}
+			errs = append(errs, childErrs...)
+		}
+		return errs, nil
+	}
+	for p, page := range config.Pages {
+		for i, block := range page.CustomContent {
+			prefix := fmt.Sprintf("/pages/%d/custom_content/%d/keyValues", p, i)
+			errs, err := validateBlock(block, prefix, fmt.Sprintf("%s block of page '%s'", block.Type, page.Route))
+			if err != nil {
+				return nil, err
+			}
+			problems = append(problems, errs...)
+		}
+		for _, variant := range getVariantBlocks(&page, p) {
+			for i, block := range variant.Blocks {
+				errs, err := validateBlock(block, fmt.Sprintf("%s/%d/keyValues", variant.Pointer, i), fmt.Sprintf("%s block of a variant of page '%s'", block.Type, page.Route))
+				if err != nil {
+					return nil, err
+				}
+				problems = append(problems, errs...)
+			}
+		}
+		// shortcode errors point to the content itself, json pointers cannot address a part of a string
+		contentPointer := fmt.Sprintf("/pages/%d/content", p)
+		parts, err := parseShortcodes(page.Content)
+		if err != nil {
+			problems = append(problems, ConfigError{Pointer: contentPointer, Message: fmt.Sprintf("content of page '%s': %v", page.Route, err)})
+			continue
+		}
+		for _, part := range parts {
+			if part.Block == nil {
+				continue
+			}
+			what := fmt.Sprintf("%s shortcode of page '%s'", part.Block.Type, page.Route)
+			if !isComponent(dir, part.Block.Type) {
+				problems = append(problems, ConfigError{Pointer: contentPointer, Message: fmt.Sprintf("%s: unknown component", what)})
+				continue
+			}
+			errs, err := validateBlock(*part.Block, "", what)
+			if err != nil {
+				return nil, err
+			}
+			for _, ce := range errs {
+				if ce.Pointer != "" {
+					ce.Message = fmt.Sprintf("%s (parameter %s)", ce.Message, strings.TrimPrefix(ce.Pointer, "/"))
+				}
+				ce.Pointer = contentPointer
+				problems = append(problems, ce)
+			}
+		}
+	}
+	for _, name := range getSnippetNames(config) {
+		for i, block := range config.Snippets[name] {
+			prefix := fmt.Sprintf("/snippets/%s/%d/keyValues", strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1"), i)
+			errs, err := validateBlock(block, prefix, fmt.Sprintf("%s block of snippet '%s'", block.Type, name))
+			if err != nil {
+				return nil, err
+			}
+			problems = append(problems, errs...)
+		}
+	}
+	return problems, nil
+}
+
+// isComponent reports whether name is a component of the templates of dir, defined by components/<name>.gohtml.
+func isComponent(dir, name string) bool {
+	if name == "" || strings.ContainsAny(name, `/\.`) {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(dir, "components", name+".gohtml"))
+	return err == nil
+}
+
+// loadComponentSchema returns the compiled schema of a component type of the templates of dir, or nil when it has none.
+func loadComponentSchema(dir, componentType string) (*gojsonschema.Schema, error) {
+	if componentType == "" || strings.ContainsAny(componentType, `/\.`) {
+		return nil, nil
+	}
+	schemaPath := filepath.Join(dir, "components", componentType+componentSchemaSuffix)
+	if _, err := os.Stat(schemaPath); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	absSchemaPath, err := filepath.Abs(schemaPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not get absolute path for component schema: %w", err)
+	}
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewReferenceLoader("file://" + absSchemaPath))
+	if err != nil {
+		return nil, fmt.Errorf("error loading component schema %s: %w", schemaPath, err)
+	}
+	return schema, nil
+}
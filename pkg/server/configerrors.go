@@ -0,0 +1,76 @@
+package server
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+
+	siteconfig "github.com/lao-tseu-is-alive/JsonSiteGo/pkg/config"
+)
+
+// ConfigError is one problem found in the configuration file, the checks of the server return them with the
+// json pointer of the offending value.
+type ConfigError = siteconfig.Error
+
+// ConfigValidationError lists all the problems found in a configuration file.
+type ConfigValidationError = siteconfig.ValidationError
+
+// configSource is one file of a layered configuration, the base config or an overlay.
+type configSource = siteconfig.Source
+
+var configErrorsTemplate = template.Must(template.New("config_errors").Funcs(template.FuncMap{
+	"formatValue": siteconfig.FormatValue,
+	"integrity":   getComputedIntegrity,
+}).Parse(`<!doctype html>
+<html lang="en" data-theme="dark">
+<head>
+    <meta charset="UTF-8">
+    <title>Configuration errors</title>
+    <link rel="stylesheet" href="https://cdn.jsdelivr.net/npm/@picocss/pico@2/css/pico.min.css"{{with integrity "https://cdn.jsdelivr.net/npm/@picocss/pico@2/css/pico.min.css"}} integrity="{{.}}" crossorigin="anonymous"{{end}}>
+</head>
+<body>
+<main class="container">
+    <h1>💥 {{len .Errors}} errors in {{.Path}}</h1>
+    <p>The server is running in dev mode and will not serve the site until the configuration is fixed and the server restarted.</p>
+    <table>
+        <thead><tr><th>Position</th><th>JSON pointer</th><th>Problem</th><th>Value</th></tr></thead>
+        <tbody>
+        {{range .Errors}}
+            <tr>
+                <td>{{if .Line}}{{.File}}:{{.Line}}:{{.Column}}{{end}}</td>
+                <td><code>{{.DisplayPointer}}</code></td>
+                <td>{{.Message}}</td>
+                <td>{{if .Value}}<code>{{formatValue .Value}}</code>{{end}}</td>
+            </tr>
+        {{end}}
+        </tbody>
+    </table>
+</main>
+</body>
+</html>`))
+
+// serveConfigErrors answers every request with the html report of the configuration errors,
+// it is used in dev mode instead of exiting so the problems can be read in the browser.
+func serveConfigErrors(listenAddress string, cfgErr *ConfigValidationError, l *log.Logger) error {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wantsJSON(r) {
+			writeJSONError(w, r, http.StatusInternalServerError, cfgErr.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		if err := configErrorsTemplate.Execute(w, cfgErr); err != nil {
+			l.Printf("error rendering configuration errors page: %v", err)
+		}
+	})
+	l.Printf("💥 dev mode: serving the configuration errors on http://localhost%s", listenAddress)
+	server := http.Server{
+		Addr:         listenAddress,
+		Handler:      withRequestID(handler),
+		ErrorLog:     l,
+		ReadTimeout:  defaultReadTimeout,
+		WriteTimeout: defaultWriteTimeout,
+		IdleTimeout:  defaultIdleTimeout,
+	}
+	return server.ListenAndServe()
+}
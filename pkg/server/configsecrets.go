@@ -0,0 +1,67 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	siteconfig "github.com/lao-tseu-is-alive/JsonSiteGo/pkg/config"
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/version"
+)
+
+// runEncrypt is the encrypt subcommand : it prints the value read from stdin encrypted with env CONFIG_SECRET_KEY,
+// to paste in the config instead of the secret, or a new random key with -generate-key.
+// it returns the exit code of the process.
+func runEncrypt(args []string) int {
+	fs := flag.NewFlagSet(version.APP+" "+siteconfig.EncryptCommand, flag.ContinueOnError)
+	generateKey := fs.Bool("generate-key", false, "print a new random key for env CONFIG_SECRET_KEY")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: echo -n secret | CONFIG_SECRET_KEY=... %s %s\n", version.APP, siteconfig.EncryptCommand)
+		fs.PrintDefaults()
+	}
+	if _, err := parseFlagsToEnv(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() > 0 {
+		// a secret given as an argument would stay in the shell history
+		fs.Usage()
+		return 2
+	}
+	if *generateKey {
+		key := make([]byte, siteconfig.SecretKeySize)
+		if _, err := rand.Read(key); err != nil {
+			fmt.Fprintf(os.Stderr, "💥💥 error generating the key: %v\n", err)
+			return 1
+		}
+		fmt.Println(base64.StdEncoding.EncodeToString(key))
+		return 0
+	}
+	key, err := siteconfig.SecretKey()
+	if err == nil && key == nil {
+		err = siteconfig.ErrNoSecretKey
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "💥💥 %v\n", err)
+		return 2
+	}
+	plaintext, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "💥💥 error reading the secret from stdin: %v\n", err)
+		return 1
+	}
+	value, err := siteconfig.EncryptSecret(key, strings.TrimRight(string(plaintext), "\r\n"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "💥💥 error encrypting the secret: %v\n", err)
+		return 1
+	}
+	fmt.Println(value)
+	return 0
+}
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/storage"
+)
+
+const (
+	configPath              = "/api/v1/config"
+	configVersionsPath      = configPath + "/versions"
+	configReloadPath        = configPath + "/reload"
+	configVersionsKeyPrefix = "config/versions/" // storage keys of the snapshots, one json file per version
+	configVersionTimeFormat = "20060102T150405Z"
+	configVersionHashSize   = 12 // hex digits of the sha256 of the content kept in the id
+	maxConfigVersions       = 50 // the older versions are deleted
+)
+
+// configVersionIDRegex matches the ids of the versions, the time of the snapshot followed by the start of its hash.
+var configVersionIDRegex = regexp.MustCompile(`^(\d{8}T\d{6}Z)-([0-9a-f]{12})$`)
+
+// ConfigVersion describes a snapshot of the config in the history.
+type ConfigVersion struct {
+	ID      string    `json:"id"`
+	Time    time.Time `json:"time"`
+	Hash    string    `json:"hash"` // start of the sha256 of the content
+	Size    int       `json:"size"`
+	Current bool      `json:"current"` // the version currently served
+}
+
+// getConfigVersionID returns the id of the snapshot of data taken at t.
+func getConfigVersionID(data []byte, t time.Time) string {
+	sum := sha256.Sum256(data)
+	return t.UTC().Format(configVersionTimeFormat) + "-" + hex.EncodeToString(sum[:])[:configVersionHashSize]
+}
+
+// listConfigVersionIDs returns the ids of the versions in the store, the oldest first.
+func listConfigVersionIDs(ctx context.Context, store storage.Store) ([]string, error) {
+	keys, err := store.List(ctx, configVersionsKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(keys))
+	for _, key := range keys {
+		id := strings.TrimSuffix(strings.TrimPrefix(key, configVersionsKeyPrefix), ".json")
+		if configVersionIDRegex.MatchString(id) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+// saveConfigVersion keeps a snapshot of the config data in the history and returns its id. nothing is saved when
+// data is the same as the latest version, whose id is returned, and only the last maxConfigVersions are kept.
+func saveConfigVersion(store storage.Store, data []byte, t time.Time) (string, error) {
+	ctx := context.Background()
+	ids, err := listConfigVersionIDs(ctx, store)
+	if err != nil {
+		return "", fmt.Errorf("error listing config versions: %w", err)
+	}
+	id := getConfigVersionID(data, t)
+	if len(ids) > 0 && strings.HasSuffix(ids[len(ids)-1], id[len(id)-configVersionHashSize:]) {
+		return ids[len(ids)-1], nil
+	}
+	if err := store.Put(ctx, configVersionsKeyPrefix+id+".json", data); err != nil {
+		return "", fmt.Errorf("error saving config version %s: %w", id, err)
+	}
+	ids = append(ids, id)
+	for len(ids) > maxConfigVersions {
+		if err := store.Delete(ctx, configVersionsKeyPrefix+ids[0]+".json"); err != nil {
+			return id, fmt.Errorf("error deleting config version %s: %w", ids[0], err)
+		}
+		ids = ids[1:]
+	}
+	return id, nil
+}
+
+// getConfigVersion returns the content of the version id, or storage.ErrNotFound.
+func getConfigVersion(ctx context.Context, store storage.Store, id string) ([]byte, error) {
+	if !configVersionIDRegex.MatchString(id) {
+		return nil, storage.ErrNotFound
+	}
+	return store.Get(ctx, configVersionsKeyPrefix+id+".json")
+}
+
+// getConfigVersionsHandler lists the versions of the config in the history, the newest first.
+func getConfigVersionsHandler(store storage.Store, l *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ids, err := listConfigVersionIDs(r.Context(), store)
+		if err != nil {
+			l.Printf("💥 error listing config versions: %v", err)
+			writeJSONError(w, r, http.StatusInternalServerError, "error listing the config versions")
+			return
+		}
+		current := getLiveSite().Version
+		versions := make([]ConfigVersion, 0, len(ids))
+		for _, id := range slices.Backward(ids) {
+			data, err := getConfigVersion(r.Context(), store, id)
+			if err != nil {
+				l.Printf("💥 error reading config version %s: %v", id, err)
+				continue
+			}
+			match := configVersionIDRegex.FindStringSubmatch(id)
+			t, _ := time.Parse(configVersionTimeFormat, match[1])
+			versions = append(versions, ConfigVersion{ID: id, Time: t, Hash: match[2], Size: len(data), Current: id == current})
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, r, http.StatusOK, versions)
+	}
+}
+
+// getConfigVersionHandler returns the config json of the version {id}.
+func getConfigVersionHandler(store storage.Store, l *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		data, err := getConfigVersion(r.Context(), store, id)
+		if errors.Is(err, storage.ErrNotFound) {
+			writeJSONError(w, r, http.StatusNotFound, fmt.Sprintf("config version '%s' not found", id))
+			return
+		}
+		if err != nil {
+			l.Printf("💥 error reading config version %s: %v", id, err)
+			writeJSONError(w, r, http.StatusInternalServerError, "error reading the config version")
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		writeResponse(w, r, http.StatusOK, "application/json", data)
+	}
+}
+
+// getConfigRollbackHandler validates the version {id} like a config file and, when it is valid, serves it instead
+// of the current config. the config file itself is not changed, so a restart serves it again.
+func getConfigRollbackHandler(loader *siteLoader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		data, err := getConfigVersion(r.Context(), loader.store, id)
+		if errors.Is(err, storage.ErrNotFound) {
+			writeJSONError(w, r, http.StatusNotFound, fmt.Sprintf("config version '%s' not found", id))
+			return
+		}
+		if err != nil {
+			loader.l.Printf("💥 error reading config version %s: %v", id, err)
+			writeJSONError(w, r, http.StatusInternalServerError, "error reading the config version")
+			return
+		}
+		loader.l.Printf("INFO: rolling back to config version %s", id)
+		loader.mu.Lock()
+		defer loader.mu.Unlock()
+		config, err := parseConfig([]configSource{{Path: "config version " + id, Data: data}}, data, loader.schemaURL, loader.l)
+		var site *Site
+		if err == nil {
+			site, err = loader.build(config)
+		}
+		if err != nil {
+			loader.l.Printf("💥 error rolling back to config version %s: %v", id, err)
+			auditLog.RecordRequest(r, "config.rollback", auditFailure, "admin", id+": "+err.Error())
+			writeJSONError(w, r, http.StatusUnprocessableEntity, fmt.Sprintf("config version '%s' cannot be applied: %s", id, getConfigErrorMessage(err)))
+			return
+		}
+		site.Version = id
+		loader.apply(site)
+		loader.l.Printf("✅ Config version %s applied with %d pages", id, len(config.Pages))
+		auditLog.RecordRequest(r, "config.rollback", auditSuccess, "admin", fmt.Sprintf("%s with %d pages", id, len(config.Pages)))
+		writeJSON(w, r, http.StatusOK, getCurrentConfigVersion(site))
+	}
+}
+
+// getConfigReloadHandler loads the config file again, after pulling the git checkout of the content.
+func getConfigReloadHandler(loader *siteLoader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		site, err := loader.reload(r.Context(), true)
+		if err != nil {
+			loader.l.Printf("💥 error reloading config %s: %v", loader.configURL, err)
+			auditLog.RecordRequest(r, "config.reload", auditFailure, "admin", err.Error())
+			writeJSONError(w, r, http.StatusUnprocessableEntity, "the config cannot be reloaded: "+getConfigErrorMessage(err))
+			return
+		}
+		auditLog.RecordRequest(r, "config.reload", auditSuccess, "admin", fmt.Sprintf("%s with %d pages", site.Version, len(site.Config.Pages)))
+		writeJSON(w, r, http.StatusOK, getCurrentConfigVersion(site))
+	}
+}
+
+// getCurrentConfigVersion describes the version served by site.
+func getCurrentConfigVersion(site *Site) ConfigVersion {
+	version := ConfigVersion{ID: site.Version, Size: len(site.Config.raw), Current: true}
+	if match := configVersionIDRegex.FindStringSubmatch(site.Version); match != nil {
+		version.Time, _ = time.Parse(configVersionTimeFormat, match[1])
+		version.Hash = match[2]
+	}
+	return version
+}
+
+// getConfigErrorMessage returns the problems of a config validation error on one line, or the error itself.
+func getConfigErrorMessage(err error) string {
+	var cfgErr *ConfigValidationError
+	if !errors.As(err, &cfgErr) {
+		return err.Error()
+	}
+	problems := make([]string, 0, len(cfgErr.Errors))
+	for _, ce := range cfgErr.Errors {
+		problems = append(problems, cfgErr.FormatError(ce))
+	}
+	return strings.Join(problems, "; ")
+}
+
+// registerConfigVersionsHandlers adds the config history and reload endpoints, all behind the admin token.
+func registerConfigVersionsHandlers(mux *http.ServeMux, loader *siteLoader, adminToken string) {
+	l := loader.l
+	mux.HandleFunc("GET "+configVersionsPath, requireAdmin(getConfigVersionsHandler(loader.store, l), adminToken, l))
+	mux.HandleFunc("GET "+configVersionsPath+"/{id}", requireAdmin(getConfigVersionHandler(loader.store, l), adminToken, l))
+	mux.HandleFunc("POST "+configVersionsPath+"/{id}/rollback", requireAdmin(getConfigRollbackHandler(loader), adminToken, l))
+	mux.HandleFunc("POST "+configReloadPath, requireAdmin(getConfigReloadHandler(loader), adminToken, l))
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"net"
+	"net/netip"
+	"sync"
+)
+
+// limitListener caps the open connections of a listener : Accept waits while maxConns are open, leaving the next
+// clients in the backlog of the kernel, and the connections beyond maxPerIP from the same address are closed at
+// once, so that a slow client opening many connections can't take them all. the trusted proxies, which carry the
+// connections of many clients, are only counted in maxConns.
+type limitListener struct {
+	net.Listener
+	slots    chan struct{} // one token by open connection, nil without maxConns
+	maxPerIP int
+	trusted  []netip.Prefix
+	mu       sync.Mutex
+	perIP    map[netip.Addr]int
+}
+
+// newLimitListener returns ln limited to maxConns connections, and maxPerIP by client address, 0 is unlimited.
+func newLimitListener(ln net.Listener, maxConns, maxPerIP int, trusted []netip.Prefix) net.Listener {
+	if maxConns <= 0 && maxPerIP <= 0 {
+		return ln
+	}
+	limited := &limitListener{Listener: ln, maxPerIP: maxPerIP, trusted: trusted, perIP: make(map[netip.Addr]int)}
+	if maxConns > 0 {
+		limited.slots = make(chan struct{}, maxConns)
+	}
+	return limited
+}
+
+// Accept waits for a free slot and returns the next connection whose address is below its limit.
+func (ln *limitListener) Accept() (net.Conn, error) {
+	for {
+		if ln.slots != nil {
+			ln.slots <- struct{}{}
+		}
+		conn, err := ln.Listener.Accept()
+		if err != nil {
+			ln.releaseSlot()
+			return nil, err
+		}
+		addr := getConnAddr(conn)
+		if !ln.acquireIP(addr) {
+			conn.Close()
+			ln.releaseSlot()
+			continue
+		}
+		return &limitConn{Conn: conn, release: sync.OnceFunc(func() {
+			ln.releaseIP(addr)
+			ln.releaseSlot()
+		})}, nil
+	}
+}
+
+// acquireIP counts a connection of addr, it reports false when addr already has maxPerIP connections.
+func (ln *limitListener) acquireIP(addr netip.Addr) bool {
+	if ln.maxPerIP <= 0 || !addr.IsValid() || isTrustedProxy(ln.trusted, addr) {
+		return true
+	}
+	ln.mu.Lock()
+	defer ln.mu.Unlock()
+	if ln.perIP[addr] >= ln.maxPerIP {
+		return false
+	}
+	ln.perIP[addr]++
+	return true
+}
+
+// releaseIP forgets a connection counted by acquireIP.
+func (ln *limitListener) releaseIP(addr netip.Addr) {
+	if ln.maxPerIP <= 0 || !addr.IsValid() || isTrustedProxy(ln.trusted, addr) {
+		return
+	}
+	ln.mu.Lock()
+	defer ln.mu.Unlock()
+	if ln.perIP[addr]--; ln.perIP[addr] <= 0 {
+		delete(ln.perIP, addr)
+	}
+}
+
+// releaseSlot frees the slot of a connection closed.
+func (ln *limitListener) releaseSlot() {
+	if ln.slots != nil {
+		<-ln.slots
+	}
+}
+
+// limitConn releases its slot and address count when it is closed, once.
+type limitConn struct {
+	net.Conn
+	release func()
+}
+
+// Close closes the connection and releases its limits.
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.release()
+	return err
+}
+
+// getConnAddr returns the ip address of the peer of conn, unmapped so that ipv4 clients of a dual stack listener
+// are counted once.
+func getConnAddr(conn net.Conn) netip.Addr {
+	addrPort, err := netip.ParseAddrPort(conn.RemoteAddr().String())
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addrPort.Addr().Unmap()
+}
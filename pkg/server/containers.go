@@ -0,0 +1,100 @@
+package server
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// containerKeys gives the keyValue holding the panels of each container component, every panel has a title and
+// child blocks rendered like the blocks of the page.
+var containerKeys = map[string]string{
+	"Tabs":  "tabs",
+	"Steps": "steps",
+}
+
+// ContainerPanel is a tab of a Tabs component or a step of a Steps component.
+type ContainerPanel struct {
+	ID     string
+	Number int // from 1
+	Title  string
+	Blocks []ContentBlock
+}
+
+// ContainerData is the normalized content of a container component.
+type ContainerData struct {
+	ID     string
+	Panels []ContainerPanel
+}
+
+// containerCounter gives a unique html id to every container component rendered by the server.
+var containerCounter atomic.Int64
+
+// childBlock is a block inside a container, with the json pointer of its keyValues relative to the container ones.
+type childBlock struct {
+	Pointer string
+	Block   ContentBlock
+}
+
+// toContentBlock converts a child block decoded from the keyValues of a container.
+func toContentBlock(raw interface{}) (ContentBlock, error) {
+	values, ok := raw.(map[string]interface{})
+	if !ok {
+		return ContentBlock{}, fmt.Errorf("a child block should be an object with a type and keyValues, got %v", raw)
+	}
+	block := ContentBlock{Type: toCellString(values["type"])}
+	if block.Type == "" {
+		return ContentBlock{}, fmt.Errorf("a child block needs a type, got %v", raw)
+	}
+	block.KeyValues, _ = values["keyValues"].(map[string]interface{})
+	return block, nil
+}
+
+// getChildBlocks returns the blocks of the panels of a container block, nil for the other components.
+func getChildBlocks(block ContentBlock) ([]childBlock, error) {
+	key, found := containerKeys[block.Type]
+	if !found {
+		return nil, nil
+	}
+	panels, _ := block.KeyValues[key].([]interface{})
+	var children []childBlock
+	for i, raw := range panels {
+		panel, _ := raw.(map[string]interface{})
+		blocks, _ := panel["blocks"].([]interface{})
+		for j, rawBlock := range blocks {
+			child, err := toContentBlock(rawBlock)
+			if err != nil {
+				return nil, err
+			}
+			children = append(children, childBlock{Pointer: fmt.Sprintf("/%s/%d/blocks/%d/keyValues", key, i, j), Block: child})
+		}
+	}
+	return children, nil
+}
+
+// getContainerData builds the ContainerData of a Tabs or Steps component from the panels under key in its
+// KeyValues, each a {"title", "blocks"} object whose blocks are like the custom_content of a page.
+func getContainerData(kv map[string]interface{}, key string) (*ContainerData, error) {
+	id := fmt.Sprintf("%s-%d", key, containerCounter.Add(1))
+	data := &ContainerData{ID: id}
+	panels, _ := kv[key].([]interface{})
+	if len(panels) == 0 {
+		return nil, fmt.Errorf("%s should be a list of panels with a title and blocks", key)
+	}
+	for i, raw := range panels {
+		values, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s should be a list of panels with a title and blocks, got %v", key, raw)
+		}
+		panel := ContainerPanel{ID: fmt.Sprintf("%s-%d", id, i+1), Number: i + 1, Title: toCellString(values["title"])}
+		blocks, _ := values["blocks"].([]interface{})
+		for _, rawBlock := range blocks {
+			block, err := toContentBlock(rawBlock)
+			if err != nil {
+				return nil, err
+			}
+			panel.Blocks = append(panel.Blocks, block)
+		}
+		data.Panels = append(data.Panels, panel)
+	}
+	return data, nil
+}
@@ -0,0 +1,409 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/markdown"
+)
+
+// defaultContentTemplate is the template of the pages of the content files without one in their front matter.
+const defaultContentTemplate = "main_basic.gohtml"
+
+// contentExtensions are the extensions of the files of the content dir converted into pages.
+var contentExtensions = []string{".md", ".html"}
+
+// the content files are pages written as markdown or html, starting with a front matter giving the fields of the
+// page like in the config, in yaml between --- lines or in toml between +++ lines:
+//
+//	---
+//	title: About us
+//	showInMenu: true
+//	menuOrder: 3
+//	tags: [team, history]
+//	---
+//	# Our story
+//
+// the front matter understands the scalars, the [a, b] lists, and the nested objects and - lists of yaml or the
+// [table] of toml, which covers the fields of a page without the need of a full parser.
+
+// splitFrontMatter returns the front matter of a content file decoded, and the text after it.
+func splitFrontMatter(data string) (map[string]interface{}, string, error) {
+	data = strings.TrimPrefix(strings.ReplaceAll(data, "\r\n", "\n"), "\ufeff")
+	for _, delim := range []string{"---", "+++"} {
+		if !strings.HasPrefix(data, delim+"\n") {
+			continue
+		}
+		front, body, found := strings.Cut(data[len(delim)+1:], "\n"+delim)
+		if !found || (body != "" && body[0] != '\n') {
+			return nil, "", fmt.Errorf("the front matter starting with %s has no closing %s line", delim, delim)
+		}
+		front += "\n"
+		parse := parseYAMLFrontMatter
+		if delim == "+++" {
+			parse = parseTOMLFrontMatter
+		}
+		values, err := parse(strings.Split(front, "\n"))
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid front matter: %w", err)
+		}
+		return values, strings.TrimPrefix(body, "\n"), nil
+	}
+	return map[string]interface{}{}, data, nil
+}
+
+// frontMatterLine is a significant line of a yaml front matter.
+type frontMatterLine struct {
+	Number int // in the file, the opening --- is the line 1
+	Indent int
+	Text   string
+}
+
+// parseYAMLFrontMatter decodes the lines of a yaml front matter, the comments and the blank lines are skipped.
+func parseYAMLFrontMatter(lines []string) (map[string]interface{}, error) {
+	var significant []frontMatterLine
+	for i, line := range lines {
+		text := strings.TrimSpace(line)
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "\t") {
+			return nil, fmt.Errorf("line %d: indent with spaces, not tabs", i+2)
+		}
+		significant = append(significant, frontMatterLine{Number: i + 2, Indent: len(line) - len(strings.TrimLeft(line, " ")), Text: text})
+	}
+	if len(significant) == 0 {
+		return map[string]interface{}{}, nil
+	}
+	value, next, err := parseYAMLBlock(significant, 0, significant[0].Indent)
+	if err != nil {
+		return nil, err
+	}
+	if next < len(significant) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", significant[next].Number)
+	}
+	values, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("line %d: the front matter must be keys with their values", significant[0].Number)
+	}
+	return values, nil
+}
+
+// parseYAMLBlock decodes the lines from pos having indent, a list when they start with - else an object, and
+// returns the position of the line after the block.
+func parseYAMLBlock(lines []frontMatterLine, pos, indent int) (interface{}, int, error) {
+	isItem := func(text string) bool { return text == "-" || strings.HasPrefix(text, "- ") }
+	if isItem(lines[pos].Text) {
+		var list []interface{}
+		for pos < len(lines) && lines[pos].Indent == indent && isItem(lines[pos].Text) {
+			line := lines[pos]
+			pos++
+			text := strings.TrimSpace(strings.TrimPrefix(line.Text, "-"))
+			if isYAMLKeyLine(text) {
+				// an object starting on the line of its item, like - name: home, its keys are at the indent of the first one
+				keyIndent := indent + len(line.Text) - len(text)
+				lines[pos-1] = frontMatterLine{Number: line.Number, Indent: keyIndent, Text: text}
+				value, next, err := parseYAMLBlock(lines, pos-1, keyIndent)
+				if err != nil {
+					return nil, next, err
+				}
+				list, pos = append(list, value), next
+				continue
+			}
+			if text != "" {
+				value, err := parseFrontMatterValue(text)
+				if err != nil {
+					return nil, pos, fmt.Errorf("line %d: %w", line.Number, err)
+				}
+				list = append(list, value)
+				continue
+			}
+			if pos >= len(lines) || lines[pos].Indent <= indent {
+				list = append(list, nil)
+				continue
+			}
+			value, next, err := parseYAMLBlock(lines, pos, lines[pos].Indent)
+			if err != nil {
+				return nil, next, err
+			}
+			list, pos = append(list, value), next
+		}
+		return list, pos, nil
+	}
+	values := make(map[string]interface{})
+	for pos < len(lines) && lines[pos].Indent == indent && !isItem(lines[pos].Text) {
+		line := lines[pos]
+		pos++
+		key, text, found := strings.Cut(line.Text, ":")
+		if !found || (text != "" && text[0] != ' ') {
+			return nil, pos, fmt.Errorf("line %d: expected key: value, got %q", line.Number, line.Text)
+		}
+		key = strings.Trim(strings.TrimSpace(key), `"'`)
+		if _, duplicate := values[key]; duplicate {
+			return nil, pos, fmt.Errorf("line %d: duplicate key %q", line.Number, key)
+		}
+		if text = strings.TrimSpace(text); text != "" {
+			value, err := parseFrontMatterValue(text)
+			if err != nil {
+				return nil, pos, fmt.Errorf("line %d: %w", line.Number, err)
+			}
+			values[key] = value
+			continue
+		}
+		// the value is the block below the key, more indented, or a list at the same indent
+		switch {
+		case pos < len(lines) && lines[pos].Indent > indent:
+		case pos < len(lines) && lines[pos].Indent == indent && isItem(lines[pos].Text):
+		default:
+			values[key] = nil
+			continue
+		}
+		value, next, err := parseYAMLBlock(lines, pos, lines[pos].Indent)
+		if err != nil {
+			return nil, next, err
+		}
+		values[key], pos = value, next
+	}
+	return values, pos, nil
+}
+
+// isYAMLKeyLine reports whether the text of a list item is a key: value line rather than a scalar.
+func isYAMLKeyLine(text string) bool {
+	if text == "" || strings.ContainsRune(`"'[#`, rune(text[0])) {
+		return false
+	}
+	_, value, found := strings.Cut(text, ":")
+	return found && (value == "" || value[0] == ' ')
+}
+
+// parseTOMLFrontMatter decodes the lines of a toml front matter, the key = value lines under [table] headers.
+func parseTOMLFrontMatter(lines []string) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	table := values
+	for i, line := range lines {
+		text := strings.TrimSpace(line)
+		number := i + 2
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]") {
+			table = values
+			for _, name := range strings.Split(strings.Trim(text, "[] "), ".") {
+				name = strings.Trim(strings.TrimSpace(name), `"'`)
+				sub, found := table[name]
+				if !found {
+					sub = make(map[string]interface{})
+					table[name] = sub
+				}
+				if table, found = sub.(map[string]interface{}); !found {
+					return nil, fmt.Errorf("line %d: %s is already a value", number, name)
+				}
+			}
+			continue
+		}
+		key, text, found := strings.Cut(text, "=")
+		if !found {
+			return nil, fmt.Errorf("line %d: expected key = value, got %q", number, strings.TrimSpace(line))
+		}
+		key = strings.Trim(strings.TrimSpace(key), `"'`)
+		if _, duplicate := table[key]; duplicate {
+			return nil, fmt.Errorf("line %d: duplicate key %q", number, key)
+		}
+		value, err := parseFrontMatterValue(strings.TrimSpace(text))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", number, err)
+		}
+		table[key] = value
+	}
+	return values, nil
+}
+
+// parseFrontMatterValue decodes a value of a front matter line: a quoted string, true, false, null, a number, an
+// [a, b] list, or else the text itself like 2026-01-15 or a title, without its # comment.
+func parseFrontMatterValue(text string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(text, `"`):
+		end := 1
+		for ; end < len(text) && text[end] != '"'; end++ {
+			if text[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(text) {
+			return nil, fmt.Errorf("unterminated string %s", text)
+		}
+		if rest := strings.TrimSpace(text[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return nil, fmt.Errorf("unexpected %q after the string", rest)
+		}
+		return strconv.Unquote(text[:end+1])
+	case strings.HasPrefix(text, "'"):
+		end := strings.Index(strings.ReplaceAll(text[1:], "''", "  "), "'")
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated string %s", text)
+		}
+		return strings.ReplaceAll(text[1:end+1], "''", "'"), nil
+	case strings.HasPrefix(text, "["):
+		end := strings.LastIndex(text, "]")
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated list %s", text)
+		}
+		list := []interface{}{}
+		for _, item := range splitFrontMatterList(text[1:end]) {
+			value, err := parseFrontMatterValue(item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, nil
+	}
+	if cut := strings.Index(text, " #"); cut >= 0 {
+		text = strings.TrimSpace(text[:cut])
+	}
+	switch text {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null", "~":
+		return nil, nil
+	}
+	if n, err := strconv.ParseFloat(text, 64); err == nil && !strings.ContainsAny(text, "xXnN") {
+		return n, nil
+	}
+	return text, nil
+}
+
+// splitFrontMatterList splits the items of an [a, "b, c"] list on the commas outside of the quotes.
+func splitFrontMatterList(text string) []string {
+	var items []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote != 0 && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, strings.TrimSpace(text[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(text[start:]); last != "" {
+		items = append(items, last)
+	}
+	return items
+}
+
+// getContentRoute returns the route of a content file without one in its front matter, from its path in the
+// content dir: about.md is GET /about, blog/first-post.md is GET /blog/first-post and blog/index.md is GET /blog.
+func getContentRoute(rel string) string {
+	rel = strings.TrimSuffix(filepath.ToSlash(rel), path.Ext(rel))
+	if base := path.Base(rel); base == "index" {
+		rel = strings.TrimSuffix(path.Dir(rel), ".")
+	}
+	return http.MethodGet + " /" + rel
+}
+
+// readContentPage converts the content file at rel, a slash separated path in the content dir root, into a page:
+// its front matter gives the fields of the page and the markdown or html after it the Body.
+func readContentPage(root fs.FS, rel string) (Page, error) {
+	data, err := fs.ReadFile(root, rel)
+	if err != nil {
+		return Page{}, err
+	}
+	front, body, err := splitFrontMatter(string(data))
+	if err != nil {
+		return Page{}, err
+	}
+	page := Page{Template: defaultContentTemplate, CreateHandler: true}
+	raw, err := json.Marshal(front)
+	if err != nil {
+		return Page{}, fmt.Errorf("invalid front matter: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&page); err != nil {
+		return Page{}, fmt.Errorf("invalid front matter: %w", err)
+	}
+	if page.Route == "" {
+		page.Route = getContentRoute(rel)
+	}
+	if page.Title == "" {
+		page.Title = strings.TrimSuffix(path.Base(rel), path.Ext(rel))
+	}
+	if strings.ToLower(path.Ext(rel)) == ".md" {
+		page.Body = template.HTML(markdown.ToHTML(body))
+	} else {
+		page.Body = template.HTML(body)
+	}
+	return page, nil
+}
+
+// loadContentPages appends the pages of the files of the content dir to the pages of the config, in the order of
+// their paths. the dot files are skipped, and a route already used by another page is a problem.
+func loadContentPages(config *SiteConfig) []ConfigError {
+	if config.Content == nil || config.Content.Dir == "" {
+		return nil
+	}
+	dir := config.Content.Dir
+	root, err := config.openDir(dir)
+	if err != nil {
+		return []ConfigError{{Pointer: "/content/dir", Value: dir, Message: "the dir must be an existing directory"}}
+	}
+	defer root.Close()
+	var problems []ConfigError
+	routes := make(map[string]string, len(config.Pages))
+	for i, page := range config.Pages {
+		routes[page.Route] = fmt.Sprintf("/pages/%d", i)
+	}
+	err = fs.WalkDir(root.FS(), ".", func(rel string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(entry.Name(), ".") && rel != "." {
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() || !slices.Contains(contentExtensions, strings.ToLower(path.Ext(rel))) {
+			return nil
+		}
+		file := filepath.Join(dir, filepath.FromSlash(rel))
+		page, err := readContentPage(root.FS(), rel)
+		if err != nil {
+			problems = append(problems, ConfigError{Pointer: "/content/dir", Value: file, Message: err.Error()})
+			return nil
+		}
+		// an unknown policy is reported by validateSanitize
+		if policy, found := getSanitizePolicy(config, config.Content.Sanitize); found {
+			page.Body = template.HTML(policy.Sanitize(string(page.Body)))
+		}
+		if other, found := routes[page.Route]; found {
+			problems = append(problems, ConfigError{Pointer: "/content/dir", Value: file, Message: fmt.Sprintf("the route %s is already the one of %s", page.Route, other)})
+			return nil
+		}
+		routes[page.Route] = file
+		config.Pages = append(config.Pages, page)
+		return nil
+	})
+	if err != nil {
+		problems = append(problems, ConfigError{Pointer: "/content/dir", Value: dir, Message: fmt.Sprintf("error reading the content files: %v", err)})
+	}
+	return problems
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSplitFrontMatter(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		want     map[string]interface{}
+		wantBody string
+		wantErr  string
+	}{
+		{
+			name:     "no front matter",
+			data:     "# Title\n---\n",
+			want:     map[string]interface{}{},
+			wantBody: "# Title\n---\n",
+		},
+		{
+			name:     "yaml scalars",
+			data:     "---\ntitle: About us\nshowInMenu: true\nmenuOrder: 3\ndraft: false\nlayout: ~\ndate: 2026-01-15 # publication\n---\n# Our story\n",
+			want:     map[string]interface{}{"title": "About us", "showInMenu": true, "menuOrder": float64(3), "draft": false, "layout": nil, "date": "2026-01-15"},
+			wantBody: "# Our story\n",
+		},
+		{
+			name: "yaml quoted values",
+			data: "---\ntitle: \"Hello: \\\"world\\\" # not a comment\"\nquote: 'it''s here'\nnumber: \"42\"\n---\n",
+			want: map[string]interface{}{"title": `Hello: "world" # not a comment`, "quote": "it's here", "number": "42"},
+		},
+		{
+			name: "yaml lists",
+			data: "---\ntags: [team, \"a, b\", 'c']\nempty: []\nauthors:\n  - Ann\n  - 2\nlinks:\n- name: home\n  url: /\n- name: blog\n  tags:\n    - news\n- time: 10:30\n- http://example.com\n---\n",
+			want: map[string]interface{}{
+				"tags":    []interface{}{"team", "a, b", "c"},
+				"empty":   []interface{}{},
+				"authors": []interface{}{"Ann", float64(2)},
+				"links": []interface{}{
+					map[string]interface{}{"name": "home", "url": "/"},
+					map[string]interface{}{"name": "blog", "tags": []interface{}{"news"}},
+					map[string]interface{}{"time": "10:30"},
+					"http://example.com",
+				},
+			},
+		},
+		{
+			name: "yaml nested keys",
+			data: "---\n# the seo of the page\nseo:\n  description: Our team\n  image:\n    url: /static/team.png\n    width: 1200\n\ntitle: Team\n---\n",
+			want: map[string]interface{}{
+				"seo":   map[string]interface{}{"description": "Our team", "image": map[string]interface{}{"url": "/static/team.png", "width": float64(1200)}},
+				"title": "Team",
+			},
+		},
+		{
+			name:     "crlf and bom",
+			data:     "\ufeff---\r\ntitle: Windows\r\ntags:\r\n  - a\r\n---\r\nbody\r\n",
+			want:     map[string]interface{}{"title": "Windows", "tags": []interface{}{"a"}},
+			wantBody: "body\n",
+		},
+		{
+			name:     "toml tables",
+			data:     "+++\ntitle = \"About\"\nmenuOrder = 2\ntags = [\"a\", \"b\"]\n\n[seo]\ndescription = 'Our team'\n[seo.image]\nurl = \"/static/team.png\"\n+++\nbody",
+			want:     map[string]interface{}{"title": "About", "menuOrder": float64(2), "tags": []interface{}{"a", "b"}, "seo": map[string]interface{}{"description": "Our team", "image": map[string]interface{}{"url": "/static/team.png"}}},
+			wantBody: "body",
+		},
+		{name: "missing closing fence", data: "---\ntitle: About\n# Our story\n", wantErr: "has no closing --- line"},
+		{name: "closing fence not alone on its line", data: "---\ntitle: About\n---more\n", wantErr: "has no closing --- line"},
+		{name: "missing closing toml fence", data: "+++\ntitle = \"About\"\n", wantErr: "has no closing +++ line"},
+		{name: "tab indent", data: "---\nseo:\n\tdescription: x\n---\n", wantErr: "line 3: indent with spaces"},
+		{name: "not a key", data: "---\ntitle About\n---\n", wantErr: "line 2: expected key: value"},
+		{name: "no space after the colon", data: "---\nurl:http://x\n---\n", wantErr: "line 2: expected key: value"},
+		{name: "duplicate key", data: "---\ntitle: a\ntitle: b\n---\n", wantErr: `line 3: duplicate key "title"`},
+		{name: "bad indentation", data: "---\n  title: a\nmenuOrder: 2\n---\n", wantErr: "line 3: unexpected indentation"},
+		{name: "bad indentation in a list item", data: "---\nlinks:\n  - name: home\n   url: /\n---\n", wantErr: "line 4: unexpected indentation"},
+		{name: "list at the root", data: "---\n- a\n- b\n---\n", wantErr: "must be keys with their values"},
+		{name: "unterminated string", data: "---\ntitle: \"About\n---\n", wantErr: "line 2: unterminated string"},
+		{name: "text after the string", data: "---\ntitle: \"About\" us\n---\n", wantErr: `unexpected "us" after the string`},
+		{name: "unterminated list", data: "---\ntags: [a, b\n---\n", wantErr: "unterminated list"},
+		{name: "toml without equal", data: "+++\ntitle \"About\"\n+++\n", wantErr: "line 2: expected key = value"},
+		{name: "toml table over a value", data: "+++\nseo = 1\n[seo]\n+++\n", wantErr: "line 3: seo is already a value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, body, err := splitFrontMatter(tt.data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("splitFrontMatter() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("splitFrontMatter() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitFrontMatter() = %#v, want %#v", got, tt.want)
+			}
+			if body != tt.wantBody {
+				t.Errorf("splitFrontMatter() body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestReadContentPage(t *testing.T) {
+	root := fstest.MapFS{
+		"blog/index.md":   {Data: []byte("---\ntitle: Blog\n---\n# News\n")},
+		"about.html":      {Data: []byte("+++\nroute = \"GET /team\"\nshowInMenu = true\n+++\n<p>us</p>")},
+		"untitled.md":     {Data: []byte("text")},
+		"unknown.md":      {Data: []byte("---\ntitel: typo\n---\n")},
+		"wrong-type.md":   {Data: []byte("---\nmenuOrder: first\n---\n")},
+		"not-closed.html": {Data: []byte("---\ntitle: x\n")},
+	}
+	tests := []struct {
+		rel       string
+		wantRoute string
+		wantTitle string
+		wantBody  string
+		wantErr   string
+	}{
+		{rel: "blog/index.md", wantRoute: "GET /blog", wantTitle: "Blog", wantBody: "<h1"},
+		{rel: "about.html", wantRoute: "GET /team", wantTitle: "about", wantBody: "<p>us</p>"},
+		{rel: "untitled.md", wantRoute: "GET /untitled", wantTitle: "untitled", wantBody: "text"},
+		{rel: "unknown.md", wantErr: `unknown field "titel"`},
+		{rel: "wrong-type.md", wantErr: "invalid front matter"},
+		{rel: "not-closed.html", wantErr: "no closing --- line"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rel, func(t *testing.T) {
+			page, err := readContentPage(root, tt.rel)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("readContentPage() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readContentPage() error = %v", err)
+			}
+			if page.Route != tt.wantRoute || page.Title != tt.wantTitle || !page.CreateHandler || page.Template != defaultContentTemplate {
+				t.Errorf("readContentPage() = route %q title %q handler %v template %q", page.Route, page.Title, page.CreateHandler, page.Template)
+			}
+			if !strings.Contains(string(page.Body), tt.wantBody) {
+				t.Errorf("readContentPage() body = %q, want %q in it", page.Body, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	cookieSameSiteLax    = "lax"
+	cookieSameSiteStrict = "strict"
+	cookieSameSiteNone   = "none"
+	cookieSecureAuto     = "auto"
+	cookieSecureAlways   = "always"
+	cookieSecureNever    = "never"
+)
+
+// CookiesConfig sets the attributes of the cookies of the site : the theme, flash and login session cookies.
+type CookiesConfig struct {
+	SameSite string `json:"sameSite,omitempty"` // lax (default), strict or none, none needs the secure attribute
+	Secure   string `json:"secure,omitempty"`   // auto (default) sets it on the https requests, always or never
+}
+
+// validateCookies checks the sameSite and secure values, the browsers drop the SameSite=None cookies without Secure.
+func validateCookies(config *SiteConfig) []ConfigError {
+	if config.Cookies == nil {
+		return nil
+	}
+	var problems []ConfigError
+	switch config.Cookies.SameSite {
+	case "", cookieSameSiteLax, cookieSameSiteStrict, cookieSameSiteNone:
+	default:
+		problems = append(problems, ConfigError{Pointer: "/cookies/sameSite", Value: config.Cookies.SameSite, Message: "sameSite must be lax, strict or none"})
+	}
+	switch config.Cookies.Secure {
+	case "", cookieSecureAuto, cookieSecureAlways, cookieSecureNever:
+	default:
+		problems = append(problems, ConfigError{Pointer: "/cookies/secure", Value: config.Cookies.Secure, Message: "secure must be auto, always or never"})
+	}
+	if config.Cookies.SameSite == cookieSameSiteNone && config.Cookies.Secure == cookieSecureNever {
+		problems = append(problems, ConfigError{Pointer: "/cookies/secure", Value: config.Cookies.Secure, Message: "sameSite none needs the secure attribute, the browsers drop these cookies without it"})
+	}
+	return problems
+}
+
+// getCookieSameSite returns the SameSite attribute of the cookies of the config, lax by default.
+func getCookieSameSite(config *SiteConfig) http.SameSite {
+	if config.Cookies != nil {
+		switch config.Cookies.SameSite {
+		case cookieSameSiteStrict:
+			return http.SameSiteStrictMode
+		case cookieSameSiteNone:
+			return http.SameSiteNoneMode
+		}
+	}
+	return http.SameSiteLaxMode
+}
+
+// isSecureCookie reports whether the cookies of the response to r get the Secure attribute : on the https requests,
+// as seen by the client behind the trusted proxies, unless the config says always or never.
+func isSecureCookie(config *SiteConfig, r *http.Request) bool {
+	if config.Cookies != nil {
+		switch config.Cookies.Secure {
+		case cookieSecureAlways:
+			return true
+		case cookieSecureNever:
+			return false
+		}
+	}
+	return getRequestScheme(r) == "https" || getCookieSameSite(config) == http.SameSiteNoneMode
+}
+
+// getCookieKey returns the key signing the theme and flash cookies : env COOKIE_SECRET, else SESSION_SECRET, else
+// the generated session key, kept in the store, so that the cookies are dropped at restart with a store in memory.
+func getCookieKey() []byte {
+	if secret := os.Getenv("COOKIE_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	if secret := os.Getenv("SESSION_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	return getGeneratedSessionKey()
+}
+
+// getCookieSignature returns the hmac of the cookie, its name is signed too so that a value can't be moved to
+// another cookie.
+func getCookieSignature(name, value string) []byte {
+	mac := hmac.New(sha256.New, getCookieKey())
+	mac.Write([]byte(name + "=" + value))
+	return mac.Sum(nil)
+}
+
+// setSignedCookie sets the cookie with its value followed by its signature, and the SameSite and Secure attributes
+// of the cookies config. a cookie having a negative MaxAge is removed.
+func setSignedCookie(w http.ResponseWriter, r *http.Request, config *SiteConfig, cookie *http.Cookie) {
+	if cookie.MaxAge >= 0 {
+		cookie.Value += "." + base64.RawURLEncoding.EncodeToString(getCookieSignature(cookie.Name, cookie.Value))
+	}
+	cookie.SameSite = getCookieSameSite(config)
+	cookie.Secure = isSecureCookie(config, r)
+	http.SetCookie(w, cookie)
+}
+
+// getSignedCookie returns the value of the cookie name set by setSignedCookie, found is false when the cookie is
+// missing or its signature is wrong, like a cookie edited by the visitor.
+func getSignedCookie(r *http.Request, name string) (value string, found bool) {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return "", false
+	}
+	i := strings.LastIndexByte(cookie.Value, '.')
+	if i < 0 {
+		return "", false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(cookie.Value[i+1:])
+	if err != nil || !hmac.Equal(signature, getCookieSignature(name, cookie.Value[:i])) {
+		return "", false
+	}
+	return cookie.Value[:i], true
+}
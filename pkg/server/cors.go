@@ -0,0 +1,143 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// defaultCORSHeaders are the request headers allowed when the cors config has no allowedHeaders
+var defaultCORSHeaders = []string{"Accept", "Accept-Language", "Content-Language", "Content-Type", requestIDHeader}
+
+// CORSConfig allows scripts of other origins to read the responses of the site, like the JSON errors and /health.
+type CORSConfig struct {
+	AllowedOrigins []string `json:"allowedOrigins"`           // like https://app.example.com, or * for any origin
+	AllowedMethods []string `json:"allowedMethods,omitempty"` // default is every method of the route
+	AllowedHeaders []string `json:"allowedHeaders,omitempty"` // request headers the scripts may send, default is defaultCORSHeaders
+	MaxAge         int      `json:"maxAge,omitempty"`         // seconds the browsers may cache a preflight response
+}
+
+// isCORSEnabled reports whether the config allows at least one other origin.
+func isCORSEnabled(site *SiteConfig) bool {
+	return site.CORS != nil && len(site.CORS.AllowedOrigins) > 0
+}
+
+// validateCORS checks the origins are * or a scheme and host without path, and the methods are http tokens.
+func validateCORS(config *SiteConfig) []ConfigError {
+	if config.CORS == nil {
+		return nil
+	}
+	var problems []ConfigError
+	for i, origin := range config.CORS.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+			problems = append(problems, ConfigError{Pointer: fmt.Sprintf("/cors/allowedOrigins/%d", i), Value: origin, Message: "an origin must be * or a scheme and host like https://app.example.com"})
+		}
+	}
+	for i, method := range config.CORS.AllowedMethods {
+		if method == "" || strings.ToUpper(method) != method || strings.ContainsAny(method, " ,") {
+			problems = append(problems, ConfigError{Pointer: fmt.Sprintf("/cors/allowedMethods/%d", i), Value: method, Message: "a method must be an uppercase http method like GET"})
+		}
+	}
+	if config.CORS.MaxAge < 0 {
+		problems = append(problems, ConfigError{Pointer: "/cors/maxAge", Value: config.CORS.MaxAge, Message: "maxAge must be a positive number of seconds"})
+	}
+	return problems
+}
+
+// getCORSFromEnvOrPanic returns the cors config with the allowed origins of env CORS_ALLOWED_ORIGINS,
+// a comma separated list overriding the allowedOrigins of the config.
+func getCORSFromEnvOrPanic(site *SiteConfig) *CORSConfig {
+	val, exist := os.LookupEnv("CORS_ALLOWED_ORIGINS")
+	if !exist {
+		return site.CORS
+	}
+	config := CORSConfig{}
+	if site.CORS != nil {
+		config = *site.CORS
+	}
+	config.AllowedOrigins = nil
+	for _, origin := range strings.Split(val, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			config.AllowedOrigins = append(config.AllowedOrigins, origin)
+		}
+	}
+	if problems := validateCORS(&SiteConfig{CORS: &config}); len(problems) > 0 {
+		panic(fmt.Errorf("💥💥 ERROR: CONFIG ENV CORS_ALLOWED_ORIGINS is invalid. %v: %s", problems[0].Value, problems[0].Message))
+	}
+	return &config
+}
+
+// getAllowedOrigin returns the value of Access-Control-Allow-Origin for the Origin of the request,
+// or an empty string when the origin is not allowed.
+func getAllowedOrigin(config *CORSConfig, origin string) string {
+	if origin == "" {
+		return ""
+	}
+	for _, allowed := range config.AllowedOrigins {
+		if allowed == "*" {
+			return "*"
+		}
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// withCORS adds the Access-Control-Allow-Origin header to the responses for the allowed origins,
+// the preflight requests are answered by getOptionsHandler.
+func withCORS(next http.Handler, site *SiteConfig) http.Handler {
+	if !isCORSEnabled(site) {
+		return next
+	}
+	config := site.CORS
+	anyOrigin := slices.Contains(config.AllowedOrigins, "*")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !anyOrigin {
+			// the response depends on the origin, a shared cache must not serve it to another one
+			w.Header().Add("Vary", "Origin")
+		}
+		if origin := getAllowedOrigin(config, r.Header.Get("Origin")); origin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Expose-Headers", requestIDHeader)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// setCORSPreflightHeaders answers a preflight request of an allowed origin with the methods of the route
+// permitted by the config, the allowed headers and the max age.
+func setCORSPreflightHeaders(w http.ResponseWriter, r *http.Request, site *SiteConfig, methods []string) {
+	if !isCORSEnabled(site) || r.Header.Get("Access-Control-Request-Method") == "" || w.Header().Get("Access-Control-Allow-Origin") == "" {
+		return
+	}
+	config := site.CORS
+	allowed := methods
+	if len(config.AllowedMethods) > 0 {
+		allowed = nil
+		for _, method := range methods {
+			if slices.Contains(config.AllowedMethods, method) {
+				allowed = append(allowed, method)
+			}
+		}
+	}
+	headers := config.AllowedHeaders
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	}
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(allowed, ", "))
+	w.Header().Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+	if config.MaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(config.MaxAge))
+	}
+	w.Header().Add("Vary", "Access-Control-Request-Method")
+	w.Header().Add("Vary", "Access-Control-Request-Headers")
+}
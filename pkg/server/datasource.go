@@ -0,0 +1,258 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/internal/siteerrors"
+)
+
+const (
+	dataSourceFetchTimeout  = 5 * time.Second
+	dataSourceRetryDelay    = 10 * time.Second // after a failed fetch, doubled at each failure up to maxDataSourceRetryDelay
+	maxDataSourceRetryDelay = 5 * time.Minute
+)
+
+// errDataNotFound is returned when the entry selected by a route parameter does not exist in the data source,
+// the page answers a 404.
+var errDataNotFound = siteerrors.Wrap(siteerrors.KindNotFound, "", errors.New("data source entry not found"))
+
+// routeParamRegex matches the wildcards of a Go 1.22 path pattern like /docs/{slug} or /files/{path...}
+var routeParamRegex = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)(\.\.\.)?\}`)
+
+// DataSource describes where a page loads its dynamic content from.
+type DataSource struct {
+	URL         string            `json:"url"`                   // a local json file path or an http(s) url
+	Key         string            `json:"key,omitempty"`         // name of the route parameter used to select one entry, e.g. "slug"
+	Sanitize    map[string]string `json:"sanitize,omitempty"`    // sanitize policy of the html fields, like {"body": "ugc"}, they are rendered as html
+	MaxStale    string            `json:"maxStale,omitempty"`    // age of the last copy served when the url fails, a Go duration like 24h, no limit when empty
+	StaleNotice string            `json:"staleNotice,omitempty"` // shown above the page by the StaleDataNotice partial while the last copy is served
+}
+
+// DataStatus tells the templates, as .DataStatus, whether the data of the page is fresh.
+type DataStatus struct {
+	Stale     bool      // the url failed, .Data is its last copy fetched successfully
+	FetchedAt time.Time // when the remote data was fetched, zero for a local file
+	Notice    string    // the staleNotice of the data source
+	err       error     // why the url failed, only logged
+}
+
+// dataSourceCopy is the last json fetched successfully from the url of a remote data source.
+type dataSourceCopy struct {
+	raw       []byte // nil when the url never answered
+	fetchedAt time.Time
+	failing   bool      // the last fetch failed, the copy is stale
+	failures  int       // fetches failed in a row
+	retryAt   time.Time // while failing, the requests do not fetch the url again before it
+	err       error     // of the last fetch failed
+}
+
+// dataSourceCopies keeps the last copy of each remote data source, served when its url fails.
+var dataSourceCopies = struct {
+	mu      sync.RWMutex
+	entries map[string]*dataSourceCopy
+}{entries: make(map[string]*dataSourceCopy)}
+
+// recordDataSourceFetch records the outcome of a fetch of the data source at url, the json fetched or the error,
+// and returns its last copy, whose raw is nil when it never succeeded. after a failure, the next fetch by a request
+// waits a delay doubling at each failure, so that a url down is not called by every request.
+func recordDataSourceFetch(url string, raw []byte, err error) *dataSourceCopy {
+	dataSourceCopies.mu.Lock()
+	defer dataSourceCopies.mu.Unlock()
+	now := time.Now()
+	if err == nil {
+		c := &dataSourceCopy{raw: raw, fetchedAt: now}
+		dataSourceCopies.entries[url] = c
+		return c
+	}
+	failing := &dataSourceCopy{}
+	if c, found := dataSourceCopies.entries[url]; found {
+		*failing = *c
+	}
+	failing.failing, failing.err = true, err
+	failing.failures++
+	delay := maxDataSourceRetryDelay
+	if failing.failures <= 10 {
+		delay = min(dataSourceRetryDelay<<(failing.failures-1), maxDataSourceRetryDelay)
+	}
+	failing.retryAt = now.Add(delay)
+	dataSourceCopies.entries[url] = failing
+	return failing
+}
+
+// getDataSourceCopy returns the last copy of the data source at url, nil when it was never fetched.
+func getDataSourceCopy(url string) *dataSourceCopy {
+	dataSourceCopies.mu.RLock()
+	defer dataSourceCopies.mu.RUnlock()
+	return dataSourceCopies.entries[url]
+}
+
+// validateDataSources checks the maxStale durations of the data sources of the pages.
+func validateDataSources(config *SiteConfig) []ConfigError {
+	var problems []ConfigError
+	for i, page := range config.Pages {
+		if page.DataSource == nil || page.DataSource.MaxStale == "" {
+			continue
+		}
+		if _, err := parseServerDuration(page.DataSource.MaxStale); err != nil {
+			problems = append(problems, ConfigError{Pointer: fmt.Sprintf("/pages/%d/dataSource/maxStale", i), Value: page.DataSource.MaxStale, Message: fmt.Sprintf("invalid duration: %v", err)})
+		}
+	}
+	return problems
+}
+
+// getRouteParamNames returns the names of the wildcards present in a route path pattern.
+func getRouteParamNames(path string) []string {
+	var names []string
+	for _, m := range routeParamRegex.FindAllStringSubmatch(path, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+// isRoutePatternMatch reports whether urlPath is really served by the route path pattern.
+// the mux already did the matching for patterns with wildcards, but a plain "/" pattern matches every path.
+func isRoutePatternMatch(pattern, urlPath string) bool {
+	if strings.Contains(pattern, "{") {
+		return true
+	}
+	return pattern == urlPath
+}
+
+// getRouteParams returns the path values of the request for the given wildcard names.
+func getRouteParams(r *http.Request, names []string) map[string]string {
+	if len(names) == 0 {
+		return nil
+	}
+	params := make(map[string]string, len(names))
+	for _, name := range names {
+		params[name] = r.PathValue(name)
+	}
+	return params
+}
+
+// isRemoteDataSource reports whether the data source at url is fetched over http.
+func isRemoteDataSource(url string) bool {
+	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
+}
+
+// fetchDataSource returns the body of the remote data source at url.
+func fetchDataSource(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the request of data source %s: %w", url, err)
+	}
+	client := http.Client{Timeout: dataSourceFetchTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching data source %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("data source %s returned status %s", url, resp.Status)
+	}
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading data source %s: %w", url, err)
+	}
+	return raw, nil
+}
+
+// loadDataSource reads the json document of the data source and, when a Key is set,
+// returns only the entry selected by the corresponding route parameter.
+func loadDataSource(ctx context.Context, site *SiteConfig, ds *DataSource, params map[string]string) (interface{}, error) {
+	data, _, err := loadDataSourceStatus(ctx, site, ds, params)
+	return data, err
+}
+
+// loadDataSourceStatus is loadDataSource returning the freshness of the data too. a remote data source refreshed by
+// a refreshDataSources task is read from memory, and the last copy of a remote data source whose url fails is
+// served while it is younger than its maxStale. the url failing is fetched again by a request after its retry delay.
+func loadDataSourceStatus(ctx context.Context, site *SiteConfig, ds *DataSource, params map[string]string) (interface{}, *DataStatus, error) {
+	var raw []byte
+	var err error
+	status := &DataStatus{Notice: ds.StaleNotice}
+	if isRemoteDataSource(ds.URL) {
+		c := getDataSourceCopy(ds.URL)
+		var found bool
+		if raw, found = getCachedDataSource(ds.URL); !found {
+			if c != nil && c.failing && time.Now().Before(c.retryAt) {
+				err = fmt.Errorf("data source %s failed, fetched again after %s: %w", ds.URL, c.retryAt.Format(time.RFC3339), c.err)
+			} else {
+				raw, err = fetchDataSource(ctx, ds.URL)
+				if ctx.Err() != nil {
+					// the request is gone, the url did not fail
+					return nil, nil, err
+				}
+				if err == nil && !json.Valid(raw) {
+					err = fmt.Errorf("data source %s is not valid json", ds.URL)
+				}
+				c = recordDataSourceFetch(ds.URL, raw, err)
+			}
+			if c.raw == nil {
+				return nil, nil, err
+			}
+		}
+		if c != nil && c.failing {
+			if maxStale, _ := parseServerDuration(ds.MaxStale); maxStale > 0 && time.Since(c.fetchedAt) > maxStale {
+				return nil, nil, fmt.Errorf("data source %s fails and its last copy of %s is older than maxStale %s", ds.URL, c.fetchedAt.Format(time.RFC3339), ds.MaxStale)
+			}
+			raw, status.Stale, status.err = c.raw, true, err
+		}
+		if c != nil {
+			status.FetchedAt = c.fetchedAt
+		}
+	} else {
+		raw, err = site.readFile(ds.URL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading data source %s: %w", ds.URL, err)
+		}
+	}
+	var data interface{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, nil, fmt.Errorf("error decoding data source %s: %w", ds.URL, err)
+	}
+	if ds.Key == "" {
+		return data, status, nil
+	}
+	entries, ok := data.(map[string]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("data source %s should contain a json object when key '%s' is used", ds.URL, ds.Key)
+	}
+	entry, ok := entries[params[ds.Key]]
+	if !ok {
+		return nil, nil, errDataNotFound
+	}
+	return entry, status, nil
+}
+
+// applyDataToPage overrides the title, description and content of the page with the
+// values of the same name found in the data source entry, if any.
+func applyDataToPage(page *Page, data interface{}) {
+	entry, ok := data.(map[string]interface{})
+	if !ok {
+		return
+	}
+	if v, ok := entry["title"].(string); ok {
+		page.Title = v
+	}
+	if v, ok := entry["description"].(string); ok {
+		page.Description = v
+	}
+	if v, ok := entry["content"].(string); ok {
+		page.Content = v
+	}
+	if v, ok := entry["content"].(template.HTML); ok {
+		// the content is html kept by its sanitize policy
+		page.Body = v
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoadDataSourceBackoff(t *testing.T) {
+	var hits atomic.Int32
+	var down atomic.Bool
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if down.Load() {
+			http.Error(w, "down", http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"title": "Products"}`))
+	}))
+	defer remote.Close()
+	ds := &DataSource{URL: remote.URL + "/products.json"}
+	ctx := context.Background()
+	load := func() (*DataStatus, error) {
+		t.Helper()
+		_, status, err := loadDataSourceStatus(ctx, &SiteConfig{}, ds, nil)
+		return status, err
+	}
+	// the retry delay is over
+	expireRetry := func() {
+		dataSourceCopies.mu.Lock()
+		dataSourceCopies.entries[ds.URL].retryAt = time.Now().Add(-time.Second)
+		dataSourceCopies.mu.Unlock()
+	}
+
+	down.Store(true)
+	if _, err := load(); err == nil {
+		t.Fatal("loadDataSourceStatus() of a url down without copy succeeded")
+	}
+	if _, err := load(); err == nil || hits.Load() != 1 {
+		t.Fatalf("loadDataSourceStatus() during the retry delay: error %v after %d fetches, want an error without fetching", err, hits.Load())
+	}
+	expireRetry()
+	down.Store(false)
+	if status, err := load(); err != nil || status.Stale || hits.Load() != 2 {
+		t.Fatalf("loadDataSourceStatus() after the retry delay = %+v, %v after %d fetches, want the fresh data", status, err, hits.Load())
+	}
+
+	down.Store(true)
+	if status, err := load(); err != nil || !status.Stale || hits.Load() != 3 {
+		t.Fatalf("loadDataSourceStatus() of a url failing = %+v, %v, want the last copy", status, err)
+	}
+	if status, err := load(); err != nil || !status.Stale || hits.Load() != 3 {
+		t.Fatalf("loadDataSourceStatus() during the retry delay = %+v, %v after %d fetches, want the last copy without fetching", status, err, hits.Load())
+	}
+	first := getDataSourceCopy(ds.URL).retryAt
+	expireRetry()
+	load()
+	if c := getDataSourceCopy(ds.URL); c.failures != 2 || time.Until(c.retryAt) <= time.Until(first) {
+		t.Errorf("after %d failures the retry delay %s did not grow", c.failures, time.Until(c.retryAt))
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	expireRetry()
+	failures := getDataSourceCopy(ds.URL).failures
+	if _, _, err := loadDataSourceStatus(canceled, &SiteConfig{}, ds, nil); err == nil || getDataSourceCopy(ds.URL).failures != failures {
+		t.Errorf("a request canceled counted as a failure of the url")
+	}
+}
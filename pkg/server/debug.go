@@ -0,0 +1,135 @@
+package server
+
+import (
+	"expvar"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/version"
+)
+
+const debugPath = "/debug"
+
+// DebugConfig enables the /debug endpoint, protected by the ADMIN_TOKEN like the admin endpoints.
+type DebugConfig struct {
+	Enabled bool `json:"enabled"`
+	Pprof   bool `json:"pprof,omitempty"`  // also serve the go profiles under /debug/pprof/
+	Expvar  bool `json:"expvar,omitempty"` // also serve the expvar variables under /debug/vars
+}
+
+// DebugInfo is the snapshot returned by /debug
+type DebugInfo struct {
+	App        string          `json:"app"`
+	Version    string          `json:"version"`
+	Build      string          `json:"build"`
+	GoVersion  string          `json:"goVersion"`
+	StartedAt  time.Time       `json:"startedAt"`
+	Uptime     string          `json:"uptime"`
+	Goroutines int             `json:"goroutines"`
+	Templates  int             `json:"templates"` // renderers in the template cache, the pages and the error pages
+	Config     DebugConfigInfo `json:"config"`
+	Memory     DebugMemoryInfo `json:"memory"`
+}
+
+// DebugConfigInfo counts the main elements of the loaded config.
+type DebugConfigInfo struct {
+	Pages         int `json:"pages"`
+	Handlers      int `json:"handlers"` // pages having a handler, drafts excluded
+	Drafts        int `json:"drafts"`
+	ContentBlocks int `json:"contentBlocks"`
+	Forms         int `json:"forms"`
+	DataSources   int `json:"dataSources"`
+	Menus         int `json:"menus"`
+}
+
+// DebugMemoryInfo is a subset of runtime.MemStats, in bytes.
+type DebugMemoryInfo struct {
+	HeapAlloc    uint64 `json:"heapAlloc"`
+	HeapInuse    uint64 `json:"heapInuse"`
+	HeapObjects  uint64 `json:"heapObjects"`
+	TotalAlloc   uint64 `json:"totalAlloc"`
+	Sys          uint64 `json:"sys"`
+	NumGC        uint32 `json:"numGC"`
+	PauseTotalNs uint64 `json:"pauseTotalNs"`
+}
+
+// isDebugEnabled reports whether the /debug endpoint is enabled in the config.
+func isDebugEnabled(site *SiteConfig) bool {
+	return site.Debug != nil && site.Debug.Enabled
+}
+
+// getDebugConfigInfo counts the pages, handlers and components of the config.
+func getDebugConfigInfo(site *SiteConfig) DebugConfigInfo {
+	info := DebugConfigInfo{Pages: len(site.Pages), Menus: len(site.Menus)}
+	for _, page := range site.Pages {
+		if page.Draft {
+			info.Drafts++
+		} else if page.CreateHandler {
+			info.Handlers++
+		}
+		info.ContentBlocks += len(page.CustomContent)
+		if page.Form != nil {
+			info.Forms++
+		}
+		if page.DataSource != nil {
+			info.DataSources++
+		}
+	}
+	return info
+}
+
+// getDebugInfo returns the current state of the server, the memory stats stop the world for a short time.
+func getDebugInfo(site *SiteConfig, startedAt time.Time) DebugInfo {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	templateCacheMu.RLock()
+	templates := len(templateCache)
+	templateCacheMu.RUnlock()
+	return DebugInfo{
+		App:        version.APP,
+		Version:    version.VERSION,
+		Build:      version.BuildStamp,
+		GoVersion:  runtime.Version(),
+		StartedAt:  startedAt,
+		Uptime:     time.Since(startedAt).Round(time.Second).String(),
+		Goroutines: runtime.NumGoroutine(),
+		Templates:  templates,
+		Config:     getDebugConfigInfo(site),
+		Memory: DebugMemoryInfo{
+			HeapAlloc:    m.HeapAlloc,
+			HeapInuse:    m.HeapInuse,
+			HeapObjects:  m.HeapObjects,
+			TotalAlloc:   m.TotalAlloc,
+			Sys:          m.Sys,
+			NumGC:        m.NumGC,
+			PauseTotalNs: m.PauseTotalNs,
+		},
+	}
+}
+
+// getDebugHandler returns the debug info of the config currently served as json.
+func getDebugHandler(startedAt time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, r, http.StatusOK, getDebugInfo(getLiveSite().Config, startedAt))
+	}
+}
+
+// registerDebugHandlers adds /debug and, when enabled, the pprof and expvar endpoints, all behind the admin token.
+func registerDebugHandlers(mux *http.ServeMux, site *SiteConfig, adminToken string, startedAt time.Time, l *log.Logger) {
+	mux.HandleFunc("GET "+debugPath, requireAdmin(getDebugHandler(startedAt), adminToken, l))
+	if site.Debug.Pprof {
+		mux.HandleFunc(debugPath+"/pprof/", requireAdmin(pprof.Index, adminToken, l))
+		mux.HandleFunc(debugPath+"/pprof/cmdline", requireAdmin(pprof.Cmdline, adminToken, l))
+		mux.HandleFunc(debugPath+"/pprof/profile", requireAdmin(pprof.Profile, adminToken, l))
+		mux.HandleFunc(debugPath+"/pprof/symbol", requireAdmin(pprof.Symbol, adminToken, l))
+		mux.HandleFunc(debugPath+"/pprof/trace", requireAdmin(pprof.Trace, adminToken, l))
+	}
+	if site.Debug.Expvar {
+		mux.HandleFunc("GET "+debugPath+"/vars", requireAdmin(expvar.Handler().ServeHTTP, adminToken, l))
+	}
+	l.Printf("✅ Debug endpoint enabled on %s (pprof: %v, expvar: %v)", debugPath, site.Debug.Pprof, site.Debug.Expvar)
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/render"
+)
+
+// htmlRecorder keeps a copy of the html written, so that it can be checked once the response is sent.
+type htmlRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *htmlRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *htmlRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	if strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		rec.body.Write(b)
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// Unwrap allows http.ResponseController to reach the underlying ResponseWriter.
+func (rec *htmlRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// withDevChecks logs a warning for each structural or accessibility problem of the html pages served by next,
+// it is only used in dev mode since it keeps a copy of each page.
+func withDevChecks(next http.Handler, l *log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &htmlRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.body.Len() == 0 {
+			return
+		}
+		for _, problem := range render.ValidateHTML(rec.body.Bytes()) {
+			l.Printf("⚠️ WARNING: html of %s: %s", r.URL.Path, problem)
+		}
+		for _, problem := range checkAccessibility(rec.body.Bytes()) {
+			l.Printf("⚠️ WARNING: accessibility of %s: %s", r.URL.Path, problem)
+		}
+	})
+}
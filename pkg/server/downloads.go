@@ -0,0 +1,160 @@
+package server
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// downloadQuery is the query parameter asking the static handler to send a file as an attachment, like
+// /static/docs/report.pdf?download
+const downloadQuery = "download"
+
+// DownloadFile is one file of a Downloads component.
+type DownloadFile struct {
+	Name     string
+	URL      string // the static url of the file with ?download
+	Size     string // like 1.2 MB
+	Bytes    int64
+	Modified time.Time
+	Type     string // the extension in upper case, like PDF
+	Icon     string // an emoji of the kind of file
+	Checksum string // sha256 in hex, only when the component shows the checksums
+}
+
+// DownloadsData is the normalized content of a Downloads component.
+type DownloadsData struct {
+	Files     []DownloadFile
+	Checksums bool
+}
+
+// downloadIcons gives the emoji of the files by extension, the others get downloadIconDefault.
+var downloadIcons = map[string]string{
+	".pdf": "📕", ".doc": "📝", ".docx": "📝", ".odt": "📝", ".rtf": "📝", ".txt": "📝", ".md": "📝",
+	".xls": "📊", ".xlsx": "📊", ".ods": "📊", ".csv": "📊", ".ppt": "📽️", ".pptx": "📽️", ".odp": "📽️",
+	".zip": "🗜️", ".gz": "🗜️", ".tgz": "🗜️", ".7z": "🗜️", ".rar": "🗜️", ".png": "🖼️", ".jpg": "🖼️", ".jpeg": "🖼️",
+	".gif": "🖼️", ".svg": "🖼️", ".webp": "🖼️", ".mp3": "🎵", ".ogg": "🎵", ".wav": "🎵", ".mp4": "🎬", ".webm": "🎬",
+}
+
+const downloadIconDefault = "📄"
+
+// downloadChecksums caches the sha256 of the files by path, size and modification time, so that a big file is only
+// read again when it changes.
+var downloadChecksums sync.Map
+
+// getFileChecksum returns the sha256 of the file at name in hex.
+func getFileChecksum(name string, info os.FileInfo) (string, error) {
+	key := fmt.Sprintf("%s|%d|%d", name, info.Size(), info.ModTime().UnixNano())
+	if sum, ok := downloadChecksums.Load(key); ok {
+		return sum.(string), nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("error reading %s: %w", name, err)
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	downloadChecksums.Store(key, sum)
+	return sum, nil
+}
+
+// formatFileSize returns size in bytes with a binary unit, like 1.2 MB.
+func formatFileSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// getDownloadsData builds the DownloadsData of a Downloads component from its KeyValues : the files of "dir",
+// relative to the static directory, matching the optional "glob" like "*.pdf", sorted by "sort" name (default),
+// date (the newest first) or size, with their sha256 when "checksums" is true.
+func getDownloadsData(kv map[string]interface{}, staticDir string) (*DownloadsData, error) {
+	dir := path.Clean("/" + toCellString(kv["dir"]))
+	if strings.Contains(toCellString(kv["dir"]), "..") {
+		return nil, fmt.Errorf("downloads dir '%s' should stay inside the static directory", toCellString(kv["dir"]))
+	}
+	pattern := toCellString(kv["glob"])
+	if pattern == "" {
+		pattern = "*"
+	}
+	if strings.ContainsAny(pattern, `/\`) {
+		return nil, fmt.Errorf("downloads glob '%s' should match the file names of the dir", pattern)
+	}
+	files, err := filepath.Glob(filepath.Join(staticDir, filepath.FromSlash(dir), pattern))
+	if err != nil {
+		return nil, fmt.Errorf("invalid downloads glob '%s': %w", pattern, err)
+	}
+	data := &DownloadsData{Checksums: toCellString(kv["checksums"]) == "true"}
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil || !info.Mode().IsRegular() || strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(info.Name()))
+		icon, found := downloadIcons[ext]
+		if !found {
+			icon = downloadIconDefault
+		}
+		download := DownloadFile{
+			Name:     info.Name(),
+			URL:      staticURLPrefix + strings.TrimPrefix(path.Join(dir, url.PathEscape(info.Name())), "/") + "?" + downloadQuery,
+			Size:     formatFileSize(info.Size()),
+			Bytes:    info.Size(),
+			Modified: info.ModTime(),
+			Type:     strings.ToUpper(strings.TrimPrefix(ext, ".")),
+			Icon:     icon,
+		}
+		if data.Checksums {
+			if download.Checksum, err = getFileChecksum(file, info); err != nil {
+				return nil, err
+			}
+		}
+		data.Files = append(data.Files, download)
+	}
+	switch sortBy := toCellString(kv["sort"]); sortBy {
+	case "", "name":
+		slices.SortFunc(data.Files, func(a, b DownloadFile) int { return compareCells(a.Name, b.Name) })
+	case "date":
+		slices.SortFunc(data.Files, func(a, b DownloadFile) int { return b.Modified.Compare(a.Modified) })
+	case "size":
+		slices.SortFunc(data.Files, func(a, b DownloadFile) int { return cmp.Compare(b.Bytes, a.Bytes) })
+	default:
+		return nil, fmt.Errorf("downloads sort should be name, date or size, got '%s'", sortBy)
+	}
+	return data, nil
+}
+
+// setDownloadDisposition makes the response to a ?download request an attachment named like the file, the names
+// outside of ascii are encoded as filename*.
+func setDownloadDisposition(w http.ResponseWriter, r *http.Request) {
+	if _, found := r.URL.Query()[downloadQuery]; !found {
+		return
+	}
+	name := path.Base(r.URL.Path)
+	if disposition := mime.FormatMediaType("attachment", map[string]string{"filename": name}); disposition != "" {
+		w.Header().Set("Content-Disposition", disposition)
+	}
+}
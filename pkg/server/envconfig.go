@@ -0,0 +1,164 @@
+package server
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+const envCommand = "env" // subcommand printing the effective environment settings
+
+// envSetting is one setting of the environment surface, the env variable wins over the flag which wins over the file.
+type envSetting struct {
+	Env         string
+	Flag        string // command line flag setting the env variable when it is not set, empty when there is none
+	Default     string // shown by the env subcommand, the code keeps its own default
+	Description string
+	Secret      bool // its value is masked by the env subcommand
+}
+
+// envSettings lists all the env variables read by the server, documented by the env subcommand.
+var envSettings = []envSetting{
+	{Env: "CONFIG_URL", Flag: "config", Default: defaultSiteConfigFile, Description: "path or http(s) url of the site config, the APP_ENV overlay is read next to it, - reads it from stdin and writes no file"},
+	{Env: "SCHEMA_URL", Flag: "schema", Default: defaultSchemaFile, Description: "path or http(s) url of the config json schema"},
+	{Env: "TEMPLATES_DIR", Flag: "templates", Default: defaultTemplatesDir, Description: "directory of the templates, layouts and components"},
+	{Env: "STATIC_DIR", Flag: "static", Default: defaultStaticDir, Description: "directory served as is under " + staticURLPrefix},
+	{Env: "BASE_URL", Flag: "base-url", Description: "overrides the baseURL of the config, like https://example.com/"},
+	{Env: "APP_ENV", Flag: "env", Description: "environment selecting the config overlay, dev or development enables the dev mode"},
+	{Env: "PORT", Flag: "port", Default: fmt.Sprint(defaultPort), Description: "port of the public listener when the config has no listeners"},
+	{Env: "LOG_FILE", Flag: "log", Default: defaultLogName, Description: "comma separated targets of the log: file name, stdout, stderr, DISCARD, syslog, syslog://host:514, syslog+tcp://host:601, journald or eventlog on windows, each one optionally followed by @warning or @error"},
+	{Env: "LOG_LEVEL", Flag: "log-level", Default: "", Description: "level of the log, debug, info, warn or error, followed by the levels of the config, render and http messages, like warn,render=debug, replaces the log config"},
+	{Env: "TRUSTED_PROXIES", Description: "comma separated ip addresses or cidr ranges overriding the trustedProxies of the config"},
+	{Env: "CORS_ALLOWED_ORIGINS", Description: "comma separated origins overriding the allowedOrigins of the cors config"},
+	{Env: "AUDIT_LOG", Description: "json lines file of the audit log, overriding the audit file of the config"},
+	{Env: "CONTENT_GIT_URL", Description: "git repository of the config, cloned in CONTENT_GIT_DIR where CONFIG_URL is then read", Secret: true},
+	{Env: "CONTENT_GIT_BRANCH", Description: "branch of the content repository, its default branch when empty"},
+	{Env: "CONTENT_GIT_DIR", Default: defaultContentGitDir, Description: "directory of the checkout of the content repository"},
+	{Env: "CONTENT_WEBHOOK_SECRET", Description: "secret of the push webhook of the content repository, it is disabled when empty", Secret: true},
+	{Env: "PREVIEW_DIR", Description: "directory of the configs <name>.json previewed under " + previewPathPrefix + "<name>/"},
+	{Env: "PREVIEW_GIT_BRANCHES", Description: "pattern of the branches of the content repository previewed under " + previewPathPrefix + "<branch>/, like feature/*"},
+	{Env: "TENANTS_DIR", Description: "directory of one sub-directory by tenant, with its config.json, templates and static, served for its host and under " + tenantsPathPrefix + "<name>/"},
+	{Env: "MAINTENANCE_MODE", Default: "false", Description: "true starts the server in maintenance mode, answering 503 until DELETE " + maintenancePath},
+	{Env: "SENTRY_DSN", Description: "dsn of a Sentry compatible service receiving the panics and the responses 5xx, overriding the dsn of errorReporting", Secret: true},
+	{Env: "NOTIFICATIONS_SECRET", Description: "secret of the hmac sha256 signature of the notifications sent to the webhooks, in X-JsonSiteGo-Signature"},
+	{Env: "DEV_REQUESTS", Default: fmt.Sprint(defaultRecordedRequests), Description: "number of the last requests kept in dev mode and shown by " + requestsPath + " with the admin token, 0 disables it"},
+	{Env: "UPDATE_CHECK", Description: "true to check at start whether a newer release is published on GitHub, logged and returned by " + versionPath},
+	{Env: "UPDATE_CHECK_URL", Description: "base url of the api of the update check, like a GitHub Enterprise api", Default: "https://api.github.com"},
+	{Env: "FLAGS", Description: "comma separated name=true or name=false overriding the flags of the config, like newFooter=true"},
+	{Env: "MAINTENANCE_FILE", Description: "the maintenance mode is on while this file exists, overriding the maintenance file of the config"},
+	{Env: "STORAGE_URL", Default: "memory://", Description: "runtime state storage, like file:///var/lib/jsonsitego or s3://bucket/prefix", Secret: true},
+	{Env: "S3_ENDPOINT", Description: "endpoint of an S3 compatible store of STORAGE_URL, like https://minio.example.com, AWS S3 when empty"},
+	{Env: "AWS_REGION", Default: "us-east-1", Description: "region of the S3 store and of the awssm:// secrets of AWS Secrets Manager"},
+	{Env: "AWS_ACCESS_KEY_ID", Description: "access key of the S3 store and of the awssm:// secrets", Secret: true},
+	{Env: "AWS_SECRET_ACCESS_KEY", Description: "secret key of the S3 store and of the awssm:// secrets", Secret: true},
+	{Env: "AWS_SESSION_TOKEN", Description: "session token of temporary AWS credentials, like the ones of an IAM role", Secret: true},
+	{Env: "SECRETS_URL", Description: "provider of the secret://name values of the config, none when empty: env://PREFIX_ reading the env variables of the prefix, default SECRET_, file:///run/secrets, vault://mount/prefix with VAULT_ADDR and VAULT_TOKEN, awssm://region with the AWS_* variables or gcpsm://project"},
+	{Env: "AWS_ENDPOINT_URL_SECRETS_MANAGER", Description: "endpoint of an AWS Secrets Manager compatible api of the awssm:// secrets, the one of AWS_REGION when empty"},
+	{Env: "GOOGLE_CLOUD_PROJECT", Description: "project of the gcpsm:// secrets when their url has none"},
+	{Env: "GCP_ACCESS_TOKEN", Description: "oauth access token reading the gcpsm:// secrets of Google Secret Manager", Secret: true},
+	{Env: "GCP_SECRET_MANAGER_ENDPOINT", Description: "endpoint of a Google Secret Manager compatible api of the gcpsm:// secrets"},
+	{Env: "VAULT_ADDR", Default: "http://127.0.0.1:8200", Description: "address of the HashiCorp Vault of the vault:// secrets"},
+	{Env: "VAULT_TOKEN", Description: "token reading the vault:// secrets", Secret: true},
+	{Env: "VAULT_NAMESPACE", Description: "namespace of the vault:// secrets on Vault Enterprise"},
+	{Env: "CONFIG_SECRET_KEY", Description: "base64 AES-256 key decrypting the ENC[aes256gcm,...] values of the config, made by the encrypt subcommand", Secret: true},
+	{Env: "ADMIN_TOKEN", Description: "bearer token of the admin endpoints, they are disabled when empty", Secret: true},
+	{Env: "PREVIEW_TOKEN", Description: "token allowing to preview themes, defaults to ADMIN_TOKEN", Secret: true},
+	{Env: "CDN_PURGE_TOKEN", Description: "api token purging the cdn of the config, Fastly key or Cloudflare bearer token", Secret: true},
+	{Env: "OIDC_CLIENT_SECRET", Description: "client secret of the auth clientID at the OpenID Connect provider, overriding its clientSecret", Secret: true},
+	{Env: "SESSION_SECRET", Description: "key signing the login session cookies, without it a generated key is kept in the STORAGE_URL store, ending the sessions at restart only with the memory store", Secret: true},
+	{Env: "COOKIE_SECRET", Description: "key signing the theme and flash cookies, defaults to SESSION_SECRET, then to the generated key kept in the STORAGE_URL store", Secret: true},
+	{Env: "JWT_SECRET", Description: "shared secret verifying the HS256 bearer tokens", Secret: true},
+	{Env: "CHROME_PATH", Description: "headless Chrome used for the pdf exports, searched in the PATH when empty"},
+	{Env: "SMTP_HOST", Description: "smtp server of the emails when the config has no mail transport"},
+	{Env: "SMTP_PORT", Default: "587", Description: "port of the smtp server"},
+	{Env: "SMTP_FROM", Description: "sender address of the emails when the config has no mail transport"},
+	{Env: "SMTP_USER", Description: "smtp user, no authentication when empty"},
+	{Env: "SMTP_TLS", Description: "required to refuse sending when the smtp server does not offer STARTTLS"},
+	{Env: "SMTP_PASSWORD", Description: "smtp password, also of the smtp transport of the mail config, overriding its password", Secret: true},
+	{Env: "READ_TIMEOUT", Default: defaultReadTimeout.String(), Description: "overrides server.readTimeout of the config"},
+	{Env: "WRITE_TIMEOUT", Default: defaultWriteTimeout.String(), Description: "overrides server.writeTimeout of the config"},
+	{Env: "IDLE_TIMEOUT", Default: defaultIdleTimeout.String(), Description: "overrides server.idleTimeout of the config"},
+	{Env: "READ_HEADER_TIMEOUT", Default: defaultReadHeaderTimeout.String(), Description: "overrides server.readHeaderTimeout of the config"},
+	{Env: "MAX_HEADER_BYTES", Default: fmt.Sprint(defaultMaxHeaderBytes), Description: "overrides server.maxHeaderBytes of the config"},
+	{Env: "MAX_BODY_BYTES", Default: fmt.Sprint(defaultMaxBodyBytes), Description: "overrides server.maxBodyBytes of the config"},
+	{Env: "MAX_CONNECTIONS", Description: "overrides server.maxConnections of the config"},
+	{Env: "MAX_CONNECTIONS_PER_IP", Description: "overrides server.maxConnectionsPerIP of the config"},
+}
+
+// parseFlagsToEnv parses the command line flags with fs, which may define its own flags, and copies the ones given
+// into their env variable when it is not set, so that the env variables win over the flags.
+// it returns the env variables set from a flag.
+func parseFlagsToEnv(fs *flag.FlagSet, args []string) (map[string]bool, error) {
+	values := make(map[string]*string)
+	for _, setting := range envSettings {
+		if setting.Flag != "" {
+			values[setting.Flag] = fs.String(setting.Flag, "", fmt.Sprintf("%s (env %s)", setting.Description, setting.Env))
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	fromFlags := make(map[string]bool)
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		for _, setting := range envSettings {
+			if setting.Flag != f.Name {
+				continue
+			}
+			if _, exist := os.LookupEnv(setting.Env); !exist {
+				if e := os.Setenv(setting.Env, *values[f.Name]); e != nil && err == nil {
+					err = e
+				}
+				fromFlags[setting.Env] = true
+			}
+		}
+	})
+	return fromFlags, err
+}
+
+// getEnvOrDefault returns the value of the env variable env, or defaultValue when it is not set or empty.
+func getEnvOrDefault(env, defaultValue string) string {
+	if val := strings.TrimSpace(os.Getenv(env)); val != "" {
+		return val
+	}
+	return defaultValue
+}
+
+// applyEnvOverrides replaces the config values having an env variable, like BASE_URL.
+func applyEnvOverrides(config *SiteConfig) {
+	if baseURL := strings.TrimSpace(os.Getenv("BASE_URL")); baseURL != "" {
+		config.BaseURL = baseURL
+	}
+}
+
+// printEnvSettings writes the effective value of each env setting with where it comes from : env, flag, file or default.
+func printEnvSettings(w io.Writer, fromFlags map[string]bool) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VARIABLE\tFLAG\tVALUE\tSOURCE\tDESCRIPTION")
+	for _, setting := range envSettings {
+		value, source := setting.Default, "default"
+		if val, exist := os.LookupEnv(setting.Env); exist {
+			value, source = val, "env"
+			if fromFlags[setting.Env] {
+				source = "flag"
+			}
+		} else if setting.Env == "BASE_URL" {
+			value, source = "baseURL of the config", "file"
+		}
+		if setting.Secret && value != "" && source != "default" {
+			value = "********"
+		}
+		if value == "" {
+			value = "-"
+		}
+		flagName := "-"
+		if setting.Flag != "" {
+			flagName = "-" + setting.Flag
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", setting.Env, flagName, value, source, setting.Description)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,332 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	siteconfig "github.com/lao-tseu-is-alive/JsonSiteGo/pkg/config"
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/version"
+)
+
+const (
+	errorReportsPerMinute = 30 // the reports beyond are dropped, so that an outage does not flood the service
+	errorReportTimeout    = 10 * time.Second
+	sentryProtocolVersion = "7"
+	errorReportEvent      = "error.reported" // X-JsonSiteGo-Event of the webhook
+	maxStackFrames        = 50
+)
+
+// ErrorReportingConfig forwards the panics and the responses 5xx, with the error of the template or of the handler
+// behind them, to a Sentry compatible service and/or a webhook.
+type ErrorReportingConfig struct {
+	DSN         string `json:"dsn,omitempty"`         // like https://key@o1.ingest.sentry.io/42, overridden by env SENTRY_DSN
+	Webhook     string `json:"webhook,omitempty"`     // receives the event json, signed like the notifications
+	Environment string `json:"environment,omitempty"` // env APP_ENV by default
+}
+
+// sentryDSN is the parsed dsn of a Sentry compatible service.
+type sentryDSN struct {
+	raw       string
+	publicKey string
+	envelope  string // url of the envelope endpoint of the project
+}
+
+// parseSentryDSN parses a dsn like https://key@host/path/project.
+func parseSentryDSN(raw string) (*sentryDSN, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User.Username() == "" {
+		return nil, fmt.Errorf("a dsn is like https://key@host/project")
+	}
+	dir, project := "", strings.TrimPrefix(u.Path, "/")
+	if i := strings.LastIndex(project, "/"); i >= 0 {
+		dir, project = "/"+project[:i], project[i+1:]
+	}
+	if project == "" {
+		return nil, fmt.Errorf("the dsn has no project id")
+	}
+	return &sentryDSN{raw: raw, publicKey: u.User.Username(), envelope: fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, dir, project)}, nil
+}
+
+// getErrorReportingDSN returns the dsn of env SENTRY_DSN, else the one of config.
+func getErrorReportingDSN(config *ErrorReportingConfig) string {
+	if val, exist := os.LookupEnv("SENTRY_DSN"); exist {
+		return strings.TrimSpace(val)
+	}
+	if config == nil {
+		return ""
+	}
+	return config.DSN
+}
+
+// validateErrorReporting checks the dsn and the url of the webhook.
+func validateErrorReporting(config *SiteConfig) []ConfigError {
+	if config.ErrorReporting == nil {
+		return nil
+	}
+	var problems []ConfigError
+	if dsn := config.ErrorReporting.DSN; dsn != "" {
+		if _, err := parseSentryDSN(dsn); err != nil {
+			problems = append(problems, ConfigError{Pointer: "/errorReporting/dsn", Value: dsn, Message: fmt.Sprintf("invalid dsn: %v", err)})
+		}
+	}
+	if webhook := config.ErrorReporting.Webhook; webhook != "" && !strings.HasPrefix(webhook, "http://") && !strings.HasPrefix(webhook, "https://") {
+		problems = append(problems, ConfigError{Pointer: "/errorReporting/webhook", Value: webhook, Message: "the webhook needs an http(s) url"})
+	}
+	return problems
+}
+
+// ErrorEvent is an event in the format of Sentry, also sent to the webhook.
+type ErrorEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Platform    string            `json:"platform"`
+	Level       string            `json:"level"` // error, or fatal for a panic
+	Logger      string            `json:"logger"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Release     string            `json:"release"`
+	Environment string            `json:"environment,omitempty"`
+	Tags        map[string]string `json:"tags"`
+	Exception   struct {
+		Values []ErrorException `json:"values"`
+	} `json:"exception"`
+	Request struct {
+		URL     string            `json:"url"`
+		Method  string            `json:"method"`
+		Headers map[string]string `json:"headers,omitempty"`
+	} `json:"request"`
+}
+
+// ErrorException is the error of an event, with the stack of a panic.
+type ErrorException struct {
+	Type       string `json:"type"`
+	Value      string `json:"value"`
+	Stacktrace *struct {
+		Frames []ErrorFrame `json:"frames"`
+	} `json:"stacktrace,omitempty"`
+}
+
+// ErrorFrame is a call of the stack of a panic, the oldest first like Sentry wants them.
+type ErrorFrame struct {
+	Function string `json:"function"`
+	Filename string `json:"filename"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+// requestErrorKey is the context key of the error behind the response of a request, reported with its status.
+type requestErrorKey struct{}
+
+// requestError holds the error recorded by the handler of a request.
+type requestError struct {
+	err error
+}
+
+// recordRequestError keeps err as the cause of the response 5xx of r, when its errors are reported.
+func recordRequestError(r *http.Request, err error) {
+	if holder, ok := r.Context().Value(requestErrorKey{}).(*requestError); ok && holder.err == nil {
+		holder.err = err
+	}
+}
+
+// errorReportsLimit counts the reports of the current minute.
+var errorReportsLimit = struct {
+	mu    sync.Mutex
+	start time.Time
+	count int
+}{}
+
+// allowErrorReport reports whether the limit of reports per minute is not reached yet.
+func allowErrorReport() bool {
+	errorReportsLimit.mu.Lock()
+	defer errorReportsLimit.mu.Unlock()
+	if now := time.Now(); now.Sub(errorReportsLimit.start) >= time.Minute {
+		errorReportsLimit.start, errorReportsLimit.count = now, 0
+	}
+	errorReportsLimit.count++
+	return errorReportsLimit.count <= errorReportsPerMinute
+}
+
+// withErrorReporting reports the panics and the responses 5xx of next, other than 503, to the service of the error
+// reporting config. a panic is answered with a 500 when nothing was sent yet.
+func withErrorReporting(next http.Handler, config *SiteConfig, l *log.Logger) http.Handler {
+	dsnValue := getErrorReportingDSN(config.ErrorReporting)
+	var dsn *sentryDSN
+	if dsnValue != "" {
+		var err error
+		if dsn, err = parseSentryDSN(dsnValue); err != nil {
+			l.Printf("⚠️ WARNING: env SENTRY_DSN is invalid, the errors are not sent to it: %v", err)
+		}
+	}
+	webhook := ""
+	if config.ErrorReporting != nil {
+		webhook = config.ErrorReporting.Webhook
+	}
+	if dsn == nil && webhook == "" {
+		return next
+	}
+	environment := siteconfig.AppEnv()
+	if config.ErrorReporting != nil && config.ErrorReporting.Environment != "" {
+		environment = config.ErrorReporting.Environment
+	}
+	report := func(r *http.Request, status int, err error, level string, frames []ErrorFrame) {
+		if !allowErrorReport() {
+			return
+		}
+		event := newErrorEvent(r, status, err, level, frames, environment)
+		go sendErrorEvent(event, dsn, webhook, l)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		holder := &requestError{}
+		outer := r
+		r = r.WithContext(context.WithValue(r.Context(), requestErrorKey{}, holder))
+		// the mux fills the pattern of the request with the holder, the middlewares around like the metrics read it
+		defer func() { outer.Pattern = r.Pattern }()
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			if p := recover(); p != nil {
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				l.Printf("💥💥 panic serving %s %s: %v", r.Method, r.URL.Path, p)
+				report(r, http.StatusInternalServerError, fmt.Errorf("panic: %v", p), "fatal", getPanicFrames())
+				if rec.status != 0 {
+					// the response is already started, like net/http the connection is closed
+					panic(http.ErrAbortHandler)
+				}
+				http.Error(rec, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(rec, r)
+		if rec.status >= http.StatusInternalServerError && rec.status != http.StatusServiceUnavailable {
+			err := holder.err
+			if err == nil {
+				err = fmt.Errorf("response %d %s", rec.status, http.StatusText(rec.status))
+			}
+			report(r, rec.status, err, "error", nil)
+		}
+	})
+}
+
+// getPanicFrames returns the stack of the panic being recovered, the oldest call first.
+func getPanicFrames() []ErrorFrame {
+	pcs := make([]uintptr, maxStackFrames)
+	// skip runtime.Callers, getPanicFrames and the deferred function
+	n := runtime.Callers(3, pcs)
+	callers := runtime.CallersFrames(pcs[:n])
+	var frames []ErrorFrame
+	for {
+		frame, more := callers.Next()
+		frames = append(frames, ErrorFrame{Function: frame.Function, Filename: frame.File, Lineno: frame.Line,
+			InApp: strings.Contains(frame.Function, "/JsonSiteGo/")})
+		if !more {
+			break
+		}
+	}
+	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+		frames[i], frames[j] = frames[j], frames[i]
+	}
+	return frames
+}
+
+// newErrorEvent returns the event of err for the response status of r.
+func newErrorEvent(r *http.Request, status int, err error, level string, frames []ErrorFrame, environment string) *ErrorEvent {
+	id := make([]byte, 16)
+	rand.Read(id)
+	event := &ErrorEvent{
+		EventID:     hex.EncodeToString(id),
+		Timestamp:   time.Now().UTC().Format(time.RFC3339),
+		Platform:    "go",
+		Level:       level,
+		Logger:      version.APP,
+		Release:     version.APP + "@" + version.VERSION,
+		Environment: environment,
+		Tags: map[string]string{
+			"app":       version.APP,
+			"version":   version.VERSION,
+			"revision":  version.REVISION,
+			"status":    strconv.Itoa(status),
+			"route":     r.Pattern,
+			"requestID": getRequestID(r),
+		},
+	}
+	event.ServerName, _ = os.Hostname()
+	exception := ErrorException{Type: fmt.Sprintf("HTTP %d", status), Value: err.Error()}
+	if len(frames) > 0 {
+		exception.Type = "panic"
+		exception.Stacktrace = &struct {
+			Frames []ErrorFrame `json:"frames"`
+		}{Frames: frames}
+	}
+	event.Exception.Values = []ErrorException{exception}
+	event.Request.URL = getRequestScheme(r) + "://" + r.Host + r.URL.RequestURI()
+	event.Request.Method = r.Method
+	event.Request.Headers = map[string]string{}
+	for _, name := range []string{"User-Agent", "Referer", "Accept-Language"} {
+		if value := r.Header.Get(name); value != "" {
+			event.Request.Headers[name] = value
+		}
+	}
+	return event
+}
+
+// sendErrorEvent sends event to the envelope endpoint of dsn and to webhook.
+func sendErrorEvent(event *ErrorEvent, dsn *sentryDSN, webhook string, l *log.Logger) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		l.Printf("💥 error encoding the error event: %v", err)
+		return
+	}
+	if dsn != nil {
+		if err := postSentryEnvelope(dsn, event.EventID, body); err != nil {
+			l.Printf("💥 error sending the error event %s: %v", event.EventID, err)
+		}
+	}
+	if webhook != "" {
+		if _, err := postNotification(webhook, body, errorReportEvent, event.EventID, os.Getenv("NOTIFICATIONS_SECRET")); err != nil {
+			l.Printf("💥 error sending the error event %s to %s: %v", event.EventID, webhook, err)
+		}
+	}
+}
+
+// postSentryEnvelope posts the event json in an envelope, the format of the Sentry ingestion api.
+func postSentryEnvelope(dsn *sentryDSN, eventID string, event []byte) error {
+	var envelope bytes.Buffer
+	header, _ := json.Marshal(map[string]string{"event_id": eventID, "dsn": dsn.raw, "sent_at": time.Now().UTC().Format(time.RFC3339)})
+	envelope.Write(header)
+	fmt.Fprintf(&envelope, "\n{\"type\":\"event\",\"length\":%d}\n", len(event))
+	envelope.Write(event)
+	envelope.WriteString("\n")
+	ctx, cancel := context.WithTimeout(context.Background(), errorReportTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dsn.envelope, &envelope)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", fmt.Sprintf("Sentry sentry_version=%s, sentry_client=%s/%s, sentry_key=%s", sentryProtocolVersion, version.APP, version.VERSION, dsn.publicKey))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned status %s", dsn.envelope, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const eventsICSPath = "/events.ics"
+
+// Event is an entry of the events of the site, listed by the Events component and exported in /events.ics.
+type Event struct {
+	Title       string     `json:"title"`
+	Start       time.Time  `json:"start"`                 // like 2026-11-05T19:00:00+01:00, or the day of an all day event
+	End         *time.Time `json:"end,omitempty"`         // optional, the last day of an all day event
+	AllDay      bool       `json:"allDay,omitempty"`      // only the dates of start and end are used
+	Location    string     `json:"location,omitempty"`    // like the address of the venue
+	Description string     `json:"description,omitempty"` // plain text
+	URL         string     `json:"url,omitempty"`         // page of the event, on the site or elsewhere
+}
+
+// EventsData is what the Events component renders.
+type EventsData struct {
+	Events []Event
+	Past   bool // the events are the past ones, the most recent first
+	ICS    string
+}
+
+// validateEvents checks each event has a title, a start, an end after it and a valid url.
+func validateEvents(config *SiteConfig) []ConfigError {
+	var problems []ConfigError
+	if len(config.Events) > 0 {
+		for i, page := range config.Pages {
+			if parts := strings.Fields(page.Route); page.CreateHandler && len(parts) > 1 && parts[1] == eventsICSPath {
+				problems = append(problems, ConfigError{Pointer: fmt.Sprintf("/pages/%d/route", i), Value: page.Route, Message: "the route is already the calendar of the events"})
+			}
+		}
+	}
+	for i, event := range config.Events {
+		pointer := fmt.Sprintf("/events/%d", i)
+		if strings.TrimSpace(event.Title) == "" {
+			problems = append(problems, ConfigError{Pointer: pointer + "/title", Message: "the event needs a title"})
+		}
+		if event.Start.IsZero() {
+			problems = append(problems, ConfigError{Pointer: pointer + "/start", Value: event.Title, Message: "the event needs a start"})
+		}
+		if event.End != nil && event.End.Before(event.Start) {
+			problems = append(problems, ConfigError{Pointer: pointer + "/end", Value: event.End.Format(time.RFC3339), Message: "the end of the event is before its start"})
+		}
+		if event.URL != "" {
+			if u, err := url.Parse(event.URL); err != nil || (!u.IsAbs() && !strings.HasPrefix(event.URL, "/")) {
+				problems = append(problems, ConfigError{Pointer: pointer + "/url", Value: event.URL, Message: "the url must be absolute or a path of the site"})
+			}
+		}
+	}
+	return problems
+}
+
+// getEventEnd returns the time an event ends: its end, the day after the last day of an all day event, else its start.
+func getEventEnd(event Event) time.Time {
+	end := event.Start
+	if event.End != nil {
+		end = *event.End
+	}
+	if event.AllDay {
+		y, m, d := end.Date()
+		return time.Date(y, m, d+1, 0, 0, 0, 0, end.Location())
+	}
+	return end
+}
+
+// getEventsData builds the EventsData of an Events component from its KeyValues : "past" lists the events already
+// ended instead of the upcoming ones, "limit" keeps the first ones.
+func getEventsData(kv map[string]interface{}, events []Event, now time.Time) (*EventsData, error) {
+	data := &EventsData{Past: toCellString(kv["past"]) == "true", ICS: eventsICSPath}
+	for _, event := range events {
+		if getEventEnd(event).After(now) != data.Past {
+			data.Events = append(data.Events, event)
+		}
+	}
+	slices.SortStableFunc(data.Events, func(a, b Event) int {
+		if data.Past {
+			return b.Start.Compare(a.Start)
+		}
+		return a.Start.Compare(b.Start)
+	})
+	if raw, found := kv["limit"]; found {
+		limit, err := toFloat(raw)
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("events limit should be a positive number, got %v", raw)
+		}
+		if int(limit) < len(data.Events) {
+			data.Events = data.Events[:int(limit)]
+		}
+	}
+	return data, nil
+}
+
+// icsEscaper escapes the text values of the iCalendar format (RFC 5545).
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// writeICSLine writes a content line folded at 75 octets, without splitting an utf-8 character.
+func writeICSLine(buf *bytes.Buffer, line string) {
+	for len(line) > 75 {
+		cut := 75
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		buf.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+	}
+	buf.WriteString(line + "\r\n")
+}
+
+// generateICS returns the iCalendar file of the events of the site. the uid of an event is derived from its title
+// and start, so that the calendars subscribed update it until one of them changes.
+func generateICS(config *SiteConfig, now time.Time) []byte {
+	host := "jsonsitego"
+	if base, err := url.Parse(config.BaseURL); err == nil && base.Hostname() != "" {
+		host = base.Hostname()
+	}
+	var buf bytes.Buffer
+	writeICSLine(&buf, "BEGIN:VCALENDAR")
+	writeICSLine(&buf, "VERSION:2.0")
+	writeICSLine(&buf, "PRODID:-//JsonSiteGo//Events//EN")
+	writeICSLine(&buf, "CALSCALE:GREGORIAN")
+	writeICSLine(&buf, "X-WR-CALNAME:"+icsEscaper.Replace(config.Title))
+	for _, event := range config.Events {
+		sum := sha256.Sum256([]byte(event.Title + "\n" + event.Start.Format(time.RFC3339)))
+		writeICSLine(&buf, "BEGIN:VEVENT")
+		writeICSLine(&buf, "UID:"+hex.EncodeToString(sum[:12])+"@"+host)
+		writeICSLine(&buf, "DTSTAMP:"+now.UTC().Format("20060102T150405Z"))
+		if event.AllDay {
+			writeICSLine(&buf, "DTSTART;VALUE=DATE:"+event.Start.Format("20060102"))
+			writeICSLine(&buf, "DTEND;VALUE=DATE:"+getEventEnd(event).Format("20060102"))
+		} else {
+			writeICSLine(&buf, "DTSTART:"+event.Start.UTC().Format("20060102T150405Z"))
+			if event.End != nil {
+				writeICSLine(&buf, "DTEND:"+event.End.UTC().Format("20060102T150405Z"))
+			}
+		}
+		writeICSLine(&buf, "SUMMARY:"+icsEscaper.Replace(event.Title))
+		if event.Location != "" {
+			writeICSLine(&buf, "LOCATION:"+icsEscaper.Replace(event.Location))
+		}
+		if event.Description != "" {
+			writeICSLine(&buf, "DESCRIPTION:"+icsEscaper.Replace(event.Description))
+		}
+		if event.URL != "" {
+			eventURL := event.URL
+			if strings.HasPrefix(eventURL, "/") && config.BaseURL != "" {
+				eventURL = strings.TrimSuffix(config.BaseURL, "/") + eventURL
+			}
+			writeICSLine(&buf, "URL:"+eventURL)
+		}
+		writeICSLine(&buf, "END:VEVENT")
+	}
+	writeICSLine(&buf, "END:VCALENDAR")
+	return buf.Bytes()
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	jsonsitego "github.com/lao-tseu-is-alive/JsonSiteGo"
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/version"
+)
+
+const exampleCommand = "example" // subcommand writing the embedded example site and serving it
+
+// writeExampleSite writes the files of the embedded example site in dir, an existing file is only replaced with
+// force. the files are checked first, so that nothing is written when one of them exists.
+func writeExampleSite(dir string, force bool) ([]string, error) {
+	var files []string
+	err := fs.WalkDir(jsonsitego.ExampleSite, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		files = append(files, path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !force {
+		for _, file := range files {
+			if _, err := os.Stat(filepath.Join(dir, file)); err == nil {
+				return nil, fmt.Errorf("%s already exists, use -force to replace the files of the example", filepath.Join(dir, file))
+			}
+		}
+	}
+	for _, file := range files {
+		data, err := jsonsitego.ExampleSite.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		target := filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(target, data, 0o644); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// runExample is the example subcommand : it writes the example site in -dir and, unless -no-run, points the env
+// variables of the server at its files. it returns the exit code of the process and whether the server should run.
+func runExample(args []string) (int, bool) {
+	flags := flag.NewFlagSet(version.APP+" "+exampleCommand, flag.ContinueOnError)
+	dir := flags.String("dir", ".", "directory where the example site is written, created when needed")
+	force := flags.Bool("force", false, "replace the files of the directory having the name of a file of the example")
+	noRun := flags.Bool("no-run", false, "only write the files, without serving them")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s %s [flags]\n", version.APP, exampleCommand)
+		flags.PrintDefaults()
+	}
+	if _, err := parseFlagsToEnv(flags, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0, false
+		}
+		return 2, false
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2, false
+	}
+	files, err := writeExampleSite(*dir, *force)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "💥💥 error writing the example site: %v\n", err)
+		return 1, false
+	}
+	fmt.Printf("✅ example site of %d files written in %s, its pages are in %s\n", len(files), *dir, filepath.Join(*dir, defaultSiteConfigFile))
+	if *noRun {
+		return 0, false
+	}
+	// the server reads the favicon and the files of the config in its working directory
+	if err := os.Chdir(*dir); err != nil {
+		fmt.Fprintf(os.Stderr, "💥💥 error entering %s: %v\n", *dir, err)
+		return 1, false
+	}
+	for env, value := range map[string]string{"CONFIG_URL": defaultSiteConfigFile, "SCHEMA_URL": "config.schema.json", "TEMPLATES_DIR": defaultTemplatesDir} {
+		os.Setenv(env, value)
+	}
+	fmt.Printf("INFO: serving the example site on http://localhost:%d/\n", getPortFromEnvOrPanic(defaultPort))
+	return 0, true
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	experimentCookiePrefix = "exp_"            // followed by the name of the experiment
+	experimentCookieMaxAge = 90 * 24 * 60 * 60 // a visitor keeps its variant for 90 days
+	experimentVariantParam = "variant"         // query parameter showing a variant without assigning it, to review it
+)
+
+// experimentNameRegex are the names of the experiments and of their variants, used in the cookies and the metrics.
+var experimentNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Experiment is an A/B test of a page: each visitor is assigned one of its variants, by weight, remembered by a
+// signed cookie, and each page shown is logged and counted as an exposure of the variant.
+type Experiment struct {
+	Name     string              `json:"name"`     // in the cookie, the log and the metrics, unique in the site
+	Variants []ExperimentVariant `json:"variants"` // at least two, the first one is usually the page as it is
+}
+
+// ExperimentVariant replaces the title, the template or the content blocks of the page for its visitors.
+type ExperimentVariant struct {
+	Name          string         `json:"name"`
+	Weight        *int           `json:"weight,omitempty"`         // share of the visitors, relative to the other variants, 1 by default
+	Title         string         `json:"title,omitempty"`          // replaces the title of the page
+	Template      string         `json:"template,omitempty"`       // replaces the template of the page
+	CustomContent []ContentBlock `json:"custom_content,omitempty"` // replaces the content blocks of the page
+}
+
+// getWeight returns the weight of the variant, 1 when it is not set.
+func (v *ExperimentVariant) getWeight() int {
+	if v.Weight == nil {
+		return 1
+	}
+	return *v.Weight
+}
+
+// validateExperiments checks the names of the experiments are unique, and that each one has at least two variants
+// with unique names and a weight, one of them at least not zero.
+func validateExperiments(config *SiteConfig) []ConfigError {
+	var problems []ConfigError
+	seen := make(map[string]bool)
+	for i, page := range config.Pages {
+		experiment := page.Experiment
+		if experiment == nil {
+			continue
+		}
+		pointer := fmt.Sprintf("/pages/%d/experiment", i)
+		if !experimentNameRegex.MatchString(experiment.Name) {
+			problems = append(problems, ConfigError{Pointer: pointer + "/name", Value: experiment.Name, Message: "the name of an experiment must be lowercase letters, digits, _ and -"})
+		} else if seen[experiment.Name] {
+			problems = append(problems, ConfigError{Pointer: pointer + "/name", Value: experiment.Name, Message: "another page has an experiment with this name"})
+		}
+		seen[experiment.Name] = true
+		if len(experiment.Variants) < 2 {
+			problems = append(problems, ConfigError{Pointer: pointer + "/variants", Value: len(experiment.Variants), Message: "an experiment needs at least two variants"})
+		}
+		if !page.CreateHandler || !strings.HasPrefix(page.Route, http.MethodGet+" ") {
+			problems = append(problems, ConfigError{Pointer: pointer, Value: page.Route, Message: "an experiment needs a page with a GET handler"})
+		}
+		total := 0
+		var names []string
+		for j, variant := range experiment.Variants {
+			variantPointer := fmt.Sprintf("%s/variants/%d", pointer, j)
+			if !experimentNameRegex.MatchString(variant.Name) {
+				problems = append(problems, ConfigError{Pointer: variantPointer + "/name", Value: variant.Name, Message: "the name of a variant must be lowercase letters, digits, _ and -"})
+			} else if slices.Contains(names, variant.Name) {
+				problems = append(problems, ConfigError{Pointer: variantPointer + "/name", Value: variant.Name, Message: "another variant of the experiment has this name"})
+			}
+			names = append(names, variant.Name)
+			if variant.getWeight() < 0 {
+				problems = append(problems, ConfigError{Pointer: variantPointer + "/weight", Value: variant.getWeight(), Message: "the weight of a variant cannot be negative"})
+			}
+			total += max(variant.getWeight(), 0)
+		}
+		if len(experiment.Variants) > 0 && total == 0 {
+			problems = append(problems, ConfigError{Pointer: pointer + "/variants", Message: "the weight of one variant at least must not be zero"})
+		}
+	}
+	return problems
+}
+
+// variantBlocks are the content blocks of a variant, with the json pointer of their list.
+type variantBlocks struct {
+	Pointer string
+	Blocks  []ContentBlock
+}
+
+// getVariantBlocks returns the content blocks of the variants of the experiment of the page at index, the checks
+// of the blocks of the pages apply to them too.
+func getVariantBlocks(page *Page, index int) []variantBlocks {
+	if page.Experiment == nil {
+		return nil
+	}
+	var blocks []variantBlocks
+	for j, variant := range page.Experiment.Variants {
+		if variant.CustomContent != nil {
+			blocks = append(blocks, variantBlocks{Pointer: fmt.Sprintf("/pages/%d/experiment/variants/%d/custom_content", index, j), Blocks: variant.CustomContent})
+		}
+	}
+	return blocks
+}
+
+// getVariantTemplateKey returns the key of the template of the variant in the cached templates.
+func getVariantTemplateKey(page *Page, variant *ExperimentVariant) string {
+	return page.Route + "#" + variant.Name
+}
+
+// getVariantPage returns page with the title, template and content blocks of variant.
+func getVariantPage(page *Page, variant *ExperimentVariant) Page {
+	variantPage := *page
+	if variant.Title != "" {
+		variantPage.Title = variant.Title
+	}
+	if variant.Template != "" {
+		// a template replaces the content blocks, like on a page
+		variantPage.Template, variantPage.CustomContent = variant.Template, nil
+	}
+	if variant.CustomContent != nil {
+		variantPage.CustomContent = variant.CustomContent
+	}
+	return variantPage
+}
+
+// getExperimentVariant returns the variant of the experiment shown for r: the one of the variant query parameter,
+// else the one of the cookie of the visitor, else one drawn by weight. assigned is true when the visitor has just
+// been assigned the variant and reviewed when it was chosen by the query parameter.
+func getExperimentVariant(r *http.Request, experiment *Experiment) (variant *ExperimentVariant, assigned, reviewed bool) {
+	find := func(name string) *ExperimentVariant {
+		for i := range experiment.Variants {
+			if experiment.Variants[i].Name == name {
+				return &experiment.Variants[i]
+			}
+		}
+		return nil
+	}
+	if variant := find(r.URL.Query().Get(experimentVariantParam)); variant != nil {
+		return variant, false, true
+	}
+	if name, found := getSignedCookie(r, experimentCookiePrefix+experiment.Name); found {
+		// a variant removed from the config, or whose weight is now zero, is assigned again
+		if variant := find(name); variant != nil && variant.getWeight() > 0 {
+			return variant, false, false
+		}
+	}
+	total := 0
+	for i := range experiment.Variants {
+		total += max(experiment.Variants[i].getWeight(), 0)
+	}
+	n := rand.IntN(total)
+	for i := range experiment.Variants {
+		n -= max(experiment.Variants[i].getWeight(), 0)
+		if n < 0 {
+			return &experiment.Variants[i], true, false
+		}
+	}
+	return &experiment.Variants[len(experiment.Variants)-1], true, false
+}
+
+// setExperimentCookie remembers the variant assigned to the visitor.
+func setExperimentCookie(w http.ResponseWriter, r *http.Request, site *SiteConfig, experiment *Experiment, variant *ExperimentVariant) {
+	setSignedCookie(w, r, site, &http.Cookie{Name: experimentCookiePrefix + experiment.Name, Value: variant.Name, Path: "/",
+		MaxAge: experimentCookieMaxAge, HttpOnly: true})
+}
+
+// experimentExposureKey identifies the counter of the exposures of a variant.
+type experimentExposureKey struct {
+	Experiment string
+	Variant    string
+}
+
+// experimentExposures counts the pages shown with each variant, exported by the metrics endpoint.
+var experimentExposures = struct {
+	mu     sync.Mutex
+	counts map[experimentExposureKey]int64
+}{counts: make(map[experimentExposureKey]int64)}
+
+// logExperimentExposure logs and counts the page shown with variant, the log line is the exposure event of the
+// analysis, with the request id to join it with the conversions.
+func logExperimentExposure(r *http.Request, experiment *Experiment, variant *ExperimentVariant, assigned bool, l *log.Logger) {
+	experimentExposures.mu.Lock()
+	experimentExposures.counts[experimentExposureKey{Experiment: experiment.Name, Variant: variant.Name}]++
+	experimentExposures.mu.Unlock()
+	l.Printf("experiment exposure: experiment=%s variant=%s assigned=%t path=%s request=%s", experiment.Name, variant.Name, assigned, r.URL.Path, getRequestID(r))
+}
+
+// writeExperimentMetrics writes the exposures of the variants in the Prometheus text format.
+func writeExperimentMetrics(w *bytes.Buffer) {
+	experimentExposures.mu.Lock()
+	defer experimentExposures.mu.Unlock()
+	if len(experimentExposures.counts) == 0 {
+		return
+	}
+	keys := make([]experimentExposureKey, 0, len(experimentExposures.counts))
+	for key := range experimentExposures.counts {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b experimentExposureKey) int {
+		return strings.Compare(a.Experiment+"\n"+a.Variant, b.Experiment+"\n"+b.Variant)
+	})
+	fmt.Fprintln(w, "# HELP jsonsitego_experiment_exposures_total Pages shown per experiment and variant.")
+	fmt.Fprintln(w, "# TYPE jsonsitego_experiment_exposures_total counter")
+	for _, key := range keys {
+		fmt.Fprintf(w, "jsonsitego_experiment_exposures_total{experiment=%s,variant=%s} %d\n", strconv.Quote(key.Experiment), strconv.Quote(key.Variant), experimentExposures.counts[key])
+	}
+}
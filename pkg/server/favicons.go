@@ -0,0 +1,192 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/gif"  // register the gif decoder for the favicon source
+	_ "image/jpeg" // register the jpeg decoder for the favicon source
+	"image/png"
+	"net/http"
+	"os"
+	"time"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	defaultThemeColor      = "#ffffff"
+	defaultBackgroundColor = "#ffffff"
+	manifestPath           = "/site.webmanifest"
+)
+
+// generatedFile is a file built at startup and served from memory.
+type generatedFile struct {
+	ContentType string
+	Data        []byte
+}
+
+// faviconPNGs are the png icons generated from the favicon source, by url path.
+var faviconPNGs = []struct {
+	Path string
+	Size int
+}{
+	{"/favicon-16x16.png", 16},
+	{"/favicon-32x32.png", 32},
+	{"/apple-touch-icon.png", 180},
+	{"/android-chrome-192x192.png", 192},
+	{"/android-chrome-512x512.png", 512},
+}
+
+// faviconICOSizes are the sizes embedded in /favicon.ico
+var faviconICOSizes = []int{16, 32, 48}
+
+// webManifest is the subset of the web app manifest we generate.
+type webManifest struct {
+	Name            string                `json:"name"`
+	ShortName       string                `json:"short_name"`
+	Description     string                `json:"description,omitempty"`
+	Lang            string                `json:"lang,omitempty"`
+	StartURL        string                `json:"start_url"`
+	Display         string                `json:"display"`
+	ThemeColor      string                `json:"theme_color"`
+	BackgroundColor string                `json:"background_color"`
+	Icons           []webManifestIconInfo `json:"icons"`
+}
+
+type webManifestIconInfo struct {
+	Src   string `json:"src"`
+	Sizes string `json:"sizes"`
+	Type  string `json:"type"`
+}
+
+// getThemeColor returns the theme color of the site, used by the browsers to color their interface.
+func getThemeColor(site *SiteConfig) string {
+	if site.ThemeColor != "" {
+		return site.ThemeColor
+	}
+	return defaultThemeColor
+}
+
+// generateFavicons decodes the png, jpeg or gif favicon source of the site and returns, by url path, the favicon.ico,
+// the png icons of all the standard sizes and the web app manifest.
+func generateFavicons(site *SiteConfig) (map[string]generatedFile, error) {
+	f, err := site.openFile(site.Favicon, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error opening favicon source: %w", err)
+	}
+	defer f.Close()
+	src, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding favicon source %s: %w", site.Favicon, err)
+	}
+	files := make(map[string]generatedFile)
+	for _, icon := range faviconPNGs {
+		data, err := encodeIconPNG(src, icon.Size)
+		if err != nil {
+			return nil, err
+		}
+		files[icon.Path] = generatedFile{ContentType: "image/png", Data: data}
+	}
+	ico, err := encodeICO(src, faviconICOSizes)
+	if err != nil {
+		return nil, err
+	}
+	files["/favicon.ico"] = generatedFile{ContentType: "image/x-icon", Data: ico}
+
+	display := "browser"
+	if isPWAEnabled(site) {
+		display = defaultPWADisplay
+		if site.PWA.Display != "" {
+			display = site.PWA.Display
+		}
+	}
+	backgroundColor := site.BackgroundColor
+	if backgroundColor == "" {
+		backgroundColor = defaultBackgroundColor
+	}
+	manifest := webManifest{
+		Name:            site.Title,
+		ShortName:       site.Title,
+		Description:     site.Description,
+		Lang:            site.Language,
+		StartURL:        "/",
+		Display:         display,
+		ThemeColor:      getThemeColor(site),
+		BackgroundColor: backgroundColor,
+		Icons: []webManifestIconInfo{
+			{Src: "/android-chrome-192x192.png", Sizes: "192x192", Type: "image/png"},
+			{Src: "/android-chrome-512x512.png", Sizes: "512x512", Type: "image/png"},
+		},
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding web manifest: %w", err)
+	}
+	files[manifestPath] = generatedFile{ContentType: "application/manifest+json", Data: data}
+	return files, nil
+}
+
+// resizeIcon scales src to a size x size square, a non square source is centered keeping its proportions.
+func resizeIcon(src image.Image, size int) *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+	b := src.Bounds()
+	w, h := size, size
+	if b.Dx() > b.Dy() {
+		h = size * b.Dy() / b.Dx()
+	} else if b.Dy() > b.Dx() {
+		w = size * b.Dx() / b.Dy()
+	}
+	offset := image.Pt((size-w)/2, (size-h)/2)
+	draw.CatmullRom.Scale(dst, image.Rectangle{Min: offset, Max: offset.Add(image.Pt(w, h))}, src, b, draw.Over, nil)
+	return dst
+}
+
+func encodeIconPNG(src image.Image, size int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, resizeIcon(src, size)); err != nil {
+		return nil, fmt.Errorf("error encoding %dx%d icon: %w", size, size, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeICO returns an ico file holding one png image by size, a format supported by all current browsers.
+func encodeICO(src image.Image, sizes []int) ([]byte, error) {
+	images := make([][]byte, len(sizes))
+	for i, size := range sizes {
+		data, err := encodeIconPNG(src, size)
+		if err != nil {
+			return nil, err
+		}
+		images[i] = data
+	}
+	var buf bytes.Buffer
+	// ICONDIR header : reserved, type 1 (icon), count
+	binary.Write(&buf, binary.LittleEndian, [3]uint16{0, 1, uint16(len(sizes))})
+	offset := 6 + 16*len(sizes)
+	for i, size := range sizes {
+		// ICONDIRENTRY : width and height (0 means 256), palette, reserved, planes, bits per pixel, size, offset
+		binary.Write(&buf, binary.LittleEndian, struct {
+			Width, Height, Colors, Reserved uint8
+			Planes, BitCount                uint16
+			Size, Offset                    uint32
+		}{uint8(size % 256), uint8(size % 256), 0, 0, 1, 32, uint32(len(images[i])), uint32(offset)})
+		offset += len(images[i])
+	}
+	for _, data := range images {
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
+
+// getGeneratedFileHandler serves a file built at startup, with conditional requests support.
+func getGeneratedFileHandler(path string, file generatedFile) http.HandlerFunc {
+	generatedAt := time.Now()
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", file.ContentType)
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		http.ServeContent(w, r, path, generatedAt, bytes.NewReader(file.Data))
+	}
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const flagsPath = adminPathPrefix + "/flags"
+
+// flagNameRegex are the names of the flags, usable as .Flags.name in the templates.
+var flagNameRegex = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// FlagStatus is the value of a flag returned by the admin endpoint, with the setting deciding it.
+type FlagStatus struct {
+	Enabled bool   `json:"enabled"`
+	Source  string `json:"source"` // config, env or admin
+}
+
+// featureFlags are the overrides of the flags of the config, by env FLAGS at start and by the admin endpoint,
+// shared by all the sites.
+type featureFlags struct {
+	mu    sync.Mutex
+	env   map[string]bool
+	admin map[string]bool
+}
+
+// flagOverrides are set from env FLAGS at start.
+var flagOverrides = &featureFlags{env: map[string]bool{}, admin: map[string]bool{}}
+
+// validateFlags checks the names of the flags can be used in the templates.
+func validateFlags(config *SiteConfig) []ConfigError {
+	var problems []ConfigError
+	for name := range config.Flags {
+		if !flagNameRegex.MatchString(name) {
+			problems = append(problems, ConfigError{Pointer: "/flags/" + name, Value: name, Message: "the name of a flag must start with a letter, followed by letters, digits and _"})
+		}
+	}
+	return problems
+}
+
+// parseFlags parses a comma separated list of name=bool like "newFooter=true,banner=false".
+func parseFlags(val string) (map[string]bool, error) {
+	flags := make(map[string]bool)
+	for _, item := range strings.Split(val, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, found := strings.Cut(item, "=")
+		name = strings.TrimSpace(name)
+		if !found || !flagNameRegex.MatchString(name) {
+			return nil, fmt.Errorf("'%s' should be like name=true", item)
+		}
+		enabled, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("the value of flag %s should be true or false. %w", name, err)
+		}
+		flags[name] = enabled
+	}
+	return flags, nil
+}
+
+// setFlagsFromEnvOrPanic reads the overrides of env FLAGS, a flag missing from the config is only reported.
+func setFlagsFromEnvOrPanic(config *SiteConfig, l *log.Logger) {
+	val := strings.TrimSpace(os.Getenv("FLAGS"))
+	if val == "" {
+		return
+	}
+	flags, err := parseFlags(val)
+	if err != nil {
+		panic(fmt.Errorf("💥💥 ERROR: CONFIG ENV FLAGS is invalid. %w", err))
+	}
+	for name := range flags {
+		if _, found := config.Flags[name]; !found {
+			l.Printf("⚠️ WARNING: flag %s of env FLAGS is not in the flags of the config", name)
+		}
+	}
+	flagOverrides.mu.Lock()
+	flagOverrides.env = flags
+	flagOverrides.mu.Unlock()
+}
+
+// getStatuses returns the value and the source of each flag of config.
+func (f *featureFlags) getStatuses(config *SiteConfig) map[string]FlagStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	statuses := make(map[string]FlagStatus, len(config.Flags))
+	for name, enabled := range config.Flags {
+		status := FlagStatus{Enabled: enabled, Source: "config"}
+		if enabled, found := f.env[name]; found {
+			status = FlagStatus{Enabled: enabled, Source: "env"}
+		}
+		if enabled, found := f.admin[name]; found {
+			status = FlagStatus{Enabled: enabled, Source: "admin"}
+		}
+		statuses[name] = status
+	}
+	return statuses
+}
+
+// getFlags returns the value of each flag of config, the .Flags of the templates.
+func getFlags(config *SiteConfig) map[string]bool {
+	if len(config.Flags) == 0 {
+		return nil
+	}
+	statuses := flagOverrides.getStatuses(config)
+	flags := make(map[string]bool, len(statuses))
+	for name, status := range statuses {
+		flags[name] = status.Enabled
+	}
+	return flags
+}
+
+// getFlagsKey returns the flags switched on, sorted, to tell apart the pages rendered with other flags in the output cache.
+func getFlagsKey(flags map[string]bool) string {
+	var names []string
+	for name, enabled := range flags {
+		if enabled {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return strings.Join(names, ",")
+}
+
+// getFlagsHandler returns the flags of the live site on GET, sets the value of a flag with PUT on flagsPath/{name}
+// and a json body like {"enabled": true}, and removes the value set with DELETE, the flag is back to the one of
+// env FLAGS or of the config. the values set are kept in memory until the server restarts.
+func getFlagsHandler(l *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		config := getLiveSite().Config
+		w.Header().Set("Cache-Control", "no-store")
+		if r.Method == http.MethodGet {
+			writeJSON(w, r, http.StatusOK, flagOverrides.getStatuses(config))
+			return
+		}
+		name := r.PathValue("name")
+		if _, found := config.Flags[name]; !found {
+			writeJSONError(w, r, http.StatusNotFound, fmt.Sprintf("flag '%s' is not in the flags of the config", name))
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			var body struct {
+				Enabled *bool `json:"enabled"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Enabled == nil {
+				writeJSONError(w, r, http.StatusBadRequest, `the body should be like {"enabled": true}`)
+				return
+			}
+			flagOverrides.mu.Lock()
+			flagOverrides.admin[name] = *body.Enabled
+			flagOverrides.mu.Unlock()
+			l.Printf("⚠️ WARNING: flag %s set to %t by %s", name, *body.Enabled, getClientIP(r))
+		case http.MethodDelete:
+			flagOverrides.mu.Lock()
+			delete(flagOverrides.admin, name)
+			flagOverrides.mu.Unlock()
+			l.Printf("✅ flag %s reset by %s", name, getClientIP(r))
+		}
+		writeJSON(w, r, http.StatusOK, flagOverrides.getStatuses(config)[name])
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+)
+
+const (
+	flashCookieName  = "flash"
+	flashMaxMessages = 5 // keep the cookie well below the browsers size limit
+	FlashSuccess     = "success"
+	FlashError       = "error"
+	FlashInfo        = "info"
+)
+
+// FlashMessage is a one-time message set by a handler and rendered by the FlashMessages partial on the next GET.
+type FlashMessage struct {
+	Kind    string `json:"kind"` // one of FlashSuccess, FlashError or FlashInfo
+	Message string `json:"message"`
+}
+
+// decodeFlashes returns the messages stored in the signed flash cookie of the request, if any.
+func decodeFlashes(r *http.Request) []FlashMessage {
+	value, found := getSignedCookie(r, flashCookieName)
+	if !found {
+		return nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil
+	}
+	var flashes []FlashMessage
+	if err := json.Unmarshal(raw, &flashes); err != nil {
+		return nil
+	}
+	return flashes
+}
+
+// addFlash appends a message to the ones already pending in the request and stores them in the flash cookie.
+func addFlash(w http.ResponseWriter, r *http.Request, site *SiteConfig, kind, message string) {
+	flashes := append(decodeFlashes(r), FlashMessage{Kind: kind, Message: message})
+	if len(flashes) > flashMaxMessages {
+		flashes = flashes[len(flashes)-flashMaxMessages:]
+	}
+	raw, err := json.Marshal(flashes)
+	if err != nil {
+		return
+	}
+	setSignedCookie(w, r, site, &http.Cookie{
+		Name:     flashCookieName,
+		Value:    base64.RawURLEncoding.EncodeToString(raw),
+		Path:     "/",
+		HttpOnly: true,
+	})
+}
+
+// popFlashes returns the pending messages and clears the flash cookie so they are only shown once.
+func popFlashes(w http.ResponseWriter, r *http.Request, site *SiteConfig) []FlashMessage {
+	flashes := decodeFlashes(r)
+	if _, err := r.Cookie(flashCookieName); err == nil {
+		setSignedCookie(w, r, site, &http.Cookie{Name: flashCookieName, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+	}
+	return flashes
+}
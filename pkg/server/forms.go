@@ -0,0 +1,253 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	siteconfig "github.com/lao-tseu-is-alive/JsonSiteGo/pkg/config"
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/mailer"
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/storage"
+)
+
+const (
+	formActionEmail     = "email"
+	formActionWebhook   = "webhook"
+	formActionFile      = "file"
+	formActionStore     = "store"
+	formActionSubscribe = "subscribe"
+	formWebhookTimeout  = 10 * time.Second
+)
+
+// formFileMutex serializes the appends to the submissions files.
+var formFileMutex sync.Mutex
+
+// Form describes a declarative html form processed by a generated POST handler on the page route.
+type Form struct {
+	Fields         []FormField  `json:"fields"`
+	Actions        []FormAction `json:"actions"`
+	SubmitLabel    string       `json:"submitLabel,omitempty"`
+	RedirectTo     string       `json:"redirectTo,omitempty"`     // where to go after a successful submit, defaults to the page itself
+	SuccessMessage string       `json:"successMessage,omitempty"` // flash message after a successful submit
+	ErrorMessage   string       `json:"errorMessage,omitempty"`   // flash message when validation or an action failed
+}
+
+// FormField defines one input of a Form with its validation rules.
+type FormField struct {
+	Name        string `json:"name"`
+	Label       string `json:"label,omitempty"`
+	Type        string `json:"type,omitempty"` // html input type like text, email, tel, number or textarea
+	Placeholder string `json:"placeholder,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	MinLength   int    `json:"minLength,omitempty"`
+	MaxLength   int    `json:"maxLength,omitempty"`
+	Pattern     string `json:"pattern,omitempty"` // a Go regular expression the value must match
+}
+
+// FormAction is one of the things done with a valid submission.
+type FormAction struct {
+	Type     string `json:"type"`               // "email", "webhook", "file", "store" or "subscribe"
+	To       string `json:"to,omitempty"`       // recipient of the email action
+	Template string `json:"template,omitempty"` // email template of templates/emails rendering the email action, a list of the values without it
+	ReplyTo  string `json:"replyTo,omitempty"`  // field whose value is the Reply-To of the email action, like email
+	URL      string `json:"url,omitempty"`      // target of the webhook action, receiving the values as json
+	Path     string `json:"path,omitempty"`     // file where the file action appends one json line per submission
+	Field    string `json:"field,omitempty"`    // field holding the email of the subscribe action, email by default
+	List     string `json:"list,omitempty"`     // newsletter list of the subscribe action, the page key by default
+}
+
+// validateFormValues checks the posted values against the field rules and returns the list of problems.
+func validateFormValues(form *Form, values url.Values) []string {
+	var problems []string
+	for _, field := range form.Fields {
+		value := strings.TrimSpace(values.Get(field.Name))
+		label := field.Label
+		if label == "" {
+			label = field.Name
+		}
+		if value == "" {
+			if field.Required {
+				problems = append(problems, fmt.Sprintf("%s is required", label))
+			}
+			continue
+		}
+		length := utf8.RuneCountInString(value)
+		if field.MinLength > 0 && length < field.MinLength {
+			problems = append(problems, fmt.Sprintf("%s should contain at least %d characters", label, field.MinLength))
+		}
+		if field.MaxLength > 0 && length > field.MaxLength {
+			problems = append(problems, fmt.Sprintf("%s should contain at most %d characters", label, field.MaxLength))
+		}
+		if field.Type == "email" {
+			if _, err := mail.ParseAddress(value); err != nil {
+				problems = append(problems, fmt.Sprintf("%s should be a valid email", label))
+			}
+		}
+		if field.Pattern != "" {
+			re, err := regexp.Compile(field.Pattern)
+			if err != nil || !re.MatchString(value) {
+				problems = append(problems, fmt.Sprintf("%s has an invalid format", label))
+			}
+		}
+	}
+	return problems
+}
+
+// getFormSubmission returns only the values of the declared fields, so nothing unexpected reaches the actions.
+func getFormSubmission(form *Form, values url.Values) map[string]string {
+	submission := make(map[string]string, len(form.Fields))
+	for _, field := range form.Fields {
+		submission[field.Name] = strings.TrimSpace(values.Get(field.Name))
+	}
+	return submission
+}
+
+// runFormAction executes one action with the submitted values.
+func runFormAction(ctx context.Context, action FormAction, page *Page, site *SiteConfig, submission map[string]string, store storage.Store, mail *siteMailer, l *log.Logger) error {
+	switch action.Type {
+	case formActionEmail:
+		return sendFormEmail(ctx, action, page, site, submission, mail)
+	case formActionWebhook:
+		body, err := json.Marshal(map[string]interface{}{
+			"page":       page.Route,
+			"submission": submission,
+			"time":       time.Now().UTC().Format(time.RFC3339),
+		})
+		if err != nil {
+			return fmt.Errorf("error encoding webhook body: %w", err)
+		}
+		client := http.Client{Timeout: formWebhookTimeout}
+		resp, err := client.Post(action.URL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("error calling form webhook %s: %w", action.URL, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("form webhook %s returned status %s", action.URL, resp.Status)
+		}
+		return nil
+	case formActionFile:
+		line, err := json.Marshal(map[string]interface{}{
+			"time":       time.Now().UTC().Format(time.RFC3339),
+			"submission": submission,
+		})
+		if err != nil {
+			return fmt.Errorf("error encoding form submission: %w", err)
+		}
+		if siteconfig.IsFromStdin() {
+			l.Printf("INFO: the config is read from stdin, submission of %s not written to %s: %s", page.Route, action.Path, line)
+			return nil
+		}
+		formFileMutex.Lock()
+		defer formFileMutex.Unlock()
+		file, err := site.openFile(action.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return fmt.Errorf("error opening form submissions file %s: %w", action.Path, err)
+		}
+		defer file.Close()
+		_, err = file.Write(append(line, '\n'))
+		return err
+	case formActionStore:
+		line, err := json.Marshal(map[string]interface{}{
+			"time":       time.Now().UTC().Format(time.RFC3339),
+			"submission": submission,
+		})
+		if err != nil {
+			return fmt.Errorf("error encoding form submission: %w", err)
+		}
+		key := getPageKey(page)
+		if err := store.Append(ctx, "submissions/"+key+".jsonl", append(line, '\n')); err != nil {
+			return fmt.Errorf("error storing form submission: %w", err)
+		}
+		_, err = store.Incr(ctx, "counters/submissions/"+key, 1)
+		return err
+	case formActionSubscribe:
+		return subscribeToNewsletter(ctx, action, page, site, submission, store, mail)
+	default:
+		l.Printf("💥 unsupported form action type '%s' in page %s", action.Type, page.Route)
+		return fmt.Errorf("unsupported form action type '%s'", action.Type)
+	}
+}
+
+// sendFormEmail sends the submission to the recipient of action, rendered with its email template or as a plain
+// text list of the values.
+func sendFormEmail(ctx context.Context, action FormAction, page *Page, site *SiteConfig, submission map[string]string, mail *siteMailer) error {
+	msg := &mailer.Message{Subject: "New submission from " + page.Title, ReplyTo: submission[action.ReplyTo]}
+	if action.Template == "" {
+		names := make([]string, 0, len(submission))
+		for name := range submission {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var text strings.Builder
+		for _, name := range names {
+			fmt.Fprintf(&text, "%s: %s\n", name, submission[name])
+		}
+		msg.Text = text.String()
+	}
+	return mail.send(ctx, []string{action.To}, action.Template, EmailData{Site: site, Page: page, Values: submission}, msg)
+}
+
+// getFormHandler creates the POST handler processing the form of a page, then redirects (Post/Redirect/Get)
+// with a flash message telling the visitor the outcome.
+func getFormHandler(page *Page, site *SiteConfig, store storage.Store, mail *siteMailer, l *log.Logger) http.HandlerFunc {
+	form := page.Form
+	pagePath := splitRoutePath(page.Route)
+	notFound := getNotFoundHandler(site, l)
+	successMessage := form.SuccessMessage
+	if successMessage == "" {
+		successMessage = "Thank you, your submission was received."
+	}
+	errorMessage := form.ErrorMessage
+	if errorMessage == "" {
+		errorMessage = "Sorry, your submission could not be processed."
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		l.Printf("in form handler '%s' url: %s", page.Route, r.URL.Path)
+		if !isRoutePatternMatch(pagePath, r.URL.Path) {
+			notFound(w, r)
+			return
+		}
+		back := r.URL.Path
+		if err := r.ParseForm(); err != nil {
+			l.Printf("💥 error parsing form of %s: %v", page.Route, err)
+			addFlash(w, r, site, FlashError, errorMessage)
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			return
+		}
+		if problems := validateFormValues(form, r.PostForm); len(problems) > 0 {
+			l.Printf("💥 invalid form submission for %s: %s", page.Route, strings.Join(problems, ", "))
+			addFlash(w, r, site, FlashError, fmt.Sprintf("%s %s.", errorMessage, strings.Join(problems, ", ")))
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			return
+		}
+		submission := getFormSubmission(form, r.PostForm)
+		for _, action := range form.Actions {
+			if err := runFormAction(r.Context(), action, page, site, submission, store, mail, l); err != nil {
+				l.Printf("💥💥 error in form action %s of %s: %v", action.Type, page.Route, err)
+				addFlash(w, r, site, FlashError, errorMessage)
+				http.Redirect(w, r, back, http.StatusSeeOther)
+				return
+			}
+		}
+		notify(eventFormSubmitted, fmt.Sprintf("form of %s submitted", page.Route), map[string]interface{}{"page": page.Route, "submission": submission}, l)
+		target := back
+		if form.RedirectTo != "" {
+			target = form.RedirectTo
+		}
+		addFlash(w, r, site, FlashSuccess, successMessage)
+		http.Redirect(w, r, target, http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,330 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/version"
+)
+
+const (
+	defaultContentGitDir = "content"
+	gitTimeout           = 2 * time.Minute
+	contentWebhookPath   = "/api/v1/content/webhook"
+)
+
+// GitContent is the git checkout holding the config and the content, pulled at start, on reload and by the
+// webhook of the git server. the changes saved by the admin api are committed and pushed to it.
+type GitContent struct {
+	url    string
+	branch string // empty for the default branch of the remote
+	dir    string
+	mu     sync.Mutex // one git command sequence at a time in the checkout
+	l      *log.Logger
+}
+
+// getGitContentFromEnv returns the checkout of the repository of env CONTENT_GIT_URL, or nil when it is not set.
+// env CONTENT_GIT_BRANCH selects the branch and env CONTENT_GIT_DIR the directory of the checkout.
+func getGitContentFromEnv(l *log.Logger) *GitContent {
+	url := strings.TrimSpace(os.Getenv("CONTENT_GIT_URL"))
+	if url == "" {
+		return nil
+	}
+	return &GitContent{
+		url:    url,
+		branch: strings.TrimSpace(os.Getenv("CONTENT_GIT_BRANCH")),
+		dir:    getEnvOrDefault("CONTENT_GIT_DIR", defaultContentGitDir),
+		l:      l,
+	}
+}
+
+// getPath returns path inside the checkout, the absolute paths and the http(s) urls are returned as is.
+func (g *GitContent) getPath(path string) string {
+	if g == nil || filepath.IsAbs(path) || strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return path
+	}
+	return filepath.Join(g.dir, path)
+}
+
+// run executes git with args in the checkout and returns its trimmed output.
+func (g *GitContent) run(ctx context.Context, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = g.dir
+	// never wait for a password on a terminal
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Sync clones the repository when the checkout does not exist yet, else pulls the last commits of the branch.
+// it returns the hash of the commit checked out.
+func (g *GitContent) Sync(ctx context.Context) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.sync(ctx)
+}
+
+func (g *GitContent) sync(ctx context.Context) (string, error) {
+	if _, err := os.Stat(filepath.Join(g.dir, ".git")); errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(g.dir, 0755); err != nil {
+			return "", fmt.Errorf("error creating content checkout %s: %w", g.dir, err)
+		}
+		args := []string{"clone", "--quiet"}
+		if g.branch != "" {
+			args = append(args, "--branch", g.branch)
+		}
+		if _, err := g.run(ctx, append(args, "--", g.url, ".")...); err != nil {
+			return "", err
+		}
+	} else if _, err := g.run(ctx, "pull", "--quiet", "--ff-only"); err != nil {
+		return "", err
+	}
+	commit, err := g.run(ctx, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	g.l.Printf("✅ Content checkout %s at commit %s", g.dir, commit)
+	return commit, nil
+}
+
+// Commit writes data to path, relative to the checkout, then commits it with the identity of the editor and pushes it.
+// the checkout is first synced so that the commit follows the last one, and reset when the push fails.
+func (g *GitContent) Commit(ctx context.Context, path string, data []byte, editor Editor, message string) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, err := g.sync(ctx); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(g.dir, path), data, 0644); err != nil {
+		return "", fmt.Errorf("error writing %s in content checkout: %w", path, err)
+	}
+	if _, err := g.run(ctx, "add", "--", path); err != nil {
+		return "", err
+	}
+	if _, err := g.run(ctx, "diff", "--cached", "--quiet"); err == nil {
+		// same content as the last commit, there is nothing to commit
+		return g.run(ctx, "rev-parse", "HEAD")
+	}
+	// the editor is the author, the server is the committer
+	_, err := g.run(ctx, "-c", "user.name="+version.APP, "-c", "user.email="+version.APP+"@localhost",
+		"commit", "--quiet", "--author", editor.String(), "-m", message)
+	if err != nil {
+		if _, resetErr := g.run(ctx, "reset", "--quiet", "--hard", "HEAD"); resetErr != nil {
+			g.l.Printf("💥 error resetting content checkout after a failed commit: %v", resetErr)
+		}
+		return "", err
+	}
+	if _, err := g.run(ctx, "push", "--quiet", "origin", "HEAD"); err != nil {
+		if _, resetErr := g.run(ctx, "reset", "--quiet", "--hard", "@{upstream}"); resetErr != nil {
+			g.l.Printf("💥 error resetting content checkout after a failed push: %v", resetErr)
+		}
+		return "", err
+	}
+	commit, err := g.run(ctx, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	g.l.Printf("✅ %s committed by %s as %s", path, editor, commit)
+	return commit, nil
+}
+
+// Editor is the identity of the person changing the content, the author of the git commits.
+type Editor struct {
+	Name  string
+	Email string
+}
+
+// String returns the editor as a git author, like "Ann <ann@example.com>".
+func (e Editor) String() string {
+	return fmt.Sprintf("%s <%s>", e.Name, e.Email)
+}
+
+// isValidWebhookRequest checks the secret of a push webhook, either the hmac signature of GitHub and Gitea
+// (X-Hub-Signature-256) or the token of GitLab (X-Gitlab-Token).
+func isValidWebhookRequest(secret string, body []byte, signature, token string) bool {
+	if secret == "" {
+		return false
+	}
+	if hexSum, found := strings.CutPrefix(signature, "sha256="); found {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		sum, err := hex.DecodeString(hexSum)
+		return err == nil && hmac.Equal(sum, mac.Sum(nil))
+	}
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+}
+
+// ContentConfig holds the settings of the content files and of the content kept in git.
+type ContentConfig struct {
+	EditorRole string `json:"editorRole,omitempty"` // users having this role can save the config, besides the admin token
+	Dir        string `json:"dir,omitempty"`        // directory of .md and .html files with a front matter, added to the pages
+	Sanitize   string `json:"sanitize,omitempty"`   // sanitize policy of the html of the content files, kept as is without it
+}
+
+// validateContent checks the editor role can be known.
+func validateContent(config *SiteConfig) []ConfigError {
+	if config.Content == nil || config.Content.EditorRole == "" || config.Auth != nil {
+		return nil
+	}
+	return []ConfigError{{Pointer: "/content/editorRole", Value: config.Content.EditorRole, Message: "the editorRole needs the auth config"}}
+}
+
+// authorReplacer removes the characters that would break the author of a commit.
+var authorReplacer = strings.NewReplacer("<", "", ">", "", "\n", " ", "\r", " ")
+
+// getEditor returns the identity of the editor making the request, a user having the editorRole, or the admin token
+// completed by the X-Editor-Name and X-Editor-Email headers. it returns false when the request cannot edit.
+func getEditor(r *http.Request, adminToken string) (Editor, bool) {
+	if isAdminRequest(r, adminToken) {
+		editor := Editor{
+			Name:  strings.TrimSpace(authorReplacer.Replace(r.Header.Get("X-Editor-Name"))),
+			Email: strings.TrimSpace(authorReplacer.Replace(r.Header.Get("X-Editor-Email"))),
+		}
+		if editor.Name == "" {
+			editor.Name = "admin"
+		}
+		if editor.Email == "" {
+			editor.Email = "admin@localhost"
+		}
+		return editor, true
+	}
+	content := getLiveSite().Config.Content
+	user := getUser(r)
+	if content == nil || content.EditorRole == "" || !user.HasRole(content.EditorRole) {
+		return Editor{}, false
+	}
+	editor := Editor{Name: authorReplacer.Replace(user.Name), Email: authorReplacer.Replace(user.Email)}
+	if editor.Email == "" {
+		editor.Email = authorReplacer.Replace(user.Subject)
+	}
+	if editor.Name == "" {
+		editor.Name = editor.Email
+	}
+	return editor, true
+}
+
+// getConfigUpdateHandler validates the config json of the request body, commits it to path in the git checkout
+// with the identity of the editor and serves it. the X-Commit-Message header gives the message of the commit.
+func getConfigUpdateHandler(loader *siteLoader, path, adminToken string) http.HandlerFunc {
+	l := loader.l
+	return func(w http.ResponseWriter, r *http.Request) {
+		editor, ok := getEditor(r, adminToken)
+		if !ok {
+			l.Printf("💥 unauthorized config update from %s", getClientIP(r))
+			auditLog.RecordRequest(r, "admin.denied", auditFailure, "", "invalid admin token or missing editor role")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeJSONError(w, r, http.StatusUnauthorized, "a valid admin bearer token or the editor role is required")
+			return
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				writeJSONError(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("the config is larger than %d bytes", maxErr.Limit))
+				return
+			}
+			writeJSONError(w, r, http.StatusBadRequest, "error reading the config")
+			return
+		}
+		// only the admin token may commit secret values, an editor could read the secrets of the server with them
+		opts := configOptions{untrusted: !isAdminRequest(r, adminToken)}
+		config, err := parseConfigIn([]configSource{{Path: path, Data: data}}, data, loader.schemaURL, opts, l)
+		if err == nil {
+			// also compiles the templates of the new pages, so that an unusable config is never committed
+			_, err = loader.build(config)
+		}
+		if err != nil {
+			auditLog.RecordRequest(r, "config.update", auditFailure, editor.Email, err.Error())
+			writeJSONError(w, r, http.StatusUnprocessableEntity, "the config is invalid: "+getConfigErrorMessage(err))
+			return
+		}
+		message := strings.TrimSpace(r.Header.Get("X-Commit-Message"))
+		if message == "" {
+			message = "Update " + path
+		}
+		// a client going away must not interrupt git between the commit and the push
+		ctx := context.WithoutCancel(r.Context())
+		commit, err := loader.git.Commit(ctx, path, data, editor, message)
+		if err != nil {
+			l.Printf("💥 error committing %s: %v", path, err)
+			auditLog.RecordRequest(r, "config.update", auditFailure, editor.Email, err.Error())
+			writeJSONError(w, r, http.StatusBadGateway, "error committing the config to the content repository")
+			return
+		}
+		site, err := loader.reload(ctx, false)
+		if err != nil {
+			l.Printf("💥 error loading config %s committed as %s: %v", path, commit, err)
+			auditLog.RecordRequest(r, "config.update", auditFailure, editor.Email, fmt.Sprintf("commit %s: %v", commit, err))
+			writeJSONError(w, r, http.StatusUnprocessableEntity, fmt.Sprintf("the config is committed as %s but cannot be served: %s", commit, getConfigErrorMessage(err)))
+			return
+		}
+		auditLog.RecordRequest(r, "config.update", auditSuccess, editor.Email, fmt.Sprintf("commit %s by %s", commit, editor))
+		writeJSON(w, r, http.StatusOK, map[string]interface{}{
+			"commit":  commit,
+			"version": getCurrentConfigVersion(site),
+		})
+	}
+}
+
+// getContentWebhookHandler pulls the git checkout and loads the config again when the git server notifies a push.
+func getContentWebhookHandler(loader *siteLoader, secret string) http.HandlerFunc {
+	l := loader.l
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil || !isValidWebhookRequest(secret, body, r.Header.Get("X-Hub-Signature-256"), r.Header.Get("X-Gitlab-Token")) {
+			l.Printf("💥 invalid content webhook request from %s", getClientIP(r))
+			auditLog.RecordRequest(r, "content.webhook", auditFailure, "", "invalid signature")
+			writeJSONError(w, r, http.StatusUnauthorized, "invalid webhook signature")
+			return
+		}
+		site, err := loader.reload(context.WithoutCancel(r.Context()), true)
+		if err != nil {
+			l.Printf("💥 error reloading config after webhook: %v", err)
+			auditLog.RecordRequest(r, "content.webhook", auditFailure, "", err.Error())
+			writeJSONError(w, r, http.StatusUnprocessableEntity, "the config cannot be reloaded: "+getConfigErrorMessage(err))
+			return
+		}
+		auditLog.RecordRequest(r, "content.webhook", auditSuccess, "", fmt.Sprintf("%s with %d pages", site.Version, len(site.Config.Pages)))
+		writeJSON(w, r, http.StatusOK, getCurrentConfigVersion(site))
+	}
+}
+
+// registerGitContentHandlers adds the webhook of the git server, when env CONTENT_WEBHOOK_SECRET is set, to the public
+// mux and the config update endpoint to the admin mux.
+func registerGitContentHandlers(publicMux, adminMux *http.ServeMux, loader *siteLoader, adminToken string) {
+	l := loader.l
+	if secret := strings.TrimSpace(os.Getenv("CONTENT_WEBHOOK_SECRET")); secret != "" {
+		publicMux.HandleFunc("POST "+contentWebhookPath, getContentWebhookHandler(loader, secret))
+		l.Printf("INFO: content pulled on the push webhooks sent to %s", contentWebhookPath)
+	} else {
+		l.Printf("INFO: env CONTENT_WEBHOOK_SECRET is not set, %s is disabled", contentWebhookPath)
+	}
+	path, err := filepath.Rel(loader.git.dir, loader.configURL)
+	if err != nil || strings.HasPrefix(path, "..") {
+		l.Printf("⚠️ WARNING: config %s is not in the content checkout %s, PUT %s is disabled", loader.configURL, loader.git.dir, configPath)
+		return
+	}
+	adminMux.HandleFunc("PUT "+configPath, getConfigUpdateHandler(loader, path, adminToken))
+}
@@ -0,0 +1,233 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	siteconfig "github.com/lao-tseu-is-alive/JsonSiteGo/pkg/config"
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/storage"
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/version"
+)
+
+// Server is the site of the config given by the env variables with all its handlers wired : the live site, the
+// admin endpoints and the middlewares. the live site is global to the process, so a single Server serves at a time.
+type Server struct {
+	config   *SiteConfig
+	loader   *siteLoader
+	limits   serverLimits
+	trusted  []netip.Prefix          // trusted proxies, exempt of the connection limit by client address
+	handlers map[string]http.Handler // handler of each listener kind
+	tasks    *scheduler              // runs the tasks of the live config
+	update   bool                    // checks at start and each day whether a newer release is published, env UPDATE_CHECK
+	l        *log.Logger
+}
+
+// New loads the config of CONFIG_URL, syncing it from git when CONTENT_GIT_URL is set, and builds the site and its
+// handlers like the server does, without listening. a config validation error is a *ConfigValidationError.
+func New(l *log.Logger) (*Server, error) {
+	pathToTemplates = getEnvOrDefault("TEMPLATES_DIR", defaultTemplatesDir)
+	pathToStatic = getEnvOrDefault("STATIC_DIR", defaultStaticDir)
+	startedAt := time.Now()
+	// timings of the startup steps, logged once the site is ready to measure the cold starts
+	var timings []string
+	lap := startedAt
+	measure := func(step string) {
+		now := time.Now()
+		timings = append(timings, fmt.Sprintf("%s %v", step, now.Sub(lap).Round(time.Microsecond)))
+		lap = now
+	}
+
+	gitContent := getGitContentFromEnv(l)
+	if gitContent != nil && siteconfig.IsFromStdin() {
+		return nil, fmt.Errorf("the config read from stdin cannot be taken from the git content of env CONTENT_GIT_URL")
+	}
+	if siteconfig.IsFromStdin() {
+		l.Printf("INFO: the config is read from stdin, the data and the form submissions are kept in memory")
+	}
+	if gitContent != nil {
+		if _, err := gitContent.Sync(context.Background()); err != nil {
+			return nil, fmt.Errorf("error getting the content from git: %w", err)
+		}
+		measure("git")
+	}
+	configURL := gitContent.getPath(getEnvOrDefault("CONFIG_URL", defaultSiteConfigFile))
+	schemaURL := getEnvOrDefault("SCHEMA_URL", defaultSchemaFile)
+	config, err := LoadConfig(configURL, schemaURL, l)
+	if err != nil {
+		return nil, fmt.Errorf("error loading config file: %w", err)
+	}
+	measure("config")
+	applyEnvOverrides(config)
+	auditLog = getAuditLogFromEnvOrPanic(config, l)
+	auditLog.Record(AuditEvent{Action: "config.load", Outcome: auditSuccess, Target: configURL, Detail: fmt.Sprintf("%s %s with %d pages", version.APP, version.VERSION, len(config.Pages))})
+
+	store := getStoreFromEnvOrPanic()
+	if err := loadGeneratedSessionKey(store); err != nil {
+		return nil, fmt.Errorf("error loading the session key from the store: %w", err)
+	}
+	loader := &siteLoader{configURL: configURL, schemaURL: schemaURL, store: store, bandwidth: NewBandwidthCounter(), git: gitContent, l: l}
+	site, err := buildSite(config, store, loader.bandwidth, l)
+	if err != nil {
+		return nil, fmt.Errorf("error building the site: %w", err)
+	}
+	measure("site")
+	if site.Version, err = saveConfigVersion(store, config.raw, time.Now()); err != nil {
+		l.Printf("💥 warning: could not save the config version in the history: %v", err)
+	}
+	applySite(site)
+	go purgeOutputCache(store, l)
+	if os.Getenv("COOKIE_SECRET") == "" && os.Getenv("SESSION_SECRET") == "" && storage.IsInMemory(store) {
+		l.Printf("⚠️ WARNING: env COOKIE_SECRET is not set, the theme and flash cookies are reset when the server restarts")
+	}
+
+	// the admin endpoints are served by the public listeners, unless the config has an admin listener
+	publicMux := http.NewServeMux()
+	setMaintenanceFromEnvOrPanic(l)
+	setFlagsFromEnvOrPanic(config, l)
+	// the jobs of the server run with the tasks of the live config
+	serverJobs := []scheduledJob{getPublishingJob(loader)}
+	checkUpdate := isUpdateCheckEnabledOrPanic()
+	if checkUpdate {
+		serverJobs = append(serverJobs, getUpdateCheckJob(l))
+	}
+	tasks := newScheduler(func() []scheduledJob {
+		return append(slices.Clone(serverJobs), getScheduledJobs(getLiveSite().Config, l)...)
+	}, l)
+	loader.tasks = tasks
+	tenants, err := getTenantSitesFromEnv(schemaURL, store, loader.bandwidth, l)
+	if err != nil {
+		return nil, err
+	}
+	if tenants != nil {
+		if err := tenants.load(); err != nil {
+			return nil, err
+		}
+		publicMux.Handle(tenantsPathPrefix+"{name}/", withMaintenance(tenants, l))
+		measure("tenants")
+	}
+	publicMux.Handle("/", withMaintenance(withTenantHosts(http.HandlerFunc(serveLiveSite), tenants), l))
+	if loader.previews, err = getPreviewSitesFromEnv(gitContent, configURL, schemaURL, loader.bandwidth, l); err != nil {
+		return nil, err
+	}
+	if loader.previews != nil {
+		loader.previews.load(context.Background())
+		publicMux.Handle(previewPathPrefix+"{name}/", withMaintenance(loader.previews, l))
+	}
+	adminMux := publicMux
+	if hasAdminListener(config) {
+		adminMux = http.NewServeMux()
+	}
+	recorder := getRequestRecorderFromEnvOrPanic()
+	adminMux.HandleFunc("GET /metrics", getMetricsHandler(loader.bandwidth))
+	adminMux.HandleFunc("GET "+healthPath, getHealthHandler())
+	if adminToken := getAdminTokenFromEnv(); adminToken != "" {
+		adminMux.HandleFunc("GET "+versionPath, requireAdmin(getVersionHandler(), adminToken, l))
+		adminMux.HandleFunc("GET "+adminPathPrefix+"/bandwidth", requireAdmin(getBandwidthReportHandler(loader.bandwidth), adminToken, l))
+		routeOptions := routeListOptions{adminToken: adminToken, gitContent: gitContent != nil, audit: auditLog != nil, previews: loader.previews != nil, tenants: tenants != nil}
+		adminMux.HandleFunc("GET "+routesPath, requireAdmin(getRoutesHandler(routeOptions), adminToken, l))
+		registerConfigVersionsHandlers(adminMux, loader, adminToken)
+		for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodDelete} {
+			adminMux.HandleFunc(method+" "+maintenancePath, requireAdmin(getMaintenanceHandler(l), adminToken, l))
+		}
+		adminMux.HandleFunc("GET "+flagsPath, requireAdmin(getFlagsHandler(l), adminToken, l))
+		for _, method := range []string{http.MethodPut, http.MethodDelete} {
+			adminMux.HandleFunc(method+" "+flagsPath+"/{name}", requireAdmin(getFlagsHandler(l), adminToken, l))
+		}
+		adminMux.HandleFunc("GET "+tasksPath, requireAdmin(getTasksHandler(tasks), adminToken, l))
+		if tenants != nil {
+			adminMux.HandleFunc("GET "+tenantsPath, requireAdmin(getTenantsHandler(tenants), adminToken, l))
+			adminMux.HandleFunc("POST "+tenantsPath+"/reload", requireAdmin(getTenantsReloadHandler(tenants), adminToken, l))
+			adminMux.HandleFunc("POST "+tenantsPath+"/{name}/reload", requireAdmin(getTenantReloadHandler(tenants), adminToken, l))
+		}
+		if isDebugEnabled(config) {
+			registerDebugHandlers(adminMux, config, adminToken, startedAt, l)
+		}
+		if recorder != nil {
+			adminMux.HandleFunc("GET "+requestsPath, requireAdmin(getRequestsViewHandler(recorder, l), adminToken, l))
+			l.Printf("✅ Dev mode: the last %d requests are shown on %s", recorder.size, requestsPath)
+		}
+	} else {
+		l.Printf("INFO: env ADMIN_TOKEN is not set, admin endpoints are disabled")
+		if recorder != nil {
+			l.Printf("⚠️ WARNING: the requests are recorded in dev mode but %s needs env ADMIN_TOKEN", requestsPath)
+			recorder = nil
+		}
+		if isDebugEnabled(config) {
+			l.Printf("⚠️ WARNING: debug is enabled in the config but needs env ADMIN_TOKEN, %s is disabled", debugPath)
+		}
+	}
+	if auditLog != nil {
+		// the viewer also accepts the users having the viewerRole, so it is registered without the admin token
+		adminMux.HandleFunc("GET "+auditPath, getAuditViewHandler(config, getAdminTokenFromEnv(), l))
+	}
+	if gitContent != nil {
+		registerGitContentHandlers(publicMux, adminMux, loader, getAdminTokenFromEnv())
+	}
+
+	limits := getServerLimitsFromEnvOrPanic(config)
+	l.Printf("INFO: timeouts read: %s, write: %s, idle: %s, read header: %s, max header: %d bytes, max body: %d bytes",
+		limits.ReadTimeout, limits.WriteTimeout, limits.IdleTimeout, limits.ReadHeaderTimeout, limits.MaxHeaderBytes, limits.MaxBodyBytes)
+	if limits.MaxConnections > 0 || limits.MaxConnectionsPerIP > 0 {
+		l.Printf("INFO: max connections by listener: %d, by client address: %d (0 is unlimited)", limits.MaxConnections, limits.MaxConnectionsPerIP)
+	}
+	trustedProxies := getTrustedProxiesFromEnvOrPanic(config)
+	if len(trustedProxies) > 0 {
+		l.Printf("INFO: client address and scheme taken from X-Forwarded-For and X-Forwarded-Proto of %d trusted proxies ranges", len(trustedProxies))
+	}
+	measure("handlers")
+	l.Printf("✅ Site of %d pages ready in %v: %s", len(config.Pages), time.Since(startedAt).Round(time.Microsecond), strings.Join(timings, ", "))
+	return &Server{
+		config:  config,
+		loader:  loader,
+		limits:  limits,
+		trusted: trustedProxies,
+		tasks:   tasks,
+		update:  checkUpdate,
+		handlers: map[string]http.Handler{
+			listenerPublic: withTrustedProxies(withRequestID(withRequestRecorder(withIPAccess(withLiveAuth(withBodyLimit(publicMux, limits.MaxBodyBytes)), l), recorder)), trustedProxies),
+			listenerAdmin:  withTrustedProxies(withRequestID(withRequestRecorder(withIPAccess(withLiveAuth(withBodyLimit(adminMux, limits.MaxBodyBytes)), l), recorder)), trustedProxies),
+		},
+		l: l,
+	}, nil
+}
+
+// Handler returns the handler of the public listeners, with the same middlewares, so that it can be driven by
+// net/http/httptest without listening. it also serves the admin endpoints unless the config has an admin listener.
+func (s *Server) Handler() http.Handler {
+	return s.handlers[listenerPublic]
+}
+
+// AdminHandler returns the handler of the admin listener, it serves the same endpoints as Handler when the config
+// has no admin listener.
+func (s *Server) AdminHandler() http.Handler {
+	return s.handlers[listenerAdmin]
+}
+
+// ListenAndServe purges the cdn when the config asks it, starts the scheduler of the tasks, the publishing of the
+// pages and the update check, and serves the listeners of the config, or the PORT env variable, until one of them fails.
+func (s *Server) ListenAndServe() error {
+	if s.config.CDN != nil && s.config.CDN.PurgeOnStart {
+		if err := purgeCDN(s.config.CDN, getAllSurrogateKeys(s.config), s.l); err != nil {
+			s.l.Printf("💥 warning: could not purge cdn cache: %v", err)
+		}
+	}
+	if next, found := getNextPublishingChange(s.config, time.Now()); found {
+		s.l.Printf("INFO: next page published or expiring at %s", next.Format(time.RFC3339))
+	}
+	if len(s.config.Tasks) > 0 {
+		s.l.Printf("INFO: %d scheduled tasks, their state is in %s", len(s.config.Tasks), tasksPath)
+	}
+	if s.update {
+		s.l.Printf("INFO: checking for a newer version at start and each %s", updateCheckInterval)
+	}
+	go s.tasks.run(context.Background())
+	notify(eventServerStarted, fmt.Sprintf("%s %s started with %d pages", version.APP, version.VERSION, len(s.config.Pages)), nil, s.l)
+	return serveListeners(getListeners(s.config, getPortFromEnvOrPanic(defaultPort)), s.handlers, s.limits, s.trusted, s.l)
+}
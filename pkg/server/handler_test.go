@@ -0,0 +1,56 @@
+package server
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServerHandler(t *testing.T) {
+	t.Setenv("CONFIG_URL", "../../config.json")
+	t.Setenv("SCHEMA_URL", "../../config.schema.json")
+	t.Setenv("TEMPLATES_DIR", "../../templates")
+	t.Setenv("STATIC_DIR", t.TempDir())
+	srv, err := New(log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	tests := []struct {
+		path        string
+		status      int
+		contentType string
+		contains    string
+	}{
+		{path: "/", status: http.StatusOK, contentType: "text/html", contains: "<html"},
+		{path: "/about", status: http.StatusOK, contentType: "text/html"},
+		{path: "/secret-project", status: http.StatusNotFound},
+		{path: "/no-such-page", status: http.StatusNotFound},
+		{path: healthPath, status: http.StatusOK},
+		{path: "/metrics", status: http.StatusOK, contains: "jsonsitego_"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := ts.Client().Get(ts.URL + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("GET %s = %d, want %d", tt.path, resp.StatusCode, tt.status)
+			}
+			if !strings.HasPrefix(resp.Header.Get("Content-Type"), tt.contentType) {
+				t.Errorf("GET %s content type = %s, want %s", tt.path, resp.Header.Get("Content-Type"), tt.contentType)
+			}
+			if !strings.Contains(string(body), tt.contains) {
+				t.Errorf("GET %s has no %q", tt.path, tt.contains)
+			}
+		})
+	}
+}
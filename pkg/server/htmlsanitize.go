@@ -0,0 +1,138 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/sanitize"
+)
+
+// the builtin sanitize policies, a policy of the config can't take their names
+const (
+	sanitizeText = "text" // keeps the text only
+	sanitizeUGC  = "ugc"  // formatting, headings, lists, quotes, code, tables, links and images
+)
+
+// sanitizeElementRegex matches the names of the elements and attributes of a policy.
+var sanitizeElementRegex = regexp.MustCompile(`^[a-z][a-z0-9-]*(:[a-z][a-z0-9-]*)?$`)
+
+// SanitizePolicy lists the html kept from a field by a policy of the sanitize config.
+type SanitizePolicy struct {
+	Elements   []string            `json:"elements"`             // allowed elements, the others are removed keeping their text
+	Attributes map[string][]string `json:"attributes,omitempty"` // allowed attributes by element, those of * on all the elements
+	URLSchemes []string            `json:"urlSchemes,omitempty"` // schemes allowed in href and src, only the relative urls without
+}
+
+// getSanitizePolicy returns the policy name of config, a builtin one or one of its sanitize policies.
+func getSanitizePolicy(config *SiteConfig, name string) (*sanitize.Policy, bool) {
+	switch name {
+	case sanitizeText:
+		return sanitize.Text(), true
+	case sanitizeUGC:
+		return sanitize.UGC(), true
+	}
+	policy, found := config.Sanitize[name]
+	if !found {
+		return nil, false
+	}
+	return &sanitize.Policy{Elements: policy.Elements, Attributes: policy.Attributes, URLSchemes: policy.URLSchemes}, true
+}
+
+// sanitizeHTML returns the html of value kept by the policy name of config, the template func sanitize.
+func sanitizeHTML(config *SiteConfig, name string, value interface{}) (template.HTML, error) {
+	policy, found := getSanitizePolicy(config, name)
+	if !found {
+		return "", fmt.Errorf("unknown sanitize policy %q", name)
+	}
+	if value == nil {
+		return "", nil
+	}
+	return template.HTML(policy.Sanitize(fmt.Sprint(value))), nil
+}
+
+// sanitizeDataFields replaces the string fields of data named by the keys of fields, like body or items.body
+// through the arrays, by their html kept by the policy of the field.
+func sanitizeDataFields(config *SiteConfig, data interface{}, fields map[string]string) interface{} {
+	for field, name := range fields {
+		// the policies are checked by validateSanitize
+		if policy, found := getSanitizePolicy(config, name); found {
+			data = sanitizeDataField(data, strings.Split(field, "."), policy)
+		}
+	}
+	return data
+}
+
+// sanitizeDataField sanitizes the field at path in data, the arrays are traversed.
+func sanitizeDataField(data interface{}, path []string, policy *sanitize.Policy) interface{} {
+	switch v := data.(type) {
+	case []interface{}:
+		for i := range v {
+			v[i] = sanitizeDataField(v[i], path, policy)
+		}
+	case map[string]interface{}:
+		child, found := v[path[0]]
+		if !found {
+			return data
+		}
+		if len(path) > 1 {
+			v[path[0]] = sanitizeDataField(child, path[1:], policy)
+		} else if s, ok := child.(string); ok {
+			v[path[0]] = template.HTML(policy.Sanitize(s))
+		}
+	}
+	return data
+}
+
+// validateSanitize checks the names of the policies and of their elements and attributes, and that the policies
+// used by the content files and the data sources exist.
+func validateSanitize(config *SiteConfig) []ConfigError {
+	var problems []ConfigError
+	for name, policy := range config.Sanitize {
+		pointer := "/sanitize/" + name
+		if name == sanitizeText || name == sanitizeUGC {
+			problems = append(problems, ConfigError{Pointer: pointer, Message: "the name of a builtin policy, choose another one"})
+			continue
+		}
+		for i, element := range policy.Elements {
+			if !sanitizeElementRegex.MatchString(element) {
+				problems = append(problems, ConfigError{Pointer: fmt.Sprintf("%s/elements/%d", pointer, i), Value: element, Message: "not a lowercase element name"})
+			} else if sanitize.IsDropped(element) {
+				problems = append(problems, ConfigError{Pointer: fmt.Sprintf("%s/elements/%d", pointer, i), Value: element, Message: "this element is always removed with its content"})
+			}
+		}
+		for element, attributes := range policy.Attributes {
+			if element != "*" && !slices.Contains(policy.Elements, element) {
+				problems = append(problems, ConfigError{Pointer: pointer + "/attributes/" + element, Message: "the element is not in the elements of the policy"})
+			}
+			for i, attribute := range attributes {
+				if !sanitizeElementRegex.MatchString(attribute) || strings.HasPrefix(attribute, "on") {
+					problems = append(problems, ConfigError{Pointer: fmt.Sprintf("%s/attributes/%s/%d", pointer, element, i), Value: attribute, Message: "not a lowercase attribute name, or an event handler"})
+				}
+			}
+		}
+		for i, scheme := range policy.URLSchemes {
+			if slices.Contains([]string{"javascript", "vbscript", "data"}, strings.ToLower(scheme)) {
+				problems = append(problems, ConfigError{Pointer: fmt.Sprintf("%s/urlSchemes/%d", pointer, i), Value: scheme, Message: "this scheme can run scripts"})
+			}
+		}
+	}
+	if config.Content != nil && config.Content.Sanitize != "" {
+		if _, found := getSanitizePolicy(config, config.Content.Sanitize); !found {
+			problems = append(problems, ConfigError{Pointer: "/content/sanitize", Value: config.Content.Sanitize, Message: "unknown sanitize policy"})
+		}
+	}
+	for i, page := range config.Pages {
+		if page.DataSource == nil {
+			continue
+		}
+		for field, name := range page.DataSource.Sanitize {
+			if _, found := getSanitizePolicy(config, name); !found {
+				problems = append(problems, ConfigError{Pointer: fmt.Sprintf("/pages/%d/dataSource/sanitize/%s", i, field), Value: name, Message: "unknown sanitize policy"})
+			}
+		}
+	}
+	return problems
+}
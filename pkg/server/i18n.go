@@ -0,0 +1,194 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+)
+
+const defaultLanguage = "en"
+
+// dateNames holds the localized names and layouts used by formatDate, golang.org/x/text does not provide them.
+type dateNames struct {
+	Months     [12]string
+	Days       [7]string // starting on Sunday like time.Weekday
+	ShortDate  string    // layout using the Go reference date
+	LongDate   string    // layout where "January" and "Monday" are replaced by the localized names
+	MediumDate string
+}
+
+var (
+	supportedDateLanguages = []language.Tag{
+		language.AmericanEnglish, // first one is the fallback of the matcher
+		language.BritishEnglish,
+		language.French,
+		language.German,
+		language.Italian,
+		language.Spanish,
+	}
+	dateLanguageMatcher = language.NewMatcher(supportedDateLanguages)
+	localizedDateNames  = map[string]dateNames{
+		"en-US": {
+			Months:     [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+			Days:       [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+			ShortDate:  "01/02/2006",
+			MediumDate: "January 2, 2006",
+			LongDate:   "Monday, January 2, 2006",
+		},
+		"en-GB": {
+			Months:     [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+			Days:       [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+			ShortDate:  "02/01/2006",
+			MediumDate: "2 January 2006",
+			LongDate:   "Monday 2 January 2006",
+		},
+		"fr": {
+			Months:     [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+			Days:       [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+			ShortDate:  "02/01/2006",
+			MediumDate: "2 January 2006",
+			LongDate:   "Monday 2 January 2006",
+		},
+		"de": {
+			Months:     [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+			Days:       [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+			ShortDate:  "02.01.2006",
+			MediumDate: "2. January 2006",
+			LongDate:   "Monday, 2. January 2006",
+		},
+		"it": {
+			Months:     [12]string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"},
+			Days:       [7]string{"domenica", "lunedì", "martedì", "mercoledì", "giovedì", "venerdì", "sabato"},
+			ShortDate:  "02/01/2006",
+			MediumDate: "2 January 2006",
+			LongDate:   "Monday 2 January 2006",
+		},
+		"es": {
+			Months:     [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+			Days:       [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+			ShortDate:  "02/01/2006",
+			MediumDate: "2 de January de 2006",
+			LongDate:   "Monday, 2 de January de 2006",
+		},
+	}
+)
+
+// getLanguageTag parses a language code like "fr-ch" or "en-us", falling back to English when it is invalid.
+func getLanguageTag(lang string) language.Tag {
+	tag, err := language.Parse(strings.TrimSpace(lang))
+	if err != nil {
+		return language.English
+	}
+	return tag
+}
+
+// getDateNames returns the best matching month and day names for the language.
+func getDateNames(lang string) dateNames {
+	_, index, _ := dateLanguageMatcher.Match(getLanguageTag(lang))
+	return localizedDateNames[supportedDateLanguages[index].String()]
+}
+
+// toTime converts a template value to a time, accepting time.Time and the RFC3339 or 2006-01-02 strings found in json.
+func toTime(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case *time.Time:
+		return *v, nil
+	case string:
+		for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+			if t, err := time.Parse(layout, strings.TrimSpace(v)); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("cannot parse date '%s'", v)
+	default:
+		return time.Time{}, fmt.Errorf("cannot format %T as a date", value)
+	}
+}
+
+// toFloat converts a template value to a float64, accepting numbers and numeric strings found in json.
+func toFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	default:
+		return 0, fmt.Errorf("cannot format %T as a number", value)
+	}
+}
+
+// formatDate formats a date for the language, style is one of "short", "medium" (the default) or "long".
+func formatDate(lang, style string, value interface{}) (string, error) {
+	t, err := toTime(value)
+	if err != nil {
+		return "", err
+	}
+	names := getDateNames(lang)
+	layout := names.MediumDate
+	switch style {
+	case "short":
+		return t.Format(names.ShortDate), nil
+	case "long":
+		layout = names.LongDate
+	}
+	// the names are replaced after formatting, the layout only uses the english reference names as placeholders
+	res := t.Format(layout)
+	res = strings.Replace(res, t.Weekday().String(), names.Days[t.Weekday()], 1)
+	res = strings.Replace(res, t.Month().String(), names.Months[t.Month()-1], 1)
+	return res, nil
+}
+
+// formatNumber formats a number with the grouping and decimal separators of the language.
+func formatNumber(lang string, value interface{}) (string, error) {
+	f, err := toFloat(value)
+	if err != nil {
+		return "", err
+	}
+	return message.NewPrinter(getLanguageTag(lang)).Sprint(number.Decimal(f)), nil
+}
+
+// formatCurrency formats an amount in the ISO 4217 currency (e.g. "CHF", "EUR") for the language.
+func formatCurrency(lang, code string, value interface{}) (string, error) {
+	f, err := toFloat(value)
+	if err != nil {
+		return "", err
+	}
+	unit, err := currency.ParseISO(code)
+	if err != nil {
+		return "", fmt.Errorf("invalid currency code '%s': %w", code, err)
+	}
+	return message.NewPrinter(getLanguageTag(lang)).Sprint(currency.Symbol(unit.Amount(f))), nil
+}
+
+// getI18nFuncMap returns the locale aware template helpers bound to the given language.
+func getI18nFuncMap(lang string) template.FuncMap {
+	if strings.TrimSpace(lang) == "" {
+		lang = defaultLanguage
+	}
+	return template.FuncMap{
+		"formatDate": func(style string, value interface{}) (string, error) {
+			return formatDate(lang, style, value)
+		},
+		"formatNumber": func(value interface{}) (string, error) {
+			return formatNumber(lang, value)
+		},
+		"formatCurrency": func(code string, value interface{}) (string, error) {
+			return formatCurrency(lang, code, value)
+		},
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/internal/siteerrors"
+)
+
+// IPAccessRule allows or denies client addresses on the paths under a prefix, like /admin or / for every path.
+// every rule matching a path applies : a client must not be in any deny list nor missing from any allow list.
+type IPAccessRule struct {
+	Prefix string   `json:"prefix"`          // path prefix, /admin matches /admin and /admin/... but not /administrator
+	Allow  []string `json:"allow,omitempty"` // ip addresses or cidr ranges allowed, every other address is denied
+	Deny   []string `json:"deny,omitempty"`  // ip addresses or cidr ranges denied, even when they are allowed
+}
+
+// ipAccessRule is an IPAccessRule with its ranges parsed.
+type ipAccessRule struct {
+	prefix string
+	allow  []netip.Prefix
+	deny   []netip.Prefix
+}
+
+// validateIPAccess checks the prefixes and the addresses and ranges of the ipAccess rules.
+func validateIPAccess(config *SiteConfig) []ConfigError {
+	var problems []ConfigError
+	for i, rule := range config.IPAccess {
+		pointer := fmt.Sprintf("/ipAccess/%d", i)
+		if !strings.HasPrefix(rule.Prefix, "/") {
+			problems = append(problems, ConfigError{Pointer: pointer + "/prefix", Value: rule.Prefix, Message: "the prefix must be a path like /admin, or / for every path"})
+		}
+		if len(rule.Allow) == 0 && len(rule.Deny) == 0 {
+			problems = append(problems, ConfigError{Pointer: pointer, Value: rule.Prefix, Message: "the rule needs an allow or a deny list"})
+		}
+		for _, list := range []struct {
+			name   string
+			values []string
+		}{{"allow", rule.Allow}, {"deny", rule.Deny}} {
+			for j, value := range list.values {
+				_, err := parseTrustedProxies([]string{value})
+				if err == nil && strings.TrimSpace(value) == "" {
+					err = errors.New("the value is empty")
+				}
+				if err != nil {
+					problems = append(problems, ConfigError{Pointer: fmt.Sprintf("%s/%s/%d", pointer, list.name, j), Value: value, Message: fmt.Sprintf("invalid ip address or cidr range: %v", err)})
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// getIPAccessRules parses the ipAccess rules of the config, already checked by validateIPAccess.
+func getIPAccessRules(config *SiteConfig) []ipAccessRule {
+	rules := make([]ipAccessRule, 0, len(config.IPAccess))
+	for _, rule := range config.IPAccess {
+		allow, _ := parseTrustedProxies(rule.Allow)
+		deny, _ := parseTrustedProxies(rule.Deny)
+		rules = append(rules, ipAccessRule{prefix: rule.Prefix, allow: allow, deny: deny})
+	}
+	return rules
+}
+
+// matches reports whether path is under the prefix of the rule, on a segment boundary.
+func (rule ipAccessRule) matches(path string) bool {
+	prefix := strings.TrimSuffix(rule.prefix, "/")
+	return prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// isIPAllowed reports whether addr may request path, it returns the prefix of the rule denying it otherwise.
+func isIPAllowed(rules []ipAccessRule, path string, addr netip.Addr) (bool, string) {
+	for _, rule := range rules {
+		if !rule.matches(path) {
+			continue
+		}
+		if !addr.IsValid() || isTrustedProxy(rule.deny, addr) || (len(rule.allow) > 0 && !isTrustedProxy(rule.allow, addr)) {
+			return false, rule.prefix
+		}
+	}
+	return true, ""
+}
+
+// withIPAccess answers 403 to the clients denied by the ipAccess rules of the site currently served. it runs after
+// withTrustedProxies, so the address checked is the client one given by a trusted proxy.
+func withIPAccess(next http.Handler, l *log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		site := getLiveSite()
+		if len(site.IPAccess) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		addr, _ := netip.ParseAddr(getClientIP(r))
+		allowed, prefix := isIPAllowed(site.IPAccess, r.URL.Path, addr.Unmap())
+		if allowed {
+			next.ServeHTTP(w, r)
+			return
+		}
+		l.Printf("💥 request to %s from %s denied by the ipAccess rule of %s", r.URL.Path, getClientIP(r), prefix)
+		w.Header().Set("Cache-Control", "no-store")
+		data := PageData{
+			Site:        site.Config,
+			Page:        &Page{Route: r.URL.Path, Title: "Forbidden"},
+			Theme:       getThemeFromCookie(r),
+			Request:     getRequestInfo(r, site.Config),
+			CurrentPath: r.URL.Path,
+			Flags:       getFlags(site.Config),
+		}
+		renderError(w, r, siteerrors.Forbidden("your address is not allowed to access this page"), data, l)
+	})
+}
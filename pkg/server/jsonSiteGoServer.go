@@ -0,0 +1,861 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/internal/siteerrors"
+	siteconfig "github.com/lao-tseu-is-alive/JsonSiteGo/pkg/config"
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/render"
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/storage"
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/version"
+)
+
+const (
+	defaultTemplatesDir   = "templates"
+	defaultStaticDir      = "static"
+	staticURLPrefix       = "/static/"   // url prefix of the files in pathToStatic
+	themeCookieName       = "theme"      // signed cookie of the theme chosen by the visitor
+	themeAPIPath          = "/api/theme" // json endpoint of the theme toggle script, /set-theme is its fallback without javascript
+	initCallMsg           = "INITIAL CALL TO %s()\n"
+	defaultPort           = 8888
+	defaultLogName        = "stderr"
+	defaultSiteConfigFile = "config.json"
+	defaultSchemaFile     = "https://raw.githubusercontent.com/lao-tseu-is-alive/JsonSiteGo/refs/heads/main/config.schema.json"
+	customContentTemplate = `
+        {{define "main"}}
+            <main id="main-content" class="container" tabindex="-1">
+                <h1>{{.Page.Title}}</h1>
+                {{range .Page.CustomContent}}
+                    {{renderBlock .}}
+                {{end}}
+                {{if .Page.Form}}
+                    {{template "Form" .}}
+                {{end}}
+            </main>
+        {{end}}`
+)
+
+var (
+	// templateCache holds all final, assembled templates, including error pages, read with getCachedTemplate.
+	templateCache = make(map[string]TemplateRenderer)
+	// templateCacheMu guards templateCache, replaced as a whole when another config version is applied.
+	templateCacheMu sync.RWMutex
+	// pathToTemplates is the directory of the templates, set from env TEMPLATES_DIR at startup
+	pathToTemplates = defaultTemplatesDir
+	// pathToStatic is the directory whose files are served as is under staticURLPrefix, set from env STATIC_DIR at startup
+	pathToStatic = defaultStaticDir
+)
+
+// Route represents a parsed HTTP route.
+type Route struct {
+	Method string
+	Path   string
+}
+
+// Author contains author information
+type Author struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// SiteConfig holds the overall site configuration read from the config file.
+type SiteConfig struct {
+	Title             string                    `json:"title"`
+	BaseURL           string                    `json:"baseURL"`
+	Language          string                    `json:"language"`
+	Description       string                    `json:"description"`
+	Author            Author                    `json:"author"`
+	Social            map[string]string         `json:"social"`                // e.g., "github": "https://..."
+	SocialOrder       []string                  `json:"socialOrder,omitempty"` // order of the social links, the platforms not listed follow by name
+	Footer            string                    `json:"footer"`
+	Pages             []Page                    `json:"pages"`
+	CDN               *CDNConfig                `json:"cdn,omitempty"`               // optional CDN cache tags and purge settings
+	Themes            []string                  `json:"themes,omitempty"`            // extra theme names, besides auto, light and dark, usable with ?previewTheme
+	EmbedPrivacy      string                    `json:"embedPrivacy,omitempty"`      // privacy mode of the Embed components : click-to-load (default), no-cookie or off
+	Templates         *TemplatesConfig          `json:"templates,omitempty"`         // optional template engine settings like custom delimiters
+	Menus             map[string][]MenuItem     `json:"menus,omitempty"`             // named menus like main, footer or sidebar
+	Favicon           string                    `json:"favicon,omitempty"`           // png, jpeg or gif source of the generated icons and web manifest
+	ThemeColor        string                    `json:"themeColor,omitempty"`        // color of the browser interface, like #1e88e5
+	BackgroundColor   string                    `json:"backgroundColor,omitempty"`   // color of the splash screen of the installed site
+	WellKnown         map[string]WellKnownFile  `json:"wellKnown,omitempty"`         // files served by url path, like /robots.txt or /.well-known/security.txt
+	Events            []Event                   `json:"events,omitempty"`            // events listed by the Events component and exported in /events.ics
+	Snippets          map[string][]ContentBlock `json:"snippets,omitempty"`          // named groups of blocks, included in the custom_content of the pages with {"snippet": "name"}
+	Params            map[string]interface{}    `json:"params,omitempty"`            // free values for the templates, like .Site.Params.phone
+	Mail              *MailConfig               `json:"mail,omitempty"`              // transport and sender of the emails, env SMTP_HOST and SMTP_FROM without it
+	ErrorReporting    *ErrorReportingConfig     `json:"errorReporting,omitempty"`    // forwards the panics and the responses 5xx to a Sentry compatible dsn or a webhook
+	Log               *LogConfig                `json:"log,omitempty"`               // level of the log and of its config, render and http messages, overridden by env LOG_LEVEL
+	Sanitize          map[string]SanitizePolicy `json:"sanitize,omitempty"`          // html sanitize policies by name, used with the builtin text and ugc ones
+	Notifications     *NotificationsConfig      `json:"notifications,omitempty"`     // webhooks notified of the events of the server, like a config reload that failed
+	Tasks             []ScheduledTask           `json:"tasks,omitempty"`             // jobs run periodically, like refreshing the data sources or rotating the log
+	Flags             map[string]bool           `json:"flags,omitempty"`             // feature flags of the templates, like .Flags.newFooter, overridden by env FLAGS and the admin endpoint
+	PWA               *PWAConfig                `json:"pwa,omitempty"`               // optional progressive web app mode
+	Debug             *DebugConfig              `json:"debug,omitempty"`             // optional /debug endpoint, needs the ADMIN_TOKEN
+	Server            *ServerConfig             `json:"server,omitempty"`            // optional timeouts and limits of the http server
+	Listeners         []ListenerConfig          `json:"listeners,omitempty"`         // addresses to listen on, default is one public listener on PORT
+	TrustedProxies    []string                  `json:"trustedProxies,omitempty"`    // ip addresses or cidr ranges of the proxies whose X-Forwarded-* headers are used
+	IPAccess          []IPAccessRule            `json:"ipAccess,omitempty"`          // optional client addresses allowed or denied by path prefix
+	CanonicalRedirect *CanonicalRedirectConfig  `json:"canonicalRedirect,omitempty"` // optional redirect of the other hosts and http to the baseURL
+	CORS              *CORSConfig               `json:"cors,omitempty"`              // optional access of the scripts of other origins to the responses
+	Audit             *AuditConfig              `json:"audit,omitempty"`             // optional append-only log of the admin actions, config loads and auth events
+	Auth              *AuthConfig               `json:"auth,omitempty"`              // optional OpenID Connect login and bearer tokens protecting the pages having a requiredRole
+	Content           *ContentConfig            `json:"content,omitempty"`           // optional settings of the content kept in git, see env CONTENT_GIT_URL
+	Maintenance       *MaintenanceConfig        `json:"maintenance,omitempty"`       // optional settings of the maintenance mode, like its lock file
+	Assets            *AssetsConfig             `json:"assets,omitempty"`            // optional external stylesheets and scripts, sent with their integrity hash
+	Cookies           *CookiesConfig            `json:"cookies,omitempty"`           // optional SameSite and Secure attributes of the cookies
+
+	raw          []byte // merged json the config was decoded from, kept by the config history
+	templatesDir string // directory of the templates of a tenant, pathToTemplates when empty
+	staticDir    string // directory of the static files of a tenant, pathToStatic when empty
+	tenant       string // name of the tenant of the config, empty for the site of the config file
+	rootDir      string // directory of a tenant, where all the paths of its config are resolved
+}
+
+// Page defines the structure for a single page in the website.
+type Page struct {
+	Route         string                 `json:"route"`                   // the http Mux router like GET /page
+	Title         string                 `json:"title"`                   // Page-specific title
+	Description   string                 `json:"description,omitempty"`   // Page-specific description
+	Draft         bool                   `json:"draft,omitempty"`         // Don't render if true
+	PublishAt     *time.Time             `json:"publishAt,omitempty"`     // Not rendered before this time, published without restart
+	ExpireAt      *time.Time             `json:"expireAt,omitempty"`      // Not rendered anymore from this time
+	ErrorHttpCode string                 `json:"ErrorHttpCode,omitempty"` // the actual http error template
+	ErrorMsg      string                 `json:"ErrorMsg,omitempty"`      // the actual http error msg
+	CreateHandler bool                   `json:"create_handler"`          // Should we register an handler
+	ShowInMenu    bool                   `json:"showInMenu"`              // Control visibility in nav
+	MenuOrder     int                    `json:"menuOrder,omitempty"`     // Control nav order
+	Tags          []string               `json:"tags,omitempty"`          // Used to derive the CDN surrogate keys
+	Language      string                 `json:"language,omitempty"`      // Overrides the site language for this page
+	Content       string                 `json:"content,omitempty"`
+	CustomContent []ContentBlock         `json:"custom_content"`
+	Template      string                 `json:"template"`
+	Layout        string                 `json:"layout"`
+	DataSource    *DataSource            `json:"dataSource,omitempty"`   // Optional dynamic content loaded at request time
+	Form          *Form                  `json:"form,omitempty"`         // Optional form processed by a POST handler on the same route
+	Autoindex     *Autoindex             `json:"autoindex,omitempty"`    // Optional listing of a directory tree, the route ends with {path...}
+	RequiredRole  string                 `json:"requiredRole,omitempty"` // Only authenticated users having this role, or any of them with *, can see the page
+	VisibleTo     []string               `json:"visibleTo,omitempty"`    // Only the users having one of these roles see the page, in the menus too
+	Cache         *CachePolicy           `json:"cache,omitempty"`        // Cache-Control and Vary headers, and the in-memory output cache
+	Params        map[string]interface{} `json:"params,omitempty"`       // Free values for the templates, like .Page.Params.hero
+	Experiment    *Experiment            `json:"experiment,omitempty"`   // Optional A/B test showing a variant of the page to each visitor
+	Body          template.HTML          `json:"-"`                      // html of the content file of the page, see ContentConfig.Dir
+}
+
+// ContentBlock defines a generic block of content.
+type ContentBlock struct {
+	Type      string                 `json:"type"` // e.g., "AccordionCard", "AccordionFormGroup", "Table"
+	KeyValues map[string]interface{} `json:"keyValues"`
+	VisibleTo []string               `json:"visibleTo,omitempty"` // only the users having one of these roles see the block
+	When      string                 `json:"when,omitempty"`      // expression rendering the block only when true, like date.month == 12
+	Snippet   string                 `json:"snippet,omitempty"`   // name of the snippet whose blocks replace this one when the config is loaded
+}
+
+// PageData holds data passed to templates, including the current theme.
+type PageData struct {
+	Site        *SiteConfig
+	Page        *Page
+	Theme       string
+	MenuPages   []Page
+	Menus       map[string][]MenuItem // the menus of the site by name, like .Menus.footer
+	Params      map[string]string     // values of the route wildcards, e.g. .Params.slug for GET /docs/{slug}
+	Data        interface{}           // content resolved from the page data source, if any
+	DataStatus  *DataStatus           // freshness of .Data, like .DataStatus.Stale, nil without data source
+	Flashes     []FlashMessage        // one-time messages set by the previous request, rendered by the FlashMessages partial
+	User        *User                 // the authenticated user, nil for the anonymous visitors
+	Request     *RequestInfo          // path, query, whitelisted headers and device hints of the request
+	CurrentPath string                // path of the request, used with isActive to mark the current links
+	Variant     string                // name of the variant of the experiment of the page shown, empty without experiment
+	Flags       map[string]bool       // the feature flags of the site, with their overrides, like .Flags.newFooter
+}
+
+// errorPageTemplates is the error template of each status, the other statuses and the optional templates missing
+// use error_500.
+var errorPageTemplates = map[int]string{
+	http.StatusBadRequest:         "error_400",
+	http.StatusUnauthorized:       "error_403",
+	http.StatusForbidden:          "error_403",
+	http.StatusNotFound:           "error_404",
+	http.StatusServiceUnavailable: "error_503",
+}
+
+// defaultErrorMessages are the messages of the json errors of each kind when the error has no message.
+var defaultErrorMessages = map[siteerrors.Kind]string{
+	siteerrors.KindForbidden:    "you are not allowed to see this page",
+	siteerrors.KindUnauthorized: "you must be authenticated to see this page",
+	siteerrors.KindValidation:   "the request is invalid",
+	siteerrors.KindUnavailable:  "the site is under maintenance",
+}
+
+// renderError serves err with the status of its kind, as a json error envelope when the client prefers json, else
+// as the error page of the status rendered with the cached template. an error without kind is an internal error.
+func renderError(w http.ResponseWriter, r *http.Request, err error, data PageData, l *log.Logger) {
+	e := siteerrors.From(err)
+	status := e.Status()
+	message := e.Message
+	switch e.Kind {
+	case siteerrors.KindNotFound:
+		l.Printf("renderError: in handler '%s' this path was not found: %v", data.Page.Route, r.URL.Path)
+		if message == "" {
+			message = fmt.Sprintf("the resource '%s' was not found", r.URL.Path)
+		}
+	case siteerrors.KindInternal:
+		l.Printf("error in %s was: %v", data.Page.Route, err)
+		recordRequestError(r, err)
+		message = e.Error()
+	}
+	if wantsJSON(r) {
+		if message == "" {
+			message = defaultErrorMessages[e.Kind]
+		}
+		writeJSONError(w, r, status, message)
+		return
+	}
+	switch e.Kind {
+	case siteerrors.KindNotFound:
+		message += "."
+	case siteerrors.KindInternal:
+		message = "error in server " + message
+	}
+	data.Page.ErrorHttpCode = errorPageTemplates[status]
+	if _, ok := getCachedTemplate(r, data.Page.ErrorHttpCode); !ok {
+		data.Page.ErrorHttpCode = "error_500"
+	}
+	data.Page.ErrorMsg = message
+	renderErrorPage(w, r, status, data, l)
+}
+
+// renderErrorPage renders the cached error template data.Page.ErrorHttpCode in a buffer, so that the response
+// gets an accurate Content-Length and a template error does not leave a truncated page.
+func renderErrorPage(w http.ResponseWriter, r *http.Request, status int, data PageData, l *log.Logger) {
+	tmpl, ok := getCachedTemplate(r, data.Page.ErrorHttpCode)
+	if !ok {
+		// Fallback in case the template is somehow missing from the cache
+		http.Error(w, fmt.Sprintf("Critical Error: %d %s template is missing", status, http.StatusText(status)), http.StatusInternalServerError)
+		return
+	}
+	recordTemplate(r, data.Page.ErrorHttpCode)
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, render.LayoutEntryTemplate, data); err != nil {
+		l.Printf("error in %s rendering %s doing ExecuteTemplate: %v", data.Page.Route, data.Page.ErrorHttpCode, err)
+		recordRequestError(r, fmt.Errorf("error template %s failed: %w", data.Page.ErrorHttpCode, err))
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	writeResponse(w, r, status, "text/html; charset=utf-8", render.ApplyMarks(buf.Bytes(), isDebugTemplatesRequest(r)))
+}
+
+// LoadConfig merges the config file with its APP_ENV overlay, then validates the result against the schema before decoding.
+// validation problems are returned as a *ConfigValidationError giving the position of each one in the file.
+func LoadConfig(configPath, schemaPath string, l *log.Logger) (*SiteConfig, error) {
+	l = getComponentLogger(l, logComponentConfig)
+	sources, data, err := siteconfig.LoadSources(configPath, l)
+	if err != nil {
+		return nil, err
+	}
+	return parseConfig(sources, data, schemaPath, l)
+}
+
+// configOptions tell parseConfigIn where a config comes from.
+type configOptions struct {
+	templatesDir string // of its templates, pathToTemplates when empty
+	staticDir    string // of its static files, pathToStatic when empty
+	rootDir      string // of a tenant, its paths are relative to it and cannot leave it
+	untrusted    bool   // the config of a tenant, a preview or an editor, it cannot have secret values
+}
+
+// parseConfig validates the merged json data of the config sources against the schema, then decodes and checks it.
+func parseConfig(sources []configSource, data []byte, schemaPath string, l *log.Logger) (*SiteConfig, error) {
+	return parseConfigIn(sources, data, schemaPath, configOptions{}, l)
+}
+
+// parseConfigIn is parseConfig for a config of the origin described by opts.
+func parseConfigIn(sources []configSource, data []byte, schemaPath string, opts configOptions, l *log.Logger) (*SiteConfig, error) {
+	config := SiteConfig{templatesDir: opts.templatesDir, staticDir: opts.staticDir, rootDir: opts.rootDir}
+	secretPointers, err := siteconfig.Decode(sources, data, schemaPath, !opts.untrusted, &config, l)
+	if err != nil {
+		return nil, err
+	}
+	var problems []ConfigError
+	problems = append(problems, validateTenantPaths(&config)...)
+	problems = append(problems, loadContentPages(&config)...)
+	blockProblems, err := validateContentBlocks(&config)
+	if err != nil {
+		return nil, err
+	}
+	problems = append(problems, blockProblems...)
+	problems = append(problems, validateMenus(&config)...)
+	problems = append(problems, validatePWA(&config)...)
+	problems = append(problems, validateServer(&config)...)
+	problems = append(problems, validateListeners(&config)...)
+	problems = append(problems, validateTrustedProxies(&config)...)
+	problems = append(problems, validateIPAccess(&config)...)
+	problems = append(problems, validateCanonicalRedirect(&config)...)
+	problems = append(problems, validateCORS(&config)...)
+	problems = append(problems, validateAuth(&config)...)
+	problems = append(problems, validateVisibility(&config)...)
+	problems = append(problems, validateAudit(&config)...)
+	problems = append(problems, validateContent(&config)...)
+	problems = append(problems, validatePublishing(&config)...)
+	problems = append(problems, validateMaintenance(&config)...)
+	problems = append(problems, validateCachePolicies(&config)...)
+	problems = append(problems, validateRequestHeaders(&config)...)
+	problems = append(problems, validateAssets(&config)...)
+	problems = append(problems, validateCookies(&config)...)
+	problems = append(problems, validateWellKnown(&config)...)
+	problems = append(problems, validateEvents(&config)...)
+	problems = append(problems, validateAutoindex(&config)...)
+	problems = append(problems, validateWhen(&config)...)
+	problems = append(problems, validateSnippets(&config)...)
+	problems = append(problems, validateExperiments(&config)...)
+	problems = append(problems, validateFlags(&config)...)
+	problems = append(problems, validateTasks(&config)...)
+	problems = append(problems, validateNotifications(&config)...)
+	problems = append(problems, validateMail(&config)...)
+	problems = append(problems, validateNewsletter(&config)...)
+	problems = append(problems, validateErrorReporting(&config)...)
+	problems = append(problems, validateLog(&config)...)
+	problems = append(problems, validateSanitize(&config)...)
+	problems = append(problems, validateDataSources(&config)...)
+	problems = append(problems, validatePageTemplates(&config)...)
+	problems = append(problems, validateRoutes(&config)...)
+	if len(problems) > 0 {
+		cfgErr := siteconfig.NewValidationError(sources, siteconfig.MaskSecrets(problems, secretPointers))
+		l.Printf("%v", cfgErr)
+		return nil, cfgErr
+	}
+	l.Println("✅ Content blocks validated successfully against component schemas.")
+	expandSnippets(&config)
+	config.raw = data
+	return &config, nil
+}
+
+// isDevMode reports whether the server runs in development mode, when env APP_ENV is dev or development.
+func isDevMode() bool {
+	env := siteconfig.AppEnv()
+	return env == "dev" || env == "development"
+}
+
+// getPortFromEnvOrPanic returns a valid TCP/IP port from the environment or a default.
+func getPortFromEnvOrPanic(defaultPort int) int {
+	srvPort := defaultPort
+	if val, exist := os.LookupEnv("PORT"); exist {
+		if p, err := strconv.Atoi(val); err == nil {
+			srvPort = p
+		} else {
+			panic(fmt.Errorf("💥💥 ERROR: CONFIG ENV PORT should contain a valid integer. %v", err))
+		}
+	}
+	if srvPort < 1 || srvPort > 65535 {
+		panic(fmt.Errorf("💥💥 ERROR: PORT should contain an integer between 1 and 65535"))
+	}
+	return srvPort
+}
+
+// getStoreFromEnvOrPanic returns the storage used for the runtime state from the content of the env variable :
+// STORAGE_URL : like memory:// (default), file:///var/lib/jsonsitego or s3://bucket/prefix
+func getStoreFromEnvOrPanic() storage.Store {
+	if siteconfig.IsFromStdin() {
+		return storage.NewMemoryStore()
+	}
+	store, err := storage.New(os.Getenv("STORAGE_URL"))
+	if err != nil {
+		panic(fmt.Errorf("💥💥 ERROR: CONFIG ENV STORAGE_URL is invalid. %v", err))
+	}
+	return store
+}
+
+// GetLogWriterFromEnvOrPanic returns the writer of the log from the content of the env variable :
+// LOG_FILE : comma separated targets of the log, like stderr,app.log@warning, each one being a filename, stdout,
+// stderr, DISCARD for no log, syslog, syslog://host:514, syslog+tcp://host:601, journald or eventlog, followed by
+// @warning or @error to only receive the messages of this level, default is STDERR
+func GetLogWriterFromEnvOrPanic(defaultLogName string) io.Writer {
+	logFileName := defaultLogName
+	val, exist := os.LookupEnv("LOG_FILE")
+	if exist {
+		logFileName = val
+	}
+	var targets []logTarget
+	for _, target := range strings.Split(logFileName, ",") {
+		name, severity := parseLogTarget(strings.TrimSpace(target))
+		w, err := getLogWriter(name)
+		if err != nil {
+			panic(fmt.Sprintf("💥💥 ERROR: LOG_FILE %q could not be open : %v", name, err))
+		}
+		targets = append(targets, logTarget{w: w, severity: severity})
+	}
+	if len(targets) == 1 && targets[0].severity == 0 {
+		return targets[0].w
+	}
+	return &multiLogWriter{targets: targets}
+}
+
+// themeCycle is the order of the built-in themes switched by the theme toggle, auto follows the prefers-color-scheme
+// of the browser and is the theme of the visitors without cookie.
+var themeCycle = []string{"auto", "light", "dark"}
+
+// isKnownTheme reports whether theme is one of the built-in themes or one declared in the site config.
+func isKnownTheme(site *SiteConfig, theme string) bool {
+	return slices.Contains(themeCycle, theme) || slices.Contains(site.Themes, theme)
+}
+
+// getPreviewTheme returns the theme requested with ?previewTheme=<name> when the request carries
+// the preview token, or an empty string. the visitor cookie is never touched by a preview.
+func getPreviewTheme(r *http.Request, site *SiteConfig, previewToken string) string {
+	theme := r.URL.Query().Get("previewTheme")
+	if theme == "" || !isKnownTheme(site, theme) || !isPreviewRequest(r, previewToken) {
+		return ""
+	}
+	return theme
+}
+
+// getThemeFromCookie retrieves the theme from the signed cookie or defaults to "auto".
+func getThemeFromCookie(r *http.Request) string {
+	theme, found := getSignedCookie(r, themeCookieName)
+	if !found || !slices.Contains(themeCycle, theme) {
+		return themeCycle[0]
+	}
+	return theme
+}
+
+// getNextTheme returns the theme following theme in the cycle auto, light, dark.
+func getNextTheme(theme string) string {
+	return themeCycle[(slices.Index(themeCycle, theme)+1)%len(themeCycle)]
+}
+
+// setThemeCookie remembers the theme chosen by the visitor, the toggle script reads the theme of the html instead.
+func setThemeCookie(w http.ResponseWriter, r *http.Request, site *SiteConfig, theme string) {
+	setSignedCookie(w, r, site, &http.Cookie{Name: themeCookieName, Value: theme, Path: "/", HttpOnly: true})
+}
+
+// getSetThemeHandler switches the theme cookie to the next theme of the cycle and redirects back to the referrer
+// when it is a page of the site, it is the fallback without javascript of the theme toggle.
+func getSetThemeHandler(site *SiteConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setThemeCookie(w, r, site, getNextTheme(getThemeFromCookie(r)))
+		http.Redirect(w, r, getSafeRedirect(r, site, r.Referer()), http.StatusSeeOther)
+	}
+}
+
+// ThemeRequest is the body of POST /api/theme.
+type ThemeRequest struct {
+	Theme string `json:"theme"` // auto, light or dark
+}
+
+// getThemeAPIHandler sets the theme cookie to the theme of the json body and answers 204, so that the theme toggle
+// script switches the data-theme of the page without reloading it.
+func getThemeAPIHandler(site *SiteConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// a json content type cannot be sent by a cross-site form, the browsers preflight it
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != mimeJSON {
+			writeJSONError(w, r, http.StatusUnsupportedMediaType, "the body must be json, like {\"theme\":\"dark\"}")
+			return
+		}
+		var req ThemeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid json body: %v", err))
+			return
+		}
+		if !slices.Contains(themeCycle, req.Theme) {
+			writeJSONError(w, r, http.StatusBadRequest, fmt.Sprintf("unknown theme %q, expected %s", req.Theme, strings.Join(themeCycle, ", ")))
+			return
+		}
+		setThemeCookie(w, r, site, req.Theme)
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// setTemplateCache replaces all the cached templates at once.
+func setTemplateCache(renderers map[string]TemplateRenderer) {
+	templateCacheMu.Lock()
+	defer templateCacheMu.Unlock()
+	templateCache = renderers
+}
+
+// getCachedTemplate returns the cached template of a page route or of an error page, the one of the preview site
+// when r is served by a preview.
+func getCachedTemplate(r *http.Request, name string) (TemplateRenderer, bool) {
+	if templates, ok := r.Context().Value(siteTemplatesKey{}).(map[string]TemplateRenderer); ok {
+		tmpl, ok := templates[name]
+		return tmpl, ok
+	}
+	templateCacheMu.RLock()
+	defer templateCacheMu.RUnlock()
+	tmpl, ok := templateCache[name]
+	return tmpl, ok
+}
+
+// getMenuPages returns the non-draft pages marked to be shown in the menu, sorted by MenuOrder.
+func getMenuPages(site *SiteConfig) []Page {
+	var menuPages []Page
+	now := time.Now()
+	for _, p := range site.Pages {
+		if isPublished(&p, now) && p.ShowInMenu {
+			menuPages = append(menuPages, p)
+		}
+	}
+	sort.Slice(menuPages, func(i, j int) bool {
+		return menuPages[i].MenuOrder < menuPages[j].MenuOrder
+	})
+	return menuPages
+}
+
+// getNotFoundHandler creates the catch-all handler used for any path that no page route matches.
+func getNotFoundHandler(site *SiteConfig, l *log.Logger) http.HandlerFunc {
+	menuPages := getMenuPages(site)
+	menus := getMenus(site)
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := PageData{
+			Site:        site,
+			Page:        &Page{Route: "/", Title: "Page Not Found"},
+			Theme:       getThemeFromCookie(r),
+			MenuPages:   menuPages,
+			Menus:       menus,
+			Request:     getRequestInfo(r, site),
+			CurrentPath: r.URL.Path,
+			Flags:       getFlags(site),
+		}
+		renderError(w, r, siteerrors.NotFound(""), data, l)
+	}
+}
+
+// getStaticHandler serves the files of the static directory, without listing the directories.
+func getStaticHandler(site *SiteConfig, l *log.Logger) http.HandlerFunc {
+	fileServer := http.StripPrefix(staticURLPrefix, http.FileServer(http.Dir(site.getStaticDir())))
+	notFound := getNotFoundHandler(site, l)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") {
+			notFound(w, r)
+			return
+		}
+		setDownloadDisposition(w, r)
+		fileServer.ServeHTTP(w, r)
+	}
+}
+
+// getHandler creates a generic HTTP handler for a given page.
+// the renderings of its output cache are kept in cacheStore when it is not nil.
+func getHandler(page *Page, site *SiteConfig, cacheStore storage.Store, l *log.Logger) http.HandlerFunc {
+	httpLog := getComponentLogger(l, logComponentHTTP)
+	l = getComponentLogger(l, logComponentRender)
+	logDebug(l, initCallMsg, page.Title)
+	parts := strings.Split(strings.TrimSpace(page.Route), " ")
+	route := Route{
+		Method: parts[0],
+		Path:   parts[1],
+	}
+	menuPages := getMenuPages(site)
+	menus := getMenus(site)
+	surrogateKeys := getSurrogateKeys(page)
+	paramNames := getRouteParamNames(route.Path)
+	previewToken := getPreviewTokenFromEnv()
+	chrome := getChromePathFromEnv()
+	cache := newOutputCache(page, cacheStore)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		logDebug(httpLog, "in handler '%s' url: %s from %s", page.Route, r.URL.Path, getClientIP(r))
+		previewTheme := getPreviewTheme(r, site, previewToken)
+		debugTemplates := isDebugTemplatesRequest(r)
+		cacheKey := cache.getKey(r, previewTheme)
+		if debugTemplates {
+			// the page showing its templates is never cached
+			cacheKey = ""
+		}
+		flags := getFlags(site)
+		if cacheKey != "" && flags != nil {
+			cacheKey += "\n" + getFlagsKey(flags)
+		}
+		templateKey := page.Route
+		var variant *ExperimentVariant
+		var assigned, reviewed bool
+		if page.Experiment != nil {
+			variant, assigned, reviewed = getExperimentVariant(r, page.Experiment)
+			templateKey = getVariantTemplateKey(page, variant)
+			if cacheKey != "" {
+				cacheKey += "\n" + variant.Name
+			}
+		}
+		// exposeVariant remembers and logs the variant shown, just before the page is sent
+		exposeVariant := func() {
+			if variant == nil {
+				return
+			}
+			if !reviewed {
+				if assigned {
+					setExperimentCookie(w, r, site, page.Experiment, variant)
+				}
+				logExperimentExposure(r, page.Experiment, variant, assigned, l)
+			}
+			// the variant depends on the cookie of the visitor, a shared cache would show the same one to everybody
+			if w.Header().Get("Cache-Control") != "no-store" {
+				w.Header().Set("Cache-Control", "private, no-cache")
+			}
+			w.Header().Add("Vary", "Cookie")
+		}
+		if cacheKey != "" {
+			if entry, ok := cache.get(r.Context(), cacheKey); ok {
+				if entry.ContentDisposition != "" {
+					w.Header().Set("Content-Disposition", entry.ContentDisposition)
+				}
+				setSurrogateKeyHeaders(w, surrogateKeys)
+				setCachePolicyHeaders(w, page.Cache)
+				exposeVariant()
+				writeResponse(w, r, http.StatusOK, entry.ContentType, entry.Body)
+				return
+			}
+		}
+		// each request works on its own copy, so that data sources and errors never alter the config
+		currentPage := *page
+		if variant != nil {
+			currentPage = getVariantPage(page, variant)
+		}
+		data := PageData{
+			Site:        site,
+			Page:        &currentPage,
+			Theme:       getThemeFromCookie(r),
+			MenuPages:   menuPages,
+			Menus:       menus,
+			Params:      getRouteParams(r, paramNames),
+			Flashes:     popFlashes(w, r, site),
+			User:        getUser(r),
+			Request:     getRequestInfo(r, site),
+			CurrentPath: r.URL.Path,
+			Flags:       flags,
+		}
+		if variant != nil {
+			data.Variant = variant.Name
+		}
+		data.MenuPages = getVisiblePages(menuPages, data.User)
+		currentPage.CustomContent = getVisibleBlocks(currentPage.CustomContent, data.User)
+		currentPage.CustomContent = getWhenBlocks(currentPage.CustomContent, whenScope{site: site, page: page, path: r.URL.Path, now: time.Now()})
+		if !isRoutePatternMatch(route.Path, r.URL.Path) {
+			l.Printf("💥 requested path %s is not here...", r.URL.Path)
+			renderError(w, r, siteerrors.NotFound(""), data, l)
+			return
+		}
+		if previewTheme != "" {
+			data.Theme = previewTheme
+		}
+		if page.DataSource != nil {
+			pageData, status, err := loadDataSourceStatus(r.Context(), site, page.DataSource, data.Params)
+			if err != nil {
+				renderError(w, r, err, data, l)
+				return
+			}
+			if status.Stale {
+				cause := "its last refresh failed"
+				if status.err != nil {
+					cause = status.err.Error()
+				}
+				l.Printf("⚠️ WARNING: request %s of %s served the copy of %s of its data source: %s", getRequestID(r), r.URL.Path, status.FetchedAt.Format(time.RFC3339), cause)
+			}
+			data.DataStatus = status
+			pageData = sanitizeDataFields(site, pageData, page.DataSource.Sanitize)
+			data.Data = pageData
+			applyDataToPage(&currentPage, pageData)
+		}
+		if page.Autoindex != nil {
+			listing, err := getAutoindexData(w, r, site, page.Autoindex, route.Path, data.Params)
+			if err != nil {
+				renderError(w, r, err, data, l)
+				return
+			}
+			if listing == nil {
+				// the file was served, or the directory redirected to its url with a slash
+				return
+			}
+			data.Data = listing
+		}
+		myTemplate, ok := getCachedTemplate(r, templateKey)
+		if !ok {
+			err := fmt.Errorf("template for route '%s' not found in cache", templateKey)
+			renderError(w, r, err, data, l)
+			return
+		}
+		format := getRenderFormat(r)
+		entryTemplate := render.LayoutEntryTemplate
+		if format != "" {
+			entryTemplate = render.PrintEntryTemplate
+		}
+		// render in a buffer so that errors can still produce a clean 500 and HEAD gets an accurate Content-Length
+		recordTemplate(r, templateKey)
+		logDebug(l, "rendering '%s' with template %s, theme: %q, variant: %q, params: %v, user: %v, flags: %v", page.Route, templateKey, data.Theme, data.Variant, data.Params, data.User != nil, data.Flags)
+		var buf bytes.Buffer
+		err := myTemplate.ExecuteTemplate(&buf, entryTemplate, data)
+		if err != nil {
+			l.Printf("💥💥 error in template execution err: %v ", err)
+			renderError(w, r, fmt.Errorf("template execution failed for %s: %w", page.Route, err), data, l)
+			return
+		}
+		if isDevMode() {
+			// the marks of the templates become comments and a panel with ?debugTemplates, they are removed otherwise
+			body := render.ApplyMarks(buf.Bytes(), debugTemplates && format == "")
+			buf.Reset()
+			buf.Write(body)
+		}
+		contentType := "text/html; charset=utf-8"
+		if format == formatPDF {
+			pdf, err := renderPDF(r.Context(), chrome, buf.Bytes(), site.BaseURL, fmt.Sprintf("%s | %s", currentPage.Title, site.Title))
+			if err != nil {
+				l.Printf("💥💥 error converting %s to pdf err: %v ", r.URL.Path, err)
+				renderError(w, r, fmt.Errorf("pdf export failed for %s: %w", page.Route, err), data, l)
+				return
+			}
+			buf.Reset()
+			buf.Write(pdf)
+			contentType = "application/pdf"
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, getPDFFileName(r.URL.Path)))
+		}
+		setSurrogateKeyHeaders(w, surrogateKeys)
+		setCachePolicyHeaders(w, page.Cache)
+		if len(data.Flashes) > 0 || previewTheme != "" || data.User != nil {
+			// a page showing one-time messages, a theme preview or a user must never be stored by a cache
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		if cacheKey != "" {
+			entry := outputCacheEntry{ContentType: contentType, ContentDisposition: w.Header().Get("Content-Disposition"), Body: buf.Bytes()}
+			if err := cache.put(r.Context(), cacheKey, entry); err != nil {
+				l.Printf("💥 warning: could not keep the rendering of %s in the output cache: %v", r.URL.Path, err)
+			}
+		}
+		exposeVariant()
+		writeResponse(w, r, http.StatusOK, contentType, buf.Bytes())
+	}
+}
+
+// getAllowedMethods returns, for each path having a handler, the list of http methods it accepts.
+// a GET route implicitly accepts HEAD, and every route accepts OPTIONS.
+func getAllowedMethods(site *SiteConfig) map[string][]string {
+	allowed := make(map[string][]string)
+	now := time.Now()
+	for _, page := range site.Pages {
+		if !page.CreateHandler || !isPublished(&page, now) {
+			continue
+		}
+		parts := strings.Fields(page.Route)
+		if len(parts) < 2 {
+			continue
+		}
+		method, path := parts[0], parts[1]
+		if !slices.Contains(allowed[path], method) {
+			allowed[path] = append(allowed[path], method)
+		}
+		if method == http.MethodGet && !slices.Contains(allowed[path], http.MethodHead) {
+			allowed[path] = append(allowed[path], http.MethodHead)
+		}
+		if page.Form != nil && !slices.Contains(allowed[path], http.MethodPost) {
+			allowed[path] = append(allowed[path], http.MethodPost)
+		}
+	}
+	for path := range allowed {
+		allowed[path] = append(allowed[path], http.MethodOptions)
+	}
+	return allowed
+}
+
+// getOptionsHandler answers OPTIONS requests for a path with the accurate Allow and CORS preflight headers.
+func getOptionsHandler(path string, methods []string, site *SiteConfig, l *log.Logger) http.HandlerFunc {
+	allow := strings.Join(methods, ", ")
+	notFound := getNotFoundHandler(site, l)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isRoutePatternMatch(path, r.URL.Path) {
+			notFound(w, r)
+			return
+		}
+		w.Header().Set("Allow", allow)
+		setCORSPreflightHeaders(w, r, site, methods)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Main runs the jsonSiteGoServer command : the check-links, routes, types, new-component and env subcommands, or the server
+// of the config given by the env variables and flags, or of the example site written by the example subcommand, until
+// it fails. the service subcommand installs the server as a systemd unit or a windows service, run by it.
+func Main() {
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == checkLinksCommand {
+		os.Exit(runCheckLinks(args[1:]))
+	}
+	if len(args) > 0 && args[0] == siteconfig.EncryptCommand {
+		os.Exit(runEncrypt(args[1:]))
+	}
+	if len(args) > 0 && args[0] == lintCommand {
+		os.Exit(runLint(args[1:]))
+	}
+	if len(args) > 0 && args[0] == routesCommand {
+		os.Exit(runRoutes(args[1:]))
+	}
+	if len(args) > 0 && args[0] == typesCommand {
+		os.Exit(runTypes(args[1:]))
+	}
+	if len(args) > 0 && args[0] == newComponentCommand {
+		os.Exit(runNewComponent(args[1:]))
+	}
+	if len(args) > 0 && args[0] == exampleCommand {
+		code, serve := runExample(args[1:])
+		if !serve {
+			os.Exit(code)
+		}
+		// the flags were parsed by the example subcommand
+		args = nil
+	}
+	asService := false
+	if len(args) > 0 && args[0] == serviceCommand {
+		code, serverArgs, serve := runServiceCommand(args[1:])
+		if !serve {
+			os.Exit(code)
+		}
+		asService, args = true, serverArgs
+	}
+	printEnv := len(args) > 0 && args[0] == envCommand
+	if printEnv {
+		args = args[1:]
+	}
+	fromFlags, err := parseFlagsToEnv(flag.NewFlagSet(version.APP, flag.ContinueOnError), args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		os.Exit(2)
+	}
+	if printEnv {
+		printEnvSettings(os.Stdout, fromFlags)
+		return
+	}
+
+	setLogLevelsFromEnvOrPanic()
+	l := newLevelLogger(GetLogWriterFromEnvOrPanic(defaultLogName), fmt.Sprintf("%s, ", version.APP), log.Ldate|log.Ltime|log.Lshortfile)
+	l.Printf("🚀🚀 Starting App: %s, version: %s, build: %s", version.APP, version.VERSION, version.BuildStamp)
+	if asService {
+		if err := serveAsService(l); err != nil {
+			l.Fatalf("💥💥 fatal %v", err)
+		}
+		return
+	}
+	srv, err := New(l)
+	if err != nil {
+		var cfgErr *ConfigValidationError
+		if isDevMode() && errors.As(err, &cfgErr) {
+			l.Fatalf("💥💥 fatal error serving configuration errors: %v", serveConfigErrors(fmt.Sprintf(":%d", getPortFromEnvOrPanic(defaultPort)), cfgErr, l))
+		}
+		l.Fatalf("💥💥 fatal %v", err)
+	}
+	if err := srv.ListenAndServe(); err != nil {
+		l.Fatalf("💥💥 Server failed to start: %v", err)
+	}
+}
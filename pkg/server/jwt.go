@@ -0,0 +1,340 @@
+package server
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	jwtLeeway          = time.Minute // clock skew tolerated on exp, nbf and iat
+	jwksRefreshMinimum = time.Minute // an unknown key id refetches the keys at most once per minute
+)
+
+var errInvalidToken = errors.New("invalid token")
+
+// jwtHeader is the part of the jose header used to verify a token.
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// jwtClaims are the claims of a verified token, the registered ones are checked by verifyJWT.
+type jwtClaims map[string]interface{}
+
+// getString returns the string claim name, or an empty string.
+func (c jwtClaims) getString(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// getTime returns the numeric date claim name, and false when it is missing.
+func (c jwtClaims) getTime(name string) (time.Time, bool) {
+	v, ok := c[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(v), 0), true
+}
+
+// hasAudience reports whether the aud claim, a string or an array, contains audience.
+func (c jwtClaims) hasAudience(audience string) bool {
+	switch aud := c["aud"].(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getStrings returns the claim at the dotted path, like realm_access.roles, as a list of strings.
+// a single string is split on spaces or commas, like the scope claim.
+func (c jwtClaims) getStrings(path string) []string {
+	var value interface{} = map[string]interface{}(c)
+	for _, key := range strings.Split(path, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = m[key]
+	}
+	switch v := value.(type) {
+	case string:
+		return strings.FieldsFunc(v, func(r rune) bool { return r == ' ' || r == ',' })
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// jwtKeySet holds the public keys of an issuer by key id, fetched from its jwks_uri, and an optional hmac secret.
+type jwtKeySet struct {
+	url       string
+	secret    []byte // verifies the HS256 tokens when set
+	client    *http.Client
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// newJWTKeySet returns a key set reading the keys at url when it is not empty.
+func newJWTKeySet(url string, secret []byte) *jwtKeySet {
+	return &jwtKeySet{url: url, secret: secret, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// getKey returns the public key kid, the keys are fetched again when kid is unknown, to follow the key rotations.
+func (ks *jwtKeySet) getKey(kid string) (crypto.PublicKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if key := ks.findKey(kid); key != nil {
+		return key, nil
+	}
+	if ks.url == "" {
+		return nil, fmt.Errorf("no jwks url to find the key '%s'", kid)
+	}
+	if time.Since(ks.fetchedAt) < jwksRefreshMinimum {
+		return nil, fmt.Errorf("unknown key '%s'", kid)
+	}
+	ks.fetchedAt = time.Now()
+	keys, err := fetchJWKS(ks.client, ks.url)
+	if err != nil {
+		return nil, err
+	}
+	ks.keys = keys
+	if key := ks.findKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key '%s'", kid)
+}
+
+// findKey returns the key kid, or the only key when the token has no kid.
+func (ks *jwtKeySet) findKey(kid string) crypto.PublicKey {
+	if kid == "" && len(ks.keys) == 1 {
+		for _, key := range ks.keys {
+			return key
+		}
+	}
+	return ks.keys[kid]
+}
+
+// jsonWebKey is a public key of a jwks document, only the RSA and EC keys are used.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// fetchJWKS downloads the signing keys of a jwks document.
+func fetchJWKS(client *http.Client, url string) (map[string]crypto.PublicKey, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching jwks %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching jwks %s: status %d", url, resp.StatusCode)
+	}
+	var doc struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("error decoding jwks %s: %w", url, err)
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range doc.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue // keys of unsupported types are ignored
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+// publicKey decodes the RSA or EC public key of the jwk.
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", jwk.Kty)
+}
+
+// getJWTHash returns the hash function of a signing algorithm like RS256, ES384 or HS512.
+func getJWTHash(alg string) (crypto.Hash, func() hash.Hash, error) {
+	switch alg[len(alg)-3:] {
+	case "256":
+		return crypto.SHA256, sha256.New, nil
+	case "384":
+		return crypto.SHA384, sha512.New384, nil
+	case "512":
+		return crypto.SHA512, sha512.New, nil
+	}
+	return 0, nil, fmt.Errorf("unsupported algorithm %s", alg)
+}
+
+// verifyJWTSignature checks the signature of the signed part of a token with the key set.
+func verifyJWTSignature(ks *jwtKeySet, header jwtHeader, signed string, signature []byte) error {
+	if len(header.Alg) != 5 {
+		return fmt.Errorf("unsupported algorithm %s", header.Alg)
+	}
+	hashID, newHash, err := getJWTHash(header.Alg)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(header.Alg, "HS") {
+		if len(ks.secret) == 0 {
+			return fmt.Errorf("no secret to verify %s tokens", header.Alg)
+		}
+		mac := hmac.New(newHash, ks.secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errInvalidToken
+		}
+		return nil
+	}
+	key, err := ks.getKey(header.Kid)
+	if err != nil {
+		return err
+	}
+	h := newHash()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+	switch header.Alg[:2] {
+	case "RS":
+		if rsaKey, ok := key.(*rsa.PublicKey); ok {
+			return rsa.VerifyPKCS1v15(rsaKey, hashID, digest, signature)
+		}
+	case "PS":
+		if rsaKey, ok := key.(*rsa.PublicKey); ok {
+			return rsa.VerifyPSS(rsaKey, hashID, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+	case "ES":
+		if ecKey, ok := key.(*ecdsa.PublicKey); ok {
+			size := (ecKey.Curve.Params().BitSize + 7) / 8
+			if len(signature) != 2*size {
+				return errInvalidToken
+			}
+			r, s := new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:])
+			if !ecdsa.Verify(ecKey, digest, r, s) {
+				return errInvalidToken
+			}
+			return nil
+		}
+	default:
+		return fmt.Errorf("unsupported algorithm %s", header.Alg)
+	}
+	return fmt.Errorf("the key '%s' does not match the algorithm %s", header.Kid, header.Alg)
+}
+
+// verifyJWT checks the signature, the issuer, the audience and the validity period of a compact jws token
+// and returns its claims. issuer and audience are required, a token is never accepted without checking them.
+func verifyJWT(ks *jwtKeySet, token, issuer, audience string) (jwtClaims, error) {
+	if issuer == "" || audience == "" {
+		return nil, fmt.Errorf("%w: no issuer or audience to check", errInvalidToken)
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: not a compact jws", errInvalidToken)
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: header: %v", errInvalidToken, err)
+	}
+	var header jwtHeader
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", errInvalidToken, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", errInvalidToken, err)
+	}
+	if err := verifyJWTSignature(ks, header, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", errInvalidToken, err)
+	}
+	rawClaims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", errInvalidToken, err)
+	}
+	var claims jwtClaims
+	if err := json.Unmarshal(rawClaims, &claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", errInvalidToken, err)
+	}
+	now := time.Now()
+	exp, ok := claims.getTime("exp")
+	if !ok || now.After(exp.Add(jwtLeeway)) {
+		return nil, fmt.Errorf("%w: expired", errInvalidToken)
+	}
+	if nbf, ok := claims.getTime("nbf"); ok && now.Add(jwtLeeway).Before(nbf) {
+		return nil, fmt.Errorf("%w: not valid yet", errInvalidToken)
+	}
+	if strings.TrimSuffix(claims.getString("iss"), "/") != strings.TrimSuffix(issuer, "/") {
+		return nil, fmt.Errorf("%w: issuer '%s' is not trusted", errInvalidToken, claims.getString("iss"))
+	}
+	if !claims.hasAudience(audience) {
+		return nil, fmt.Errorf("%w: audience is not %s", errInvalidToken, audience)
+	}
+	return claims, nil
+}
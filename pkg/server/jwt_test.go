@@ -0,0 +1,150 @@
+package server
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer   = "https://login.example.com/realms/intranet"
+	testAudience = "site"
+)
+
+// signTestJWT returns a compact jws of claims with header, signed by sign over the signing input.
+func signTestJWT(t *testing.T, header map[string]string, claims map[string]interface{}, sign func(signed string) []byte) string {
+	t.Helper()
+	rawHeader, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawClaims, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(rawHeader) + "." + base64.RawURLEncoding.EncodeToString(rawClaims)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign(signed))
+}
+
+func TestVerifyJWT(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := &jwtKeySet{keys: map[string]crypto.PublicKey{"k1": &key.PublicKey}}
+	rs256 := func(signed string) []byte {
+		digest := sha256.Sum256([]byte(signed))
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signature
+	}
+	// the classic confusion: an HS256 token whose secret is the public key of the issuer
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs256WithPublicKey := func(signed string) []byte {
+		mac := hmac.New(sha256.New, publicDER)
+		mac.Write([]byte(signed))
+		return mac.Sum(nil)
+	}
+	now := time.Now()
+	validClaims := func() map[string]interface{} {
+		return map[string]interface{}{"iss": testIssuer, "aud": testAudience, "sub": "alice", "exp": now.Add(time.Hour).Unix()}
+	}
+	with := func(name string, value interface{}) map[string]interface{} {
+		claims := validClaims()
+		claims[name] = value
+		return claims
+	}
+	rsHeader := map[string]string{"alg": "RS256", "kid": "k1"}
+	tests := []struct {
+		name     string
+		token    string
+		issuer   string
+		audience string
+		wantErr  string
+	}{
+		{name: "valid", token: signTestJWT(t, rsHeader, validClaims(), rs256)},
+		{name: "audience in a list", token: signTestJWT(t, rsHeader, with("aud", []string{"other", testAudience}), rs256)},
+		{name: "wrong audience", token: signTestJWT(t, rsHeader, with("aud", "other-client"), rs256), wantErr: "audience"},
+		{name: "no audience", token: signTestJWT(t, rsHeader, with("aud", nil), rs256), wantErr: "audience"},
+		{name: "wrong issuer", token: signTestJWT(t, rsHeader, with("iss", "https://evil.example.com"), rs256), wantErr: "issuer"},
+		{name: "expired", token: signTestJWT(t, rsHeader, with("exp", now.Add(-time.Hour).Unix()), rs256), wantErr: "expired"},
+		{name: "no expiry", token: signTestJWT(t, rsHeader, with("exp", nil), rs256), wantErr: "expired"},
+		{name: "not valid yet", token: signTestJWT(t, rsHeader, with("nbf", now.Add(time.Hour).Unix()), rs256), wantErr: "not valid yet"},
+		{name: "alg confusion HS256 with the public key", token: signTestJWT(t, map[string]string{"alg": "HS256", "kid": "k1"}, validClaims(), hs256WithPublicKey), wantErr: "signature"},
+		{name: "alg none", token: signTestJWT(t, map[string]string{"alg": "none"}, validClaims(), func(string) []byte { return nil }), wantErr: "signature"},
+		{name: "tampered claims", token: func() string {
+			token := signTestJWT(t, rsHeader, validClaims(), rs256)
+			parts := strings.Split(token, ".")
+			forged, _ := json.Marshal(with("sub", "admin"))
+			return parts[0] + "." + base64.RawURLEncoding.EncodeToString(forged) + "." + parts[2]
+		}(), wantErr: "signature"},
+		{name: "no issuer configured", token: signTestJWT(t, rsHeader, validClaims(), rs256), issuer: "-", wantErr: "no issuer"},
+		{name: "no audience configured", token: signTestJWT(t, rsHeader, validClaims(), rs256), audience: "-", wantErr: "no issuer or audience"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer, audience := testIssuer, testAudience
+			if tt.issuer == "-" {
+				issuer = ""
+			}
+			if tt.audience == "-" {
+				audience = ""
+			}
+			claims, err := verifyJWT(ks, tt.token, issuer, audience)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("verifyJWT() error = %v", err)
+				}
+				if claims.getString("sub") != "alice" {
+					t.Errorf("verifyJWT() sub = %q, want alice", claims.getString("sub"))
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("verifyJWT() accepted the token, want an error about %s", tt.wantErr)
+			}
+			if !errors.Is(err, errInvalidToken) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("verifyJWT() error = %v, want an invalid token error about %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateAuthRequiresIssuerAndAudience(t *testing.T) {
+	tests := []struct {
+		name string
+		auth AuthConfig
+		want []string
+	}{
+		{name: "login", auth: AuthConfig{Issuer: testIssuer, ClientID: testAudience}},
+		{name: "bearer tokens of an audience", auth: AuthConfig{Issuer: testIssuer, JWKSURL: testIssuer + "/certs", Audience: "api"}},
+		{name: "issuer only", auth: AuthConfig{Issuer: testIssuer}, want: []string{"/auth/audience"}},
+		{name: "jwksURL only", auth: AuthConfig{JWKSURL: testIssuer + "/certs"}, want: []string{"/auth/issuer", "/auth/audience"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &SiteConfig{BaseURL: "https://example.com/", Auth: &tt.auth}
+			var got []string
+			for _, ce := range validateAuth(config) {
+				got = append(got, ce.Pointer)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("validateAuth() problems at %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
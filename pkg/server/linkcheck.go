@@ -0,0 +1,332 @@
+package server
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/storage"
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/version"
+)
+
+const (
+	checkLinksCommand       = "check-links" // subcommand reporting the broken links of the site
+	defaultLinkCheckWorkers = 8
+	defaultLinkCheckTimeout = 10 * time.Second
+	maxLinkCheckURLs        = 10000   // the crawl stops there, in case a page links ever new urls
+	maxLinkCheckPageSize    = 5 << 20 // the links of the pages larger than 5 MiB are not followed
+)
+
+// linkRegex matches the urls of the href and src attributes of a page.
+var linkRegex = regexp.MustCompile(`(?i)\s(?:href|src)\s*=\s*"([^"]*)"`)
+
+// excludeFlag collects the -exclude regular expressions, the flag can be given several times.
+type excludeFlag []*regexp.Regexp
+
+func (e *excludeFlag) String() string {
+	patterns := make([]string, len(*e))
+	for i, re := range *e {
+		patterns[i] = re.String()
+	}
+	return strings.Join(patterns, ", ")
+}
+
+func (e *excludeFlag) Set(value string) error {
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return err
+	}
+	*e = append(*e, re)
+	return nil
+}
+
+// LinkCheckResult is the outcome of the check of one url.
+type LinkCheckResult struct {
+	URL      string
+	Status   int      // http status, 0 when the request failed
+	Err      error    // error of the request
+	Sources  []string // pages linking the url
+	External bool
+}
+
+// isBroken reports whether the url could not be fetched or answered an error.
+func (r *LinkCheckResult) isBroken() bool {
+	return r.Err != nil || r.Status >= http.StatusBadRequest
+}
+
+// linkChecker crawls the pages of a site from its base url, following its internal links.
+type linkChecker struct {
+	base     *url.URL                       // the site crawled
+	aliases  []string                       // other hosts of the site, like the one of its baseURL when it is rendered locally
+	external bool                           // check the external links too
+	exclude  []*regexp.Regexp               // urls neither checked nor followed
+	onPage   func(path string, body []byte) // called with each internal html page crawled, concurrently
+	client   *http.Client
+	workers  chan struct{} // limits the requests in progress
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	results  map[string]*LinkCheckResult
+}
+
+// newLinkChecker returns a checker of the site at base using workers concurrent requests.
+func newLinkChecker(base *url.URL, workers int, timeout time.Duration) *linkChecker {
+	return &linkChecker{
+		base: base,
+		client: &http.Client{
+			Timeout: timeout,
+			// a redirect is a working link, the login of the protected pages for instance
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		workers: make(chan struct{}, max(workers, 1)),
+		results: make(map[string]*LinkCheckResult),
+	}
+}
+
+// resolve returns the absolute url of link found in page, whether it belongs to the site, and false when it is
+// not checked, like mailto: and the anchors of the same page.
+func (lc *linkChecker) resolve(page *url.URL, link string) (string, bool, bool) {
+	link = strings.TrimSpace(link)
+	if link == "" || strings.HasPrefix(link, "#") {
+		return "", false, false
+	}
+	u, err := page.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", false, false
+	}
+	u.Fragment = ""
+	internal := u.Host == lc.base.Host
+	if !internal && slices.Contains(lc.aliases, u.Host) {
+		u.Scheme, u.Host, internal = lc.base.Scheme, lc.base.Host, true
+	}
+	return u.String(), internal, true
+}
+
+// add records that source links target, and checks target the first time it is seen.
+func (lc *linkChecker) add(source, target string, internal bool) {
+	for _, re := range lc.exclude {
+		if re.MatchString(target) {
+			return
+		}
+	}
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if result, seen := lc.results[target]; seen {
+		if source != "" && !slices.Contains(result.Sources, source) {
+			result.Sources = append(result.Sources, source)
+		}
+		return
+	}
+	if len(lc.results) >= maxLinkCheckURLs || (!internal && !lc.external) {
+		return
+	}
+	result := &LinkCheckResult{URL: target, External: !internal}
+	if source != "" {
+		result.Sources = []string{source}
+	}
+	lc.results[target] = result
+	lc.wg.Add(1)
+	go lc.check(result)
+}
+
+// check fetches the url of result, and follows the links of the internal html pages.
+func (lc *linkChecker) check(result *LinkCheckResult) {
+	defer lc.wg.Done()
+	lc.workers <- struct{}{}
+	defer func() { <-lc.workers }()
+	method := http.MethodGet
+	if result.External {
+		method = http.MethodHead
+	}
+	resp, err := lc.get(method, result.URL)
+	if err == nil && result.External && resp.StatusCode >= http.StatusBadRequest {
+		// some servers refuse HEAD
+		resp.Body.Close()
+		resp, err = lc.get(http.MethodGet, result.URL)
+	}
+	if err != nil {
+		lc.mu.Lock()
+		result.Err = err
+		lc.mu.Unlock()
+		return
+	}
+	defer resp.Body.Close()
+	lc.mu.Lock()
+	result.Status = resp.StatusCode
+	lc.mu.Unlock()
+	if result.External || resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxLinkCheckPageSize))
+	if err != nil {
+		return
+	}
+	page, _ := url.Parse(result.URL)
+	if lc.onPage != nil {
+		lc.onPage(page.RequestURI(), body)
+	}
+	for _, m := range linkRegex.FindAllSubmatch(body, -1) {
+		if target, internal, ok := lc.resolve(page, string(m[1])); ok {
+			lc.add(page.RequestURI(), target, internal)
+		}
+	}
+}
+
+func (lc *linkChecker) get(method, target string) (*http.Response, error) {
+	req, err := http.NewRequest(method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", version.APP+" link checker")
+	return lc.client.Do(req)
+}
+
+// run crawls the site from the paths given and returns the results of all the urls checked, sorted by url.
+func (lc *linkChecker) run(paths []string) []*LinkCheckResult {
+	for _, path := range paths {
+		if target, internal, ok := lc.resolve(lc.base, path); ok {
+			lc.add("", target, internal)
+		}
+	}
+	lc.wg.Wait()
+	results := make([]*LinkCheckResult, 0, len(lc.results))
+	for _, result := range lc.results {
+		results = append(results, result)
+	}
+	slices.SortFunc(results, func(a, b *LinkCheckResult) int { return strings.Compare(a.URL, b.URL) })
+	return results
+}
+
+// getCrawlStartPaths returns the home and the pages of site without route wildcards, the others are found by
+// following the links.
+func getCrawlStartPaths(site *SiteConfig) []string {
+	paths := []string{"/"}
+	now := time.Now()
+	for _, page := range site.Pages {
+		parts := strings.Fields(page.Route)
+		if !page.CreateHandler || !isPublished(&page, now) || len(parts) < 2 || parts[0] != http.MethodGet {
+			continue
+		}
+		if path := parts[1]; !strings.Contains(path, "{") && !slices.Contains(paths, path) {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// startLocalSite builds the site of the config of the env variables and serves it on a local port,
+// so that the links are checked without a running instance. it returns the url of the site and its config.
+func startLocalSite(l *log.Logger) (*url.URL, *SiteConfig, error) {
+	config, err := LoadConfig(getEnvOrDefault("CONFIG_URL", defaultSiteConfigFile), getEnvOrDefault("SCHEMA_URL", defaultSchemaFile), l)
+	if err != nil {
+		return nil, nil, err
+	}
+	applyEnvOverrides(config)
+	site, err := buildSite(config, storage.NewMemoryStore(), NewBandwidthCounter(), l)
+	if err != nil {
+		return nil, nil, err
+	}
+	applySite(site)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, nil, fmt.Errorf("error listening on a local port: %w", err)
+	}
+	go http.Serve(listener, withLiveAuth(http.HandlerFunc(serveLiveSite)))
+	return &url.URL{Scheme: "http", Host: listener.Addr().String(), Path: "/"}, config, nil
+}
+
+// getCrawledSite returns the url of the site crawled, the running instance at siteURL or else the site of the config
+// served locally, the other hosts of the site and the paths the crawl starts from.
+func getCrawledSite(siteURL string, l *log.Logger) (*url.URL, []string, []string, error) {
+	if siteURL != "" {
+		u, err := url.Parse(siteURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, nil, nil, fmt.Errorf("invalid -url %q, expected an http(s) url", siteURL)
+		}
+		return u, nil, []string{"/"}, nil
+	}
+	u, config, err := startLocalSite(l)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error rendering the site: %w", err)
+	}
+	var aliases []string
+	if configBase, err := url.Parse(config.BaseURL); err == nil && configBase.Host != "" {
+		aliases = append(aliases, configBase.Host)
+	}
+	return u, aliases, getCrawlStartPaths(config), nil
+}
+
+// runCheckLinks is the check-links subcommand : it renders the site of the config, or crawls the running instance
+// given by -url, and reports the broken internal links and assets, and the external ones with -external.
+// it returns the exit code of the process, 1 when a link is broken.
+func runCheckLinks(args []string) int {
+	fs := flag.NewFlagSet(version.APP+" "+checkLinksCommand, flag.ContinueOnError)
+	siteURL := fs.String("url", "", "crawl this running instance, like https://example.com/, instead of rendering the site of the config")
+	external := fs.Bool("external", false, "check the external links too")
+	workers := fs.Int("concurrency", defaultLinkCheckWorkers, "number of requests in progress at once")
+	timeout := fs.Duration("timeout", defaultLinkCheckTimeout, "timeout of each request")
+	var exclude excludeFlag
+	fs.Var(&exclude, "exclude", "regular expression of the urls not checked, like format=pdf, can be given several times")
+	if _, err := parseFlagsToEnv(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	pathToTemplates = getEnvOrDefault("TEMPLATES_DIR", defaultTemplatesDir)
+	pathToStatic = getEnvOrDefault("STATIC_DIR", defaultStaticDir)
+	l := log.New(os.Stderr, fmt.Sprintf("%s, ", version.APP), log.Ldate|log.Ltime|log.Lshortfile)
+	if !isDevMode() {
+		// rendering the pages logs each request, only the report matters here
+		l.SetOutput(io.Discard)
+	}
+
+	base, aliases, paths, err := getCrawledSite(*siteURL, l)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "💥💥 %v\n", err)
+		return 2
+	}
+
+	lc := newLinkChecker(base, *workers, *timeout)
+	lc.aliases, lc.external, lc.exclude = aliases, *external, exclude
+	results := lc.run(paths)
+	broken := 0
+	for _, result := range results {
+		if !result.isBroken() {
+			continue
+		}
+		broken++
+		target := result.URL
+		if !result.External {
+			u, _ := url.Parse(result.URL)
+			target = u.RequestURI()
+		}
+		problem := fmt.Sprint(result.Status)
+		if result.Err != nil {
+			problem = result.Err.Error()
+		}
+		sources := "the start pages"
+		if len(result.Sources) > 0 {
+			sources = strings.Join(result.Sources, ", ")
+		}
+		fmt.Printf("💥 %s: %s, linked from %s\n", target, problem, sources)
+	}
+	if broken > 0 {
+		fmt.Printf("💥💥 %d broken links out of %d urls checked\n", broken, len(results))
+		return 1
+	}
+	fmt.Printf("✅ %d urls checked, no broken link\n", len(results))
+	return 0
+}
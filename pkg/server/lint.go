@@ -0,0 +1,140 @@
+package server
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/version"
+)
+
+const (
+	lintCommand         = "lint" // subcommand reporting the seo problems of the pages of the site
+	defaultLintMaxTitle = 60     // longer titles are cut in the search results
+)
+
+var (
+	lintTitleRegex       = regexp.MustCompile(`(?is)<title\b[^>]*>(.*?)</title>`)
+	lintDescriptionRegex = regexp.MustCompile(`(?is)<meta\b[^>]*\sname\s*=\s*"description"[^>]*>`)
+	lintContentRegex     = regexp.MustCompile(`(?is)\scontent\s*=\s*"\s*[^"\s]`)
+	lintH1Regex          = regexp.MustCompile(`(?i)<h1\b`)
+)
+
+// lintPage is a page crawled by the lint, with its title and the problems found in its html.
+type lintPage struct {
+	path     string
+	title    string
+	problems []string
+}
+
+// lintHTML returns the title of a rendered html page and its problems: images without alt, a missing or too long
+// title, a missing meta description and no h1. the duplicate titles are found once all the pages are crawled.
+func lintHTML(page []byte, maxTitle int) (string, []string) {
+	var problems []string
+	for _, img := range a11yImgRegex.FindAll(page, -1) {
+		if !a11yAltRegex.Match(img) {
+			src := "?"
+			if m := a11ySrcRegex.FindSubmatch(img); m != nil {
+				src = string(m[1])
+			}
+			problems = append(problems, fmt.Sprintf("image %s has no alt attribute", src))
+		}
+	}
+	title := ""
+	if m := lintTitleRegex.FindSubmatch(page); m != nil {
+		title = strings.Join(strings.Fields(html.UnescapeString(string(m[1]))), " ")
+	}
+	if title == "" {
+		problems = append(problems, "the page has no title")
+	} else if n := utf8.RuneCountInString(title); n > maxTitle {
+		problems = append(problems, fmt.Sprintf("the title %q has %d characters, more than %d", title, n, maxTitle))
+	}
+	if m := lintDescriptionRegex.Find(page); m == nil || !lintContentRegex.Match(m) {
+		problems = append(problems, "the page has no meta description")
+	}
+	if !lintH1Regex.Match(page) {
+		problems = append(problems, "the page has no h1 heading")
+	}
+	return title, problems
+}
+
+// runLint is the lint subcommand : it renders the pages of the site of the config, or crawls the running instance
+// given by -url, following the internal links, and reports their seo problems. it returns the exit code of the
+// process, 1 when a problem is found so that a CI pipeline fails.
+func runLint(args []string) int {
+	fs := flag.NewFlagSet(version.APP+" "+lintCommand, flag.ContinueOnError)
+	siteURL := fs.String("url", "", "crawl this running instance, like https://example.com/, instead of rendering the site of the config")
+	maxTitle := fs.Int("max-title", defaultLintMaxTitle, "maximum number of characters of a title")
+	workers := fs.Int("concurrency", defaultLinkCheckWorkers, "number of requests in progress at once")
+	timeout := fs.Duration("timeout", defaultLinkCheckTimeout, "timeout of each request")
+	var exclude excludeFlag
+	fs.Var(&exclude, "exclude", "regular expression of the urls not checked, like format=pdf, can be given several times")
+	if _, err := parseFlagsToEnv(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	pathToTemplates = getEnvOrDefault("TEMPLATES_DIR", defaultTemplatesDir)
+	pathToStatic = getEnvOrDefault("STATIC_DIR", defaultStaticDir)
+	l := log.New(os.Stderr, fmt.Sprintf("%s, ", version.APP), log.Ldate|log.Ltime|log.Lshortfile)
+	if !isDevMode() {
+		// rendering the pages logs each request, only the report matters here
+		l.SetOutput(io.Discard)
+	}
+	base, aliases, paths, err := getCrawledSite(*siteURL, l)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "💥💥 %v\n", err)
+		return 2
+	}
+
+	var mu sync.Mutex
+	var pages []*lintPage
+	lc := newLinkChecker(base, *workers, *timeout)
+	lc.aliases, lc.exclude = aliases, exclude
+	lc.onPage = func(path string, body []byte) {
+		title, problems := lintHTML(body, *maxTitle)
+		mu.Lock()
+		defer mu.Unlock()
+		pages = append(pages, &lintPage{path: path, title: title, problems: problems})
+	}
+	lc.run(paths)
+
+	slices.SortFunc(pages, func(a, b *lintPage) int { return strings.Compare(a.path, b.path) })
+	byTitle := make(map[string][]string)
+	for _, page := range pages {
+		if page.title != "" {
+			byTitle[page.title] = append(byTitle[page.title], page.path)
+		}
+	}
+	count, failed := 0, 0
+	for _, page := range pages {
+		problems := page.problems
+		if others := byTitle[page.title]; len(others) > 1 {
+			others = slices.DeleteFunc(slices.Clone(others), func(path string) bool { return path == page.path })
+			problems = append(problems, fmt.Sprintf("the title %q is also the one of %s", page.title, strings.Join(others, ", ")))
+		}
+		for _, problem := range problems {
+			fmt.Printf("💥 %s: %s\n", page.path, problem)
+		}
+		if len(problems) > 0 {
+			count += len(problems)
+			failed++
+		}
+	}
+	if count > 0 {
+		fmt.Printf("💥💥 %d problems on %d of the %d pages checked\n", count, failed, len(pages))
+		return 1
+	}
+	fmt.Printf("✅ %d pages checked, no problem\n", len(pages))
+	return 0
+}
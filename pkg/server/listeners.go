@@ -0,0 +1,147 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/update"
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/version"
+)
+
+const (
+	listenerPublic = "public" // serves the pages of the site
+	listenerAdmin  = "admin"  // serves /metrics, /health, /version, /debug and /admin
+	healthPath     = "/health"
+	versionPath    = "/version"
+)
+
+// ListenerConfig is one address the server listens on, with https when it has a certificate.
+type ListenerConfig struct {
+	Address string `json:"address"`           // like :8080 or 127.0.0.1:9090
+	Role    string `json:"role,omitempty"`    // public (default) or admin
+	TLSCert string `json:"tlsCert,omitempty"` // path of the certificate file, the full chain in pem format
+	TLSKey  string `json:"tlsKey,omitempty"`  // path of the private key file in pem format
+}
+
+// getRole returns the role of the listener, public by default.
+func (lc ListenerConfig) getRole() string {
+	if lc.Role == "" {
+		return listenerPublic
+	}
+	return lc.Role
+}
+
+// validateListeners checks the listeners have distinct addresses, complete tls settings and that one serves the site.
+func validateListeners(config *SiteConfig) []ConfigError {
+	if len(config.Listeners) == 0 {
+		return nil
+	}
+	var problems []ConfigError
+	seen := make(map[string]bool)
+	hasPublic := false
+	for i, listener := range config.Listeners {
+		pointer := fmt.Sprintf("/listeners/%d", i)
+		if seen[listener.Address] {
+			problems = append(problems, ConfigError{Pointer: pointer + "/address", Value: listener.Address, Message: "address used by another listener"})
+		}
+		seen[listener.Address] = true
+		if (listener.TLSCert == "") != (listener.TLSKey == "") {
+			problems = append(problems, ConfigError{Pointer: pointer, Message: "an https listener needs both tlsCert and tlsKey"})
+		}
+		if listener.getRole() == listenerPublic {
+			hasPublic = true
+		}
+	}
+	if !hasPublic {
+		problems = append(problems, ConfigError{Pointer: "/listeners", Message: "at least one listener must have the public role to serve the site"})
+	}
+	return problems
+}
+
+// hasAdminListener reports whether the admin endpoints have their own listener, away from the public ones.
+func hasAdminListener(site *SiteConfig) bool {
+	for _, listener := range site.Listeners {
+		if listener.getRole() == listenerAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// getListeners returns the listeners of the config, or a single public one on port when there is none.
+func getListeners(site *SiteConfig, port int) []ListenerConfig {
+	if len(site.Listeners) > 0 {
+		return site.Listeners
+	}
+	return []ListenerConfig{{Address: fmt.Sprintf(":%d", port), Role: listenerPublic}}
+}
+
+// getHealthHandler answers the liveness probes, it needs no token.
+func getHealthHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, r, http.StatusOK, map[string]string{"status": "ok", "version": version.VERSION})
+	}
+}
+
+// VersionInfo is the running build returned by /version, with the result of the update check when env
+// UPDATE_CHECK is true.
+type VersionInfo struct {
+	version.Info
+	Update *update.Status `json:"update,omitempty"`
+}
+
+// getVersionHandler returns the info of the running build, behind the admin token since it tells the exact
+// versions to look for vulnerabilities.
+func getVersionHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, r, http.StatusOK, VersionInfo{Info: version.Get(), Update: getUpdateStatus()})
+	}
+}
+
+// serveListeners starts one http server by listener, with the handler of its role and the same limits,
+// it returns when one of them fails. the connections of the trusted proxies are not limited by client address.
+func serveListeners(listeners []ListenerConfig, handlers map[string]http.Handler, limits serverLimits, trusted []netip.Prefix, l *log.Logger) error {
+	errs := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		server := &http.Server{
+			Addr:              listener.Address,
+			Handler:           handlers[listener.getRole()],
+			ErrorLog:          l,
+			ReadTimeout:       limits.ReadTimeout,
+			WriteTimeout:      limits.WriteTimeout,
+			IdleTimeout:       limits.IdleTimeout,
+			ReadHeaderTimeout: limits.ReadHeaderTimeout,
+			MaxHeaderBytes:    limits.MaxHeaderBytes,
+		}
+		go func() {
+			host := listener.Address
+			if strings.HasPrefix(host, ":") {
+				host = "localhost" + host
+			}
+			ln, err := net.Listen("tcp", listener.Address)
+			if err != nil {
+				errs <- fmt.Errorf("%s listener on %s: %w", listener.getRole(), listener.Address, err)
+				return
+			}
+			ln = newLimitListener(ln, limits.MaxConnections, limits.MaxConnectionsPerIP, trusted)
+			if listener.TLSCert != "" {
+				l.Printf("Server starting %s listener on https://%s", listener.getRole(), host)
+				err = server.ServeTLS(ln, listener.TLSCert, listener.TLSKey)
+			} else {
+				l.Printf("Server starting %s listener on http://%s", listener.getRole(), host)
+				err = server.Serve(ln)
+			}
+			if !errors.Is(err, http.ErrServerClosed) {
+				errs <- fmt.Errorf("%s listener on %s: %w", listener.getRole(), listener.Address, err)
+			}
+		}()
+	}
+	return <-errs
+}
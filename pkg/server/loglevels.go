@@ -0,0 +1,206 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// the levels of the log messages, from their text : DEBUG:, INFO: or none, WARNING or ⚠️, and 💥 for the errors.
+const (
+	levelDebug = iota
+	levelInfo
+	levelWarning
+	levelError
+)
+
+// the components of the log having their own level.
+const (
+	logComponentConfig = "config" // loading and validation of the config
+	logComponentRender = "render" // templates and pages
+	logComponentHTTP   = "http"   // requests
+)
+
+// logLevels are the names of the levels, warn is also accepted for warning.
+var logLevels = []string{"debug", "info", "warning", "error"}
+
+// logComponents are the components of the log having their own level.
+var logComponents = []string{logComponentConfig, logComponentRender, logComponentHTTP}
+
+// LogConfig sets the verbosity of the log, overridden by env LOG_LEVEL.
+type LogConfig struct {
+	Level      string            `json:"level,omitempty"`      // debug, info, warn or error, info by default
+	Components map[string]string `json:"components,omitempty"` // level of the config, render and http messages, like {"render": "debug"}
+}
+
+// logVerbosity holds the levels of the log, set by env LOG_LEVEL, else by the log config of the live site.
+var logVerbosity = struct {
+	mu         sync.RWMutex
+	fromEnv    bool
+	level      int
+	components map[string]int
+}{level: levelInfo}
+
+// logSeverity returns the level of a log message from its text.
+func logSeverity(msg string) int {
+	switch {
+	case strings.Contains(msg, "💥"):
+		return levelError
+	case strings.Contains(msg, "⚠️") || strings.Contains(msg, "WARNING"):
+		return levelWarning
+	case strings.Contains(msg, "DEBUG:"):
+		return levelDebug
+	}
+	return levelInfo
+}
+
+// parseLogLevel returns the level of name, like warning.
+func parseLogLevel(name string) (int, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "warn" {
+		name = "warning"
+	}
+	level := slices.Index(logLevels, name)
+	return level, level >= 0
+}
+
+// parseLogLevels parses levels like warn,render=debug : the level of all the messages followed by the levels of
+// some components.
+func parseLogLevels(val string) (int, map[string]int, error) {
+	level, components := levelInfo, make(map[string]int)
+	for _, part := range strings.Split(val, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		component, name, found := strings.Cut(part, "=")
+		if !found {
+			component, name = "", part
+		}
+		l, ok := parseLogLevel(name)
+		if !ok {
+			return 0, nil, fmt.Errorf("unknown level %q, expected one of debug, info, warn or error", strings.TrimSpace(name))
+		}
+		component = strings.TrimSpace(component)
+		if component == "" {
+			level = l
+			continue
+		}
+		if !slices.Contains(logComponents, component) {
+			return 0, nil, fmt.Errorf("unknown component %q, expected one of %s", component, strings.Join(logComponents, ", "))
+		}
+		components[component] = l
+	}
+	return level, components, nil
+}
+
+// setLogLevelsFromEnvOrPanic reads the levels of env LOG_LEVEL, like warn,render=debug, they replace the ones of the
+// log config.
+func setLogLevelsFromEnvOrPanic() {
+	val := strings.TrimSpace(os.Getenv("LOG_LEVEL"))
+	if val == "" {
+		return
+	}
+	level, components, err := parseLogLevels(val)
+	if err != nil {
+		panic(fmt.Errorf("💥💥 ERROR: CONFIG ENV LOG_LEVEL is invalid. %w", err))
+	}
+	logVerbosity.mu.Lock()
+	defer logVerbosity.mu.Unlock()
+	logVerbosity.fromEnv, logVerbosity.level, logVerbosity.components = true, level, components
+}
+
+// setLogLevelsFromConfig applies the log config of the site about to be served, unless env LOG_LEVEL is set.
+func setLogLevelsFromConfig(config *SiteConfig) {
+	level, components := levelInfo, make(map[string]int)
+	if config.Log != nil {
+		// the levels are checked by validateLog
+		if l, ok := parseLogLevel(config.Log.Level); ok {
+			level = l
+		}
+		for component, name := range config.Log.Components {
+			if l, ok := parseLogLevel(name); ok {
+				components[component] = l
+			}
+		}
+	}
+	logVerbosity.mu.Lock()
+	defer logVerbosity.mu.Unlock()
+	if !logVerbosity.fromEnv {
+		logVerbosity.level, logVerbosity.components = level, components
+	}
+}
+
+// validateLog checks the levels and the components of the log config.
+func validateLog(config *SiteConfig) []ConfigError {
+	if config.Log == nil {
+		return nil
+	}
+	var problems []ConfigError
+	if _, ok := parseLogLevel(config.Log.Level); config.Log.Level != "" && !ok {
+		problems = append(problems, ConfigError{Pointer: "/log/level", Value: config.Log.Level, Message: "unknown level, expected one of debug, info, warn or error"})
+	}
+	for component, name := range config.Log.Components {
+		pointer := "/log/components/" + component
+		if !slices.Contains(logComponents, component) {
+			problems = append(problems, ConfigError{Pointer: pointer, Message: "unknown component, expected one of " + strings.Join(logComponents, ", ")})
+		} else if _, ok := parseLogLevel(name); !ok {
+			problems = append(problems, ConfigError{Pointer: pointer, Value: name, Message: "unknown level, expected one of debug, info, warn or error"})
+		}
+	}
+	return problems
+}
+
+// getLogLevel returns the lowest level of the messages of component that are logged, the level of all the messages
+// for the empty component.
+func getLogLevel(component string) int {
+	logVerbosity.mu.RLock()
+	defer logVerbosity.mu.RUnlock()
+	if level, found := logVerbosity.components[component]; found {
+		return level
+	}
+	return logVerbosity.level
+}
+
+// levelWriter drops the messages of its component below its level.
+type levelWriter struct {
+	w         io.Writer
+	component string
+}
+
+func (lw *levelWriter) Write(b []byte) (int, error) {
+	if logSeverity(string(b)) < getLogLevel(lw.component) {
+		return len(b), nil
+	}
+	return lw.w.Write(b)
+}
+
+// newLevelLogger returns the logger of the server writing to w, its messages below the level of LOG_LEVEL are dropped.
+func newLevelLogger(w io.Writer, prefix string, flags int) *log.Logger {
+	return log.New(&levelWriter{w: w}, prefix, flags)
+}
+
+// getComponentLogger returns a logger like l whose messages have the level of component.
+func getComponentLogger(l *log.Logger, component string) *log.Logger {
+	w := l.Writer()
+	if lw, ok := w.(*levelWriter); ok {
+		w = lw.w
+	}
+	return log.New(&levelWriter{w: w, component: component}, l.Prefix(), l.Flags())
+}
+
+// logDebug logs a DEBUG: message with l when its component is at the debug level, the message is not formatted
+// otherwise.
+func logDebug(l *log.Logger, format string, args ...interface{}) {
+	component := ""
+	if lw, ok := l.Writer().(*levelWriter); ok {
+		component = lw.component
+	}
+	if getLogLevel(component) > levelDebug {
+		return
+	}
+	l.Output(2, "DEBUG: "+fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	siteconfig "github.com/lao-tseu-is-alive/JsonSiteGo/pkg/config"
+)
+
+const (
+	syslogLog      = "syslog"   // LOG_FILE sending the log to the local syslog
+	eventLogLog    = "eventlog" // LOG_FILE sending the log to the windows event log
+	journaldLog    = "journald" // LOG_FILE sending the log to the native socket of systemd-journald
+	journaldSocket = "/run/systemd/journal/socket"
+	syslogFacility = 3 // daemon
+	logDialTimeout = 5 * time.Second
+	// rfc 5424 timestamps have at most 6 digits of fraction of second
+	syslogTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+// localSyslogSockets are the sockets of the local syslog daemon, the first one found is used.
+var localSyslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// logTarget is a writer of the log with the lowest severity it receives.
+type logTarget struct {
+	w        io.Writer
+	severity int
+}
+
+// multiLogWriter writes each message of the log to the targets whose level it reaches.
+type multiLogWriter struct {
+	targets []logTarget
+}
+
+func (m *multiLogWriter) Write(b []byte) (int, error) {
+	severity := logSeverity(string(b))
+	var errs []error
+	for _, target := range m.targets {
+		if severity >= target.severity {
+			if _, err := target.w.Write(b); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return len(b), errors.Join(errs...)
+}
+
+// parseLogTarget splits a target of LOG_FILE like app.log@warning in its name and the lowest level it receives,
+// all the messages without level.
+func parseLogTarget(target string) (string, int) {
+	if i := strings.LastIndex(target, "@"); i >= 0 {
+		if severity, ok := parseLogLevel(target[i+1:]); ok {
+			return target[:i], severity
+		}
+	}
+	return target, levelDebug
+}
+
+// getLogWriter returns the writer of the log target name : stdout, stderr, DISCARD, syslog, syslog://host:514,
+// syslog+tcp://host:601, journald, eventlog or a file name.
+func getLogWriter(name string) (io.Writer, error) {
+	if utf8.RuneCountInString(name) < 5 {
+		return nil, fmt.Errorf("the filename should contain at least %d characters (got %d)", 5, utf8.RuneCountInString(name))
+	}
+	switch {
+	case name == "stdout":
+		return os.Stdout, nil
+	case name == "stderr":
+		return os.Stderr, nil
+	case name == "DISCARD":
+		return io.Discard, nil
+	case name == syslogLog:
+		for _, socket := range localSyslogSockets {
+			if _, err := os.Stat(socket); err == nil {
+				return newSyslogWriter("unixgram", socket)
+			}
+		}
+		return nil, fmt.Errorf("no local syslog socket in %s", strings.Join(localSyslogSockets, ", "))
+	case strings.HasPrefix(name, syslogLog+"://") || strings.HasPrefix(name, syslogLog+"+tcp://"):
+		u, err := url.Parse(name)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("a remote syslog is like syslog://host:514 or syslog+tcp://host:601")
+		}
+		network, port := "udp", "514"
+		if u.Scheme == syslogLog+"+tcp" {
+			network, port = "tcp", "601"
+		}
+		address := u.Host
+		if u.Port() == "" {
+			address = net.JoinHostPort(u.Hostname(), port)
+		}
+		return newSyslogWriter(network, address)
+	case name == journaldLog:
+		return newJournaldWriter()
+	case name == eventLogLog:
+		return newEventLogWriter()
+	}
+	if siteconfig.IsFromStdin() {
+		fmt.Fprintf(os.Stderr, "INFO: the config is read from stdin, the log is written to stderr instead of %s\n", name)
+		return os.Stderr, nil
+	}
+	// The 0644 permission allows the owner to read/write and others to read.
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	// the file is opened again when a rotateLogs task rotates it
+	f := &logFile{name: name, file: file}
+	serverLogFiles = append(serverLogFiles, f)
+	return f, nil
+}
+
+// syslogWriter sends each message of the log to a syslog in the format of rfc 5424, with the severity of its emoji.
+// the connection is opened again when a message cannot be sent.
+type syslogWriter struct {
+	mu       sync.Mutex
+	network  string
+	address  string
+	conn     net.Conn
+	hostname string
+}
+
+// newSyslogWriter returns a syslogWriter connected to address.
+func newSyslogWriter(network, address string) (*syslogWriter, error) {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	s := &syslogWriter{network: network, address: address, hostname: hostname}
+	if s.conn, err = net.DialTimeout(network, address, logDialTimeout); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *syslogWriter) Write(b []byte) (int, error) {
+	msg := strings.TrimRight(string(b), "\n")
+	severity := []int{7, 6, 4, 3}[logSeverity(msg)] // debug, informational, warning, error
+	line := fmt.Sprintf("<%d>1 %s %s %s %d - - %s", syslogFacility*8+severity, time.Now().Format(syslogTimeFormat), s.hostname, serviceName, os.Getpid(), msg)
+	if s.network == "tcp" {
+		// octet counting framing of rfc 6587
+		line = fmt.Sprintf("%d %s", len(line), line)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		if _, err := s.conn.Write([]byte(line)); err == nil {
+			return len(b), nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+	conn, err := net.DialTimeout(s.network, s.address, logDialTimeout)
+	if err != nil {
+		return 0, err
+	}
+	s.conn = conn
+	if _, err := conn.Write([]byte(line)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// journaldWriter sends each message of the log to systemd-journald with its native protocol, the priority of its
+// emoji and the name of the service as identifier.
+type journaldWriter struct {
+	conn net.Conn
+}
+
+// newJournaldWriter returns a journaldWriter connected to the socket of journald.
+func newJournaldWriter() (*journaldWriter, error) {
+	conn, err := net.Dial("unixgram", journaldSocket)
+	if err != nil {
+		return nil, err
+	}
+	return &journaldWriter{conn: conn}, nil
+}
+
+func (j *journaldWriter) Write(b []byte) (int, error) {
+	msg := strings.TrimRight(string(b), "\n")
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "PRIORITY=%d\nSYSLOG_IDENTIFIER=%s\nSYSLOG_PID=%d\n", []int{7, 6, 4, 3}[logSeverity(msg)], serviceName, os.Getpid())
+	if strings.Contains(msg, "\n") {
+		// a value having new lines is sent with its length
+		size := make([]byte, 8)
+		binary.LittleEndian.PutUint64(size, uint64(len(msg)))
+		buf.WriteString("MESSAGE\n")
+		buf.Write(size)
+		buf.WriteString(msg + "\n")
+	} else {
+		buf.WriteString("MESSAGE=" + msg + "\n")
+	}
+	if _, err := j.conn.Write([]byte(buf.String())); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/mailer"
+)
+
+const (
+	pathToEmails      = "emails" // directory of the email templates inside pathToTemplates
+	emailSubjectBlock = "subject"
+	emailTextBlock    = "text"
+	emailHTMLBlock    = "html"
+)
+
+// mailTransportSchemes are the schemes of the transports of pkg/mailer.
+var mailTransportSchemes = []string{"smtp", "smtps", "sendmail", "file"}
+
+// errNoMailTransport is returned when an email is sent without mail config nor env SMTP_HOST and SMTP_FROM.
+var errNoMailTransport = errors.New("the mail config, or env SMTP_HOST and SMTP_FROM, are required to send emails")
+
+// MailConfig holds the transport and the sender of the emails sent by the server, the form emails and the alerts.
+type MailConfig struct {
+	Transport string `json:"transport"`          // smtp://user@host:587 with an optional ?tls=required, smtps://user@host, sendmail:///usr/sbin/sendmail or file:///dir
+	From      string `json:"from"`               // sender of the emails, like "My Site <noreply@example.com>"
+	Password  string `json:"password,omitempty"` // smtp password, best encrypted with the encrypt subcommand, env SMTP_PASSWORD wins
+}
+
+// EmailData is what the email templates receive.
+type EmailData struct {
+	Site         *SiteConfig
+	Page         *Page             // the page of the form, nil for the other emails
+	Values       map[string]string // the submitted values of the form, like .Values.email
+	Notification *Notification     // the event of an alert email
+	ConfirmURL   string            // the link confirming a newsletter subscription
+}
+
+// emailTemplate is a file of templates/emails defining the subject, text and optional html blocks of an email,
+// the subject and the text are rendered without the html escaping.
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *template.Template
+}
+
+// siteMailer sends the emails of a site with the email templates of its build.
+type siteMailer struct {
+	mailer    *mailer.Mailer // nil without transport
+	templates map[string]*emailTemplate
+}
+
+// validateMail checks the scheme of the transport and the sender address.
+func validateMail(config *SiteConfig) []ConfigError {
+	if config.Mail == nil {
+		return nil
+	}
+	var problems []ConfigError
+	if u, err := url.Parse(config.Mail.Transport); err != nil || !slices.Contains(mailTransportSchemes, u.Scheme) {
+		problems = append(problems, ConfigError{Pointer: "/mail/transport", Value: config.Mail.Transport, Message: "the transport must be an url of scheme " + strings.Join(mailTransportSchemes, ", ")})
+	}
+	if _, err := mail.ParseAddress(config.Mail.From); err != nil {
+		problems = append(problems, ConfigError{Pointer: "/mail/from", Value: config.Mail.From, Message: fmt.Sprintf("invalid address: %v", err)})
+	}
+	return problems
+}
+
+// getMailer returns the mailer of the mail config, or of env SMTP_HOST, SMTP_PORT, SMTP_USER, SMTP_TLS and SMTP_FROM
+// without it, nil when there is none.
+func getMailer(config *SiteConfig) (*mailer.Mailer, error) {
+	transportURL, from := "", ""
+	if config.Mail != nil {
+		transportURL, from = config.Mail.Transport, config.Mail.From
+	} else if host := os.Getenv("SMTP_HOST"); host != "" && os.Getenv("SMTP_FROM") != "" {
+		u := url.URL{Scheme: "smtp", Host: host + ":" + getEnvOrDefault("SMTP_PORT", "587")}
+		if user := os.Getenv("SMTP_USER"); user != "" {
+			u.User = url.User(user)
+		}
+		if mode := os.Getenv("SMTP_TLS"); mode != "" {
+			u.RawQuery = url.Values{"tls": {mode}}.Encode()
+		}
+		transportURL, from = u.String(), os.Getenv("SMTP_FROM")
+	}
+	if transportURL == "" {
+		return nil, nil
+	}
+	password := os.Getenv("SMTP_PASSWORD")
+	if password == "" && config.Mail != nil {
+		password = config.Mail.Password
+	}
+	transport, err := mailer.NewTransport(transportURL, password)
+	if err != nil {
+		return nil, err
+	}
+	return mailer.New(transport, from)
+}
+
+// getEmailTemplateNames returns the email templates used by the form actions and the notifications of config.
+func getEmailTemplateNames(config *SiteConfig) []string {
+	var names []string
+	for _, page := range config.Pages {
+		if page.Form == nil {
+			continue
+		}
+		for _, action := range page.Form.Actions {
+			if action.Template != "" {
+				names = append(names, action.Template)
+			}
+		}
+	}
+	if config.Notifications != nil {
+		for _, email := range config.Notifications.Emails {
+			if email.Template != "" {
+				names = append(names, email.Template)
+			}
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// newSiteMailer returns the mailer of config with the email templates it uses, parsed from templates/emails with
+// the functions of the page templates.
+func newSiteMailer(config *SiteConfig) (*siteMailer, error) {
+	m, err := getMailer(config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the mail transport: %w", err)
+	}
+	sm := &siteMailer{mailer: m, templates: make(map[string]*emailTemplate)}
+	funcs := (&HTMLTemplateEngine{}).getFuncMap(config)
+	for _, name := range getEmailTemplateNames(config) {
+		file := filepath.Join(config.getTemplatesDir(), pathToEmails, name+".gohtml")
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the email template %s: %w", name, err)
+		}
+		text, err := texttemplate.New(name).Funcs(texttemplate.FuncMap(funcs)).Parse(string(src))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing the email template %s: %w", file, err)
+		}
+		html, err := template.New(name).Funcs(funcs).Parse(string(src))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing the email template %s: %w", file, err)
+		}
+		for _, block := range []string{emailSubjectBlock, emailTextBlock} {
+			if text.Lookup(block) == nil {
+				return nil, fmt.Errorf("the email template %s has no {{define %q}}", file, block)
+			}
+		}
+		sm.templates[name] = &emailTemplate{text: text, html: html}
+	}
+	return sm, nil
+}
+
+// render returns the message of the email template name for data.
+func (t *emailTemplate) render(data EmailData) (*mailer.Message, error) {
+	var subject, text, html bytes.Buffer
+	if err := t.text.ExecuteTemplate(&subject, emailSubjectBlock, data); err != nil {
+		return nil, err
+	}
+	if err := t.text.ExecuteTemplate(&text, emailTextBlock, data); err != nil {
+		return nil, err
+	}
+	if t.html.Lookup(emailHTMLBlock) != nil {
+		if err := t.html.ExecuteTemplate(&html, emailHTMLBlock, data); err != nil {
+			return nil, err
+		}
+	}
+	return &mailer.Message{Subject: strings.TrimSpace(subject.String()), Text: text.String(), HTML: html.String()}, nil
+}
+
+// send sends to the recipients the email of template name, or msg when name is empty.
+func (sm *siteMailer) send(ctx context.Context, to []string, name string, data EmailData, msg *mailer.Message) error {
+	if sm == nil || sm.mailer == nil {
+		return errNoMailTransport
+	}
+	if name != "" {
+		t, found := sm.templates[name]
+		if !found {
+			return fmt.Errorf("unknown email template %s", name)
+		}
+		rendered, err := t.render(data)
+		if err != nil {
+			return fmt.Errorf("error rendering the email template %s: %w", name, err)
+		}
+		rendered.ReplyTo = msg.ReplyTo
+		msg = rendered
+	}
+	msg.To = to
+	return sm.mailer.Send(ctx, msg)
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/internal/siteerrors"
+)
+
+const (
+	maintenancePath              = adminPathPrefix + "/maintenance"
+	defaultMaintenanceRetryAfter = 5 * time.Minute
+	maintenanceFileCheckInterval = time.Second // the lock file is looked for at most once per second
+)
+
+// MaintenanceConfig holds the settings of the maintenance mode, switched on by env MAINTENANCE_MODE,
+// by the lock file or by the admin endpoint.
+type MaintenanceConfig struct {
+	File       string `json:"file,omitempty"`       // the maintenance is on while this file exists, overridden by env MAINTENANCE_FILE
+	RetryAfter string `json:"retryAfter,omitempty"` // duration announced in Retry-After, default is 5m
+	Message    string `json:"message,omitempty"`    // shown on the 503 page
+}
+
+// MaintenanceStatus is the state of the maintenance mode returned by the admin endpoint.
+type MaintenanceStatus struct {
+	Enabled    bool   `json:"enabled"`
+	Source     string `json:"source,omitempty"` // env, file or admin
+	Message    string `json:"message,omitempty"`
+	RetryAfter int    `json:"retryAfter,omitempty"` // seconds
+}
+
+// maintenanceMode is the switch of the maintenance mode, shared by all the sites.
+type maintenanceMode struct {
+	mu         sync.Mutex
+	source     string        // env or admin when switched on without the lock file
+	message    string        // replaces the message of the config when not empty
+	retryAfter time.Duration // replaces the retryAfter of the config when not zero
+	file       string        // the lock file of env MAINTENANCE_FILE, else the one of the config
+	fileFound  bool
+	checkedAt  time.Time
+}
+
+// maintenance is switched on by env MAINTENANCE_MODE at start.
+var maintenance = &maintenanceMode{}
+
+// validateMaintenance checks the retryAfter duration.
+func validateMaintenance(config *SiteConfig) []ConfigError {
+	if config.Maintenance == nil || config.Maintenance.RetryAfter == "" {
+		return nil
+	}
+	if _, err := parseServerDuration(config.Maintenance.RetryAfter); err != nil {
+		return []ConfigError{{Pointer: "/maintenance/retryAfter", Value: config.Maintenance.RetryAfter, Message: fmt.Sprintf("invalid duration: %v", err)}}
+	}
+	return nil
+}
+
+// setMaintenanceFromEnvOrPanic switches the maintenance on when env MAINTENANCE_MODE is true and reads the path of
+// the lock file from env MAINTENANCE_FILE.
+func setMaintenanceFromEnvOrPanic(l *log.Logger) {
+	if val, exist := os.LookupEnv("MAINTENANCE_MODE"); exist && strings.TrimSpace(val) != "" {
+		enabled, err := strconv.ParseBool(strings.TrimSpace(val))
+		if err != nil {
+			panic(fmt.Errorf("💥💥 ERROR: CONFIG ENV MAINTENANCE_MODE should be true or false. %w", err))
+		}
+		if enabled {
+			maintenance.source = "env"
+			l.Printf("⚠️ WARNING: maintenance mode is on, the pages answer 503 until %s is called with DELETE", maintenancePath)
+		}
+	}
+	maintenance.file = strings.TrimSpace(os.Getenv("MAINTENANCE_FILE"))
+}
+
+// getStatus returns the state of the maintenance with the settings of config.
+func (m *maintenanceMode) getStatus(config *MaintenanceConfig) MaintenanceStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if config == nil {
+		config = &MaintenanceConfig{}
+	}
+	status := MaintenanceStatus{Source: m.source, Message: config.Message}
+	if status.Source == "" {
+		file := m.file
+		if file == "" {
+			file = config.File
+		}
+		if file != "" && time.Since(m.checkedAt) >= maintenanceFileCheckInterval {
+			_, err := os.Stat(file)
+			m.fileFound = err == nil
+			m.checkedAt = time.Now()
+		}
+		if file != "" && m.fileFound {
+			status.Source = "file"
+		}
+	}
+	if status.Source == "" {
+		return MaintenanceStatus{}
+	}
+	status.Enabled = true
+	if m.message != "" {
+		status.Message = m.message
+	}
+	retryAfter := m.retryAfter
+	if retryAfter == 0 {
+		retryAfter = defaultMaintenanceRetryAfter
+		if d, err := parseServerDuration(config.RetryAfter); err == nil {
+			retryAfter = d
+		}
+	}
+	status.RetryAfter = int(retryAfter.Seconds())
+	return status
+}
+
+// set switches the maintenance on with the optional message and retryAfter, or off.
+func (m *maintenanceMode) set(enabled bool, message string, retryAfter time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.source, m.message, m.retryAfter = "", "", 0
+	if enabled {
+		m.source, m.message, m.retryAfter = "admin", message, retryAfter
+	}
+}
+
+// isMaintenanceExempt reports whether path is still served during the maintenance, the static files and icons
+// being needed by the 503 page itself.
+func isMaintenanceExempt(path string) bool {
+	if strings.HasPrefix(path, staticURLPrefix) || path == "/favicon.ico" || path == manifestPath {
+		return true
+	}
+	for _, icon := range faviconPNGs {
+		if icon.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// withMaintenance answers 503 with a Retry-After to the requests of the site while the maintenance is on.
+// the health and admin endpoints are registered besides the site, so they are never behind it.
+func withMaintenance(next http.Handler, l *log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		site := getLiveSite()
+		status := maintenance.getStatus(site.Config.Maintenance)
+		if !status.Enabled || isMaintenanceExempt(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(status.RetryAfter))
+		w.Header().Set("Cache-Control", "no-store")
+		data := PageData{
+			Site:        site.Config,
+			Page:        &Page{Route: r.URL.Path, Title: "Maintenance"},
+			Theme:       getThemeFromCookie(r),
+			Request:     getRequestInfo(r, site.Config),
+			CurrentPath: r.URL.Path,
+			Flags:       getFlags(site.Config),
+		}
+		renderError(w, r, siteerrors.Unavailable(status.Message), data, l)
+	})
+}
+
+// getMaintenanceHandler returns the state of the maintenance on GET, switches it on with POST, with an optional
+// json body like {"message": "back at 14:00", "retryAfter": "2h"}, and off with DELETE.
+func getMaintenanceHandler(l *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			var body struct {
+				Message    string `json:"message"`
+				RetryAfter string `json:"retryAfter"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+				writeJSONError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid json body: %v", err))
+				return
+			}
+			var retryAfter time.Duration
+			if body.RetryAfter != "" {
+				d, err := parseServerDuration(body.RetryAfter)
+				if err != nil {
+					writeJSONError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid retryAfter '%s': %v", body.RetryAfter, err))
+					return
+				}
+				retryAfter = d
+			}
+			maintenance.set(true, body.Message, retryAfter)
+			l.Printf("⚠️ WARNING: maintenance mode switched on by %s", getClientIP(r))
+		case http.MethodDelete:
+			maintenance.set(false, "", 0)
+			l.Printf("✅ maintenance mode switched off by %s", getClientIP(r))
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, r, http.StatusOK, maintenance.getStatus(getLiveSite().Config.Maintenance))
+	}
+}
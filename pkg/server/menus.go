@@ -0,0 +1,131 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// mainMenu is the menu of the header, it defaults to the pages having showInMenu sorted by menuOrder.
+const mainMenu = "main"
+
+// MenuItem is one entry of a menu, it links either to a page of the site or to an url.
+type MenuItem struct {
+	Label     string   `json:"label,omitempty"`     // text of the link, defaults to the title of the page
+	Page      string   `json:"page,omitempty"`      // route of a page of the site, like "GET /about"
+	URL       string   `json:"url,omitempty"`       // any other link, like https://github.com/lao-tseu-is-alive
+	Icon      string   `json:"icon,omitempty"`      // url of an image or a short text like an emoji, shown before the label
+	Target    string   `json:"target,omitempty"`    // like _blank, such links get rel="noopener noreferrer"
+	VisibleTo []string `json:"visibleTo,omitempty"` // only the users having one of these roles see the item
+	Href      string   `json:"-"`                   // the resolved link
+	Active    bool     `json:"-"`                   // true when the item links the current path
+	linked    *Page    // the page of the item, hidden with it from the users who cannot see it
+}
+
+// IsIconImage reports whether the icon is the url of an image rather than a text.
+func (m MenuItem) IsIconImage() bool {
+	return strings.HasPrefix(m.Icon, "/") || strings.HasPrefix(m.Icon, "http://") || strings.HasPrefix(m.Icon, "https://")
+}
+
+// findMenuPage returns the non-draft page having route, or nil.
+func findMenuPage(site *SiteConfig, route string) *Page {
+	route = strings.Join(strings.Fields(route), " ")
+	for i := range site.Pages {
+		p := &site.Pages[i]
+		if !p.Draft && strings.Join(strings.Fields(p.Route), " ") == route {
+			return p
+		}
+	}
+	return nil
+}
+
+// validateMenus checks that every menu item has a link, and that the pages it references exist and can be linked.
+func validateMenus(config *SiteConfig) []ConfigError {
+	var problems []ConfigError
+	for name, items := range config.Menus {
+		for i, item := range items {
+			pointer := fmt.Sprintf("/menus/%s/%d", name, i)
+			switch {
+			case item.Page == "" && item.URL == "":
+				problems = append(problems, ConfigError{Pointer: pointer, Message: fmt.Sprintf("item of menu %s needs a page or an url", name)})
+			case item.Page != "" && item.URL != "":
+				problems = append(problems, ConfigError{Pointer: pointer, Message: fmt.Sprintf("item of menu %s has both a page and an url", name)})
+			case item.Page != "":
+				page := findMenuPage(config, item.Page)
+				if page == nil {
+					problems = append(problems, ConfigError{Pointer: pointer + "/page", Value: item.Page, Message: fmt.Sprintf("menu %s references an unknown or draft page", name)})
+				} else if len(getRouteParamNames(splitRoutePath(page.Route))) > 0 {
+					problems = append(problems, ConfigError{Pointer: pointer + "/page", Value: item.Page, Message: fmt.Sprintf("menu %s cannot link a route pattern, use an url instead", name)})
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// getMenus returns the menus of the site with their links resolved, by name, without the items of the pages
+// not published yet or expired. when the config has no main menu, it is derived from the pages having showInMenu.
+func getMenus(site *SiteConfig) map[string][]MenuItem {
+	menus := make(map[string][]MenuItem, len(site.Menus)+1)
+	now := time.Now()
+	for name, items := range site.Menus {
+		resolved := make([]MenuItem, 0, len(items))
+		for _, item := range items {
+			item.Href = item.URL
+			if item.Page != "" {
+				page := findMenuPage(site, item.Page)
+				if page == nil || !isPublished(page, now) {
+					continue
+				}
+				item.Href = splitRoutePath(page.Route)
+				item.linked = page
+				if item.Label == "" {
+					item.Label = page.Title
+				}
+			}
+			resolved = append(resolved, item)
+		}
+		menus[name] = resolved
+	}
+	if _, ok := menus[mainMenu]; !ok {
+		for _, p := range getMenuPages(site) {
+			menus[mainMenu] = append(menus[mainMenu], MenuItem{Label: p.Title, Page: p.Route, Href: splitRoutePath(p.Route), linked: &p})
+		}
+	}
+	return menus
+}
+
+// isActive reports whether href links the current path, ignoring its query and trailing slash,
+// like {{if isActive "/about" .CurrentPath}}.
+func isActive(href, currentPath string) bool {
+	href, _, _ = strings.Cut(href, "?")
+	href, _, _ = strings.Cut(href, "#")
+	if href == "" || currentPath == "" {
+		return false
+	}
+	if href != "/" {
+		href = strings.TrimSuffix(href, "/")
+	}
+	if currentPath != "/" {
+		currentPath = strings.TrimSuffix(currentPath, "/")
+	}
+	return href == currentPath
+}
+
+// Menu returns the items of the menu name the user can see, the one linking the current path being active.
+func (d PageData) Menu(name string) []MenuItem {
+	items := make([]MenuItem, 0, len(d.Menus[name]))
+	for _, item := range d.Menus[name] {
+		if isVisibleTo(item.VisibleTo, d.User) && (item.linked == nil || canSeePage(item.linked, d.User)) {
+			items = append(items, item)
+		}
+	}
+	current := d.CurrentPath
+	if current == "" && d.Page != nil {
+		current = splitRoutePath(d.Page.Route)
+	}
+	for i := range items {
+		items[i].Active = strings.HasPrefix(items[i].Href, "/") && isActive(items[i].Href, current)
+	}
+	return items
+}
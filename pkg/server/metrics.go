@@ -0,0 +1,133 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// routeStatusKey identifies a bandwidth counter by the mux pattern that served the request and its status code.
+type routeStatusKey struct {
+	Route  string
+	Status int
+}
+
+// BandwidthStat holds the traffic counters of one route and status.
+type BandwidthStat struct {
+	Route    string `json:"route"`
+	Status   int    `json:"status"`
+	Requests int64  `json:"requests"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// BandwidthCounter accumulates the bytes served per route and status, it is safe for concurrent use.
+type BandwidthCounter struct {
+	mu    sync.Mutex
+	stats map[routeStatusKey]*BandwidthStat
+}
+
+// NewBandwidthCounter returns an empty BandwidthCounter.
+func NewBandwidthCounter() *BandwidthCounter {
+	return &BandwidthCounter{stats: make(map[routeStatusKey]*BandwidthStat)}
+}
+
+// Add records one response of the given size.
+func (c *BandwidthCounter) Add(route string, status int, bytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := routeStatusKey{Route: route, Status: status}
+	stat, ok := c.stats[key]
+	if !ok {
+		stat = &BandwidthStat{Route: route, Status: status}
+		c.stats[key] = stat
+	}
+	stat.Requests++
+	stat.Bytes += bytes
+}
+
+// Snapshot returns a copy of all counters sorted by bytes served, biggest first.
+func (c *BandwidthCounter) Snapshot() []BandwidthStat {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	res := make([]BandwidthStat, 0, len(c.stats))
+	for _, stat := range c.stats {
+		res = append(res, *stat)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Bytes == res[j].Bytes {
+			return res[i].Route < res[j].Route
+		}
+		return res[i].Bytes > res[j].Bytes
+	})
+	return res
+}
+
+// statusRecorder wraps a ResponseWriter to remember the status code and count the bytes written.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap allows http.ResponseController to reach the underlying ResponseWriter.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// withBandwidthAccounting counts the bytes served by next, grouped by the mux pattern that handled the request.
+func withBandwidthAccounting(next http.Handler, counter *BandwidthCounter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		// r.Pattern is filled by the ServeMux once it has routed the request
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		counter.Add(route, status, rec.bytes)
+	})
+}
+
+// getMetricsHandler exposes the bandwidth counters in the Prometheus text format.
+func getMetricsHandler(counter *BandwidthCounter) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		stats := counter.Snapshot()
+		var buf bytes.Buffer
+		w := &buf
+		fmt.Fprintln(w, "# HELP jsonsitego_http_response_bytes_total Bytes served per route and status.")
+		fmt.Fprintln(w, "# TYPE jsonsitego_http_response_bytes_total counter")
+		for _, s := range stats {
+			fmt.Fprintf(w, "jsonsitego_http_response_bytes_total{route=%s,status=\"%d\"} %d\n", strconv.Quote(s.Route), s.Status, s.Bytes)
+		}
+		fmt.Fprintln(w, "# HELP jsonsitego_http_requests_total Requests served per route and status.")
+		fmt.Fprintln(w, "# TYPE jsonsitego_http_requests_total counter")
+		for _, s := range stats {
+			fmt.Fprintf(w, "jsonsitego_http_requests_total{route=%s,status=\"%d\"} %d\n", strconv.Quote(s.Route), s.Status, s.Requests)
+		}
+		writeExperimentMetrics(w)
+		writeResponse(rw, r, http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", buf.Bytes())
+	}
+}
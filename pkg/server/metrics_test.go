@@ -0,0 +1,49 @@
+package server
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBandwidthAccountingRouteWithErrorReporting(t *testing.T) {
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }))
+	defer webhook.Close()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /docs/{slug}", func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, r.PathValue("slug")) })
+	mux.HandleFunc("GET /boom", func(w http.ResponseWriter, r *http.Request) { panic("boom") })
+	config := &SiteConfig{ErrorReporting: &ErrorReportingConfig{Webhook: webhook.URL}}
+	counter := NewBandwidthCounter()
+	// the same order as the handler of a site
+	handler := withBandwidthAccounting(withErrorReporting(mux, config, log.New(io.Discard, "", 0)), counter)
+
+	tests := []struct {
+		path   string
+		route  string
+		status int
+	}{
+		{path: "/docs/intro", route: "GET /docs/{slug}", status: http.StatusOK},
+		{path: "/boom", route: "GET /boom", status: http.StatusInternalServerError},
+		{path: "/missing", route: "unmatched", status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			for _, stat := range counter.Snapshot() {
+				if stat.Status == tt.status {
+					if stat.Route != tt.route {
+						t.Errorf("route counted = %q, want %q", stat.Route, tt.route)
+					}
+					return
+				}
+			}
+			t.Errorf("no request counted with the status %d in %v", tt.status, counter.Snapshot())
+		})
+	}
+}
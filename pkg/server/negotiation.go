@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	mimeHTML        = "text/html"
+	mimeJSON        = "application/json"
+	requestIDHeader = "X-Request-ID"
+)
+
+type requestIDKey struct{}
+
+// requestIDRegex limits the request ids accepted from the clients or proxies, to keep the logs and responses clean
+var requestIDRegex = regexp.MustCompile(`^[\w.:-]{1,128}$`)
+
+// mediaRange is one entry of an Accept header, like text/* or application/json;q=0.8
+type mediaRange struct {
+	Type    string
+	Subtype string
+	Q       float64
+}
+
+// parseAccept returns the media ranges of an Accept header, the invalid entries are ignored.
+func parseAccept(header string) []mediaRange {
+	var ranges []mediaRange
+	for _, entry := range strings.Split(header, ",") {
+		params := strings.Split(entry, ";")
+		mime := strings.ToLower(strings.TrimSpace(params[0]))
+		mainType, subType, ok := strings.Cut(mime, "/")
+		if !ok || mainType == "" || subType == "" || (mainType == "*" && subType != "*") {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.ToLower(strings.TrimSpace(name)) != "q" {
+				continue
+			}
+			if v, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && v >= 0 && v <= 1 {
+				q = v
+			}
+		}
+		ranges = append(ranges, mediaRange{Type: mainType, Subtype: subType, Q: q})
+	}
+	return ranges
+}
+
+// acceptQuality returns the quality given to mime by the most specific matching range, or 0 when none matches.
+func acceptQuality(ranges []mediaRange, mime string) float64 {
+	mainType, subType, _ := strings.Cut(mime, "/")
+	q, specificity := 0.0, -1
+	for _, r := range ranges {
+		s := -1
+		switch {
+		case r.Type == mainType && r.Subtype == subType:
+			s = 2
+		case r.Type == mainType && r.Subtype == "*":
+			s = 1
+		case r.Type == "*" && r.Subtype == "*":
+			s = 0
+		}
+		if s > specificity {
+			q, specificity = r.Q, s
+		}
+	}
+	return q
+}
+
+// negotiateContentType returns the offer preferred by the Accept header of the request, the first offer winning ties.
+// it returns the first offer when there is no Accept header, and an empty string when no offer is acceptable.
+func negotiateContentType(r *http.Request, offers ...string) string {
+	header := strings.TrimSpace(r.Header.Get("Accept"))
+	if header == "" {
+		if len(offers) == 0 {
+			return ""
+		}
+		return offers[0]
+	}
+	ranges := parseAccept(header)
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		if q := acceptQuality(ranges, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// wantsJSON checks if the client prefers a JSON response to the html page.
+func wantsJSON(r *http.Request) bool {
+	return negotiateContentType(r, mimeHTML, mimeJSON) == mimeJSON
+}
+
+// withRequestID gives every request an id, the one sent by the client or a proxy in X-Request-ID if valid,
+// else a random one. it is returned in the X-Request-ID response header and in the JSON errors.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !requestIDRegex.MatchString(id) {
+			b := make([]byte, 8)
+			rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// getRequestID returns the id given to the request by withRequestID, or an empty string.
+func getRequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// ErrorEnvelope is the body of all the JSON error responses, like {"error":{"code":404,"message":"not found"}}
+type ErrorEnvelope struct {
+	Error ErrorBody `json:"error"`
+}
+
+// ErrorBody describes an error, Code is the http status.
+type ErrorBody struct {
+	Code      int    `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"requestID,omitempty"`
+}
+
+// writeJSONError writes a JSON error envelope with the http status code.
+func writeJSONError(w http.ResponseWriter, r *http.Request, code int, message string) {
+	body, err := json.Marshal(ErrorEnvelope{Error: ErrorBody{Code: code, Message: message, RequestID: getRequestID(r)}})
+	if err != nil {
+		// cannot happen with strings and ints, but never send an invalid document
+		body = []byte(`{"error":{"code":500,"message":"error encoding the error"}}`)
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	writeResponse(w, r, code, "application/json; charset=utf-8", append(body, '\n'))
+}
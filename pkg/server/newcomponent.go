@@ -0,0 +1,243 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+
+	siteconfig "github.com/lao-tseu-is-alive/JsonSiteGo/pkg/config"
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/render"
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/version"
+)
+
+const newComponentCommand = "new-component" // subcommand creating the files of a new component
+
+// componentNameRegex matches the component names, which are template names and TypeScript identifiers.
+var componentNameRegex = regexp.MustCompile(`^[A-Z][A-Za-z0-9]*$`)
+
+// newComponentTemplate is the template of a new component, %[1]s is its name.
+const newComponentTemplate = `{{/*
+    %[1]s component, used in the custom_content of a page :
+        { "type": "%[1]s", "keyValues": { "Title": "...", "Text": "..." } }
+    or in the content of a page with the shortcode {{< %[1]s Title="..." Text="..." >}}.
+    the component gets the ContentBlock, its KeyValues are the keyValues of the config :
+        Title  heading of the card, required
+        Text   paragraph below the heading, optional
+    to add a parameter, use it below as {{.Name}} and declare it in %[1]s.schema.json, which validates the config.
+*/}}
+{{define "%[1]s"}}
+    {{ with .KeyValues }}
+        <article>
+            <header><strong>{{.Title}}</strong></header>
+            {{ with .Text }}<p>{{.}}</p>{{ end }}
+        </article>
+    {{ end }}
+{{end}}
+`
+
+// newComponentSchema is the schema stub of the keyValues of a new component, %[1]s is its name.
+const newComponentSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "title": "%[1]s keyValues",
+  "description": "A card with a title and a text.",
+  "type": "object",
+  "required": [
+    "Title"
+  ],
+  "properties": {
+    "Title": {
+      "type": "string",
+      "description": "Heading of the card."
+    },
+    "Text": {
+      "type": "string",
+      "description": "Paragraph below the heading."
+    }
+  },
+  "additionalProperties": false
+}
+`
+
+// componentExamplePage is the page added to the config to show a new component, its fields are in the config order.
+type componentExamplePage struct {
+	Route         string         `json:"route"`
+	Title         string         `json:"title"`
+	Layout        string         `json:"layout"`
+	CreateHandler bool           `json:"create_handler"`
+	CustomContent []ContentBlock `json:"custom_content"`
+}
+
+// getComponentRoute returns the path of the example page of a component, like /components/price-table for PriceTable.
+func getComponentRoute(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) && i > 0 {
+			b.WriteByte('-')
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return "/components/" + b.String()
+}
+
+// addConfigPage returns the config data with page appended to its pages, the rest of the file is kept as is.
+func addConfigPage(data []byte, page interface{}) ([]byte, error) {
+	var config struct {
+		Pages []json.RawMessage `json:"pages"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error parsing the config: %w", err)
+	}
+	offsets := siteconfig.JSONPointerOffsets(data)
+	pagesStart, found := offsets["/pages"]
+	if !found {
+		return nil, errors.New("the config has no pages")
+	}
+	// the new page follows the last one, or opens the empty array, with the indentation of the file
+	insertAt, indent := pagesStart+1, "    "
+	if n := len(config.Pages); n > 0 {
+		lastStart := offsets[fmt.Sprintf("/pages/%d", n-1)]
+		insertAt = lastStart + int64(len(config.Pages[n-1]))
+		lineStart := bytes.LastIndexByte(data[:lastStart], '\n') + 1
+		indent = string(data[lineStart:lastStart])
+	}
+	pageJSON, err := json.MarshalIndent(page, indent, "  ")
+	if err != nil {
+		return nil, err
+	}
+	separator := ",\n"
+	if len(config.Pages) == 0 {
+		separator = "\n"
+	}
+	var out bytes.Buffer
+	out.Write(data[:insertAt])
+	out.WriteString(separator + indent)
+	out.Write(pageJSON)
+	out.Write(data[insertAt:])
+	if !json.Valid(out.Bytes()) {
+		return nil, errors.New("the config with the new page is not valid json")
+	}
+	return out.Bytes(), nil
+}
+
+// writeNewFile creates the file path with data, an existing file is never replaced.
+func writeNewFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// runNewComponent is the new-component subcommand : it creates the template of the component given by name in the
+// components of the templates, with a schema stub of its keyValues unless -no-schema, and adds a page showing it to
+// the config unless -no-config. it returns the exit code of the process.
+func runNewComponent(args []string) int {
+	fs := flag.NewFlagSet(version.APP+" "+newComponentCommand, flag.ContinueOnError)
+	noSchema := fs.Bool("no-schema", false, "do not create the json schema of the keyValues")
+	noConfig := fs.Bool("no-config", false, "do not add the example page of the component to the config")
+	route := fs.String("route", "", "path of the example page, like /components/card for Card")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s %s [flags] Name\n", version.APP, newComponentCommand)
+		fs.PrintDefaults()
+	}
+	// the flags may follow the name of the component
+	var name string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if _, err := parseFlagsToEnv(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if name == "" && fs.NArg() == 1 {
+		name = fs.Arg(0)
+	} else if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+	if !componentNameRegex.MatchString(name) {
+		fmt.Fprintf(os.Stderr, "💥💥 invalid component name %q, expected a name like Card or PriceTable\n", name)
+		return 2
+	}
+	if *route == "" {
+		*route = getComponentRoute(name)
+	}
+	if !strings.HasPrefix(*route, "/") {
+		fmt.Fprintf(os.Stderr, "💥💥 invalid -route %q, expected a path like /components/card\n", *route)
+		return 2
+	}
+
+	// the config is checked first, so that nothing is created when it cannot be updated
+	configPath := getEnvOrDefault("CONFIG_URL", defaultSiteConfigFile)
+	var configData []byte
+	if !*noConfig {
+		if siteconfig.IsURL(configPath) || configPath == siteconfig.StdinPath {
+			fmt.Fprintf(os.Stderr, "💥💥 the config %s is not a local file, use -no-config\n", configPath)
+			return 1
+		}
+		data, err := os.ReadFile(strings.TrimPrefix(configPath, "file://"))
+		if err == nil {
+			var config SiteConfig
+			if err = json.Unmarshal(data, &config); err == nil {
+				for _, page := range config.Pages {
+					if strings.Join(strings.Fields(page.Route), " ") == "GET "+*route {
+						err = fmt.Errorf("the route GET %s already exists, choose another one with -route", *route)
+					}
+				}
+			}
+		}
+		if err == nil {
+			configData, err = addConfigPage(data, componentExamplePage{
+				Route:         "GET " + *route,
+				Title:         name + " component",
+				Layout:        render.DefaultLayout,
+				CreateHandler: true,
+				CustomContent: []ContentBlock{{Type: name, KeyValues: map[string]interface{}{
+					"Title": name + " example",
+					"Text":  "Edit templates/components/" + name + ".gohtml to change this component.",
+				}}},
+			})
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "💥💥 error adding the example page to %s: %v\n", configPath, err)
+			return 1
+		}
+	}
+
+	dir := filepath.Join(getEnvOrDefault("TEMPLATES_DIR", defaultTemplatesDir), "components")
+	templatePath := filepath.Join(dir, name+".gohtml")
+	if err := writeNewFile(templatePath, []byte(fmt.Sprintf(newComponentTemplate, name))); err != nil {
+		fmt.Fprintf(os.Stderr, "💥💥 error creating the component: %v\n", err)
+		return 1
+	}
+	fmt.Printf("✅ created %s\n", templatePath)
+	if !*noSchema {
+		schemaPath := filepath.Join(dir, name+componentSchemaSuffix)
+		if err := writeNewFile(schemaPath, []byte(fmt.Sprintf(newComponentSchema, name))); err != nil {
+			fmt.Fprintf(os.Stderr, "💥💥 error creating the schema of the component: %v\n", err)
+			return 1
+		}
+		fmt.Printf("✅ created %s\n", schemaPath)
+	}
+	if configData != nil {
+		if err := os.WriteFile(strings.TrimPrefix(configPath, "file://"), configData, 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "💥💥 error writing the config: %v\n", err)
+			return 1
+		}
+		fmt.Printf("✅ added the page GET %s showing the component to %s\n", *route, configPath)
+	}
+	return 0
+}
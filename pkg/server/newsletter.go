@@ -0,0 +1,180 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/mailer"
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/storage"
+)
+
+const (
+	newsletterConfirmPath   = "/newsletter/confirm"
+	newsletterPendingPrefix = "newsletter/pending/" // key prefix of the subscriptions waiting for their confirmation
+	newsletterConfirmTTL    = 48 * time.Hour        // time given to open the link of the confirmation email
+	defaultSubscribeField   = "email"
+)
+
+// newsletterTokenRegex matches the tokens of the confirmation links.
+var newsletterTokenRegex = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// pendingSubscription is kept in the store until the link of its confirmation email is opened.
+type pendingSubscription struct {
+	List     string            `json:"list"`
+	Email    string            `json:"email"`
+	Values   map[string]string `json:"values"`
+	Created  time.Time         `json:"created"`
+	Redirect string            `json:"redirect"` // where the subscriber goes once confirmed
+}
+
+// hasNewsletter reports whether a form of config has a subscribe action.
+func hasNewsletter(config *SiteConfig) bool {
+	for _, page := range config.Pages {
+		if page.Form == nil {
+			continue
+		}
+		for _, action := range page.Form.Actions {
+			if action.Type == formActionSubscribe {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getNewsletterList returns the list of the subscribe action, the key of its page by default.
+func getNewsletterList(action FormAction, page *Page) string {
+	return cmp.Or(action.List, getPageKey(page))
+}
+
+// validateNewsletter checks the subscribe actions have an email field, a valid list and an absolute baseURL for
+// their confirmation link.
+func validateNewsletter(config *SiteConfig) []ConfigError {
+	var problems []ConfigError
+	for i, page := range config.Pages {
+		if page.Form == nil {
+			continue
+		}
+		for j, action := range page.Form.Actions {
+			if action.Type != formActionSubscribe {
+				continue
+			}
+			pointer := fmt.Sprintf("/pages/%d/form/actions/%d", i, j)
+			field := cmp.Or(action.Field, defaultSubscribeField)
+			found := false
+			for _, f := range page.Form.Fields {
+				found = found || f.Name == field
+			}
+			if !found {
+				problems = append(problems, ConfigError{Pointer: pointer + "/field", Value: field, Message: "the subscribe action needs a field of the form holding the email"})
+			}
+			if action.List != "" && !experimentNameRegex.MatchString(action.List) {
+				problems = append(problems, ConfigError{Pointer: pointer + "/list", Value: action.List, Message: "the name of a list must be lowercase letters, digits, _ and -"})
+			}
+			if !strings.HasPrefix(config.BaseURL, "http://") && !strings.HasPrefix(config.BaseURL, "https://") {
+				problems = append(problems, ConfigError{Pointer: pointer, Value: action.Type, Message: "the subscribe action needs an absolute http(s) baseURL for its confirmation link"})
+			}
+		}
+	}
+	return problems
+}
+
+// subscribeToNewsletter keeps the subscription of the submission pending and sends the email with its confirmation
+// link, rendered by the template of action or as a plain text. the email is only added to the list once confirmed.
+func subscribeToNewsletter(ctx context.Context, action FormAction, page *Page, site *SiteConfig, submission map[string]string, store storage.Store, sm *siteMailer) error {
+	field := cmp.Or(action.Field, defaultSubscribeField)
+	address, err := mail.ParseAddress(submission[field])
+	if err != nil {
+		return fmt.Errorf("invalid email in field %s: %w", field, err)
+	}
+	token := make([]byte, 16)
+	rand.Read(token)
+	id := hex.EncodeToString(token)
+	redirect := page.Form.RedirectTo
+	if redirect == "" {
+		if redirect = splitRoutePath(page.Route); strings.Contains(redirect, "{") {
+			redirect = "/"
+		}
+	}
+	pending, err := json.Marshal(pendingSubscription{List: getNewsletterList(action, page), Email: address.Address, Values: submission, Created: time.Now().UTC(), Redirect: redirect})
+	if err != nil {
+		return fmt.Errorf("error encoding the subscription: %w", err)
+	}
+	if err := store.Put(ctx, newsletterPendingPrefix+id+".json", pending); err != nil {
+		return fmt.Errorf("error storing the subscription: %w", err)
+	}
+	confirmURL := strings.TrimSuffix(site.BaseURL, "/") + newsletterConfirmPath + "?token=" + id
+	msg := &mailer.Message{Subject: "Please confirm your subscription to " + site.Title}
+	if action.Template == "" {
+		msg.Text = fmt.Sprintf("Please confirm your subscription to %s by opening this link within %d hours:\n\n%s\n\nIf you did not ask for it, ignore this email.\n",
+			site.Title, int(newsletterConfirmTTL.Hours()), confirmURL)
+	}
+	return sm.send(ctx, []string{address.Address}, action.Template, EmailData{Site: site, Page: page, Values: submission, ConfirmURL: confirmURL}, msg)
+}
+
+// getNewsletterConfirmHandler adds the email of the pending subscription of the token to its list, then redirects
+// to the page of the form with a flash message.
+func getNewsletterConfirmHandler(site *SiteConfig, store storage.Store, l *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		token := r.URL.Query().Get("token")
+		fail := func(reason string) {
+			l.Printf("💥 newsletter subscription not confirmed from %s: %s", getClientIP(r), reason)
+			addFlash(w, r, site, FlashError, "This confirmation link is invalid or has expired, please subscribe again.")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+		}
+		if !newsletterTokenRegex.MatchString(token) {
+			fail("invalid token")
+			return
+		}
+		key := newsletterPendingPrefix + token + ".json"
+		data, err := store.Get(r.Context(), key)
+		if err != nil {
+			fail(err.Error())
+			return
+		}
+		var pending pendingSubscription
+		if err := json.Unmarshal(data, &pending); err != nil {
+			fail(err.Error())
+			return
+		}
+		if time.Since(pending.Created) > newsletterConfirmTTL {
+			store.Delete(r.Context(), key)
+			fail("expired")
+			return
+		}
+		line, err := json.Marshal(map[string]interface{}{
+			"time":       time.Now().UTC().Format(time.RFC3339),
+			"email":      pending.Email,
+			"submission": pending.Values,
+		})
+		if err == nil {
+			err = store.Append(r.Context(), "newsletter/"+pending.List+".jsonl", append(line, '\n'))
+		}
+		if err == nil {
+			_, err = store.Incr(r.Context(), "counters/newsletter/"+pending.List, 1)
+		}
+		if err == nil {
+			err = store.Delete(r.Context(), key)
+		}
+		if err != nil {
+			l.Printf("💥💥 error confirming the subscription to the newsletter %s: %v", pending.List, err)
+			addFlash(w, r, site, FlashError, "Sorry, your subscription could not be confirmed, please try again later.")
+			http.Redirect(w, r, pending.Redirect, http.StatusSeeOther)
+			return
+		}
+		l.Printf("✅ subscription to the newsletter %s confirmed", pending.List)
+		addFlash(w, r, site, FlashSuccess, "Your subscription is confirmed, thank you.")
+		http.Redirect(w, r, pending.Redirect, http.StatusSeeOther)
+	}
+}
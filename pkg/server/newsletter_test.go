@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log"
+	"mime/quotedprintable"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/mailer"
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/storage"
+)
+
+// sentMails keeps the messages sent by a mailer.
+type sentMails []string
+
+func (s *sentMails) Send(ctx context.Context, from string, to []string, msg []byte) error {
+	*s = append(*s, string(msg))
+	return nil
+}
+
+func TestNewsletterDoubleOptIn(t *testing.T) {
+	ctx := context.Background()
+	var sent sentMails
+	m, err := mailer.New(&sent, "My Site <noreply@example.com>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm := &siteMailer{mailer: m, templates: map[string]*emailTemplate{}}
+	site := &SiteConfig{Title: "My Site", BaseURL: "https://example.com/"}
+	page := &Page{Route: "/newsletter", Form: &Form{Fields: []FormField{{Name: "email"}}}}
+	action := FormAction{Type: formActionSubscribe, List: "news"}
+	store := storage.NewMemoryStore()
+	l := log.New(io.Discard, "", 0)
+
+	if err := subscribeToNewsletter(ctx, action, page, site, map[string]string{"email": "not an email"}, store, sm); err == nil {
+		t.Errorf("subscribeToNewsletter() accepted an invalid email")
+	}
+	if err := subscribeToNewsletter(ctx, action, page, site, map[string]string{"email": "Alice <alice@example.org>"}, store, sm); err != nil {
+		t.Fatalf("subscribeToNewsletter() error = %v", err)
+	}
+	if _, err := store.Get(ctx, "newsletter/news.jsonl"); err == nil {
+		t.Fatalf("the email is in the list before its confirmation")
+	}
+	if len(sent) != 1 {
+		t.Fatalf("%d emails sent, want one confirmation", len(sent))
+	}
+	body, _ := io.ReadAll(quotedprintable.NewReader(strings.NewReader(sent[0])))
+	link := regexp.MustCompile(`https://example\.com/newsletter/confirm\?token=[0-9a-f]{32}`).FindString(string(body))
+	if link == "" {
+		t.Fatalf("no confirmation link in:\n%s", sent[0])
+	}
+
+	confirm := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		getNewsletterConfirmHandler(site, store, l).ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+	if w := confirm("/newsletter/confirm?token=0123456789abcdef0123456789abcdef"); w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/" {
+		t.Errorf("confirm of an unknown token = %d to %s, want a redirect to /", w.Code, w.Header().Get("Location"))
+	}
+	if w := confirm(strings.TrimPrefix(link, "https://example.com")); w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/newsletter" {
+		t.Errorf("confirm = %d to %s, want a redirect to the page of the form", w.Code, w.Header().Get("Location"))
+	}
+	list, err := store.Get(ctx, "newsletter/news.jsonl")
+	if err != nil || !strings.Contains(string(list), `"email":"alice@example.org"`) {
+		t.Errorf("list after the confirmation = %q, %v", list, err)
+	}
+	if count, _ := store.Incr(ctx, "counters/newsletter/news", 0); count != 1 {
+		t.Errorf("counter of the list = %d, want 1", count)
+	}
+	if w := confirm(strings.TrimPrefix(link, "https://example.com")); w.Header().Get("Location") != "/" {
+		t.Errorf("a second confirm redirects to %s, want the link refused", w.Header().Get("Location"))
+	}
+}
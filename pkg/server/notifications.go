@@ -0,0 +1,275 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/mailer"
+)
+
+const (
+	eventServerStarted      = "server.started"
+	eventConfigReloaded     = "config.reloaded"
+	eventConfigReloadFailed = "config.reload_failed"
+	eventFormSubmitted      = "form.submitted"
+	eventErrorSpike         = "errors.spike"
+
+	notificationFormatJSON  = "json"
+	notificationFormatSlack = "slack"
+
+	notificationTimeout         = 10 * time.Second
+	notificationAttempts        = 4           // the first try and 3 retries
+	notificationRetryDelay      = time.Second // doubled after each failed attempt
+	defaultErrorSpikeCount      = 10
+	defaultErrorSpikeWindow     = time.Minute
+	notificationSignatureHeader = "X-JsonSiteGo-Signature"
+)
+
+// notificationEvents are the events a webhook can subscribe to.
+var notificationEvents = []string{eventServerStarted, eventConfigReloaded, eventConfigReloadFailed, eventFormSubmitted, eventErrorSpike}
+
+// NotificationsConfig holds the webhooks and the emails notified of the events of the server, like a config reload that failed.
+type NotificationsConfig struct {
+	Webhooks   []NotificationWebhook `json:"webhooks,omitempty"`
+	Emails     []NotificationEmail   `json:"emails,omitempty"`
+	ErrorSpike *ErrorSpikeConfig     `json:"errorSpike,omitempty"` // when errors.spike is sent, 10 errors in 1m by default
+}
+
+// NotificationWebhook receives the events it subscribes to, retried with a backoff when it fails. the body is
+// signed with the hmac sha256 of env NOTIFICATIONS_SECRET in the X-JsonSiteGo-Signature header, when it is set.
+type NotificationWebhook struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events,omitempty"` // all the events when empty
+	Format string   `json:"format,omitempty"` // json by default, or slack: {"text": "..."} for Slack, Mattermost and the Matrix hookshot
+}
+
+// NotificationEmail receives by email the events it subscribes to, sent with the mail config.
+type NotificationEmail struct {
+	To       string   `json:"to"`
+	Events   []string `json:"events,omitempty"`   // all the events when empty
+	Template string   `json:"template,omitempty"` // email template of templates/emails receiving .Notification, the message of the event without it
+}
+
+// ErrorSpikeConfig is the number of responses 5xx in a window of time sending the errors.spike event.
+type ErrorSpikeConfig struct {
+	Count  int    `json:"count,omitempty"`
+	Window string `json:"window,omitempty"`
+}
+
+// Notification is the json body sent to the webhooks in the json format.
+type Notification struct {
+	Event   string                 `json:"event"`
+	Site    string                 `json:"site"`
+	Time    string                 `json:"time"`
+	Message string                 `json:"message"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+}
+
+// validateNotifications checks the urls, the events and the formats of the webhooks, and the error spike settings.
+func validateNotifications(config *SiteConfig) []ConfigError {
+	if config.Notifications == nil {
+		return nil
+	}
+	var problems []ConfigError
+	for i, webhook := range config.Notifications.Webhooks {
+		pointer := fmt.Sprintf("/notifications/webhooks/%d", i)
+		if !strings.HasPrefix(webhook.URL, "http://") && !strings.HasPrefix(webhook.URL, "https://") {
+			problems = append(problems, ConfigError{Pointer: pointer + "/url", Value: webhook.URL, Message: "a webhook needs an http(s) url"})
+		}
+		for j, event := range webhook.Events {
+			if !slices.Contains(notificationEvents, event) {
+				problems = append(problems, ConfigError{Pointer: fmt.Sprintf("%s/events/%d", pointer, j), Value: event, Message: "unknown event, expected one of " + strings.Join(notificationEvents, ", ")})
+			}
+		}
+		if webhook.Format != "" && webhook.Format != notificationFormatJSON && webhook.Format != notificationFormatSlack {
+			problems = append(problems, ConfigError{Pointer: pointer + "/format", Value: webhook.Format, Message: "the format must be json or slack"})
+		}
+	}
+	for i, email := range config.Notifications.Emails {
+		pointer := fmt.Sprintf("/notifications/emails/%d", i)
+		if _, err := mail.ParseAddress(email.To); err != nil {
+			problems = append(problems, ConfigError{Pointer: pointer + "/to", Value: email.To, Message: fmt.Sprintf("invalid address: %v", err)})
+		}
+		for j, event := range email.Events {
+			if !slices.Contains(notificationEvents, event) {
+				problems = append(problems, ConfigError{Pointer: fmt.Sprintf("%s/events/%d", pointer, j), Value: event, Message: "unknown event, expected one of " + strings.Join(notificationEvents, ", ")})
+			}
+		}
+	}
+	if len(config.Notifications.Emails) > 0 && config.Mail == nil && (os.Getenv("SMTP_HOST") == "" || os.Getenv("SMTP_FROM") == "") {
+		problems = append(problems, ConfigError{Pointer: "/notifications/emails", Message: "the emails need the mail config, or env SMTP_HOST and SMTP_FROM"})
+	}
+	if spike := config.Notifications.ErrorSpike; spike != nil {
+		if spike.Count < 0 {
+			problems = append(problems, ConfigError{Pointer: "/notifications/errorSpike/count", Value: spike.Count, Message: "count cannot be negative"})
+		}
+		if spike.Window != "" {
+			if _, err := parseServerDuration(spike.Window); err != nil {
+				problems = append(problems, ConfigError{Pointer: "/notifications/errorSpike/window", Value: spike.Window, Message: fmt.Sprintf("invalid duration: %v", err)})
+			}
+		}
+	}
+	return problems
+}
+
+// notify sends event to the webhooks of the live site subscribing to it, in the background.
+func notify(event, message string, data map[string]interface{}, l *log.Logger) {
+	site := getLiveSite()
+	if site == nil || site.Config.Notifications == nil {
+		return
+	}
+	notification := Notification{Event: event, Site: site.Config.Title, Time: time.Now().UTC().Format(time.RFC3339), Message: message, Data: data}
+	for _, webhook := range site.Config.Notifications.Webhooks {
+		if len(webhook.Events) == 0 || slices.Contains(webhook.Events, event) {
+			go sendNotification(webhook, notification, l)
+		}
+	}
+	for _, email := range site.Config.Notifications.Emails {
+		if len(email.Events) == 0 || slices.Contains(email.Events, event) {
+			go sendNotificationEmail(site, email, notification, l)
+		}
+	}
+}
+
+// sendNotificationEmail sends notification to the recipient of email.
+func sendNotificationEmail(site *Site, email NotificationEmail, notification Notification, l *log.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+	defer cancel()
+	msg := &mailer.Message{Subject: fmt.Sprintf("[%s] %s", notification.Site, notification.Event), Text: notification.Message + "\n"}
+	if err := site.Mail.send(ctx, []string{email.To}, email.Template, EmailData{Site: site.Config, Notification: &notification}, msg); err != nil {
+		l.Printf("💥 error sending the notification %s to %s: %v", notification.Event, email.To, err)
+	}
+}
+
+// getNotificationBody returns the body of notification in the format of webhook.
+func getNotificationBody(webhook NotificationWebhook, notification Notification) ([]byte, error) {
+	if webhook.Format == notificationFormatSlack {
+		icon := "ℹ️"
+		if notification.Event == eventConfigReloadFailed || notification.Event == eventErrorSpike {
+			icon = "💥"
+		}
+		return json.Marshal(map[string]string{"text": fmt.Sprintf("%s %s: %s", icon, notification.Site, notification.Message)})
+	}
+	return json.Marshal(notification)
+}
+
+// sendNotification posts notification to webhook, retried with a backoff on the network errors, 429 and 5xx.
+func sendNotification(webhook NotificationWebhook, notification Notification, l *log.Logger) {
+	body, err := getNotificationBody(webhook, notification)
+	if err != nil {
+		l.Printf("💥 error encoding the notification %s: %v", notification.Event, err)
+		return
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	delivery := hex.EncodeToString(id)
+	secret := os.Getenv("NOTIFICATIONS_SECRET")
+	delay := notificationRetryDelay
+	for attempt := 1; ; attempt++ {
+		retry, err := postNotification(webhook.URL, body, notification.Event, delivery, secret)
+		if err == nil {
+			return
+		}
+		if !retry || attempt == notificationAttempts {
+			l.Printf("💥 error sending the notification %s to %s after %d attempts: %v", notification.Event, webhook.URL, attempt, err)
+			return
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// postNotification posts body once, retry is true when the error may not happen again.
+func postNotification(url string, body []byte, event, delivery, secret string) (retry bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-JsonSiteGo-Event", event)
+	req.Header.Set("X-JsonSiteGo-Delivery", delivery)
+	if secret != "" {
+		// the same signature as the push webhooks of GitHub
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set(notificationSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, fmt.Errorf("status %s", resp.Status)
+	}
+	return false, nil
+}
+
+// errorSpike counts the responses 5xx of the current window, the errors.spike event is sent once per window.
+var errorSpike = struct {
+	mu     sync.Mutex
+	start  time.Time
+	count  int
+	sent   bool
+	window time.Duration
+}{}
+
+// countServerError counts a response 5xx of the live site and sends errors.spike when their number in the window
+// reaches the count of the config.
+func countServerError(l *log.Logger) {
+	site := getLiveSite()
+	if site == nil || site.Config.Notifications == nil {
+		return
+	}
+	count, window := defaultErrorSpikeCount, defaultErrorSpikeWindow
+	if spike := site.Config.Notifications.ErrorSpike; spike != nil {
+		if spike.Count > 0 {
+			count = spike.Count
+		}
+		if d, err := parseServerDuration(spike.Window); err == nil {
+			window = d
+		}
+	}
+	errorSpike.mu.Lock()
+	now := time.Now()
+	if now.Sub(errorSpike.start) >= window || errorSpike.window != window {
+		errorSpike.start, errorSpike.count, errorSpike.sent, errorSpike.window = now, 0, false, window
+	}
+	errorSpike.count++
+	send := errorSpike.count >= count && !errorSpike.sent
+	if send {
+		errorSpike.sent = true
+	}
+	errorSpike.mu.Unlock()
+	if send {
+		l.Printf("⚠️ WARNING: %d errors 5xx in less than %s", count, window)
+		notify(eventErrorSpike, fmt.Sprintf("%d errors 5xx in less than %s", count, window), map[string]interface{}{"count": count, "window": window.String()}, l)
+	}
+}
+
+// withServerErrors counts the responses 5xx of next for the errors.spike event.
+func withServerErrors(next http.Handler, l *log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status >= http.StatusInternalServerError {
+			countServerError(l)
+		}
+	})
+}
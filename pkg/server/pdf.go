@@ -0,0 +1,224 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/internal/siteerrors"
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/textpdf"
+)
+
+const (
+	formatPrint       = "print" // ?format=print renders the page with the print layout
+	formatPDF         = "pdf"   // ?format=pdf converts the print version to a pdf file
+	defaultPDFTimeout = 8 * time.Second
+	maxConcurrentPDFs = 2               // pdf exports running at the same time, each one may start a headless Chrome
+	pdfQueueTimeout   = 2 * time.Second // waited for a free slot before answering 503
+)
+
+// errPDFBusy is returned when maxConcurrentPDFs exports are already running for pdfQueueTimeout.
+var errPDFBusy = siteerrors.Unavailable("too many pdf exports are running, retry in a moment")
+
+// pdfSlots bounds the pdf exports running at the same time, so that the clients cannot exhaust the host.
+var pdfSlots = make(chan struct{}, maxConcurrentPDFs)
+
+var (
+	// chromeCandidates are the executables searched in the PATH when CHROME_PATH is not set
+	chromeCandidates = []string{"chromium", "chromium-browser", "google-chrome", "google-chrome-stable"}
+	// htmlTagRegex matches an opening or closing html tag, giving its name
+	htmlTagRegex    = regexp.MustCompile(`<(/?)([a-zA-Z][a-zA-Z0-9]*)[^>]*>`)
+	htmlCommentRe   = regexp.MustCompile(`(?s)<!--.*?-->|<![^>]*>`) // comments and doctype
+	fileNameCleanRe = regexp.MustCompile(`[^\w.-]+`)
+)
+
+// getRenderFormat returns the alternative format asked with ?format, or an empty string for the normal page.
+func getRenderFormat(r *http.Request) string {
+	switch format := strings.ToLower(r.URL.Query().Get("format")); format {
+	case formatPrint, formatPDF:
+		return format
+	default:
+		return ""
+	}
+}
+
+// getPDFPath returns the path of the pdf version of a page, like /about.pdf for /about, or an empty string
+// when the route has wildcards, these pages are only available with ?format=pdf
+func getPDFPath(routePath string) string {
+	if len(getRouteParamNames(routePath)) > 0 {
+		return ""
+	}
+	p := strings.TrimSuffix(strings.TrimSuffix(routePath, "{$}"), "/")
+	if p == "" {
+		return "/index.pdf"
+	}
+	return p + ".pdf"
+}
+
+// getPDFHandler serves the pdf version of the page at routePath, by passing the request to its handler with ?format=pdf
+func getPDFHandler(routePath string, next http.Handler) http.HandlerFunc {
+	pagePath := strings.TrimSuffix(routePath, "{$}")
+	return func(w http.ResponseWriter, r *http.Request) {
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = pagePath
+		query := r2.URL.Query()
+		query.Set("format", formatPDF)
+		r2.URL.RawQuery = query.Encode()
+		next.ServeHTTP(w, r2)
+	}
+}
+
+// getPDFFileName returns the name of the downloaded pdf file, derived from the path of the page.
+func getPDFFileName(urlPath string) string {
+	name := fileNameCleanRe.ReplaceAllString(path.Base(strings.TrimSuffix(urlPath, "/")), "-")
+	if name == "" || name == "-" || name == "." {
+		name = "index"
+	}
+	return name + ".pdf"
+}
+
+// getChromePathFromEnv returns the headless Chrome used to print the pdf files : env CHROME_PATH,
+// or the first chromium or chrome found in the PATH, or an empty string to use the pure Go converter.
+func getChromePathFromEnv() string {
+	if chrome := strings.TrimSpace(os.Getenv("CHROME_PATH")); chrome != "" {
+		return chrome
+	}
+	for _, name := range chromeCandidates {
+		if chrome, err := exec.LookPath(name); err == nil {
+			return chrome
+		}
+	}
+	return ""
+}
+
+// renderPDF converts the print version of a page to pdf, with headless Chrome when available, else with
+// the pure Go converter that keeps the text, headings and lists but not the styles and images. baseURL is the
+// one of the config, never the host of the request, so that Chrome only fetches the resources of the site.
+// at most maxConcurrentPDFs conversions run at the same time, errPDFBusy is returned when none ends in time.
+func renderPDF(ctx context.Context, chrome string, printHTML []byte, baseURL, title string) ([]byte, error) {
+	timer := time.NewTimer(pdfQueueTimeout)
+	defer timer.Stop()
+	select {
+	case pdfSlots <- struct{}{}:
+		defer func() { <-pdfSlots }()
+	case <-timer.C:
+		return nil, errPDFBusy
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if chrome != "" {
+		ctx, cancel := context.WithTimeout(ctx, defaultPDFTimeout)
+		defer cancel()
+		return chromePDF(ctx, chrome, printHTML, baseURL)
+	}
+	return htmlToTextPDF(printHTML, title)
+}
+
+// chromePDF prints the html page with headless Chrome, the relative urls are resolved against baseURL when it is
+// an absolute http(s) url. Chrome is never run without its sandbox, which it refuses to start as root.
+func chromePDF(ctx context.Context, chrome string, printHTML []byte, baseURL string) ([]byte, error) {
+	if os.Geteuid() == 0 {
+		return nil, fmt.Errorf("headless Chrome cannot run as root with its sandbox, run the server as another user or unset CHROME_PATH to use the pure Go converter")
+	}
+	dir, err := os.MkdirTemp("", "jsonsitego-pdf-")
+	if err != nil {
+		return nil, fmt.Errorf("error creating pdf temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	page := printHTML
+	if u, err := url.Parse(baseURL); err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" {
+		base := fmt.Sprintf(`<head><base href="%s">`, html.EscapeString(u.String()))
+		page = bytes.Replace(printHTML, []byte("<head>"), []byte(base), 1)
+	}
+	htmlPath := filepath.Join(dir, "page.html")
+	pdfPath := filepath.Join(dir, "page.pdf")
+	if err := os.WriteFile(htmlPath, page, 0o600); err != nil {
+		return nil, fmt.Errorf("error writing pdf source: %w", err)
+	}
+	args := []string{"--headless=new", "--disable-gpu", "--no-pdf-header-footer", "--user-data-dir=" + filepath.Join(dir, "profile"),
+		"--print-to-pdf=" + pdfPath, "file://" + htmlPath}
+	out, err := exec.CommandContext(ctx, chrome, args...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("error running %s: %w, output: %s", chrome, err, bytes.TrimSpace(out))
+	}
+	data, err := os.ReadFile(pdfPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading pdf printed by %s: %w", chrome, err)
+	}
+	return data, nil
+}
+
+// htmlToTextPDF writes the text of the html page to a pdf : h1 to h3 become headings, li list items
+// and the other block elements paragraphs. scripts, styles, svg and forms are skipped.
+func htmlToTextPDF(printHTML []byte, title string) ([]byte, error) {
+	doc := textpdf.New(title)
+	src := htmlCommentRe.ReplaceAllString(string(printHTML), "")
+	var text strings.Builder
+	kind := ""
+	skipped := ""
+	flush := func() {
+		content := html.UnescapeString(text.String())
+		text.Reset()
+		switch kind {
+		case "h1":
+			doc.AddHeading(1, content)
+		case "h2":
+			doc.AddHeading(2, content)
+		case "h3", "h4", "h5", "h6":
+			doc.AddHeading(3, content)
+		case "li":
+			doc.AddListItem(content)
+		default:
+			doc.AddParagraph(content)
+		}
+	}
+	pos := 0
+	for _, m := range htmlTagRegex.FindAllStringSubmatchIndex(src, -1) {
+		if skipped == "" {
+			text.WriteString(src[pos:m[0]])
+		}
+		pos = m[1]
+		closing := m[3] > m[2]
+		name := strings.ToLower(src[m[4]:m[5]])
+		if skipped != "" {
+			if closing && name == skipped {
+				skipped = ""
+			}
+			continue
+		}
+		switch name {
+		case "head", "script", "style", "svg", "noscript", "form", "nav", "button", "template":
+			if !closing {
+				flush()
+				skipped = name
+			}
+		case "h1", "h2", "h3", "h4", "h5", "h6", "li", "p", "div", "br", "tr", "table", "ul", "ol", "dl", "dt", "dd",
+			"section", "article", "header", "footer", "main", "aside", "blockquote", "pre", "figure", "figcaption",
+			"details", "summary", "hr":
+			flush()
+			if closing {
+				kind = ""
+			} else if kind != "li" || name != "p" {
+				// a paragraph inside a list item stays a list item
+				kind = name
+			}
+		case "td", "th":
+			text.WriteString("  ")
+		}
+	}
+	if skipped == "" {
+		text.WriteString(src[pos:])
+	}
+	flush()
+	return doc.Bytes()
+}
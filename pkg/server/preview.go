@@ -0,0 +1,232 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	siteconfig "github.com/lao-tseu-is-alive/JsonSiteGo/pkg/config"
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/storage"
+)
+
+const previewPathPrefix = "/preview/"
+
+// previewLinkRegex matches the root relative urls of the html attributes, the ones prefixed for a preview.
+var previewLinkRegex = regexp.MustCompile(`\b(href|src|action|poster)="/([^/"]|")`)
+
+// previewNameRegex are the characters kept in the name of a preview taken from a file or a branch.
+var previewNameRegex = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// siteTemplatesKey is the context key of the templates of the preview site serving the request.
+type siteTemplatesKey struct{}
+
+// previewSites are the sites of the other versions of the config, served under /preview/{name}/ so that the reviewers
+// can compare them with the site served before they are merged. they are built from the files of env PREVIEW_DIR,
+// named after the files, or from the remote branches of the git content matching env PREVIEW_GIT_BRANCHES.
+// each one keeps its data in memory, the templates, static files and content files are the ones of the site served.
+type previewSites struct {
+	dir       string // with a config file <name>.json for each preview
+	branches  string // path.Match pattern of the remote branches of the git content
+	git       *GitContent
+	config    string // path of the config in the git checkout
+	schemaURL string
+	bandwidth *BandwidthCounter
+	sites     atomic.Pointer[map[string]*Site]
+	l         *log.Logger
+}
+
+// getPreviewSitesFromEnv returns the previews of env PREVIEW_DIR or PREVIEW_GIT_BRANCHES, nil when both are unset.
+func getPreviewSitesFromEnv(git *GitContent, configURL, schemaURL string, bandwidth *BandwidthCounter, l *log.Logger) (*previewSites, error) {
+	p := &previewSites{
+		dir:       strings.TrimSpace(os.Getenv("PREVIEW_DIR")),
+		branches:  strings.TrimSpace(os.Getenv("PREVIEW_GIT_BRANCHES")),
+		git:       git,
+		schemaURL: schemaURL,
+		bandwidth: bandwidth,
+		l:         l,
+	}
+	if p.dir == "" && p.branches == "" {
+		return nil, nil
+	}
+	if p.dir != "" && p.branches != "" {
+		return nil, fmt.Errorf("env PREVIEW_DIR and PREVIEW_GIT_BRANCHES cannot be used together")
+	}
+	if p.branches != "" {
+		if git == nil {
+			return nil, fmt.Errorf("env PREVIEW_GIT_BRANCHES needs the content in git, set env CONTENT_GIT_URL")
+		}
+		if _, err := path.Match(p.branches, ""); err != nil {
+			return nil, fmt.Errorf("invalid env PREVIEW_GIT_BRANCHES %q: %w", p.branches, err)
+		}
+		config, err := filepath.Rel(git.dir, configURL)
+		if err != nil || strings.HasPrefix(config, "..") {
+			return nil, fmt.Errorf("the config %s is not in the content checkout %s, env PREVIEW_GIT_BRANCHES cannot be used", configURL, git.dir)
+		}
+		p.config = filepath.ToSlash(config)
+	}
+	if siteconfig.IsFromStdin() {
+		return nil, fmt.Errorf("the previews cannot be served with the config read from stdin")
+	}
+	return p, nil
+}
+
+// getPreviewName returns the name of a preview in its url, the characters other than letters, digits, dots,
+// underscores and dashes, like the slashes of the branches, are replaced by dashes.
+func getPreviewName(name string) string {
+	return strings.Trim(previewNameRegex.ReplaceAllString(name, "-"), "-")
+}
+
+// getConfigs returns the json of each preview config by name, with the name of its source for the errors.
+func (p *previewSites) getConfigs(ctx context.Context) (map[string]configSource, error) {
+	configs := make(map[string]configSource)
+	if p.dir != "" {
+		files, err := filepath.Glob(filepath.Join(p.dir, "*.json"))
+		if err != nil {
+			return nil, fmt.Errorf("error listing the previews of %s: %w", p.dir, err)
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("error reading the preview %s: %w", file, err)
+			}
+			configs[getPreviewName(strings.TrimSuffix(filepath.Base(file), ".json"))] = configSource{Path: file, Data: data}
+		}
+		return configs, nil
+	}
+	p.git.mu.Lock()
+	defer p.git.mu.Unlock()
+	if _, err := p.git.run(ctx, "fetch", "--quiet", "--prune", "origin"); err != nil {
+		return nil, err
+	}
+	out, err := p.git.run(ctx, "for-each-ref", "--format=%(refname:lstrip=3)", "refs/remotes/origin/")
+	if err != nil {
+		return nil, err
+	}
+	for _, branch := range strings.Fields(out) {
+		if matched, _ := path.Match(p.branches, branch); !matched || branch == "HEAD" {
+			continue
+		}
+		data, err := p.git.run(ctx, "show", "origin/"+branch+":"+p.config)
+		if err != nil {
+			p.l.Printf("⚠️ WARNING: branch %s has no config %s, it is not previewed: %v", branch, p.config, err)
+			continue
+		}
+		configs[getPreviewName(branch)] = configSource{Path: branch + ":" + p.config, Data: []byte(data)}
+	}
+	return configs, nil
+}
+
+// load builds the sites of all the previews and serves them in place of the previous ones, a preview whose config
+// is invalid is not served.
+func (p *previewSites) load(ctx context.Context) {
+	if p == nil {
+		return
+	}
+	configs, err := p.getConfigs(ctx)
+	if err != nil {
+		p.l.Printf("💥 error getting the previews: %v", err)
+		return
+	}
+	sites := make(map[string]*Site, len(configs))
+	for name, source := range configs {
+		config, err := parseConfigIn([]configSource{source}, source.Data, p.schemaURL, configOptions{untrusted: true}, p.l)
+		if err == nil {
+			applyEnvOverrides(config)
+			// a preview never writes in the store of the site served
+			sites[name], err = buildSite(config, storage.NewMemoryStore(), p.bandwidth, p.l)
+		}
+		if err != nil {
+			p.l.Printf("💥 error building the preview %s of %s: %v", name, source.Path, err)
+		}
+	}
+	p.sites.Store(&sites)
+	names := make([]string, 0, len(sites))
+	for name := range sites {
+		names = append(names, previewPathPrefix+name+"/")
+	}
+	slices.Sort(names)
+	p.l.Printf("✅ %d previews served: %s", len(sites), strings.Join(names, ", "))
+}
+
+// ServeHTTP serves the request with the site of the preview of its path, its templates and the root relative
+// urls of its pages prefixed with the path of the preview.
+func (p *previewSites) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	var site *Site
+	if sites := p.sites.Load(); sites != nil {
+		site = (*sites)[name]
+	}
+	if site == nil {
+		serveLiveSite(w, r)
+		return
+	}
+	prefix := previewPathPrefix + name
+	r = r.WithContext(context.WithValue(r.Context(), siteTemplatesKey{}, site.Templates))
+	rec := &previewRecorder{ResponseWriter: w, prefix: prefix, head: r.Method == http.MethodHead}
+	http.StripPrefix(prefix, site.Handler).ServeHTTP(rec, r)
+	rec.flush()
+}
+
+// previewRecorder prefixes the redirects and the root relative urls of the html pages of a preview, the html is
+// kept until the handler returns to be rewritten at once.
+type previewRecorder struct {
+	http.ResponseWriter
+	prefix string
+	head   bool // the length of the body is not known
+	status int
+	html   bool
+	body   bytes.Buffer
+}
+
+func (rec *previewRecorder) WriteHeader(code int) {
+	if rec.status != 0 {
+		return
+	}
+	rec.status = code
+	header := rec.Header()
+	if location := header.Get("Location"); strings.HasPrefix(location, "/") && !strings.HasPrefix(location, "//") {
+		header.Set("Location", rec.prefix+location)
+	}
+	isHTML := strings.HasPrefix(header.Get("Content-Type"), "text/html")
+	if isHTML && rec.head {
+		header.Del("Content-Length")
+	}
+	rec.html = isHTML && !rec.head
+	if rec.html {
+		// the length changes with the prefixed urls
+		header.Del("Content-Length")
+		return
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *previewRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+	if rec.html {
+		return rec.body.Write(b)
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// flush sends the html kept with its urls prefixed.
+func (rec *previewRecorder) flush() {
+	if !rec.html {
+		return
+	}
+	body := previewLinkRegex.ReplaceAll(rec.body.Bytes(), []byte(`$1="`+rec.prefix+`/$2`))
+	rec.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	rec.ResponseWriter.WriteHeader(rec.status)
+	rec.ResponseWriter.Write(body)
+}
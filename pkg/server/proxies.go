@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+type requestSchemeKey struct{}
+
+// forwardedHeaders are removed from the requests not coming from a trusted proxy, so no handler can be fooled by them.
+var forwardedHeaders = []string{"X-Forwarded-For", "X-Forwarded-Proto", "X-Forwarded-Host", "X-Real-Ip", "Forwarded"}
+
+// parseTrustedProxies parses ip addresses and cidr ranges, like 10.0.0.0/8 or 192.168.1.10
+func parseTrustedProxies(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if strings.Contains(value, "/") {
+			prefix, err := netip.ParsePrefix(value)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+// validateTrustedProxies checks the addresses and ranges of trustedProxies.
+func validateTrustedProxies(config *SiteConfig) []ConfigError {
+	var problems []ConfigError
+	for i, value := range config.TrustedProxies {
+		if _, err := parseTrustedProxies([]string{value}); err != nil {
+			problems = append(problems, ConfigError{Pointer: fmt.Sprintf("/trustedProxies/%d", i), Value: value, Message: fmt.Sprintf("invalid ip address or cidr range: %v", err)})
+		}
+	}
+	return problems
+}
+
+// getTrustedProxiesFromEnvOrPanic returns the trusted proxies from env TRUSTED_PROXIES, a comma separated list
+// overriding the trustedProxies of the config.
+func getTrustedProxiesFromEnvOrPanic(site *SiteConfig) []netip.Prefix {
+	values := site.TrustedProxies
+	if val, exist := os.LookupEnv("TRUSTED_PROXIES"); exist {
+		values = strings.Split(val, ",")
+	}
+	prefixes, err := parseTrustedProxies(values)
+	if err != nil {
+		panic(fmt.Errorf("💥💥 ERROR: CONFIG ENV TRUSTED_PROXIES or trustedProxies in config is invalid. %v", err))
+	}
+	return prefixes
+}
+
+// isTrustedProxy reports whether addr belongs to one of the trusted ranges.
+func isTrustedProxy(trusted []netip.Prefix, addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// getForwardedClient returns the client address from X-Forwarded-For, reading it from the right and skipping
+// the trusted proxies since the left entries can be forged by the client.
+func getForwardedClient(trusted []netip.Prefix, header string) (netip.Addr, bool) {
+	hops := strings.Split(header, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		if i == 0 || !isTrustedProxy(trusted, addr) {
+			return addr.Unmap(), true
+		}
+	}
+	return netip.Addr{}, false
+}
+
+// withTrustedProxies replaces the RemoteAddr of the requests coming through a trusted proxy by the client address
+// from X-Forwarded-For, and keeps the scheme from X-Forwarded-Proto for getRequestScheme.
+// the X-Forwarded-* headers of the other requests are removed.
+func withTrustedProxies(next http.Handler, trusted []netip.Prefix) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, port, err := net.SplitHostPort(r.RemoteAddr)
+		remote, perr := netip.ParseAddr(host)
+		if err != nil || perr != nil || !isTrustedProxy(trusted, remote) {
+			for _, name := range forwardedHeaders {
+				if r.Header.Get(name) != "" {
+					r = r.Clone(r.Context())
+					for _, name := range forwardedHeaders {
+						r.Header.Del(name)
+					}
+					break
+				}
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		r = r.Clone(r.Context())
+		// a proxy may add its own header line instead of appending to the one of the client, they are read as one list
+		if client, ok := getForwardedClient(trusted, strings.Join(r.Header.Values("X-Forwarded-For"), ",")); ok {
+			r.RemoteAddr = net.JoinHostPort(client.String(), port)
+		}
+		if proto := strings.ToLower(strings.TrimSpace(r.Header.Get("X-Forwarded-Proto"))); proto == "http" || proto == "https" {
+			r = r.WithContext(context.WithValue(r.Context(), requestSchemeKey{}, proto))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// getRequestScheme returns the scheme used by the client : the one given by a trusted proxy, else https when
+// the connection uses tls, else http.
+func getRequestScheme(r *http.Request) string {
+	if scheme, ok := r.Context().Value(requestSchemeKey{}).(string); ok {
+		return scheme
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// getClientIP returns the ip address of the client, from a trusted proxy when withTrustedProxies is used.
+func getClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
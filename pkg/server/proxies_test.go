@@ -0,0 +1,42 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithTrustedProxiesReadsAllTheForwardedLines(t *testing.T) {
+	trusted, err := parseTrustedProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		remote string
+		lines  []string
+		want   string
+	}{
+		{name: "one line", remote: "10.0.0.1:4000", lines: []string{"203.0.113.7, 10.0.0.2"}, want: "203.0.113.7"},
+		{name: "line added by the proxy", remote: "10.0.0.1:4000", lines: []string{"198.51.100.1", "203.0.113.7"}, want: "203.0.113.7"},
+		{name: "forged line and proxy line", remote: "10.0.0.1:4000", lines: []string{"10.0.0.9, 198.51.100.1", "203.0.113.7, 10.0.0.2"}, want: "203.0.113.7"},
+		{name: "untrusted remote", remote: "192.0.2.10:4000", lines: []string{"198.51.100.1"}, want: "192.0.2.10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := withTrustedProxies(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = getClientIP(r)
+			}), trusted)
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			for _, line := range tt.lines {
+				r.Header.Add("X-Forwarded-For", line)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+			if got != tt.want {
+				t.Errorf("client ip = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	publishingJobName    = "publishing" // name of the job of the scheduler publishing the pages, reserved in the tasks
+	publishingRetryDelay = time.Minute  // delay before building the site again when it failed
+)
+
+// isPublished reports whether the page is served at now : it is not a draft, its publishAt is reached
+// and its expireAt is not.
+func isPublished(page *Page, now time.Time) bool {
+	if page.Draft {
+		return false
+	}
+	if page.PublishAt != nil && now.Before(*page.PublishAt) {
+		return false
+	}
+	return page.ExpireAt == nil || now.Before(*page.ExpireAt)
+}
+
+// getNextPublishingChange returns the first publishAt or expireAt of the pages after now, and false when there is none.
+func getNextPublishingChange(site *SiteConfig, now time.Time) (time.Time, bool) {
+	var next time.Time
+	for _, page := range site.Pages {
+		if page.Draft {
+			continue
+		}
+		for _, t := range []*time.Time{page.PublishAt, page.ExpireAt} {
+			if t != nil && t.After(now) && (next.IsZero() || t.Before(next)) {
+				next = *t
+			}
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// validatePublishing checks the pages expire after they are published.
+func validatePublishing(config *SiteConfig) []ConfigError {
+	var problems []ConfigError
+	for i, page := range config.Pages {
+		if page.PublishAt != nil && page.ExpireAt != nil && !page.ExpireAt.After(*page.PublishAt) {
+			problems = append(problems, ConfigError{Pointer: fmt.Sprintf("/pages/%d/expireAt", i), Value: page.ExpireAt.Format(time.RFC3339), Message: "expireAt must be after publishAt"})
+		}
+	}
+	return problems
+}
+
+// getPublishingJob returns the job of the scheduler building the live site again each time one of its pages is
+// published or expires, so that its routes and menu entries appear and disappear on time.
+func getPublishingJob(loader *siteLoader) scheduledJob {
+	return scheduledJob{
+		name:  publishingJobName,
+		retry: publishingRetryDelay,
+		schedule: funcSchedule(func(after time.Time) time.Time {
+			next, _ := getNextPublishingChange(getLiveSite().Config, after)
+			return next
+		}),
+		run: func(ctx context.Context) error {
+			if err := loader.republish(getLiveSite()); err != nil {
+				return fmt.Errorf("error publishing the scheduled pages: %w", err)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/version"
+)
+
+const (
+	serviceWorkerPath  = "/sw.js"
+	defaultPWADisplay  = "standalone"
+	serviceWorkerCache = "jsonsitego-"
+	pwaIconMinSize     = 512 // pixels of the largest icon of the manifest
+)
+
+// PWAConfig enables the progressive web app mode : an installable manifest and a service worker
+// caching the pages and assets so that the site keeps working offline.
+type PWAConfig struct {
+	Enabled  bool     `json:"enabled"`
+	Display  string   `json:"display,omitempty"`  // display mode of the installed site : standalone (default), minimal-ui, fullscreen or browser
+	Precache []string `json:"precache,omitempty"` // extra urls cached at install, like /static/css/site.css
+}
+
+// isPWAEnabled reports whether the site runs in PWA mode.
+func isPWAEnabled(site *SiteConfig) bool {
+	return site.PWA != nil && site.PWA.Enabled
+}
+
+// validatePWA checks that the PWA mode has the icons needed by the browsers to install the site: a favicon whose
+// decoded image is large enough for the 512x512 icon of the manifest.
+func validatePWA(config *SiteConfig) []ConfigError {
+	if !isPWAEnabled(config) {
+		return nil
+	}
+	if config.Favicon == "" {
+		return []ConfigError{{Pointer: "/pwa/enabled", Value: true, Message: "the PWA mode needs a favicon to generate the icons of the manifest"}}
+	}
+	f, err := config.openFile(config.Favicon, os.O_RDONLY, 0)
+	if err != nil {
+		return []ConfigError{{Pointer: "/favicon", Value: config.Favicon, Message: fmt.Sprintf("the favicon of the PWA mode cannot be read: %v", err)}}
+	}
+	defer f.Close()
+	size, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return []ConfigError{{Pointer: "/favicon", Value: config.Favicon, Message: fmt.Sprintf("the favicon of the PWA mode is not a png, jpeg or gif image: %v", err)}}
+	}
+	if size.Width < pwaIconMinSize || size.Height < pwaIconMinSize {
+		return []ConfigError{{Pointer: "/favicon", Value: config.Favicon, Message: fmt.Sprintf("the favicon of the PWA mode is %dx%d, it must be %dx%d or larger for the icon of the manifest", size.Width, size.Height, pwaIconMinSize, pwaIconMinSize)}}
+	}
+	return nil
+}
+
+// getPrecacheURLs returns the urls cached by the service worker at install : the pages of the site
+// that can be linked, the icons, the manifest and the extra urls of the config.
+func getPrecacheURLs(site *SiteConfig) []string {
+	urls := []string{"/"}
+	now := time.Now()
+	for _, page := range site.Pages {
+		// the protected pages would answer the anonymous service worker with a redirect and fail the install
+		if !page.CreateHandler || !isPublished(&page, now) || isProtectedPage(&page) || !strings.HasPrefix(strings.TrimSpace(page.Route), http.MethodGet+" ") {
+			continue
+		}
+		path := splitRoutePath(page.Route)
+		if len(getRouteParamNames(path)) > 0 || strings.HasSuffix(path, "/{$}") {
+			continue
+		}
+		urls = append(urls, path)
+	}
+	urls = append(urls, manifestPath, "/favicon.ico")
+	for _, icon := range faviconPNGs {
+		urls = append(urls, icon.Path)
+	}
+	if site.PWA != nil {
+		urls = append(urls, site.PWA.Precache...)
+	}
+	slices.Sort(urls)
+	return slices.Compact(urls)
+}
+
+// serviceWorkerScript is the service worker : pages are fetched from the network first and fall back to the cache
+// when offline, the other requests are served from the cache first. a new version of the server gets a new cache.
+const serviceWorkerScript = `// generated by %s, do not edit
+const CACHE = %q;
+const PRECACHE = %s;
+
+self.addEventListener("install", (event) => {
+    event.waitUntil(caches.open(CACHE).then((cache) => cache.addAll(PRECACHE)).then(() => self.skipWaiting()));
+});
+
+self.addEventListener("activate", (event) => {
+    event.waitUntil(caches.keys()
+        .then((keys) => Promise.all(keys.filter((k) => k.startsWith(%q) && k !== CACHE).map((k) => caches.delete(k))))
+        .then(() => self.clients.claim()));
+});
+
+self.addEventListener("fetch", (event) => {
+    const request = event.request;
+    if (request.method !== "GET" || new URL(request.url).origin !== self.location.origin) {
+        return;
+    }
+    if (request.mode === "navigate") {
+        event.respondWith(fetch(request)
+            .then((response) => {
+                if (response.ok) {
+                    const copy = response.clone();
+                    caches.open(CACHE).then((cache) => cache.put(request, copy));
+                }
+                return response;
+            })
+            .catch(() => caches.match(request).then((cached) => cached || caches.match("/"))));
+        return;
+    }
+    event.respondWith(caches.match(request).then((cached) => cached || fetch(request).then((response) => {
+        if (response.ok && new URL(request.url).pathname.startsWith(%q)) {
+            const copy = response.clone();
+            caches.open(CACHE).then((cache) => cache.put(request, copy));
+        }
+        return response;
+    })));
+});
+`
+
+// generateServiceWorker returns the service worker of the site, its cache name changes at every start of the server
+// since the config, and so the rendered pages, may have changed.
+func generateServiceWorker(site *SiteConfig, startedAt time.Time) (generatedFile, error) {
+	urls := getPrecacheURLs(site)
+	list, err := json.Marshal(urls)
+	if err != nil {
+		return generatedFile{}, fmt.Errorf("error encoding precache list: %w", err)
+	}
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%d|%s", version.VERSION, version.BuildStamp, startedAt.UnixNano(), list)))
+	cacheName := serviceWorkerCache + hex.EncodeToString(h[:6])
+	script := fmt.Sprintf(serviceWorkerScript, version.APP, cacheName, list, serviceWorkerCache, staticURLPrefix)
+	return generatedFile{ContentType: "text/javascript; charset=utf-8", Data: []byte(script)}, nil
+}
+
+// getServiceWorkerHandler serves the service worker, browsers must always revalidate it to see the new versions.
+func getServiceWorkerHandler(file generatedFile) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+		writeResponse(w, r, http.StatusOK, file.ContentType, file.Data)
+	}
+}
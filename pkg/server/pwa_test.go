@@ -0,0 +1,61 @@
+package server
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidatePWAIconSize(t *testing.T) {
+	dir := t.TempDir()
+	writePNG := func(name string, width, height int) string {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := png.Encode(f, image.NewNRGBA(image.Rect(0, 0, width, height))); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	notImage := filepath.Join(dir, "icon.txt")
+	if err := os.WriteFile(notImage, []byte("not an image"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		favicon string
+		wantErr string
+	}{
+		{name: "512x512", favicon: writePNG("512.png", 512, 512)},
+		{name: "larger", favicon: writePNG("1024.png", 1024, 768)},
+		{name: "too small", favicon: writePNG("256.png", 256, 256), wantErr: "is 256x256, it must be 512x512"},
+		{name: "one side too small", favicon: writePNG("wide.png", 1024, 511), wantErr: "is 1024x511"},
+		{name: "not an image", favicon: notImage, wantErr: "not a png, jpeg or gif"},
+		{name: "missing", favicon: filepath.Join(dir, "missing.png"), wantErr: "cannot be read"},
+		{name: "no favicon", wantErr: "needs a favicon"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &SiteConfig{Favicon: tt.favicon, PWA: &PWAConfig{Enabled: true}}
+			problems := validatePWA(config)
+			if tt.wantErr == "" {
+				if len(problems) > 0 {
+					t.Errorf("validatePWA() = %v, want no problem", problems)
+				}
+				return
+			}
+			if len(problems) != 1 || !strings.Contains(problems[0].Message, tt.wantErr) {
+				t.Errorf("validatePWA() = %v, want a problem about %s", problems, tt.wantErr)
+			}
+		})
+	}
+	if problems := validatePWA(&SiteConfig{Favicon: filepath.Join(dir, "256.png")}); len(problems) > 0 {
+		t.Errorf("validatePWA() without the PWA mode = %v, want no problem", problems)
+	}
+}
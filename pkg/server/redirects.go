@@ -0,0 +1,41 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// getLocalRedirect returns target when it is a path of the site, else / to avoid open redirects. the control
+// characters are refused since the browsers remove them, turning /\t/example.com into //example.com.
+func getLocalRedirect(target string) string {
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") ||
+		strings.ContainsFunc(target, func(r rune) bool { return r < ' ' || r == 0x7f }) {
+		return "/"
+	}
+	return target
+}
+
+// getSafeRedirect returns target as a path of the site when it is one, or an absolute url of the origin of r or of
+// the baseURL, like a Referer, else / so that the redirects of the handlers never lead to another site.
+func getSafeRedirect(r *http.Request, site *SiteConfig, target string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "/"
+	}
+	if u.Scheme == "" && u.Host == "" {
+		return getLocalRedirect(target)
+	}
+	sameOrigin := u.Scheme == getRequestScheme(r) && strings.EqualFold(u.Host, r.Host)
+	if base, err := url.Parse(site.BaseURL); err == nil && base.Host != "" {
+		sameOrigin = sameOrigin || (u.Scheme == base.Scheme && strings.EqualFold(u.Host, base.Host))
+	}
+	if !sameOrigin || u.User != nil {
+		return "/"
+	}
+	path := u.RequestURI()
+	if u.Fragment != "" {
+		path += "#" + u.EscapedFragment()
+	}
+	return getLocalRedirect(path)
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// secretRequestHeaders are never exposed to the templates, they would end in the pages and the output cache.
+var secretRequestHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization"}
+
+// RequestInfo is the part of the request exposed to the templates as .Request, like .Request.Query.Get "utm_source".
+type RequestInfo struct {
+	Path     string            // path of the url, like /docs/intro
+	Query    url.Values        // query parameters of the url
+	Headers  map[string]string // values of the headers listed in templates.requestHeaders, by canonical name
+	Mobile   bool              // device hint from Sec-CH-UA-Mobile, else from the User-Agent
+	Platform string            // device hint from Sec-CH-UA-Platform, like Android or Windows, empty when not sent
+}
+
+// Header returns the value of the header name when it is listed in templates.requestHeaders.
+func (ri *RequestInfo) Header(name string) string {
+	if ri == nil {
+		return ""
+	}
+	return ri.Headers[http.CanonicalHeaderKey(name)]
+}
+
+// validateRequestHeaders checks the headers exposed to the templates are names and not secrets.
+func validateRequestHeaders(config *SiteConfig) []ConfigError {
+	if config.Templates == nil {
+		return nil
+	}
+	var problems []ConfigError
+	for i, header := range config.Templates.RequestHeaders {
+		pointer := fmt.Sprintf("/templates/requestHeaders/%d", i)
+		if header == "" || strings.ContainsAny(header, " ,:") {
+			problems = append(problems, ConfigError{Pointer: pointer, Value: header, Message: "not a header name"})
+			continue
+		}
+		for _, secret := range secretRequestHeaders {
+			if strings.EqualFold(header, secret) {
+				problems = append(problems, ConfigError{Pointer: pointer, Value: header, Message: "this header holds credentials and cannot be exposed to the templates"})
+			}
+		}
+	}
+	return problems
+}
+
+// getRequestInfo returns the request info of r with the headers listed in the templates config of site.
+func getRequestInfo(r *http.Request, site *SiteConfig) *RequestInfo {
+	info := &RequestInfo{
+		Path:     r.URL.Path,
+		Query:    r.URL.Query(),
+		Headers:  make(map[string]string),
+		Platform: strings.Trim(r.Header.Get("Sec-CH-UA-Platform"), `"`),
+	}
+	if site.Templates != nil {
+		for _, header := range site.Templates.RequestHeaders {
+			if value := r.Header.Get(header); value != "" {
+				info.Headers[http.CanonicalHeaderKey(header)] = value
+			}
+		}
+	}
+	if hint := r.Header.Get("Sec-CH-UA-Mobile"); hint != "" {
+		info.Mobile = hint == "?1"
+	} else {
+		// the browsers of phones and most tablets put Mobi in their user agent
+		info.Mobile = strings.Contains(r.Header.Get("User-Agent"), "Mobi")
+	}
+	return info
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	requestsPath            = "/__/requests"
+	defaultRecordedRequests = 100
+)
+
+// RecordedRequest is a request served in dev mode, shown by /__/requests.
+type RecordedRequest struct {
+	ID              string      `json:"id"`
+	Time            time.Time   `json:"time"`
+	Method          string      `json:"method"`
+	URL             string      `json:"url"`
+	Client          string      `json:"client"`
+	Status          int         `json:"status"`
+	Duration        string      `json:"duration"`
+	Size            int64       `json:"size"`               // bytes of the body sent
+	Template        string      `json:"template,omitempty"` // template rendered, the route of the page or the error template
+	RequestHeaders  http.Header `json:"requestHeaders"`     // the secret ones are masked
+	ResponseHeaders http.Header `json:"responseHeaders"`
+}
+
+// requestRecorder keeps the last requests in a ring buffer.
+type requestRecorder struct {
+	mu       sync.Mutex
+	requests []RecordedRequest
+	next     int // index of the next request in requests once it is full
+	size     int
+}
+
+// newRequestRecorder returns a recorder of the last size requests.
+func newRequestRecorder(size int) *requestRecorder {
+	return &requestRecorder{requests: make([]RecordedRequest, 0, size), size: size}
+}
+
+// getRequestRecorderFromEnvOrPanic returns the recorder of the requests in dev mode, or nil, from the content of the
+// env variable :
+// DEV_REQUESTS : number of the last requests kept, 0 disables the recorder
+func getRequestRecorderFromEnvOrPanic() *requestRecorder {
+	if !isDevMode() {
+		return nil
+	}
+	size := defaultRecordedRequests
+	if val := strings.TrimSpace(os.Getenv("DEV_REQUESTS")); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 0 {
+			panic(fmt.Errorf("💥💥 ERROR: CONFIG ENV DEV_REQUESTS should contain a positive integer, got %q", val))
+		}
+		size = n
+	}
+	if size == 0 {
+		return nil
+	}
+	return newRequestRecorder(size)
+}
+
+// add keeps req, replacing the oldest request when the buffer is full.
+func (rr *requestRecorder) add(req RecordedRequest) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	if len(rr.requests) < rr.size {
+		rr.requests = append(rr.requests, req)
+		return
+	}
+	rr.requests[rr.next] = req
+	rr.next = (rr.next + 1) % rr.size
+}
+
+// list returns the requests kept, the last one first.
+func (rr *requestRecorder) list() []RecordedRequest {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	res := make([]RecordedRequest, 0, len(rr.requests))
+	res = append(res, rr.requests[rr.next:]...)
+	res = append(res, rr.requests[:rr.next]...)
+	slices.Reverse(res)
+	return res
+}
+
+// recordedTemplateKey is the context key of the template rendered for a recorded request.
+type recordedTemplateKey struct{}
+
+// recordedTemplate holds the template rendered by the handler of a request.
+type recordedTemplate struct {
+	name string
+}
+
+// recordTemplate keeps name as the template rendered for r, when the requests are recorded.
+func recordTemplate(r *http.Request, name string) {
+	if holder, ok := r.Context().Value(recordedTemplateKey{}).(*recordedTemplate); ok {
+		holder.name = name
+	}
+}
+
+// getRecordedHeaders returns a copy of header with the values of the secret headers masked.
+func getRecordedHeaders(header http.Header) http.Header {
+	res := header.Clone()
+	for _, secret := range append(slices.Clone(secretRequestHeaders), "Set-Cookie") {
+		if _, found := res[secret]; found {
+			res[secret] = []string{"***"}
+		}
+	}
+	return res
+}
+
+// withRequestRecorder keeps the requests served by next in recorder, next is returned as is without recorder.
+// the requests of /__/requests itself are not kept.
+func withRequestRecorder(next http.Handler, recorder *requestRecorder) http.Handler {
+	if recorder == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == requestsPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		holder := &recordedTemplate{}
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), recordedTemplateKey{}, holder)))
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		recorder.add(RecordedRequest{
+			ID:              getRequestID(r),
+			Time:            start,
+			Method:          r.Method,
+			URL:             r.URL.RequestURI(),
+			Client:          getClientIP(r),
+			Status:          rec.status,
+			Duration:        time.Since(start).Round(time.Microsecond).String(),
+			Size:            rec.bytes,
+			Template:        holder.name,
+			RequestHeaders:  getRecordedHeaders(r.Header),
+			ResponseHeaders: getRecordedHeaders(w.Header()),
+		})
+	})
+}
+
+// requestsViewTemplate is the page of the recorded requests, standalone so it does not depend on the templates of
+// the site.
+var requestsViewTemplate = template.Must(template.New("requests").Funcs(template.FuncMap{
+	"integrity": getComputedIntegrity,
+}).Parse(`<!doctype html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta name="robots" content="noindex">
+    <title>Requests | {{.Site}}</title>
+    <link rel="stylesheet" href="https://cdn.jsdelivr.net/npm/@picocss/pico@2/css/pico.min.css"{{with integrity "https://cdn.jsdelivr.net/npm/@picocss/pico@2/css/pico.min.css"}} integrity="{{.}}" crossorigin="anonymous"{{end}}>
+</head>
+<body>
+<main class="container-fluid">
+    <h1>Last requests</h1>
+    <p>The last {{.Size}} requests served in dev mode, the last one first.</p>
+    <figure class="overflow-auto">
+        <table class="striped">
+            <thead><tr><th>Time</th><th>Request</th><th>Status</th><th>Duration</th><th>Size</th><th>Template</th><th>Client</th></tr></thead>
+            <tbody>
+            {{range .Requests}}
+                <tr>
+                    <td><time datetime="{{.Time.Format "2006-01-02T15:04:05Z07:00"}}">{{.Time.Format "15:04:05.000"}}</time></td>
+                    <td>
+                        <details>
+                            <summary>{{.Method}} <code>{{.URL}}</code></summary>
+                            <small>id {{.ID}}</small>
+                            <pre>{{range $name, $values := .RequestHeaders}}{{range $values}}{{$name}}: {{.}}
+{{end}}{{end}}</pre>
+                            <pre>{{range $name, $values := .ResponseHeaders}}{{range $values}}{{$name}}: {{.}}
+{{end}}{{end}}</pre>
+                        </details>
+                    </td>
+                    <td>{{if ge .Status 400}}<mark>{{.Status}}</mark>{{else}}{{.Status}}{{end}}</td>
+                    <td>{{.Duration}}</td>
+                    <td>{{.Size}}</td>
+                    <td>{{with .Template}}<code>{{.}}</code>{{end}}</td>
+                    <td>{{.Client}}</td>
+                </tr>
+            {{else}}
+                <tr><td colspan="7">No request.</td></tr>
+            {{end}}
+            </tbody>
+        </table>
+    </figure>
+</main>
+</body>
+</html>
+`))
+
+// getRequestsViewHandler shows the requests kept by recorder, as json for the api clients.
+func getRequestsViewHandler(recorder *requestRecorder, l *log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requests := recorder.list()
+		w.Header().Set("Cache-Control", "no-store")
+		if wantsJSON(r) {
+			writeJSON(w, r, http.StatusOK, requests)
+			return
+		}
+		var buf bytes.Buffer
+		err := requestsViewTemplate.Execute(&buf, map[string]interface{}{
+			"Site":     getLiveSite().Config.Title,
+			"Size":     recorder.size,
+			"Requests": requests,
+		})
+		if err != nil {
+			l.Printf("💥 error rendering the requests: %v", err)
+			writeJSONError(w, r, http.StatusInternalServerError, "error rendering the requests")
+			return
+		}
+		writeResponse(w, r, http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+	}
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// writeResponse writes a body rendered in memory with its exact Content-Length, HEAD requests only get the headers.
+func writeResponse(w http.ResponseWriter, r *http.Request, status int, contentType string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
+
+// writeJSON writes v as indented json with writeResponse.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	body, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "error encoding the response: "+err.Error())
+		return
+	}
+	writeResponse(w, r, status, "application/json", append(body, '\n'))
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// reservedPathPrefixes are the paths under which the server registers its own endpoints, in front of the pages
+// or on the admin listener, so that a page there would never be served.
+var reservedPathPrefixes = []string{staticURLPrefix, adminPathPrefix + "/", authPathPrefix + "/", debugPath + "/", configPath + "/", previewPathPrefix}
+
+// pageRoute is a pattern registered for a page, with a description of it naming the page for the problems.
+type pageRoute struct {
+	Pattern string
+	Owner   string
+	Pointer string // of the route of the page
+	Page    int    // index of the page in the config
+	Handler string // page, pdf or form
+}
+
+// getPageRoutes returns the patterns registered by buildSite for the pages having a handler: their route, the
+// pdf version of the GET ones and the POST of their form.
+func getPageRoutes(config *SiteConfig) []pageRoute {
+	var routes []pageRoute
+	for i, page := range config.Pages {
+		if !page.CreateHandler {
+			continue
+		}
+		pointer := fmt.Sprintf("/pages/%d/route", i)
+		owner := fmt.Sprintf("the page %q (/pages/%d)", page.Title, i)
+		routes = append(routes, pageRoute{Pattern: page.Route, Owner: owner, Pointer: pointer, Page: i, Handler: "page"})
+		parts := strings.Fields(page.Route)
+		if len(parts) == 2 && parts[0] == http.MethodGet {
+			if pdfPath := getPDFPath(parts[1]); pdfPath != "" {
+				routes = append(routes, pageRoute{Pattern: "GET " + pdfPath, Owner: "the pdf version of " + owner, Pointer: pointer, Page: i, Handler: "pdf"})
+			}
+		}
+		if page.Form != nil {
+			routes = append(routes, pageRoute{Pattern: http.MethodPost + " " + splitRoutePath(page.Route), Owner: "the form of " + owner, Pointer: pointer, Page: i, Handler: "form"})
+		}
+	}
+	return routes
+}
+
+// registerProbe registers pattern on mux like http.ServeMux.Handle, returning its panic as an error.
+func registerProbe(mux *http.ServeMux, pattern string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	mux.Handle(pattern, http.NotFoundHandler())
+	return nil
+}
+
+// getConflictReason returns the explanation of the mux for a conflict, like "GET /a/{x} and GET /{y}/b both match
+// some paths, like "/a/b". But neither is more specific than the other.", without the file positions.
+func getConflictReason(err error) string {
+	if _, reason, found := strings.Cut(err.Error(), ":\n"); found {
+		return strings.Join(strings.Fields(reason), " ")
+	}
+	return err.Error()
+}
+
+// validateRoutes checks the routes of the pages are valid patterns, that no two of them match the same requests
+// without one being more specific than the other, which makes the mux panic, and that none is the path of an
+// endpoint of the server, which would be served instead of the page.
+func validateRoutes(config *SiteConfig) []ConfigError {
+	var problems []ConfigError
+	reserved := getReservedPaths(config)
+	mux := http.NewServeMux()
+	var registered []pageRoute
+	var failed []string // pointers of the pages already having a problem, their pdf and form routes are skipped
+	for _, route := range getPageRoutes(config) {
+		if slices.Contains(failed, route.Pointer) {
+			continue
+		}
+		problemsBefore := len(problems)
+		if err := registerProbe(http.NewServeMux(), route.Pattern); err != nil {
+			problems = append(problems, ConfigError{Pointer: route.Pointer, Value: route.Pattern, Message: fmt.Sprintf("invalid route of %s: %v", route.Owner, err)})
+		} else if path := splitRoutePath(route.Pattern); slices.Contains(reserved, path) || slices.ContainsFunc(reservedPathPrefixes, func(prefix string) bool { return strings.HasPrefix(path, prefix) }) {
+			problems = append(problems, ConfigError{Pointer: route.Pointer, Value: route.Pattern, Message: fmt.Sprintf("the path %s of %s is served by the server itself", path, route.Owner)})
+		} else if err := registerProbe(mux, route.Pattern); err == nil {
+			registered = append(registered, route)
+		} else {
+			// find the route it conflicts with, by registering them alone
+			other := slices.IndexFunc(registered, func(previous pageRoute) bool {
+				pair := http.NewServeMux()
+				return registerProbe(pair, previous.Pattern) == nil && registerProbe(pair, route.Pattern) != nil
+			})
+			message := fmt.Sprintf("%s conflicts with another route: %s", route.Owner, getConflictReason(err))
+			if other >= 0 {
+				message = fmt.Sprintf("%s conflicts with %s on %s: %s", route.Owner, registered[other].Owner, registered[other].Pattern, getConflictReason(err))
+			}
+			problems = append(problems, ConfigError{Pointer: route.Pointer, Value: route.Pattern, Message: message})
+		}
+		if len(problems) > problemsBefore {
+			failed = append(failed, route.Pointer)
+		}
+	}
+	return problems
+}
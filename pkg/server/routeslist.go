@@ -0,0 +1,289 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/render"
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/version"
+)
+
+const (
+	routesCommand = "routes"
+	routesPath    = adminPathPrefix + "/routes"
+)
+
+// RouteInfo describes a route registered by the server, for the routes subcommand and endpoint.
+type RouteInfo struct {
+	Method     string   `json:"method,omitempty"` // empty when the route matches all the methods
+	Path       string   `json:"path"`
+	Listener   string   `json:"listener"`             // public or admin
+	Handler    string   `json:"handler"`              // kind of handler, like page, pdf, form, static or admin
+	Source     string   `json:"source,omitempty"`     // the page or the setting registering the route
+	Template   string   `json:"template,omitempty"`   // of the pages
+	Layout     string   `json:"layout,omitempty"`     // of the pages
+	Middleware []string `json:"middleware,omitempty"` // of this route, the outermost first, after the ones of its listener
+}
+
+// RoutesReport is the json of the routes endpoint and of the routes subcommand with -json.
+type RoutesReport struct {
+	Middleware map[string][]string `json:"middleware"` // of each listener and of the site, the outermost first
+	Routes     []RouteInfo         `json:"routes"`
+}
+
+// routeListOptions are the settings outside of the config deciding which endpoints the server registers.
+type routeListOptions struct {
+	adminToken string
+	gitContent bool
+	audit      bool
+	previews   bool
+	tenants    bool
+}
+
+// siteMiddleware names, in the middleware of the routes, the middlewares of the handler of the site around all its routes.
+const siteMiddleware = "site"
+
+// getRoutesReport returns the routes New and buildSite register for config, in their order of registration.
+// it must be kept in sync with them, the routes of the pages come from getPageRoutes.
+func getRoutesReport(config *SiteConfig, options routeListOptions) RoutesReport {
+	listenerMiddleware := []string{"trustedProxies", "requestID", "ipAccess", "auth", "bodyLimit"}
+	report := RoutesReport{Middleware: map[string][]string{
+		listenerPublic: listenerMiddleware,
+		siteMiddleware: {"maintenance", "canonicalRedirect", "cors", "bandwidthAccounting", "serverErrors", "errorReporting"},
+	}}
+	adminListener := listenerPublic
+	if hasAdminListener(config) {
+		adminListener = listenerAdmin
+		report.Middleware[listenerAdmin] = listenerMiddleware
+	}
+	addSite := func(pattern, handler, source string, middleware ...string) {
+		method, path := "", pattern
+		if parts := strings.Fields(pattern); len(parts) == 2 {
+			method, path = parts[0], parts[1]
+		}
+		report.Routes = append(report.Routes, RouteInfo{Method: method, Path: path, Listener: listenerPublic, Handler: handler, Source: source,
+			Middleware: append([]string{siteMiddleware}, middleware...)})
+	}
+	addAdmin := func(method, path, handler, source string, admin bool) {
+		var middleware []string
+		if admin {
+			middleware = []string{"requireAdmin"}
+		}
+		report.Routes = append(report.Routes, RouteInfo{Method: method, Path: path, Listener: adminListener, Handler: handler, Source: source, Middleware: middleware})
+	}
+
+	// the routes of the site, see buildSite
+	if config.Favicon != "" {
+		addSite("GET /favicon.ico", "favicon", "favicon")
+		addSite("GET "+manifestPath, "favicon", "favicon")
+		for _, icon := range faviconPNGs {
+			addSite("GET "+icon.Path, "favicon", "favicon")
+		}
+		if isPWAEnabled(config) {
+			addSite("GET "+serviceWorkerPath, "serviceWorker", "pwa")
+		}
+	} else if _, found := config.WellKnown["/favicon.ico"]; !found {
+		addSite("GET /favicon.ico", "file", "")
+	}
+	for _, path := range getWellKnownPaths(config) {
+		addSite("GET "+path, "wellKnown", "wellKnown")
+	}
+	if _, replaced := config.WellKnown[webFingerPath]; !replaced {
+		if _, found := getFediverseAccount(config); found {
+			addSite("GET "+webFingerPath, "webfinger", "social")
+		}
+	}
+	if len(config.Events) > 0 {
+		addSite("GET "+eventsICSPath, "events", "events")
+	}
+	if info, err := os.Stat(config.getStaticDir()); err == nil && info.IsDir() {
+		addSite("GET "+staticURLPrefix, "static", config.getStaticDir())
+	}
+	if config.Auth != nil && config.Auth.ClientID != "" {
+		for _, name := range []string{"login", "callback", "logout"} {
+			addSite("GET "+authPathPrefix+"/"+name, "auth", "auth")
+		}
+	}
+	now := time.Now()
+	for _, route := range getPageRoutes(config) {
+		page := &config.Pages[route.Page]
+		if !isPublished(page, now) {
+			continue
+		}
+		var middleware []string
+		if isProtectedPage(page) {
+			middleware = append(middleware, "requireRole")
+		}
+		if route.Handler != "form" && isDevMode() {
+			middleware = append(middleware, "devChecks")
+		}
+		addSite(route.Pattern, route.Handler, fmt.Sprintf("page %q (/pages/%d)", page.Title, route.Page), middleware...)
+		if route.Handler != "form" {
+			info := &report.Routes[len(report.Routes)-1]
+			info.Template, info.Layout = page.Template, render.LayoutName(page.Layout)
+			if page.CustomContent != nil {
+				info.Template = "custom_content"
+			}
+		}
+	}
+	allowed := getAllowedMethods(config)
+	paths := make([]string, 0, len(allowed))
+	for path := range allowed {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	for _, path := range paths {
+		addSite(http.MethodOptions+" "+path, "options", strings.Join(allowed[path], ", "))
+	}
+	addSite("GET /set-theme", "theme", "")
+	addSite("POST "+themeAPIPath, "theme", "")
+	addSite("/", "notFound", "")
+	if options.previews {
+		report.Routes = append(report.Routes, RouteInfo{Path: previewPathPrefix + "{name}/", Listener: listenerPublic, Handler: "preview",
+			Source: "env PREVIEW_DIR or PREVIEW_GIT_BRANCHES", Middleware: []string{"maintenance"}})
+	}
+	if options.tenants {
+		report.Routes = append(report.Routes, RouteInfo{Path: tenantsPathPrefix + "{name}/", Listener: listenerPublic, Handler: "tenant",
+			Source: "env TENANTS_DIR", Middleware: []string{"maintenance"}})
+	}
+
+	// the endpoints of the server, see New
+	addAdmin(http.MethodGet, "/metrics", "metrics", "", false)
+	addAdmin(http.MethodGet, healthPath, "health", "", false)
+	if options.adminToken != "" {
+		addAdmin(http.MethodGet, versionPath, "version", "env ADMIN_TOKEN", true)
+		addAdmin(http.MethodGet, adminPathPrefix+"/bandwidth", "admin", "env ADMIN_TOKEN", true)
+		addAdmin(http.MethodGet, routesPath, "admin", "env ADMIN_TOKEN", true)
+		addAdmin(http.MethodGet, configVersionsPath, "admin", "env ADMIN_TOKEN", true)
+		addAdmin(http.MethodGet, configVersionsPath+"/{id}", "admin", "env ADMIN_TOKEN", true)
+		addAdmin(http.MethodPost, configVersionsPath+"/{id}/rollback", "admin", "env ADMIN_TOKEN", true)
+		addAdmin(http.MethodPost, configReloadPath, "admin", "env ADMIN_TOKEN", true)
+		for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodDelete} {
+			addAdmin(method, maintenancePath, "admin", "env ADMIN_TOKEN", true)
+		}
+		addAdmin(http.MethodGet, flagsPath, "admin", "env ADMIN_TOKEN", true)
+		for _, method := range []string{http.MethodPut, http.MethodDelete} {
+			addAdmin(method, flagsPath+"/{name}", "admin", "env ADMIN_TOKEN", true)
+		}
+		addAdmin(http.MethodGet, tasksPath, "admin", "env ADMIN_TOKEN", true)
+		if options.tenants {
+			addAdmin(http.MethodGet, tenantsPath, "admin", "env TENANTS_DIR", true)
+			addAdmin(http.MethodPost, tenantsPath+"/reload", "admin", "env TENANTS_DIR", true)
+			addAdmin(http.MethodPost, tenantsPath+"/{name}/reload", "admin", "env TENANTS_DIR", true)
+		}
+		if isDebugEnabled(config) {
+			addAdmin(http.MethodGet, debugPath, "debug", "debug", true)
+			if config.Debug.Pprof {
+				addAdmin("", debugPath+"/pprof/", "debug", "debug.pprof", true)
+				for _, name := range []string{"cmdline", "profile", "symbol", "trace"} {
+					addAdmin("", debugPath+"/pprof/"+name, "debug", "debug.pprof", true)
+				}
+			}
+			if config.Debug.Expvar {
+				addAdmin(http.MethodGet, debugPath+"/vars", "debug", "debug.expvar", true)
+			}
+		}
+		if isDevMode() && os.Getenv("DEV_REQUESTS") != "0" {
+			addAdmin(http.MethodGet, requestsPath, "requests", "env APP_ENV", true)
+		}
+	}
+	if options.audit {
+		// the viewer checks the admin token or the viewerRole itself
+		addAdmin(http.MethodGet, auditPath, "audit", "audit", false)
+	}
+	if options.gitContent {
+		if strings.TrimSpace(os.Getenv("CONTENT_WEBHOOK_SECRET")) != "" {
+			report.Routes = append(report.Routes, RouteInfo{Method: http.MethodPost, Path: contentWebhookPath, Listener: listenerPublic, Handler: "webhook", Source: "env CONTENT_WEBHOOK_SECRET"})
+		}
+		addAdmin(http.MethodPut, configPath, "admin", "env CONTENT_GIT_URL", false)
+	}
+	return report
+}
+
+// getRoutesHandler returns the routes of the live site as json.
+func getRoutesHandler(options routeListOptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, r, http.StatusOK, getRoutesReport(getLiveSite().Config, options))
+	}
+}
+
+// writeRoutesTable writes the routes of report as a table aligned in columns.
+func writeRoutesTable(w io.Writer, report RoutesReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "METHOD\tPATH\tLISTENER\tHANDLER\tSOURCE\tTEMPLATE\tMIDDLEWARE")
+	for _, route := range report.Routes {
+		method := route.Method
+		if method == "" {
+			method = "*"
+		}
+		template := route.Template
+		if template != "" {
+			template += " (" + route.Layout + ")"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", method, route.Path, route.Listener, route.Handler,
+			route.Source, template, strings.Join(route.Middleware, ", "))
+	}
+	// the listeners and the site
+	listeners := make([]string, 0, len(report.Middleware))
+	for listener := range report.Middleware {
+		listeners = append(listeners, listener)
+	}
+	slices.Sort(listeners)
+	fmt.Fprintln(tw)
+	for _, listener := range listeners {
+		fmt.Fprintf(tw, "%s middleware:\t%s\n", listener, strings.Join(report.Middleware[listener], ", "))
+	}
+	return tw.Flush()
+}
+
+// runRoutes is the routes subcommand : it lists the routes the server registers for the config, with the page,
+// template and middlewares of each one. it returns the exit code of the process.
+func runRoutes(args []string) int {
+	fs := flag.NewFlagSet(version.APP+" "+routesCommand, flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "write the routes as json, like "+routesPath)
+	if _, err := parseFlagsToEnv(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	pathToTemplates = getEnvOrDefault("TEMPLATES_DIR", defaultTemplatesDir)
+	pathToStatic = getEnvOrDefault("STATIC_DIR", defaultStaticDir)
+	l := log.New(io.Discard, "", 0)
+	gitContent := getGitContentFromEnv(l)
+	config, err := LoadConfig(gitContent.getPath(getEnvOrDefault("CONFIG_URL", defaultSiteConfigFile)), getEnvOrDefault("SCHEMA_URL", defaultSchemaFile), l)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "💥💥 error loading the config: %v\n", err)
+		return 1
+	}
+	applyEnvOverrides(config)
+	audit := config.Audit != nil && config.Audit.File != ""
+	if val, exist := os.LookupEnv("AUDIT_LOG"); exist {
+		audit = strings.TrimSpace(val) != ""
+	}
+	previews := os.Getenv("PREVIEW_DIR") != "" || os.Getenv("PREVIEW_GIT_BRANCHES") != ""
+	tenants := strings.TrimSpace(os.Getenv("TENANTS_DIR")) != ""
+	report := getRoutesReport(config, routeListOptions{adminToken: getAdminTokenFromEnv(), gitContent: gitContent != nil, audit: audit, previews: previews, tenants: tenants})
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	} else {
+		err = writeRoutesTable(os.Stdout, report)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "💥💥 error writing the routes: %v\n", err)
+		return 1
+	}
+	return 0
+}
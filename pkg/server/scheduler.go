@@ -0,0 +1,293 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	tasksPath        = adminPathPrefix + "/tasks"
+	maxSchedulerWait = time.Minute // longest sleep of the scheduler, so that it follows the jobs of a config loaded again
+	cronSearchLimit  = 5 * 366 * 24 * time.Hour
+	cronFieldsCount  = 5
+	jobRunTimeout    = 10 * time.Minute // a job running longer is canceled
+)
+
+// schedule returns the next time a job runs after a time.
+type schedule interface {
+	next(after time.Time) time.Time
+}
+
+// intervalSchedule runs a job at a fixed interval.
+type intervalSchedule time.Duration
+
+func (s intervalSchedule) next(after time.Time) time.Time {
+	return after.Add(time.Duration(s))
+}
+
+// funcSchedule runs a job at the times computed by a function, like the ones a page is published or expires.
+type funcSchedule func(after time.Time) time.Time
+
+func (s funcSchedule) next(after time.Time) time.Time {
+	return s(after)
+}
+
+// cronSchedule runs a job at the minutes matching the five fields of a crontab line, in the local time.
+type cronSchedule struct {
+	minute, hour, day, month, weekday uint64 // bit n set when value n matches
+	anyDay, anyWeekday                bool   // the day of the month and of the week are ORed unless one starts with *, like cron
+}
+
+// cronFieldBounds are the minimum and maximum values of the fields of a cron expression, sunday is 0 or 7.
+var cronFieldBounds = [cronFieldsCount][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+// parseCronField parses a field like *, 5, 1-5, */15, 0-30/10 or a list of them separated by commas.
+func parseCronField(field string, low, high int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step '%s'", stepPart)
+			}
+			step = n
+		}
+		start, end := low, high
+		if rangePart != "*" {
+			first, last, isRange := strings.Cut(rangePart, "-")
+			n, err := strconv.Atoi(first)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value '%s'", first)
+			}
+			start, end = n, n
+			if isRange {
+				if end, err = strconv.Atoi(last); err != nil {
+					return 0, fmt.Errorf("invalid value '%s'", last)
+				}
+			} else if hasStep {
+				end = high
+			}
+		}
+		if start < low || end > high || start > end {
+			return 0, fmt.Errorf("'%s' is not between %d and %d", part, low, high)
+		}
+		for n := start; n <= end; n += step {
+			bits |= 1 << n
+		}
+	}
+	return bits, nil
+}
+
+// parseCron parses the five fields of a crontab line: minute, hour, day of the month, month and day of the week.
+func parseCron(expression string) (*cronSchedule, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != cronFieldsCount {
+		return nil, fmt.Errorf("a cron expression has %d fields: minute hour day month weekday", cronFieldsCount)
+	}
+	var bits [cronFieldsCount]uint64
+	for i, field := range fields {
+		var err error
+		if bits[i], err = parseCronField(field, cronFieldBounds[i][0], cronFieldBounds[i][1]); err != nil {
+			return nil, fmt.Errorf("field %d of the cron expression: %w", i+1, err)
+		}
+	}
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1 // 7 is sunday too
+	}
+	return &cronSchedule{minute: bits[0], hour: bits[1], day: bits[2], month: bits[3], weekday: bits[4],
+		anyDay: strings.HasPrefix(fields[2], "*"), anyWeekday: strings.HasPrefix(fields[4], "*")}, nil
+}
+
+// matchDay reports whether the day of t matches the day of the month and of the week of the schedule.
+func (s *cronSchedule) matchDay(t time.Time) bool {
+	day, weekday := s.day&(1<<t.Day()) != 0, s.weekday&(1<<t.Weekday()) != 0
+	if s.anyDay || s.anyWeekday {
+		return day && weekday
+	}
+	return day || weekday
+}
+
+func (s *cronSchedule) next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	for limit := after.Add(cronSearchLimit); t.Before(limit); {
+		switch {
+		case s.month&(1<<t.Month()) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<t.Hour()) == 0:
+			// in the local time, t.Truncate(time.Hour) is off in the zones with a half hour offset
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	// never, like the 31st of february
+	return time.Time{}
+}
+
+// scheduledJob is a job run periodically by the scheduler, declared in the config or by a feature of the server.
+type scheduledJob struct {
+	name     string // unique, the state of the job is kept by name across the configs loaded again
+	schedule schedule
+	run      func(ctx context.Context) error
+	atStart  bool          // first run at the start of the scheduler, instead of at the first time of its schedule
+	retry    time.Duration // when set, a failed job runs again after it, unless its schedule comes first
+}
+
+// JobStatus is the state of a scheduled job returned by the admin endpoint.
+type JobStatus struct {
+	Name      string     `json:"name"`
+	Running   bool       `json:"running"`
+	LastRun   *time.Time `json:"lastRun,omitempty"`
+	LastError string     `json:"lastError,omitempty"`
+	Duration  string     `json:"duration,omitempty"` // of the last run
+	NextRun   *time.Time `json:"nextRun,omitempty"`
+}
+
+// jobState is what the scheduler remembers of a job.
+type jobState struct {
+	lastRun   time.Time
+	lastError string
+	duration  time.Duration
+	running   bool
+	next      time.Time
+}
+
+// scheduler runs the jobs returned by its jobs function, called again at each wake up so that the jobs follow the
+// config served. a job still running when its time comes again is skipped.
+type scheduler struct {
+	jobs    func() []scheduledJob
+	mu      sync.Mutex
+	states  map[string]*jobState
+	started time.Time
+	wake    chan struct{} // notified when a job ends, its next run may come before the wake up planned
+	l       *log.Logger
+}
+
+// newScheduler returns a scheduler of the jobs returned by jobs.
+func newScheduler(jobs func() []scheduledJob, l *log.Logger) *scheduler {
+	return &scheduler{jobs: jobs, states: make(map[string]*jobState), started: time.Now(), wake: make(chan struct{}, 1), l: l}
+}
+
+// getState returns the state of the job, its next run computed from its last run, or from the start of the
+// scheduler when it never ran. s.mu must be held.
+func (s *scheduler) getState(job scheduledJob) *jobState {
+	state, found := s.states[job.name]
+	if !found {
+		state = &jobState{}
+		s.states[job.name] = state
+	}
+	from := state.lastRun
+	if from.IsZero() {
+		if job.atStart {
+			state.next = s.started
+			return state
+		}
+		from = s.started
+	}
+	state.next = job.schedule.next(from)
+	if job.retry > 0 && state.lastError != "" {
+		if retry := state.lastRun.Add(job.retry); state.next.IsZero() || retry.Before(state.next) {
+			state.next = retry
+		}
+	}
+	return state
+}
+
+// run wakes up at the next run of its jobs, or at most each maxSchedulerWait, until ctx is done.
+func (s *scheduler) run(ctx context.Context) {
+	for {
+		now := time.Now()
+		wait := maxSchedulerWait
+		s.mu.Lock()
+		for _, job := range s.jobs() {
+			state := s.getState(job)
+			if state.next.IsZero() {
+				continue
+			}
+			if !state.next.After(now) {
+				if !state.running {
+					state.running = true
+					go s.runJob(ctx, job, state)
+				}
+				continue
+			}
+			wait = min(wait, state.next.Sub(now))
+		}
+		s.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		case <-s.wake:
+		}
+	}
+}
+
+// runJob runs job and records the result in its state.
+func (s *scheduler) runJob(ctx context.Context, job scheduledJob, state *jobState) {
+	ctx, cancel := context.WithTimeout(ctx, jobRunTimeout)
+	defer cancel()
+	start := time.Now()
+	err := job.run(ctx)
+	defer s.wakeUp()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state.running, state.lastRun, state.duration, state.lastError = false, start, time.Since(start), ""
+	if err != nil {
+		state.lastError = err.Error()
+		s.l.Printf("💥 scheduled job %s failed: %v", job.name, err)
+		return
+	}
+	s.l.Printf("✅ scheduled job %s done in %s", job.name, state.duration.Round(time.Millisecond))
+}
+
+// wakeUp makes the scheduler compute the next runs of its jobs now, like when another config is served.
+func (s *scheduler) wakeUp() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// getStatuses returns the state of the current jobs, sorted by name.
+func (s *scheduler) getStatuses() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := []JobStatus{}
+	for _, job := range s.jobs() {
+		state := s.getState(job)
+		status := JobStatus{Name: job.name, Running: state.running, LastError: state.lastError}
+		if !state.lastRun.IsZero() {
+			lastRun := state.lastRun
+			status.LastRun, status.Duration = &lastRun, state.duration.Round(time.Millisecond).String()
+		}
+		if !state.next.IsZero() {
+			next := state.next
+			status.NextRun = &next
+		}
+		statuses = append(statuses, status)
+	}
+	slices.SortFunc(statuses, func(a, b JobStatus) int { return strings.Compare(a.Name, b.Name) })
+	return statuses
+}
+
+// getTasksHandler returns the state of the scheduled jobs as json.
+func getTasksHandler(s *scheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, r, http.StatusOK, s.getStatuses())
+	}
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expression string
+		wantErr    bool
+		minute     uint64
+		weekday    uint64
+		anyDay     bool
+		anyWeekday bool
+	}{
+		{expression: "* * * * *", minute: 1<<60 - 1, weekday: 1<<8 - 1, anyDay: true, anyWeekday: true},
+		{expression: "*/15 3 * * 1-5", minute: 1 | 1<<15 | 1<<30 | 1<<45, weekday: 0b111110, anyDay: true},
+		{expression: "0,30 * 1 * 7", minute: 1 | 1<<30, weekday: 1 | 1<<7},
+		{expression: "10-40/10 * */2 * */3", minute: 1<<10 | 1<<20 | 1<<30 | 1<<40, weekday: 1 | 1<<3 | 1<<6, anyDay: true, anyWeekday: true},
+		{expression: "5/20 * * * *", minute: 1<<5 | 1<<25 | 1<<45, weekday: 1<<8 - 1, anyDay: true, anyWeekday: true},
+		{expression: "* * * *", wantErr: true},
+		{expression: "60 * * * *", wantErr: true},
+		{expression: "* 24 * * *", wantErr: true},
+		{expression: "* * 0 * *", wantErr: true},
+		{expression: "* * * 13 *", wantErr: true},
+		{expression: "* * * * 8", wantErr: true},
+		{expression: "*/0 * * * *", wantErr: true},
+		{expression: "5-1 * * * *", wantErr: true},
+		{expression: "a * * * *", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			s, err := parseCron(tt.expression)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseCron() accepted %q", tt.expression)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseCron() error = %v", err)
+			}
+			if s.minute != tt.minute || s.weekday != tt.weekday || s.anyDay != tt.anyDay || s.anyWeekday != tt.anyWeekday {
+				t.Errorf("parseCron() = minute %b weekday %b anyDay %v anyWeekday %v, want %b %b %v %v",
+					s.minute, s.weekday, s.anyDay, s.anyWeekday, tt.minute, tt.weekday, tt.anyDay, tt.anyWeekday)
+			}
+		})
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	location := func(name string) *time.Location {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			t.Skipf("no time zone database: %v", err)
+		}
+		return loc
+	}
+	kolkata, zurich := location("Asia/Kolkata"), location("Europe/Zurich")
+	tests := []struct {
+		name       string
+		expression string
+		after      time.Time
+		want       time.Time // zero for never
+	}{
+		{name: "every minute", expression: "* * * * *", after: time.Date(2026, 1, 1, 10, 0, 30, 0, time.UTC), want: time.Date(2026, 1, 1, 10, 1, 0, 0, time.UTC)},
+		{name: "later the same day", expression: "0 12 * * *", after: time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC), want: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)},
+		{name: "the next day", expression: "0 12 * * *", after: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC), want: time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)},
+		{name: "half hour offset zone", expression: "0 12 * * *", after: time.Date(2026, 1, 1, 10, 30, 0, 0, kolkata), want: time.Date(2026, 1, 1, 12, 0, 0, 0, kolkata)},
+		{name: "minutes in a half hour offset zone", expression: "15 9-17/4 * * *", after: time.Date(2026, 1, 1, 9, 45, 0, 0, kolkata), want: time.Date(2026, 1, 1, 13, 15, 0, 0, kolkata)},
+		{name: "next month", expression: "0 0 1 * *", after: time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC), want: time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "day of the month or of the week", expression: "0 0 13 * 5", after: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), want: time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{name: "day of the month and a weekday step", expression: "0 0 1 * */2", after: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), want: time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "day step and a weekday", expression: "0 0 */2 * 1", after: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), want: time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)},
+		{name: "sunday as 7", expression: "0 0 * * 7", after: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), want: time.Date(2026, 1, 4, 0, 0, 0, 0, time.UTC)},
+		{name: "skipped by the daylight saving time", expression: "30 2 * * *", after: time.Date(2026, 3, 29, 0, 0, 0, 0, zurich), want: time.Date(2026, 3, 30, 2, 30, 0, 0, zurich)},
+		{name: "never", expression: "0 0 31 2 *", after: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := parseCron(tt.expression)
+			if err != nil {
+				t.Fatalf("parseCron() error = %v", err)
+			}
+			if got := s.next(tt.after); !got.Equal(tt.want) {
+				t.Errorf("next(%s) of %q = %s, want %s", tt.after, tt.expression, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchedulerNextRun(t *testing.T) {
+	s := newScheduler(nil, log.New(io.Discard, "", 0))
+	hourly := scheduledJob{name: "hourly", schedule: intervalSchedule(time.Hour)}
+	if got := s.getState(hourly).next; !got.Equal(s.started.Add(time.Hour)) {
+		t.Errorf("next run of a job = %s, want one hour after the start", got)
+	}
+	atStart := scheduledJob{name: "at-start", schedule: intervalSchedule(time.Hour), atStart: true}
+	if got := s.getState(atStart).next; !got.Equal(s.started) {
+		t.Errorf("next run of a job run at start = %s, want the start", got)
+	}
+	retried := scheduledJob{name: "retried", schedule: intervalSchedule(time.Hour), retry: time.Minute}
+	lastRun := s.started.Add(time.Hour)
+	s.states[retried.name] = &jobState{lastRun: lastRun, lastError: "failed"}
+	if got := s.getState(retried).next; !got.Equal(lastRun.Add(time.Minute)) {
+		t.Errorf("next run of a failed job = %s, want after its retry delay", got)
+	}
+	s.states[retried.name].lastError = ""
+	if got := s.getState(retried).next; !got.Equal(lastRun.Add(time.Hour)) {
+		t.Errorf("next run of a job done = %s, want its schedule", got)
+	}
+	never := scheduledJob{name: "never", schedule: funcSchedule(func(time.Time) time.Time { return time.Time{} }), retry: time.Minute}
+	s.states[never.name] = &jobState{lastRun: lastRun, lastError: "failed"}
+	if got := s.getState(never).next; !got.Equal(lastRun.Add(time.Minute)) {
+		t.Errorf("next run of a failed job without schedule = %s, want after its retry delay", got)
+	}
+}
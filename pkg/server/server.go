@@ -0,0 +1,151 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultReadTimeout       = 10 * time.Second // max time to read request from the client
+	defaultWriteTimeout      = 10 * time.Second // max time to write response to the client
+	defaultIdleTimeout       = 2 * time.Minute  // max time for connections using TCP Keep-Alive
+	defaultReadHeaderTimeout = 5 * time.Second  // max time to read the request headers
+	defaultMaxHeaderBytes    = http.DefaultMaxHeaderBytes
+	defaultMaxBodyBytes      = 64 << 10 // 64 KB is plenty for forms without file upload
+)
+
+// ServerConfig holds the timeouts and limits of the http server, the durations are Go durations like "30s" or "2m".
+// each value can be overridden by an env variable, like READ_TIMEOUT or MAX_BODY_BYTES
+type ServerConfig struct {
+	ReadTimeout         string `json:"readTimeout,omitempty"`
+	WriteTimeout        string `json:"writeTimeout,omitempty"`
+	IdleTimeout         string `json:"idleTimeout,omitempty"`
+	ReadHeaderTimeout   string `json:"readHeaderTimeout,omitempty"`
+	MaxHeaderBytes      int    `json:"maxHeaderBytes,omitempty"`
+	MaxBodyBytes        int64  `json:"maxBodyBytes,omitempty"`        // max size of the request bodies, like the form submissions
+	MaxConnections      int    `json:"maxConnections,omitempty"`      // max open connections by listener, unlimited when 0
+	MaxConnectionsPerIP int    `json:"maxConnectionsPerIP,omitempty"` // max open connections of a client address, unlimited when 0
+}
+
+// serverLimits are the resolved timeouts and limits of the http server.
+type serverLimits struct {
+	ReadTimeout         time.Duration
+	WriteTimeout        time.Duration
+	IdleTimeout         time.Duration
+	ReadHeaderTimeout   time.Duration
+	MaxHeaderBytes      int
+	MaxBodyBytes        int64
+	MaxConnections      int
+	MaxConnectionsPerIP int
+}
+
+// parseServerDuration parses a positive Go duration like "30s".
+func parseServerDuration(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("duration must be positive")
+	}
+	return d, nil
+}
+
+// getServerDurations returns the duration settings of the config by json name.
+func getServerDurations(config *ServerConfig) map[string]string {
+	return map[string]string{
+		"readTimeout":       config.ReadTimeout,
+		"writeTimeout":      config.WriteTimeout,
+		"idleTimeout":       config.IdleTimeout,
+		"readHeaderTimeout": config.ReadHeaderTimeout,
+	}
+}
+
+// validateServer checks the durations and the connection limits of the server settings.
+func validateServer(config *SiteConfig) []ConfigError {
+	if config.Server == nil {
+		return nil
+	}
+	var problems []ConfigError
+	for name, value := range map[string]int{"maxConnections": config.Server.MaxConnections, "maxConnectionsPerIP": config.Server.MaxConnectionsPerIP} {
+		if value < 0 {
+			problems = append(problems, ConfigError{Pointer: "/server/" + name, Value: value, Message: "the connection limit must be positive, or 0 for unlimited"})
+		}
+	}
+	for name, value := range getServerDurations(config.Server) {
+		if value == "" {
+			continue
+		}
+		if _, err := parseServerDuration(value); err != nil {
+			problems = append(problems, ConfigError{Pointer: "/server/" + name, Value: value,
+				Message: fmt.Sprintf("invalid duration, use a Go duration like 30s or 2m: %v", err)})
+		}
+	}
+	return problems
+}
+
+// getServerDurationFromEnvOrPanic returns the duration in the env variable env, else the config value, else defaultValue.
+func getServerDurationFromEnvOrPanic(env, configValue string, defaultValue time.Duration) time.Duration {
+	if val, exist := os.LookupEnv(env); exist {
+		d, err := parseServerDuration(val)
+		if err != nil {
+			panic(fmt.Errorf("💥💥 ERROR: CONFIG ENV %s should contain a valid duration like 30s. %v", env, err))
+		}
+		return d
+	}
+	if configValue != "" {
+		// already checked by validateServer
+		if d, err := parseServerDuration(configValue); err == nil {
+			return d
+		}
+	}
+	return defaultValue
+}
+
+// getServerSizeFromEnvOrPanic returns the size in bytes in the env variable env, else the config value, else defaultValue.
+func getServerSizeFromEnvOrPanic(env string, configValue, defaultValue int64) int64 {
+	if val, exist := os.LookupEnv(env); exist {
+		n, err := strconv.ParseInt(val, 10, 64)
+		if err != nil || n <= 0 {
+			panic(fmt.Errorf("💥💥 ERROR: CONFIG ENV %s should contain a positive integer. %v", env, err))
+		}
+		return n
+	}
+	if configValue > 0 {
+		return configValue
+	}
+	return defaultValue
+}
+
+// getServerLimitsFromEnvOrPanic returns the timeouts and limits of the server : the env variables READ_TIMEOUT,
+// WRITE_TIMEOUT, IDLE_TIMEOUT, READ_HEADER_TIMEOUT, MAX_HEADER_BYTES, MAX_BODY_BYTES, MAX_CONNECTIONS and
+// MAX_CONNECTIONS_PER_IP override the server settings of the config, which override the defaults.
+func getServerLimitsFromEnvOrPanic(site *SiteConfig) serverLimits {
+	config := site.Server
+	if config == nil {
+		config = &ServerConfig{}
+	}
+	return serverLimits{
+		ReadTimeout:         getServerDurationFromEnvOrPanic("READ_TIMEOUT", config.ReadTimeout, defaultReadTimeout),
+		WriteTimeout:        getServerDurationFromEnvOrPanic("WRITE_TIMEOUT", config.WriteTimeout, defaultWriteTimeout),
+		IdleTimeout:         getServerDurationFromEnvOrPanic("IDLE_TIMEOUT", config.IdleTimeout, defaultIdleTimeout),
+		ReadHeaderTimeout:   getServerDurationFromEnvOrPanic("READ_HEADER_TIMEOUT", config.ReadHeaderTimeout, defaultReadHeaderTimeout),
+		MaxHeaderBytes:      int(getServerSizeFromEnvOrPanic("MAX_HEADER_BYTES", int64(config.MaxHeaderBytes), defaultMaxHeaderBytes)),
+		MaxBodyBytes:        getServerSizeFromEnvOrPanic("MAX_BODY_BYTES", config.MaxBodyBytes, defaultMaxBodyBytes),
+		MaxConnections:      int(getServerSizeFromEnvOrPanic("MAX_CONNECTIONS", int64(config.MaxConnections), 0)),
+		MaxConnectionsPerIP: int(getServerSizeFromEnvOrPanic("MAX_CONNECTIONS_PER_IP", int64(config.MaxConnectionsPerIP), 0)),
+	}
+}
+
+// withBodyLimit caps the size of the request bodies, reading more fails with an *http.MaxBytesError
+// so that the handlers, like the forms one, can answer with their own error message.
+func withBodyLimit(next http.Handler, maxBytes int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		next.ServeHTTP(w, r)
+	})
+}
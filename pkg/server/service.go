@@ -0,0 +1,171 @@
+package server
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/version"
+)
+
+const (
+	serviceCommand = "service" // subcommand installing and controlling the server as a systemd unit or a windows service
+	serviceRun     = "run"     // action run by the service manager
+	serviceUnit    = "unit"    // action printing the systemd unit
+)
+
+// serviceActions are the actions of the service subcommand.
+var serviceActions = []string{"install", "uninstall", "start", "stop", "status", serviceRun, serviceUnit}
+
+// serviceName is the name of the service the server runs as, the tag of its syslog and event log messages.
+var serviceName = version.APP
+
+// serviceConfig is the service installed by the service subcommand.
+type serviceConfig struct {
+	name       string
+	dir        string   // working directory of the server, where its config is read
+	user       string   // account running the systemd unit, root when empty
+	exe        string   // absolute path of the binary
+	serverArgs []string // flags of the server, given after --
+}
+
+// getCommandArgs returns the arguments of the binary run by the service manager.
+func (c serviceConfig) getCommandArgs() []string {
+	args := []string{serviceCommand, serviceRun, "-name", c.name, "-dir", c.dir}
+	if len(c.serverArgs) > 0 {
+		args = append(append(args, "--"), c.serverArgs...)
+	}
+	return args
+}
+
+// quoteSystemdArg quotes arg for the ExecStart of a systemd unit, where % starts a specifier.
+func quoteSystemdArg(arg string) string {
+	arg = strings.ReplaceAll(arg, "%", "%%")
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\;$") {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", "$$").Replace(arg) + `"`
+}
+
+// getSystemdUnit returns the systemd unit running the server of c, restarted when it fails. the env variables,
+// like ADMIN_TOKEN, are read from /etc/default/<name> when it exists.
+func getSystemdUnit(c serviceConfig) string {
+	command := []string{quoteSystemdArg(c.exe)}
+	for _, arg := range c.getCommandArgs() {
+		command = append(command, quoteSystemdArg(arg))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "[Unit]\nDescription=%s site server %s\nAfter=network-online.target\nWants=network-online.target\n\n", version.APP, c.name)
+	fmt.Fprintf(&b, "[Service]\nType=simple\nWorkingDirectory=%s\nEnvironmentFile=-/etc/default/%s\n", c.dir, c.name)
+	if c.user != "" {
+		fmt.Fprintf(&b, "User=%s\n", c.user)
+	}
+	fmt.Fprintf(&b, "ExecStart=%s\nRestart=on-failure\nRestartSec=5\nSyslogIdentifier=%s\n\n", strings.Join(command, " "), c.name)
+	b.WriteString("[Install]\nWantedBy=multi-user.target\n")
+	return b.String()
+}
+
+// runServiceCommand is the service subcommand : install, uninstall, start, stop and status control the service
+// with systemctl or the windows service manager, unit prints the systemd unit and run is the server started by the
+// service manager. it returns the exit code of the process, and the flags of the server when it should run.
+func runServiceCommand(args []string) (int, []string, bool) {
+	flags := flag.NewFlagSet(version.APP+" "+serviceCommand, flag.ContinueOnError)
+	name := flags.String("name", version.APP, "name of the service")
+	dir := flags.String("dir", "", "working directory of the server, where its config is read, the current one by default")
+	user := flags.String("user", "", "account running the systemd unit, root by default")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s %s %s [flags] [-- server flags]\n", version.APP, serviceCommand, strings.Join(serviceActions, "|"))
+		flags.PrintDefaults()
+	}
+	if len(args) == 0 || !slices.Contains(serviceActions, args[0]) {
+		flags.Usage()
+		return 2, nil, false
+	}
+	action := args[0]
+	if err := flags.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0, nil, false
+		}
+		return 2, nil, false
+	}
+	config := serviceConfig{name: *name, dir: *dir, user: *user, serverArgs: flags.Args()}
+	if config.dir == "" {
+		config.dir = "."
+	}
+	var err error
+	if config.dir, err = filepath.Abs(config.dir); err != nil {
+		fmt.Fprintf(os.Stderr, "💥💥 invalid -dir: %v\n", err)
+		return 2, nil, false
+	}
+	serviceName = config.name
+	if action == serviceRun {
+		if err := os.Chdir(config.dir); err != nil {
+			fmt.Fprintf(os.Stderr, "💥💥 error entering %s: %v\n", config.dir, err)
+			return 1, nil, false
+		}
+		return 0, config.serverArgs, true
+	}
+	if config.exe, err = os.Executable(); err != nil {
+		fmt.Fprintf(os.Stderr, "💥💥 error finding the path of the binary: %v\n", err)
+		return 1, nil, false
+	}
+	if defaultServiceLog != "" && !hasLogFlag(config.serverArgs) {
+		config.serverArgs = append([]string{"-log", defaultServiceLog}, config.serverArgs...)
+	}
+	switch action {
+	case serviceUnit:
+		fmt.Print(getSystemdUnit(config))
+		return 0, nil, false
+	case "install":
+		err = installService(config)
+	case "uninstall":
+		err = uninstallService(config.name)
+	default:
+		err = controlService(action, config.name)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "💥💥 error running %s %s of %s: %v\n", serviceCommand, action, config.name, err)
+		return 1, nil, false
+	}
+	if action == "install" || action == "uninstall" {
+		fmt.Printf("✅ service %s %sed\n", config.name, action)
+	}
+	return 0, nil, false
+}
+
+// hasLogFlag reports whether the flags of the server set the log.
+func hasLogFlag(args []string) bool {
+	for _, arg := range args {
+		if name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "="); name == "log" && strings.HasPrefix(arg, "-") {
+			return true
+		}
+	}
+	return false
+}
+
+// serveAsService runs the server like Main, under the service manager when it started the process: it stops the
+// server when the service is stopped.
+func serveAsService(l *log.Logger) error {
+	return runUnderServiceManager(serviceName, func(stop <-chan struct{}) error {
+		srv, err := New(l)
+		if err != nil {
+			return err
+		}
+		errs := make(chan error, 1)
+		go func() {
+			errs <- srv.ListenAndServe()
+		}()
+		select {
+		case err := <-errs:
+			return err
+		case <-stop:
+			l.Printf("INFO: service %s stopped by the service manager", serviceName)
+			return nil
+		}
+	})
+}
@@ -0,0 +1,65 @@
+//go:build !windows
+
+package server
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const systemdUnitDir = "/etc/systemd/system"
+
+// defaultServiceLog is the log of the installed service, the journal of systemd keeps its stderr.
+const defaultServiceLog = ""
+
+// systemctl runs systemctl with args, its output goes to the terminal.
+func systemctl(args ...string) error {
+	cmd := exec.Command("systemctl", args...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("systemctl %s: %w", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// installService writes the systemd unit of c and enables it, an existing unit is not replaced.
+func installService(c serviceConfig) error {
+	path := filepath.Join(systemdUnitDir, c.name+".service")
+	if err := writeNewFile(path, []byte(getSystemdUnit(c))); err != nil {
+		return fmt.Errorf("error writing the unit, uninstall the service first to replace it: %w", err)
+	}
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	return systemctl("enable", c.name)
+}
+
+// uninstallService stops and disables the systemd unit name, then removes it.
+func uninstallService(name string) error {
+	if err := systemctl("disable", "--now", name); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(systemdUnitDir, name+".service")); err != nil {
+		return err
+	}
+	return systemctl("daemon-reload")
+}
+
+// controlService runs the start, stop or status action of systemctl on the unit name.
+func controlService(action, name string) error {
+	return systemctl(action, name)
+}
+
+// runUnderServiceManager runs the server, systemd stops it with a signal.
+func runUnderServiceManager(name string, run func(stop <-chan struct{}) error) error {
+	return run(nil)
+}
+
+// newEventLogWriter fails, the event log is a windows one.
+func newEventLogWriter() (io.Writer, error) {
+	return nil, fmt.Errorf("the %s log is only available on windows", eventLogLog)
+}
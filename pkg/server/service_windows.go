@@ -0,0 +1,219 @@
+//go:build windows
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/version"
+)
+
+// the service manager and the event log are called through advapi32, like golang.org/x/sys/windows/svc does.
+var (
+	advapi32                          = syscall.NewLazyDLL("advapi32.dll")
+	procStartServiceCtrlDispatcherW   = advapi32.NewProc("StartServiceCtrlDispatcherW")
+	procRegisterServiceCtrlHandlerExW = advapi32.NewProc("RegisterServiceCtrlHandlerExW")
+	procSetServiceStatus              = advapi32.NewProc("SetServiceStatus")
+	procRegisterEventSourceW          = advapi32.NewProc("RegisterEventSourceW")
+	procReportEventW                  = advapi32.NewProc("ReportEventW")
+)
+
+const (
+	errorFailedServiceControllerConnect = syscall.Errno(1063) // the process was not started by the service manager
+	errorServiceSpecificError           = 1066
+
+	serviceWin32OwnProcess = 0x10
+	serviceStopped         = 1
+	serviceStopPending     = 3
+	serviceRunning         = 4
+	serviceAcceptStop      = 0x1
+	serviceAcceptShutdown  = 0x4
+	serviceControlStop     = 1
+	serviceControlShutdown = 5
+
+	eventLogError       = 0x1
+	eventLogWarning     = 0x2
+	eventLogInformation = 0x4
+	// the messages of EventCreate.exe show the text of the events as is
+	eventLogRegistryKey = `HKLM\SYSTEM\CurrentControlSet\Services\EventLog\Application\`
+	eventLogMessageFile = `%SystemRoot%\System32\EventCreate.exe`
+)
+
+// defaultServiceLog is the log of the installed service, which has no console.
+const defaultServiceLog = eventLogLog
+
+// windowsServiceStatus is the SERVICE_STATUS of the service manager.
+type windowsServiceStatus struct {
+	serviceType             uint32
+	currentState            uint32
+	controlsAccepted        uint32
+	win32ExitCode           uint32
+	serviceSpecificExitCode uint32
+	checkPoint              uint32
+	waitHint                uint32
+}
+
+// serviceTableEntry is the SERVICE_TABLE_ENTRYW of the service manager.
+type serviceTableEntry struct {
+	name *uint16
+	proc uintptr
+}
+
+// windowsService is the service run by the service manager, its callbacks cannot be closures.
+var windowsService struct {
+	name     *uint16
+	handle   uintptr
+	run      func(stop <-chan struct{}) error
+	stop     chan struct{}
+	stopOnce sync.Once
+	err      error
+}
+
+// setWindowsServiceState reports the state of the service to the service manager.
+func setWindowsServiceState(state, accepted uint32, failed bool) {
+	status := windowsServiceStatus{serviceType: serviceWin32OwnProcess, currentState: state, controlsAccepted: accepted}
+	if failed {
+		status.win32ExitCode, status.serviceSpecificExitCode = errorServiceSpecificError, 1
+	}
+	procSetServiceStatus.Call(windowsService.handle, uintptr(unsafe.Pointer(&status)))
+}
+
+// windowsServiceHandler receives the controls of the service manager.
+func windowsServiceHandler(control, eventType uint32, eventData, context uintptr) uintptr {
+	if control == serviceControlStop || control == serviceControlShutdown {
+		setWindowsServiceState(serviceStopPending, 0, false)
+		windowsService.stopOnce.Do(func() { close(windowsService.stop) })
+	}
+	return 0
+}
+
+// windowsServiceMain is the ServiceMain called by the service manager in its own thread.
+func windowsServiceMain(argc uint32, argv **uint16) uintptr {
+	handle, _, err := procRegisterServiceCtrlHandlerExW.Call(uintptr(unsafe.Pointer(windowsService.name)), syscall.NewCallback(windowsServiceHandler), 0)
+	if handle == 0 {
+		windowsService.err = fmt.Errorf("error registering the service handler: %w", err)
+		return 0
+	}
+	windowsService.handle = handle
+	setWindowsServiceState(serviceRunning, serviceAcceptStop|serviceAcceptShutdown, false)
+	windowsService.err = windowsService.run(windowsService.stop)
+	setWindowsServiceState(serviceStopped, 0, windowsService.err != nil)
+	return 0
+}
+
+// runUnderServiceManager runs the server as the service name when the service manager started the process, else
+// like on the other platforms.
+func runUnderServiceManager(name string, run func(stop <-chan struct{}) error) error {
+	namePtr, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+	windowsService.name, windowsService.run, windowsService.stop = namePtr, run, make(chan struct{})
+	table := []serviceTableEntry{{name: namePtr, proc: syscall.NewCallback(windowsServiceMain)}, {}}
+	if r, _, err := procStartServiceCtrlDispatcherW.Call(uintptr(unsafe.Pointer(&table[0]))); r == 0 {
+		if errors.Is(err, errorFailedServiceControllerConnect) {
+			// started from a console
+			return run(nil)
+		}
+		return fmt.Errorf("error connecting to the service manager: %w", err)
+	}
+	return windowsService.err
+}
+
+// sc runs sc.exe with args, its output goes to the terminal.
+func sc(args ...string) error {
+	cmd := exec.Command("sc.exe", args...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("sc.exe %s: %w", args[0], err)
+	}
+	return nil
+}
+
+// installService creates the windows service of c, started with windows and restarted when it fails, and
+// registers its event log source.
+func installService(c serviceConfig) error {
+	command := []string{syscall.EscapeArg(c.exe)}
+	for _, arg := range c.getCommandArgs() {
+		command = append(command, syscall.EscapeArg(arg))
+	}
+	if err := sc("create", c.name, "binPath=", strings.Join(command, " "), "start=", "auto", "DisplayName=", version.APP+" "+c.name); err != nil {
+		return err
+	}
+	if err := sc("description", c.name, fmt.Sprintf("%s site server of %s", version.APP, c.dir)); err != nil {
+		return err
+	}
+	if err := sc("failure", c.name, "reset=", "86400", "actions=", "restart/5000/restart/5000/restart/60000"); err != nil {
+		return err
+	}
+	key := eventLogRegistryKey + c.name
+	reg := exec.Command("reg.exe", "add", key, "/v", "EventMessageFile", "/t", "REG_EXPAND_SZ", "/d", eventLogMessageFile, "/f")
+	if out, err := reg.CombinedOutput(); err != nil {
+		return fmt.Errorf("error registering the event log source: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	reg = exec.Command("reg.exe", "add", key, "/v", "TypesSupported", "/t", "REG_DWORD", "/d", "7", "/f")
+	if out, err := reg.CombinedOutput(); err != nil {
+		return fmt.Errorf("error registering the event log source: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// uninstallService stops and deletes the windows service name with its event log source.
+func uninstallService(name string) error {
+	// a service already stopped fails to stop
+	sc("stop", name)
+	if err := sc("delete", name); err != nil {
+		return err
+	}
+	if out, err := exec.Command("reg.exe", "delete", eventLogRegistryKey+name, "/f").CombinedOutput(); err != nil {
+		return fmt.Errorf("error removing the event log source: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// controlService runs the start, stop or status action of sc.exe on the service name.
+func controlService(action, name string) error {
+	if action == "status" {
+		action = "query"
+	}
+	return sc(action, name)
+}
+
+// eventLogWriter sends each log message to the application event log with the type of its emoji.
+type eventLogWriter struct {
+	handle uintptr
+}
+
+func (e *eventLogWriter) Write(b []byte) (int, error) {
+	msg, err := syscall.UTF16PtrFromString(strings.TrimRight(strings.ReplaceAll(string(b), "\x00", ""), "\n"))
+	if err != nil {
+		return 0, err
+	}
+	eventType := []uintptr{eventLogInformation, eventLogInformation, eventLogWarning, eventLogError}[logSeverity(string(b))]
+	strs := []*uint16{msg}
+	if r, _, err := procReportEventW.Call(e.handle, eventType, 0, 1, 0, 1, 0, uintptr(unsafe.Pointer(&strs[0])), 0); r == 0 {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// newEventLogWriter returns the writer of LOG_FILE eventlog, the source being the name of the service.
+func newEventLogWriter() (io.Writer, error) {
+	source, err := syscall.UTF16PtrFromString(serviceName)
+	if err != nil {
+		return nil, err
+	}
+	handle, _, err := procRegisterEventSourceW.Call(0, uintptr(unsafe.Pointer(source)))
+	if handle == 0 {
+		return nil, fmt.Errorf("error opening the event log: %w", err)
+	}
+	return &eventLogWriter{handle: handle}, nil
+}
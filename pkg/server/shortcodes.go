@@ -0,0 +1,146 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"regexp"
+	"strings"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/render"
+)
+
+var (
+	// shortcodeRegex matches a shortcode tag like {{< Embed provider="youtube" id="abc" >}} or its closing {{< /Name >}}
+	shortcodeRegex = regexp.MustCompile(`\{\{<\s*(/?)([A-Za-z][\w-]*)((?:\s+[A-Za-z_][\w-]*=(?:"[^"]*"|'[^']*'|[^\s"'>]+))*)\s*>\}\}`)
+	// shortcodeParamRegex matches one key="value" parameter of a shortcode
+	shortcodeParamRegex = regexp.MustCompile(`([A-Za-z_][\w-]*)=(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+// shortcodeInnerKey is the key receiving the text between an opening and a closing shortcode.
+const shortcodeInnerKey = "Inner"
+
+// contentPart is a piece of a page content, either plain text or a component given by a shortcode.
+type contentPart struct {
+	Text  string
+	Block *ContentBlock
+}
+
+// parseShortcodes splits the content in text and components, like Hugo shortcodes :
+// {{< Name key="value" other=12 >}} renders the component Name with these keyValues, quoted values are strings,
+// unquoted values are decoded as json when possible (numbers, booleans).
+// {{< Name >}}text{{< /Name >}} also passes the text between the tags in the Inner key, shortcodes cannot be nested.
+func parseShortcodes(content string) ([]contentPart, error) {
+	var parts []contentPart
+	pos := 0
+	for pos < len(content) {
+		loc := shortcodeRegex.FindStringSubmatchIndex(content[pos:])
+		if loc == nil {
+			parts = append(parts, contentPart{Text: content[pos:]})
+			break
+		}
+		start, end := pos+loc[0], pos+loc[1]
+		closing := content[pos+loc[2]:pos+loc[3]] == "/"
+		name := content[pos+loc[4] : pos+loc[5]]
+		if closing {
+			return nil, fmt.Errorf("shortcode closing tag {{< /%s >}} without opening tag", name)
+		}
+		if start > pos {
+			parts = append(parts, contentPart{Text: content[pos:start]})
+		}
+		block := &ContentBlock{Type: name, KeyValues: parseShortcodeParams(content[pos+loc[6] : pos+loc[7]])}
+		pos = end
+		// the shortcode has an inner text when the next tag is its closing one
+		if next := shortcodeRegex.FindStringSubmatchIndex(content[pos:]); next != nil &&
+			content[pos+next[2]:pos+next[3]] == "/" && content[pos+next[4]:pos+next[5]] == name {
+			block.KeyValues[shortcodeInnerKey] = strings.TrimSpace(content[pos : pos+next[0]])
+			pos += next[1]
+		}
+		parts = append(parts, contentPart{Block: block})
+	}
+	return parts, nil
+}
+
+// parseShortcodeParams returns the keyValues given by the parameters of a shortcode.
+func parseShortcodeParams(params string) map[string]interface{} {
+	keyValues := make(map[string]interface{})
+	for _, m := range shortcodeParamRegex.FindAllStringSubmatch(params, -1) {
+		key := m[1]
+		switch {
+		case m[4] != "":
+			var v interface{}
+			if err := json.Unmarshal([]byte(m[4]), &v); err == nil {
+				keyValues[key] = v
+			} else {
+				keyValues[key] = m[4]
+			}
+		case m[3] != "":
+			keyValues[key] = m[3]
+		default:
+			keyValues[key] = m[2]
+		}
+	}
+	return keyValues
+}
+
+// getRenderContentFunc returns the renderContent template function of a page template, it renders the
+// text of the content in html-escaped paragraphs and the shortcodes with the components of tmpl.
+func getRenderContentFunc(tmpl *template.Template) func(content string) (template.HTML, error) {
+	return func(content string) (template.HTML, error) {
+		parts, err := parseShortcodes(content)
+		if err != nil {
+			return "", err
+		}
+		var buf bytes.Buffer
+		for _, part := range parts {
+			if part.Block == nil {
+				if strings.TrimSpace(part.Text) != "" {
+					buf.WriteString("<p>" + template.HTMLEscapeString(part.Text) + "</p>")
+				}
+				continue
+			}
+			if tmpl.Lookup(part.Block.Type) == nil {
+				return "", fmt.Errorf("unknown shortcode component %q", part.Block.Type)
+			}
+			if err := executeBlock(&buf, tmpl, part.Block.Type, part.Block); err != nil {
+				return "", fmt.Errorf("error rendering shortcode %s: %w", part.Block.Type, err)
+			}
+		}
+		return template.HTML(buf.String()), nil
+	}
+}
+
+// getRenderBlockFunc returns the renderBlock template function of a page template, it renders a block of the
+// custom_content with the component of tmpl named by its type, so that any component of the templates can be used.
+// an unknown component is an error in strict mode, else it is shown as unsupported.
+func getRenderBlockFunc(tmpl *template.Template, strict bool) func(block ContentBlock) (template.HTML, error) {
+	return func(block ContentBlock) (template.HTML, error) {
+		if tmpl.Lookup(block.Type) == nil && strict {
+			return "", fmt.Errorf("unknown component %q", block.Type)
+		}
+		if tmpl.Lookup(block.Type) == nil {
+			return template.HTML("<article><header><strong>Unsupported Component</strong></header><p>Error: The component type '" +
+				template.HTMLEscapeString(block.Type) + "' is not supported.</p></article>"), nil
+		}
+		var buf bytes.Buffer
+		if err := executeBlock(&buf, tmpl, block.Type, block); err != nil {
+			return "", fmt.Errorf("error rendering component %s: %w", block.Type, err)
+		}
+		return template.HTML(buf.String()), nil
+	}
+}
+
+// executeBlock renders block with the component name of tmpl, between the marks of the component in dev mode.
+func executeBlock(buf *bytes.Buffer, tmpl *template.Template, name string, block any) error {
+	if !isDevMode() {
+		return tmpl.ExecuteTemplate(buf, name, block)
+	}
+	file := render.TemplateFile(tmpl, name)
+	buf.WriteString(render.MarkTemplate("b", name, file))
+	if err := tmpl.ExecuteTemplate(buf, name, block); err != nil {
+		return err
+	}
+	buf.WriteString(render.MarkTemplate("e", name, file))
+	return nil
+}
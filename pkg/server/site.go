@@ -0,0 +1,263 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/storage"
+)
+
+// Site is everything served for one config, built by buildSite and replaced as a whole by applySite.
+// the listeners, limits, trusted proxies and admin endpoints are set at startup and stay the same.
+type Site struct {
+	Version   string // id of the config version in the history, empty when it could not be saved
+	Config    *SiteConfig
+	Auth      *Authenticator
+	Handler   http.Handler                // the pages, forms, auth, static files and 404 of the config
+	Templates map[string]TemplateRenderer // the templates of the config, cached when the site is applied
+	IPAccess  []ipAccessRule              // the ipAccess rules of the config, checked by withIPAccess
+	Mail      *siteMailer                 // sends the form emails and the alerts with the email templates of the config
+}
+
+// liveSite is the site currently served.
+var liveSite atomic.Pointer[Site]
+
+// getLiveSite returns the site currently served.
+func getLiveSite() *Site {
+	return liveSite.Load()
+}
+
+// applySite starts serving site, the requests in progress finish with the previous one.
+func applySite(site *Site) {
+	setLogLevelsFromConfig(site.Config)
+	setTemplateCache(site.Templates)
+	liveSite.Store(site)
+}
+
+// buildSite parses the templates and creates the handlers of config, without changing the site currently served.
+func buildSite(config *SiteConfig, store storage.Store, bandwidth *BandwidthCounter, l *log.Logger) (*Site, error) {
+	if err := resolveAssets(config, l); err != nil {
+		return nil, fmt.Errorf("error resolving the integrity of the external assets: %w", err)
+	}
+	renderLog := getComponentLogger(l, logComponentRender)
+	renderLog.Println("🚀 Caching templates...")
+	templates, err := getTemplateEngine(config).Parse(config, renderLog)
+	if err != nil {
+		return nil, fmt.Errorf("error caching templates: %w", err)
+	}
+	mail, err := newSiteMailer(config)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	if config.Favicon != "" {
+		icons, err := generateFavicons(config)
+		if err != nil {
+			return nil, fmt.Errorf("error generating favicons: %w", err)
+		}
+		for path, file := range icons {
+			mux.Handle("GET "+path, getGeneratedFileHandler(path, file))
+		}
+		l.Printf("✅ Favicons and web manifest generated from %s", config.Favicon)
+		if isPWAEnabled(config) {
+			sw, err := generateServiceWorker(config, time.Now())
+			if err != nil {
+				return nil, fmt.Errorf("error generating service worker: %w", err)
+			}
+			mux.Handle("GET "+serviceWorkerPath, getServiceWorkerHandler(sw))
+			l.Printf("✅ PWA mode: service worker precaching %d urls", len(getPrecacheURLs(config)))
+		}
+	} else if _, found := config.WellKnown["/favicon.ico"]; !found {
+		mux.HandleFunc("GET /favicon.ico", func(w http.ResponseWriter, r *http.Request) {
+			http.ServeFile(w, r, "./favicon.ico")
+		})
+	}
+	wellKnown, err := getWellKnownFiles(config)
+	if err != nil {
+		return nil, err
+	}
+	for path, file := range wellKnown {
+		mux.Handle("GET "+path, getGeneratedFileHandler(path, file))
+	}
+	if len(wellKnown) > 0 {
+		l.Printf("✅ %d wellKnown files served: %s", len(wellKnown), strings.Join(getWellKnownPaths(config), ", "))
+	}
+	// a wellKnown file replaces the webfinger of the mastodon account
+	if _, replaced := config.WellKnown[webFingerPath]; !replaced {
+		if account, found := getFediverseAccount(config); found {
+			mux.Handle("GET "+webFingerPath, getWebFingerHandler(config, account))
+			l.Printf("✅ webfinger served for the mastodon account @%s@%s", account.User, account.Host)
+		}
+	}
+	if len(config.Events) > 0 {
+		mux.Handle("GET "+eventsICSPath, getGeneratedFileHandler(eventsICSPath, generatedFile{
+			ContentType: "text/calendar; charset=utf-8",
+			Data:        generateICS(config, time.Now()),
+		}))
+		l.Printf("✅ %d events exported in %s", len(config.Events), eventsICSPath)
+	}
+	if info, err := os.Stat(config.getStaticDir()); err == nil && info.IsDir() {
+		mux.Handle("GET "+staticURLPrefix, getStaticHandler(config, l))
+	}
+
+	auth, err := getAuthenticatorFromEnv(config, l)
+	if err != nil {
+		return nil, err
+	}
+	registerAuthHandlers(mux, auth)
+	if hasNewsletter(config) {
+		mux.HandleFunc("GET "+newsletterConfirmPath, getNewsletterConfirmHandler(config, store, l))
+	}
+	now := time.Now()
+	cacheStore := newOutputCacheStore(config, store, now)
+	for i := range config.Pages {
+		page := &config.Pages[i]
+		if page.CreateHandler && isPublished(page, now) {
+			var handler http.Handler = getHandler(page, config, cacheStore, l)
+			if isProtectedPage(page) {
+				handler = requireRole(handler, page, config, auth, l)
+			}
+			if isDevMode() {
+				handler = withDevChecks(handler, l)
+			}
+			mux.Handle(page.Route, handler)
+			if route := strings.Fields(page.Route); route[0] == http.MethodGet {
+				if pdfPath := getPDFPath(route[1]); pdfPath != "" {
+					mux.Handle("GET "+pdfPath, getPDFHandler(route[1], handler))
+				}
+			}
+			if page.Form != nil {
+				var formHandler http.Handler = getFormHandler(page, config, store, mail, l)
+				if isProtectedPage(page) {
+					formHandler = requireRole(formHandler, page, config, auth, l)
+				}
+				mux.Handle(fmt.Sprintf("%s %s", http.MethodPost, splitRoutePath(page.Route)), formHandler)
+			}
+		}
+	}
+	config.CORS = getCORSFromEnvOrPanic(config)
+	if isCORSEnabled(config) {
+		l.Printf("INFO: cross origin requests allowed from %s", strings.Join(config.CORS.AllowedOrigins, ", "))
+	}
+	for path, methods := range getAllowedMethods(config) {
+		mux.Handle(fmt.Sprintf("%s %s", http.MethodOptions, path), getOptionsHandler(path, methods, config, l))
+	}
+	mux.HandleFunc("GET /set-theme", getSetThemeHandler(config))
+	mux.HandleFunc("POST "+themeAPIPath, getThemeAPIHandler(config))
+	// catch-all so that paths without any matching page still get the themed 404 page
+	mux.Handle("/", getNotFoundHandler(config, l))
+
+	return &Site{
+		Config:    config,
+		Auth:      auth,
+		Handler:   withCanonicalRedirect(withCORS(withBandwidthAccounting(withServerErrors(withErrorReporting(mux, config, l), l), bandwidth), config), config, l),
+		Templates: templates,
+		IPAccess:  getIPAccessRules(config),
+		Mail:      mail,
+	}, nil
+}
+
+// serveLiveSite sends the requests to the handler of the site currently served.
+func serveLiveSite(w http.ResponseWriter, r *http.Request) {
+	getLiveSite().Handler.ServeHTTP(w, r)
+}
+
+// withLiveAuth is withAuth using the authenticator of the site currently served.
+func withLiveAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		withAuth(next, getLiveSite().Auth).ServeHTTP(w, r)
+	})
+}
+
+// siteLoader builds the sites of the config file, at startup and when it is loaded again.
+type siteLoader struct {
+	configURL string // inside the git checkout when the content is in git
+	schemaURL string
+	store     storage.Store
+	bandwidth *BandwidthCounter
+	git       *GitContent   // nil when the content is not in git
+	previews  *previewSites // nil without previews
+	mu        sync.Mutex    // one config loaded at a time
+	tasks     *scheduler    // woken up each time a site is applied, the publishing job follows its pages
+	l         *log.Logger
+}
+
+// build creates the site of config, with the env overrides applied.
+func (sl *siteLoader) build(config *SiteConfig) (*Site, error) {
+	applyEnvOverrides(config)
+	return buildSite(config, sl.store, sl.bandwidth, sl.l)
+}
+
+// apply serves site and purges the cdn and the output cache of the store, whose pages may come from the previous
+// config. it follows a reload of the config, a rollback and a publishing, whatever cdn.purgeOnStart.
+func (sl *siteLoader) apply(site *Site) {
+	applySite(site)
+	if sl.tasks != nil {
+		sl.tasks.wakeUp()
+	}
+	go purgeOutputCache(sl.store, sl.l)
+	if site.Config.CDN != nil {
+		if err := purgeCDN(site.Config.CDN, getAllSurrogateKeys(site.Config), sl.l); err != nil {
+			sl.l.Printf("💥 warning: could not purge cdn cache: %v", err)
+		}
+	}
+}
+
+// reload loads the config file again, after pulling the git checkout when pull is true, and serves it when it is valid.
+// the new config is saved in the history.
+func (sl *siteLoader) reload(ctx context.Context, pull bool) (site *Site, err error) {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	defer func() {
+		if err != nil {
+			notify(eventConfigReloadFailed, fmt.Sprintf("the config %s could not be loaded again: %v", sl.configURL, err), map[string]interface{}{"error": err.Error()}, sl.l)
+			return
+		}
+		notify(eventConfigReloaded, fmt.Sprintf("the config %s is loaded again with %d pages", sl.configURL, len(site.Config.Pages)), map[string]interface{}{"version": site.Version}, sl.l)
+	}()
+	if pull && sl.git != nil {
+		if _, err := sl.git.Sync(ctx); err != nil {
+			return nil, err
+		}
+	}
+	// the previews follow the branches pulled, even when the config served is invalid
+	sl.previews.load(ctx)
+	config, err := LoadConfig(sl.configURL, sl.schemaURL, sl.l)
+	if err != nil {
+		return nil, err
+	}
+	site, err = sl.build(config)
+	if err != nil {
+		return nil, err
+	}
+	if site.Version, err = saveConfigVersion(sl.store, config.raw, time.Now()); err != nil {
+		sl.l.Printf("💥 warning: could not save the config version in the history: %v", err)
+	}
+	sl.apply(site)
+	sl.l.Printf("✅ Config %s loaded again with %d pages", sl.configURL, len(config.Pages))
+	return site, nil
+}
+
+// republish builds site again when it is still served, with the pages published now.
+func (sl *siteLoader) republish(site *Site) error {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	if getLiveSite() != site {
+		return nil
+	}
+	next, err := buildSite(site.Config, sl.store, sl.bandwidth, sl.l)
+	if err != nil {
+		return err
+	}
+	next.Version = site.Version
+	sl.apply(next)
+	sl.l.Printf("✅ Site built again with the pages published at %s", time.Now().Format(time.RFC3339))
+	return nil
+}
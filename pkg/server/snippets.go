@@ -0,0 +1,112 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// getSnippetNames returns the names of the snippets sorted, so that the problems keep their order.
+func getSnippetNames(config *SiteConfig) []string {
+	names := make([]string, 0, len(config.Snippets))
+	for name := range config.Snippets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateSnippets checks the blocks referencing a snippet name an existing one, have no type of their own, and
+// that no snippet includes itself through its references.
+func validateSnippets(config *SiteConfig) []ConfigError {
+	var problems []ConfigError
+	checkRefs := func(pointer string, blocks []ContentBlock) {
+		for i, block := range blocks {
+			if block.Snippet == "" {
+				continue
+			}
+			blockPointer := fmt.Sprintf("%s/%d", pointer, i)
+			if _, found := config.Snippets[block.Snippet]; !found {
+				problems = append(problems, ConfigError{Pointer: blockPointer + "/snippet", Value: block.Snippet, Message: fmt.Sprintf("unknown snippet, the snippets are %s", strings.Join(getSnippetNames(config), ", "))})
+			}
+			if block.Type != "" || block.KeyValues != nil {
+				problems = append(problems, ConfigError{Pointer: blockPointer, Value: block.Snippet, Message: "a block referencing a snippet cannot have a type or keyValues"})
+			}
+		}
+	}
+	for i, page := range config.Pages {
+		checkRefs(fmt.Sprintf("/pages/%d/custom_content", i), page.CustomContent)
+		for _, variant := range getVariantBlocks(&page, i) {
+			checkRefs(variant.Pointer, variant.Blocks)
+		}
+	}
+	for _, name := range getSnippetNames(config) {
+		pointer := "/snippets/" + strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+		checkRefs(pointer, config.Snippets[name])
+		if path := getSnippetCycle(config, name, nil); path != nil {
+			problems = append(problems, ConfigError{Pointer: pointer, Value: name, Message: fmt.Sprintf("the snippet includes itself through %s", strings.Join(path, " -> "))})
+		}
+	}
+	return problems
+}
+
+// getSnippetCycle returns the chain of references leading from name back to a snippet already in seen, or nil.
+func getSnippetCycle(config *SiteConfig, name string, seen []string) []string {
+	if slices.Contains(seen, name) {
+		return append(seen, name)
+	}
+	seen = append(seen, name)
+	for _, block := range config.Snippets[name] {
+		if block.Snippet == "" {
+			continue
+		}
+		if path := getSnippetCycle(config, block.Snippet, slices.Clone(seen)); path != nil && path[0] == path[len(path)-1] {
+			return path
+		}
+	}
+	return nil
+}
+
+// expandSnippetBlocks returns blocks with each reference replaced by the blocks of its snippet, already checked by
+// validateSnippets. the when and visibleTo of a reference apply to the blocks of the snippet: both when
+// expressions must be true, and the blocks without their own visibleTo get the one of the reference.
+func expandSnippetBlocks(config *SiteConfig, blocks []ContentBlock) []ContentBlock {
+	if !slices.ContainsFunc(blocks, func(b ContentBlock) bool { return b.Snippet != "" }) {
+		return blocks
+	}
+	expanded := make([]ContentBlock, 0, len(blocks))
+	for _, block := range blocks {
+		if block.Snippet == "" {
+			expanded = append(expanded, block)
+			continue
+		}
+		for _, included := range expandSnippetBlocks(config, config.Snippets[block.Snippet]) {
+			switch {
+			case block.When != "" && included.When != "":
+				included.When = fmt.Sprintf("(%s) && (%s)", block.When, included.When)
+			case block.When != "":
+				included.When = block.When
+			}
+			if len(included.VisibleTo) == 0 {
+				included.VisibleTo = block.VisibleTo
+			}
+			expanded = append(expanded, included)
+		}
+	}
+	return expanded
+}
+
+// expandSnippets replaces the snippet references of the custom_content of the pages, once the config is valid.
+func expandSnippets(config *SiteConfig) {
+	for i := range config.Pages {
+		config.Pages[i].CustomContent = expandSnippetBlocks(config, config.Pages[i].CustomContent)
+		if experiment := config.Pages[i].Experiment; experiment != nil {
+			for j := range experiment.Variants {
+				if experiment.Variants[j].CustomContent != nil {
+					experiment.Variants[j].CustomContent = expandSnippetBlocks(config, experiment.Variants[j].CustomContent)
+				}
+			}
+		}
+	}
+}
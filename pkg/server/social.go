@@ -0,0 +1,84 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"slices"
+	"strings"
+)
+
+// SocialLink is one entry of SiteConfig.Social ready to be rendered by the SocialLinks component.
+type SocialLink struct {
+	Platform string        // the key in the config, like github
+	Name     string        // the display name of the platform, like GitHub
+	URL      string        // the profile url, e-mail addresses get a mailto: scheme
+	Icon     template.HTML // an inline svg using currentColor, so it follows the theme
+}
+
+// socialPlatforms gives the display name and the svg content of the bundled icons (24x24 stroke icons in the
+// style of Feather icons, MIT license), the platforms without an icon use the globe one.
+var socialPlatforms = map[string]struct {
+	Name string
+	SVG  string
+}{
+	"github":    {"GitHub", `<path d="M9 19c-5 1.5-5-2.5-7-3m14 6v-3.87a3.37 3.37 0 0 0-.94-2.61c3.14-.35 6.44-1.54 6.44-7A5.44 5.44 0 0 0 20 4.77 5.07 5.07 0 0 0 19.91 1S18.73.65 16 2.48a13.38 13.38 0 0 0-7 0C6.27.65 5.09 1 5.09 1A5.07 5.07 0 0 0 5 4.77a5.44 5.44 0 0 0-1.5 3.78c0 5.42 3.3 6.61 6.44 7A3.37 3.37 0 0 0 9 18.13V22"/>`},
+	"gitlab":    {"GitLab", `<path d="M22.65 14.39L12 22.13 1.35 14.39a.84.84 0 0 1-.3-.94l1.22-3.78 2.44-7.51A.42.42 0 0 1 4.82 2a.43.43 0 0 1 .58 0 .42.42 0 0 1 .11.18l2.44 7.49h8.1l2.44-7.51A.42.42 0 0 1 18.6 2a.43.43 0 0 1 .58 0 .42.42 0 0 1 .11.18l2.44 7.51L23 13.45a.84.84 0 0 1-.35.94z"/>`},
+	"linkedin":  {"LinkedIn", `<path d="M16 8a6 6 0 0 1 6 6v7h-4v-7a2 2 0 0 0-2-2 2 2 0 0 0-2 2v7h-4v-7a6 6 0 0 1 6-6z"/><rect x="2" y="9" width="4" height="12"/><circle cx="4" cy="4" r="2"/>`},
+	"twitter":   {"Twitter", `<path d="M23 3a10.9 10.9 0 0 1-3.14 1.53 4.48 4.48 0 0 0-7.86 3v1A10.66 10.66 0 0 1 3 4s-4 9 5 13a11.64 11.64 0 0 1-7 2c9 5 20 0 20-11.5a4.5 4.5 0 0 0-.08-.83A7.72 7.72 0 0 0 23 3z"/>`},
+	"x":         {"X", `<path d="M4 4l16 16M20 4L4 20"/>`},
+	"mastodon":  {"Mastodon", `<path d="M21 11.5a8.38 8.38 0 0 1-.9 3.8 8.5 8.5 0 0 1-7.6 4.7 8.38 8.38 0 0 1-3.8-.9L3 21l1.9-5.7a8.38 8.38 0 0 1-.9-3.8 8.5 8.5 0 0 1 4.7-7.6 8.38 8.38 0 0 1 3.8-.9h.5a8.48 8.48 0 0 1 8 8v.5z"/>`},
+	"bluesky":   {"Bluesky", `<path d="M18 10h-1.26A8 8 0 1 0 9 20h9a5 5 0 0 0 0-10z"/>`},
+	"youtube":   {"YouTube", `<path d="M22.54 6.42a2.78 2.78 0 0 0-1.94-2C18.88 4 12 4 12 4s-6.88 0-8.6.46a2.78 2.78 0 0 0-1.94 2A29 29 0 0 0 1 11.75a29 29 0 0 0 .46 5.33A2.78 2.78 0 0 0 3.4 19c1.72.46 8.6.46 8.6.46s6.88 0 8.6-.46a2.78 2.78 0 0 0 1.94-2 29 29 0 0 0 .46-5.25 29 29 0 0 0-.46-5.33z"/><polygon points="9.75 15.02 15.5 11.75 9.75 8.48 9.75 15.02"/>`},
+	"instagram": {"Instagram", `<rect x="2" y="2" width="20" height="20" rx="5" ry="5"/><path d="M16 11.37A4 4 0 1 1 12.63 8 4 4 0 0 1 16 11.37z"/><line x1="17.5" y1="6.5" x2="17.51" y2="6.5"/>`},
+	"facebook":  {"Facebook", `<path d="M18 2h-3a5 5 0 0 0-5 5v3H7v4h3v8h4v-8h3l1-4h-4V7a1 1 0 0 1 1-1h3z"/>`},
+	"email":     {"E-mail", `<path d="M4 4h16c1.1 0 2 .9 2 2v12c0 1.1-.9 2-2 2H4c-1.1 0-2-.9-2-2V6c0-1.1.9-2 2-2z"/><polyline points="22,6 12,13 2,6"/>`},
+	"rss":       {"RSS", `<path d="M4 11a9 9 0 0 1 9 9"/><path d="M4 4a16 16 0 0 1 16 16"/><circle cx="5" cy="19" r="1"/>`},
+	"website":   {"Website", `<circle cx="12" cy="12" r="10"/><line x1="2" y1="12" x2="22" y2="12"/><path d="M12 2a15.3 15.3 0 0 1 4 10 15.3 15.3 0 0 1-4 10 15.3 15.3 0 0 1-4-10 15.3 15.3 0 0 1 4-10z"/>`},
+}
+
+const socialIconFormat = `<svg xmlns="http://www.w3.org/2000/svg" width="24" height="24" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2" stroke-linecap="round" stroke-linejoin="round" aria-hidden="true">%s</svg>`
+
+// getSocialLinks returns the social links of the site, first the ones listed in socialOrder, then the others by name.
+func getSocialLinks(site *SiteConfig) []SocialLink {
+	platforms := make([]string, 0, len(site.Social))
+	for platform, url := range site.Social {
+		if strings.TrimSpace(url) != "" {
+			platforms = append(platforms, platform)
+		}
+	}
+	rank := func(platform string) int {
+		if i := slices.Index(site.SocialOrder, platform); i >= 0 {
+			return i
+		}
+		return len(site.SocialOrder)
+	}
+	slices.SortFunc(platforms, func(a, b string) int {
+		if ra, rb := rank(a), rank(b); ra != rb {
+			return ra - rb
+		}
+		return strings.Compare(a, b)
+	})
+	links := make([]SocialLink, 0, len(platforms))
+	for _, platform := range platforms {
+		url := strings.TrimSpace(site.Social[platform])
+		key := strings.ToLower(platform)
+		if key == "mail" || key == "e-mail" {
+			key = "email"
+		}
+		if key == "email" && !strings.HasPrefix(url, "mailto:") {
+			url = "mailto:" + url
+		}
+		info, ok := socialPlatforms[key]
+		if !ok {
+			info = socialPlatforms["website"]
+			info.Name = platform
+		}
+		links = append(links, SocialLink{
+			Platform: platform,
+			Name:     info.Name,
+			URL:      url,
+			Icon:     template.HTML(fmt.Sprintf(socialIconFormat, info.SVG)),
+		})
+	}
+	return links
+}
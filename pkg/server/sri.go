@@ -0,0 +1,297 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sriFetchTimeout = 10 * time.Second
+	maxSRIAssetSize = 10 << 20 // the assets larger than 10 MiB are not hashed
+)
+
+// defaultStyles are the stylesheets of the default templates, used when the config lists none.
+var defaultStyles = []ExternalAsset{
+	{URL: "https://cdn.jsdelivr.net/npm/@picocss/pico@2/css/pico.min.css"},
+	{URL: "https://cdn.jsdelivr.net/npm/@picocss/pico@2/css/pico.colors.min.css"},
+}
+
+// mapAssets are loaded by the Map component, with the integrity published by Leaflet, so that a changed file on the
+// CDN is refused by the browsers even when it cannot be checked at start. they are checked only when a page has a Map block.
+var mapAssets = []ExternalAsset{
+	{URL: "https://unpkg.com/leaflet@1.9.4/dist/leaflet.css", Integrity: "sha256-p4NxAoJBhIIN+hmNHrzRCf9tD/miZyoHS5obTRR9BMY="},
+	{URL: "https://unpkg.com/leaflet@1.9.4/dist/leaflet.js", Integrity: "sha256-20nQCchB9co0qIjJZRGuk2/Z9VM+kNiyxNV1lvTlZBo="},
+}
+
+// leafletVendorDir is the directory of the static files where `make vendor-leaflet` puts the Leaflet files, the Map
+// component serves them from the site instead of the CDN when they are there.
+const leafletVendorDir = "vendor/leaflet"
+
+// integrityRegex matches one hash of an integrity attribute, like sha384-oqVuAfXRKap7fdgcCY5uykM6+R9GqQ8K/uxy9rx7HNQlGYl1kPzQho1wx4JwY8wC
+var integrityRegex = regexp.MustCompile(`^(sha256|sha384|sha512)-[A-Za-z0-9+/]+={0,2}$`)
+
+// sriDigests keeps the hashes of the assets by url for the life of the process, so that the reloads do not fetch them again.
+var sriDigests sync.Map
+
+// AssetsConfig lists the external stylesheets and scripts of the pages, sent with their Subresource Integrity hash.
+type AssetsConfig struct {
+	Styles           []ExternalAsset `json:"styles,omitempty"`           // stylesheets of the pages, they replace the default Pico CSS ones
+	Scripts          []ExternalAsset `json:"scripts,omitempty"`          // scripts loaded with defer by all the pages
+	RequireIntegrity bool            `json:"requireIntegrity,omitempty"` // the site is not built when the hash of an external asset cannot be computed
+
+	styles, scripts []ExternalAsset   // the assets with their resolved integrity, set by resolveAssets
+	integrity       map[string]string // resolved integrity by url, including the assets of the components
+}
+
+// ExternalAsset is a stylesheet or script, its integrity is computed at start when it is not pinned in the config.
+type ExternalAsset struct {
+	URL       string `json:"url"`
+	Integrity string `json:"integrity,omitempty"` // pinned hashes like sha384-..., the site is not built when the asset does not match them
+}
+
+// getStyles returns the stylesheets of the pages with their integrity once resolved.
+func (a *AssetsConfig) getStyles() []ExternalAsset {
+	switch {
+	case a == nil:
+		return defaultStyles
+	case a.styles != nil:
+		return a.styles
+	case len(a.Styles) > 0:
+		return a.Styles
+	}
+	return defaultStyles
+}
+
+// getScripts returns the scripts of the pages with their integrity once resolved.
+func (a *AssetsConfig) getScripts() []ExternalAsset {
+	if a == nil {
+		return nil
+	}
+	if a.scripts != nil {
+		return a.scripts
+	}
+	return a.Scripts
+}
+
+// getIntegrity returns the resolved integrity of url, or an empty string when it is unknown, for the components
+// adding their own assets like {{with integrity "https://unpkg.com/leaflet@1.9.4/dist/leaflet.js"}}.
+func (a *AssetsConfig) getIntegrity(url string) string {
+	if a != nil {
+		if integrity, ok := a.integrity[url]; ok {
+			return integrity
+		}
+	}
+	if at := slices.IndexFunc(mapAssets, func(asset ExternalAsset) bool { return asset.URL == url }); at >= 0 {
+		return mapAssets[at].Integrity
+	}
+	return getComputedIntegrity(url)
+}
+
+// validateAssets checks the urls of the assets and the format of their pinned integrity.
+func validateAssets(config *SiteConfig) []ConfigError {
+	if config.Assets == nil {
+		return nil
+	}
+	var problems []ConfigError
+	check := func(kind string, assets []ExternalAsset) {
+		for i, asset := range assets {
+			pointer := fmt.Sprintf("/assets/%s/%d", kind, i)
+			if !isExternalAsset(asset.URL) && !strings.HasPrefix(asset.URL, "/") {
+				problems = append(problems, ConfigError{Pointer: pointer + "/url", Value: asset.URL, Message: "must be an http(s) url or a path of the site"})
+			}
+			for _, hash := range strings.Fields(asset.Integrity) {
+				if !integrityRegex.MatchString(hash) {
+					problems = append(problems, ConfigError{Pointer: pointer + "/integrity", Value: hash, Message: "must be a base64 sha256, sha384 or sha512 hash like sha384-..."})
+				}
+			}
+		}
+	}
+	check("styles", config.Assets.Styles)
+	check("scripts", config.Assets.Scripts)
+	return problems
+}
+
+// isExternalAsset reports whether url is served by another origin, such assets need an integrity hash.
+func isExternalAsset(url string) bool {
+	return strings.HasPrefix(url, "https://") || strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "//")
+}
+
+// hasMapBlock reports whether a page of site has a Map component.
+func hasMapBlock(site *SiteConfig) bool {
+	for _, page := range site.Pages {
+		if slices.ContainsFunc(page.CustomContent, func(b ContentBlock) bool { return b.Type == "Map" }) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveAssets computes the integrity of the external assets not pinned in the config and checks the pinned ones,
+// an asset that cannot be fetched is sent without integrity unless assets.requireIntegrity is true.
+func resolveAssets(config *SiteConfig, l *log.Logger) error {
+	if config.Assets == nil {
+		config.Assets = &AssetsConfig{}
+	}
+	assets := config.Assets
+	assets.integrity = make(map[string]string)
+	resolve := func(list []ExternalAsset) ([]ExternalAsset, error) {
+		resolved := make([]ExternalAsset, 0, len(list))
+		for _, asset := range list {
+			integrity, err := resolveIntegrity(asset, assets.RequireIntegrity, l)
+			if err != nil {
+				return nil, err
+			}
+			asset.Integrity = integrity
+			assets.integrity[asset.URL] = integrity
+			resolved = append(resolved, asset)
+		}
+		return resolved, nil
+	}
+	styles := assets.Styles
+	if len(styles) == 0 {
+		styles = defaultStyles
+	}
+	var err error
+	if assets.styles, err = resolve(styles); err != nil {
+		return err
+	}
+	if assets.scripts, err = resolve(assets.Scripts); err != nil {
+		return err
+	}
+	if hasMapBlock(config) {
+		for _, asset := range mapAssets {
+			vendored, err := checkVendoredAsset(config, asset)
+			if err != nil {
+				return err
+			}
+			if vendored {
+				continue
+			}
+			if _, err := resolve([]ExternalAsset{asset}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// getVendoredPath returns the path in the static files of config of the vendored copy of the map asset.
+func getVendoredPath(config *SiteConfig, asset ExternalAsset) string {
+	return filepath.Join(config.getStaticDir(), filepath.FromSlash(leafletVendorDir), path.Base(asset.URL))
+}
+
+// checkVendoredAsset reports whether the static files of config have a copy of the map asset, and checks that it
+// matches the hash published by Leaflet.
+func checkVendoredAsset(config *SiteConfig, asset ExternalAsset) (bool, error) {
+	content, err := os.ReadFile(getVendoredPath(config, asset))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error reading the vendored copy of %s: %w", asset.URL, err)
+	}
+	sum := sha256.Sum256(content)
+	if digest := "sha256-" + base64.StdEncoding.EncodeToString(sum[:]); digest != asset.Integrity {
+		return false, fmt.Errorf("the vendored copy of %s does not match its pinned integrity %s, it is %s", asset.URL, asset.Integrity, digest)
+	}
+	return true, nil
+}
+
+// getMapAsset returns the url and integrity of the Leaflet file name, like leaflet.js, for the Map component: the
+// copy in the static files when it was vendored, else the one of the CDN.
+func getMapAsset(config *SiteConfig, name string) (ExternalAsset, error) {
+	at := slices.IndexFunc(mapAssets, func(asset ExternalAsset) bool { return path.Base(asset.URL) == name })
+	if at < 0 {
+		return ExternalAsset{}, fmt.Errorf("unknown map asset %q", name)
+	}
+	asset := mapAssets[at]
+	if info, err := os.Stat(getVendoredPath(config, asset)); err == nil && !info.IsDir() {
+		return ExternalAsset{URL: staticURLPrefix + leafletVendorDir + "/" + name, Integrity: asset.Integrity}, nil
+	}
+	asset.Integrity = config.Assets.getIntegrity(asset.URL)
+	return asset, nil
+}
+
+// resolveIntegrity returns the pinned integrity of asset once verified, else the sha384 hash of its content.
+func resolveIntegrity(asset ExternalAsset, required bool, l *log.Logger) (string, error) {
+	if !isExternalAsset(asset.URL) {
+		return asset.Integrity, nil
+	}
+	digests, err := getAssetDigests(asset.URL)
+	if asset.Integrity != "" {
+		if err != nil {
+			l.Printf("⚠️ WARNING: the pinned integrity of %s cannot be verified: %v", asset.URL, err)
+			return asset.Integrity, nil
+		}
+		for _, hash := range strings.Fields(asset.Integrity) {
+			if slices.Contains(digests, hash) {
+				return asset.Integrity, nil
+			}
+		}
+		return "", fmt.Errorf("the content of %s does not match its pinned integrity %s, it is now %s", asset.URL, asset.Integrity, digests[1])
+	}
+	if err != nil {
+		if required {
+			return "", fmt.Errorf("error computing the integrity of %s: %w", asset.URL, err)
+		}
+		l.Printf("⚠️ WARNING: %s is sent without integrity: %v", asset.URL, err)
+		return "", nil
+	}
+	return digests[1], nil
+}
+
+// getComputedIntegrity returns the sha384 integrity of url when it was already fetched.
+func getComputedIntegrity(url string) string {
+	if digests, ok := sriDigests.Load(url); ok {
+		return digests.([]string)[1]
+	}
+	return ""
+}
+
+// getAssetDigests fetches url once and returns its sha256, sha384 and sha512 integrity values, in this order.
+func getAssetDigests(url string) ([]string, error) {
+	if digests, ok := sriDigests.Load(url); ok {
+		return digests.([]string), nil
+	}
+	fetchURL := url
+	if strings.HasPrefix(fetchURL, "//") {
+		fetchURL = "https:" + fetchURL
+	}
+	client := http.Client{Timeout: sriFetchTimeout}
+	resp, err := client.Get(fetchURL)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching %s: status %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSRIAssetSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", url, err)
+	}
+	if len(body) > maxSRIAssetSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", url, maxSRIAssetSize)
+	}
+	sum256, sum384, sum512 := sha256.Sum256(body), sha512.Sum384(body), sha512.Sum512(body)
+	digests := []string{
+		"sha256-" + base64.StdEncoding.EncodeToString(sum256[:]),
+		"sha384-" + base64.StdEncoding.EncodeToString(sum384[:]),
+		"sha512-" + base64.StdEncoding.EncodeToString(sum512[:]),
+	}
+	sriDigests.Store(url, digests)
+	return digests, nil
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGetMapAssetVendored(t *testing.T) {
+	config := &SiteConfig{staticDir: t.TempDir()}
+	asset, err := getMapAsset(config, "leaflet.js")
+	if err != nil {
+		t.Fatalf("getMapAsset() error = %v", err)
+	}
+	if asset.URL != mapAssets[1].URL || asset.Integrity != mapAssets[1].Integrity {
+		t.Errorf("getMapAsset() without vendored copy = %+v, want %+v", asset, mapAssets[1])
+	}
+	if _, err := getMapAsset(config, "leaflet-src.js"); err == nil {
+		t.Errorf("getMapAsset() of an unknown asset should fail")
+	}
+
+	dir := filepath.Join(config.staticDir, filepath.FromSlash(leafletVendorDir))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "leaflet.js"), []byte("alert(1)"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	asset, err = getMapAsset(config, "leaflet.js")
+	if err != nil {
+		t.Fatalf("getMapAsset() error = %v", err)
+	}
+	if asset.URL != "/static/vendor/leaflet/leaflet.js" || asset.Integrity != mapAssets[1].Integrity {
+		t.Errorf("getMapAsset() with vendored copy = %+v", asset)
+	}
+	// the copy does not match the hash published by Leaflet, so the site is not built
+	if _, err := checkVendoredAsset(config, mapAssets[1]); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("checkVendoredAsset() error = %v, want a mismatch", err)
+	}
+	if vendored, err := checkVendoredAsset(config, mapAssets[0]); vendored || err != nil {
+		t.Errorf("checkVendoredAsset() of a missing copy = %v, %v", vendored, err)
+	}
+}
@@ -0,0 +1,275 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	taskActionRefreshDataSources = "refreshDataSources"
+	taskActionWebhook            = "webhook"
+	taskActionRotateLogs         = "rotateLogs"
+	taskWebhookTimeout           = 10 * time.Second
+	defaultRotatedLogsKept       = 7
+	rotatedLogTimeFormat         = "20060102-150405"
+)
+
+// taskActions are the actions of the tasks of the config.
+var taskActions = []string{taskActionRefreshDataSources, taskActionWebhook, taskActionRotateLogs}
+
+// ScheduledTask is a job of the config run periodically by the scheduler, every interval or at the times of a
+// cron expression.
+type ScheduledTask struct {
+	Name   string `json:"name"`            // unique, in the log and the admin endpoint
+	Every  string `json:"every,omitempty"` // interval like 15m, the first run is one interval after the start
+	Cron   string `json:"cron,omitempty"`  // minute hour day month weekday, in the local time, like "30 3 * * 1-5"
+	Action string `json:"action"`          // refreshDataSources, webhook or rotateLogs
+	URL    string `json:"url,omitempty"`   // of the webhook, receiving the name of the task and the time as json
+	Keep   *int   `json:"keep,omitempty"`  // rotated log files kept, 7 by default
+}
+
+// getSchedule returns the schedule of the task.
+func (t *ScheduledTask) getSchedule() (schedule, error) {
+	if t.Cron != "" {
+		return parseCron(t.Cron)
+	}
+	d, err := parseServerDuration(t.Every)
+	if err != nil {
+		return nil, err
+	}
+	return intervalSchedule(d), nil
+}
+
+// validateTasks checks the names of the tasks are unique, that each one has one valid schedule and a known action
+// with its settings.
+func validateTasks(config *SiteConfig) []ConfigError {
+	var problems []ConfigError
+	var names []string
+	for i, task := range config.Tasks {
+		pointer := fmt.Sprintf("/tasks/%d", i)
+		if !experimentNameRegex.MatchString(task.Name) {
+			problems = append(problems, ConfigError{Pointer: pointer + "/name", Value: task.Name, Message: "the name of a task must be lowercase letters, digits, _ and -"})
+		} else if slices.Contains(names, task.Name) {
+			problems = append(problems, ConfigError{Pointer: pointer + "/name", Value: task.Name, Message: "another task has this name"})
+		} else if slices.Contains(serverJobNames, task.Name) {
+			problems = append(problems, ConfigError{Pointer: pointer + "/name", Value: task.Name, Message: "this name is reserved for a job of the server: " + strings.Join(serverJobNames, ", ")})
+		}
+		names = append(names, task.Name)
+		switch {
+		case (task.Every == "") == (task.Cron == ""):
+			problems = append(problems, ConfigError{Pointer: pointer, Message: "a task needs either every or cron"})
+		case task.Cron != "":
+			if _, err := task.getSchedule(); err != nil {
+				problems = append(problems, ConfigError{Pointer: pointer + "/cron", Value: task.Cron, Message: err.Error()})
+			}
+		default:
+			if _, err := task.getSchedule(); err != nil {
+				problems = append(problems, ConfigError{Pointer: pointer + "/every", Value: task.Every, Message: fmt.Sprintf("invalid duration: %v", err)})
+			}
+		}
+		switch task.Action {
+		case taskActionWebhook:
+			if !strings.HasPrefix(task.URL, "http://") && !strings.HasPrefix(task.URL, "https://") {
+				problems = append(problems, ConfigError{Pointer: pointer + "/url", Value: task.URL, Message: "a webhook task needs an http(s) url"})
+			}
+		case taskActionRotateLogs:
+			if task.Keep != nil && *task.Keep < 0 {
+				problems = append(problems, ConfigError{Pointer: pointer + "/keep", Value: *task.Keep, Message: "keep cannot be negative"})
+			}
+		case taskActionRefreshDataSources:
+		default:
+			problems = append(problems, ConfigError{Pointer: pointer + "/action", Value: task.Action, Message: "unknown action, expected one of " + strings.Join(taskActions, ", ")})
+		}
+	}
+	return problems
+}
+
+// serverJobNames are the names of the jobs the server runs with the tasks of the config.
+var serverJobNames = []string{publishingJobName, updateCheckJobName}
+
+// getScheduledJobs returns the jobs of the scheduler for config, the tasks of the config.
+func getScheduledJobs(config *SiteConfig, l *log.Logger) []scheduledJob {
+	jobs := make([]scheduledJob, 0, len(config.Tasks))
+	for _, task := range config.Tasks {
+		s, err := task.getSchedule()
+		if err != nil {
+			// already reported when the config was loaded
+			continue
+		}
+		jobs = append(jobs, scheduledJob{name: task.Name, schedule: s, run: func(ctx context.Context) error {
+			return runTaskAction(ctx, task, config, l)
+		}})
+	}
+	return jobs
+}
+
+// runTaskAction runs the action of task.
+func runTaskAction(ctx context.Context, task ScheduledTask, config *SiteConfig, l *log.Logger) error {
+	switch task.Action {
+	case taskActionRefreshDataSources:
+		return refreshDataSources(ctx, config, l)
+	case taskActionWebhook:
+		body, err := json.Marshal(map[string]interface{}{
+			"task": task.Name,
+			"time": time.Now().UTC().Format(time.RFC3339),
+		})
+		if err != nil {
+			return fmt.Errorf("error encoding webhook body: %w", err)
+		}
+		ctx, cancel := context.WithTimeout(ctx, taskWebhookTimeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, task.URL, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("error creating the request of webhook %s: %w", task.URL, err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("error calling webhook %s: %w", task.URL, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("webhook %s returned status %s", task.URL, resp.Status)
+		}
+		return nil
+	case taskActionRotateLogs:
+		keep := defaultRotatedLogsKept
+		if task.Keep != nil {
+			keep = *task.Keep
+		}
+		if len(serverLogFiles) == 0 {
+			return fmt.Errorf("the log is not written in a file, set env LOG_FILE")
+		}
+		var errs []error
+		for _, f := range serverLogFiles {
+			if err := f.rotate(keep); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+	return fmt.Errorf("unknown action %s", task.Action)
+}
+
+// dataSourceCache keeps the remote data sources fetched by the refreshDataSources tasks, the pages read them from
+// memory instead of fetching them at each request.
+var dataSourceCache = struct {
+	mu      sync.RWMutex
+	entries map[string][]byte
+}{entries: make(map[string][]byte)}
+
+// getCachedDataSource returns the json of the data source at url fetched by the last refresh.
+func getCachedDataSource(url string) ([]byte, bool) {
+	dataSourceCache.mu.RLock()
+	defer dataSourceCache.mu.RUnlock()
+	raw, found := dataSourceCache.entries[url]
+	return raw, found
+}
+
+// refreshDataSources fetches the remote data sources of the pages of config, a data source that cannot be
+// fetched keeps its previous copy. the pages of the data sources changed are purged from the cdn.
+func refreshDataSources(ctx context.Context, config *SiteConfig, l *log.Logger) error {
+	var urls []string
+	for _, page := range config.Pages {
+		if ds := page.DataSource; ds != nil && isRemoteDataSource(ds.URL) && !slices.Contains(urls, ds.URL) {
+			urls = append(urls, ds.URL)
+		}
+	}
+	entries := make(map[string][]byte, len(urls))
+	var failed, changed []string
+	for _, url := range urls {
+		raw, err := fetchDataSource(ctx, url)
+		if err == nil && !json.Valid(raw) {
+			err = fmt.Errorf("data source %s is not valid json", url)
+		}
+		recordDataSourceFetch(url, raw, err)
+		previous, found := getCachedDataSource(url)
+		if err != nil {
+			l.Printf("💥 error refreshing data source: %v", err)
+			failed = append(failed, url)
+			raw = previous
+		} else if !found || !bytes.Equal(raw, previous) {
+			changed = append(changed, getDataSourceKey(url))
+		}
+		if raw != nil {
+			entries[url] = raw
+		}
+	}
+	dataSourceCache.mu.Lock()
+	dataSourceCache.entries = entries
+	dataSourceCache.mu.Unlock()
+	if config.CDN != nil && len(changed) > 0 {
+		if err := purgeCDN(config.CDN, changed, l); err != nil {
+			l.Printf("💥 warning: could not purge the pages of the data sources refreshed from the cdn: %v", err)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d data sources could not be refreshed: %s", len(failed), len(urls), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// logFile is the file of env LOG_FILE, opened again when it is rotated.
+type logFile struct {
+	mu   sync.Mutex
+	name string
+	file *os.File
+}
+
+// serverLogFiles are the log files of env LOG_FILE.
+var serverLogFiles []*logFile
+
+func (f *logFile) Write(b []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Write(b)
+}
+
+// rotate renames the log file with the current time as suffix, opens a new one and removes the oldest rotated
+// files beyond keep.
+func (f *logFile) rotate(keep int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	rotated := f.name + "." + time.Now().Format(rotatedLogTimeFormat)
+	if err := os.Rename(f.name, rotated); err != nil {
+		return fmt.Errorf("error renaming the log file %s: %w", f.name, err)
+	}
+	file, err := os.OpenFile(f.name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		// the log keeps going to the renamed file
+		return fmt.Errorf("error opening the log file %s: %w", f.name, err)
+	}
+	f.file.Close()
+	f.file = file
+	files, err := filepath.Glob(f.name + ".*")
+	if err != nil {
+		return err
+	}
+	var old []string
+	for _, file := range files {
+		if _, err := time.Parse(rotatedLogTimeFormat, strings.TrimPrefix(file, f.name+".")); err == nil {
+			old = append(old, file)
+		}
+	}
+	// the suffixes sort by time
+	slices.Sort(old)
+	var errs []error
+	for len(old) > keep {
+		if err := os.Remove(old[0]); err != nil {
+			errs = append(errs, fmt.Errorf("error removing the rotated log: %w", err))
+		}
+		old = old[1:]
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,410 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/render"
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/version"
+)
+
+// debugTemplatesParam is the query parameter showing the templates of a page in dev mode.
+const debugTemplatesParam = "debugTemplates"
+
+// templateWorkers is the number of templates parsed at once by Parse.
+var templateWorkers = runtime.GOMAXPROCS(0)
+
+// errorTemplates are the error pages in templates/errors, rendered with the default layout
+var errorTemplates = []string{"error_404", "error_500", "error_403", "error_503"}
+
+// optionalErrorTemplates are cached when templates/errors has them, their statuses use error_500 otherwise
+var optionalErrorTemplates = []string{"error_400"}
+
+// TemplateRenderer renders one assembled page, *html/template.Template and *text/template.Template implement it.
+type TemplateRenderer = render.Renderer
+
+// TemplateEngine builds, at startup, the renderers of all the pages keyed by route, plus the errorTemplates.
+// every renderer must define a "page_layout" template, it receives a PageData.
+// the renderers of the pages may also define a "print_layout" template used by ?format=print and ?format=pdf
+type TemplateEngine interface {
+	Parse(config *SiteConfig, l *log.Logger) (map[string]TemplateRenderer, error)
+}
+
+// TemplatesConfig holds the optional settings of the template engine.
+type TemplatesConfig struct {
+	LeftDelim      string   `json:"leftDelim,omitempty"`      // delimiters of the page template files, default is {{
+	RightDelim     string   `json:"rightDelim,omitempty"`     // the layouts and components always use {{ and }}
+	RequestHeaders []string `json:"requestHeaders,omitempty"` // request headers exposed in .Request.Headers, like Accept-Language
+	Lazy           bool     `json:"lazy,omitempty"`           // compile the page templates at their first request instead of at startup
+	Strict         bool     `json:"strict,omitempty"`         // fail on a missing key, like a typo in the keyValues, an undefined template or component
+}
+
+var (
+	// templateEngine is the engine used by buildSite, replace it with SetTemplateEngine.
+	templateEngine TemplateEngine = &HTMLTemplateEngine{}
+	// extraTemplateFuncs are added to the functions available in the templates by RegisterTemplateFunc.
+	extraTemplateFuncs = template.FuncMap{}
+)
+
+// SetTemplateEngine replaces the default html/template engine, it must be called before the templates are parsed.
+func SetTemplateEngine(engine TemplateEngine) {
+	templateEngine = engine
+}
+
+// RegisterTemplateFunc makes fn available as name in all templates, it must be called before the templates are parsed.
+// a function registered with the name of a builtin one replaces it.
+func RegisterTemplateFunc(name string, fn any) {
+	extraTemplateFuncs[name] = fn
+}
+
+// HTMLTemplateEngine is the default engine, based on html/template with contextual auto-escaping.
+// it keeps the templates of the previous build, so that a reload only parses the pages whose files changed.
+type HTMLTemplateEngine struct {
+	mu     sync.Mutex    // one Parse at a time
+	base   render.Parsed // the base and component templates
+	parsed *render.Cache // of the previous build
+}
+
+// getFuncMap returns the functions available in all templates for the site.
+func (e *HTMLTemplateEngine) getFuncMap(config *SiteConfig) template.FuncMap {
+	socialLinks := getSocialLinks(config)
+	staticDir := config.getStaticDir()
+	funcMap := template.FuncMap{
+		"replace": strings.ReplaceAll,
+		"splitFirst": func(s string) string {
+			parts := strings.Split(strings.TrimSpace(s), " ")
+			if len(parts) > 1 {
+				return parts[1]
+			}
+			return ""
+		},
+		"default": func(fallback, value string) string {
+			if value == "" {
+				return fallback
+			}
+			return value
+		},
+		"isActive":      isActive,
+		"tableData":     func(kv map[string]interface{}) (*TableData, error) { return getTableData(kv, config) },
+		"galleryData":   func(kv map[string]interface{}) (*GalleryData, error) { return getGalleryData(kv, staticDir) },
+		"mapData":       func(kv map[string]interface{}) (*MapData, error) { return getMapData(kv, config) },
+		"downloadsData": func(kv map[string]interface{}) (*DownloadsData, error) { return getDownloadsData(kv, staticDir) },
+		"tabsData": func(kv map[string]interface{}) (*ContainerData, error) {
+			return getContainerData(kv, containerKeys["Tabs"])
+		},
+		"stepsData": func(kv map[string]interface{}) (*ContainerData, error) {
+			return getContainerData(kv, containerKeys["Steps"])
+		},
+		"eventsData": func(kv map[string]interface{}) (*EventsData, error) {
+			return getEventsData(kv, config.Events, time.Now())
+		},
+		"embedData": func(kv map[string]interface{}) (*EmbedData, error) {
+			return getEmbedData(kv, config.EmbedPrivacy)
+		},
+		"socialLinks": func() []SocialLink {
+			return socialLinks
+		},
+		"externalStyles": func() []ExternalAsset {
+			return config.Assets.getStyles()
+		},
+		"externalScripts": func() []ExternalAsset {
+			return config.Assets.getScripts()
+		},
+		"integrity": func(url string) string {
+			return config.Assets.getIntegrity(url)
+		},
+		// like {{ with mapAsset "leaflet.js" }}{{ .URL }}{{ end }}, the vendored Leaflet file when there is one
+		"mapAsset": func(name string) (ExternalAsset, error) {
+			return getMapAsset(config, name)
+		},
+		// like {{ with buildInfo }}{{ .Version }} ({{ .Revision }}){{ end }} in a footer
+		"buildInfo": version.Get,
+		// like {{ sanitize "ugc" .Data.comment }} to render the html of a field, keeping what the policy allows
+		"sanitize": func(policy string, value interface{}) (template.HTML, error) {
+			return sanitizeHTML(config, policy, value)
+		},
+		// renderContent and renderBlock are bound to the template of each page in Parse, so that they use its components
+		"renderContent": func(content string) (template.HTML, error) {
+			return "", fmt.Errorf("renderContent is not available in this template")
+		},
+		"renderBlock": func(block ContentBlock) (template.HTML, error) {
+			return "", fmt.Errorf("renderBlock is not available in this template")
+		},
+	}
+	for name, fn := range getI18nFuncMap(config.Language) {
+		funcMap[name] = fn
+	}
+	for name, fn := range extraTemplateFuncs {
+		funcMap[name] = fn
+	}
+	return funcMap
+}
+
+func (e *HTMLTemplateEngine) Parse(config *SiteConfig, l *log.Logger) (map[string]TemplateRenderer, error) {
+	start := time.Now()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	renderers := make(map[string]TemplateRenderer)
+	templatesDir := config.getTemplatesDir()
+	leftDelim, rightDelim := "", ""
+	if config.Templates != nil {
+		leftDelim, rightDelim = config.Templates.LeftDelim, config.Templates.RightDelim
+	}
+
+	// 1. Parse all base and component files into a master template set, the layouts are parsed for each page.
+	// the set of the previous build is kept while none of its files changed, a change invalidates all the pages.
+	baseFiles := []string{
+		filepath.Join(templatesDir, "header.gohtml"),
+		filepath.Join(templatesDir, "footer.gohtml"),
+		filepath.Join(templatesDir, "menu.gohtml"),
+		filepath.Join(templatesDir, "errors", "error_500.gohtml"),
+		filepath.Join(templatesDir, "errors", "error_404.gohtml"),
+	}
+	components, err := filepath.Glob(filepath.Join(templatesDir, "components", "*.gohtml"))
+	if err != nil {
+		return nil, fmt.Errorf("error listing component templates: %w", err)
+	}
+	baseFingerprint := render.FilesFingerprint(append(baseFiles, components...))
+	baseTemplate := e.base.Tmpl
+	if baseTemplate == nil || e.base.Fingerprint != baseFingerprint {
+		baseTemplate, err = template.New("base").Funcs(e.getFuncMap(config)).ParseFiles(baseFiles...)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing base templates: %w", err)
+		}
+		_, err = baseTemplate.ParseGlob(filepath.Join(templatesDir, "components", "*.gohtml"))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing component templates: %w", err)
+		}
+		l.Printf("✅ Base and component templates parsed in %v", time.Since(start).Round(time.Microsecond))
+	}
+	funcMap := e.getFuncMap(config)
+	strict := isStrictTemplates(config)
+	previous, parsed := e.parsed, render.NewCache()
+	var reused atomic.Int64
+	// getRenderer returns a clone of the never executed template of key, parsing it with parse when its fingerprint
+	// changed, bound to the functions of config and of language. it is called by concurrent workers, and by the
+	// requests after Parse in lazy mode.
+	getRenderer := func(key, fingerprint, language string, parse func(tmpl *template.Template) error) (*template.Template, error) {
+		fingerprint = baseFingerprint + "\n" + fingerprint
+		cached, found := previous.Get(key)
+		if found && cached.Fingerprint == fingerprint {
+			reused.Add(1)
+		} else {
+			tmpl, err := baseTemplate.Clone()
+			if err != nil {
+				return nil, err
+			}
+			if err := parse(tmpl); err != nil {
+				return nil, err
+			}
+			cached = render.Parsed{Fingerprint: fingerprint, Tmpl: tmpl}
+			l.Printf("✅ Template cached for: %s", key)
+		}
+		parsed.Set(key, cached)
+		tmpl, err := cached.Tmpl.Clone()
+		if err != nil {
+			return nil, err
+		}
+		if isDevMode() {
+			if err := render.InstrumentTemplates(tmpl); err != nil {
+				return nil, fmt.Errorf("error marking the templates of %s: %w", key, err)
+			}
+		}
+		tmpl.Funcs(funcMap)
+		if language != "" {
+			tmpl.Funcs(getI18nFuncMap(language))
+		}
+		tmpl.Funcs(template.FuncMap{"renderContent": getRenderContentFunc(tmpl), "renderBlock": getRenderBlockFunc(tmpl, strict)})
+		if strict {
+			if err := render.CheckTemplateCalls(tmpl); err != nil {
+				return nil, fmt.Errorf("error in the templates of %s: %w", key, err)
+			}
+			tmpl.Option("missingkey=error")
+		}
+		return tmpl, nil
+	}
+
+	// 2. Build a specific template for each route and each error page, the jobs are independent so that they run
+	// on templateWorkers goroutines.
+	type templateJob struct {
+		key    string
+		render func() (*template.Template, error)
+		lazy   bool // compiled at the first request of the page in lazy mode
+	}
+	lazy := config.Templates != nil && config.Templates.Lazy
+	var jobs []templateJob
+	printLayoutPath := filepath.Join(templatesDir, render.LayoutsDir, render.PrintEntryTemplate+".gohtml")
+	// getPageJob returns the job of the template of page under key, the key of a variant of an experiment differs
+	// from the route of its page
+	getPageJob := func(key string, page Page) templateJob {
+		return templateJob{key: key, render: func() (*template.Template, error) {
+			chain, _, err := render.LayoutChain(templatesDir, render.LayoutName(page.Layout))
+			if err != nil {
+				return nil, fmt.Errorf("error parsing layout for route %s: %w", key, err)
+			}
+			files := append(chain, printLayoutPath)
+			source := "custom_content"
+			if page.CustomContent == nil && strings.TrimSpace(page.Template) != "" {
+				source = filepath.Join(templatesDir, page.Template)
+				files = append(files, source)
+			}
+			fingerprint := fmt.Sprintf("%s\n%s%s\n%s", source, leftDelim, rightDelim, render.FilesFingerprint(files))
+			return getRenderer(key, fingerprint, page.Language, func(tmpl *template.Template) error {
+				if err := render.ParseLayout(tmpl, templatesDir, page.Layout); err != nil {
+					return fmt.Errorf("error parsing layout for route %s: %w", key, err)
+				}
+				// the print layout only renders the main block, it is parsed before the page so that it does not override it
+				if _, err := tmpl.ParseFiles(printLayoutPath); err != nil {
+					return fmt.Errorf("error parsing print layout for route %s: %w", key, err)
+				}
+				if page.CustomContent != nil {
+					if _, err := tmpl.Parse(customContentTemplate); err != nil {
+						return fmt.Errorf("error parsing custom content template for route %s: %w", key, err)
+					}
+				} else if strings.TrimSpace(page.Template) != "" {
+					// the delimiters only apply to the parsing of the page file, the layouts are already parsed
+					if _, err := tmpl.Delims(leftDelim, rightDelim).ParseFiles(source); err != nil {
+						return fmt.Errorf("error parsing page template %s for route %s: %w", source, key, err)
+					}
+				}
+				return nil
+			})
+		}, lazy: lazy}
+	}
+	for _, page := range config.Pages {
+		if !page.CreateHandler || page.Draft {
+			continue
+		}
+		jobs = append(jobs, getPageJob(page.Route, page))
+		if page.Experiment != nil {
+			for i := range page.Experiment.Variants {
+				variant := &page.Experiment.Variants[i]
+				jobs = append(jobs, getPageJob(getVariantTemplateKey(&page, variant), getVariantPage(&page, variant)))
+			}
+		}
+	}
+	// Cache the error pages.
+	chain, _, err := render.LayoutChain(templatesDir, render.DefaultLayout)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing layout for the error pages: %w", err)
+	}
+	for _, name := range append(errorTemplates, optionalErrorTemplates...) {
+		path := filepath.Join(templatesDir, "errors", name+".gohtml")
+		if _, err := os.Stat(path); err != nil && slices.Contains(optionalErrorTemplates, name) {
+			continue
+		}
+		jobs = append(jobs, templateJob{key: name, render: func() (*template.Template, error) {
+			return getRenderer(name, render.FilesFingerprint(append(slices.Clone(chain), path)), "", func(tmpl *template.Template) error {
+				if err := render.ParseLayout(tmpl, templatesDir, render.DefaultLayout); err != nil {
+					return fmt.Errorf("error parsing layout for %s page: %w", name, err)
+				}
+				if _, err := tmpl.ParseFiles(path); err != nil {
+					return fmt.Errorf("error parsing %s template: %w", name, err)
+				}
+				return nil
+			})
+		}})
+	}
+	workers := min(templateWorkers, max(len(jobs), 1))
+	results := make([]*template.Template, len(jobs))
+	errs := make([]error, len(jobs))
+	slots := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	deferred := 0
+	for i, job := range jobs {
+		if job.lazy {
+			renderers[job.key] = render.NewLazy(func() (*template.Template, error) {
+				started := time.Now()
+				tmpl, err := job.render()
+				if err != nil {
+					l.Printf("💥 error compiling the template of %s at its first request: %v", job.key, err)
+					return nil, err
+				}
+				l.Printf("✅ Template of %s compiled at its first request in %v", job.key, time.Since(started).Round(time.Microsecond))
+				return tmpl, nil
+			})
+			deferred++
+			continue
+		}
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-slots; wg.Done() }()
+			results[i], errs[i] = job.render()
+		}()
+	}
+	wg.Wait()
+	// the error of the first job in the order of the config, like when the templates were parsed one after the other
+	for i, job := range jobs {
+		if job.lazy {
+			continue
+		}
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		renderers[job.key] = results[i]
+	}
+
+	e.base = render.Parsed{Fingerprint: baseFingerprint, Tmpl: baseTemplate}
+	e.parsed = parsed
+	compiled := len(renderers) - deferred
+	l.Printf("✅ %d templates ready in %v with %d workers, %d parsed and %d unchanged since the previous build",
+		compiled, time.Since(start).Round(time.Microsecond), workers, compiled-int(reused.Load()), reused.Load())
+	if deferred > 0 {
+		l.Printf("INFO: lazy templates, %d pages are compiled at their first request", deferred)
+	}
+	return renderers, nil
+}
+
+// validatePageTemplates checks the template file and the layout chain of each page with a handler, and the template
+// file of the variants of its experiment, so that a missing file fails the load instead of the page at its request.
+func validatePageTemplates(config *SiteConfig) []ConfigError {
+	var problems []ConfigError
+	dir := config.getTemplatesDir()
+	checkTemplate := func(pointer, route, name string) {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			problems = append(problems, ConfigError{Pointer: pointer, Value: name, Message: fmt.Sprintf("template file of page '%s' not found in %s", route, dir)})
+		}
+	}
+	for i, page := range config.Pages {
+		if !page.CreateHandler || page.Draft {
+			continue
+		}
+		pointer := fmt.Sprintf("/pages/%d", i)
+		if page.CustomContent == nil && strings.TrimSpace(page.Template) != "" {
+			checkTemplate(pointer+"/template", page.Route, page.Template)
+		}
+		if _, _, err := render.LayoutChain(dir, render.LayoutName(page.Layout)); err != nil {
+			problems = append(problems, ConfigError{Pointer: pointer + "/layout", Value: page.Layout, Message: fmt.Sprintf("layout of page '%s': %v", page.Route, err)})
+		}
+		if page.Experiment == nil {
+			continue
+		}
+		for j, variant := range page.Experiment.Variants {
+			if strings.TrimSpace(variant.Template) != "" {
+				checkTemplate(fmt.Sprintf("%s/experiment/variants/%d/template", pointer, j), page.Route, variant.Template)
+			}
+		}
+	}
+	return problems
+}
+
+// isStrictTemplates reports whether the templates of config fail on a missing key and an undefined template.
+func isStrictTemplates(config *SiteConfig) bool {
+	return config.Templates != nil && config.Templates.Strict
+}
+
+// isDebugTemplatesRequest reports whether r asks, in dev mode, to show the templates of the page with ?debugTemplates.
+func isDebugTemplatesRequest(r *http.Request) bool {
+	return isDevMode() && r.URL.Query().Has(debugTemplatesParam)
+}
@@ -0,0 +1,443 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	siteconfig "github.com/lao-tseu-is-alive/JsonSiteGo/pkg/config"
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/storage"
+)
+
+const (
+	tenantsPathPrefix  = "/tenants/"                  // the tenants are also served under /tenants/{name}/
+	tenantsPath        = adminPathPrefix + "/tenants" // lists the tenants, and reloads them
+	tenantConfigFile   = "config.json"
+	tenantTemplatesDir = "templates"
+	tenantStaticDir    = "static"
+	tenantKeyPrefix    = "tenants/" // the keys of a tenant in the store are below tenants/<name>/
+)
+
+var (
+	// tenantEngines are the template engines of the tenants by name, so that each one keeps its own cache.
+	tenantEngines   = make(map[string]*HTMLTemplateEngine)
+	tenantEnginesMu sync.Mutex
+)
+
+// getTemplatesDir returns the directory of the templates of config, the one of its tenant or pathToTemplates.
+func (c *SiteConfig) getTemplatesDir() string {
+	if c.templatesDir != "" {
+		return c.templatesDir
+	}
+	return pathToTemplates
+}
+
+// getStaticDir returns the directory of the static files of config, the one of its tenant or pathToStatic.
+func (c *SiteConfig) getStaticDir() string {
+	if c.staticDir != "" {
+		return c.staticDir
+	}
+	return pathToStatic
+}
+
+// getTemplateEngine returns the engine parsing the templates of config: templateEngine for the site of the config
+// file, and an engine of its own for each tenant unless templateEngine was replaced by SetTemplateEngine.
+func getTemplateEngine(config *SiteConfig) TemplateEngine {
+	if _, isDefault := templateEngine.(*HTMLTemplateEngine); config.tenant == "" || !isDefault {
+		return templateEngine
+	}
+	tenantEnginesMu.Lock()
+	defer tenantEnginesMu.Unlock()
+	engine, found := tenantEngines[config.tenant]
+	if !found {
+		engine = &HTMLTemplateEngine{}
+		tenantEngines[config.tenant] = engine
+	}
+	return engine
+}
+
+// tenantPathMessage is the problem of a path of a tenant config leaving its directory.
+const tenantPathMessage = "the paths of a tenant must be relative to its directory, without .."
+
+// openFile opens the file name of the config: relative to the working directory of the process for the config of
+// the server, and inside the directory of its tenant otherwise, where no path nor symbolic link can leave it.
+func (c *SiteConfig) openFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	if c.rootDir == "" {
+		return os.OpenFile(name, flag, perm)
+	}
+	root, err := os.OpenRoot(c.rootDir)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	return root.OpenFile(name, flag, perm)
+}
+
+// readFile returns the content of the file name of the config, resolved like openFile.
+func (c *SiteConfig) readFile(name string) ([]byte, error) {
+	f, err := c.openFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// openDir opens the directory name of the config as a root, resolved like openFile, whose files cannot leave it.
+func (c *SiteConfig) openDir(name string) (*os.Root, error) {
+	if c.rootDir == "" {
+		return os.OpenRoot(name)
+	}
+	root, err := os.OpenRoot(c.rootDir)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	return root.OpenRoot(name)
+}
+
+// isDir reports whether name is a directory of the config, resolved like openFile.
+func (c *SiteConfig) isDir(name string) bool {
+	root, err := c.openDir(name)
+	if err != nil {
+		return false
+	}
+	root.Close()
+	return true
+}
+
+// validateTenantPaths checks the paths of the config of a tenant are relative to its directory, and its templates
+// relative to its templates directory, so that a tenant cannot read nor write the files of the server or of the
+// other tenants. its mail transport can only be smtp, the sendmail and file ones use the paths of the server.
+func validateTenantPaths(config *SiteConfig) []ConfigError {
+	if config.rootDir == "" {
+		return nil
+	}
+	var problems []ConfigError
+	check := func(pointer, p string) {
+		if p != "" && !filepath.IsLocal(p) {
+			problems = append(problems, ConfigError{Pointer: pointer, Value: p, Message: tenantPathMessage})
+		}
+	}
+	if config.Content != nil {
+		check("/content/dir", config.Content.Dir)
+	}
+	check("/favicon", config.Favicon)
+	for _, p := range getWellKnownPaths(config) {
+		check("/wellKnown/"+strings.ReplaceAll(strings.ReplaceAll(p, "~", "~0"), "/", "~1")+"/file", config.WellKnown[p].File)
+	}
+	for i, page := range config.Pages {
+		pointer := fmt.Sprintf("/pages/%d", i)
+		check(pointer+"/template", page.Template)
+		check(pointer+"/layout", page.Layout)
+		if page.Autoindex != nil {
+			check(pointer+"/autoindex/dir", page.Autoindex.Dir)
+		}
+		if page.DataSource != nil && !isRemoteDataSource(page.DataSource.URL) {
+			check(pointer+"/dataSource/url", page.DataSource.URL)
+		}
+		if page.Form != nil {
+			for j, action := range page.Form.Actions {
+				check(fmt.Sprintf("%s/form/actions/%d/path", pointer, j), action.Path)
+				check(fmt.Sprintf("%s/form/actions/%d/template", pointer, j), action.Template)
+			}
+		}
+		if page.Experiment != nil {
+			for j, variant := range page.Experiment.Variants {
+				check(fmt.Sprintf("%s/experiment/variants/%d/template", pointer, j), variant.Template)
+			}
+		}
+	}
+	if config.Notifications != nil {
+		for i, email := range config.Notifications.Emails {
+			check(fmt.Sprintf("/notifications/emails/%d/template", i), email.Template)
+		}
+	}
+	if config.Mail != nil {
+		if u, err := url.Parse(config.Mail.Transport); err == nil && u.Scheme != "smtp" && u.Scheme != "smtps" {
+			problems = append(problems, ConfigError{Pointer: "/mail/transport", Value: config.Mail.Transport, Message: "the mail transport of a tenant must be smtp or smtps"})
+		}
+	}
+	return problems
+}
+
+// TenantInfo describes a tenant in the list of the tenants.
+type TenantInfo struct {
+	Name  string   `json:"name"`
+	Hosts []string `json:"hosts"`           // the name of its directory and the host of its baseURL
+	Pages int      `json:"pages"`           // pages of the site served
+	Error string   `json:"error,omitempty"` // of its last load, the previous site is still served
+}
+
+// tenant is a site of its own directory of TENANTS_DIR, with its config, templates and static files.
+type tenant struct {
+	name  string
+	dir   string
+	store storage.Store
+	site  atomic.Pointer[Site]
+	hosts atomic.Pointer[[]string]
+	err   atomic.Pointer[string] // of the last load, nil when it succeeded
+	mu    sync.Mutex             // one load at a time
+}
+
+// getInfo describes t.
+func (t *tenant) getInfo() TenantInfo {
+	info := TenantInfo{Name: t.name}
+	if hosts := t.hosts.Load(); hosts != nil {
+		info.Hosts = *hosts
+	}
+	if site := t.site.Load(); site != nil {
+		info.Pages = len(site.Config.Pages)
+	}
+	if err := t.err.Load(); err != nil {
+		info.Error = *err
+	}
+	return info
+}
+
+// tenantSites are the sites of the sub-directories of env TENANTS_DIR, each one with a config.json and optional
+// templates and static directories, the ones of TEMPLATES_DIR and STATIC_DIR being used without them. a tenant is
+// served for the host named like its directory or the one of its baseURL, and under /tenants/{name}/. its data is
+// kept in the store below tenants/<name>/ and the paths of its config are resolved inside its directory, the
+// listeners, limits, ip access rules, maintenance and admin endpoints are the ones of the process.
+type tenantSites struct {
+	dir       string
+	schemaURL string
+	store     storage.Store
+	bandwidth *BandwidthCounter
+	tenants   atomic.Pointer[map[string]*tenant] // by name
+	mu        sync.Mutex                         // one scan of the directory at a time
+	l         *log.Logger
+}
+
+// getTenantSitesFromEnv returns the tenants of env TENANTS_DIR, nil when it is unset.
+func getTenantSitesFromEnv(schemaURL string, store storage.Store, bandwidth *BandwidthCounter, l *log.Logger) (*tenantSites, error) {
+	dir := strings.TrimSpace(os.Getenv("TENANTS_DIR"))
+	if dir == "" {
+		return nil, nil
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("env TENANTS_DIR %q is not a directory", dir)
+	}
+	if siteconfig.IsFromStdin() {
+		return nil, fmt.Errorf("the tenants cannot be served with the config read from stdin")
+	}
+	return &tenantSites{dir: dir, schemaURL: schemaURL, store: store, bandwidth: bandwidth, l: l}, nil
+}
+
+// load scans the directory of the tenants, loads the new ones and the ones already served again, and stops serving
+// the ones whose directory was removed. a tenant whose config is invalid is not served until it is fixed.
+func (ts *tenantSites) load() error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	entries, err := os.ReadDir(ts.dir)
+	if err != nil {
+		return fmt.Errorf("error listing the tenants of %s: %w", ts.dir, err)
+	}
+	previous := ts.getTenants()
+	tenants := make(map[string]*tenant)
+	for _, entry := range entries {
+		dir := filepath.Join(ts.dir, entry.Name())
+		if _, err := os.Stat(filepath.Join(dir, tenantConfigFile)); !entry.IsDir() || err != nil {
+			continue
+		}
+		name := strings.ToLower(entry.Name())
+		t, found := previous[name]
+		if !found {
+			t = &tenant{name: name, dir: dir, store: storage.NewPrefixStore(ts.store, tenantKeyPrefix+name)}
+		}
+		if err := ts.reload(t); err != nil {
+			ts.l.Printf("💥 error loading the tenant %s: %v", name, err)
+		}
+		tenants[name] = t
+	}
+	ts.tenants.Store(&tenants)
+	tenantEnginesMu.Lock()
+	for name := range tenantEngines {
+		if _, found := tenants[name]; !found {
+			delete(tenantEngines, name)
+		}
+	}
+	tenantEnginesMu.Unlock()
+	served := make([]string, 0, len(tenants))
+	for name, t := range tenants {
+		if t.site.Load() != nil {
+			served = append(served, name)
+		}
+	}
+	slices.Sort(served)
+	ts.l.Printf("✅ %d tenants served: %s", len(served), strings.Join(served, ", "))
+	return nil
+}
+
+// reload loads the config of t again and serves its site when it is valid, its templates are parsed by its own
+// engine so that the other sites are not affected.
+func (ts *tenantSites) reload(t *tenant) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	err := func() error {
+		templatesDir, staticDir := filepath.Join(t.dir, tenantTemplatesDir), filepath.Join(t.dir, tenantStaticDir)
+		if info, err := os.Stat(templatesDir); err != nil || !info.IsDir() {
+			templatesDir = pathToTemplates
+		}
+		if info, err := os.Stat(staticDir); err != nil || !info.IsDir() {
+			staticDir = pathToStatic
+		}
+		configPath := filepath.Join(t.dir, tenantConfigFile)
+		sources, data, err := siteconfig.LoadSources(configPath, ts.l)
+		if err != nil {
+			return err
+		}
+		config, err := parseConfigIn(sources, data, ts.schemaURL, configOptions{templatesDir: templatesDir, staticDir: staticDir, rootDir: t.dir, untrusted: true}, ts.l)
+		if err != nil {
+			return err
+		}
+		config.tenant = t.name
+		site, err := buildSite(config, t.store, ts.bandwidth, ts.l)
+		if err != nil {
+			return err
+		}
+		if site.Version, err = saveConfigVersion(t.store, config.raw, time.Now()); err != nil {
+			ts.l.Printf("💥 warning: could not save the config version of the tenant %s in the history: %v", t.name, err)
+		}
+		t.site.Store(site)
+		ts.l.Printf("✅ Tenant %s loaded with %d pages from %s", t.name, len(config.Pages), configPath)
+		return nil
+	}()
+	if err != nil {
+		message := getConfigErrorMessage(err)
+		t.err.Store(&message)
+	} else {
+		t.err.Store(nil)
+	}
+	hosts := []string{t.name}
+	if site := t.site.Load(); site != nil {
+		if u, err := url.Parse(site.Config.BaseURL); err == nil && u.Hostname() != "" && !slices.Contains(hosts, strings.ToLower(u.Hostname())) {
+			hosts = append(hosts, strings.ToLower(u.Hostname()))
+		}
+	}
+	t.hosts.Store(&hosts)
+	return err
+}
+
+// getTenants returns the tenants by name.
+func (ts *tenantSites) getTenants() map[string]*tenant {
+	if tenants := ts.tenants.Load(); tenants != nil {
+		return *tenants
+	}
+	return nil
+}
+
+// getTenantOfHost returns the tenant served for the host of a request, nil when it is not the one of a tenant.
+func (ts *tenantSites) getTenantOfHost(host string) *tenant {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, t := range ts.getTenants() {
+		if hosts := t.hosts.Load(); hosts != nil && slices.Contains(*hosts, host) {
+			return t
+		}
+	}
+	return nil
+}
+
+// serve serves r with the site of t, its templates and its authentication.
+func (t *tenant) serve(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	site := t.site.Load()
+	if site == nil {
+		next.ServeHTTP(w, r)
+		return
+	}
+	r = r.WithContext(context.WithValue(r.Context(), siteTemplatesKey{}, site.Templates))
+	withAuth(site.Handler, site.Auth).ServeHTTP(w, r)
+}
+
+// ServeHTTP serves the request with the site of the tenant of its path, the root relative urls of its pages
+// prefixed with the path of the tenant like for a preview.
+func (ts *tenantSites) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t := ts.getTenants()[r.PathValue("name")]
+	if t == nil || t.site.Load() == nil {
+		serveLiveSite(w, r)
+		return
+	}
+	prefix := tenantsPathPrefix + t.name
+	rec := &previewRecorder{ResponseWriter: w, prefix: prefix, head: r.Method == http.MethodHead}
+	http.StripPrefix(prefix, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.serve(w, r, http.HandlerFunc(serveLiveSite))
+	})).ServeHTTP(rec, r)
+	rec.flush()
+}
+
+// withTenantHosts serves the requests for the host of a tenant with its site, and the others with next.
+func withTenantHosts(next http.Handler, ts *tenantSites) http.Handler {
+	if ts == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if t := ts.getTenantOfHost(r.Host); t != nil {
+			t.serve(w, r, next)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// getTenantsHandler lists the tenants with their hosts and the error of their last load.
+func getTenantsHandler(ts *tenantSites) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenants := ts.getTenants()
+		list := make([]TenantInfo, 0, len(tenants))
+		for _, t := range tenants {
+			list = append(list, t.getInfo())
+		}
+		slices.SortFunc(list, func(a, b TenantInfo) int { return strings.Compare(a.Name, b.Name) })
+		writeJSON(w, r, http.StatusOK, list)
+	}
+}
+
+// getTenantsReloadHandler scans the directory of the tenants again, adding the new ones and loading all of them again.
+func getTenantsReloadHandler(ts *tenantSites) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := ts.load(); err != nil {
+			ts.l.Printf("💥 error reloading the tenants: %v", err)
+			auditLog.RecordRequest(r, "tenants.reload", auditFailure, "admin", err.Error())
+			writeJSONError(w, r, http.StatusInternalServerError, "the tenants cannot be reloaded")
+			return
+		}
+		auditLog.RecordRequest(r, "tenants.reload", auditSuccess, "admin", fmt.Sprintf("%d tenants", len(ts.getTenants())))
+		getTenantsHandler(ts)(w, r)
+	}
+}
+
+// getTenantReloadHandler loads the config of one tenant again, the other sites are not affected.
+func getTenantReloadHandler(ts *tenantSites) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		t := ts.getTenants()[name]
+		if t == nil {
+			writeJSONError(w, r, http.StatusNotFound, fmt.Sprintf("unknown tenant '%s'", name))
+			return
+		}
+		if err := ts.reload(t); err != nil {
+			ts.l.Printf("💥 error reloading the tenant %s: %v", name, err)
+			auditLog.RecordRequest(r, "t.reload", auditFailure, "admin", name+": "+err.Error())
+			writeJSONError(w, r, http.StatusUnprocessableEntity, fmt.Sprintf("the tenant '%s' cannot be reloaded: %s", name, getConfigErrorMessage(err)))
+			return
+		}
+		info := t.getInfo()
+		auditLog.RecordRequest(r, "t.reload", auditSuccess, "admin", fmt.Sprintf("%s with %d pages", name, info.Pages))
+		writeJSON(w, r, http.StatusOK, info)
+	}
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateTenantPaths(t *testing.T) {
+	config := &SiteConfig{
+		rootDir: t.TempDir(),
+		Favicon: "static/icon.png",
+		Content: &ContentConfig{Dir: "/etc"},
+		Pages: []Page{
+			{Route: "GET /", Template: "../../other/main", DataSource: &DataSource{URL: "data/items.json"}},
+			{Route: "POST /contact", Form: &Form{Actions: []FormAction{{Type: formActionFile, Path: "../submissions.jsonl"}}}},
+		},
+		Mail: &MailConfig{Transport: "sendmail:///usr/sbin/sendmail"},
+	}
+	got := map[string]bool{}
+	for _, ce := range validateTenantPaths(config) {
+		got[ce.Pointer] = true
+	}
+	want := []string{"/content/dir", "/pages/0/template", "/pages/1/form/actions/0/path", "/mail/transport"}
+	for _, pointer := range want {
+		if !got[pointer] {
+			t.Errorf("validateTenantPaths did not report %s, got %v", pointer, got)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("validateTenantPaths reported %d problems, want %d: %v", len(got), len(want), got)
+	}
+	if problems := validateTenantPaths(&SiteConfig{Favicon: "/srv/icon.png"}); len(problems) > 0 {
+		t.Errorf("the paths of the config of the server should not be checked, got %v", problems)
+	}
+}
+
+func TestTenantFilesStayInsideTheDirectory(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "data.json"), []byte(`{}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/etc", filepath.Join(dir, "etc")); err != nil {
+		t.Fatal(err)
+	}
+	config := &SiteConfig{rootDir: dir}
+	if _, err := config.readFile("data.json"); err != nil {
+		t.Errorf("readFile of a file of the tenant failed: %v", err)
+	}
+	for _, name := range []string{"../../etc/passwd", "/etc/passwd", "etc/passwd"} {
+		if _, err := config.readFile(name); err == nil {
+			t.Errorf("readFile(%q) should not leave the directory of the tenant", name)
+		}
+	}
+	if config.isDir("etc") {
+		t.Error("isDir should not follow a symbolic link leaving the directory of the tenant")
+	}
+}
@@ -0,0 +1,375 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	siteconfig "github.com/lao-tseu-is-alive/JsonSiteGo/pkg/config"
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/version"
+)
+
+const typesCommand = "types" // subcommand printing the TypeScript types of the config
+
+// jsonSchema is a decoded json schema, or one of its sub schemas.
+type jsonSchema map[string]interface{}
+
+// get returns the sub schema of s at key, nil when there is none.
+func (s jsonSchema) get(key string) jsonSchema {
+	if s == nil {
+		return nil
+	}
+	sub, _ := s[key].(map[string]interface{})
+	return sub
+}
+
+// property returns the schema of the property name of the object schema s.
+func (s jsonSchema) property(name string) jsonSchema {
+	return s.get("properties").get(name)
+}
+
+// isRequired reports whether the object schema s requires the property name.
+func (s jsonSchema) isRequired(name string) bool {
+	required, _ := s["required"].([]interface{})
+	return slices.Contains(required, interface{}(name))
+}
+
+// enum returns the enum of s as TypeScript literals, nil when s has no enum.
+func (s jsonSchema) enum() []string {
+	values, _ := s["enum"].([]interface{})
+	literals := make([]string, 0, len(values))
+	for _, value := range values {
+		literal, err := json.Marshal(value)
+		if err != nil {
+			return nil
+		}
+		literals = append(literals, string(literal))
+	}
+	return literals
+}
+
+// tsComponent is a component of the templates, with the json schema of its keyValues when it has one.
+type tsComponent struct {
+	Name   string
+	Schema jsonSchema
+}
+
+// tsGenerator writes the TypeScript declarations of Go types, following their json tags, and uses the json schema
+// of the config for the required properties, the enums and the descriptions, which the Go types do not have.
+type tsGenerator struct {
+	out        bytes.Buffer
+	names      map[reflect.Type]string // interface name of the structs already declared or queued
+	queue      []tsPending
+	components []tsComponent
+}
+
+// tsPending is a struct whose interface is still to be written.
+type tsPending struct {
+	t      reflect.Type
+	schema jsonSchema
+}
+
+var (
+	contentBlockType = reflect.TypeOf(ContentBlock{})
+	timeType         = reflect.TypeOf(time.Time{})
+)
+
+// generateTypeScript returns the TypeScript declarations of SiteConfig, using the config json schema when it is not
+// nil, with a ContentBlock type per component so that the keyValues of each component type are checked.
+func generateTypeScript(schema jsonSchema, components []tsComponent) []byte {
+	g := &tsGenerator{names: make(map[reflect.Type]string), components: components}
+	fmt.Fprintf(&g.out, "// Code generated by %s %s %s. DO NOT EDIT.\n", version.APP, typesCommand, version.VERSION)
+	fmt.Fprintf(&g.out, "// TypeScript types of the config.json of %s, use them with `satisfies SiteConfig` in a config written in TypeScript.\n", version.APP)
+	g.typeExpr(reflect.TypeOf(SiteConfig{}), schema, "")
+	for len(g.queue) > 0 {
+		pending := g.queue[0]
+		g.queue = g.queue[1:]
+		if pending.t == contentBlockType {
+			g.writeContentBlock(pending.schema)
+		} else {
+			g.writeInterface(g.names[pending.t], pending.t, pending.schema, nil)
+		}
+	}
+	return g.out.Bytes()
+}
+
+// typeExpr returns the TypeScript type of t, queuing the interfaces of the structs seen for the first time.
+// indent is used by the object types written inline.
+func (g *tsGenerator) typeExpr(t reflect.Type, schema jsonSchema, indent string) string {
+	if enum := schema.enum(); len(enum) > 0 {
+		return strings.Join(enum, " | ")
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return "string"
+	case t.Kind() == reflect.String:
+		return "string"
+	case t.Kind() == reflect.Bool:
+		return "boolean"
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Float64:
+		return "number"
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return g.arrayOf(g.typeExpr(t.Elem(), schema.get("items"), indent))
+	case t.Kind() == reflect.Map:
+		return fmt.Sprintf("Record<string, %s>", g.typeExpr(t.Elem(), schema.get("additionalProperties"), indent))
+	case t.Kind() == reflect.Struct:
+		if name, seen := g.names[t]; seen {
+			return name
+		}
+		g.names[t] = t.Name()
+		g.queue = append(g.queue, tsPending{t: t, schema: schema})
+		return t.Name()
+	case t.Kind() == reflect.Interface && schema != nil:
+		return g.schemaExpr(schema, indent)
+	}
+	return "unknown"
+}
+
+// arrayOf returns the array type of elem, with parentheses when elem is a union.
+func (g *tsGenerator) arrayOf(elem string) string {
+	if strings.Contains(elem, " | ") {
+		return "(" + elem + ")[]"
+	}
+	return elem + "[]"
+}
+
+// schemaExpr returns the TypeScript type described by a json schema, used for the keyValues of the components.
+func (g *tsGenerator) schemaExpr(schema jsonSchema, indent string) string {
+	if enum := schema.enum(); len(enum) > 0 {
+		return strings.Join(enum, " | ")
+	}
+	if value, ok := schema["const"]; ok {
+		if literal, err := json.Marshal(value); err == nil {
+			return string(literal)
+		}
+	}
+	for _, key := range []string{"oneOf", "anyOf"} {
+		if alternatives, ok := schema[key].([]interface{}); ok && len(alternatives) > 0 {
+			exprs := make([]string, 0, len(alternatives))
+			for _, alternative := range alternatives {
+				sub, _ := alternative.(map[string]interface{})
+				exprs = append(exprs, g.schemaExpr(sub, indent))
+			}
+			return strings.Join(exprs, " | ")
+		}
+	}
+	types, _ := schema["type"].([]interface{})
+	if name, ok := schema["type"].(string); ok {
+		types = []interface{}{name}
+	}
+	var exprs []string
+	for _, name := range types {
+		switch name {
+		case "string":
+			exprs = append(exprs, "string")
+		case "integer", "number":
+			exprs = append(exprs, "number")
+		case "boolean":
+			exprs = append(exprs, "boolean")
+		case "null":
+			exprs = append(exprs, "null")
+		case "array":
+			items := schema.get("items")
+			if items == nil {
+				exprs = append(exprs, "unknown[]")
+			} else {
+				exprs = append(exprs, g.arrayOf(g.schemaExpr(items, indent)))
+			}
+		case "object":
+			exprs = append(exprs, g.objectExpr(schema, indent))
+		}
+	}
+	if len(exprs) == 0 {
+		return "unknown"
+	}
+	return strings.Join(exprs, " | ")
+}
+
+// objectExpr returns the inline object type of an object json schema.
+func (g *tsGenerator) objectExpr(schema jsonSchema, indent string) string {
+	properties := schema.get("properties")
+	if len(properties) == 0 {
+		if values := schema.get("additionalProperties"); values != nil {
+			return fmt.Sprintf("Record<string, %s>", g.schemaExpr(values, indent))
+		}
+		return "Record<string, unknown>"
+	}
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var b strings.Builder
+	b.WriteString("{\n")
+	for _, name := range names {
+		property := properties.get(name)
+		g.writeDescription(&b, property, indent+"  ")
+		fmt.Fprintf(&b, "%s  %s%s: %s;\n", indent, tsPropertyName(name), tsOptional(schema, name), g.schemaExpr(property, indent+"  "))
+	}
+	if additional, ok := schema["additionalProperties"].(bool); !ok || additional {
+		fmt.Fprintf(&b, "%s  [key: string]: unknown;\n", indent)
+	}
+	b.WriteString(indent + "}")
+	return b.String()
+}
+
+// writeInterface writes the interface name of the struct t, without the json properties in skip.
+func (g *tsGenerator) writeInterface(name string, t reflect.Type, schema jsonSchema, skip []string) {
+	g.out.WriteString("\n")
+	g.writeDescription(&g.out, schema, "")
+	fmt.Fprintf(&g.out, "export interface %s {\n", name)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		jsonName, ok := getJSONName(field)
+		if !ok || slices.Contains(skip, jsonName) {
+			continue
+		}
+		property := schema.property(jsonName)
+		g.writeDescription(&g.out, property, "  ")
+		fmt.Fprintf(&g.out, "  %s%s: %s;\n", tsPropertyName(jsonName), tsOptional(schema, jsonName), g.typeExpr(field.Type, property, "  "))
+	}
+	g.out.WriteString("}\n")
+}
+
+// writeContentBlock writes the ContentBlock union, with one interface by component narrowing its type and keyValues.
+func (g *tsGenerator) writeContentBlock(schema jsonSchema) {
+	g.writeInterface("ContentBlockBase", contentBlockType, schema, []string{"type", "keyValues"})
+	keyValuesOptional := tsOptional(schema, "keyValues")
+	blocks := make([]string, 0, len(g.components)+1)
+	for _, component := range g.components {
+		keyValues := "Record<string, unknown>"
+		if component.Schema != nil {
+			keyValues = component.Name + "KeyValues"
+			g.out.WriteString("\n")
+			g.writeDescription(&g.out, component.Schema, "")
+			fmt.Fprintf(&g.out, "export type %s = %s;\n", keyValues, g.schemaExpr(component.Schema, ""))
+		}
+		name := component.Name + "Block"
+		fmt.Fprintf(&g.out, "\n/** block rendered by templates/components/%s.gohtml */\n", component.Name)
+		fmt.Fprintf(&g.out, "export interface %s extends ContentBlockBase {\n  type: %q;\n  keyValues%s: %s;\n}\n", name, component.Name, keyValuesOptional, keyValues)
+		blocks = append(blocks, name)
+	}
+	if len(blocks) == 0 {
+		// without the templates, any component type is accepted
+		fmt.Fprintf(&g.out, "\nexport interface ContentBlock extends ContentBlockBase {\n  type: string;\n  keyValues%s: Record<string, unknown>;\n}\n", keyValuesOptional)
+		return
+	}
+	fmt.Fprintf(&g.out, "\nexport type ContentBlock =\n  | %s;\n", strings.Join(blocks, "\n  | "))
+}
+
+// writeDescription writes the description of schema as a doc comment.
+func (g *tsGenerator) writeDescription(w io.Writer, schema jsonSchema, indent string) {
+	description, _ := schema["description"].(string)
+	if description = strings.TrimSpace(description); description == "" {
+		return
+	}
+	fmt.Fprintf(w, "%s/** %s */\n", indent, strings.ReplaceAll(description, "*/", "*\\/"))
+}
+
+// getJSONName returns the json name of field, and false when it is not encoded.
+func getJSONName(field reflect.StructField) (string, bool) {
+	if !field.IsExported() {
+		return "", false
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return "", false
+	}
+	if name == "" {
+		name = field.Name
+	}
+	return name, true
+}
+
+// tsOptional returns the ? of the properties not required by the object schema, the Go decoding requires none.
+func tsOptional(schema jsonSchema, name string) string {
+	if schema.isRequired(name) {
+		return ""
+	}
+	return "?"
+}
+
+// tsPropertyName quotes the property names which are not TypeScript identifiers.
+func tsPropertyName(name string) string {
+	for i, r := range name {
+		if !(r == '_' || r == '$' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (i > 0 && r >= '0' && r <= '9')) {
+			return strconv.Quote(name)
+		}
+	}
+	return name
+}
+
+// getTemplateComponents returns the components of the templates directory sorted by name, with their schema.
+func getTemplateComponents(dir string) ([]tsComponent, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "components", "*.gohtml"))
+	if err != nil {
+		return nil, err
+	}
+	components := make([]tsComponent, 0, len(files))
+	for _, file := range files {
+		component := tsComponent{Name: strings.TrimSuffix(filepath.Base(file), ".gohtml")}
+		data, err := os.ReadFile(strings.TrimSuffix(file, ".gohtml") + componentSchemaSuffix)
+		if err == nil {
+			if err := json.Unmarshal(data, &component.Schema); err != nil {
+				return nil, fmt.Errorf("error parsing the schema of component %s: %w", component.Name, err)
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		components = append(components, component)
+	}
+	return components, nil
+}
+
+// runTypes is the types subcommand : it writes the TypeScript types of the config to stdout or to the -out file,
+// completed by the config schema and the components of the templates. it returns the exit code of the process.
+func runTypes(args []string) int {
+	fs := flag.NewFlagSet(version.APP+" "+typesCommand, flag.ContinueOnError)
+	out := fs.String("out", "", "file written, like config.d.ts, instead of stdout")
+	if _, err := parseFlagsToEnv(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	var schema jsonSchema
+	schemaURL := getEnvOrDefault("SCHEMA_URL", defaultSchemaFile)
+	data, err := siteconfig.ReadSource(schemaURL)
+	if err == nil {
+		err = json.Unmarshal(data, &schema)
+	}
+	if err != nil {
+		// the Go types are enough for the types, the schema only adds the required properties, enums and descriptions
+		fmt.Fprintf(os.Stderr, "⚠️ WARNING: the config schema %s is not used: %v\n", schemaURL, err)
+		schema = nil
+	}
+	components, err := getTemplateComponents(getEnvOrDefault("TEMPLATES_DIR", defaultTemplatesDir))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "💥💥 error reading the components: %v\n", err)
+		return 1
+	}
+	types := generateTypeScript(schema, components)
+	if *out == "" {
+		os.Stdout.Write(types)
+		return 0
+	}
+	if err := os.WriteFile(*out, types, 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "💥💥 error writing the types: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "✅ TypeScript types of the config written to %s\n", *out)
+	return 0
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/update"
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/version"
+)
+
+const (
+	updateCheckTimeout  = 10 * time.Second
+	updateCheckInterval = 24 * time.Hour
+	updateCheckJobName  = "update-check" // name of the job of the scheduler checking for an update, reserved in the tasks
+)
+
+// updateCheck keeps the result of the check of env UPDATE_CHECK, returned by /version.
+var updateCheck = struct {
+	mu     sync.RWMutex
+	status *update.Status
+}{}
+
+// isUpdateCheckEnabledOrPanic reports whether env UPDATE_CHECK is true, the check is off by default since it
+// calls GitHub.
+func isUpdateCheckEnabledOrPanic() bool {
+	val := strings.TrimSpace(os.Getenv("UPDATE_CHECK"))
+	if val == "" {
+		return false
+	}
+	enabled, err := strconv.ParseBool(val)
+	if err != nil {
+		panic(fmt.Errorf("💥💥 ERROR: CONFIG ENV UPDATE_CHECK should be true or false. %w", err))
+	}
+	return enabled
+}
+
+// getUpdateCheckJob returns the job of the scheduler checking for an update at start and then each day.
+func getUpdateCheckJob(l *log.Logger) scheduledJob {
+	return scheduledJob{name: updateCheckJobName, schedule: intervalSchedule(updateCheckInterval), atStart: true, run: func(ctx context.Context) error {
+		return checkForUpdate(ctx, l)
+	}}
+}
+
+// checkForUpdate logs when a newer release than the running version is published, the api of env
+// UPDATE_CHECK_URL replaces the one of GitHub.
+func checkForUpdate(ctx context.Context, l *log.Logger) error {
+	ctx, cancel := context.WithTimeout(ctx, updateCheckTimeout)
+	defer cancel()
+	status, err := update.Check(ctx, http.DefaultClient, getEnvOrDefault("UPDATE_CHECK_URL", update.GitHubAPI), version.REPOSITORY, version.VERSION)
+	if err != nil {
+		return fmt.Errorf("error checking for a newer version: %w", err)
+	}
+	updateCheck.mu.Lock()
+	updateCheck.status = status
+	updateCheck.mu.Unlock()
+	if status.Available {
+		l.Printf("⚠️ WARNING: %s %s is available, this server runs %s, see %s", version.APP, status.Latest, status.Current, status.URL)
+	} else {
+		l.Printf("INFO: %s %s is the latest version", version.APP, status.Current)
+	}
+	return nil
+}
+
+// getUpdateStatus returns the result of the update check, nil when it did not run or failed.
+func getUpdateStatus() *update.Status {
+	updateCheck.mu.RLock()
+	defer updateCheck.mu.RUnlock()
+	return updateCheck.status
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+)
+
+// HasAnyRole reports whether the user has one of roles.
+func (u *User) HasAnyRole(roles []string) bool {
+	return slices.ContainsFunc(roles, u.HasRole)
+}
+
+// isVisibleTo reports whether an element restricted to the visibleTo roles can be shown to user,
+// an empty list means visible to everybody.
+func isVisibleTo(visibleTo []string, user *User) bool {
+	return len(visibleTo) == 0 || user.HasAnyRole(visibleTo)
+}
+
+// isProtectedPage reports whether the page is restricted to some users by requiredRole or visibleTo.
+func isProtectedPage(page *Page) bool {
+	return page.RequiredRole != "" || len(page.VisibleTo) > 0
+}
+
+// canSeePage reports whether user has the requiredRole and one of the visibleTo roles of the page.
+func canSeePage(page *Page, user *User) bool {
+	if page.RequiredRole != "" && !user.HasRole(page.RequiredRole) {
+		return false
+	}
+	return isVisibleTo(page.VisibleTo, user)
+}
+
+// getVisibleBlocks returns the content blocks of the page the user can see.
+func getVisibleBlocks(blocks []ContentBlock, user *User) []ContentBlock {
+	if !slices.ContainsFunc(blocks, func(b ContentBlock) bool { return len(b.VisibleTo) > 0 }) {
+		return blocks
+	}
+	visible := make([]ContentBlock, 0, len(blocks))
+	for _, block := range blocks {
+		if isVisibleTo(block.VisibleTo, user) {
+			visible = append(visible, block)
+		}
+	}
+	return visible
+}
+
+// getVisiblePages returns the pages the user can see.
+func getVisiblePages(pages []Page, user *User) []Page {
+	visible := make([]Page, 0, len(pages))
+	for i := range pages {
+		if canSeePage(&pages[i], user) {
+			visible = append(visible, pages[i])
+		}
+	}
+	return visible
+}
+
+// validateVisibility checks the visibleTo roles are not empty and that the auth config can identify the users.
+func validateVisibility(config *SiteConfig) []ConfigError {
+	var problems []ConfigError
+	check := func(pointer string, roles []string) {
+		for i, role := range roles {
+			if role == "" {
+				problems = append(problems, ConfigError{Pointer: fmt.Sprintf("%s/visibleTo/%d", pointer, i), Value: role, Message: "a role cannot be empty"})
+			}
+		}
+		if len(roles) > 0 && config.Auth == nil {
+			problems = append(problems, ConfigError{Pointer: pointer + "/visibleTo", Value: roles, Message: "visibleTo needs the auth config to know the roles of the users"})
+		}
+	}
+	for i, page := range config.Pages {
+		check(fmt.Sprintf("/pages/%d", i), page.VisibleTo)
+		for j, block := range page.CustomContent {
+			check(fmt.Sprintf("/pages/%d/custom_content/%d", i, j), block.VisibleTo)
+		}
+		for _, variant := range getVariantBlocks(&page, i) {
+			for j, block := range variant.Blocks {
+				check(fmt.Sprintf("%s/%d", variant.Pointer, j), block.VisibleTo)
+			}
+		}
+	}
+	for _, name := range getSnippetNames(config) {
+		for j, block := range config.Snippets[name] {
+			check(fmt.Sprintf("/snippets/%s/%d", name, j), block.VisibleTo)
+		}
+	}
+	for name, items := range config.Menus {
+		for i, item := range items {
+			check(fmt.Sprintf("/menus/%s/%d", name, i), item.VisibleTo)
+		}
+	}
+	return problems
+}
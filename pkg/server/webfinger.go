@@ -0,0 +1,127 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+const webFingerPath = "/.well-known/webfinger"
+
+// webFingerLink is a link of a webfinger resource (RFC 7033).
+type webFingerLink struct {
+	Rel  string `json:"rel"`
+	Type string `json:"type,omitempty"`
+	Href string `json:"href"`
+}
+
+// webFingerResource is the json resource descriptor answered by the webfinger endpoint.
+type webFingerResource struct {
+	Subject string          `json:"subject"`
+	Aliases []string        `json:"aliases,omitempty"`
+	Links   []webFingerLink `json:"links"`
+}
+
+// fediverseAccount is the mastodon account of the social links, like https://mastodon.social/@name.
+type fediverseAccount struct {
+	User    string // name
+	Host    string // mastodon.social
+	Profile string // https://mastodon.social/@name
+}
+
+// getFediverseAccount returns the account of the mastodon social link, found is false without one or when its url
+// is not the profile of an account.
+func getFediverseAccount(config *SiteConfig) (account fediverseAccount, found bool) {
+	for platform, profile := range config.Social {
+		if !strings.EqualFold(platform, "mastodon") {
+			continue
+		}
+		u, err := url.Parse(strings.TrimSpace(profile))
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return fediverseAccount{}, false
+		}
+		user, found := strings.CutPrefix(strings.Trim(u.Path, "/"), "@")
+		if !found || user == "" || strings.ContainsAny(user, "/@") {
+			return fediverseAccount{}, false
+		}
+		return fediverseAccount{User: user, Host: u.Host, Profile: "https://" + u.Host + "/@" + user}, true
+	}
+	return fediverseAccount{}, false
+}
+
+// getWebFingerResources returns the resources the webfinger endpoint answers for: the account itself first, its
+// profile, the author e-mail as acct: or mailto: uri.
+func getWebFingerResources(config *SiteConfig, account fediverseAccount) []string {
+	resources := []string{"acct:" + account.User + "@" + account.Host, account.Profile}
+	if email := strings.TrimSpace(config.Author.Email); email != "" {
+		resources = append(resources, "acct:"+email, "mailto:"+email)
+	}
+	return resources
+}
+
+// isSiteAccount reports whether resource is an acct: uri of the host of the site, like acct:me@example.com, so that
+// the site domain can be used as the fediverse identity of its author.
+func isSiteAccount(config *SiteConfig, r *http.Request, resource string) bool {
+	acct, found := strings.CutPrefix(resource, "acct:")
+	if !found {
+		return false
+	}
+	_, host, found := strings.Cut(acct, "@")
+	if !found {
+		return false
+	}
+	requestHost := r.Host
+	if h, _, err := net.SplitHostPort(requestHost); err == nil {
+		requestHost = h
+	}
+	if strings.EqualFold(host, requestHost) {
+		return true
+	}
+	base, err := url.Parse(config.BaseURL)
+	return err == nil && base.Hostname() != "" && strings.EqualFold(host, base.Hostname())
+}
+
+// getWebFingerHandler answers the webfinger queries of the author with the mastodon account of the social links, so
+// that @author@example.com is found by the fediverse servers. the rel parameters filter the links.
+func getWebFingerHandler(config *SiteConfig, account fediverseAccount) http.HandlerFunc {
+	links := []webFingerLink{
+		{Rel: "http://webfinger.net/rel/profile-page", Type: "text/html", Href: account.Profile},
+		{Rel: "self", Type: "application/activity+json", Href: "https://" + account.Host + "/users/" + account.User},
+	}
+	resources := getWebFingerResources(config, account)
+	return func(w http.ResponseWriter, r *http.Request) {
+		// the webfinger clients are often scripts of other sites
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		query := r.URL.Query()
+		resource := query.Get("resource")
+		if resource == "" {
+			writeJSONError(w, r, http.StatusBadRequest, "the resource parameter is missing, like ?resource=acct:name@example.com")
+			return
+		}
+		if !slices.Contains(resources, resource) && !isSiteAccount(config, r, resource) {
+			writeJSONError(w, r, http.StatusNotFound, "unknown resource "+resource)
+			return
+		}
+		// the subject is the account, the fediverse servers check it on the mastodon server
+		answer := webFingerResource{
+			Subject: resources[0],
+			Aliases: []string{account.Profile, "https://" + account.Host + "/users/" + account.User},
+			Links:   links,
+		}
+		if rels := query["rel"]; len(rels) > 0 {
+			answer.Links = slices.DeleteFunc(slices.Clone(links), func(link webFingerLink) bool {
+				return !slices.Contains(rels, link.Rel)
+			})
+		}
+		body, err := json.Marshal(answer)
+		if err != nil {
+			writeJSONError(w, r, http.StatusInternalServerError, "error encoding the resource")
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		writeResponse(w, r, http.StatusOK, "application/jrd+json", append(body, '\n'))
+	}
+}
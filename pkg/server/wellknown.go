@@ -0,0 +1,99 @@
+package server
+
+import (
+	"fmt"
+	"mime"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// WellKnownFile is a file served at a fixed path of the site, like /robots.txt or /.well-known/security.txt,
+// from its content in the config or from a file.
+type WellKnownFile struct {
+	Content     string `json:"content,omitempty"`     // text of the file
+	File        string `json:"file,omitempty"`        // path of the file served instead of content, read when the site is built
+	ContentType string `json:"contentType,omitempty"` // guessed from the extension of the path when empty, else text/plain
+}
+
+// getReservedPaths returns the paths served by the server itself, which a wellKnown file can't replace.
+// the /favicon.ico of the working directory is only served without favicon source, so a wellKnown file may replace it.
+func getReservedPaths(config *SiteConfig) []string {
+	reserved := []string{"/set-theme", themeAPIPath, healthPath, versionPath, "/metrics", debugPath, configPath, contentWebhookPath, requestsPath}
+	if config.Favicon != "" {
+		reserved = append(reserved, "/favicon.ico", manifestPath)
+		for _, icon := range faviconPNGs {
+			reserved = append(reserved, icon.Path)
+		}
+		if isPWAEnabled(config) {
+			reserved = append(reserved, serviceWorkerPath)
+		}
+	}
+	if len(config.Events) > 0 {
+		reserved = append(reserved, eventsICSPath)
+	}
+	if hasNewsletter(config) {
+		reserved = append(reserved, newsletterConfirmPath)
+	}
+	return reserved
+}
+
+// validateWellKnown checks each wellKnown file has a path of a file, not served otherwise, and a content or a file.
+func validateWellKnown(config *SiteConfig) []ConfigError {
+	var problems []ConfigError
+	reserved := getReservedPaths(config)
+	for _, p := range getWellKnownPaths(config) {
+		file := config.WellKnown[p]
+		pointer := "/wellKnown/" + strings.ReplaceAll(strings.ReplaceAll(p, "~", "~0"), "/", "~1")
+		switch {
+		case !strings.HasPrefix(p, "/") || strings.HasSuffix(p, "/") || strings.ContainsAny(p, "{}? ") || path.Clean(p) != p:
+			problems = append(problems, ConfigError{Pointer: pointer, Value: p, Message: "the path must be the clean path of a file, like /robots.txt or /.well-known/security.txt"})
+		case slices.Contains(reserved, p) || strings.HasPrefix(p, staticURLPrefix) || strings.HasPrefix(p, adminPathPrefix+"/") || strings.HasPrefix(p, authPathPrefix+"/"):
+			problems = append(problems, ConfigError{Pointer: pointer, Value: p, Message: "the path is already served by the server"})
+		}
+		for _, page := range config.Pages {
+			if parts := strings.Fields(page.Route); page.CreateHandler && len(parts) > 1 && (parts[0] == "GET" || parts[0] == "HEAD") && parts[1] == p {
+				problems = append(problems, ConfigError{Pointer: pointer, Value: p, Message: fmt.Sprintf("the path is already the route of the page %q", page.Title)})
+			}
+		}
+		if (file.Content == "") == (file.File == "") {
+			problems = append(problems, ConfigError{Pointer: pointer, Value: p, Message: "the file needs either a content or a file"})
+		}
+	}
+	return problems
+}
+
+// getWellKnownPaths returns the paths of the wellKnown files sorted, so that the problems and logs keep their order.
+func getWellKnownPaths(config *SiteConfig) []string {
+	paths := make([]string, 0, len(config.WellKnown))
+	for p := range config.WellKnown {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// getWellKnownFiles returns the wellKnown files of the config by url path, with the files read now.
+func getWellKnownFiles(config *SiteConfig) (map[string]generatedFile, error) {
+	files := make(map[string]generatedFile, len(config.WellKnown))
+	for _, p := range getWellKnownPaths(config) {
+		file := config.WellKnown[p]
+		data := []byte(file.Content)
+		if file.File != "" {
+			var err error
+			if data, err = config.readFile(file.File); err != nil {
+				return nil, fmt.Errorf("error reading the wellKnown file of %s: %w", p, err)
+			}
+		}
+		contentType := file.ContentType
+		if contentType == "" {
+			contentType = mime.TypeByExtension(path.Ext(p))
+		}
+		if contentType == "" {
+			contentType = "text/plain; charset=utf-8"
+		}
+		files[p] = generatedFile{ContentType: contentType, Data: data}
+	}
+	return files, nil
+}
@@ -0,0 +1,388 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// the when expressions of the content blocks are a small language evaluated at render time, like
+//
+//	date.today >= "2026-12-01" && date.today <= "2026-12-31"
+//	env.APP_ENV != "production" || page.language == "fr"
+//
+// the values are strings, numbers and booleans, compared as numbers when both sides are numbers, else as strings,
+// so that the dates written like 2026-12-01 compare in order. a value alone is true when it is not false, 0 or "".
+
+// whenFields are the names known under each root of the expressions, env accepts any variable name.
+var whenFields = map[string][]string{
+	"site": {"title", "baseURL", "language", "description"},
+	"page": {"route", "title", "language", "description", "path"},
+	"date": {"today", "now", "year", "month", "day", "weekday", "hour", "minute"},
+}
+
+// whenScope gives the values of the identifiers of an expression when a page is rendered.
+type whenScope struct {
+	site *SiteConfig
+	page *Page
+	path string // of the request
+	now  time.Time
+}
+
+// lookup returns the value of a dotted identifier like date.month, checked by parseWhen.
+func (s whenScope) lookup(name string) interface{} {
+	root, field, _ := strings.Cut(name, ".")
+	switch root {
+	case "env":
+		return os.Getenv(field)
+	case "site":
+		switch field {
+		case "title":
+			return s.site.Title
+		case "baseURL":
+			return s.site.BaseURL
+		case "language":
+			return s.site.Language
+		case "description":
+			return s.site.Description
+		}
+	case "page":
+		switch field {
+		case "route":
+			return s.page.Route
+		case "title":
+			return s.page.Title
+		case "language":
+			if s.page.Language == "" {
+				return s.site.Language
+			}
+			return s.page.Language
+		case "description":
+			return s.page.Description
+		case "path":
+			return s.path
+		}
+	case "date":
+		switch field {
+		case "today":
+			return s.now.Format("2006-01-02")
+		case "now":
+			return s.now.Format(time.RFC3339)
+		case "year":
+			return float64(s.now.Year())
+		case "month":
+			return float64(s.now.Month())
+		case "day":
+			return float64(s.now.Day())
+		case "weekday":
+			return strings.ToLower(s.now.Weekday().String())
+		case "hour":
+			return float64(s.now.Hour())
+		case "minute":
+			return float64(s.now.Minute())
+		}
+	}
+	return nil
+}
+
+// whenNode is a node of a parsed expression.
+type whenNode interface {
+	eval(scope whenScope) interface{}
+}
+
+type whenLiteral struct{ value interface{} }
+
+type whenIdent struct{ name string }
+
+type whenNot struct{ operand whenNode }
+
+type whenBinary struct {
+	op          string
+	left, right whenNode
+}
+
+func (n whenLiteral) eval(whenScope) interface{} { return n.value }
+
+func (n whenIdent) eval(scope whenScope) interface{} { return scope.lookup(n.name) }
+
+func (n whenNot) eval(scope whenScope) interface{} { return !isWhenTrue(n.operand.eval(scope)) }
+
+func (n whenBinary) eval(scope whenScope) interface{} {
+	switch n.op {
+	case "&&":
+		return isWhenTrue(n.left.eval(scope)) && isWhenTrue(n.right.eval(scope))
+	case "||":
+		return isWhenTrue(n.left.eval(scope)) || isWhenTrue(n.right.eval(scope))
+	}
+	c := compareWhenValues(n.left.eval(scope), n.right.eval(scope))
+	switch n.op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default: // >=
+		return c >= 0
+	}
+}
+
+// isWhenTrue reports whether a value is true: not false, 0 nor an empty string.
+func isWhenTrue(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	}
+	return false
+}
+
+// compareWhenValues compares two values as numbers when both are numbers or numeric strings, else as strings.
+func compareWhenValues(a, b interface{}) int {
+	fa, errA := toFloat(a)
+	fb, errB := toFloat(b)
+	if errA == nil && errB == nil {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// whenParser is a recursive descent parser of the expressions, by increasing precedence: ||, &&, the comparisons,
+// then ! and the operands.
+type whenParser struct {
+	tokens []string
+	pos    int
+}
+
+// whenOperators are the operator tokens, the two characters ones first.
+var whenOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")"}
+
+// tokenizeWhen splits an expression in tokens, the strings keep their quotes.
+func tokenizeWhen(expr string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(expr); {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(expr[i+1:], expr[i])
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at %d", i+1)
+			}
+			tokens = append(tokens, expr[i:i+end+2])
+			i += end + 2
+		case c == '_' || c == '.' || c == '-' || unicode.IsLetter(c) || unicode.IsDigit(c):
+			start := i
+			for i < len(expr) && (expr[i] == '_' || expr[i] == '.' || expr[i] == '-' || unicode.IsLetter(rune(expr[i])) || unicode.IsDigit(rune(expr[i]))) {
+				i++
+			}
+			tokens = append(tokens, expr[start:i])
+		default:
+			op := ""
+			for _, candidate := range whenOperators {
+				if strings.HasPrefix(expr[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at %d", c, i+1)
+			}
+			tokens = append(tokens, op)
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+// parseWhen parses an expression, checking its identifiers.
+func parseWhen(expr string) (whenNode, error) {
+	tokens, err := tokenizeWhen(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("the expression is empty")
+	}
+	p := &whenParser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	return node, nil
+}
+
+func (p *whenParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *whenParser) parseOr() (whenNode, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.peek() == "||" {
+		p.pos++
+		var right whenNode
+		if right, err = p.parseAnd(); err == nil {
+			left = whenBinary{op: "||", left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *whenParser) parseAnd() (whenNode, error) {
+	left, err := p.parseComparison()
+	for err == nil && p.peek() == "&&" {
+		p.pos++
+		var right whenNode
+		if right, err = p.parseComparison(); err == nil {
+			left = whenBinary{op: "&&", left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *whenParser) parseComparison() (whenNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	if op := p.peek(); slices.Contains([]string{"==", "!=", "<", "<=", ">", ">="}, op) {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return whenBinary{op: op, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *whenParser) parseUnary() (whenNode, error) {
+	token := p.peek()
+	p.pos++
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("unexpected end of the expression")
+	case token == "!":
+		operand, err := p.parseUnary()
+		return whenNot{operand: operand}, err
+	case token == "(":
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return node, nil
+	case token[0] == '"' || token[0] == '\'':
+		return whenLiteral{value: token[1 : len(token)-1]}, nil
+	case token == "true" || token == "false":
+		return whenLiteral{value: token == "true"}, nil
+	}
+	if f, err := strconv.ParseFloat(token, 64); err == nil {
+		return whenLiteral{value: f}, nil
+	}
+	root, field, found := strings.Cut(token, ".")
+	if !found || field == "" {
+		return nil, fmt.Errorf("unexpected %q, the values are strings, numbers, true, false or like date.today", token)
+	}
+	if root == "env" {
+		return whenIdent{name: token}, nil
+	}
+	fields, known := whenFields[root]
+	if !known {
+		return nil, fmt.Errorf("unknown %q, the values are under site, page, env or date", token)
+	}
+	if !slices.Contains(fields, field) {
+		return nil, fmt.Errorf("unknown %q, %s has %s", token, root, strings.Join(fields, ", "))
+	}
+	return whenIdent{name: token}, nil
+}
+
+// parsedWhens caches the parsed expressions, checked when the config is loaded.
+var parsedWhens sync.Map
+
+// isWhenMet reports whether the when expression of a block is true for scope, a block without one is always shown.
+func isWhenMet(expr string, scope whenScope) bool {
+	if expr == "" {
+		return true
+	}
+	node, ok := parsedWhens.Load(expr)
+	if !ok {
+		parsed, err := parseWhen(expr)
+		if err != nil {
+			return false
+		}
+		node, _ = parsedWhens.LoadOrStore(expr, parsed)
+	}
+	return isWhenTrue(node.(whenNode).eval(scope))
+}
+
+// getWhenBlocks returns the blocks whose when expression is true for the page rendered now.
+func getWhenBlocks(blocks []ContentBlock, scope whenScope) []ContentBlock {
+	if !slices.ContainsFunc(blocks, func(b ContentBlock) bool { return b.When != "" }) {
+		return blocks
+	}
+	shown := make([]ContentBlock, 0, len(blocks))
+	for _, block := range blocks {
+		if isWhenMet(block.When, scope) {
+			shown = append(shown, block)
+		}
+	}
+	return shown
+}
+
+// validateWhen checks the when expressions of the content blocks of the pages and of the snippets parse.
+func validateWhen(config *SiteConfig) []ConfigError {
+	var problems []ConfigError
+	for i, page := range config.Pages {
+		lists := append([]variantBlocks{{Pointer: fmt.Sprintf("/pages/%d/custom_content", i), Blocks: page.CustomContent}}, getVariantBlocks(&page, i)...)
+		for _, list := range lists {
+			for j, block := range list.Blocks {
+				if block.When == "" {
+					continue
+				}
+				if _, err := parseWhen(block.When); err != nil {
+					problems = append(problems, ConfigError{Pointer: fmt.Sprintf("%s/%d/when", list.Pointer, j), Value: block.When, Message: fmt.Sprintf("invalid expression: %v", err)})
+				}
+			}
+		}
+	}
+	for _, name := range getSnippetNames(config) {
+		for j, block := range config.Snippets[name] {
+			if block.When == "" {
+				continue
+			}
+			if _, err := parseWhen(block.When); err != nil {
+				problems = append(problems, ConfigError{Pointer: fmt.Sprintf("/snippets/%s/%d/when", name, j), Value: block.When, Message: fmt.Sprintf("invalid expression: %v", err)})
+			}
+		}
+	}
+	return problems
+}
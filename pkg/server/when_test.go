@@ -0,0 +1,138 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWhenExpressions(t *testing.T) {
+	t.Setenv("JSONSITEGO_TEST_MODE", "preview")
+	t.Setenv("JSONSITEGO_TEST_LIMIT", "10")
+	scope := whenScope{
+		site: &SiteConfig{Title: "My Site", BaseURL: "https://example.com", Language: "en"},
+		page: &Page{Route: "GET /blog", Title: "Blog"},
+		path: "/blog",
+		now:  time.Date(2026, time.December, 24, 18, 30, 0, 0, time.UTC),
+	}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		// precedence: ! before the comparisons, before &&, before ||
+		{expr: `true || false && false`, want: true},
+		{expr: `(true || false) && false`, want: false},
+		{expr: `false && false || true`, want: true},
+		{expr: `!false && false`, want: false},
+		{expr: `!(false && false)`, want: true},
+		{expr: `!!true`, want: true},
+		{expr: `1 < 2 && 2 < 1 || 3 == 3`, want: true},
+		{expr: `!page.title == false`, want: true},
+		// strings
+		{expr: `page.title == "Blog"`, want: true},
+		{expr: `page.title == 'blog'`, want: false},
+		{expr: `page.language == "en"`, want: true},
+		{expr: `site.title != "My Site"`, want: false},
+		{expr: `page.path >= "/blog"`, want: true},
+		{expr: `page.route`, want: true},
+		{expr: `site.description`, want: false},
+		{expr: `"b" > "a"`, want: true},
+		// numbers, compared as numbers even when written as strings
+		{expr: `date.year == 2026`, want: true},
+		{expr: `date.month >= 12 && date.day > 20`, want: true},
+		{expr: `date.hour < 18`, want: false},
+		{expr: `"10" > 9`, want: true},
+		{expr: `"10" > "9"`, want: true},
+		{expr: `0`, want: false},
+		{expr: `-1 < 0`, want: true},
+		// dates, compared as strings in the order of their days
+		{expr: `date.today == "2026-12-24"`, want: true},
+		{expr: `date.today >= "2026-12-01" && date.today <= "2026-12-31"`, want: true},
+		{expr: `date.today < "2026-02-01"`, want: false},
+		{expr: `date.now > "2026-12-24T18:00:00Z"`, want: true},
+		{expr: `date.weekday == "thursday"`, want: true},
+		// env
+		{expr: `env.JSONSITEGO_TEST_MODE == "preview"`, want: true},
+		{expr: `env.JSONSITEGO_TEST_LIMIT > 9`, want: true},
+		{expr: `env.JSONSITEGO_TEST_UNSET`, want: false},
+		{expr: `env.JSONSITEGO_TEST_UNSET == ""`, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			node, err := parseWhen(tt.expr)
+			if err != nil {
+				t.Fatalf("parseWhen() error = %v", err)
+			}
+			if got := isWhenTrue(node.eval(scope)); got != tt.want {
+				t.Errorf("%s = %v, want %v", tt.expr, got, tt.want)
+			}
+			if got := isWhenMet(tt.expr, scope); got != tt.want {
+				t.Errorf("isWhenMet(%s) = %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseWhenErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{expr: ``, wantErr: "the expression is empty"},
+		{expr: `   `, wantErr: "the expression is empty"},
+		{expr: `page.color == "red"`, wantErr: `unknown "page.color", page has route, title`},
+		{expr: `user.name == "ann"`, wantErr: `unknown "user.name", the values are under site, page, env or date`},
+		{expr: `date.`, wantErr: `unexpected "date."`},
+		{expr: `today`, wantErr: `unexpected "today", the values are strings`},
+		{expr: `page.title == "Blog`, wantErr: "unterminated string at 15"},
+		{expr: `date.year = 2026`, wantErr: `unexpected '=' at 11`},
+		{expr: `(true || false`, wantErr: "missing )"},
+		{expr: `true)`, wantErr: `unexpected ")"`},
+		{expr: `true &&`, wantErr: "unexpected end of the expression"},
+		{expr: `!`, wantErr: "unexpected end of the expression"},
+		{expr: `1 < 2 < 3`, wantErr: `unexpected "<"`},
+		{expr: `true false`, wantErr: `unexpected "false"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			if _, err := parseWhen(tt.expr); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseWhen(%q) error = %v, want %s", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+	// a block whose expression does not parse is hidden rather than failing the page
+	if isWhenMet(`page.color == "red"`, whenScope{}) {
+		t.Errorf("isWhenMet() of an invalid expression should be false")
+	}
+}
+
+func TestValidateWhen(t *testing.T) {
+	config := &SiteConfig{
+		Pages: []Page{
+			{Route: "GET /", CustomContent: []ContentBlock{
+				{Type: "Text", When: `date.month == 12`},
+				{Type: "Text"},
+				{Type: "Text", When: `page.color == "red"`},
+			}},
+		},
+		Snippets: map[string][]ContentBlock{
+			"banner": {{Type: "Text", When: `date.today >=`}},
+		},
+	}
+	problems := validateWhen(config)
+	if len(problems) != 2 {
+		t.Fatalf("validateWhen() = %v, want 2 problems", problems)
+	}
+	want := []struct{ pointer, message string }{
+		{"/pages/0/custom_content/2/when", `invalid expression: unknown "page.color"`},
+		{"/snippets/banner/0/when", "invalid expression: unexpected end of the expression"},
+	}
+	for i, w := range want {
+		if problems[i].Pointer != w.pointer || !strings.Contains(problems[i].Message, w.message) {
+			t.Errorf("validateWhen()[%d] = %s: %s, want %s: %s", i, problems[i].Pointer, problems[i].Message, w.pointer, w.message)
+		}
+	}
+	if problems[0].Value != `page.color == "red"` {
+		t.Errorf("validateWhen() value = %v, want the expression", problems[0].Value)
+	}
+}
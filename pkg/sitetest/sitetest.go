@@ -0,0 +1,296 @@
+// Package sitetest renders the routes of a JsonSiteGo site and compares the pages with golden files, so that the
+// tests of a site repository catch the regressions of its templates and config. the golden files are written, or
+// rewritten once a change is reviewed, by running the tests with go test -update.
+//
+// a test of a site repository builds the site of its config in the test process, then checks every route of it :
+//
+//	func TestPages(t *testing.T) {
+//		site := sitetest.NewHandler(t, "../config.json")
+//		sitetest.Run(t, site, "../config.json", sitetest.Options{})
+//	}
+//
+// StartServer does the same with a server binary, to test the site with a released version of JsonSiteGo.
+package sitetest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/pkg/server"
+)
+
+const (
+	DefaultGoldenDir   = "testdata/golden" // directory of the golden files when Options.Dir is empty
+	serverStartTimeout = 30 * time.Second
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of sitetest with the pages rendered")
+
+// Options customizes Run.
+type Options struct {
+	Dir       string                   // directory of the golden files, DefaultGoldenDir when empty
+	Routes    []string                 // paths rendered, the GET routes of the config without wildcards when empty
+	Request   func(r *http.Request)    // prepares each fake request, like adding a cookie or an Accept-Language
+	Normalize func(page []byte) []byte // removes the parts of the pages changing at each run, like dates
+}
+
+// configPage is the part of a page of the config used to find its route.
+type configPage struct {
+	Route         string     `json:"route"`
+	Draft         bool       `json:"draft"`
+	PublishAt     *time.Time `json:"publishAt"`
+	ExpireAt      *time.Time `json:"expireAt"`
+	CreateHandler bool       `json:"create_handler"`
+}
+
+// Routes returns the home and the paths of the GET routes of the published pages of the config at configPath,
+// the routes having wildcards like /blog/{slug} are skipped since they need a real value.
+func Routes(configPath string) ([]string, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the config: %w", err)
+	}
+	var config struct {
+		Pages []configPage `json:"pages"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error parsing the config %s: %w", configPath, err)
+	}
+	routes := []string{"/"}
+	now := time.Now()
+	for _, page := range config.Pages {
+		parts := strings.Fields(page.Route)
+		if !page.CreateHandler || page.Draft || len(parts) < 2 || parts[0] != http.MethodGet {
+			continue
+		}
+		if (page.PublishAt != nil && now.Before(*page.PublishAt)) || (page.ExpireAt != nil && !now.Before(*page.ExpireAt)) {
+			continue
+		}
+		if path := parts[1]; !strings.Contains(path, "{") && !slices.Contains(routes, path) {
+			routes = append(routes, path)
+		}
+	}
+	return routes, nil
+}
+
+// Run renders each route of the config at configPath with handler, in a subtest by route, and compares the status,
+// the content type and the body of the response with the golden file of the route.
+func Run(t *testing.T, handler http.Handler, configPath string, opts Options) {
+	t.Helper()
+	routes := opts.Routes
+	if len(routes) == 0 {
+		var err error
+		if routes, err = Routes(configPath); err != nil {
+			t.Fatalf("💥💥 %v", err)
+		}
+	}
+	dir := opts.Dir
+	if dir == "" {
+		dir = DefaultGoldenDir
+	}
+	for _, route := range routes {
+		t.Run(route, func(t *testing.T) {
+			got := Render(handler, route, opts.Request)
+			if opts.Normalize != nil {
+				got = opts.Normalize(got)
+			}
+			AssertGolden(t, filepath.Join(dir, GoldenName(route)), got)
+		})
+	}
+}
+
+// Render serves a fake GET request of path with handler, prepared by prepare when it is not nil, and returns the
+// response as compared with the golden files : the request line, the status and the content type, then the body.
+func Render(handler http.Handler, path string, prepare func(r *http.Request)) []byte {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	r.Header.Set("Accept", "text/html")
+	if prepare != nil {
+		prepare(r)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "GET %s\nstatus: %d\ncontent-type: %s\n\n", path, w.Code, w.Header().Get("Content-Type"))
+	out.Write(w.Body.Bytes())
+	return out.Bytes()
+}
+
+// GoldenName returns the file name of the golden file of path, like docs_intro.golden for /docs/intro.
+func GoldenName(path string) string {
+	name := strings.Trim(path, "/")
+	if name == "" {
+		name = "index"
+	}
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == '?' || r == '&' || r == '=' || r == ':' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, name)
+	return name + ".golden"
+}
+
+// AssertGolden fails t when got differs from the golden file at path, reporting the first line differing.
+// with -update the golden file is written instead.
+func AssertGolden(t testing.TB, path string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("💥💥 error creating the golden files directory: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("💥💥 error writing the golden file: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		t.Fatalf("💥 golden file %s does not exist, run go test -update to create it", path)
+	}
+	if err != nil {
+		t.Fatalf("💥💥 error reading the golden file: %v", err)
+	}
+	if !bytes.Equal(want, got) {
+		t.Errorf("💥 the page differs from %s, run go test -update to accept the change\n%s", path, firstDifference(want, got))
+	}
+}
+
+// firstDifference describes the first line differing between want and got.
+func firstDifference(want, got []byte) string {
+	wantLines, gotLines := strings.Split(string(want), "\n"), strings.Split(string(got), "\n")
+	for i := 0; i < max(len(wantLines), len(gotLines)); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g || i >= len(wantLines) || i >= len(gotLines) {
+			return fmt.Sprintf("line %d:\n  golden: %q\n  got:    %q", i+1, w, g)
+		}
+	}
+	return "the files differ"
+}
+
+// NewHandler builds the site of the config at configPath in the test process, like the server does, and returns its
+// handler. the templates and static directories are the ones next to the config unless TEMPLATES_DIR or STATIC_DIR
+// are set, like the config.schema.json there. the env variables are set with t.Setenv, so the test can't be parallel.
+func NewHandler(t testing.TB, configPath string) http.Handler {
+	t.Helper()
+	configPath, err := filepath.Abs(configPath)
+	if err != nil {
+		t.Fatalf("💥💥 error getting the path of the config: %v", err)
+	}
+	dir := filepath.Dir(configPath)
+	t.Setenv("CONFIG_URL", configPath)
+	for env, name := range map[string]string{"TEMPLATES_DIR": "templates", "STATIC_DIR": "static"} {
+		if os.Getenv(env) == "" {
+			t.Setenv(env, filepath.Join(dir, name))
+		}
+	}
+	if schema, found := getLocalSchema(dir); found {
+		t.Setenv("SCHEMA_URL", schema)
+	}
+	srv, err := server.New(log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("💥💥 error building the site: %v", err)
+	}
+	return srv.Handler()
+}
+
+// getLocalSchema returns the config.schema.json of dir when SCHEMA_URL is not set, so that the config is validated
+// without downloading the schema.
+func getLocalSchema(dir string) (string, bool) {
+	if os.Getenv("SCHEMA_URL") != "" {
+		return "", false
+	}
+	schema := filepath.Join(dir, "config.schema.json")
+	if _, err := os.Stat(schema); err != nil {
+		return "", false
+	}
+	return schema, true
+}
+
+// StartServer runs the server binary, like jsonSiteGoServer installed by go install, with the config at configPath
+// on a free local port, and returns a handler forwarding the requests to it. the server runs in the directory of the
+// config so that its templates and static directories are found, with the config.schema.json there if any, and is
+// stopped at the end of the test. env adds variables like APP_ENV=dev, the config must not define listeners.
+func StartServer(t testing.TB, binary, configPath string, env ...string) http.Handler {
+	t.Helper()
+	configPath, err := filepath.Abs(configPath)
+	if err != nil {
+		t.Fatalf("💥💥 error getting the path of the config: %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("💥💥 error finding a free port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	dir := filepath.Dir(configPath)
+	cmd := exec.Command(binary)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "CONFIG_URL="+configPath, fmt.Sprintf("PORT=%d", port), "LOG_FILE=stderr")
+	if schema, found := getLocalSchema(dir); found {
+		cmd.Env = append(cmd.Env, "SCHEMA_URL="+schema)
+	}
+	cmd.Env = append(cmd.Env, env...)
+	var logs bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &logs, &logs
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("💥💥 error starting %s: %v", binary, err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		<-exited
+	})
+
+	base := &url.URL{Scheme: "http", Host: fmt.Sprintf("127.0.0.1:%d", port)}
+	ctx, cancel := context.WithTimeout(context.Background(), serverStartTimeout)
+	defer cancel()
+	for {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, base.String()+"/", nil)
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			break
+		}
+		select {
+		case <-exited:
+			t.Fatalf("💥💥 %s exited before serving the site:\n%s", binary, logs.String())
+		case <-ctx.Done():
+			t.Fatalf("💥💥 %s did not serve the site within %s:\n%s", binary, serverStartTimeout, logs.String())
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	proxy := httputil.NewSingleHostReverseProxy(base)
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		t.Errorf("💥 error forwarding %s to %s: %v", r.URL.Path, binary, err)
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	return proxy
+}
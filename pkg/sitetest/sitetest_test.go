@@ -0,0 +1,45 @@
+package sitetest
+
+import (
+	"strings"
+	"testing"
+)
+
+// exampleConfig is the config of the example site at the root of the repository.
+const exampleConfig = "../../config.json"
+
+func TestRoutes(t *testing.T) {
+	routes, err := Routes(exampleConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "/ /blog /product1 /product2 /contact /about"
+	if got := strings.Join(routes, " "); got != want {
+		t.Errorf("Routes() = %s, want %s without the draft", got, want)
+	}
+}
+
+func TestGoldenName(t *testing.T) {
+	tests := map[string]string{
+		"/":                 "index.golden",
+		"/docs/intro":       "docs_intro.golden",
+		"/search?q=go&p=2":  "search_q_go_p_2.golden",
+		"/blog/":            "blog.golden",
+		"/c:\\windows\\ini": "c__windows_ini.golden",
+	}
+	for path, want := range tests {
+		if got := GoldenName(path); got != want {
+			t.Errorf("GoldenName(%q) = %s, want %s", path, got, want)
+		}
+	}
+}
+
+// TestExampleSite renders the example site with its golden files, run go test -update after a change of its
+// config or of the templates.
+func TestExampleSite(t *testing.T) {
+	site := NewHandler(t, exampleConfig)
+	Run(t, site, exampleConfig, Options{})
+	if page := string(Render(site, "/secret-project", nil)); !strings.Contains(page, "status: 404") {
+		t.Errorf("the draft page is served:\n%s", page)
+	}
+}
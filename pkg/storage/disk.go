@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DiskStore keeps one file per key below a root directory.
+// writes are serialized inside the process, several processes must not share the same directory.
+type DiskStore struct {
+	mu   sync.Mutex
+	root string
+}
+
+// NewDiskStore returns a DiskStore rooted at dir, creating it when needed.
+func NewDiskStore(dir string) (*DiskStore, error) {
+	if strings.TrimSpace(dir) == "" {
+		return nil, fmt.Errorf("storage: disk store needs a directory")
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("storage: cannot create directory %s: %w", dir, err)
+	}
+	return &DiskStore{root: dir}, nil
+}
+
+func (d *DiskStore) path(key string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(d.root, filepath.FromSlash(key)), nil
+}
+
+func (d *DiskStore) Get(_ context.Context, key string) ([]byte, error) {
+	p, err := d.path(key)
+	if err != nil {
+		return nil, err
+	}
+	v, err := os.ReadFile(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return v, err
+}
+
+func (d *DiskStore) Put(_ context.Context, key string, value []byte) error {
+	p, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return writeFileAtomic(p, value)
+}
+
+func (d *DiskStore) Delete(_ context.Context, key string) error {
+	p, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (d *DiskStore) List(_ context.Context, prefix string) ([]string, error) {
+	var keys []string
+	err := filepath.WalkDir(d.root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || strings.HasSuffix(p, ".tmp") {
+			return nil
+		}
+		rel, err := filepath.Rel(d.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	slices.Sort(keys)
+	return keys, err
+}
+
+func (d *DiskStore) Append(_ context.Context, key string, value []byte) error {
+	p, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(p), 0750); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(p, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(value)
+	return err
+}
+
+func (d *DiskStore) Incr(_ context.Context, key string, delta int64) (int64, error) {
+	p, err := d.path(key)
+	if err != nil {
+		return 0, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	v, err := os.ReadFile(p)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, err
+	}
+	n, err := parseCounter(v)
+	if err != nil {
+		return 0, err
+	}
+	n += delta
+	return n, writeFileAtomic(p, []byte(strconv.FormatInt(n, 10)))
+}
+
+// writeFileAtomic writes to a temporary file then renames it, so readers never see a partial value.
+func writeFileAtomic(p string, value []byte) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0750); err != nil {
+		return err
+	}
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, value, 0640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
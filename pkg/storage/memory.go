@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MemoryStore keeps everything in a map, it is meant for development and single process deployments.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	values map[string][]byte
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{values: make(map[string][]byte)}
+}
+
+func (m *MemoryStore) Get(_ context.Context, key string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	v, ok := m.values[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return slices.Clone(v), nil
+}
+
+func (m *MemoryStore) Put(_ context.Context, key string, value []byte) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[key] = slices.Clone(value)
+	return nil
+}
+
+func (m *MemoryStore) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.values, key)
+	return nil
+}
+
+func (m *MemoryStore) List(_ context.Context, prefix string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var keys []string
+	for k := range m.values {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
+
+func (m *MemoryStore) Append(_ context.Context, key string, value []byte) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[key] = append(m.values[key], value...)
+	return nil
+}
+
+func (m *MemoryStore) Incr(_ context.Context, key string, delta int64) (int64, error) {
+	if err := validateKey(key); err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, err := parseCounter(m.values[key])
+	if err != nil {
+		return 0, err
+	}
+	n += delta
+	m.values[key] = []byte(strconv.FormatInt(n, 10))
+	return n, nil
+}
+
+// parseCounter decodes the value of a counter, a missing value counts as zero.
+func parseCounter(v []byte) (int64, error) {
+	s := strings.TrimSpace(string(v))
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
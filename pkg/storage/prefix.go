@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"strings"
+)
+
+// PrefixStore keeps its keys below a prefix of another store, so that several sites share a store without seeing
+// the keys of each other.
+type PrefixStore struct {
+	store  Store
+	prefix string // ends with a /
+}
+
+// NewPrefixStore returns the store of the keys of store below prefix, like "tenants/example.com".
+func NewPrefixStore(store Store, prefix string) *PrefixStore {
+	return &PrefixStore{store: store, prefix: strings.Trim(prefix, "/") + "/"}
+}
+
+func (p *PrefixStore) Get(ctx context.Context, key string) ([]byte, error) {
+	return p.store.Get(ctx, p.prefix+key)
+}
+
+func (p *PrefixStore) Put(ctx context.Context, key string, value []byte) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	return p.store.Put(ctx, p.prefix+key, value)
+}
+
+func (p *PrefixStore) Delete(ctx context.Context, key string) error {
+	return p.store.Delete(ctx, p.prefix+key)
+}
+
+func (p *PrefixStore) List(ctx context.Context, prefix string) ([]string, error) {
+	keys, err := p.store.List(ctx, p.prefix+prefix)
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range keys {
+		keys[i] = strings.TrimPrefix(key, p.prefix)
+	}
+	return keys, nil
+}
+
+func (p *PrefixStore) Append(ctx context.Context, key string, value []byte) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	return p.store.Append(ctx, p.prefix+key, value)
+}
+
+func (p *PrefixStore) Incr(ctx context.Context, key string, delta int64) (int64, error) {
+	if err := validateKey(key); err != nil {
+		return 0, err
+	}
+	return p.store.Incr(ctx, p.prefix+key, delta)
+}
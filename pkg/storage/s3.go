@@ -0,0 +1,332 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lao-tseu-is-alive/JsonSiteGo/internal/sigv4"
+)
+
+const (
+	s3RequestTimeout = 30 * time.Second
+	s3WriteRetries   = 5                     // times Append and Incr read and write again after a concurrent write
+	s3RetryDelay     = 50 * time.Millisecond // multiplied by the attempt, with a jitter
+)
+
+// errS3Conflict is returned by a conditional write when the object was changed by another writer.
+var errS3Conflict = errors.New("storage: s3 object changed by another writer")
+
+// S3Store keeps one object per key in an S3 compatible bucket (AWS, MinIO, Exoscale, ...).
+// requests are signed with AWS Signature Version 4 and use path-style urls.
+// Append and Incr are read-modify-write operations using conditional writes, If-None-Match for a new object and
+// If-Match with its ETag for an existing one, read and written again when another replica wrote in between. with
+// a provider ignoring these headers, the last writer wins, so a single replica must write the same keys.
+type S3Store struct {
+	mu       sync.Mutex // serializes Append and Incr inside the process, saving the conflicts between its goroutines
+	endpoint string     // like https://s3.eu-central-1.amazonaws.com
+	region   string
+	bucket   string
+	prefix   string
+	creds    sigv4.Credentials
+	client   *http.Client
+}
+
+// NewS3StoreFromEnv returns an S3Store for bucket using AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, the
+// AWS_SESSION_TOKEN of temporary credentials, AWS_REGION (default us-east-1) and the optional S3_ENDPOINT for non
+// AWS providers.
+func NewS3StoreFromEnv(bucket, prefix string) (*S3Store, error) {
+	if bucket == "" {
+		return nil, fmt.Errorf("storage: s3 store needs a bucket like s3://bucket/prefix")
+	}
+	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return nil, fmt.Errorf("storage: env AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required for s3")
+	}
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := strings.TrimRight(os.Getenv("S3_ENDPOINT"), "/")
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	return &S3Store{
+		endpoint: endpoint,
+		region:   region,
+		bucket:   bucket,
+		prefix:   prefix,
+		creds:    sigv4.Credentials{AccessKey: accessKey, SecretKey: secretKey, SessionToken: os.Getenv("AWS_SESSION_TOKEN")},
+		client:   &http.Client{Timeout: s3RequestTimeout},
+	}, nil
+}
+
+func (s *S3Store) objectName(key string) string {
+	if s.prefix == "" {
+		return key
+	}
+	return s.prefix + "/" + key
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) ([]byte, error) {
+	value, _, err := s.getObject(ctx, key)
+	return value, err
+}
+
+// getObject returns the value of key and its ETag, or ErrNotFound.
+func (s *S3Store) getObject(ctx context.Context, key string) ([]byte, string, error) {
+	if err := validateKey(key); err != nil {
+		return nil, "", err
+	}
+	resp, err := s.do(ctx, http.MethodGet, s.objectName(key), nil, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, "", ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", s3Error(resp)
+	}
+	value, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	return value, resp.Header.Get("ETag"), nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, value []byte) error {
+	return s.putObject(ctx, key, value, nil)
+}
+
+// putObject writes value to key with the conditions of header, errS3Conflict is returned when they fail.
+func (s *S3Store) putObject(ctx context.Context, key string, value []byte, header http.Header) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodPut, s.objectName(key), nil, header, value)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		// 409 is returned when a concurrent conditional write is in progress
+		return errS3Conflict
+	default:
+		return s3Error(resp)
+	}
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodDelete, s.objectName(key), nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+// s3ListResult is the subset of the ListObjectsV2 response we need.
+type s3ListResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *S3Store) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.objectName(prefix)}}
+		if s.prefix != "" && prefix == "" {
+			query.Set("prefix", s.prefix+"/")
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := s3Error(resp)
+			resp.Body.Close()
+			return nil, err
+		}
+		var result s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("storage: error decoding s3 list response: %w", err)
+		}
+		for _, c := range result.Contents {
+			key := c.Key
+			if s.prefix != "" {
+				key = strings.TrimPrefix(key, s.prefix+"/")
+			}
+			keys = append(keys, key)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
+
+func (s *S3Store) Append(ctx context.Context, key string, value []byte) error {
+	return s.update(ctx, key, func(current []byte) ([]byte, error) {
+		return append(current, value...), nil
+	})
+}
+
+func (s *S3Store) Incr(ctx context.Context, key string, delta int64) (int64, error) {
+	var n int64
+	err := s.update(ctx, key, func(current []byte) ([]byte, error) {
+		value, err := parseCounter(current)
+		if err != nil {
+			return nil, err
+		}
+		n = value + delta
+		return []byte(strconv.FormatInt(n, 10)), nil
+	})
+	return n, err
+}
+
+// update replaces the value of key by the result of change with a conditional write, read and written again when
+// another writer changed it in between.
+func (s *S3Store) update(ctx context.Context, key string, change func(current []byte) ([]byte, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for attempt := 1; ; attempt++ {
+		current, etag, err := s.getObject(ctx, key)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		value, err := change(current)
+		if err != nil {
+			return err
+		}
+		header := http.Header{}
+		if etag == "" {
+			header.Set("If-None-Match", "*")
+		} else {
+			header.Set("If-Match", etag)
+		}
+		err = s.putObject(ctx, key, value, header)
+		if !errors.Is(err, errS3Conflict) {
+			return err
+		}
+		if attempt > s3WriteRetries {
+			return fmt.Errorf("storage: s3 %s still changed by another writer after %d attempts: %w", key, attempt, err)
+		}
+		delay := time.Duration(attempt)*s3RetryDelay + rand.N(s3RetryDelay)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// do sends a signed request for the object name (or the bucket itself when name is empty), with the headers of
+// header signed too.
+func (s *S3Store) do(ctx context.Context, method, name string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	path := "/" + s.bucket
+	if name != "" {
+		path += "/" + name
+	}
+	rawQuery := canonicalQueryString(query)
+	u := s.endpoint + s3EscapePath(path)
+	if rawQuery != "" {
+		u += "?" + rawQuery
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("storage: error creating s3 request: %w", err)
+	}
+	req.ContentLength = int64(len(body))
+	names := make([]string, 0, len(header))
+	for name, values := range header {
+		req.Header[name] = values
+		names = append(names, name)
+	}
+	s.sign(req, path, rawQuery, body, names, time.Now().UTC())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("storage: s3 %s %s failed: %w", method, name, err)
+	}
+	return resp, nil
+}
+
+// sign adds the AWS Signature Version 4 headers to req, signing the headers of names too.
+func (s *S3Store) sign(req *http.Request, path, rawQuery string, body []byte, names []string, now time.Time) {
+	payloadHash := sigv4.SHA256Hex(body)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	sigv4.Sign(req, s.creds, s.region, "s3", s3EscapePath(path), rawQuery, payloadHash, append(names, "x-amz-content-sha256"), now)
+}
+
+// canonicalQueryString encodes the query sorted by key with RFC 3986 escaping, as required by SigV4.
+func canonicalQueryString(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, s3Escape(k)+"="+s3Escape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3EscapePath escapes every segment of the path but keeps the slashes.
+func s3EscapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		segments[i] = s3Escape(seg)
+	}
+	return strings.Join(segments, "/")
+}
+
+// s3Escape is url.QueryEscape with the RFC 3986 rules expected by SigV4.
+func s3Escape(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(url.QueryEscape(s), "+", "%20"), "%7E", "~")
+}
+
+func s3Error(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("storage: s3 returned status %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 is a bucket supporting the conditional writes of S3, If-None-Match: * and If-Match with an ETag.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	etags   map[string]string
+	version int
+	t       *testing.T
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	for _, name := range []string{"x-amz-security-token", "x-amz-content-sha256"} {
+		if !strings.Contains(auth, name) {
+			f.t.Errorf("%s %s: %s is not signed in %q", r.Method, r.URL.Path, name, auth)
+		}
+	}
+	if r.Header.Get("x-amz-security-token") != "session-token" {
+		f.t.Errorf("%s %s: x-amz-security-token = %q", r.Method, r.URL.Path, r.Header.Get("x-amz-security-token"))
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodGet:
+		value, found := f.objects[r.URL.Path]
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", f.etags[r.URL.Path])
+		w.Write(value)
+	case http.MethodPut:
+		for _, name := range []string{"If-None-Match", "If-Match"} {
+			if r.Header.Get(name) != "" && !strings.Contains(auth, strings.ToLower(name)) {
+				f.t.Errorf("PUT %s: %s is not signed in %q", r.URL.Path, name, auth)
+			}
+		}
+		_, found := f.objects[r.URL.Path]
+		if (r.Header.Get("If-None-Match") == "*" && found) || (r.Header.Get("If-Match") != "" && r.Header.Get("If-Match") != f.etags[r.URL.Path]) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		value, _ := io.ReadAll(r.Body)
+		f.version++
+		f.objects[r.URL.Path], f.etags[r.URL.Path] = value, fmt.Sprintf(`"%d"`, f.version)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestS3StoreConcurrentWriters(t *testing.T) {
+	bucket := &fakeS3{objects: make(map[string][]byte), etags: make(map[string]string), t: t}
+	server := httptest.NewServer(bucket)
+	defer server.Close()
+	t.Setenv("AWS_ACCESS_KEY_ID", "key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "session-token")
+	t.Setenv("S3_ENDPOINT", server.URL)
+	// two stores are two replicas, their writes are only ordered by the conditional writes
+	var replicas []*S3Store
+	for range 2 {
+		store, err := NewS3StoreFromEnv("bucket", "site")
+		if err != nil {
+			t.Fatal(err)
+		}
+		replicas = append(replicas, store)
+	}
+	const writes = 10
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i, store := range replicas {
+		for j := range writes {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := store.Incr(ctx, "counters/visits", 1); err != nil {
+					t.Errorf("Incr() error = %v", err)
+				}
+				if err := store.Append(ctx, "submissions/contact.jsonl", []byte(fmt.Sprintf("%d-%d\n", i, j))); err != nil {
+					t.Errorf("Append() error = %v", err)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	counter, err := replicas[0].Get(ctx, "counters/visits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(counter); got != fmt.Sprint(2*writes) {
+		t.Errorf("counter = %s, want %d", got, 2*writes)
+	}
+	lines, err := replicas[1].Get(ctx, "submissions/contact.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(lines), "\n"); got != 2*writes {
+		t.Errorf("appended lines = %d, want %d", got, 2*writes)
+	}
+}
+
+func TestIsInMemory(t *testing.T) {
+	disk, err := NewDiskStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		store Store
+		want  bool
+	}{
+		{name: "memory", store: NewMemoryStore(), want: true},
+		{name: "prefix of memory", store: NewPrefixStore(NewMemoryStore(), "tenants/a"), want: true},
+		{name: "disk", store: disk},
+		{name: "prefix of disk", store: NewPrefixStore(disk, "tenants/a")},
+	}
+	for _, tt := range tests {
+		if got := IsInMemory(tt.store); got != tt.want {
+			t.Errorf("IsInMemory(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Package storage defines the key/value and blob storage used for the runtime state of the server
+// (form submissions, caches, counters, ...) so that it works the same on a single node with a local disk
+// and on stateless replicas sharing an S3 bucket.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ErrNotFound is returned by Get when the key does not exist.
+var ErrNotFound = errors.New("storage: key not found")
+
+// Store is a flat key/value store where values can be small records or whole blobs.
+// keys use "/" as separator like "submissions/contact.jsonl".
+type Store interface {
+	// Get returns the value of key or ErrNotFound.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Put creates or replaces the value of key.
+	Put(ctx context.Context, key string, value []byte) error
+	// Delete removes key, deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+	// List returns the sorted keys starting with prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+	// Append adds value at the end of key, creating it when needed.
+	Append(ctx context.Context, key string, value []byte) error
+	// Incr adds delta to the integer counter stored in key and returns the new value.
+	Incr(ctx context.Context, key string, delta int64) (int64, error)
+}
+
+// New returns the Store described by rawURL :
+//   - memory://                  in process only, lost at restart (default when rawURL is empty)
+//   - file:///var/lib/site       one file per key below the directory
+//   - s3://bucket/optional/prefix using the AWS_* and S3_ENDPOINT env variables
+func New(rawURL string) (Store, error) {
+	if strings.TrimSpace(rawURL) == "" {
+		return NewMemoryStore(), nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("storage: invalid url %q: %w", rawURL, err)
+	}
+	switch u.Scheme {
+	case "memory":
+		return NewMemoryStore(), nil
+	case "file":
+		dir := u.Path
+		if u.Host != "" {
+			// file://./data is parsed with "." as host, keep it as a relative path
+			dir = u.Host + u.Path
+		}
+		return NewDiskStore(dir)
+	case "s3":
+		return NewS3StoreFromEnv(u.Host, strings.Trim(u.Path, "/"))
+	default:
+		return nil, fmt.Errorf("storage: unsupported scheme %q in %q", u.Scheme, rawURL)
+	}
+}
+
+// IsInMemory reports whether store keeps its values in the process only, so that they are neither shared by the
+// replicas nor kept across the restarts.
+func IsInMemory(store Store) bool {
+	switch s := store.(type) {
+	case *MemoryStore:
+		return true
+	case *PrefixStore:
+		return IsInMemory(s.store)
+	default:
+		return false
+	}
+}
+
+// validateKey rejects the keys that could escape the storage root.
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("storage: invalid key %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("storage: invalid key %q", key)
+		}
+	}
+	return nil
+}
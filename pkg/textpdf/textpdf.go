@@ -0,0 +1,253 @@
+// Package textpdf writes simple text documents (headings, paragraphs and list items) as PDF files
+// using the standard Helvetica fonts, so that no font has to be embedded and no external tool is needed.
+package textpdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+const (
+	pageWidth  = 595.0 // A4 in points
+	pageHeight = 842.0
+	margin     = 56.0
+	bodySize   = 11.0
+	lineFactor = 1.35 // line height relative to the font size
+)
+
+// blockKind is the kind of a block of text, it gives its font and spacing.
+type blockKind int
+
+const (
+	kindParagraph blockKind = iota
+	kindHeading1
+	kindHeading2
+	kindHeading3
+	kindListItem
+)
+
+type block struct {
+	kind blockKind
+	text string
+}
+
+// Document is a list of text blocks laid out on A4 pages when written.
+type Document struct {
+	title  string
+	blocks []block
+}
+
+// New returns an empty Document, the title is stored in the PDF metadata.
+func New(title string) *Document {
+	return &Document{title: title}
+}
+
+// AddHeading adds a heading of level 1 to 3, deeper levels use the level 3 style.
+func (d *Document) AddHeading(level int, text string) {
+	kind := kindHeading3
+	switch level {
+	case 1:
+		kind = kindHeading1
+	case 2:
+		kind = kindHeading2
+	}
+	d.add(kind, text)
+}
+
+// AddParagraph adds a paragraph, the white space is normalized.
+func (d *Document) AddParagraph(text string) {
+	d.add(kindParagraph, text)
+}
+
+// AddListItem adds an item of a bullet list.
+func (d *Document) AddListItem(text string) {
+	d.add(kindListItem, text)
+}
+
+func (d *Document) add(kind blockKind, text string) {
+	text = strings.Join(strings.Fields(text), " ")
+	if text != "" {
+		d.blocks = append(d.blocks, block{kind: kind, text: text})
+	}
+}
+
+// style returns the font resource name, the font size and the space before a block.
+func (k blockKind) style() (font string, size, spaceBefore float64) {
+	switch k {
+	case kindHeading1:
+		return "F2", 20, 8
+	case kindHeading2:
+		return "F2", 15, 14
+	case kindHeading3:
+		return "F2", 12.5, 12
+	case kindListItem:
+		return "F1", bodySize, 2
+	default:
+		return "F1", bodySize, 8
+	}
+}
+
+func (k blockKind) isHeading() bool {
+	return k == kindHeading1 || k == kindHeading2 || k == kindHeading3
+}
+
+// Bytes lays out the document and returns the PDF file.
+func (d *Document) Bytes() ([]byte, error) {
+	var pages []string
+	var page strings.Builder
+	y := pageHeight - margin
+	newPage := func() {
+		pages = append(pages, page.String())
+		page.Reset()
+		y = pageHeight - margin
+	}
+	for _, b := range d.blocks {
+		font, size, spaceBefore := b.kind.style()
+		indent := 0.0
+		if b.kind == kindListItem {
+			indent = 14
+		}
+		lineHeight := size * lineFactor
+		lines := wrapText(b.text, size, font == "F2", pageWidth-2*margin-indent)
+		if y != pageHeight-margin {
+			y -= spaceBefore
+		}
+		for i, line := range lines {
+			// keep a heading on the same page as the first line of the next block
+			needed := lineHeight
+			if b.kind.isHeading() && i == len(lines)-1 {
+				needed += bodySize * lineFactor * 2
+			}
+			if y-needed < margin {
+				newPage()
+			}
+			y -= lineHeight
+			if b.kind == kindListItem && i == 0 {
+				// \x95 is the bullet in the WinAnsi encoding
+				fmt.Fprintf(&page, "BT /%s %.1f Tf %.2f %.2f Td (\x95) Tj ET\n", font, size, margin+4, y)
+			}
+			fmt.Fprintf(&page, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, margin+indent, y, escapePDFString(encodeWinAnsi(line)))
+		}
+	}
+	if page.Len() > 0 || len(pages) == 0 {
+		newPage()
+	}
+	return d.write(pages), nil
+}
+
+// write assembles the objects of the PDF file : catalog, pages tree, fonts, info and one page and stream by page.
+func (d *Document) write(pages []string) []byte {
+	var buf bytes.Buffer
+	var offsets []int
+	addObject := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	const firstPageObject = 6
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPageObject+2*i)
+	}
+	addObject("<< /Type /Catalog /Pages 2 0 R >>")
+	addObject(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	addObject("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	addObject("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	addObject(fmt.Sprintf("<< /Title (%s) /Producer (textpdf) >>", escapePDFString(encodeWinAnsi(d.title))))
+	for i, content := range pages {
+		addObject(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, firstPageObject+2*i+1))
+		addObject(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(content), content))
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return buf.Bytes()
+}
+
+// escapePDFString escapes the characters having a meaning inside a PDF literal string.
+func escapePDFString(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`, "\r", `\r`, "\n", `\n`).Replace(s)
+}
+
+// encodeWinAnsi converts s to the WinAnsi encoding of the standard fonts, the missing characters become a question mark.
+func encodeWinAnsi(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		b, ok := charmap.Windows1252.EncodeRune(r)
+		if !ok {
+			b = '?'
+		}
+		sb.WriteByte(b)
+	}
+	return sb.String()
+}
+
+// helveticaWidths are the widths of the ascii characters from space to tilde in the Helvetica font, per 1000 units.
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278, // space to /
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, // 0 to 9
+	278, 278, 584, 584, 584, 556, 1015, // : to @
+	667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778, 667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, // A to Z
+	278, 278, 278, 469, 556, 333, // [ to `
+	556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556, 556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, // a to z
+	334, 260, 334, 584, // { to ~
+}
+
+// textWidth returns the width of s in points, the bold font is approximated as 10% wider.
+func textWidth(s string, size float64, bold bool) float64 {
+	units := 0
+	for _, r := range s {
+		if r >= ' ' && r <= '~' {
+			units += helveticaWidths[r-' ']
+		} else {
+			units += 556
+		}
+	}
+	w := float64(units) * size / 1000
+	if bold {
+		w *= 1.1
+	}
+	return w
+}
+
+// wrapText splits text in lines fitting in width, a word longer than a line is cut.
+func wrapText(text string, size float64, bold bool, width float64) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		for textWidth(word, size, bold) > width {
+			// cut the long word at the last rune that fits
+			runes := []rune(word)
+			n := len(runes) - 1
+			for n > 1 && textWidth(string(runes[:n]), size, bold) > width {
+				n--
+			}
+			if line != "" {
+				lines = append(lines, line)
+				line = ""
+			}
+			lines = append(lines, string(runes[:n]))
+			word = string(runes[n:])
+		}
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if textWidth(candidate, size, bold) > width && line != "" {
+			lines = append(lines, line)
+			candidate = word
+		}
+		line = candidate
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,182 @@
+// Package update tells whether a newer release of the server than the running version is published on GitHub.
+// the comparison of the versions is apart from the http call, so that it can be used alone.
+package update
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GitHubAPI is the base url of the GitHub api.
+const GitHubAPI = "https://api.github.com"
+
+// Release is a published release of a repository.
+type Release struct {
+	Version     string    `json:"version"` // the tag, like v1.2.3
+	URL         string    `json:"url"`     // html page of the release
+	PublishedAt time.Time `json:"publishedAt"`
+}
+
+// Status is the result of a check.
+type Status struct {
+	Current   string    `json:"current"`
+	Latest    string    `json:"latest"`
+	Available bool      `json:"available"` // latest is newer than current
+	URL       string    `json:"url"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// semver is a parsed version major.minor.patch with an optional pre-release, the build metadata is ignored.
+type semver struct {
+	numbers    [3]int
+	preRelease []string
+}
+
+// parse parses a version like 1.2.3, v1.2 or 1.2.3-rc.1+build.
+func parse(v string) (semver, error) {
+	var s semver
+	rest := strings.TrimPrefix(strings.TrimSpace(v), "v")
+	rest, _, _ = strings.Cut(rest, "+")
+	rest, pre, hasPre := strings.Cut(rest, "-")
+	parts := strings.Split(rest, ".")
+	if len(parts) > 3 {
+		return s, fmt.Errorf("invalid version %q", v)
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return s, fmt.Errorf("invalid version %q", v)
+		}
+		s.numbers[i] = n
+	}
+	if hasPre {
+		if pre == "" {
+			return s, fmt.Errorf("invalid version %q", v)
+		}
+		s.preRelease = strings.Split(pre, ".")
+	}
+	return s, nil
+}
+
+// Compare returns -1, 0 or +1 when a is older, the same or newer than b, in the order of semantic versioning:
+// a pre-release like 1.2.0-rc.1 is older than 1.2.0.
+func Compare(a, b string) (int, error) {
+	va, err := parse(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := parse(b)
+	if err != nil {
+		return 0, err
+	}
+	for i := range va.numbers {
+		if c := compareInt(va.numbers[i], vb.numbers[i]); c != 0 {
+			return c, nil
+		}
+	}
+	switch {
+	case len(va.preRelease) == 0 && len(vb.preRelease) == 0:
+		return 0, nil
+	case len(va.preRelease) == 0:
+		return 1, nil
+	case len(vb.preRelease) == 0:
+		return -1, nil
+	}
+	for i := 0; i < len(va.preRelease) && i < len(vb.preRelease); i++ {
+		if c := comparePreRelease(va.preRelease[i], vb.preRelease[i]); c != 0 {
+			return c, nil
+		}
+	}
+	return compareInt(len(va.preRelease), len(vb.preRelease)), nil
+}
+
+// IsNewer reports whether latest is newer than current, false when one of them is not a version.
+func IsNewer(latest, current string) bool {
+	c, err := Compare(latest, current)
+	return err == nil && c > 0
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// comparePreRelease compares an identifier of two pre-releases, the numeric ones are lower than the others.
+func comparePreRelease(a, b string) int {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return compareInt(na, nb)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// LatestRelease returns the latest release of repository, like https://github.com/owner/name, from the api at
+// apiURL, usually GitHubAPI. the drafts and the pre-releases are not returned by GitHub.
+func LatestRelease(ctx context.Context, client *http.Client, apiURL, repository string) (*Release, error) {
+	u, err := url.Parse(repository)
+	if err != nil {
+		return nil, fmt.Errorf("update: invalid repository %q: %w", repository, err)
+	}
+	path := strings.Trim(strings.TrimSuffix(u.Path, ".git"), "/")
+	if strings.Count(path, "/") != 1 {
+		return nil, fmt.Errorf("update: the repository %q is not like https://github.com/owner/name", repository)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(apiURL, "/")+"/repos/"+path+"/releases/latest", nil)
+	if err != nil {
+		return nil, fmt.Errorf("update: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("update: error getting the latest release: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errors.New("update: the repository has no release")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("update: error getting the latest release: status %s", resp.Status)
+	}
+	var body struct {
+		TagName     string    `json:"tag_name"`
+		HTMLURL     string    `json:"html_url"`
+		PublishedAt time.Time `json:"published_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("update: error decoding the latest release: %w", err)
+	}
+	return &Release{Version: body.TagName, URL: body.HTMLURL, PublishedAt: body.PublishedAt}, nil
+}
+
+// Check compares current with the latest release of repository.
+func Check(ctx context.Context, client *http.Client, apiURL, repository, current string) (*Status, error) {
+	release, err := LatestRelease(ctx, client, apiURL, repository)
+	if err != nil {
+		return nil, err
+	}
+	return &Status{
+		Current:   current,
+		Latest:    release.Version,
+		Available: IsNewer(release.Version, current),
+		URL:       release.URL,
+		CheckedAt: time.Now(),
+	}, nil
+}
@@ -0,0 +1,130 @@
+package update
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b    string
+		want    int
+		wantErr bool
+	}{
+		{a: "1.2.3", b: "1.2.3", want: 0},
+		{a: "v1.2.3", b: "1.2.3", want: 0},
+		{a: "1.2", b: "1.2.0", want: 0},
+		{a: "1", b: "1.0.0", want: 0},
+		{a: "1.2.4", b: "1.2.3", want: 1},
+		{a: "1.10.0", b: "1.9.9", want: 1},
+		{a: "2.0.0", b: "1.99.99", want: 1},
+		{a: "1.2.3", b: "1.3", want: -1},
+		{a: "1.2.0-rc.1", b: "1.2.0", want: -1},
+		{a: "1.2.0", b: "1.2.0-rc.1", want: 1},
+		{a: "1.2.0-rc.2", b: "1.2.0-rc.10", want: -1},
+		{a: "1.2.0-alpha", b: "1.2.0-beta", want: -1},
+		{a: "1.2.0-1", b: "1.2.0-alpha", want: -1},
+		{a: "1.2.0-alpha.1", b: "1.2.0-alpha", want: 1},
+		{a: "1.2.0+build.5", b: "1.2.0+build.7", want: 0},
+		{a: "v1.2.0-rc.1+build", b: "1.2.0-rc.1", want: 0},
+		{a: "", b: "1.0.0", wantErr: true},
+		{a: "v", b: "1.0.0", wantErr: true},
+		{a: "1.2.3.4", b: "1.0.0", wantErr: true},
+		{a: "1..2", b: "1.0.0", wantErr: true},
+		{a: "1.x.0", b: "1.0.0", wantErr: true},
+		{a: "1.-2.0", b: "1.0.0", wantErr: true},
+		{a: "1.2.0-", b: "1.0.0", wantErr: true},
+		{a: "1.0.0", b: "dev", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" vs "+tt.b, func(t *testing.T) {
+			got, err := Compare(tt.a, tt.b)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Compare() = %d, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Compare() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Compare() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsNewer(t *testing.T) {
+	if !IsNewer("v1.3.0", "1.2.9") {
+		t.Errorf("IsNewer(v1.3.0, 1.2.9) = false")
+	}
+	if IsNewer("v1.2.0", "v1.2.0") || IsNewer("1.2.0-rc.1", "1.2.0") {
+		t.Errorf("IsNewer() is true for a version not newer")
+	}
+	if IsNewer("v1.3.0", "dev") {
+		t.Errorf("IsNewer() is true for a development build")
+	}
+}
+
+func TestLatestRelease(t *testing.T) {
+	published := time.Date(2026, 9, 1, 12, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/vnd.github+json" {
+			t.Errorf("request without the github accept header: %q", r.Header.Get("Accept"))
+		}
+		switch r.URL.Path {
+		case "/repos/owner/name/releases/latest":
+			w.Write([]byte(`{"tag_name": "v1.4.0", "html_url": "https://github.com/owner/name/releases/tag/v1.4.0", "published_at": "2026-09-01T12:00:00Z"}`))
+		case "/repos/owner/broken/releases/latest":
+			w.Write([]byte(`{"tag_name": `))
+		case "/repos/owner/down/releases/latest":
+			http.Error(w, "rate limited", http.StatusForbidden)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		repository string
+		want       string
+		wantErr    string
+	}{
+		{repository: "https://github.com/owner/name", want: "v1.4.0"},
+		{repository: "https://github.com/owner/name.git", want: "v1.4.0"},
+		{repository: "https://github.com/owner/name/", want: "v1.4.0"},
+		{repository: "https://github.com/owner/empty", wantErr: "update: the repository has no release"},
+		{repository: "https://github.com/owner/broken", wantErr: "update: error decoding the latest release: unexpected EOF"},
+		{repository: "https://github.com/owner/down", wantErr: "update: error getting the latest release: status 403 Forbidden"},
+		{repository: "https://github.com/owner", wantErr: `update: the repository "https://github.com/owner" is not like https://github.com/owner/name`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.repository, func(t *testing.T) {
+			release, err := LatestRelease(context.Background(), server.Client(), server.URL+"/", tt.repository)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("LatestRelease() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LatestRelease() error = %v", err)
+			}
+			if release.Version != tt.want || release.URL != "https://github.com/owner/name/releases/tag/v1.4.0" || !release.PublishedAt.Equal(published) {
+				t.Errorf("LatestRelease() = %+v", release)
+			}
+		})
+	}
+
+	status, err := Check(context.Background(), server.Client(), server.URL, "https://github.com/owner/name", "v1.3.2")
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if !status.Available || status.Latest != "v1.4.0" || status.Current != "v1.3.2" {
+		t.Errorf("Check() = %+v, want v1.4.0 available", status)
+	}
+}
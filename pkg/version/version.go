@@ -1,10 +1,56 @@
 package version
 
+import (
+	"runtime"
+	"runtime/debug"
+)
+
 var (
 	APP        = "jsonSiteGo"
 	AppSnake   = "json-site-go"
 	VERSION    = "0.2.6"
-	REPOSITORY = "https://github.com/lao-tseu-is-alive/json-site-go"
+	REPOSITORY = "https://github.com/lao-tseu-is-alive/JsonSiteGo"
 	REVISION   = "unknown"
 	BuildStamp = "unknown"
+	COMMIT     = "unknown" // full hash of the git commit, injected with -X like REVISION and BuildStamp
+	// SchemaVersion is the version of config.schema.json, increased when a change of the schema rejects configs
+	// that were valid before
+	SchemaVersion = "1"
 )
+
+// Info describes the running build.
+type Info struct {
+	App           string `json:"app"`
+	Version       string `json:"version"`
+	Revision      string `json:"revision"`
+	Commit        string `json:"commit"`
+	BuildDate     string `json:"buildDate"`
+	GoVersion     string `json:"goVersion"`
+	SchemaVersion string `json:"schemaVersion"`
+	Repository    string `json:"repository"`
+}
+
+// Get returns the info of the running build, the commit falls back on the one recorded by go build when it was
+// not injected.
+func Get() Info {
+	commit := COMMIT
+	if commit == "unknown" {
+		if info, ok := debug.ReadBuildInfo(); ok {
+			for _, setting := range info.Settings {
+				if setting.Key == "vcs.revision" {
+					commit = setting.Value
+				}
+			}
+		}
+	}
+	return Info{
+		App:           APP,
+		Version:       VERSION,
+		Revision:      REVISION,
+		Commit:        commit,
+		BuildDate:     BuildStamp,
+		GoVersion:     runtime.Version(),
+		SchemaVersion: SchemaVersion,
+		Repository:    REPOSITORY,
+	}
+}